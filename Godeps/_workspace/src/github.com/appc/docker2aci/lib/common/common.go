@@ -9,6 +9,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -29,6 +30,9 @@ const (
 	appcDockerV1Tag           = "appc.io/docker/v1/tag"
 	appcDockerV1ImageID       = "appc.io/docker/v1/imageid"
 	appcDockerV1ParentImageID = "appc.io/docker/v1/parentimageid"
+	appcDockerEntrypoint      = "appc.io/docker/entrypoint"
+	appcDockerCmd             = "appc.io/docker/cmd"
+	appcDockerHealthcheck     = "appc.io/docker/healthcheck"
 )
 
 func ParseDockerURL(arg string) *types.ParsedDockerURL {
@@ -170,6 +174,16 @@ func GenerateManifest(layerData types.DockerImageData, dockerURL *types.ParsedDo
 	annotations = append(annotations, appctypes.Annotation{Name: *appctypes.MustACIdentifier(appcDockerV1ImageID), Value: layerData.ID})
 	annotations = append(annotations, appctypes.Annotation{Name: *appctypes.MustACIdentifier(appcDockerV1ParentImageID), Value: layerData.Parent})
 
+	if dockerConfig != nil {
+		// record the original entrypoint, cmd and healthcheck, which can't be
+		// represented exactly in the app of the manifest
+		configAnnotations, err := getConfigAnnotations(dockerConfig)
+		if err != nil {
+			return nil, err
+		}
+		annotations = append(annotations, configAnnotations...)
+	}
+
 	genManifest.Labels = labels
 	genManifest.Annotations = annotations
 
@@ -280,11 +294,43 @@ func parseDockerPort(dockerPort string) (*appctypes.Port, error) {
 	return appcPort, nil
 }
 
+// getConfigAnnotations returns the annotations holding the entrypoint, cmd
+// and healthcheck of the docker image as JSON, for the ones that are set.
+func getConfigAnnotations(dockerConfig *types.DockerImageConfig) (appctypes.Annotations, error) {
+	var annotations appctypes.Annotations
+	for _, a := range []struct {
+		name  string
+		isSet bool
+		value interface{}
+	}{
+		{appcDockerEntrypoint, dockerConfig.Entrypoint != nil, dockerConfig.Entrypoint},
+		{appcDockerCmd, dockerConfig.Cmd != nil, dockerConfig.Cmd},
+		{appcDockerHealthcheck, dockerConfig.Healthcheck != nil, dockerConfig.Healthcheck},
+	} {
+		if !a.isSet {
+			continue
+		}
+		b, err := json.Marshal(a.value)
+		if err != nil {
+			return nil, err
+		}
+		annotations = append(annotations, appctypes.Annotation{Name: *appctypes.MustACIdentifier(a.name), Value: string(b)})
+	}
+	return annotations, nil
+}
+
 func convertVolumesToMPs(dockerVolumes map[string]struct{}) ([]appctypes.MountPoint, error) {
 	mps := []appctypes.MountPoint{}
 	dup := make(map[string]int)
 
+	// sort the paths so the names of the mount points are stable
+	var paths []string
 	for p := range dockerVolumes {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	for _, p := range paths {
 		n := filepath.Join("volume", p)
 		sn, err := appctypes.SanitizeACName(n)
 		if err != nil {
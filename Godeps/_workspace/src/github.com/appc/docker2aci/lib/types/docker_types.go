@@ -62,6 +62,26 @@ type DockerImageConfig struct {
 	NetworkDisabled bool
 	MacAddress      string
 	OnBuild         []string
+	Healthcheck     *DockerHealthConfig
+}
+
+// DockerHealthConfig holds the HEALTHCHECK of an image
+// Taken from upstream Docker
+type DockerHealthConfig struct {
+	// Test is the test to perform to check that the container is healthy:
+	// {} inherits the healthcheck of the parent image
+	// {"NONE"} disables the healthcheck
+	// {"CMD", args...} execs the arguments directly
+	// {"CMD-SHELL", command} runs the command with the system's default shell
+	Test []string `json:",omitempty"`
+
+	// Zero means to inherit. Durations are expressed as integer nanoseconds.
+	Interval time.Duration `json:",omitempty"` // Interval is the time to wait between checks.
+	Timeout  time.Duration `json:",omitempty"` // Timeout is the time to wait before considering the check to have hung.
+
+	// Retries is the number of consecutive failures needed to consider a container as unhealthy.
+	// Zero means inherit.
+	Retries int `json:",omitempty"`
 }
 
 // Taken from upstream Docker
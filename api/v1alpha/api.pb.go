@@ -34,6 +34,16 @@ It has these top-level messages:
 	ListenEventsResponse
 	GetLogsRequest
 	GetLogsResponse
+	ExecRequest
+	ExecResponse
+	RunPodRequest
+	RunPodResponse
+	StopPodRequest
+	StopPodResponse
+	RemovePodRequest
+	RemovePodResponse
+	FetchImageRequest
+	FetchImageResponse
 */
 package v1alpha
 
@@ -293,6 +303,12 @@ type Pod struct {
 	Networks []*Network `protobuf:"bytes,5,rep,name=networks" json:"networks,omitempty"`
 	// JSON-encoded byte array that represents the pod manifest of the pod, required.
 	Manifest []byte `protobuf:"bytes,6,opt,name=manifest,proto3" json:"manifest,omitempty"`
+	// Annotations set by the user on the pod with 'rkt run --user-annotation', optional.
+	UserAnnotations []*KeyValue `protobuf:"bytes,7,rep,name=user_annotations" json:"user_annotations,omitempty"`
+	// Labels set by the user on the pod with 'rkt run --user-label', optional.
+	UserLabels []*KeyValue `protobuf:"bytes,8,rep,name=user_labels" json:"user_labels,omitempty"`
+	// Timestamp of when the pod is created, it is the seconds since epoch, optional.
+	CreatedAt int64 `protobuf:"varint,9,opt,name=created_at" json:"created_at,omitempty"`
 }
 
 func (m *Pod) Reset()         { *m = Pod{} }
@@ -313,6 +329,20 @@ func (m *Pod) GetNetworks() []*Network {
 	return nil
 }
 
+func (m *Pod) GetUserAnnotations() []*KeyValue {
+	if m != nil {
+		return m.UserAnnotations
+	}
+	return nil
+}
+
+func (m *Pod) GetUserLabels() []*KeyValue {
+	if m != nil {
+		return m.UserLabels
+	}
+	return nil
+}
+
 type KeyValue struct {
 	// Key part of the key-value pair.
 	Key string `protobuf:"bytes,1,opt" json:"Key,omitempty"`
@@ -339,6 +369,17 @@ type PodFilter struct {
 	NetworkNames []string `protobuf:"bytes,5,rep,name=network_names" json:"network_names,omitempty"`
 	// If not empty, the pods that have any of the annotations will be returned.
 	Annotations []*KeyValue `protobuf:"bytes,6,rep,name=annotations" json:"annotations,omitempty"`
+	// If not empty, the pods that have all of the user annotations will be returned.
+	UserAnnotations []*KeyValue `protobuf:"bytes,7,rep,name=user_annotations" json:"user_annotations,omitempty"`
+	// If not empty, the pods that have all of the user labels will be returned.
+	UserLabels []*KeyValue `protobuf:"bytes,8,rep,name=user_labels" json:"user_labels,omitempty"`
+	// If not empty, the pods that have any of the images(in the apps) with any of the digests will be returned.
+	// A digest can be abbreviated and omit the hash algorithm, e.g. 'sha512-6d2c1f8e' or '6d2c1f8e'.
+	ImageDigests []string `protobuf:"bytes,9,rep,name=image_digests" json:"image_digests,omitempty"`
+	// If set, the pods that are created after this timestamp will be returned.
+	CreatedAfter int64 `protobuf:"varint,10,opt,name=created_after" json:"created_after,omitempty"`
+	// If set, the pods that are created before this timestamp will be returned.
+	CreatedBefore int64 `protobuf:"varint,11,opt,name=created_before" json:"created_before,omitempty"`
 }
 
 func (m *PodFilter) Reset()         { *m = PodFilter{} }
@@ -352,6 +393,20 @@ func (m *PodFilter) GetAnnotations() []*KeyValue {
 	return nil
 }
 
+func (m *PodFilter) GetUserAnnotations() []*KeyValue {
+	if m != nil {
+		return m.UserAnnotations
+	}
+	return nil
+}
+
+func (m *PodFilter) GetUserLabels() []*KeyValue {
+	if m != nil {
+		return m.UserLabels
+	}
+	return nil
+}
+
 // ImageFilter defines the condition that the returned images need to satisfy in ListImages().
 // The conditions are combined by 'AND'.
 type ImageFilter struct {
@@ -374,6 +429,9 @@ type ImageFilter struct {
 	ImportedBefore int64 `protobuf:"varint,7,opt,name=imported_before" json:"imported_before,omitempty"`
 	// If not empty, the images that have any of the annotations will be returned.
 	Annotations []*KeyValue `protobuf:"bytes,8,rep,name=annotations" json:"annotations,omitempty"`
+	// If not empty, the images that have any of the digests will be returned.
+	// A digest can be abbreviated and omit the hash algorithm, e.g. 'sha512-6d2c1f8e' or '6d2c1f8e'.
+	Digests []string `protobuf:"bytes,9,rep,name=digests" json:"digests,omitempty"`
 }
 
 func (m *ImageFilter) Reset()         { *m = ImageFilter{} }
@@ -667,6 +725,137 @@ func (m *GetLogsResponse) Reset()         { *m = GetLogsResponse{} }
 func (m *GetLogsResponse) String() string { return proto.CompactTextString(m) }
 func (*GetLogsResponse) ProtoMessage()    {}
 
+// Request for Exec().
+type ExecRequest struct {
+	// ID of the pod in which the command will be executed, required in the
+	// first request of the stream, ignored afterwards.
+	PodId string `protobuf:"bytes,1,opt,name=pod_id" json:"pod_id,omitempty"`
+	// Name of the app within the pod in which the command will be executed,
+	// optional if the pod contains only one app. Ignored after the first request.
+	AppName string `protobuf:"bytes,2,opt,name=app_name" json:"app_name,omitempty"`
+	// Command to execute with its arguments, required in the first request
+	// of the stream, ignored afterwards.
+	Command []string `protobuf:"bytes,3,rep,name=command" json:"command,omitempty"`
+	// Data written to the standard input of the command, optional.
+	Stdin []byte `protobuf:"bytes,4,opt,name=stdin,proto3" json:"stdin,omitempty"`
+	// If true, then the standard input of the command is closed after
+	// 'stdin' has been written, default is false.
+	CloseStdin bool `protobuf:"varint,5,opt,name=close_stdin" json:"close_stdin,omitempty"`
+}
+
+func (m *ExecRequest) Reset()         { *m = ExecRequest{} }
+func (m *ExecRequest) String() string { return proto.CompactTextString(m) }
+func (*ExecRequest) ProtoMessage()    {}
+
+// Response for Exec().
+type ExecResponse struct {
+	// Data read from the standard output of the command, optional.
+	Stdout []byte `protobuf:"bytes,1,opt,name=stdout,proto3" json:"stdout,omitempty"`
+	// Data read from the standard error of the command, optional.
+	Stderr []byte `protobuf:"bytes,2,opt,name=stderr,proto3" json:"stderr,omitempty"`
+	// If true, then the command has exited and this is the last response
+	// of the stream, default is false.
+	Exited bool `protobuf:"varint,3,opt,name=exited" json:"exited,omitempty"`
+	// Exit code of the command, only valid if 'exited' is true.
+	ExitCode int32 `protobuf:"zigzag32,4,opt,name=exit_code" json:"exit_code,omitempty"`
+}
+
+func (m *ExecResponse) Reset()         { *m = ExecResponse{} }
+func (m *ExecResponse) String() string { return proto.CompactTextString(m) }
+func (*ExecResponse) ProtoMessage()    {}
+
+// Request for RunPod().
+type RunPodRequest struct {
+	// Images to run in the pod, in any form accepted by 'rkt run', required.
+	Images []string `protobuf:"bytes,1,rep,name=images" json:"images,omitempty"`
+	// Additional arguments passed to 'rkt run' before the images, optional.
+	// For example, '--net=host' or '--volume=...'.
+	Args []string `protobuf:"bytes,2,rep,name=args" json:"args,omitempty"`
+	// When to fetch the images and the stage1 image, as 'rkt run --pull-policy':
+	// "never", "new", "update" or "always", optional, default is "new".
+	PullPolicy string `protobuf:"bytes,3,opt,name=pull_policy" json:"pull_policy,omitempty"`
+}
+
+func (m *RunPodRequest) Reset()         { *m = RunPodRequest{} }
+func (m *RunPodRequest) String() string { return proto.CompactTextString(m) }
+func (*RunPodRequest) ProtoMessage()    {}
+
+// Response for RunPod().
+type RunPodResponse struct {
+	// ID of the pod that has been started, required.
+	PodId string `protobuf:"bytes,1,opt,name=pod_id" json:"pod_id,omitempty"`
+}
+
+func (m *RunPodResponse) Reset()         { *m = RunPodResponse{} }
+func (m *RunPodResponse) String() string { return proto.CompactTextString(m) }
+func (*RunPodResponse) ProtoMessage()    {}
+
+// Request for StopPod().
+type StopPodRequest struct {
+	// ID of the pod to stop, required.
+	Id string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	// If true, then the pod is killed instead of being shut down gracefully,
+	// default is false.
+	Force bool `protobuf:"varint,2,opt,name=force" json:"force,omitempty"`
+}
+
+func (m *StopPodRequest) Reset()         { *m = StopPodRequest{} }
+func (m *StopPodRequest) String() string { return proto.CompactTextString(m) }
+func (*StopPodRequest) ProtoMessage()    {}
+
+// Response for StopPod().
+type StopPodResponse struct {
+}
+
+func (m *StopPodResponse) Reset()         { *m = StopPodResponse{} }
+func (m *StopPodResponse) String() string { return proto.CompactTextString(m) }
+func (*StopPodResponse) ProtoMessage()    {}
+
+// Request for RemovePod().
+type RemovePodRequest struct {
+	// ID of the pod to remove, required. The pod must not be running.
+	Id string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+}
+
+func (m *RemovePodRequest) Reset()         { *m = RemovePodRequest{} }
+func (m *RemovePodRequest) String() string { return proto.CompactTextString(m) }
+func (*RemovePodRequest) ProtoMessage()    {}
+
+// Response for RemovePod().
+type RemovePodResponse struct {
+}
+
+func (m *RemovePodResponse) Reset()         { *m = RemovePodResponse{} }
+func (m *RemovePodResponse) String() string { return proto.CompactTextString(m) }
+func (*RemovePodResponse) ProtoMessage()    {}
+
+// Request for FetchImage().
+type FetchImageRequest struct {
+	// Name of the image to fetch, in any form accepted by 'rkt fetch', required.
+	Name string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	// If true, then only the images available in the store are used, default is false.
+	StoreOnly bool `protobuf:"varint,2,opt,name=store_only" json:"store_only,omitempty"`
+	// If true, then the image is fetched ignoring the local store, default is false.
+	NoStore bool `protobuf:"varint,3,opt,name=no_store" json:"no_store,omitempty"`
+	// When to fetch the image, as 'rkt fetch --pull-policy': "never", "new",
+	// "update" or "always", optional. It cannot be used with store_only or no_store.
+	PullPolicy string `protobuf:"bytes,4,opt,name=pull_policy" json:"pull_policy,omitempty"`
+}
+
+func (m *FetchImageRequest) Reset()         { *m = FetchImageRequest{} }
+func (m *FetchImageRequest) String() string { return proto.CompactTextString(m) }
+func (*FetchImageRequest) ProtoMessage()    {}
+
+// Response for FetchImage().
+type FetchImageResponse struct {
+	// ID of the fetched image, required.
+	Id string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+}
+
+func (m *FetchImageResponse) Reset()         { *m = FetchImageResponse{} }
+func (m *FetchImageResponse) String() string { return proto.CompactTextString(m) }
+func (*FetchImageResponse) ProtoMessage()    {}
+
 func init() {
 	proto.RegisterEnum("v1alpha.ImageType", ImageType_name, ImageType_value)
 	proto.RegisterEnum("v1alpha.AppState", AppState_name, AppState_value)
@@ -989,3 +1178,227 @@ var _PublicAPI_serviceDesc = grpc.ServiceDesc{
 		},
 	},
 }
+
+// Client API for ControlAPI service
+
+type ControlAPIClient interface {
+	// Exec executes a command inside an app of a running pod.
+	//
+	// The first request of the stream selects the pod, the app and the command,
+	// the following requests carry the standard input of the command. The
+	// standard output and error of the command are sent via the response stream,
+	// which is closed after the response that carries the exit code.
+	Exec(ctx context.Context, opts ...grpc.CallOption) (ControlAPI_ExecClient, error)
+	// RunPod runs a new pod, it returns once the pod has been started.
+	RunPod(ctx context.Context, in *RunPodRequest, opts ...grpc.CallOption) (*RunPodResponse, error)
+	// StopPod stops a running pod.
+	StopPod(ctx context.Context, in *StopPodRequest, opts ...grpc.CallOption) (*StopPodResponse, error)
+	// RemovePod removes a pod that is not running and all its resources.
+	RemovePod(ctx context.Context, in *RemovePodRequest, opts ...grpc.CallOption) (*RemovePodResponse, error)
+	// FetchImage fetches an image into the local store.
+	FetchImage(ctx context.Context, in *FetchImageRequest, opts ...grpc.CallOption) (*FetchImageResponse, error)
+}
+
+type controlAPIClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewControlAPIClient(cc *grpc.ClientConn) ControlAPIClient {
+	return &controlAPIClient{cc}
+}
+
+func (c *controlAPIClient) Exec(ctx context.Context, opts ...grpc.CallOption) (ControlAPI_ExecClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_ControlAPI_serviceDesc.Streams[0], c.cc, "/v1alpha.ControlAPI/Exec", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &controlAPIExecClient{stream}
+	return x, nil
+}
+
+type ControlAPI_ExecClient interface {
+	Send(*ExecRequest) error
+	Recv() (*ExecResponse, error)
+	grpc.ClientStream
+}
+
+type controlAPIExecClient struct {
+	grpc.ClientStream
+}
+
+func (x *controlAPIExecClient) Send(m *ExecRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *controlAPIExecClient) Recv() (*ExecResponse, error) {
+	m := new(ExecResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *controlAPIClient) RunPod(ctx context.Context, in *RunPodRequest, opts ...grpc.CallOption) (*RunPodResponse, error) {
+	out := new(RunPodResponse)
+	err := grpc.Invoke(ctx, "/v1alpha.ControlAPI/RunPod", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlAPIClient) StopPod(ctx context.Context, in *StopPodRequest, opts ...grpc.CallOption) (*StopPodResponse, error) {
+	out := new(StopPodResponse)
+	err := grpc.Invoke(ctx, "/v1alpha.ControlAPI/StopPod", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlAPIClient) RemovePod(ctx context.Context, in *RemovePodRequest, opts ...grpc.CallOption) (*RemovePodResponse, error) {
+	out := new(RemovePodResponse)
+	err := grpc.Invoke(ctx, "/v1alpha.ControlAPI/RemovePod", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlAPIClient) FetchImage(ctx context.Context, in *FetchImageRequest, opts ...grpc.CallOption) (*FetchImageResponse, error) {
+	out := new(FetchImageResponse)
+	err := grpc.Invoke(ctx, "/v1alpha.ControlAPI/FetchImage", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for ControlAPI service
+
+type ControlAPIServer interface {
+	// Exec executes a command inside an app of a running pod.
+	//
+	// The first request of the stream selects the pod, the app and the command,
+	// the following requests carry the standard input of the command. The
+	// standard output and error of the command are sent via the response stream,
+	// which is closed after the response that carries the exit code.
+	Exec(ControlAPI_ExecServer) error
+	// RunPod runs a new pod, it returns once the pod has been started.
+	RunPod(context.Context, *RunPodRequest) (*RunPodResponse, error)
+	// StopPod stops a running pod.
+	StopPod(context.Context, *StopPodRequest) (*StopPodResponse, error)
+	// RemovePod removes a pod that is not running and all its resources.
+	RemovePod(context.Context, *RemovePodRequest) (*RemovePodResponse, error)
+	// FetchImage fetches an image into the local store.
+	FetchImage(context.Context, *FetchImageRequest) (*FetchImageResponse, error)
+}
+
+func RegisterControlAPIServer(s *grpc.Server, srv ControlAPIServer) {
+	s.RegisterService(&_ControlAPI_serviceDesc, srv)
+}
+
+func _ControlAPI_Exec_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ControlAPIServer).Exec(&controlAPIExecServer{stream})
+}
+
+type ControlAPI_ExecServer interface {
+	Send(*ExecResponse) error
+	Recv() (*ExecRequest, error)
+	grpc.ServerStream
+}
+
+type controlAPIExecServer struct {
+	grpc.ServerStream
+}
+
+func (x *controlAPIExecServer) Send(m *ExecResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *controlAPIExecServer) Recv() (*ExecRequest, error) {
+	m := new(ExecRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _ControlAPI_RunPod_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(RunPodRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(ControlAPIServer).RunPod(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _ControlAPI_StopPod_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(StopPodRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(ControlAPIServer).StopPod(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _ControlAPI_RemovePod_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(RemovePodRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(ControlAPIServer).RemovePod(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _ControlAPI_FetchImage_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(FetchImageRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(ControlAPIServer).FetchImage(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+var _ControlAPI_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "v1alpha.ControlAPI",
+	HandlerType: (*ControlAPIServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "RunPod",
+			Handler:    _ControlAPI_RunPod_Handler,
+		},
+		{
+			MethodName: "StopPod",
+			Handler:    _ControlAPI_StopPod_Handler,
+		},
+		{
+			MethodName: "RemovePod",
+			Handler:    _ControlAPI_RemovePod_Handler,
+		},
+		{
+			MethodName: "FetchImage",
+			Handler:    _ControlAPI_FetchImage_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Exec",
+			Handler:       _ControlAPI_Exec_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+}
@@ -18,9 +18,13 @@ package apps
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/common/iolimit"
+	"github.com/coreos/rkt/common/rlimit"
 )
 
 type App struct {
@@ -30,14 +34,69 @@ type App struct {
 	Exec   string         // exec override for image
 	Mounts []schema.Mount // mounts for this app (superseding any mounts in rktApps.mounts of same MountPoint)
 
+	ReadOnlyMounts map[string]bool // read-only overrides of the mounts of this app, by path
+
+	ReadOnlyRootFS *bool          // whether the rootfs of the app is mounted read-only, overriding the image
+	Rlimits        rlimit.Limits  // resource limits of the app (superseding the ones in rktApps.Rlimits)
+	IOLimits       iolimit.Limits // disk IO limits of the app (superseding the ones in rktApps.IOLimits)
+	SeccompProfile string         // path of the seccomp profile file of the app
+	AppArmor       string         // name of the AppArmor profile of the app
+
+	// hardening options of the app, overriding the image
+	NoNewPrivileges *bool // whether PR_SET_NO_NEW_PRIVS is set
+	MaskProcPaths   *bool // whether the sensitive paths of /proc are masked
+	ReadOnlySys     *bool // whether /sys is mounted read-only
+
+	OneShot *bool // whether the pod completes when the app exits, overriding the image
+
 	// TODO(jonboulle): These images are partially-populated hashes, this should be clarified.
 	ImageID types.Hash // resolved image identifier
 }
 
+// Secret is a secret written on a tmpfs private to the pod, and mounted
+// read-only in all the apps
+type Secret struct {
+	Name   types.ACName // name of the secret
+	File   string       // file the secret is read from, if not Env
+	Env    string       // environment variable the secret is read from, if not File
+	Target string       // path of the secret in the apps
+	Mode   os.FileMode  // permissions of the secret
+	Uid    uint32       // owner of the secret in the apps
+	Gid    uint32       // group of the secret in the apps
+}
+
+// EmptyDirMediumMemory is the medium of the empty volumes stored on a tmpfs
+const EmptyDirMediumMemory = "memory"
+
+// EmptyDir configures an empty volume created by stage0 in the pod
+// directory, like an emptyDir volume of Kubernetes, instead of by stage1.
+// It is removed when the pod is garbage collected.
+type EmptyDir struct {
+	Medium string      // EmptyDirMediumMemory for a tmpfs, empty for the disk of the host
+	Size   string      // size of the tmpfs, with an optional k, m or g suffix
+	Mode   os.FileMode // permissions of the volume
+	Uid    uint32      // owner of the volume in the apps
+	Gid    uint32      // group of the volume in the apps
+}
+
+// PluginVolume configures a volume mounted by a volume driver on the host
+// when the pod is prepared, and unmounted when it is garbage collected.
+type PluginVolume struct {
+	Driver  string            // name of the configured driver
+	Options map[string]string // options passed to the driver
+}
+
 type Apps struct {
-	apps    []App
-	Mounts  []schema.Mount // global mounts applied to all apps
-	Volumes []types.Volume // volumes available to all apps
+	apps           []App
+	Mounts         []schema.Mount                         // global mounts applied to all apps
+	Volumes        []types.Volume                         // volumes available to all apps
+	Rlimits        rlimit.Limits                          // global resource limits applied to all apps
+	IOLimits       iolimit.Limits                         // global disk IO limits applied to all apps
+	Secrets        []Secret                               // secrets mounted in all apps
+	EmptyDirs      map[types.ACName]*EmptyDir             // options of the empty volumes, by name
+	PluginVolumes  map[types.ACName]*PluginVolume         // drivers of the plugin volumes, by name
+	NetworkVolumes map[types.ACName]*common.NetworkVolume // network file systems of the nfs and cifs volumes, by name
+	ReadOnlyMounts map[string]bool                        // read-only overrides of the global mounts, by path
 }
 
 // Reset creates a new slice for al.apps, needed by tests
@@ -83,6 +142,14 @@ func (al *Apps) Validate() error {
 		return err
 	}
 
+	secrets := map[types.ACName]struct{}{}
+	for _, sec := range al.Secrets {
+		if _, ok := secrets[sec.Name]; ok {
+			return fmt.Errorf("secret %q specified multiple times", sec.Name)
+		}
+		secrets[sec.Name] = struct{}{}
+	}
+
 	err := al.Walk(func(app *App) error {
 		return f(app.Mounts)
 	})
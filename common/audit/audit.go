@@ -0,0 +1,186 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package audit records the privileged operations performed for a pod, such
+// as mounts, network rules and device exposures, in an append-only log in
+// the pod directory and, optionally, in the systemd journal.
+package audit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+)
+
+const (
+	// LogFilename is the audit log in the pod directory, one JSON event
+	// per line
+	LogFilename = "audit.log"
+	// JournalFilename marks the pods whose events are also sent to the
+	// systemd journal
+	JournalFilename = "audit-journal"
+
+	// journalSocket is the socket of the native protocol of journald
+	journalSocket = "/run/systemd/journal/socket"
+)
+
+// Kinds of the audited operations
+const (
+	KindMount   = "mount"
+	KindNetwork = "network"
+	KindDevice  = "device"
+)
+
+// Event is an entry of the audit log.
+type Event struct {
+	Time   time.Time         `json:"time"`
+	Pod    string            `json:"pod"`
+	Kind   string            `json:"kind"`
+	Action string            `json:"action"`
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// Logger records the events of a pod.
+type Logger struct {
+	podRoot string
+	podID   types.UUID
+	journal bool
+}
+
+// NewLogger returns a Logger for the pod at podRoot. The events are also
+// sent to the journal if EnableJournal was called for the pod.
+func NewLogger(podRoot string, podID types.UUID) *Logger {
+	_, err := os.Stat(filepath.Join(podRoot, JournalFilename))
+	return &Logger{
+		podRoot: podRoot,
+		podID:   podID,
+		journal: err == nil,
+	}
+}
+
+// EnableJournal makes the loggers of the pod at podRoot send the events to
+// the systemd journal too.
+func EnableJournal(podRoot string) error {
+	f, err := os.Create(filepath.Join(podRoot, JournalFilename))
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// Log records an operation of the given kind. The fields describe its
+// parameters, like the source and target of a mount.
+func (l *Logger) Log(kind, action string, fields map[string]string) error {
+	e := Event{
+		Time:   time.Now().UTC(),
+		Pod:    l.podID.String(),
+		Kind:   kind,
+		Action: action,
+		Fields: fields,
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(l.podRoot, LogFilename), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("error opening the audit log: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("error writing the audit log: %v", err)
+	}
+
+	if l.journal {
+		if err := sendJournal(journalFields(e)); err != nil {
+			return fmt.Errorf("error sending the audit event to the journal: %v", err)
+		}
+	}
+	return nil
+}
+
+// journalFields returns the structured journal fields of an event.
+func journalFields(e Event) map[string]string {
+	fields := map[string]string{
+		"MESSAGE":           fmt.Sprintf("rkt audit: pod %s: %s %s", e.Pod, e.Kind, e.Action),
+		"SYSLOG_IDENTIFIER": "rkt",
+		"RKT_POD_UUID":      e.Pod,
+		"RKT_AUDIT_KIND":    e.Kind,
+		"RKT_AUDIT_ACTION":  e.Action,
+	}
+	for k, v := range e.Fields {
+		fields["RKT_AUDIT_"+journalFieldName(k)] = v
+	}
+	return fields
+}
+
+// journalFieldName converts a name to a valid journal field name, made of
+// upper case letters, digits and underscores.
+func journalFieldName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+// encodeJournal encodes fields in the native protocol of journald. The
+// values containing new lines are encoded with their size.
+func encodeJournal(fields map[string]string) []byte {
+	var names []string
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		val := fields[name]
+		if strings.Contains(val, "\n") {
+			buf.WriteString(name)
+			buf.WriteByte('\n')
+			binary.Write(&buf, binary.LittleEndian, uint64(len(val)))
+			buf.WriteString(val)
+			buf.WriteByte('\n')
+		} else {
+			fmt.Fprintf(&buf, "%s=%s\n", name, val)
+		}
+	}
+	return buf.Bytes()
+}
+
+func sendJournal(fields map[string]string) error {
+	conn, err := net.Dial("unixgram", journalSocket)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write(encodeJournal(fields))
+	return err
+}
@@ -0,0 +1,90 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+)
+
+func TestLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rkt-audit-test")
+	if err != nil {
+		t.Fatalf("error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	uuid, err := types.NewUUID("6733c3a8-ebf4-4b2b-8e5f-ea0a4d8d5f6e")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// two loggers, like stage0 and stage1, append to the same log
+	events := []Event{
+		{Kind: KindMount, Action: "tmpfs", Fields: map[string]string{"target": "/secrets"}},
+		{Kind: KindDevice, Action: "bind", Fields: map[string]string{"source": "/dev/fuse", "perms": "rw"}},
+	}
+	for _, e := range events {
+		if err := NewLogger(dir, *uuid).Log(e.Kind, e.Action, e.Fields); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	f, err := os.Open(filepath.Join(dir, LogFilename))
+	if err != nil {
+		t.Fatalf("cannot open the audit log: %v", err)
+	}
+	defer f.Close()
+
+	var got []Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("invalid event %q: %v", scanner.Text(), err)
+		}
+		if e.Pod != uuid.String() || e.Time.IsZero() {
+			t.Errorf("unexpected pod %q or time %v", e.Pod, e.Time)
+		}
+		e.Pod = ""
+		e.Time = events[len(got)].Time
+		got = append(got, e)
+	}
+	if !reflect.DeepEqual(got, events) {
+		t.Errorf("got %v, want %v", got, events)
+	}
+}
+
+func TestEncodeJournal(t *testing.T) {
+	fields := map[string]string{
+		"RKT_AUDIT_KIND": "mount",
+		"MESSAGE":        "a\nb",
+	}
+	expected := "MESSAGE\n\x03\x00\x00\x00\x00\x00\x00\x00a\nb\nRKT_AUDIT_KIND=mount\n"
+	if got := string(encodeJournal(fields)); got != expected {
+		t.Errorf("got %q, want %q", got, expected)
+	}
+
+	if got := journalFieldName("read-only.path"); got != "READ_ONLY_PATH" {
+		t.Errorf("got %q, want %q", got, "READ_ONLY_PATH")
+	}
+}
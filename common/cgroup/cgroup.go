@@ -29,6 +29,7 @@ import (
 
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/coreos/go-systemd/unit"
 	"github.com/coreos/rkt/Godeps/_workspace/src/k8s.io/kubernetes/pkg/api/resource"
+	"github.com/coreos/rkt/common/cpuset"
 )
 
 type addIsolatorFunc func(opts []*unit.UnitOption, limit *resource.Quantity) ([]*unit.UnitOption, error)
@@ -54,7 +55,12 @@ func addCpuLimit(opts []*unit.UnitOption, limit *resource.Quantity) ([]*unit.Uni
 }
 
 func addMemoryLimit(opts []*unit.UnitOption, limit *resource.Quantity) ([]*unit.UnitOption, error) {
-	opts = append(opts, unit.NewUnitOption("Service", "MemoryLimit", strconv.Itoa(int(limit.Value()))))
+	// MemoryLimit only applies to the legacy hierarchy
+	option := "MemoryLimit"
+	if isUnified() {
+		option = "MemoryMax"
+	}
+	opts = append(opts, unit.NewUnitOption("Service", option, strconv.Itoa(int(limit.Value()))))
 	return opts, nil
 }
 
@@ -78,8 +84,50 @@ func MaybeAddIsolator(opts []*unit.UnitOption, isolator string, limit *resource.
 	return opts, nil
 }
 
+// AddCpusetIsolator extends opts with the options pinning an app to the cpus
+// and the memory nodes mems, lists in the format of cpuset(7). On the unified
+// hierarchy the cpuset controller is used through AllowedCPUs and
+// AllowedMemoryNodes, which need systemd v244 or later in stage1. On the
+// legacy hierarchy the CPUs are set with CPUAffinity and the memory nodes
+// are not supported.
+func AddCpusetIsolator(opts []*unit.UnitOption, cpus, mems string) ([]*unit.UnitOption, error) {
+	if isUnified() {
+		if !IsIsolatorSupported("cpuset") {
+			fmt.Fprintf(os.Stderr, "warning: %s isolator set but support disabled in the kernel, skipping\n", cpuset.IsolatorName)
+			return opts, nil
+		}
+		if cpus != "" {
+			opts = append(opts, unit.NewUnitOption("Service", "AllowedCPUs", cpus))
+		}
+		if mems != "" {
+			opts = append(opts, unit.NewUnitOption("Service", "AllowedMemoryNodes", mems))
+		}
+		return opts, nil
+	}
+
+	if mems != "" {
+		fmt.Fprintf(os.Stderr, "warning: memory nodes of the %s isolator only supported on the unified cgroup hierarchy, skipping\n", cpuset.IsolatorName)
+	}
+	if cpus != "" {
+		list, err := cpuset.ParseList(cpus)
+		if err != nil {
+			return nil, err
+		}
+		affinity := make([]string, len(list))
+		for i, cpu := range list {
+			affinity[i] = strconv.Itoa(cpu)
+		}
+		opts = append(opts, unit.NewUnitOption("Service", "CPUAffinity", strings.Join(affinity, " ")))
+	}
+	return opts, nil
+}
+
 // IsIsolatorSupported returns whether an isolator is supported in the kernel
 func IsIsolatorSupported(isolator string) bool {
+	if isUnified() {
+		_, ok := unifiedControllerRWFiles[isolator]
+		return ok && isUnifiedControllerAvailable(isolator)
+	}
 	if files, ok := cgroupControllerRWFiles[isolator]; ok {
 		for _, f := range files {
 			isolatorPath := filepath.Join("/sys/fs/cgroup/", isolator, f)
@@ -181,10 +229,13 @@ func getControllerRWFiles(controller string) []string {
 }
 
 func parseOwnCgroupController(controller string) ([]string, error) {
-	cgroupPath := "/proc/self/cgroup"
+	return parseCgroupController("/proc/self/cgroup", controller)
+}
+
+func parseCgroupController(cgroupPath string, controller string) ([]string, error) {
 	cg, err := os.Open(cgroupPath)
 	if err != nil {
-		return nil, fmt.Errorf("error opening /proc/self/cgroup: %v", err)
+		return nil, fmt.Errorf("error opening %s: %v", cgroupPath, err)
 	}
 	defer cg.Close()
 
@@ -192,7 +243,7 @@ func parseOwnCgroupController(controller string) ([]string, error) {
 	for s.Scan() {
 		parts := strings.SplitN(s.Text(), ":", 3)
 		if len(parts) < 3 {
-			return nil, fmt.Errorf("error parsing /proc/self/cgroup")
+			return nil, fmt.Errorf("error parsing %s", cgroupPath)
 		}
 		controllerParts := strings.Split(parts[1], ",")
 		for _, c := range controllerParts {
@@ -215,6 +266,16 @@ func GetOwnCgroupPath(controller string) (string, error) {
 	return parts[2], nil
 }
 
+// GetCgroupPath returns the cgroup path of the process pid in controller
+// hierarchy
+func GetCgroupPath(pid int, controller string) (string, error) {
+	parts, err := parseCgroupController(fmt.Sprintf("/proc/%d/cgroup", pid), controller)
+	if err != nil {
+		return "", err
+	}
+	return parts[2], nil
+}
+
 // JoinCgroup makes the calling process join the subcgroup hierarchy on a
 // particular controller
 func JoinSubcgroup(controller string, subcgroup string) error {
@@ -230,6 +291,39 @@ func JoinSubcgroup(controller string, subcgroup string) error {
 	return nil
 }
 
+// JoinCpusetSubcgroup makes the calling process join the subcgroup of the
+// legacy cpuset hierarchy, restricting it to the cpus and the memory nodes
+// mems. An empty list inherits the one of the parent cgroup, as the kernel
+// refuses tasks in a cpuset cgroup without CPUs or memory nodes.
+func JoinCpusetSubcgroup(subcgroup, cpus, mems string) error {
+	subcgroupPath := filepath.Join("/sys/fs/cgroup/cpuset", subcgroup)
+	if err := os.MkdirAll(subcgroupPath, 0755); err != nil {
+		return fmt.Errorf("error creating %q subcgroup: %v", subcgroup, err)
+	}
+	knobs := []struct {
+		name  string
+		value string
+	}{
+		{"cpuset.cpus", cpus},
+		{"cpuset.mems", mems},
+	}
+	for _, k := range knobs {
+		value := []byte(k.value)
+		if k.value == "" {
+			var err error
+			value, err = ioutil.ReadFile(filepath.Join(filepath.Dir(subcgroupPath), k.name))
+			if err != nil {
+				return err
+			}
+		}
+		if err := ioutil.WriteFile(filepath.Join(subcgroupPath, k.name), value, 0644); err != nil {
+			return fmt.Errorf("error writing %s of the %q subcgroup: %v", k.name, subcgroup, err)
+		}
+	}
+
+	return JoinSubcgroup("cpuset", subcgroup)
+}
+
 // If /system.slice does not exist in the cpuset controller, create it and
 // configure it.
 // Since this is a workaround, we ignore errors
@@ -110,3 +110,74 @@ net_prio	6	432	1`
 		}
 	}
 }
+
+func TestParseOwnUnifiedCgroup(t *testing.T) {
+	tests := []struct {
+		input  string
+		output string
+		err    bool
+	}{
+		{
+			input:  "0::/machine.slice/rkt.service\n",
+			output: "/machine.slice/rkt.service",
+		},
+		{
+			// hybrid hierarchy
+			input:  "4:memory:/user.slice\n1:name=systemd:/user.slice/session-1.scope\n0::/user.slice/session-1.scope\n",
+			output: "/user.slice/session-1.scope",
+		},
+		{
+			input: "4:memory:/user.slice\n1:name=systemd:/user.slice/session-1.scope\n",
+			err:   true,
+		},
+		{
+			input: "garbage\n",
+			err:   true,
+		},
+	}
+
+	for i, tt := range tests {
+		output, err := parseOwnUnifiedCgroup(strings.NewReader(tt.input))
+		if (err != nil) != tt.err {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+		}
+		if output != tt.output {
+			t.Errorf("#%d: expected %q, got %q", i, tt.output, output)
+		}
+	}
+}
+
+func TestParseCPUStatUsage(t *testing.T) {
+	tests := []struct {
+		input  string
+		output uint64
+		err    bool
+	}{
+		{
+			input:  "usage_usec 1512345\nuser_usec 1000000\nsystem_usec 512345\n",
+			output: 1512345,
+		},
+		{
+			input:  "nr_periods 0\nusage_usec 42\n",
+			output: 42,
+		},
+		{
+			input: "user_usec 1000000\n",
+			err:   true,
+		},
+		{
+			input: "usage_usec garbage\n",
+			err:   true,
+		},
+	}
+
+	for i, tt := range tests {
+		output, err := parseCPUStatUsage(strings.NewReader(tt.input))
+		if (err != nil) != tt.err {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+		}
+		if output != tt.output {
+			t.Errorf("#%d: expected %d, got %d", i, tt.output, output)
+		}
+	}
+}
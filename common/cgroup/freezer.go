@@ -0,0 +1,48 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package cgroup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// PodFreezerCgroup returns the path of the cgroup in the legacy freezer
+// hierarchy where the processes of a pod are moved to pause it.
+func PodFreezerCgroup(uuid string) string {
+	return filepath.Join("/sys/fs/cgroup/freezer", "rkt", uuid)
+}
+
+// GetUnifiedCgroupPath returns the cgroup path of the process pid in the
+// unified hierarchy
+func GetUnifiedCgroupPath(pid int) (string, error) {
+	path := fmt.Sprintf("/proc/%d/cgroup", pid)
+	cg, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("error opening %s: %v", path, err)
+	}
+	defer cg.Close()
+
+	return parseOwnUnifiedCgroup(cg)
+}
+
+// UnifiedCgroupDir returns the directory of a cgroup of the unified hierarchy
+// (cgroup path relative to the root of the hierarchy)
+func UnifiedCgroupDir(cgroup string) string {
+	return filepath.Join(unifiedMountpoint, cgroup)
+}
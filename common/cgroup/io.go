@@ -0,0 +1,115 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package cgroup
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/pkg/device"
+	"github.com/coreos/rkt/common/iolimit"
+)
+
+// SetIOLimits throttles the disk IO of the cgroup of the app service
+// serviceName in subcgroup, through the blkio controller of the legacy
+// hierarchy or the io controller of the unified one. The knobs are written
+// directly instead of through systemd in stage1, as the devices are paths on
+// the host, and they stay read-only in the pod.
+func SetIOLimits(subcgroup string, serviceName string, limits iolimit.Limits) error {
+	unified := isUnified()
+	controller := "blkio"
+	if unified {
+		controller = "io"
+	}
+	if (unified && !IsIsolatorSupported(controller)) || (!unified && !IsControllerMounted(controller)) {
+		fmt.Fprintf(os.Stderr, "warning: %s isolator set but support disabled in the kernel, skipping\n", iolimit.IsolatorName)
+		return nil
+	}
+
+	appCgroup := filepath.Join("/sys/fs/cgroup", subcgroup, serviceName)
+	if !unified {
+		appCgroup = filepath.Join("/sys/fs/cgroup", controller, subcgroup, serviceName)
+	}
+	if err := os.MkdirAll(appCgroup, 0755); err != nil {
+		return err
+	}
+
+	for _, d := range limits.Devices() {
+		dev, err := blockDeviceNumber(d)
+		if err != nil {
+			return err
+		}
+		limit := limits[d]
+		knobs := []struct {
+			legacy  string
+			unified string
+			value   uint64
+		}{
+			{"blkio.throttle.read_bps_device", "rbps", limit.ReadBps},
+			{"blkio.throttle.write_bps_device", "wbps", limit.WriteBps},
+			{"blkio.throttle.read_iops_device", "riops", limit.ReadIOPS},
+			{"blkio.throttle.write_iops_device", "wiops", limit.WriteIOPS},
+		}
+
+		if unified {
+			// io.max takes all the limits of a device on one line
+			line := []string{dev}
+			for _, k := range knobs {
+				if k.value != 0 {
+					line = append(line, fmt.Sprintf("%s=%d", k.unified, k.value))
+				}
+			}
+			if err := writeKnob(filepath.Join(appCgroup, "io.max"), strings.Join(line, " ")); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, k := range knobs {
+			if k.value == 0 {
+				continue
+			}
+			if err := writeKnob(filepath.Join(appCgroup, k.legacy), fmt.Sprintf("%s %d", dev, k.value)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// blockDeviceNumber returns the MAJOR:MINOR number of the block device at
+// path.
+func blockDeviceNumber(path string) (string, error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return "", fmt.Errorf("error getting the device number of %q: %v", path, err)
+	}
+	if st.Mode&syscall.S_IFMT != syscall.S_IFBLK {
+		return "", fmt.Errorf("%q is not a block device", path)
+	}
+	return fmt.Sprintf("%d:%d", device.Major(st.Rdev), device.Minor(st.Rdev)), nil
+}
+
+func writeKnob(path, value string) error {
+	if err := ioutil.WriteFile(path, []byte(value), 0644); err != nil {
+		return fmt.Errorf("error writing %q to %q: %v", value, path, err)
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package cgroup
+
+// Support for hosts using only the unified cgroup hierarchy (cgroup v2), see
+// https://www.kernel.org/doc/Documentation/cgroup-v2.txt
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	// cgroup2SuperMagic is the magic number of the cgroup2 file system, see statfs(2)
+	cgroup2SuperMagic = 0x63677270
+
+	unifiedMountpoint = "/sys/fs/cgroup"
+)
+
+var (
+	// knobs of the unified hierarchy implementing the isolators
+	unifiedControllerRWFiles = map[string][]string{
+		"memory": []string{"memory.max"},
+		"cpu":    []string{"cpu.max"},
+		"cpuset": []string{"cpuset.cpus", "cpuset.mems"},
+		// io.max is written by stage1 and stays read-only, see SetIOLimits
+		"io": []string{},
+	}
+)
+
+// IsUnified returns whether the host uses the unified cgroup hierarchy only,
+// that is whether a cgroup2 file system is mounted on /sys/fs/cgroup
+func IsUnified() (bool, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(unifiedMountpoint, &st); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("error checking the file system of %q: %v", unifiedMountpoint, err)
+	}
+	return int64(st.Type) == cgroup2SuperMagic, nil
+}
+
+// isUnified is IsUnified ignoring errors, for the callers which fall back to
+// the legacy hierarchy.
+func isUnified() bool {
+	unified, err := IsUnified()
+	return err == nil && unified
+}
+
+// GetUnifiedControllers returns the controllers available in a cgroup of the
+// unified hierarchy (cgroup path relative to the root of the hierarchy)
+func GetUnifiedControllers(cgroup string) ([]string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(unifiedMountpoint, cgroup, "cgroup.controllers"))
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(data)), nil
+}
+
+func isUnifiedControllerAvailable(controller string) bool {
+	controllers, err := GetUnifiedControllers("/")
+	if err != nil {
+		return false
+	}
+	for _, c := range controllers {
+		if c == controller {
+			return true
+		}
+	}
+	return false
+}
+
+// parseOwnUnifiedCgroup parses the content of /proc/self/cgroup and returns
+// the cgroup path in the unified hierarchy, on the line "0::PATH"
+func parseOwnUnifiedCgroup(r io.Reader) (string, error) {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		parts := strings.SplitN(s.Text(), ":", 3)
+		if len(parts) < 3 {
+			return "", fmt.Errorf("error parsing /proc/self/cgroup")
+		}
+		if parts[0] == "0" && parts[1] == "" {
+			return parts[2], nil
+		}
+	}
+	if err := s.Err(); err != nil {
+		return "", err
+	}
+
+	return "", fmt.Errorf("unified hierarchy not found")
+}
+
+// GetOwnUnifiedCgroupPath returns the cgroup path of this process in the
+// unified hierarchy
+func GetOwnUnifiedCgroupPath() (string, error) {
+	cg, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return "", fmt.Errorf("error opening /proc/self/cgroup: %v", err)
+	}
+	defer cg.Close()
+
+	return parseOwnUnifiedCgroup(cg)
+}
+
+// JoinUnifiedSubcgroup makes the calling process join the subcgroup in the
+// unified hierarchy
+func JoinUnifiedSubcgroup(subcgroup string) error {
+	subcgroupPath := filepath.Join(unifiedMountpoint, subcgroup)
+	if err := os.MkdirAll(subcgroupPath, 0755); err != nil {
+		return fmt.Errorf("error creating %q subcgroup: %v", subcgroup, err)
+	}
+	pidBytes := []byte(strconv.Itoa(os.Getpid()))
+	if err := ioutil.WriteFile(filepath.Join(subcgroupPath, "cgroup.procs"), pidBytes, 0644); err != nil {
+		return fmt.Errorf("error adding ourselves to the %q subcgroup: %v", subcgroup, err)
+	}
+
+	return nil
+}
+
+// CreateUnifiedCgroups mounts the unified cgroup hierarchy in /sys/fs/cgroup
+// under root
+func CreateUnifiedCgroups(root string) error {
+	var flags uintptr
+
+	sys := filepath.Join(root, "/sys")
+	if err := os.MkdirAll(sys, 0700); err != nil {
+		return err
+	}
+	flags = syscall.MS_NOSUID |
+		syscall.MS_NOEXEC |
+		syscall.MS_NODEV
+	// If we're mounting the host cgroups, /sys is probably mounted so we
+	// ignore EBUSY
+	if err := syscall.Mount("sysfs", sys, "sysfs", flags, ""); err != nil && err != syscall.EBUSY {
+		return fmt.Errorf("error mounting %q: %v", sys, err)
+	}
+
+	cgroupPath := filepath.Join(root, unifiedMountpoint)
+	if err := os.MkdirAll(cgroupPath, 0700); err != nil {
+		return err
+	}
+	if err := syscall.Mount("cgroup2", cgroupPath, "cgroup2", flags, ""); err != nil {
+		return fmt.Errorf("error mounting %q: %v", cgroupPath, err)
+	}
+
+	return nil
+}
+
+// enableUnifiedControllers enables the controllers of the isolators for the
+// children of a cgroup, so systemd inside stage1 can apply the isolators to
+// the apps. Controllers can only be enabled if they are enabled in the
+// parent, so failing to enable one only disables its isolator.
+func enableUnifiedControllers(cgroupPath string) {
+	for controller := range unifiedControllerRWFiles {
+		f := filepath.Join(cgroupPath, "cgroup.subtree_control")
+		_ = ioutil.WriteFile(f, []byte("+"+controller), 0644)
+	}
+}
+
+// RemountUnifiedCgroupsRO remounts the unified cgroup hierarchy under root
+// read-only, leaving the needed knobs in the subcgroup for each app
+// read-write so the systemd inside stage1 can apply isolators to them
+func RemountUnifiedCgroupsRO(root string, subcgroup string, serviceNames []string) error {
+	cgroupPath := filepath.Join(root, unifiedMountpoint)
+	subcgroupPath := filepath.Join(cgroupPath, subcgroup)
+	sysPath := filepath.Join(root, "/sys")
+
+	var flags uintptr
+
+	if err := os.MkdirAll(subcgroupPath, 0755); err != nil {
+		return err
+	}
+	enableUnifiedControllers(subcgroupPath)
+
+	// Create cgroup directories and mount the files we need over
+	// themselves so they stay read-write
+	for _, serviceName := range serviceNames {
+		appCgroup := filepath.Join(subcgroupPath, serviceName)
+		if err := os.MkdirAll(appCgroup, 0755); err != nil {
+			return err
+		}
+		files := []string{"cgroup.procs"}
+		for _, f := range unifiedControllerRWFiles {
+			files = append(files, f...)
+		}
+		for _, f := range files {
+			cgroupFilePath := filepath.Join(appCgroup, f)
+			// the file is not there if the controller is not enabled,
+			// skip it in that case
+			if _, err := os.Stat(cgroupFilePath); os.IsNotExist(err) {
+				continue
+			}
+			if err := syscall.Mount(cgroupFilePath, cgroupFilePath, "", syscall.MS_BIND, ""); err != nil {
+				return fmt.Errorf("error bind mounting %q: %v", cgroupFilePath, err)
+			}
+		}
+	}
+
+	// Re-mount the hierarchy read-only to prevent the container modifying host cgroups
+	flags = syscall.MS_BIND |
+		syscall.MS_REMOUNT |
+		syscall.MS_NOSUID |
+		syscall.MS_NOEXEC |
+		syscall.MS_NODEV |
+		syscall.MS_RDONLY
+	if err := syscall.Mount(cgroupPath, cgroupPath, "", flags, ""); err != nil {
+		return fmt.Errorf("error remounting RO %q: %v", cgroupPath, err)
+	}
+
+	// Bind-mount sys filesystem read-only
+	if err := syscall.Mount(sysPath, sysPath, "", flags, ""); err != nil {
+		return fmt.Errorf("error remounting RO %q: %v", sysPath, err)
+	}
+
+	return nil
+}
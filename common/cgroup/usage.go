@@ -0,0 +1,135 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package cgroup
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Usage is the resource usage of a cgroup
+type Usage struct {
+	// Memory is the memory used by the processes of the cgroup, in bytes,
+	// including the page cache
+	Memory uint64
+	// CPU is the CPU time consumed by the processes of the cgroup
+	CPU time.Duration
+}
+
+// GetUsage returns the resource usage of the cgroup of the process pid and of
+// its descendants. When pid is the init process of a pod, the usage covers
+// the whole pod: the init.scope subcgroup created by systemd for it in the
+// unified hierarchy is skipped.
+func GetUsage(pid int) (*Usage, error) {
+	unified, err := IsUnified()
+	if err != nil {
+		return nil, err
+	}
+	if unified {
+		cg, err := GetUnifiedCgroupPath(pid)
+		if err != nil {
+			return nil, err
+		}
+		if filepath.Base(cg) == "init.scope" {
+			cg = filepath.Dir(cg)
+		}
+		return getUnifiedUsage(UnifiedCgroupDir(cg))
+	}
+
+	return getLegacyUsage(pid)
+}
+
+func getUnifiedUsage(dir string) (*Usage, error) {
+	memory, err := readUint(filepath.Join(dir, "memory.current"))
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(filepath.Join(dir, "cpu.stat"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	usec, err := parseCPUStatUsage(f)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", f.Name(), err)
+	}
+
+	return &Usage{
+		Memory: memory,
+		CPU:    time.Duration(usec) * time.Microsecond,
+	}, nil
+}
+
+func getLegacyUsage(pid int) (*Usage, error) {
+	memoryCgroup, err := GetCgroupPath(pid, "memory")
+	if err != nil {
+		return nil, err
+	}
+	memory, err := readUint(filepath.Join("/sys/fs/cgroup/memory", memoryCgroup, "memory.usage_in_bytes"))
+	if err != nil {
+		return nil, err
+	}
+
+	cpuacctCgroup, err := GetCgroupPath(pid, "cpuacct")
+	if err != nil {
+		return nil, err
+	}
+	// cpuacct is usually co-mounted with cpu, and reachable through the
+	// cpuacct symlink
+	nsec, err := readUint(filepath.Join("/sys/fs/cgroup/cpuacct", cpuacctCgroup, "cpuacct.usage"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Usage{
+		Memory: memory,
+		CPU:    time.Duration(nsec),
+	}, nil
+}
+
+// parseCPUStatUsage returns the usage_usec entry of a cpu.stat file of the
+// unified hierarchy
+func parseCPUStatUsage(r io.Reader) (uint64, error) {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 2 && fields[0] == "usage_usec" {
+			return strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return 0, err
+	}
+
+	return 0, fmt.Errorf("usage_usec not found")
+}
+
+func readUint(path string) (uint64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
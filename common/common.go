@@ -17,12 +17,11 @@
 package common
 
 import (
-	"bufio"
 	"fmt"
 	"net"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -32,6 +31,9 @@ import (
 
 const (
 	sharedVolumesDir = "/sharedVolumes"
+	secretsDir       = "/secrets"
+	emptyDirsDir     = "/empty-dirs"
+	pluginVolumesDir = "/plugin-volumes"
 	stage1Dir        = "/stage1"
 	stage2Dir        = "/opt/stage2"
 	AppsInfoDir      = "/appsinfo"
@@ -39,21 +41,200 @@ const (
 	EnvLockFd                    = "RKT_LOCK_FD"
 	EnvSELinuxContext            = "RKT_SELINUX_CONTEXT"
 	Stage1TreeStoreIDFilename    = "stage1TreeStoreID"
+	Stage1ImageIDFilename        = "stage1ImageID"
 	AppTreeStoreIDFilename       = "treeStoreID"
 	OverlayPreparedFilename      = "overlay-prepared"
+	OverlayDisabledFilename      = "overlay-disabled"
 	PrivateUsersPreparedFilename = "private-users-prepared"
+	PausedFilename               = "paused"
+	CreatedFilename              = "created"
+	StartedFilename              = "started"
+	QemuUserArchsFilename        = "qemu-user-archs"
+	CheckpointDir                = "checkpoint"
+	TPMEventLogFilename          = "tpm-events"
+	PodCgroupsFilename           = "cgroups"
+	PreparedExpirationFilename   = "prepared-expiration"
 
 	PrepareLock = "prepareLock"
+	GCLock      = "gcLock"
 
 	MetadataServicePort    = 18112
 	MetadataServiceRegSock = "/run/rkt/metadata-svc.sock"
 
 	APIServiceListenClientURL = "localhost:15441"
+	APIServiceControlSocket   = "/run/rkt/api-control.sock"
+
+	// StoreKeySize is the size of the AES-256 keys encrypting the blobs of
+	// the store
+	StoreKeySize = 32
+
+	// Pod annotations configuring the virtual machine of the kvm flavor
+	KVMHypervisorAnnotation  = "coreos.com/rkt/stage1/kvm/hypervisor"
+	KVMCPUsAnnotation        = "coreos.com/rkt/stage1/kvm/cpus"
+	KVMMemoryAnnotation      = "coreos.com/rkt/stage1/kvm/memory"
+	KVMVolumeFSAnnotation    = "coreos.com/rkt/stage1/kvm/volume-fs"
+	KVMVolumeCacheAnnotation = "coreos.com/rkt/stage1/kvm/volume-cache"
+	KVMVsockAnnotation       = "coreos.com/rkt/stage1/kvm/vsock"
+
+	// Pod annotations configuring the registration of the pod to systemd-machined
+	MachineNameAnnotation      = "coreos.com/rkt/stage1/machine-name"
+	MachinedRegisterAnnotation = "coreos.com/rkt/stage1/machined-register"
+
+	// Pod annotation listing the host devices exposed to the apps, see
+	// the device package
+	DevicesAnnotation = "coreos.com/rkt/stage1/devices"
+
+	// Pod annotation selecting the NVIDIA GPUs exposed to the apps, see
+	// the gpu package
+	GPUsAnnotation = "coreos.com/rkt/stage1/gpus"
+
+	// Pod annotations configuring the shared memory of the pod: the size
+	// of /dev/shm and the page size of the hugetlbfs mounted on
+	// /dev/hugepages ("default" for the default page size of the kernel)
+	ShmSizeAnnotation   = "coreos.com/rkt/stage1/shm-size"
+	HugepagesAnnotation = "coreos.com/rkt/stage1/hugepages"
+
+	// Pod annotation describing the volumes of kind nfs and cifs, passed
+	// to stage1 as empty volumes and mounted by it in the pod, a JSON
+	// list of NetworkVolume
+	NetworkVolumesAnnotation = "coreos.com/rkt/stage1/network-volumes"
+
+	// Pod annotation listing, comma-separated, the host volumes whose
+	// source is a path of the pod directory relative to it, such as the
+	// secrets: the directory is moved after the pod is prepared, so stage1
+	// resolves them against the root of the pod
+	PodVolumesAnnotation = "coreos.com/rkt/stage1/pod-volumes"
+
+	// Pod annotations setting the timezone and the locale of the apps:
+	// "host" or a name of the tz database, and a locale name
+	TimezoneAnnotation = "coreos.com/rkt/stage1/timezone"
+	LocaleAnnotation   = "coreos.com/rkt/stage1/locale"
+
+	// Pod annotation limiting how long the pod runs, a Go duration, after
+	// which stage1 stops its apps
+	TimeoutAnnotation = "coreos.com/rkt/stage1/timeout"
+
+	// Pod annotation recording the image ID of the stage1 image of the
+	// pod, set by stage0
+	Stage1DigestAnnotation = "coreos.com/rkt/stage1/digest"
+
+	// Pod annotations limiting the journal of the pod: the disk space it
+	// uses, in bytes with an optional k, m or g suffix, and the number of
+	// messages an app may log in an interval, a Go duration
+	JournalMaxUseAnnotation            = "coreos.com/rkt/stage1/journal-max-use"
+	JournalRateLimitBurstAnnotation    = "coreos.com/rkt/stage1/journal-rate-limit-burst"
+	JournalRateLimitIntervalAnnotation = "coreos.com/rkt/stage1/journal-rate-limit-interval"
+
+	// Pod annotations duplicating the output of the apps into size-rotated
+	// log files in the pod directory: the maximum size of a file, in bytes
+	// with an optional k, m or g suffix, and the number of rotated files
+	// kept
+	LogFilesMaxSizeAnnotation  = "coreos.com/rkt/stage1/log-files/max-size"
+	LogFilesMaxFilesAnnotation = "coreos.com/rkt/stage1/log-files/max-files"
+
+	// Pod annotations choosing where the output of the apps is sent: the
+	// log driver, journald, syslog or fluentd, and the address of the
+	// syslog or fluentd server
+	LogDriverAnnotation        = "coreos.com/rkt/stage1/log-driver"
+	LogDriverAddressAnnotation = "coreos.com/rkt/stage1/log-driver/address"
+
+	// Pod annotations passed to all the network plugins of the pod: the
+	// CNI_ARGS, in the form KEY=VALUE;KEY=VALUE, and a JSON object mapping
+	// the names of CNI capabilities to their runtime config, passed to the
+	// plugins declaring them
+	CNIArgsAnnotation         = "coreos.com/rkt/stage1/cni-args"
+	CNICapabilitiesAnnotation = "coreos.com/rkt/stage1/cni-capabilities"
+
+	// Pod annotations overriding, with numeric ids, the user and group
+	// the app of a fly pod runs as
+	FlyUIDAnnotation = "coreos.com/rkt/stage1/fly-uid"
+	FlyGIDAnnotation = "coreos.com/rkt/stage1/fly-gid"
+	// Pod annotation restricting, with a comma-separated list of host
+	// paths, the host volumes a fly pod can mount
+	FlyMountsAllowAnnotation = "coreos.com/rkt/stage1/fly-mounts-allow"
+	// Pod annotation choosing the resolv.conf and hosts files of the app
+	// of a fly pod: "host" for the files of the host, "none" for no name
+	// server, or a comma-separated list of name server IPs, see
+	// ParseFlyDNS. Only the fly stage1 reads it.
+	FlyDNSAnnotation = "coreos.com/rkt/stage1/fly-dns"
+
+	// Prefixes of the pod annotations holding the annotations and labels
+	// set by the user on a pod, to tag and find it
+	UserAnnotationPrefix = "coreos.com/rkt/user-annotation/"
+	UserLabelPrefix      = "coreos.com/rkt/user-label/"
+
+	// App annotation making the rootfs of the app read-only, in the pod
+	// manifest or in the image manifest.
+	ReadOnlyRootFSAnnotation = "coreos.com/rkt/stage2/read-only-rootfs"
+
+	// App annotations hardening the app, set to true or false, in the pod
+	// manifest or in the image manifest: setting PR_SET_NO_NEW_PRIVS,
+	// masking the sensitive paths of /proc and making /sys read-only.
+	NoNewPrivilegesAnnotation = "coreos.com/rkt/stage2/no-new-privileges"
+	MaskProcPathsAnnotation   = "coreos.com/rkt/stage2/mask-proc-paths"
+	ReadOnlySysAnnotation     = "coreos.com/rkt/stage2/read-only-sys"
+
+	// App annotation holding the seccomp profile of the app, in the format
+	// of the docker profiles, in the pod manifest or in the image manifest.
+	SeccompProfileAnnotation = "coreos.com/rkt/stage2/seccomp-profile"
+
+	// App annotation holding the name of the AppArmor profile of the app,
+	// in the pod manifest or in the image manifest.
+	AppArmorProfileAnnotation = "coreos.com/rkt/stage2/apparmor-profile"
+
+	// App annotation holding systemd unit directives appended to the
+	// service unit of the app, in the pod manifest only. Directives
+	// before any section header are in the [Service] section.
+	UnitPropertiesAnnotation = "coreos.com/rkt/stage2/unit-properties"
+
+	// App annotation making the app a one-shot app, set to true or false,
+	// in the pod manifest or in the image manifest. The pod completes when
+	// its one-shot apps exit successfully, and its other apps are stopped.
+	OneShotAnnotation = "coreos.com/rkt/stage2/oneshot"
+
+	// App annotations ordering the start of the app, in the pod manifest
+	// only, comma-separated lists of app names: the apps started before
+	// it, and the apps which must exit successfully before it starts.
+	AppAfterAnnotation    = "coreos.com/rkt/stage2/after"
+	AppRequiresAnnotation = "coreos.com/rkt/stage2/requires"
+
+	// App annotations defining the health check of the app, in the pod
+	// manifest or in the image manifest
+	HealthCheckExecAnnotation     = "coreos.com/rkt/stage2/healthcheck/exec"
+	HealthCheckShellAnnotation    = "coreos.com/rkt/stage2/healthcheck/shell"
+	HealthCheckTCPAnnotation      = "coreos.com/rkt/stage2/healthcheck/tcp"
+	HealthCheckHTTPAnnotation     = "coreos.com/rkt/stage2/healthcheck/http"
+	HealthCheckIntervalAnnotation = "coreos.com/rkt/stage2/healthcheck/interval"
+	HealthCheckRetriesAnnotation  = "coreos.com/rkt/stage2/healthcheck/retries"
+	HealthCheckActionAnnotation   = "coreos.com/rkt/stage2/healthcheck/action"
+
+	// Pod annotation recording, as JSON, the environment variables and
+	// the ports overridden when the prepared pod was run
+	RunPreparedOverridesAnnotation = "coreos.com/rkt/run-prepared/overrides"
+
+	// Image annotations recording, as JSON, the entrypoint, cmd and
+	// healthcheck of the docker images converted by docker2aci
+	DockerEntrypointAnnotation  = "appc.io/docker/entrypoint"
+	DockerCmdAnnotation         = "appc.io/docker/cmd"
+	DockerHealthcheckAnnotation = "appc.io/docker/healthcheck"
 
 	DefaultLocalConfigDir  = "/etc/rkt"
 	DefaultSystemConfigDir = "/usr/lib/rkt"
 )
 
+// memorySizeRegexp matches the sizes accepted by the tmpfs and hugetlbfs
+// mount options
+var memorySizeRegexp = regexp.MustCompile(`^[0-9]+[kKmMgG]?$`)
+
+// ValidateMemorySize returns an error if size is not a number of bytes,
+// optionally followed by a k, m or g suffix.
+func ValidateMemorySize(size string) error {
+	if !memorySizeRegexp.MatchString(size) {
+		return fmt.Errorf("invalid size %q, must be a number of bytes optionally followed by k, m or g", size)
+	}
+	return nil
+}
+
 // Stage1ImagePath returns the path where the stage1 app image (unpacked ACI) is rooted,
 // (i.e. where its contents are extracted during stage0).
 func Stage1ImagePath(root string) string {
@@ -130,6 +311,23 @@ func SharedVolumesPath(root string) string {
 	return filepath.Join(root, sharedVolumesDir)
 }
 
+// SecretsPath returns the path to the tmpfs holding the secrets of a pod.
+func SecretsPath(root string) string {
+	return filepath.Join(root, secretsDir)
+}
+
+// EmptyDirsPath returns the path to the directory holding the empty volumes
+// created by stage0 for a pod.
+func EmptyDirsPath(root string) string {
+	return filepath.Join(root, emptyDirsDir)
+}
+
+// PluginVolumesPath returns the path to the directory holding the volumes
+// mounted by volume drivers for a pod.
+func PluginVolumesPath(root string) string {
+	return filepath.Join(root, pluginVolumesDir)
+}
+
 // MetadataServicePublicURL returns the public URL used to host the metadata service
 func MetadataServicePublicURL(ip net.IP, token string) string {
 	return fmt.Sprintf("http://%v:%v/%v", ip, MetadataServicePort, token)
@@ -148,22 +346,7 @@ func GetRktLockFD() (int, error) {
 
 // SupportsOverlay returns whether the system supports overlay filesystem
 func SupportsOverlay() bool {
-	exec.Command("modprobe", "overlay").Run()
-
-	f, err := os.Open("/proc/filesystems")
-	if err != nil {
-		fmt.Println("error opening /proc/filesystems")
-		return false
-	}
-	defer f.Close()
-
-	s := bufio.NewScanner(f)
-	for s.Scan() {
-		if s.Text() == "nodev\toverlay" {
-			return true
-		}
-	}
-	return false
+	return checkOverlayKernel() == nil
 }
 
 // SupportsUserNS returns whether the kernel has CONFIG_USER_NS set
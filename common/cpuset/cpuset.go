@@ -0,0 +1,126 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cpuset implements the isolator pinning the apps to CPUs and NUMA
+// memory nodes.
+package cpuset
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+)
+
+// IsolatorName is the name of the isolator pinning an app to CPUs and memory
+// nodes. Its value is of the form:
+//
+//	{"cpus": "0-3,8", "mems": "0"}
+//
+// in the list format of cpuset(7). Either list can be omitted.
+const IsolatorName = "coreos.com/rkt/cpuset"
+
+func init() {
+	types.AddIsolatorValueConstructor(IsolatorName, NewCpuset)
+}
+
+// Cpuset is the value of the cpuset isolator.
+type Cpuset struct {
+	val cpusetValue
+}
+
+type cpusetValue struct {
+	CPUs string `json:"cpus,omitempty"`
+	Mems string `json:"mems,omitempty"`
+}
+
+// NewCpuset returns an empty value of the cpuset isolator.
+func NewCpuset() types.IsolatorValue {
+	return &Cpuset{}
+}
+
+func (c *Cpuset) UnmarshalJSON(b []byte) error {
+	var v cpusetValue
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	c.val = v
+	return nil
+}
+
+func (c Cpuset) AssertValid() error {
+	if c.val.CPUs == "" && c.val.Mems == "" {
+		return fmt.Errorf("cpus or mems must be set")
+	}
+	if _, err := ParseList(c.val.CPUs); err != nil {
+		return fmt.Errorf("invalid cpus: %v", err)
+	}
+	if _, err := ParseList(c.val.Mems); err != nil {
+		return fmt.Errorf("invalid mems: %v", err)
+	}
+	return nil
+}
+
+// CPUs returns the list of the CPUs the app runs on, empty for all of them.
+func (c Cpuset) CPUs() string {
+	return c.val.CPUs
+}
+
+// Mems returns the list of the memory nodes the app allocates memory from,
+// empty for all of them.
+func (c Cpuset) Mems() string {
+	return c.val.Mems
+}
+
+// ParseList parses a list of CPUs or memory nodes in the list format of
+// cpuset(7), comma separated numbers and ranges of numbers, for example
+// "0-3,8". It returns the numbers in the list, in increasing order.
+func ParseList(s string) ([]int, error) {
+	if s == "" {
+		return nil, nil
+	}
+	seen := make(map[int]bool)
+	max := -1
+	for _, r := range strings.Split(s, ",") {
+		bounds := strings.SplitN(r, "-", 2)
+		first, err := strconv.ParseUint(bounds[0], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number in %q", r)
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, err = strconv.ParseUint(bounds[1], 10, 16); err != nil {
+				return nil, fmt.Errorf("invalid number in %q", r)
+			}
+			if last < first {
+				return nil, fmt.Errorf("invalid range %q", r)
+			}
+		}
+		for n := int(first); n <= int(last); n++ {
+			seen[n] = true
+		}
+		if int(last) > max {
+			max = int(last)
+		}
+	}
+	var list []int
+	for n := 0; n <= max; n++ {
+		if seen[n] {
+			list = append(list, n)
+		}
+	}
+	return list, nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cpuset
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+)
+
+func TestParseList(t *testing.T) {
+	tests := []struct {
+		in   string
+		list []int
+		fail bool
+	}{
+		{"", nil, false},
+		{"0", []int{0}, false},
+		{"0-3,8", []int{0, 1, 2, 3, 8}, false},
+		{"8,0-1,1", []int{0, 1, 8}, false},
+		{"3-1", nil, true},
+		{"a", nil, true},
+		{"1,", nil, true},
+		{"-1", nil, true},
+	}
+	for i, tt := range tests {
+		list, err := ParseList(tt.in)
+		if tt.fail {
+			if err == nil {
+				t.Errorf("#%d: expected an error for %q", i, tt.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+		} else if !reflect.DeepEqual(list, tt.list) {
+			t.Errorf("#%d: got %v, want %v", i, list, tt.list)
+		}
+	}
+}
+
+func TestCpusetIsolator(t *testing.T) {
+	tests := []struct {
+		value string
+		cpus  string
+		mems  string
+		fail  bool
+	}{
+		{`{"cpus": "0-3", "mems": "0"}`, "0-3", "0", false},
+		{`{"cpus": "2"}`, "2", "", false},
+		{`{}`, "", "", true},
+		{`{"cpus": "2-1"}`, "", "", true},
+	}
+	for i, tt := range tests {
+		var iso types.Isolator
+		err := iso.UnmarshalJSON([]byte(`{"name": "` + IsolatorName + `", "value": ` + tt.value + `}`))
+		if tt.fail {
+			if err == nil {
+				t.Errorf("#%d: expected an error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+			continue
+		}
+		c, ok := iso.Value().(*Cpuset)
+		if !ok {
+			t.Errorf("#%d: unexpected isolator value %T", i, iso.Value())
+			continue
+		}
+		if c.CPUs() != tt.cpus || c.Mems() != tt.mems {
+			t.Errorf("#%d: got cpus %q and mems %q, want %q and %q", i, c.CPUs(), c.Mems(), tt.cpus, tt.mems)
+		}
+	}
+}
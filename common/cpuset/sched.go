@@ -0,0 +1,73 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package cpuset
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// mpolBind is the MPOL_BIND memory policy, see set_mempolicy(2)
+const mpolBind = 2
+
+// SetAffinity restricts the calling thread, and the processes it executes,
+// to the CPUs of the list cpus, see sched_setaffinity(2).
+func SetAffinity(cpus string) error {
+	mask, err := listMask(cpus)
+	if err != nil {
+		return err
+	}
+	_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY, 0, uintptr(len(mask)*8), uintptr(unsafe.Pointer(&mask[0])))
+	if errno != 0 {
+		return fmt.Errorf("error setting the CPU affinity to %q: %v", cpus, errno)
+	}
+	return nil
+}
+
+// SetMemPolicy restricts the memory allocations of the calling thread, and
+// of the processes it executes, to the memory nodes of the list mems, see
+// set_mempolicy(2).
+func SetMemPolicy(mems string) error {
+	mask, err := listMask(mems)
+	if err != nil {
+		return err
+	}
+	// the kernel ignores the last bit of maxnode
+	maxnode := len(mask)*64 + 1
+	_, _, errno := syscall.RawSyscall(syscall.SYS_SET_MEMPOLICY, mpolBind, uintptr(unsafe.Pointer(&mask[0])), uintptr(maxnode))
+	if errno != 0 {
+		return fmt.Errorf("error setting the memory nodes to %q: %v", mems, errno)
+	}
+	return nil
+}
+
+// listMask returns the bit mask of a non-empty list
+func listMask(s string) ([]uint64, error) {
+	list, err := ParseList(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("empty list")
+	}
+	mask := make([]uint64, list[len(list)-1]/64+1)
+	for _, n := range list {
+		mask[n/64] |= 1 << uint(n%64)
+	}
+	return mask, nil
+}
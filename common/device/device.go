@@ -0,0 +1,115 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package device describes the host devices exposed to the apps of a pod.
+package device
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Device is a host device exposed to the apps of a pod.
+type Device struct {
+	HostPath string // path of the device on the host
+	PodPath  string // path of the device in the apps
+	Perms    string // cgroup device permissions, a subset of "rwm"
+}
+
+// Parse parses a device of the form HOSTPATH[:PODPATH][:PERMS]. The path in
+// the pod defaults to the path on the host and the permissions to "rwm".
+func Parse(s string) (*Device, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return nil, fmt.Errorf("invalid device %q, must be in the form HOSTPATH[:PODPATH][:PERMS]", s)
+	}
+
+	d := &Device{
+		HostPath: parts[0],
+		PodPath:  parts[0],
+		Perms:    "rwm",
+	}
+	switch len(parts) {
+	case 2:
+		// the second part is either the path in the pod or the permissions
+		if filepath.IsAbs(parts[1]) {
+			d.PodPath = parts[1]
+		} else {
+			d.Perms = parts[1]
+		}
+	case 3:
+		d.PodPath = parts[1]
+		d.Perms = parts[2]
+	}
+
+	if err := d.assertValid(); err != nil {
+		return nil, fmt.Errorf("invalid device %q: %v", s, err)
+	}
+	return d, nil
+}
+
+func (d *Device) assertValid() error {
+	if !filepath.IsAbs(d.HostPath) || !filepath.IsAbs(d.PodPath) {
+		return fmt.Errorf("the paths must be absolute")
+	}
+	if d.Perms == "" || strings.Trim(d.Perms, "rwm") != "" {
+		return fmt.Errorf("the permissions must be a combination of r, w and m")
+	}
+	return nil
+}
+
+// String returns the device in the form accepted by Parse.
+func (d *Device) String() string {
+	return strings.Join([]string{d.HostPath, d.PodPath, d.Perms}, ":")
+}
+
+// CheckHost returns an error if the device is not a device node on the host.
+func (d *Device) CheckHost() error {
+	fi, err := os.Stat(d.HostPath)
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeDevice == 0 {
+		return fmt.Errorf("%q is not a device", d.HostPath)
+	}
+	return nil
+}
+
+// ParseList parses a comma-separated list of devices, as stored in the
+// devices annotation of a pod.
+func ParseList(s string) ([]*Device, error) {
+	var devices []*Device
+	for _, ds := range strings.Split(s, ",") {
+		if ds == "" {
+			continue
+		}
+		d, err := Parse(ds)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, d)
+	}
+	return devices, nil
+}
+
+// FormatList returns the devices as a comma-separated list.
+func FormatList(devices []*Device) string {
+	var ds []string
+	for _, d := range devices {
+		ds = append(ds, d.String())
+	}
+	return strings.Join(ds, ",")
+}
@@ -0,0 +1,82 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package device
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected *Device
+	}{
+		{"/dev/kvm", &Device{"/dev/kvm", "/dev/kvm", "rwm"}},
+		{"/dev/dri/card0:/dev/card0", &Device{"/dev/dri/card0", "/dev/card0", "rwm"}},
+		{"/dev/kvm:rw", &Device{"/dev/kvm", "/dev/kvm", "rw"}},
+		{"/dev/dri/card0:/dev/card0:r", &Device{"/dev/dri/card0", "/dev/card0", "r"}},
+		{"dev/kvm", nil},
+		{"/dev/kvm:dev/kvm:rw", nil},
+		{"/dev/kvm:rx", nil},
+		{"/dev/kvm:/dev/kvm:", nil},
+		{"/dev/kvm:/dev/kvm:rw:m", nil},
+	}
+
+	for i, tt := range tests {
+		d, err := Parse(tt.in)
+		if tt.expected == nil {
+			if err == nil {
+				t.Errorf("#%d: expected error parsing %q", i, tt.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: unexpected error parsing %q: %v", i, tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(d, tt.expected) {
+			t.Errorf("#%d: got %v, want %v", i, d, tt.expected)
+		}
+	}
+}
+
+func TestList(t *testing.T) {
+	devices := []*Device{
+		{"/dev/kvm", "/dev/kvm", "rwm"},
+		{"/dev/dri/card0", "/dev/card0", "rw"},
+	}
+
+	s := FormatList(devices)
+	if s != "/dev/kvm:/dev/kvm:rwm,/dev/dri/card0:/dev/card0:rw" {
+		t.Errorf("unexpected formatted list %q", s)
+	}
+	parsed, err := ParseList(s)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(parsed, devices) {
+		t.Errorf("got %v, want %v", parsed, devices)
+	}
+}
+
+func TestCheckHost(t *testing.T) {
+	if err := (&Device{HostPath: "/dev/null"}).CheckHost(); err != nil {
+		t.Errorf("unexpected error for /dev/null: %v", err)
+	}
+	if err := (&Device{HostPath: "/"}).CheckHost(); err == nil {
+		t.Errorf("expected error for a directory")
+	}
+}
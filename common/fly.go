@@ -0,0 +1,87 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+)
+
+// The DNS modes of a fly pod, see ParseFlyDNS.
+const (
+	FlyDNSHost    = "host"
+	FlyDNSNone    = "none"
+	FlyDNSServers = "servers"
+)
+
+// ParseFlyMountsAllow parses the value of the fly-mounts-allow pod
+// annotation, a comma-separated list of absolute host paths. An empty value
+// allows no host path.
+func ParseFlyMountsAllow(value string) ([]string, error) {
+	allow := []string{}
+	for _, p := range strings.Split(value, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if !filepath.IsAbs(p) {
+			return nil, fmt.Errorf("path %q is not absolute", p)
+		}
+		allow = append(allow, filepath.Clean(p))
+	}
+	return allow, nil
+}
+
+// IsFlyMountAllowed returns whether the host path source can be mounted in
+// a fly pod allowed to mount the paths of allow: source must be one of them
+// or be in one of them, once the symlinks are resolved so source cannot
+// escape them.
+func IsFlyMountAllowed(source string, allow []string) (bool, error) {
+	resolved, err := filepath.EvalSymlinks(source)
+	if err != nil {
+		return false, err
+	}
+	for _, a := range allow {
+		if r, err := filepath.EvalSymlinks(a); err == nil {
+			a = r
+		}
+		if a == "/" || resolved == a || strings.HasPrefix(resolved, a+"/") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ParseFlyDNS parses the value of the fly-dns pod annotation. It returns the
+// mode FlyDNSHost for "host", FlyDNSNone for "none", or FlyDNSServers with
+// the name servers of a comma-separated list of IPs.
+func ParseFlyDNS(value string) (string, []string, error) {
+	switch value {
+	case FlyDNSHost, FlyDNSNone:
+		return value, nil, nil
+	}
+	var servers []string
+	for _, s := range strings.Split(value, ",") {
+		s = strings.TrimSpace(s)
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return "", nil, fmt.Errorf("%q is not %q, %q or a name server IP", s, FlyDNSHost, FlyDNSNone)
+		}
+		servers = append(servers, ip.String())
+	}
+	return FlyDNSServers, servers, nil
+}
@@ -0,0 +1,125 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseFlyMountsAllow(t *testing.T) {
+	tests := []struct {
+		value string
+		allow []string
+		werr  bool
+	}{
+		{"", []string{}, false},
+		{"/srv", []string{"/srv"}, false},
+		{"/srv/, /var/lib/foo/../bar", []string{"/srv", "/var/lib/bar"}, false},
+		{"/srv,srv", nil, true},
+	}
+
+	for i, tt := range tests {
+		allow, err := ParseFlyMountsAllow(tt.value)
+		if gotErr := err != nil; gotErr != tt.werr {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.werr)
+			continue
+		}
+		if !reflect.DeepEqual(allow, tt.allow) {
+			t.Errorf("#%d: got %v, want %v", i, allow, tt.allow)
+		}
+	}
+}
+
+func TestParseFlyDNS(t *testing.T) {
+	tests := []struct {
+		value   string
+		mode    string
+		servers []string
+		werr    bool
+	}{
+		{"host", FlyDNSHost, nil, false},
+		{"none", FlyDNSNone, nil, false},
+		{"8.8.8.8", FlyDNSServers, []string{"8.8.8.8"}, false},
+		{"10.0.0.1, 2001:db8::1", FlyDNSServers, []string{"10.0.0.1", "2001:db8::1"}, false},
+		{"", "", nil, true},
+		{"8.8.8.8,dns.example.com", "", nil, true},
+	}
+
+	for i, tt := range tests {
+		mode, servers, err := ParseFlyDNS(tt.value)
+		if gotErr := err != nil; gotErr != tt.werr {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.werr)
+			continue
+		}
+		if mode != tt.mode || !reflect.DeepEqual(servers, tt.servers) {
+			t.Errorf("#%d: got %q %v, want %q %v", i, mode, servers, tt.mode, tt.servers)
+		}
+	}
+}
+
+func TestIsFlyMountAllowed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rkt-fly-allow")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	// the temporary directory may be behind a symlink
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		t.Fatalf("error resolving tempdir: %v", err)
+	}
+
+	allowed := filepath.Join(dir, "allowed")
+	other := filepath.Join(dir, "allowed-not")
+	for _, d := range []string{filepath.Join(allowed, "sub"), other} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatalf("error creating %q: %v", d, err)
+		}
+	}
+	escape := filepath.Join(allowed, "escape")
+	if err := os.Symlink(other, escape); err != nil {
+		t.Fatalf("error creating symlink: %v", err)
+	}
+
+	tests := []struct {
+		source  string
+		allow   []string
+		allowed bool
+		werr    bool
+	}{
+		{allowed, []string{allowed}, true, false},
+		{filepath.Join(allowed, "sub"), []string{allowed}, true, false},
+		{other, []string{allowed}, false, false},
+		// a symlink cannot escape the allowed paths
+		{escape, []string{allowed}, false, false},
+		{other, []string{"/"}, true, false},
+		{other, []string{}, false, false},
+		{filepath.Join(dir, "missing"), []string{dir}, false, true},
+	}
+
+	for i, tt := range tests {
+		ok, err := IsFlyMountAllowed(tt.source, tt.allow)
+		if gotErr := err != nil; gotErr != tt.werr {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.werr)
+			continue
+		}
+		if ok != tt.allowed {
+			t.Errorf("#%d: expected %s allowed to be %t, got %t", i, tt.source, tt.allowed, ok)
+		}
+	}
+}
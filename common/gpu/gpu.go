@@ -0,0 +1,278 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gpu locates the NVIDIA GPUs and the user-space part of their
+// driver on the host, so that they can be exposed to the apps of a pod.
+package gpu
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/rkt/common/device"
+)
+
+const (
+	// DriverPath is the directory of the apps where the driver libraries
+	// and binaries are bind-mounted
+	DriverPath = "/usr/local/nvidia"
+	// LibraryPath is the directory of the apps containing the driver
+	// libraries
+	LibraryPath = DriverPath + "/lib64"
+	// BinaryPath is the directory of the apps containing the driver
+	// binaries
+	BinaryPath = DriverPath + "/bin"
+
+	// VisibleDevicesEnv is the environment variable listing the indices
+	// of the GPUs exposed to an app
+	VisibleDevicesEnv = "NVIDIA_VISIBLE_DEVICES"
+
+	nvidiaVendorID = "0x10de"
+	vfioDriver     = "vfio-pci"
+)
+
+var (
+	// the locations on the host, overridden in the tests
+	devDir    = "/dev"
+	pciDir    = "/sys/bus/pci/devices"
+	libDirs   = []string{"/usr/lib64", "/usr/lib/x86_64-linux-gnu", "/usr/lib/nvidia", "/usr/lib"}
+	binDirs   = []string{"/usr/bin", "/usr/local/bin", "/opt/bin"}
+	libraries = []string{
+		"libcuda.so",
+		"libnvcuvid.so",
+		"libnvidia-compiler.so",
+		"libnvidia-encode.so",
+		"libnvidia-fatbinaryloader.so",
+		"libnvidia-ml.so",
+		"libnvidia-opencl.so",
+		"libnvidia-ptxjitcompiler.so",
+	}
+	binaries = []string{
+		"nvidia-debugdump",
+		"nvidia-persistenced",
+		"nvidia-smi",
+	}
+	// control devices shared by all the GPUs, exposed when they exist
+	controlDevices = []string{
+		"nvidiactl",
+		"nvidia-uvm",
+		"nvidia-uvm-tools",
+		"nvidia-modeset",
+	}
+	// PCI device classes of the GPUs: VGA and 3D controllers
+	pciClasses = []string{"0x0300", "0x0302"}
+)
+
+// Spec selects the GPUs of the host exposed to the apps of a pod.
+type Spec struct {
+	All     bool
+	Indices []int
+}
+
+// ParseSpec parses "all" or a comma-separated list of GPU indices.
+func ParseSpec(s string) (*Spec, error) {
+	if s == "all" {
+		return &Spec{All: true}, nil
+	}
+	spec := &Spec{}
+	seen := make(map[int]bool)
+	for _, is := range strings.Split(s, ",") {
+		i, err := strconv.Atoi(is)
+		if err != nil || i < 0 {
+			return nil, fmt.Errorf("invalid GPU %q, must be \"all\" or a comma-separated list of GPU indices", s)
+		}
+		if seen[i] {
+			continue
+		}
+		seen[i] = true
+		spec.Indices = append(spec.Indices, i)
+	}
+	sort.Ints(spec.Indices)
+	return spec, nil
+}
+
+// String returns the GPUs in the form accepted by ParseSpec.
+func (s *Spec) String() string {
+	if s.All {
+		return "all"
+	}
+	var is []string
+	for _, i := range s.Indices {
+		is = append(is, strconv.Itoa(i))
+	}
+	return strings.Join(is, ",")
+}
+
+// selects returns the indices of the GPUs out of the count of GPUs found on
+// the host, or an error if one of them does not exist.
+func (s *Spec) selects(count int) ([]int, error) {
+	if s.All {
+		if count == 0 {
+			return nil, fmt.Errorf("no NVIDIA GPU found")
+		}
+		all := make([]int, count)
+		for i := range all {
+			all[i] = i
+		}
+		return all, nil
+	}
+	for _, i := range s.Indices {
+		if i >= count {
+			return nil, fmt.Errorf("GPU %d not found, %d NVIDIA GPU(s) on the host", i, count)
+		}
+	}
+	return s.Indices, nil
+}
+
+// Devices returns the device nodes of the selected GPUs, followed by the
+// control devices of the driver.
+func Devices(s *Spec) ([]*device.Device, error) {
+	matches, err := filepath.Glob(filepath.Join(devDir, "nvidia[0-9]*"))
+	if err != nil {
+		return nil, err
+	}
+	gpus := make(map[int]string)
+	for _, m := range matches {
+		i, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(m), "nvidia"))
+		if err != nil {
+			continue
+		}
+		gpus[i] = m
+	}
+	indices, err := s.selects(len(gpus))
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []*device.Device
+	for _, i := range indices {
+		path, ok := gpus[i]
+		if !ok {
+			return nil, fmt.Errorf("GPU %d not found in %s", i, devDir)
+		}
+		devices = append(devices, newDevice(path))
+	}
+	for _, name := range controlDevices {
+		path := filepath.Join(devDir, name)
+		if _, err := os.Stat(path); err == nil {
+			devices = append(devices, newDevice(path))
+		}
+	}
+	return devices, nil
+}
+
+func newDevice(hostPath string) *device.Device {
+	return &device.Device{
+		HostPath: hostPath,
+		PodPath:  filepath.Join("/dev", filepath.Base(hostPath)),
+		Perms:    "rwm",
+	}
+}
+
+// DriverFile is a file of the user-space driver bind-mounted in the apps.
+type DriverFile struct {
+	HostPath string // path of the file on the host
+	PodPath  string // path of the file in the apps
+}
+
+// DriverFiles returns the libraries and the binaries of the driver found on
+// the host. The versioned names of the libraries are kept, for the
+// applications linking against them.
+func DriverFiles() ([]DriverFile, error) {
+	var files []DriverFile
+	seen := make(map[string]bool)
+	for _, dir := range libDirs {
+		for _, lib := range libraries {
+			matches, err := filepath.Glob(filepath.Join(dir, lib+"*"))
+			if err != nil {
+				return nil, err
+			}
+			for _, m := range matches {
+				name := filepath.Base(m)
+				if seen[name] {
+					continue
+				}
+				seen[name] = true
+				files = append(files, DriverFile{HostPath: m, PodPath: filepath.Join(LibraryPath, name)})
+			}
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no NVIDIA driver library found in %s", strings.Join(libDirs, ", "))
+	}
+
+	for _, bin := range binaries {
+		for _, dir := range binDirs {
+			path := filepath.Join(dir, bin)
+			if _, err := os.Stat(path); err == nil {
+				files = append(files, DriverFile{HostPath: path, PodPath: filepath.Join(BinaryPath, bin)})
+				break
+			}
+		}
+	}
+	return files, nil
+}
+
+// PCIAddresses returns the PCI addresses of the selected GPUs, to pass them
+// through to a virtual machine. The GPUs must be bound to the vfio-pci
+// driver. They are indexed in the order of their addresses.
+func PCIAddresses(s *Spec) ([]string, error) {
+	entries, err := ioutil.ReadDir(pciDir)
+	if err != nil {
+		return nil, err
+	}
+	var gpus []string
+	for _, e := range entries {
+		addr := e.Name()
+		if readAttr(addr, "vendor") != nvidiaVendorID {
+			continue
+		}
+		class := readAttr(addr, "class")
+		for _, c := range pciClasses {
+			if strings.HasPrefix(class, c) {
+				gpus = append(gpus, addr)
+				break
+			}
+		}
+	}
+	sort.Strings(gpus)
+
+	indices, err := s.selects(len(gpus))
+	if err != nil {
+		return nil, err
+	}
+	var addrs []string
+	for _, i := range indices {
+		addr := gpus[i]
+		driver, err := os.Readlink(filepath.Join(pciDir, addr, "driver"))
+		if err != nil || filepath.Base(driver) != vfioDriver {
+			return nil, fmt.Errorf("GPU %d (%s) is not bound to the %s driver", i, addr, vfioDriver)
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
+func readAttr(addr, attr string) string {
+	b, err := ioutil.ReadFile(filepath.Join(pciDir, addr, attr))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
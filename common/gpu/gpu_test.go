@@ -0,0 +1,197 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gpu
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseSpec(t *testing.T) {
+	tests := []struct {
+		in   string
+		out  string
+		fail bool
+	}{
+		{"all", "all", false},
+		{"0", "0", false},
+		{"2,0,2", "0,2", false},
+		{"", "", true},
+		{"-1", "", true},
+		{"0,", "", true},
+		{"a", "", true},
+	}
+	for i, tt := range tests {
+		spec, err := ParseSpec(tt.in)
+		if tt.fail {
+			if err == nil {
+				t.Errorf("#%d: expected an error for %q", i, tt.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+		} else if spec.String() != tt.out {
+			t.Errorf("#%d: got %q, want %q", i, spec.String(), tt.out)
+		}
+	}
+}
+
+func touch(t *testing.T, path string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDevices(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rkt-gpu-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	devDir = dir
+	for _, name := range []string{"nvidia0", "nvidia1", "nvidiactl", "nvidia-uvm"} {
+		touch(t, filepath.Join(dir, name))
+	}
+
+	tests := []struct {
+		spec    string
+		devices []string
+		fail    bool
+	}{
+		{"all", []string{"/dev/nvidia0", "/dev/nvidia1", "/dev/nvidiactl", "/dev/nvidia-uvm"}, false},
+		{"1", []string{"/dev/nvidia1", "/dev/nvidiactl", "/dev/nvidia-uvm"}, false},
+		{"2", nil, true},
+	}
+	for i, tt := range tests {
+		spec, err := ParseSpec(tt.spec)
+		if err != nil {
+			t.Fatalf("#%d: unexpected error: %v", i, err)
+		}
+		devices, err := Devices(spec)
+		if tt.fail {
+			if err == nil {
+				t.Errorf("#%d: expected an error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+			continue
+		}
+		var paths []string
+		for _, d := range devices {
+			paths = append(paths, d.PodPath)
+		}
+		if !reflect.DeepEqual(paths, tt.devices) {
+			t.Errorf("#%d: got %v, want %v", i, paths, tt.devices)
+		}
+	}
+}
+
+func TestDriverFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rkt-gpu-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	libDirs = []string{filepath.Join(dir, "lib64"), filepath.Join(dir, "lib")}
+	binDirs = []string{filepath.Join(dir, "bin")}
+	touch(t, filepath.Join(dir, "lib64", "libcuda.so.1"))
+	touch(t, filepath.Join(dir, "lib", "libcuda.so.1"))
+	touch(t, filepath.Join(dir, "lib", "libnvidia-ml.so.1"))
+	touch(t, filepath.Join(dir, "lib", "libfoo.so.1"))
+	touch(t, filepath.Join(dir, "bin", "nvidia-smi"))
+
+	files, err := DriverFiles()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []DriverFile{
+		{filepath.Join(dir, "lib64", "libcuda.so.1"), "/usr/local/nvidia/lib64/libcuda.so.1"},
+		{filepath.Join(dir, "lib", "libnvidia-ml.so.1"), "/usr/local/nvidia/lib64/libnvidia-ml.so.1"},
+		{filepath.Join(dir, "bin", "nvidia-smi"), "/usr/local/nvidia/bin/nvidia-smi"},
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("got %v, want %v", files, want)
+	}
+}
+
+func TestPCIAddresses(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rkt-gpu-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pciDir = dir
+	for _, d := range []struct {
+		addr, vendor, class, driver string
+	}{
+		{"0000:00:02.0", "0x8086", "0x030000", "i915"},
+		{"0000:02:00.0", "0x10de", "0x030200", "vfio-pci"},
+		{"0000:01:00.0", "0x10de", "0x030000", "vfio-pci"},
+		{"0000:01:00.1", "0x10de", "0x040300", "vfio-pci"},
+		{"0000:03:00.0", "0x10de", "0x030000", "nvidia"},
+	} {
+		if err := os.MkdirAll(filepath.Join(dir, d.addr), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, d.addr, "vendor"), []byte(d.vendor+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, d.addr, "class"), []byte(d.class+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink("../../../bus/pci/drivers/"+d.driver, filepath.Join(dir, d.addr, "driver")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		spec  string
+		addrs []string
+		fail  bool
+	}{
+		{"0,1", []string{"0000:01:00.0", "0000:02:00.0"}, false},
+		{"1", []string{"0000:02:00.0"}, false},
+		// not bound to vfio-pci
+		{"all", nil, true},
+		{"3", nil, true},
+	}
+	for i, tt := range tests {
+		spec, err := ParseSpec(tt.spec)
+		if err != nil {
+			t.Fatalf("#%d: unexpected error: %v", i, err)
+		}
+		addrs, err := PCIAddresses(spec)
+		if tt.fail {
+			if err == nil {
+				t.Errorf("#%d: expected an error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+		} else if !reflect.DeepEqual(addrs, tt.addrs) {
+			t.Errorf("#%d: got %v, want %v", i, addrs, tt.addrs)
+		}
+	}
+}
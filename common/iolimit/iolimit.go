@@ -0,0 +1,238 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package iolimit implements the isolator throttling the disk IO of the apps.
+package iolimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+)
+
+// IsolatorName is the name of the isolator throttling the disk IO of an app
+// on block devices. Its value is of the form:
+//
+//	{"limits": {"/dev/sda": {"readBps": 10485760, "writeIops": 100}}}
+//
+// with the bandwidths in bytes per second and the IOPS in operations per
+// second. Unset or zero limits are unlimited.
+const IsolatorName = "coreos.com/rkt/io"
+
+func init() {
+	types.AddIsolatorValueConstructor(IsolatorName, NewIOLimits)
+}
+
+// Limit is the IO limits on a device.
+type Limit struct {
+	ReadBps   uint64 `json:"readBps,omitempty"`
+	WriteBps  uint64 `json:"writeBps,omitempty"`
+	ReadIOPS  uint64 `json:"readIops,omitempty"`
+	WriteIOPS uint64 `json:"writeIops,omitempty"`
+}
+
+// Limits maps the paths of the devices to their limits.
+type Limits map[string]Limit
+
+// IOLimits is the value of the io isolator.
+type IOLimits struct {
+	val ioLimitsValue
+}
+
+type ioLimitsValue struct {
+	Limits Limits `json:"limits"`
+}
+
+// NewIOLimits returns an empty value of the io isolator.
+func NewIOLimits() types.IsolatorValue {
+	return &IOLimits{}
+}
+
+func (l *IOLimits) UnmarshalJSON(b []byte) error {
+	var v ioLimitsValue
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	l.val = v
+	return nil
+}
+
+func (l IOLimits) AssertValid() error {
+	if len(l.val.Limits) == 0 {
+		return fmt.Errorf("limits must be non-empty")
+	}
+	return l.val.Limits.AssertValid()
+}
+
+// Limits returns the limits set by the isolator.
+func (l IOLimits) Limits() Limits {
+	return l.val.Limits
+}
+
+// AssertValid checks that the devices are absolute paths.
+func (l Limits) AssertValid() error {
+	for device := range l {
+		if !filepath.IsAbs(device) {
+			return fmt.Errorf("device %q is not an absolute path", device)
+		}
+	}
+	return nil
+}
+
+// Isolator returns the io isolator setting the limits.
+func (l Limits) Isolator() (*types.Isolator, error) {
+	// the value of an isolator is only set when unmarshalling it
+	b, err := json.Marshal(map[string]interface{}{
+		"name":  IsolatorName,
+		"value": ioLimitsValue{Limits: l},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var i types.Isolator
+	if err := i.UnmarshalJSON(b); err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+// Merge returns the limits of l overridden by the limits set in override.
+func (l Limits) Merge(override Limits) Limits {
+	merged := make(Limits)
+	for device, limit := range l {
+		merged[device] = limit
+	}
+	for device, limit := range override {
+		merged[device] = merged[device].Merge(limit)
+	}
+	return merged
+}
+
+// Merge returns the limit l overridden by the non-zero values of override.
+func (l Limit) Merge(override Limit) Limit {
+	for _, v := range []struct {
+		dst *uint64
+		src uint64
+	}{
+		{&l.ReadBps, override.ReadBps},
+		{&l.WriteBps, override.WriteBps},
+		{&l.ReadIOPS, override.ReadIOPS},
+		{&l.WriteIOPS, override.WriteIOPS},
+	} {
+		if v.src != 0 {
+			*v.dst = v.src
+		}
+	}
+	return l
+}
+
+// Parse parses limits of the form DEVICE:KEY=VALUE[,KEY=VALUE...], where the
+// keys are read-bps, write-bps, read-iops and write-iops. The bandwidths are
+// in bytes per second, with an optional k, m or g suffix.
+func Parse(s string) (string, Limit, error) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", Limit{}, fmt.Errorf("invalid limit %q, must be in the form DEVICE:KEY=VALUE[,KEY=VALUE...]", s)
+	}
+	device := parts[0]
+	if !filepath.IsAbs(device) {
+		return "", Limit{}, fmt.Errorf("device %q is not an absolute path", device)
+	}
+
+	var limit Limit
+	for _, kv := range strings.Split(parts[1], ",") {
+		p := strings.SplitN(kv, "=", 2)
+		if len(p) != 2 {
+			return "", Limit{}, fmt.Errorf("invalid limit %q in %q, must be in the form KEY=VALUE", kv, s)
+		}
+		var err error
+		switch p[0] {
+		case "read-bps":
+			limit.ReadBps, err = parseBandwidth(p[1])
+		case "write-bps":
+			limit.WriteBps, err = parseBandwidth(p[1])
+		case "read-iops":
+			limit.ReadIOPS, err = strconv.ParseUint(p[1], 10, 64)
+		case "write-iops":
+			limit.WriteIOPS, err = strconv.ParseUint(p[1], 10, 64)
+		default:
+			return "", Limit{}, fmt.Errorf("unknown limit %q in %q, must be one of read-bps, write-bps, read-iops or write-iops", p[0], s)
+		}
+		if err != nil {
+			return "", Limit{}, fmt.Errorf("invalid value of %s in %q", p[0], s)
+		}
+	}
+
+	return device, limit, nil
+}
+
+func parseBandwidth(s string) (uint64, error) {
+	multiplier := uint64(1)
+	switch {
+	case strings.HasSuffix(s, "k"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(s, "m"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(s, "g"):
+		multiplier = 1 << 30
+	}
+	if multiplier != 1 {
+		s = s[:len(s)-1]
+	}
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return v * multiplier, nil
+}
+
+// Devices returns the devices of the limits, sorted.
+func (l Limits) Devices() []string {
+	var devices []string
+	for device := range l {
+		devices = append(devices, device)
+	}
+	sort.Strings(devices)
+	return devices
+}
+
+// String returns the limits in the form accepted by Parse, separated by
+// spaces.
+func (l Limits) String() string {
+	var limits []string
+	for _, device := range l.Devices() {
+		limit := l[device]
+		var kvs []string
+		for _, v := range []struct {
+			key   string
+			value uint64
+		}{
+			{"read-bps", limit.ReadBps},
+			{"write-bps", limit.WriteBps},
+			{"read-iops", limit.ReadIOPS},
+			{"write-iops", limit.WriteIOPS},
+		} {
+			if v.value != 0 {
+				kvs = append(kvs, fmt.Sprintf("%s=%d", v.key, v.value))
+			}
+		}
+		limits = append(limits, device+":"+strings.Join(kvs, ","))
+	}
+	return strings.Join(limits, " ")
+}
@@ -0,0 +1,81 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iolimit
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in     string
+		device string
+		limit  Limit
+		werr   bool
+	}{
+		{"/dev/sda:read-bps=10m", "/dev/sda", Limit{ReadBps: 10 << 20}, false},
+		{"/dev/sdb:write-bps=512k,write-iops=100", "/dev/sdb", Limit{WriteBps: 512 << 10, WriteIOPS: 100}, false},
+		{"/dev/sda:read-iops=50,read-bps=1024", "/dev/sda", Limit{ReadBps: 1024, ReadIOPS: 50}, false},
+		{"/dev/sda", "", Limit{}, true},
+		{"sda:read-bps=1m", "", Limit{}, true},
+		{"/dev/sda:read-bps", "", Limit{}, true},
+		{"/dev/sda:read-bps=fast", "", Limit{}, true},
+		{"/dev/sda:read-iops=1k", "", Limit{}, true},
+		{"/dev/sda:weight=100", "", Limit{}, true},
+	}
+
+	for i, tt := range tests {
+		device, limit, err := Parse(tt.in)
+		if gerr := (err != nil); gerr != tt.werr {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.werr)
+		}
+		if device != tt.device || limit != tt.limit {
+			t.Errorf("#%d: got %s:%v, want %s:%v", i, device, limit, tt.device, tt.limit)
+		}
+	}
+}
+
+func TestIsolator(t *testing.T) {
+	image := Limits{"/dev/sda": {ReadBps: 1024, WriteBps: 1024}, "/dev/sdb": {ReadIOPS: 10}}
+	limits := image.Merge(Limits{"/dev/sda": {WriteBps: 4096}})
+
+	i, err := limits.Isolator()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the isolator survives a round trip through the manifest
+	b, err := json.Marshal(types.Isolators{*i})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var isolators types.Isolators
+	if err := json.Unmarshal(b, &isolators); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	l, ok := isolators[0].Value().(*IOLimits)
+	if !ok {
+		t.Fatalf("unexpected isolator value %T", isolators[0].Value())
+	}
+
+	expected := Limits{"/dev/sda": {ReadBps: 1024, WriteBps: 4096}, "/dev/sdb": {ReadIOPS: 10}}
+	if !reflect.DeepEqual(l.Limits(), expected) {
+		t.Errorf("got %v, want %v", l.Limits(), expected)
+	}
+}
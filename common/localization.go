@@ -0,0 +1,55 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// LocalizationHost is the value of the timezone and locale pod annotations
+// taking them from the host.
+const LocalizationHost = "host"
+
+var (
+	// timezoneRegexp matches the names of the tz database, e.g.
+	// Europe/Berlin or Etc/GMT+2
+	timezoneRegexp = regexp.MustCompile(`^[A-Za-z0-9_+-]+(/[A-Za-z0-9_+-]+)*$`)
+	// localeRegexp matches the locale names, e.g. en_US.UTF-8 or
+	// sr_RS@latin
+	localeRegexp = regexp.MustCompile(`^[A-Za-z0-9_.@-]+$`)
+)
+
+// ValidateTimezone returns an error if tz is neither "host" nor the name of
+// a timezone of the tz database.
+func ValidateTimezone(tz string) error {
+	if tz == LocalizationHost {
+		return nil
+	}
+	if !timezoneRegexp.MatchString(tz) {
+		return fmt.Errorf("invalid timezone %q, must be %q or a name like Europe/Berlin", tz, LocalizationHost)
+	}
+	return nil
+}
+
+// ValidateLocale returns an error if locale is not a locale name. The
+// "host" value of the flag is resolved by stage0 before it is set in the
+// pod annotation.
+func ValidateLocale(locale string) error {
+	if !localeRegexp.MatchString(locale) {
+		return fmt.Errorf("invalid locale %q, must be a name like en_US.UTF-8", locale)
+	}
+	return nil
+}
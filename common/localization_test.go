@@ -0,0 +1,63 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import "testing"
+
+func TestValidateTimezone(t *testing.T) {
+	tests := []struct {
+		tz   string
+		werr bool
+	}{
+		{"host", false},
+		{"UTC", false},
+		{"Europe/Berlin", false},
+		{"America/Argentina/Buenos_Aires", false},
+		{"Etc/GMT+2", false},
+		{"", true},
+		{"/etc/localtime", true},
+		{"../../etc/shadow", true},
+		{"Europe//Berlin", true},
+	}
+
+	for i, tt := range tests {
+		err := ValidateTimezone(tt.tz)
+		if gotErr := err != nil; gotErr != tt.werr {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.werr)
+		}
+	}
+}
+
+func TestValidateLocale(t *testing.T) {
+	tests := []struct {
+		locale string
+		werr   bool
+	}{
+		{"C", false},
+		{"en_US.UTF-8", false},
+		{"sr_RS@latin", false},
+		{"", true},
+		{"host", false},
+		{"en_US.UTF-8\nLC_ALL=C", true},
+		{"de_DE/../C", true},
+	}
+
+	for i, tt := range tests {
+		err := ValidateLocale(tt.locale)
+		if gotErr := err != nil; gotErr != tt.werr {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.werr)
+		}
+	}
+}
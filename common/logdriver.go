@@ -0,0 +1,72 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+)
+
+// Log drivers, where the output of the apps is sent
+const (
+	// LogDriverJournald sends it to the journal of the pod
+	LogDriverJournald = "journald"
+	// LogDriverSyslog sends it to a syslog server, in the RFC 5424
+	// format, over UDP or TCP
+	LogDriverSyslog = "syslog"
+	// LogDriverFluentd sends it to a fluentd server with its forward
+	// protocol, over TCP
+	LogDriverFluentd = "fluentd"
+)
+
+// ParseLogDriverAddress returns the network and the host:port of the
+// address of the server of a log driver, of the form udp://HOST:PORT or
+// tcp://HOST:PORT. The syslog driver supports both networks and the
+// fluentd driver only tcp; the journald driver has no address.
+func ParseLogDriverAddress(driver, address string) (network string, hostport string, err error) {
+	switch driver {
+	case LogDriverJournald:
+		if address != "" {
+			return "", "", fmt.Errorf("the %s log driver has no address", driver)
+		}
+		return "", "", nil
+	case LogDriverSyslog, LogDriverFluentd:
+	default:
+		return "", "", fmt.Errorf("unknown log driver %q, must be %s, %s or %s", driver, LogDriverJournald, LogDriverSyslog, LogDriverFluentd)
+	}
+
+	if address == "" {
+		return "", "", fmt.Errorf("the %s log driver requires an address", driver)
+	}
+	u, err := url.Parse(address)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid log driver address %q: %v", address, err)
+	}
+	switch {
+	case u.Scheme == "tcp":
+	case u.Scheme == "udp" && driver == LogDriverSyslog:
+	default:
+		return "", "", fmt.Errorf("invalid log driver address %q, the %s log driver does not support the %q network", address, driver, u.Scheme)
+	}
+	if u.Path != "" || u.RawQuery != "" || u.User != nil {
+		return "", "", fmt.Errorf("invalid log driver address %q, must be %s://HOST:PORT", address, u.Scheme)
+	}
+	host, port, err := net.SplitHostPort(u.Host)
+	if err != nil || host == "" || port == "" {
+		return "", "", fmt.Errorf("invalid log driver address %q, must be %s://HOST:PORT", address, u.Scheme)
+	}
+	return u.Scheme, u.Host, nil
+}
@@ -0,0 +1,54 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import "testing"
+
+func TestParseLogDriverAddress(t *testing.T) {
+	tests := []struct {
+		driver   string
+		address  string
+		network  string
+		hostport string
+		err      bool
+	}{
+		{"journald", "", "", "", false},
+		{"journald", "udp://10.0.0.1:514", "", "", true},
+		{"syslog", "udp://10.0.0.1:514", "udp", "10.0.0.1:514", false},
+		{"syslog", "tcp://logs.example.com:6514", "tcp", "logs.example.com:6514", false},
+		{"syslog", "tcp://[fd00::1]:514", "tcp", "[fd00::1]:514", false},
+		{"fluentd", "tcp://10.0.0.1:24224", "tcp", "10.0.0.1:24224", false},
+		{"fluentd", "udp://10.0.0.1:24224", "", "", true},
+		{"syslog", "", "", "", true},
+		{"syslog", "unix:///dev/log", "", "", true},
+		{"syslog", "udp://10.0.0.1", "", "", true},
+		{"syslog", "udp://:514", "", "", true},
+		{"syslog", "tcp://10.0.0.1:514/path", "", "", true},
+		{"syslog", "10.0.0.1:514", "", "", true},
+		{"gelf", "udp://10.0.0.1:12201", "", "", true},
+		{"", "", "", "", true},
+	}
+
+	for i, tt := range tests {
+		network, hostport, err := ParseLogDriverAddress(tt.driver, tt.address)
+		if gotErr := err != nil; gotErr != tt.err {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.err)
+			continue
+		}
+		if network != tt.network || hostport != tt.hostport {
+			t.Errorf("#%d: got %q %q, want %q %q", i, network, hostport, tt.network, tt.hostport)
+		}
+	}
+}
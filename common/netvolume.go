@@ -0,0 +1,115 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+)
+
+// The kinds of the volumes of network file systems, mounted by stage1 in
+// the pod
+const (
+	VolumeKindNFS  = "nfs"
+	VolumeKindCIFS = "cifs"
+)
+
+// NetworkVolume is a network file system mounted by stage1 in the mount
+// namespace of the pod and bind mounted in the apps, so it doesn't need to
+// be mounted on the host. It is passed to stage1 as an empty volume,
+// described by NetworkVolumesAnnotation.
+type NetworkVolume struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+	// Source is host:/path for nfs and //host/share for cifs
+	Source string `json:"source"`
+	// Options are the mount options of the file system
+	Options []string `json:"options,omitempty"`
+	// Secret is the name of the secret holding the credentials file of
+	// a cifs volume
+	Secret   string `json:"secret,omitempty"`
+	ReadOnly bool   `json:"readOnly,omitempty"`
+}
+
+// IsNetworkVolumeKind returns whether kind is the kind of a network volume.
+func IsNetworkVolumeKind(kind string) bool {
+	return kind == VolumeKindNFS || kind == VolumeKindCIFS
+}
+
+// Validate checks the source, the options and the secret of v.
+func (v *NetworkVolume) Validate() error {
+	if _, err := types.NewACName(v.Name); err != nil {
+		return fmt.Errorf("invalid volume name %q: %v", v.Name, err)
+	}
+	switch v.Kind {
+	case VolumeKindNFS:
+		i := strings.Index(v.Source, ":")
+		if i <= 0 || !strings.HasPrefix(v.Source[i+1:], "/") {
+			return fmt.Errorf("invalid nfs source %q, must be HOST:/PATH", v.Source)
+		}
+		if v.Secret != "" {
+			return fmt.Errorf("secrets are only supported by cifs volumes")
+		}
+	case VolumeKindCIFS:
+		parts := strings.SplitN(strings.TrimPrefix(v.Source, "//"), "/", 2)
+		if !strings.HasPrefix(v.Source, "//") || len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("invalid cifs source %q, must be //HOST/SHARE", v.Source)
+		}
+		if v.Secret != "" {
+			if _, err := types.NewACName(v.Secret); err != nil {
+				return fmt.Errorf("invalid secret name %q: %v", v.Secret, err)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown network volume kind %q, must be %q or %q", v.Kind, VolumeKindNFS, VolumeKindCIFS)
+	}
+	for _, opt := range v.Options {
+		if opt == "" || strings.Contains(opt, ",") {
+			return fmt.Errorf("invalid mount option %q", opt)
+		}
+		switch strings.SplitN(opt, "=", 2)[0] {
+		case "credentials", "password", "pass":
+			// they would be stored in the pod manifest
+			return fmt.Errorf("mount option %q not allowed, the credentials must be given with a secret", opt)
+		}
+	}
+	return nil
+}
+
+// Host returns the server of the source of v.
+func (v *NetworkVolume) Host() string {
+	if v.Kind == VolumeKindCIFS {
+		return strings.SplitN(strings.TrimPrefix(v.Source, "//"), "/", 2)[0]
+	}
+	return strings.SplitN(v.Source, ":", 2)[0]
+}
+
+// ParseNetworkVolumes parses and validates the value of
+// NetworkVolumesAnnotation.
+func ParseNetworkVolumes(value string) ([]NetworkVolume, error) {
+	var vols []NetworkVolume
+	if err := json.Unmarshal([]byte(value), &vols); err != nil {
+		return nil, fmt.Errorf("invalid network volumes: %v", err)
+	}
+	for i := range vols {
+		if err := vols[i].Validate(); err != nil {
+			return nil, fmt.Errorf("invalid network volume %q: %v", vols[i].Name, err)
+		}
+	}
+	return vols, nil
+}
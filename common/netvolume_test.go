@@ -0,0 +1,80 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNetworkVolumeValidate(t *testing.T) {
+	tests := []struct {
+		vol  NetworkVolume
+		werr bool
+	}{
+		{NetworkVolume{Name: "data", Kind: "nfs", Source: "fs.example.com:/srv/data", Options: []string{"vers=4", "soft"}}, false},
+		{NetworkVolume{Name: "share", Kind: "cifs", Source: "//fs.example.com/share", Secret: "smb-creds"}, false},
+		{NetworkVolume{Name: "Data", Kind: "nfs", Source: "fs.example.com:/srv/data"}, true},
+		{NetworkVolume{Name: "data", Kind: "ceph", Source: "fs.example.com:/srv/data"}, true},
+		{NetworkVolume{Name: "data", Kind: "nfs", Source: "fs.example.com:srv"}, true},
+		{NetworkVolume{Name: "data", Kind: "nfs", Source: ":/srv"}, true},
+		{NetworkVolume{Name: "data", Kind: "nfs", Source: "fs.example.com:/srv", Secret: "creds"}, true},
+		{NetworkVolume{Name: "share", Kind: "cifs", Source: "fs.example.com/share"}, true},
+		{NetworkVolume{Name: "share", Kind: "cifs", Source: "//fs.example.com"}, true},
+		{NetworkVolume{Name: "share", Kind: "cifs", Source: "//fs.example.com/share", Options: []string{"password=hunter2"}}, true},
+		{NetworkVolume{Name: "share", Kind: "cifs", Source: "//fs.example.com/share", Options: []string{"ro,soft"}}, true},
+	}
+
+	for i, tt := range tests {
+		err := tt.vol.Validate()
+		if gotErr := err != nil; gotErr != tt.werr {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.werr)
+		}
+	}
+}
+
+func TestNetworkVolumeHost(t *testing.T) {
+	tests := []struct {
+		vol  NetworkVolume
+		host string
+	}{
+		{NetworkVolume{Kind: "nfs", Source: "fs.example.com:/srv/data"}, "fs.example.com"},
+		{NetworkVolume{Kind: "nfs", Source: "10.0.0.2:/srv"}, "10.0.0.2"},
+		{NetworkVolume{Kind: "cifs", Source: "//fs.example.com/share"}, "fs.example.com"},
+	}
+
+	for i, tt := range tests {
+		if host := tt.vol.Host(); host != tt.host {
+			t.Errorf("#%d: got host %q, want %q", i, host, tt.host)
+		}
+	}
+}
+
+func TestParseNetworkVolumes(t *testing.T) {
+	vols, err := ParseNetworkVolumes(`[{"name": "data", "kind": "nfs", "source": "fs:/srv", "options": ["soft"], "readOnly": true}]`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []NetworkVolume{{Name: "data", Kind: "nfs", Source: "fs:/srv", Options: []string{"soft"}, ReadOnly: true}}
+	if !reflect.DeepEqual(vols, expected) {
+		t.Errorf("got %+v, want %+v", vols, expected)
+	}
+
+	for _, value := range []string{"", "{}", `[{"name": "data", "kind": "nfs", "source": "/srv"}]`} {
+		if _, err := ParseNetworkVolumes(value); err == nil {
+			t.Errorf("expected an error for %q", value)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// magic numbers of the file systems which cannot hold the layers of an
+// overlay filesystem, see statfs(2)
+var overlayUnsupportedFS = map[int64]string{
+	0x6969:     "NFS",
+	0xff534d42: "CIFS",
+	0x517b:     "SMB",
+	0xfe534d42: "SMB2",
+	0x794c7630: "overlayfs",
+}
+
+// checkOverlayKernel returns an error if the kernel doesn't support the
+// overlay filesystem.
+func checkOverlayKernel() error {
+	exec.Command("modprobe", "overlay").Run()
+
+	f, err := os.Open("/proc/filesystems")
+	if err != nil {
+		return fmt.Errorf("cannot open /proc/filesystems: %v", err)
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if s.Text() == "nodev\toverlay" {
+			return nil
+		}
+	}
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("cannot read /proc/filesystems: %v", err)
+	}
+	return fmt.Errorf("the kernel %s does not support the overlay filesystem", kernelRelease())
+}
+
+// kernelRelease returns the release of the running kernel, as uname -r.
+func kernelRelease() string {
+	var uts syscall.Utsname
+	if err := syscall.Uname(&uts); err != nil {
+		return "(unknown release)"
+	}
+	var release []byte
+	for _, c := range uts.Release {
+		if c == 0 {
+			break
+		}
+		release = append(release, byte(c))
+	}
+	return string(release)
+}
+
+// CheckOverlay returns nil if the pods and the images stored in the rkt data
+// directory dir can be mounted with the overlay filesystem, or an error
+// explaining why they cannot.
+func CheckOverlay(dir string) error {
+	if err := checkOverlayKernel(); err != nil {
+		return err
+	}
+
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		if os.IsNotExist(err) {
+			// nothing has been stored yet, the directory will be
+			// created on the file system of its parent
+			return nil
+		}
+		return fmt.Errorf("cannot get the file system of %q: %v", dir, err)
+	}
+	if fs, ok := overlayUnsupportedFS[int64(st.Type)&0xffffffff]; ok {
+		return fmt.Errorf("the rkt data directory %q is on %s, which cannot be used by the overlay filesystem", dir, fs)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+// PodCgroups are the cgroups and systemd units of a running pod, written as
+// JSON by stage1 in the PodCgroupsFilename file of the pod directory.
+type PodCgroups struct {
+	// Cgroup is the cgroup of the pod, from the root of the hierarchy
+	Cgroup string `json:"cgroup"`
+	// Unit is the systemd unit of the host holding the pod, a machine
+	// scope or the service running rkt, empty if the pod has no unit
+	// of its own
+	Unit string `json:"unit,omitempty"`
+	// Apps are the cgroups and units of the apps
+	Apps []AppCgroup `json:"apps"`
+}
+
+// AppCgroup is the cgroup and systemd unit of an app of a pod.
+type AppCgroup struct {
+	// Name is the name of the app
+	Name string `json:"name"`
+	// Cgroup is the cgroup of the app, from the root of the hierarchy,
+	// empty if the app does not run in a cgroup of the host, like the
+	// apps of the kvm flavor
+	Cgroup string `json:"cgroup,omitempty"`
+	// Unit is the service running the app in the systemd of the pod
+	Unit string `json:"unit"`
+}
@@ -0,0 +1,75 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package podtemplate renders the pod manifest templates given to rkt run
+// and rkt prepare, with the values of their variables set on the command
+// line.
+//
+// A template is a pod manifest using the text/template syntax, e.g.
+// "name": "example.com/app:{{.version}}". The values are escaped as JSON
+// strings, so they can be used in the strings of the manifest.
+package podtemplate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+var varNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ParseVar parses a NAME=VALUE variable. The name must be usable as a field
+// of the template, made of letters, digits and underscores.
+func ParseVar(s string) (string, string, error) {
+	pair := strings.SplitN(s, "=", 2)
+	if len(pair) != 2 {
+		return "", "", fmt.Errorf("%q must be specified as name=value", s)
+	}
+	if !varNameRegexp.MatchString(pair[0]) {
+		return "", "", fmt.Errorf("invalid variable name %q, must be made of letters, digits and underscores", pair[0])
+	}
+	return pair[0], pair[1], nil
+}
+
+// Render renders the pod manifest template with the given variables. It
+// fails if the template uses a variable which is not set.
+func Render(tmpl []byte, vars map[string]string) ([]byte, error) {
+	t, err := template.New("pod manifest").Option("missingkey=error").Parse(string(tmpl))
+	if err != nil {
+		return nil, fmt.Errorf("invalid pod manifest template: %v", err)
+	}
+
+	escaped := make(map[string]string, len(vars))
+	for name, value := range vars {
+		escaped[name] = jsonEscape(value)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, escaped); err != nil {
+		return nil, fmt.Errorf("error rendering the pod manifest template: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// jsonEscape returns the value escaped as the content of a JSON string.
+func jsonEscape(value string) string {
+	b, err := json.Marshal(value)
+	if err != nil {
+		// a string is always marshalled
+		panic(err)
+	}
+	return string(b[1 : len(b)-1])
+}
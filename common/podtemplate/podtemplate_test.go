@@ -0,0 +1,96 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package podtemplate
+
+import "testing"
+
+func TestParseVar(t *testing.T) {
+	tests := []struct {
+		in    string
+		name  string
+		value string
+		werr  bool
+	}{
+		{"version=1.2", "version", "1.2", false},
+		{"image_tag=a=b", "image_tag", "a=b", false},
+		{"empty=", "empty", "", false},
+		{"version", "", "", true},
+		{"=1.2", "", "", true},
+		{"image-tag=1", "", "", true},
+		{"1st=1", "", "", true},
+	}
+	for i, tt := range tests {
+		name, value, err := ParseVar(tt.in)
+		if gotErr := err != nil; gotErr != tt.werr {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.werr)
+			continue
+		}
+		if name != tt.name || value != tt.value {
+			t.Errorf("#%d: got %q=%q, want %q=%q", i, name, value, tt.name, tt.value)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		tmpl string
+		vars map[string]string
+		out  string
+		werr bool
+	}{
+		{
+			`{"name": "example.com/app:{{.version}}"}`,
+			map[string]string{"version": "1.2"},
+			`{"name": "example.com/app:1.2"}`,
+			false,
+		},
+		{
+			`{"value": "{{.quoted}}"}`,
+			map[string]string{"quoted": `say "hi"` + "\n"},
+			`{"value": "say \"hi\"\n"}`,
+			false,
+		},
+		{
+			`{"name": "example.com/app"}`,
+			nil,
+			`{"name": "example.com/app"}`,
+			false,
+		},
+		// variable not set
+		{
+			`{"name": "example.com/app:{{.version}}"}`,
+			map[string]string{"release": "1.2"},
+			"",
+			true,
+		},
+		// invalid template
+		{
+			`{"name": "example.com/app:{{.version"}`,
+			map[string]string{"version": "1.2"},
+			"",
+			true,
+		},
+	}
+	for i, tt := range tests {
+		out, err := Render([]byte(tt.tmpl), tt.vars)
+		if gotErr := err != nil; gotErr != tt.werr {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.werr)
+			continue
+		}
+		if string(out) != tt.out {
+			t.Errorf("#%d: got %q, want %q", i, out, tt.out)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rlimit implements the isolator setting the resource limits
+// (ulimits) of the apps.
+package rlimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+)
+
+// IsolatorName is the name of the isolator setting the resource limits of an
+// app. Its value is of the form:
+//
+//	{"limits": {"nofile": {"soft": 1024, "hard": 65536}}}
+const IsolatorName = "coreos.com/rkt/rlimits"
+
+// Infinity is the value of an unlimited resource.
+const Infinity = math.MaxUint64
+
+// resources maps the names of the resources to the systemd directives
+// setting them, see systemd.exec(5)
+var resources = map[string]string{
+	"as":         "LimitAS",
+	"core":       "LimitCORE",
+	"cpu":        "LimitCPU",
+	"data":       "LimitDATA",
+	"fsize":      "LimitFSIZE",
+	"locks":      "LimitLOCKS",
+	"memlock":    "LimitMEMLOCK",
+	"msgqueue":   "LimitMSGQUEUE",
+	"nice":       "LimitNICE",
+	"nofile":     "LimitNOFILE",
+	"nproc":      "LimitNPROC",
+	"rss":        "LimitRSS",
+	"rtprio":     "LimitRTPRIO",
+	"rttime":     "LimitRTTIME",
+	"sigpending": "LimitSIGPENDING",
+	"stack":      "LimitSTACK",
+}
+
+func init() {
+	types.AddIsolatorValueConstructor(IsolatorName, NewRlimits)
+}
+
+// Limit is the soft and hard limits of a resource.
+type Limit struct {
+	Soft uint64 `json:"soft"`
+	Hard uint64 `json:"hard"`
+}
+
+// Limits maps the names of the resources to their limits.
+type Limits map[string]Limit
+
+// Rlimits is the value of the rlimits isolator.
+type Rlimits struct {
+	val rlimitsValue
+}
+
+type rlimitsValue struct {
+	Limits Limits `json:"limits"`
+}
+
+// NewRlimits returns an empty value of the rlimits isolator.
+func NewRlimits() types.IsolatorValue {
+	return &Rlimits{}
+}
+
+func (r *Rlimits) UnmarshalJSON(b []byte) error {
+	var v rlimitsValue
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	r.val = v
+	return nil
+}
+
+func (r Rlimits) AssertValid() error {
+	if len(r.val.Limits) == 0 {
+		return fmt.Errorf("limits must be non-empty")
+	}
+	return r.val.Limits.AssertValid()
+}
+
+// Limits returns the limits set by the isolator.
+func (r Rlimits) Limits() Limits {
+	return r.val.Limits
+}
+
+// AssertValid checks that the resources are known and that the soft limits
+// do not exceed the hard limits.
+func (l Limits) AssertValid() error {
+	for name, limit := range l {
+		if _, ok := resources[name]; !ok {
+			return fmt.Errorf("unknown resource %q", name)
+		}
+		if limit.Soft > limit.Hard {
+			return fmt.Errorf("soft limit of %q exceeds its hard limit", name)
+		}
+	}
+	return nil
+}
+
+// Isolator returns the rlimits isolator setting the limits.
+func (l Limits) Isolator() (*types.Isolator, error) {
+	// the value of an isolator is only set when unmarshalling it
+	b, err := json.Marshal(map[string]interface{}{
+		"name":  IsolatorName,
+		"value": rlimitsValue{Limits: l},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var i types.Isolator
+	if err := i.UnmarshalJSON(b); err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+// Merge returns the limits of l overridden by the ones of override.
+func (l Limits) Merge(override Limits) Limits {
+	merged := make(Limits)
+	for name, limit := range l {
+		merged[name] = limit
+	}
+	for name, limit := range override {
+		merged[name] = limit
+	}
+	return merged
+}
+
+// Parse parses a limit of the form RESOURCE=SOFT[:HARD]. The hard limit
+// defaults to the soft limit, and both can be "unlimited".
+func Parse(s string) (string, Limit, error) {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 {
+		return "", Limit{}, fmt.Errorf("invalid limit %q, must be in the form RESOURCE=SOFT[:HARD]", s)
+	}
+	name := parts[0]
+	if _, ok := resources[name]; !ok {
+		return "", Limit{}, fmt.Errorf("unknown resource %q, must be one of %s", name, strings.Join(resourceNames(), ", "))
+	}
+
+	values := strings.SplitN(parts[1], ":", 2)
+	soft, err := parseValue(values[0])
+	if err != nil {
+		return "", Limit{}, fmt.Errorf("invalid soft limit in %q: %v", s, err)
+	}
+	hard := soft
+	if len(values) == 2 {
+		if hard, err = parseValue(values[1]); err != nil {
+			return "", Limit{}, fmt.Errorf("invalid hard limit in %q: %v", s, err)
+		}
+	}
+	if soft > hard {
+		return "", Limit{}, fmt.Errorf("soft limit exceeds the hard limit in %q", s)
+	}
+
+	return name, Limit{Soft: soft, Hard: hard}, nil
+}
+
+func parseValue(s string) (uint64, error) {
+	if s == "unlimited" || s == "infinity" {
+		return Infinity, nil
+	}
+	return strconv.ParseUint(s, 10, 64)
+}
+
+func formatValue(v uint64) string {
+	if v == Infinity {
+		return "infinity"
+	}
+	return strconv.FormatUint(v, 10)
+}
+
+func resourceNames() []string {
+	var names []string
+	for name := range resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SystemdDirectives returns the systemd directives of the service of an app
+// setting the limits, sorted by name, as pairs of directive and value.
+// Different soft and hard limits need systemd v226 or later.
+func (l Limits) SystemdDirectives() [][2]string {
+	var directives [][2]string
+	for _, name := range resourceNames() {
+		limit, ok := l[name]
+		if !ok {
+			continue
+		}
+		value := formatValue(limit.Hard)
+		if limit.Soft != limit.Hard {
+			value = formatValue(limit.Soft) + ":" + value
+		}
+		directives = append(directives, [2]string{resources[name], value})
+	}
+	return directives
+}
+
+// String returns the limits in the form accepted by Parse, separated by
+// spaces.
+func (l Limits) String() string {
+	var limits []string
+	for _, name := range resourceNames() {
+		if limit, ok := l[name]; ok {
+			limits = append(limits, fmt.Sprintf("%s=%s:%s", name, formatValue(limit.Soft), formatValue(limit.Hard)))
+		}
+	}
+	return strings.Join(limits, " ")
+}
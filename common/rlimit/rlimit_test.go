@@ -0,0 +1,96 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rlimit
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in    string
+		name  string
+		limit Limit
+		werr  bool
+	}{
+		{"nofile=65536", "nofile", Limit{65536, 65536}, false},
+		{"nofile=1024:65536", "nofile", Limit{1024, 65536}, false},
+		{"core=0:unlimited", "core", Limit{0, Infinity}, false},
+		{"nofile=65536:1024", "", Limit{}, true},
+		{"nofile", "", Limit{}, true},
+		{"nofile=lots", "", Limit{}, true},
+		{"files=1024", "", Limit{}, true},
+	}
+
+	for i, tt := range tests {
+		name, limit, err := Parse(tt.in)
+		if gerr := (err != nil); gerr != tt.werr {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.werr)
+		}
+		if name != tt.name || limit != tt.limit {
+			t.Errorf("#%d: got %s=%v, want %s=%v", i, name, limit, tt.name, tt.limit)
+		}
+	}
+}
+
+func TestSystemdDirectives(t *testing.T) {
+	limits := Limits{
+		"nproc":  {4096, 4096},
+		"nofile": {1024, 65536},
+		"core":   {0, Infinity},
+	}
+	expected := [][2]string{
+		{"LimitCORE", "0:infinity"},
+		{"LimitNOFILE", "1024:65536"},
+		{"LimitNPROC", "4096"},
+	}
+
+	if directives := limits.SystemdDirectives(); !reflect.DeepEqual(directives, expected) {
+		t.Errorf("got %v, want %v", directives, expected)
+	}
+}
+
+func TestIsolator(t *testing.T) {
+	image := Limits{"nofile": {1024, 4096}, "nproc": {512, 512}}
+	limits := image.Merge(Limits{"nofile": {65536, 65536}})
+
+	i, err := limits.Isolator()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the isolator survives a round trip through the manifest
+	b, err := json.Marshal(types.Isolators{*i})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var isolators types.Isolators
+	if err := json.Unmarshal(b, &isolators); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	r, ok := isolators[0].Value().(*Rlimits)
+	if !ok {
+		t.Fatalf("unexpected isolator value %T", isolators[0].Value())
+	}
+
+	expected := Limits{"nofile": {65536, 65536}, "nproc": {512, 512}}
+	if !reflect.DeepEqual(r.Limits(), expected) {
+		t.Errorf("got %v, want %v", r.Limits(), expected)
+	}
+}
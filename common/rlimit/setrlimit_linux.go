@@ -0,0 +1,57 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rlimit
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// rlimits maps the names of the resources to their RLIMIT_* constants, see
+// setrlimit(2)
+var rlimits = map[string]int{
+	"as":         syscall.RLIMIT_AS,
+	"core":       syscall.RLIMIT_CORE,
+	"cpu":        syscall.RLIMIT_CPU,
+	"data":       syscall.RLIMIT_DATA,
+	"fsize":      syscall.RLIMIT_FSIZE,
+	"locks":      10,
+	"memlock":    8,
+	"msgqueue":   12,
+	"nice":       13,
+	"nofile":     syscall.RLIMIT_NOFILE,
+	"nproc":      6,
+	"rss":        5,
+	"rtprio":     14,
+	"rttime":     15,
+	"sigpending": 11,
+	"stack":      syscall.RLIMIT_STACK,
+}
+
+// Apply sets the limits on the current process, so they are inherited by
+// the programs it executes.
+func (l Limits) Apply() error {
+	for _, name := range resourceNames() {
+		limit, ok := l[name]
+		if !ok {
+			continue
+		}
+		rlim := &syscall.Rlimit{Cur: limit.Soft, Max: limit.Hard}
+		if err := syscall.Setrlimit(rlimits[name], rlim); err != nil {
+			return fmt.Errorf("error setting the %s limit: %v", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package seccomp implements the seccomp profiles of the apps, in the
+// format of the docker profiles, and their translation into the systemd
+// directives filtering the system calls of a service.
+package seccomp
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The actions of the rules of a profile.
+const (
+	ActKill  = "SCMP_ACT_KILL"
+	ActTrap  = "SCMP_ACT_TRAP"
+	ActErrno = "SCMP_ACT_ERRNO"
+	ActTrace = "SCMP_ACT_TRACE"
+	ActAllow = "SCMP_ACT_ALLOW"
+)
+
+// architectures maps the seccomp architectures of the profiles to the ones
+// of systemd, see SystemCallArchitectures in systemd.exec(5)
+var architectures = map[string]string{
+	"SCMP_ARCH_X86":     "x86",
+	"SCMP_ARCH_X86_64":  "x86-64",
+	"SCMP_ARCH_X32":     "x32",
+	"SCMP_ARCH_ARM":     "arm",
+	"SCMP_ARCH_AARCH64": "arm64",
+}
+
+// Profile is a seccomp profile, in the format of the docker profiles.
+type Profile struct {
+	DefaultAction string    `json:"defaultAction"`
+	Architectures []string  `json:"architectures,omitempty"`
+	Syscalls      []Syscall `json:"syscalls,omitempty"`
+}
+
+// Syscall is the rule of a profile applying to one system call, or several
+// ones with Names.
+type Syscall struct {
+	Name   string            `json:"name,omitempty"`
+	Names  []string          `json:"names,omitempty"`
+	Action string            `json:"action"`
+	Args   []json.RawMessage `json:"args,omitempty"`
+}
+
+// Filter is the translation of a profile into a systemd system call filter.
+type Filter struct {
+	// Whitelist is whether only the system calls in Syscalls are allowed,
+	// instead of only them being denied.
+	Whitelist bool
+	Syscalls  []string
+	// Errno is whether the denied system calls fail with EPERM instead of
+	// killing the process.
+	Errno         bool
+	Architectures []string
+	// Approximated are the system calls whose rules have conditions on
+	// their arguments, which systemd doesn't support. They are allowed
+	// unconditionally.
+	Approximated []string
+}
+
+// ParseProfile parses and validates a profile.
+func ParseProfile(b []byte) (*Profile, error) {
+	var p Profile
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("invalid seccomp profile: %v", err)
+	}
+	if _, err := p.Filter(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// String returns the profile as compact JSON.
+func (p *Profile) String() string {
+	b, err := json.Marshal(p)
+	if err != nil {
+		panic(err)
+	}
+	return string(b)
+}
+
+func (s *Syscall) names() []string {
+	if s.Name != "" {
+		return append([]string{s.Name}, s.Names...)
+	}
+	return s.Names
+}
+
+// Filter translates the profile into a system call filter. systemd applies
+// a single action to all the filtered system calls, so the profile must
+// either allow its rules by default and deny them with a same action, or the
+// opposite.
+func (p *Profile) Filter() (*Filter, error) {
+	f := &Filter{}
+
+	var denyAction string
+	switch p.DefaultAction {
+	case ActAllow:
+	case ActErrno, ActKill:
+		f.Whitelist = true
+		denyAction = p.DefaultAction
+	case "":
+		return nil, fmt.Errorf("invalid seccomp profile: no default action")
+	default:
+		return nil, fmt.Errorf("invalid seccomp profile: unsupported default action %q", p.DefaultAction)
+	}
+
+	syscalls := make(map[string]struct{})
+	approximated := make(map[string]struct{})
+	for _, s := range p.Syscalls {
+		names := s.names()
+		if len(names) == 0 {
+			return nil, fmt.Errorf("invalid seccomp profile: rule without system call name")
+		}
+
+		switch s.Action {
+		case p.DefaultAction:
+			// redundant rule
+			continue
+		case ActAllow:
+			if len(s.Args) > 0 {
+				for _, name := range names {
+					approximated[name] = struct{}{}
+				}
+			}
+		case ActErrno, ActKill:
+			if f.Whitelist {
+				return nil, fmt.Errorf("invalid seccomp profile: action %q of %s must be %q or %q", s.Action, strings.Join(names, ","), ActAllow, p.DefaultAction)
+			}
+			if denyAction != "" && s.Action != denyAction {
+				return nil, fmt.Errorf("invalid seccomp profile: the denied system calls must all have the same action")
+			}
+			denyAction = s.Action
+			if len(s.Args) > 0 {
+				// not denied at all
+				for _, name := range names {
+					approximated[name] = struct{}{}
+				}
+				continue
+			}
+		default:
+			return nil, fmt.Errorf("invalid seccomp profile: unsupported action %q of %s", s.Action, strings.Join(names, ","))
+		}
+
+		for _, name := range names {
+			syscalls[name] = struct{}{}
+		}
+	}
+	f.Errno = denyAction == ActErrno
+	f.Syscalls = sortedKeys(syscalls)
+	f.Approximated = sortedKeys(approximated)
+
+	for _, arch := range p.Architectures {
+		a, ok := architectures[arch]
+		if !ok {
+			return nil, fmt.Errorf("invalid seccomp profile: unsupported architecture %q", arch)
+		}
+		f.Architectures = append(f.Architectures, a)
+	}
+
+	return f, nil
+}
+
+// SystemdDirectives returns the systemd directives of the service of an app
+// filtering its system calls, as pairs of directive and value. The system
+// calls in extraAllowed are allowed too, whatever the profile.
+func (f *Filter) SystemdDirectives(extraAllowed []string) [][2]string {
+	var directives [][2]string
+
+	if f.Whitelist {
+		syscalls := append(append([]string(nil), f.Syscalls...), extraAllowed...)
+		directives = append(directives, [2]string{"SystemCallFilter", strings.Join(syscalls, " ")})
+	} else {
+		allowed := make(map[string]struct{})
+		for _, s := range extraAllowed {
+			allowed[s] = struct{}{}
+		}
+		var syscalls []string
+		for _, s := range f.Syscalls {
+			if _, ok := allowed[s]; !ok {
+				syscalls = append(syscalls, s)
+			}
+		}
+		if len(syscalls) == 0 {
+			return nil
+		}
+		directives = append(directives, [2]string{"SystemCallFilter", "~" + strings.Join(syscalls, " ")})
+	}
+
+	if f.Errno {
+		directives = append(directives, [2]string{"SystemCallErrorNumber", "EPERM"})
+	}
+	if len(f.Architectures) > 0 {
+		directives = append(directives, [2]string{"SystemCallArchitectures", strings.Join(f.Architectures, " ")})
+	}
+	return directives
+}
+
+// Denied returns the system calls among syscalls which the rules of the
+// profile deny explicitly.
+func (f *Filter) Denied(syscalls []string) []string {
+	if f.Whitelist {
+		return nil
+	}
+	denied := make(map[string]struct{})
+	for _, s := range f.Syscalls {
+		denied[s] = struct{}{}
+	}
+	var res []string
+	for _, s := range syscalls {
+		if _, ok := denied[s]; ok {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
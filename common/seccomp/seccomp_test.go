@@ -0,0 +1,161 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package seccomp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		profile string
+		filter  *Filter
+		werr    bool
+	}{
+		{
+			`{"defaultAction": "SCMP_ACT_ERRNO",
+			  "architectures": ["SCMP_ARCH_X86_64", "SCMP_ARCH_X86"],
+			  "syscalls": [
+				{"name": "read", "action": "SCMP_ACT_ALLOW"},
+				{"names": ["write", "close"], "action": "SCMP_ACT_ALLOW"},
+				{"name": "personality", "action": "SCMP_ACT_ALLOW", "args": [{"index": 0, "value": 0, "op": "SCMP_CMP_EQ"}]},
+				{"name": "reboot", "action": "SCMP_ACT_ERRNO"}
+			  ]}`,
+			&Filter{
+				Whitelist:     true,
+				Syscalls:      []string{"close", "personality", "read", "write"},
+				Errno:         true,
+				Architectures: []string{"x86-64", "x86"},
+				Approximated:  []string{"personality"},
+			},
+			false,
+		},
+		{
+			`{"defaultAction": "SCMP_ACT_ALLOW",
+			  "syscalls": [
+				{"name": "reboot", "action": "SCMP_ACT_KILL"},
+				{"name": "kexec_load", "action": "SCMP_ACT_KILL"},
+				{"name": "clone", "action": "SCMP_ACT_KILL", "args": [{"index": 0, "value": 2080505856, "op": "SCMP_CMP_MASKED_EQ"}]}
+			  ]}`,
+			&Filter{
+				Syscalls:     []string{"kexec_load", "reboot"},
+				Approximated: []string{"clone"},
+			},
+			false,
+		},
+		// different deny actions
+		{
+			`{"defaultAction": "SCMP_ACT_ALLOW",
+			  "syscalls": [
+				{"name": "reboot", "action": "SCMP_ACT_KILL"},
+				{"name": "kexec_load", "action": "SCMP_ACT_ERRNO"}
+			  ]}`,
+			nil,
+			true,
+		},
+		// deny action in a whitelist
+		{
+			`{"defaultAction": "SCMP_ACT_ERRNO",
+			  "syscalls": [{"name": "reboot", "action": "SCMP_ACT_KILL"}]}`,
+			nil,
+			true,
+		},
+		{
+			`{"defaultAction": "SCMP_ACT_TRACE"}`,
+			nil,
+			true,
+		},
+		{
+			`{"defaultAction": "SCMP_ACT_ALLOW", "architectures": ["SCMP_ARCH_PPC"]}`,
+			nil,
+			true,
+		},
+		{
+			`{"syscalls": []}`,
+			nil,
+			true,
+		},
+	}
+
+	for i, tt := range tests {
+		p, err := ParseProfile([]byte(tt.profile))
+		if gerr := (err != nil); gerr != tt.werr {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.werr)
+		}
+		if err != nil {
+			continue
+		}
+		f, err := p.Filter()
+		if err != nil {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(f, tt.filter) {
+			t.Errorf("#%d: got %+v, want %+v", i, f, tt.filter)
+		}
+	}
+}
+
+func TestSystemdDirectives(t *testing.T) {
+	tests := []struct {
+		filter   Filter
+		expected [][2]string
+	}{
+		{
+			Filter{Whitelist: true, Syscalls: []string{"read", "write"}, Errno: true, Architectures: []string{"x86-64"}},
+			[][2]string{
+				{"SystemCallFilter", "read write chroot"},
+				{"SystemCallErrorNumber", "EPERM"},
+				{"SystemCallArchitectures", "x86-64"},
+			},
+		},
+		{
+			Filter{Syscalls: []string{"chroot", "reboot"}},
+			[][2]string{
+				{"SystemCallFilter", "~reboot"},
+			},
+		},
+		{
+			Filter{Syscalls: []string{"chroot"}},
+			nil,
+		},
+	}
+
+	for i, tt := range tests {
+		directives := tt.filter.SystemdDirectives([]string{"chroot"})
+		if !reflect.DeepEqual(directives, tt.expected) {
+			t.Errorf("#%d: got %v, want %v", i, directives, tt.expected)
+		}
+	}
+}
+
+func TestDenied(t *testing.T) {
+	tests := []struct {
+		filter   Filter
+		expected []string
+	}{
+		{Filter{Whitelist: true, Syscalls: []string{"read"}}, nil},
+		{Filter{Syscalls: []string{"reboot"}}, nil},
+		{Filter{Syscalls: []string{"execve", "reboot", "write"}}, []string{"write", "execve"}},
+	}
+
+	for i, tt := range tests {
+		denied := tt.filter.Denied([]string{"chroot", "write", "execve"})
+		if !reflect.DeepEqual(denied, tt.expected) {
+			t.Errorf("#%d: got %v, want %v", i, denied, tt.expected)
+		}
+	}
+}
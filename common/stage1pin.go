@@ -0,0 +1,59 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"fmt"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+)
+
+// imageIDLen is the length, in hex characters, of the image IDs of the
+// store, the first half of the sha512 of the images.
+const imageIDLen = 64
+
+// ValidateStage1Digest returns an error if d cannot pin a stage1 image: it
+// must be a sha512 image ID, full or as long as the image IDs of the store.
+func ValidateStage1Digest(d string) error {
+	h, err := types.NewHash(d)
+	if err != nil {
+		return fmt.Errorf("invalid stage1 digest %q: %v", d, err)
+	}
+	if len(h.Val) < imageIDLen {
+		return fmt.Errorf("invalid stage1 digest %q, must be an image ID of at least %d hex characters", d, imageIDLen)
+	}
+	return nil
+}
+
+// Stage1DigestAllowed returns whether the stage1 image with the given image
+// ID is pinned by one of the digests, or any image if there is none.
+func Stage1DigestAllowed(id types.Hash, digests []string) bool {
+	if len(digests) == 0 {
+		return true
+	}
+	if len(id.Val) < imageIDLen {
+		return false
+	}
+	for _, d := range digests {
+		h, err := types.NewHash(d)
+		if err != nil || len(h.Val) < imageIDLen {
+			continue
+		}
+		if h.Val[:imageIDLen] == id.Val[:imageIDLen] {
+			return true
+		}
+	}
+	return false
+}
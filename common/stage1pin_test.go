@@ -0,0 +1,70 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+)
+
+func TestValidateStage1Digest(t *testing.T) {
+	tests := []struct {
+		digest string
+		werr   bool
+	}{
+		{"sha512-" + strings.Repeat("a", 64), false},
+		{"sha512-" + strings.Repeat("a", 128), false},
+		{"sha512-" + strings.Repeat("a", 12), true},
+		{"sha256-" + strings.Repeat("a", 64), true},
+		{strings.Repeat("a", 64), true},
+		{"", true},
+	}
+
+	for i, tt := range tests {
+		err := ValidateStage1Digest(tt.digest)
+		if gotErr := err != nil; gotErr != tt.werr {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.werr)
+		}
+	}
+}
+
+func TestStage1DigestAllowed(t *testing.T) {
+	full := "sha512-" + strings.Repeat("a", 64) + strings.Repeat("b", 64)
+	id := types.Hash{}
+	if err := id.Set("sha512-" + strings.Repeat("a", 64)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	other := "sha512-" + strings.Repeat("c", 64)
+
+	tests := []struct {
+		digests []string
+		allowed bool
+	}{
+		{nil, true},
+		{[]string{id.String()}, true},
+		{[]string{full}, true},
+		{[]string{other, full}, true},
+		{[]string{other}, false},
+		{[]string{"sha512-" + strings.Repeat("a", 12)}, false},
+	}
+
+	for i, tt := range tests {
+		if allowed := Stage1DigestAllowed(id, tt.digests); allowed != tt.allowed {
+			t.Errorf("#%d: expected allowed %t, got %t", i, tt.allowed, allowed)
+		}
+	}
+}
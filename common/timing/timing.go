@@ -0,0 +1,144 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package timing records how long the phases of the startup of a pod take,
+// like the resolution of its images, the rendering of the tree store, the
+// setup of its network and the exec of stage1, in a report in the pod
+// directory, so slow pod starts can be diagnosed.
+package timing
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ReportFilename is the timing report in the pod directory, one JSON span
+// per line, appended by stage0 and stage1.
+const ReportFilename = "timings.json"
+
+// Names of the spans of the startup of a pod
+const (
+	SpanResolveImages = "resolve-images"
+	SpanRenderStage1  = "render-stage1"
+	SpanRenderApp     = "render-app"
+	SpanSetupImages   = "setup-images"
+	SpanExecStage1    = "exec-stage1"
+	SpanStage1Init    = "stage1-init"
+	SpanNetworkSetup  = "network-setup"
+)
+
+// Span is a phase of the startup of a pod.
+type Span struct {
+	Name     string            `json:"name"`
+	Start    time.Time         `json:"start"`
+	Duration time.Duration     `json:"duration"`
+	Fields   map[string]string `json:"fields,omitempty"`
+}
+
+// Recorder records the spans of a pod. The spans are kept in memory until
+// they are flushed to the report, since some phases happen before the pod
+// directory exists. A nil Recorder records nothing.
+type Recorder struct {
+	mu    sync.Mutex
+	spans []Span
+}
+
+// NewRecorder returns an empty Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Start starts a span and returns the function ending it. The fields
+// describe the span, like the name of the app rendered.
+func (r *Recorder) Start(name string, fields map[string]string) func() {
+	start := time.Now()
+	return func() {
+		r.Add(Span{
+			Name:     name,
+			Start:    start.UTC(),
+			Duration: time.Since(start),
+			Fields:   fields,
+		})
+	}
+}
+
+// Add records a span measured by the caller.
+func (r *Recorder) Add(s Span) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, s)
+}
+
+// Flush appends the spans recorded since the last flush to the report of
+// the pod at podRoot.
+func (r *Recorder) Flush(podRoot string) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.spans) == 0 {
+		return nil
+	}
+
+	f, err := os.OpenFile(filepath.Join(podRoot, ReportFilename), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening the timing report: %v", err)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, s := range r.spans {
+		if err := enc.Encode(s); err != nil {
+			return fmt.Errorf("error writing the timing report: %v", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("error writing the timing report: %v", err)
+	}
+	r.spans = nil
+	return nil
+}
+
+// ReadReport returns the spans of the report of the pod at podRoot, in the
+// order they were recorded, or no spans if the pod has no report.
+func ReadReport(podRoot string) ([]Span, error) {
+	f, err := os.Open(filepath.Join(podRoot, ReportFilename))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var spans []Span
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		var s Span
+		if err := dec.Decode(&s); err != nil {
+			return nil, fmt.Errorf("error reading the timing report: %v", err)
+		}
+		spans = append(spans, s)
+	}
+	return spans, nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package timing
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rkt-timing-test")
+	if err != nil {
+		t.Fatalf("error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	spans, err := ReadReport(dir)
+	if err != nil || spans != nil {
+		t.Fatalf("got spans %v and error %v for a pod without report, want none", spans, err)
+	}
+
+	start := time.Date(2015, 11, 4, 10, 0, 0, 0, time.UTC)
+	want := []Span{
+		{Name: SpanResolveImages, Start: start, Duration: time.Second},
+		{Name: SpanRenderApp, Start: start.Add(time.Second), Duration: 2 * time.Second, Fields: map[string]string{"app": "etcd"}},
+		{Name: SpanNetworkSetup, Start: start.Add(4 * time.Second), Duration: time.Second},
+	}
+
+	// two recorders, like stage0 and stage1, append to the same report
+	stage0 := NewRecorder()
+	stage0.Add(want[0])
+	stage0.Add(want[1])
+	if err := stage0.Flush(dir); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// flushing again does not write the spans twice
+	if err := stage0.Flush(dir); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stage1 := NewRecorder()
+	stage1.Add(want[2])
+	if err := stage1.Flush(dir); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := ReadReport(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestStart(t *testing.T) {
+	r := NewRecorder()
+	end := r.Start(SpanRenderStage1, nil)
+	end()
+	if len(r.spans) != 1 || r.spans[0].Name != SpanRenderStage1 || r.spans[0].Start.IsZero() || r.spans[0].Duration < 0 {
+		t.Errorf("unexpected spans %v", r.spans)
+	}
+
+	// a nil recorder records nothing
+	var nilRecorder *Recorder
+	nilRecorder.Start(SpanRenderStage1, nil)()
+	if err := nilRecorder.Flush("/nonexistent"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package unixsocket implements the isolator declaring the unix sockets
+// shared by the apps of a pod, so that an app can serve another one, e.g. a
+// proxy in front of it, without TCP on localhost.
+package unixsocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+)
+
+// IsolatorName is the name of the isolator declaring the unix sockets an app
+// listens on or connects to. Its value is of the form:
+//
+//	{"sockets": [{"name": "backend", "role": "listen", "kind": "path"}]}
+//
+// The name identifies the socket in the pod, exactly one app of the pod
+// listens on it and any number of apps connect to it. The kind defaults to
+// "path".
+const IsolatorName = "coreos.com/rkt/unix-sockets"
+
+const (
+	// RoleListen is the role of the app serving a socket, which stage1
+	// passes the listening socket to with socket activation
+	RoleListen = "listen"
+	// RoleConnect is the role of the apps connecting to a socket
+	RoleConnect = "connect"
+
+	// KindPath is the kind of the sockets bound to a path, in a directory
+	// shared by the apps
+	KindPath = "path"
+	// KindAbstract is the kind of the sockets bound to an address in the
+	// abstract namespace of the network of the pod
+	KindAbstract = "abstract"
+
+	// AppDir is the directory of the apps containing the path sockets
+	AppDir = "/run/rkt/sockets"
+
+	// EnvPrefix is the prefix of the environment variables giving the
+	// addresses of their sockets to the apps
+	EnvPrefix = "RKT_SOCKET_"
+)
+
+func init() {
+	types.AddIsolatorValueConstructor(IsolatorName, NewUnixSockets)
+}
+
+// Socket is a unix socket of the pod used by an app.
+type Socket struct {
+	Name types.ACName `json:"name"`
+	Role string       `json:"role"`
+	Kind string       `json:"kind,omitempty"`
+}
+
+// UnixSockets is the value of the unix-sockets isolator.
+type UnixSockets struct {
+	val unixSocketsValue
+}
+
+type unixSocketsValue struct {
+	Sockets []Socket `json:"sockets"`
+}
+
+// NewUnixSockets returns an empty value of the unix-sockets isolator.
+func NewUnixSockets() types.IsolatorValue {
+	return &UnixSockets{}
+}
+
+func (u *UnixSockets) UnmarshalJSON(b []byte) error {
+	var v unixSocketsValue
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	for i := range v.Sockets {
+		if v.Sockets[i].Kind == "" {
+			v.Sockets[i].Kind = KindPath
+		}
+	}
+	u.val = v
+	return nil
+}
+
+func (u UnixSockets) AssertValid() error {
+	if len(u.val.Sockets) == 0 {
+		return fmt.Errorf("no socket declared")
+	}
+	seen := make(map[types.ACName]bool)
+	for _, s := range u.val.Sockets {
+		if s.Name.Empty() {
+			return fmt.Errorf("socket without a name")
+		}
+		if seen[s.Name] {
+			return fmt.Errorf("socket %q declared twice", s.Name)
+		}
+		seen[s.Name] = true
+		if s.Role != RoleListen && s.Role != RoleConnect {
+			return fmt.Errorf("invalid role %q of socket %q, must be %q or %q", s.Role, s.Name, RoleListen, RoleConnect)
+		}
+		if s.Kind != KindPath && s.Kind != KindAbstract {
+			return fmt.Errorf("invalid kind %q of socket %q, must be %q or %q", s.Kind, s.Name, KindPath, KindAbstract)
+		}
+	}
+	return nil
+}
+
+// Sockets returns the sockets the app listens on or connects to.
+func (u UnixSockets) Sockets() []Socket {
+	return u.val.Sockets
+}
+
+// PodSocket is a unix socket shared by the apps of a pod.
+type PodSocket struct {
+	Name       types.ACName
+	Kind       string
+	Listener   types.ACName   // the app listening on the socket
+	Connectors []types.ACName // the apps connecting to the socket
+}
+
+// AppAddress returns the address of the socket in the apps, for a pod with
+// the given UUID. Abstract addresses start with "@", which stands for the
+// leading null byte of the address.
+func (s *PodSocket) AppAddress(uuid *types.UUID) string {
+	if s.Kind == KindAbstract {
+		return "@" + path.Join("rkt", uuid.String(), s.Name.String())
+	}
+	return path.Join(AppDir, s.Name.String())
+}
+
+// EnvName returns the name of the environment variable giving the address of
+// the socket to the apps: RKT_SOCKET_ followed by the name of the socket in
+// upper case, with the characters which are not letters or digits replaced
+// with underscores.
+func (s *PodSocket) EnvName() string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, s.Name.String())
+	return EnvPrefix + name
+}
+
+// PodSockets returns the sockets declared by the apps of a pod, given the
+// unix-sockets isolators by app, sorted by name. Every socket must have
+// exactly one listening app and be of the same kind in all the apps.
+func PodSockets(apps map[types.ACName]*UnixSockets) ([]*PodSocket, error) {
+	var appNames []string
+	for app := range apps {
+		appNames = append(appNames, app.String())
+	}
+	sort.Strings(appNames)
+
+	sockets := make(map[types.ACName]*PodSocket)
+	for _, appName := range appNames {
+		app := types.ACName(appName)
+		for _, s := range apps[app].Sockets() {
+			ps, ok := sockets[s.Name]
+			if !ok {
+				ps = &PodSocket{Name: s.Name, Kind: s.Kind}
+				sockets[s.Name] = ps
+			}
+			if ps.Kind != s.Kind {
+				return nil, fmt.Errorf("socket %q is declared with different kinds", s.Name)
+			}
+			if s.Role == RoleListen {
+				if !ps.Listener.Empty() {
+					return nil, fmt.Errorf("socket %q has two listening apps, %q and %q", s.Name, ps.Listener, app)
+				}
+				ps.Listener = app
+			} else {
+				ps.Connectors = append(ps.Connectors, app)
+			}
+		}
+	}
+
+	var names []string
+	for name := range sockets {
+		names = append(names, name.String())
+	}
+	sort.Strings(names)
+	var list []*PodSocket
+	for _, name := range names {
+		ps := sockets[types.ACName(name)]
+		if ps.Listener.Empty() {
+			return nil, fmt.Errorf("socket %q has no listening app", name)
+		}
+		list = append(list, ps)
+	}
+	return list, nil
+}
@@ -0,0 +1,130 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unixsocket
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+)
+
+func parseIsolator(value string) (*UnixSockets, error) {
+	var iso types.Isolator
+	if err := iso.UnmarshalJSON([]byte(`{"name": "` + IsolatorName + `", "value": ` + value + `}`)); err != nil {
+		return nil, err
+	}
+	return iso.Value().(*UnixSockets), nil
+}
+
+func TestUnixSocketsIsolator(t *testing.T) {
+	tests := []struct {
+		value   string
+		sockets []Socket
+		fail    bool
+	}{
+		{
+			`{"sockets": [{"name": "backend", "role": "listen"}, {"name": "metrics", "role": "connect", "kind": "abstract"}]}`,
+			[]Socket{{"backend", RoleListen, KindPath}, {"metrics", RoleConnect, KindAbstract}},
+			false,
+		},
+		{`{"sockets": []}`, nil, true},
+		{`{"sockets": [{"role": "listen"}]}`, nil, true},
+		{`{"sockets": [{"name": "backend", "role": "serve"}]}`, nil, true},
+		{`{"sockets": [{"name": "backend", "role": "listen", "kind": "tcp"}]}`, nil, true},
+		{`{"sockets": [{"name": "backend", "role": "listen"}, {"name": "backend", "role": "connect"}]}`, nil, true},
+	}
+	for i, tt := range tests {
+		u, err := parseIsolator(tt.value)
+		if tt.fail {
+			if err == nil {
+				t.Errorf("#%d: expected an error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(u.Sockets(), tt.sockets) {
+			t.Errorf("#%d: got sockets %v, want %v", i, u.Sockets(), tt.sockets)
+		}
+	}
+}
+
+func TestPodSockets(t *testing.T) {
+	listen := `{"sockets": [{"name": "backend", "role": "listen"}]}`
+	connect := `{"sockets": [{"name": "backend", "role": "connect"}]}`
+	connectAbstract := `{"sockets": [{"name": "backend", "role": "connect", "kind": "abstract"}]}`
+
+	tests := []struct {
+		apps    map[types.ACName]string
+		sockets []*PodSocket
+		fail    bool
+	}{
+		{
+			map[types.ACName]string{"app": listen, "proxy": connect, "debug": connect},
+			[]*PodSocket{{Name: "backend", Kind: KindPath, Listener: "app", Connectors: []types.ACName{"debug", "proxy"}}},
+			false,
+		},
+		// two listeners
+		{map[types.ACName]string{"app": listen, "proxy": listen}, nil, true},
+		// no listener
+		{map[types.ACName]string{"proxy": connect}, nil, true},
+		// different kinds
+		{map[types.ACName]string{"app": listen, "proxy": connectAbstract}, nil, true},
+	}
+	for i, tt := range tests {
+		apps := make(map[types.ACName]*UnixSockets)
+		for app, value := range tt.apps {
+			u, err := parseIsolator(value)
+			if err != nil {
+				t.Fatalf("#%d: unexpected error: %v", i, err)
+			}
+			apps[app] = u
+		}
+		sockets, err := PodSockets(apps)
+		if gotErr := err != nil; gotErr != tt.fail {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.fail)
+			continue
+		}
+		if !reflect.DeepEqual(sockets, tt.sockets) {
+			t.Errorf("#%d: got sockets %v, want %v", i, sockets, tt.sockets)
+		}
+	}
+}
+
+func TestPodSocketAddress(t *testing.T) {
+	uuid, err := types.NewUUID("6733c3a8-ebf4-4b2b-8e5f-ea0a4d8d5f6e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		socket  PodSocket
+		address string
+		env     string
+	}{
+		{PodSocket{Name: "backend", Kind: KindPath}, "/run/rkt/sockets/backend", "RKT_SOCKET_BACKEND"},
+		{PodSocket{Name: "metrics-v2", Kind: KindAbstract}, "@rkt/6733c3a8-ebf4-4b2b-8e5f-ea0a4d8d5f6e/metrics-v2", "RKT_SOCKET_METRICS_V2"},
+	}
+	for i, tt := range tests {
+		if address := tt.socket.AppAddress(uuid); address != tt.address {
+			t.Errorf("#%d: got address %q, want %q", i, address, tt.address)
+		}
+		if env := tt.socket.EnvName(); env != tt.env {
+			t.Errorf("#%d: got environment variable %q, want %q", i, env, tt.env)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package volplugin implements the protocol between rkt and the volume
+// drivers, the commands attaching the network filesystems of the volumes of
+// kind "plugin" to the host when a pod is prepared and detaching them when
+// it is garbage collected.
+//
+// A driver is run with an operation and its arguments:
+//
+//	DRIVER capabilities
+//	DRIVER mount DIR REQUEST
+//	DRIVER unmount DIR
+//
+// where DIR is the directory in the pod directory where the volume is
+// mounted and REQUEST a JSON MountRequest. The driver prints a JSON Result
+// on its standard output.
+package volplugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Kind is the kind of the volumes mounted by a driver.
+const Kind = "plugin"
+
+// The statuses of the results of the drivers
+const (
+	StatusSuccess      = "Success"
+	StatusFailure      = "Failure"
+	StatusNotSupported = "Not supported"
+)
+
+// Capabilities are the optional features of a driver.
+type Capabilities struct {
+	// ReadOnly is whether the driver can mount the volumes read-only,
+	// otherwise only the mounts of the apps are read-only
+	ReadOnly bool `json:"readOnly"`
+}
+
+// MountRequest describes the volume to mount to the driver.
+type MountRequest struct {
+	Name     string            `json:"name"`
+	ReadOnly bool              `json:"readOnly"`
+	Options  map[string]string `json:"options,omitempty"`
+}
+
+// Result is the output of a driver.
+type Result struct {
+	Status string `json:"status"`
+	// Message explains a failure
+	Message string `json:"message,omitempty"`
+	// Capabilities is the result of the capabilities operation
+	Capabilities *Capabilities `json:"capabilities,omitempty"`
+}
+
+// Driver is a configured volume driver.
+type Driver struct {
+	Name string
+	// Command is the absolute path of the driver followed by its
+	// arguments, the operation is appended to them
+	Command []string
+}
+
+// call runs an operation of the driver and returns its result, an error if
+// the operation failed.
+func (d *Driver) call(args ...string) (*Result, error) {
+	cmd := exec.Command(d.Command[0], append(append([]string{}, d.Command[1:]...), args...)...)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = os.Stderr
+	runErr := cmd.Run()
+
+	var res Result
+	if err := json.Unmarshal(out.Bytes(), &res); err != nil {
+		if runErr != nil {
+			return nil, fmt.Errorf("volume driver %q failed to %s: %v", d.Name, args[0], runErr)
+		}
+		return nil, fmt.Errorf("invalid output of volume driver %q: %v", d.Name, err)
+	}
+	switch res.Status {
+	case StatusSuccess, StatusNotSupported:
+		if runErr != nil {
+			return nil, fmt.Errorf("volume driver %q failed to %s: %v", d.Name, args[0], runErr)
+		}
+		return &res, nil
+	case StatusFailure:
+		return nil, fmt.Errorf("volume driver %q failed to %s: %s", d.Name, args[0], res.Message)
+	}
+	return nil, fmt.Errorf("unknown status %q of volume driver %q", res.Status, d.Name)
+}
+
+// Capabilities returns the capabilities of the driver, none if it doesn't
+// support the operation.
+func (d *Driver) Capabilities() (*Capabilities, error) {
+	res, err := d.call("capabilities")
+	if err != nil {
+		return nil, err
+	}
+	if res.Status == StatusNotSupported || res.Capabilities == nil {
+		return &Capabilities{}, nil
+	}
+	return res.Capabilities, nil
+}
+
+// Mount mounts the volume described by req on dir.
+func (d *Driver) Mount(dir string, req MountRequest) error {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	res, err := d.call("mount", dir, string(b))
+	if err != nil {
+		return err
+	}
+	if res.Status == StatusNotSupported {
+		return fmt.Errorf("volume driver %q does not support mount", d.Name)
+	}
+	return nil
+}
+
+// Unmount unmounts the volume mounted on dir.
+func (d *Driver) Unmount(dir string) error {
+	res, err := d.call("unmount", dir)
+	if err != nil {
+		return err
+	}
+	if res.Status == StatusNotSupported {
+		return fmt.Errorf("volume driver %q does not support unmount", d.Name)
+	}
+	return nil
+}
+
+// Volume records, in the directory of the plugin volumes of a pod, a volume
+// mounted by a driver, so it is unmounted by the same driver when the pod is
+// garbage collected.
+type Volume struct {
+	Name   string `json:"name"`
+	Driver string `json:"driver"`
+}
+
+// recordSuffix is the suffix of the records of the volumes, next to the
+// directories they are mounted on. Volume names cannot contain dots.
+const recordSuffix = ".json"
+
+// MountPath returns the directory where the volume called name is mounted
+// in dir, the directory of the plugin volumes of a pod.
+func MountPath(dir, name string) string {
+	return filepath.Join(dir, name)
+}
+
+// WriteVolume records in dir that vol is mounted.
+func WriteVolume(dir string, vol Volume) error {
+	b, err := json.Marshal(vol)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, vol.Name+recordSuffix), b, 0600)
+}
+
+// RemoveVolume removes the record of vol and the directory it was mounted
+// on, once unmounted.
+func RemoveVolume(dir string, vol Volume) error {
+	if err := os.Remove(MountPath(dir, vol.Name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Remove(filepath.Join(dir, vol.Name+recordSuffix))
+}
+
+// ReadVolumes returns the volumes recorded in dir, none if it doesn't
+// exist.
+func ReadVolumes(dir string) ([]Volume, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var vols []Volume
+	for _, fi := range fis {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), recordSuffix) {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dir, fi.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var vol Volume
+		if err := json.Unmarshal(b, &vol); err != nil {
+			return nil, fmt.Errorf("invalid record of volume %q: %v", fi.Name(), err)
+		}
+		vols = append(vols, vol)
+	}
+	return vols, nil
+}
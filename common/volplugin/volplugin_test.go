@@ -0,0 +1,125 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package volplugin
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testDriver logs its arguments in its directory and answers with the
+// output given for each operation, "mount" failing with a message.
+const testDriver = `echo "$@" >> "$0/calls"
+case "$1" in
+capabilities) echo '{"status": "Success", "capabilities": {"readOnly": true}}' ;;
+mount) echo '{"status": "Failure", "message": "no such export"}' ;;
+unmount) echo '{"status": "Success"}' ;;
+*) echo '{"status": "Not supported"}' ;;
+esac`
+
+func TestDriver(t *testing.T) {
+	d, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating tmpdir: %v", err)
+	}
+	defer os.RemoveAll(d)
+
+	drv := &Driver{Name: "nfs", Command: []string{"/bin/sh", "-c", testDriver, d}}
+	caps, err := drv.Capabilities()
+	if err != nil {
+		t.Fatalf("unexpected error getting the capabilities: %v", err)
+	}
+	if !caps.ReadOnly {
+		t.Errorf("expected the readOnly capability")
+	}
+	err = drv.Mount("/pod/plugin-volumes/data", MountRequest{Name: "data", Options: map[string]string{"server": "fs"}})
+	if err == nil || !strings.Contains(err.Error(), "no such export") {
+		t.Errorf("expected the failure of the driver, got %v", err)
+	}
+	if err := drv.Unmount("/pod/plugin-volumes/data"); err != nil {
+		t.Errorf("unexpected error unmounting: %v", err)
+	}
+
+	calls, err := ioutil.ReadFile(filepath.Join(d, "calls"))
+	if err != nil {
+		t.Fatalf("error reading the calls of the driver: %v", err)
+	}
+	expected := "capabilities\n" +
+		`mount /pod/plugin-volumes/data {"name":"data","readOnly":false,"options":{"server":"fs"}}` + "\n" +
+		"unmount /pod/plugin-volumes/data\n"
+	if string(calls) != expected {
+		t.Errorf("expected calls %q, got %q", expected, calls)
+	}
+
+	for _, command := range [][]string{
+		{"/bin/false"},
+		{"/bin/sh", "-c", "echo not json"},
+		{"/bin/sh", "-c", `echo '{"status": "Unknown"}'`},
+	} {
+		drv := &Driver{Name: "broken", Command: command}
+		if err := drv.Unmount("/pod/plugin-volumes/data"); err == nil {
+			t.Errorf("expected an error from driver %v", command)
+		}
+	}
+	drv = &Driver{Name: "minimal", Command: []string{"/bin/sh", "-c", `echo '{"status": "Not supported"}'`}}
+	if caps, err := drv.Capabilities(); err != nil || caps.ReadOnly {
+		t.Errorf("expected no capabilities, got %+v, %v", caps, err)
+	}
+}
+
+func TestVolumeRecords(t *testing.T) {
+	d, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating tmpdir: %v", err)
+	}
+	defer os.RemoveAll(d)
+
+	vols, err := ReadVolumes(filepath.Join(d, "missing"))
+	if err != nil || len(vols) != 0 {
+		t.Errorf("expected no volumes in a missing directory, got %v, %v", vols, err)
+	}
+
+	written := []Volume{{Name: "data", Driver: "nfs"}, {Name: "logs", Driver: "ceph"}}
+	for _, vol := range written {
+		if err := os.Mkdir(MountPath(d, vol.Name), 0700); err != nil {
+			t.Fatalf("error creating the mount directory: %v", err)
+		}
+		if err := WriteVolume(d, vol); err != nil {
+			t.Fatalf("error writing the record of %q: %v", vol.Name, err)
+		}
+	}
+	vols, err = ReadVolumes(d)
+	if err != nil {
+		t.Fatalf("error reading the volumes: %v", err)
+	}
+	if !reflect.DeepEqual(vols, written) {
+		t.Errorf("expected volumes %v, got %v", written, vols)
+	}
+
+	if err := RemoveVolume(d, written[0]); err != nil {
+		t.Fatalf("error removing volume: %v", err)
+	}
+	vols, err = ReadVolumes(d)
+	if err != nil {
+		t.Fatalf("error reading the volumes: %v", err)
+	}
+	if !reflect.DeepEqual(vols, written[1:]) {
+		t.Errorf("expected volumes %v, got %v", written[1:], vols)
+	}
+}
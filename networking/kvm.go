@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"strconv"
 
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/cni/pkg/ip"
 	cnitypes "github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/cni/pkg/types"
@@ -82,13 +83,14 @@ func kvmSetupNetAddressing(network *Networking, n activeNet, ifName string) erro
 // kvmSetup prepare new Networking to be used in kvm environment based on tuntap pair interfaces
 // to allow communication with virtual machine created by lkvm tool
 // right now it only supports default "ptp" network type (other types ends with error)
-func kvmSetup(podRoot string, podID types.UUID, fps []ForwardedPort, netList common.NetList, localConfig string) (*Networking, error) {
+func kvmSetup(podRoot string, podID types.UUID, fps []ForwardedPort, netList common.NetList, pluginArgs *PluginArgs, localConfig string) (*Networking, error) {
 	network := Networking{
 		podEnv: podEnv{
 			podRoot:      podRoot,
 			podID:        podID,
 			netsLoadList: netList,
 			localConfig:  localConfig,
+			pluginArgs:   pluginArgs,
 		},
 	}
 	var e error
@@ -106,6 +108,9 @@ func kvmSetup(podRoot string, podID types.UUID, fps []ForwardedPort, netList com
 			}
 			ifName := link.Attrs().Name
 			n.runtime.IfName = ifName
+			if pluginArgs != nil {
+				n.runtime.Args = pluginArgs.netArgs(n.runtime.Args)
+			}
 
 			err = kvmSetupNetAddressing(&network, n, ifName)
 			if err != nil {
@@ -136,6 +141,16 @@ func kvmSetup(podRoot string, podID types.UUID, fps []ForwardedPort, netList com
 					return nil, err
 				}
 			}
+
+			if err := network.auditLog("add", map[string]string{
+				"network": n.conf.Name,
+				"type":    n.conf.Type,
+				"ip":      n.runtime.IP.String(),
+				"tap":     ifName,
+				"ipMasq":  strconv.FormatBool(n.conf.IPMasq),
+			}); err != nil {
+				return nil, err
+			}
 		default:
 			return nil, fmt.Errorf("network %q have unsupported type: %q", n.conf.Name, n.conf.Type)
 		}
@@ -179,6 +194,12 @@ func (n *Networking) teardownKvmNets() {
 			if err != nil {
 				log.Printf("Error executing network plugin: %q", err)
 			}
+			if err := n.auditLog("del", map[string]string{
+				"network": an.conf.Name,
+				"tap":     an.runtime.IfName,
+			}); err != nil {
+				log.Printf("Error auditing the deletion of %q: %v", an.conf.Name, err)
+			}
 		default:
 			log.Printf("Unsupported network type: %q", an.conf.Type)
 		}
@@ -60,9 +60,9 @@ type NetConf struct {
 
 // Setup creates a new networking namespace and executes network plugins to
 // set up networking. It returns in the new pod namespace
-func Setup(podRoot string, podID types.UUID, fps []ForwardedPort, netList common.NetList, localConfig, flavor string) (*Networking, error) {
+func Setup(podRoot string, podID types.UUID, fps []ForwardedPort, netList common.NetList, pluginArgs *PluginArgs, localConfig, flavor string) (*Networking, error) {
 	if flavor == "kvm" {
-		return kvmSetup(podRoot, podID, fps, netList, localConfig)
+		return kvmSetup(podRoot, podID, fps, netList, pluginArgs, localConfig)
 	}
 
 	// TODO(jonboulle): currently podRoot is _always_ ".", and behaviour in other
@@ -73,6 +73,7 @@ func Setup(podRoot string, podID types.UUID, fps []ForwardedPort, netList common
 			podID:        podID,
 			netsLoadList: netList,
 			localConfig:  localConfig,
+			pluginArgs:   pluginArgs,
 		},
 	}
 
@@ -0,0 +1,102 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package networking
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+
+	"github.com/coreos/rkt/common"
+)
+
+// PluginArgs are the arguments passed to all the network plugins of a pod,
+// set by its annotations.
+type PluginArgs struct {
+	// CNI_ARGS of the plugins, in the form KEY=VALUE
+	Args []string
+	// runtime config of the CNI capabilities, passed to the plugins
+	// declaring them in the "capabilities" of their configuration
+	Capabilities map[string]json.RawMessage
+}
+
+// GetPluginArgs returns the arguments of the network plugins set by the
+// annotations of a pod.
+func GetPluginArgs(annotations types.Annotations) (*PluginArgs, error) {
+	pa := &PluginArgs{}
+	if val, ok := annotations.Get(common.CNIArgsAnnotation); ok {
+		for _, kv := range strings.Split(val, ";") {
+			if !strings.Contains(kv, "=") {
+				return nil, fmt.Errorf("invalid CNI argument %q, must be in the form KEY=VALUE", kv)
+			}
+			pa.Args = append(pa.Args, kv)
+		}
+	}
+	if val, ok := annotations.Get(common.CNICapabilitiesAnnotation); ok {
+		if err := json.Unmarshal([]byte(val), &pa.Capabilities); err != nil {
+			return nil, fmt.Errorf("invalid CNI capabilities: %v", err)
+		}
+	}
+	return pa, nil
+}
+
+// netArgs returns the CNI_ARGS of a network, the arguments of the pod
+// followed by the ones given for the network, which plugins parsing them
+// into a map let override the ones of the pod.
+func (pa *PluginArgs) netArgs(args string) string {
+	all := append([]string{}, pa.Args...)
+	if args != "" {
+		all = append(all, args)
+	}
+	return strings.Join(all, ";")
+}
+
+// runtimeConfig returns the configuration of a network with the runtime
+// config of the capabilities it declares, as specified by CNI. It returns
+// the configuration unchanged if it declares none of the capabilities.
+func (pa *PluginArgs) runtimeConfig(confBytes []byte) ([]byte, error) {
+	if len(pa.Capabilities) == 0 {
+		return confBytes, nil
+	}
+
+	var conf map[string]json.RawMessage
+	if err := json.Unmarshal(confBytes, &conf); err != nil {
+		return nil, err
+	}
+	var declared map[string]bool
+	if c, ok := conf["capabilities"]; ok {
+		if err := json.Unmarshal(c, &declared); err != nil {
+			return nil, fmt.Errorf("invalid capabilities: %v", err)
+		}
+	}
+
+	rc := make(map[string]json.RawMessage)
+	for name, val := range pa.Capabilities {
+		if declared[name] {
+			rc[name] = val
+		}
+	}
+	if len(rc) == 0 {
+		return confBytes, nil
+	}
+	b, err := json.Marshal(rc)
+	if err != nil {
+		return nil, err
+	}
+	conf["runtimeConfig"] = b
+	return json.Marshal(conf)
+}
@@ -0,0 +1,108 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package networking
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+
+	"github.com/coreos/rkt/common"
+)
+
+func TestGetPluginArgs(t *testing.T) {
+	tests := []struct {
+		args     string
+		caps     string
+		netArgs  string
+		expected string
+		werr     bool
+	}{
+		{"", "", "", "", false},
+		{"", "", "IP=10.1.2.3", "IP=10.1.2.3", false},
+		{"K8S_POD_NAME=web;K8S_POD_NAMESPACE=prod", "", "", "K8S_POD_NAME=web;K8S_POD_NAMESPACE=prod", false},
+		{"K8S_POD_NAME=web", "", "IP=10.1.2.3", "K8S_POD_NAME=web;IP=10.1.2.3", false},
+		{"K8S_POD_NAME", "", "", "", true},
+		{"", `{"bandwidth": `, "", "", true},
+	}
+
+	for i, tt := range tests {
+		var annotations types.Annotations
+		if tt.args != "" {
+			annotations.Set(common.CNIArgsAnnotation, tt.args)
+		}
+		if tt.caps != "" {
+			annotations.Set(common.CNICapabilitiesAnnotation, tt.caps)
+		}
+		pa, err := GetPluginArgs(annotations)
+		if gerr := (err != nil); gerr != tt.werr {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.werr)
+		}
+		if err != nil {
+			continue
+		}
+		if args := pa.netArgs(tt.netArgs); args != tt.expected {
+			t.Errorf("#%d: got CNI_ARGS %q, want %q", i, args, tt.expected)
+		}
+	}
+}
+
+func TestRuntimeConfig(t *testing.T) {
+	var annotations types.Annotations
+	annotations.Set(common.CNICapabilitiesAnnotation, `{"bandwidth": {"ingressRate": 1000}, "portMappings": [{"hostPort": 8080, "containerPort": 80}]}`)
+	pa, err := GetPluginArgs(annotations)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		conf     string
+		expected map[string]interface{}
+	}{
+		// no capabilities declared, the configuration is unchanged
+		{
+			`{"name": "default", "type": "ptp"}`,
+			map[string]interface{}{"name": "default", "type": "ptp"},
+		},
+		// only the declared capabilities are passed
+		{
+			`{"name": "bw", "type": "bandwidth", "capabilities": {"bandwidth": true, "portMappings": false}}`,
+			map[string]interface{}{
+				"name":          "bw",
+				"type":          "bandwidth",
+				"capabilities":  map[string]interface{}{"bandwidth": true, "portMappings": false},
+				"runtimeConfig": map[string]interface{}{"bandwidth": map[string]interface{}{"ingressRate": float64(1000)}},
+			},
+		},
+	}
+
+	for i, tt := range tests {
+		b, err := pa.runtimeConfig([]byte(tt.conf))
+		if err != nil {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+			continue
+		}
+		var conf map[string]interface{}
+		if err := json.Unmarshal(b, &conf); err != nil {
+			t.Errorf("#%d: invalid configuration %s: %v", i, b, err)
+			continue
+		}
+		if !reflect.DeepEqual(conf, tt.expected) {
+			t.Errorf("#%d: got %v, want %v", i, conf, tt.expected)
+		}
+	}
+}
@@ -26,9 +26,11 @@ import (
 	"sort"
 	"strings"
 
+	cnitypes "github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/cni/pkg/types"
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
 
 	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/common/audit"
 	"github.com/coreos/rkt/networking/netinfo"
 )
 
@@ -49,6 +51,7 @@ type podEnv struct {
 	podID        types.UUID
 	netsLoadList common.NetList
 	localConfig  string
+	pluginArgs   *PluginArgs
 }
 
 type activeNet struct {
@@ -69,12 +72,7 @@ func (e *podEnv) loadNets() ([]activeNet, error) {
 	}
 
 	if !netExists(nets, "default") && !netExists(nets, "default-restricted") {
-		var defaultNet string
-		if e.netsLoadList.Specific("default") || e.netsLoadList.All() {
-			defaultNet = DefaultNetPath
-		} else {
-			defaultNet = DefaultRestrictedNetPath
-		}
+		_, defaultNet := defaultNet(e.netsLoadList)
 		defPath := path.Join(common.Stage1RootfsPath(e.podRoot), defaultNet)
 		n, err := loadNet(defPath)
 		if err != nil {
@@ -91,6 +89,65 @@ func (e *podEnv) loadNets() ([]activeNet, error) {
 	return nets, nil
 }
 
+// defaultNet returns the name of the default network joined by a pod
+// started with netsLoadList, when it is not overridden by the user, and the
+// path of its configuration relative to the stage1 rootfs.
+func defaultNet(netsLoadList common.NetList) (string, string) {
+	if netsLoadList.Specific("default") || netsLoadList.All() {
+		return "default", DefaultNetPath
+	}
+	return "default-restricted", DefaultRestrictedNetPath
+}
+
+// PlannedNet is a network a pod would join.
+type PlannedNet struct {
+	Name string
+	// Type is the type of the network, empty for the default networks
+	// of stage1, whose configuration is only read when the pod starts
+	Type string
+	// ConfPath is the path of the configuration of the network, relative
+	// to the stage1 rootfs for the default networks of stage1
+	ConfPath string
+	Args     string
+}
+
+// PlanNets returns the networks a pod started with netsLoadList would join,
+// loaded like by Setup but without setting them up.
+func PlanNets(localConfig string, netsLoadList common.NetList) ([]PlannedNet, error) {
+	if netsLoadList.Host() {
+		return nil, nil
+	}
+	nets, err := loadUserNets(localConfig, netsLoadList)
+	if err != nil {
+		return nil, err
+	}
+
+	var planned []PlannedNet
+	for _, n := range nets {
+		planned = append(planned, PlannedNet{
+			Name:     n.conf.Name,
+			Type:     n.conf.Type,
+			ConfPath: n.runtime.ConfPath,
+			Args:     n.runtime.Args,
+		})
+	}
+	if netsLoadList.None() {
+		return planned, nil
+	}
+
+	if !netExists(nets, "default") && !netExists(nets, "default-restricted") {
+		name, confPath := defaultNet(netsLoadList)
+		planned = append(planned, PlannedNet{Name: name, ConfPath: confPath})
+		nets = append(nets, activeNet{conf: &NetConf{NetConf: cnitypes.NetConf{Name: name}}})
+	}
+
+	missing := missingNets(netsLoadList, nets)
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("networks not found: %v", strings.Join(missing, ", "))
+	}
+	return planned, nil
+}
+
 func (e *podEnv) podNSPath() string {
 	return filepath.Join(e.podRoot, "netns")
 }
@@ -122,15 +179,44 @@ func (e *podEnv) setupNets(nets []activeNet) error {
 		if n.runtime.ConfPath, err = copyFileToDir(n.runtime.ConfPath, e.netDir()); err != nil {
 			return fmt.Errorf("error copying %q to %q: %v", n.runtime.ConfPath, e.netDir(), err)
 		}
+		if err = e.applyPluginArgs(&n); err != nil {
+			return fmt.Errorf("error passing the arguments of the pod to network %q: %v", n.conf.Name, err)
+		}
 
 		n.runtime.IP, n.runtime.HostIP, err = e.netPluginAdd(&n, nspath)
 		if err != nil {
 			return fmt.Errorf("error adding network %q: %v", n.conf.Name, err)
 		}
+		if err = e.auditLog("add", map[string]string{
+			"network": n.conf.Name,
+			"type":    n.conf.Type,
+			"ip":      n.runtime.IP.String(),
+		}); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// applyPluginArgs adds the arguments of the pod to the CNI_ARGS and to the
+// copy of the configuration of a network, which are saved in the pod so the
+// plugin gets them again when the network is torn down.
+func (e *podEnv) applyPluginArgs(n *activeNet) error {
+	if e.pluginArgs == nil {
+		return nil
+	}
+	n.runtime.Args = e.pluginArgs.netArgs(n.runtime.Args)
+	confBytes, err := e.pluginArgs.runtimeConfig(n.confBytes)
+	if err != nil {
+		return err
+	}
+	if string(confBytes) == string(n.confBytes) {
+		return nil
+	}
+	n.confBytes = confBytes
+	return ioutil.WriteFile(n.runtime.ConfPath, confBytes, 0644)
+}
+
 func (e *podEnv) teardownNets(nets []activeNet) {
 	nspath := e.podNSPath()
 
@@ -141,6 +227,12 @@ func (e *podEnv) teardownNets(nets []activeNet) {
 		if err != nil {
 			log.Printf("Error deleting %q: %v", nets[i].conf.Name, err)
 		}
+		if err := e.auditLog("del", map[string]string{
+			"network": nets[i].conf.Name,
+			"type":    nets[i].conf.Type,
+		}); err != nil {
+			log.Printf("Error auditing the deletion of %q: %v", nets[i].conf.Name, err)
+		}
 
 		// Delete the conf file to signal that the network was
 		// torn down (or at least attempted to)
@@ -150,6 +242,12 @@ func (e *podEnv) teardownNets(nets []activeNet) {
 	}
 }
 
+// auditLog records a network operation performed for the pod in its audit
+// log.
+func (e *podEnv) auditLog(action string, fields map[string]string) error {
+	return audit.NewLogger(e.podRoot, e.podID).Log(audit.KindNetwork, action, fields)
+}
+
 func listFiles(dir string) ([]string, error) {
 	dirents, err := ioutil.ReadDir(dir)
 	switch {
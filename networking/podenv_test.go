@@ -0,0 +1,88 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package networking
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/rkt/common"
+)
+
+func TestPlanNets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rkt-networking-test-")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	netDir := filepath.Join(dir, UserNetPathSuffix)
+	if err := os.MkdirAll(netDir, 0755); err != nil {
+		t.Fatalf("error creating %q: %v", netDir, err)
+	}
+	backend := filepath.Join(netDir, "10-backend.conf")
+	if err := ioutil.WriteFile(backend, []byte(`{"name": "backend", "type": "bridge"}`), 0644); err != nil {
+		t.Fatalf("error writing %q: %v", backend, err)
+	}
+
+	tests := []struct {
+		nets string
+		want []PlannedNet
+		err  bool
+	}{
+		{"host", nil, false},
+		{"none", nil, false},
+		{
+			"default",
+			[]PlannedNet{{Name: "default", ConfPath: DefaultNetPath}},
+			false,
+		},
+		{
+			"backend:IP=10.1.2.3",
+			[]PlannedNet{
+				{Name: "backend", Type: "bridge", ConfPath: backend, Args: "IP=10.1.2.3"},
+				{Name: "default-restricted", ConfPath: DefaultRestrictedNetPath},
+			},
+			false,
+		},
+		{
+			"all",
+			[]PlannedNet{
+				{Name: "backend", Type: "bridge", ConfPath: backend},
+				{Name: "default", ConfPath: DefaultNetPath},
+			},
+			false,
+		},
+		{"frontend", nil, true},
+	}
+
+	for i, tt := range tests {
+		var nl common.NetList
+		if err := nl.Set(tt.nets); err != nil {
+			t.Fatalf("#%d: unexpected error: %v", i, err)
+		}
+		got, err := PlanNets(dir, nl)
+		if gotErr := err != nil; gotErr != tt.err {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("#%d: got %+v, want %+v", i, got, tt.want)
+		}
+	}
+}
@@ -62,6 +62,14 @@ func (e *podEnv) forwardPorts(fps []ForwardedPort, defIP net.IP) error {
 		if err = forwardPort(ipt, chain, &p, defIP); err != nil {
 			return err
 		}
+		if err = e.auditLog("forward-port", map[string]string{
+			"chain":       chain,
+			"protocol":    p.Protocol,
+			"hostPort":    strconv.Itoa(int(p.HostPort)),
+			"destination": fmt.Sprintf("%v:%v", defIP, p.PodPort),
+		}); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -100,7 +108,7 @@ func (e *podEnv) unforwardPorts() error {
 	ipt.ClearChain("nat", chain)
 	ipt.DeleteChain("nat", chain)
 
-	return nil
+	return e.auditLog("unforward-ports", map[string]string{"chain": chain})
 }
 
 func (e *podEnv) portFwdChain() string {
@@ -0,0 +1,188 @@
+// Copyright 2014 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aci
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/bzip2"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/aci"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/klauspost/compress/zstd"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/klauspost/pgzip"
+)
+
+// TypeZstd is the type of the zstd compressed ACIs, which are not known by
+// the appc/spec aci package.
+const TypeZstd = aci.FileType("zst")
+
+// hdrZstd is the magic number of the zstd frames.
+var hdrZstd = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// Compression is the compression of the ACIs written by rkt.
+type Compression string
+
+const (
+	CompressionNone Compression = "none"
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+)
+
+// Compressions are the supported compressions of the ACIs written by rkt.
+var Compressions = []Compression{CompressionNone, CompressionGzip, CompressionZstd}
+
+// ParseCompression returns the compression with the given name.
+func ParseCompression(s string) (Compression, error) {
+	for _, c := range Compressions {
+		if string(c) == s {
+			return c, nil
+		}
+	}
+	return "", fmt.Errorf("unknown compression %q", s)
+}
+
+// DetectFileType detects the type of the given file like the
+// DetectFileType of the appc/spec aci package, but also detects the zstd
+// compressed files.
+func DetectFileType(r io.Reader) (aci.FileType, error) {
+	var b bytes.Buffer
+	if _, err := io.CopyN(&b, r, int64(len(hdrZstd))); err != nil && err != io.EOF {
+		return aci.TypeUnknown, err
+	}
+	if bytes.HasPrefix(b.Bytes(), hdrZstd) {
+		return TypeZstd, nil
+	}
+	return aci.DetectFileType(io.MultiReader(&b, r))
+}
+
+// NewCompressedReader returns a reader of the uncompressed content of the
+// given ACI, like the NewCompressedReader of the appc/spec aci package, but
+// supporting zstd, and decompressing gzip in parallel.
+// It is the caller's responsibility to call Close on the Reader when done.
+func NewCompressedReader(rs io.ReadSeeker) (io.ReadCloser, error) {
+	if _, err := rs.Seek(0, 0); err != nil {
+		return nil, err
+	}
+	ftype, err := DetectFileType(rs)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := rs.Seek(0, 0); err != nil {
+		return nil, err
+	}
+
+	switch ftype {
+	case aci.TypeGzip:
+		return pgzip.NewReader(rs)
+	case TypeZstd:
+		d, err := zstd.NewReader(rs)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	case aci.TypeBzip2:
+		return ioutil.NopCloser(bzip2.NewReader(rs)), nil
+	case aci.TypeXz:
+		return aci.NewXzReader(rs)
+	case aci.TypeTar:
+		return ioutil.NopCloser(rs), nil
+	case aci.TypeUnknown:
+		return nil, errors.New("error: unknown image filetype")
+	default:
+		return nil, fmt.Errorf("unsupported image filetype %q", ftype)
+	}
+}
+
+// NewCompressedTarReader returns a tar reader of the given ACI, which may be
+// compressed with any of the compressions supported by NewCompressedReader.
+// It is the caller's responsibility to call Close on the TarReadCloser when
+// done.
+func NewCompressedTarReader(rs io.ReadSeeker) (*aci.TarReadCloser, error) {
+	cr, err := NewCompressedReader(rs)
+	if err != nil {
+		return nil, err
+	}
+	return &aci.TarReadCloser{Reader: tar.NewReader(cr), Closer: cr}, nil
+}
+
+// ManifestFromImage extracts the image manifest of the given ACI, which may
+// be compressed with any of the compressions supported by
+// NewCompressedReader.
+func ManifestFromImage(rs io.ReadSeeker) (*schema.ImageManifest, error) {
+	tr, err := NewCompressedTarReader(rs)
+	if err != nil {
+		return nil, err
+	}
+	defer tr.Close()
+
+	return ManifestFromTar(tr.Reader)
+}
+
+// ManifestFromTar extracts the image manifest of the ACI read from the given
+// tar reader.
+func ManifestFromTar(tr *tar.Reader) (*schema.ImageManifest, error) {
+	for {
+		hdr, err := tr.Next()
+		switch err {
+		case io.EOF:
+			return nil, errors.New("missing manifest")
+		case nil:
+			if filepath.Clean(hdr.Name) != aci.ManifestFile {
+				continue
+			}
+			data, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return nil, err
+			}
+			var im schema.ImageManifest
+			if err := im.UnmarshalJSON(data); err != nil {
+				return nil, err
+			}
+			return &im, nil
+		default:
+			return nil, fmt.Errorf("error extracting tarball: %v", err)
+		}
+	}
+}
+
+// nopWriteCloser is a writer which does nothing on Close.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// NewCompressedWriter returns a writer compressing what is written to it
+// with the given compression, in parallel, to w.
+// It is the caller's responsibility to call Close on the Writer when done,
+// which flushes the compressed data to w, but does not close w.
+func NewCompressedWriter(w io.Writer, c Compression) (io.WriteCloser, error) {
+	switch c {
+	case CompressionNone:
+		return nopWriteCloser{w}, nil
+	case CompressionGzip:
+		return pgzip.NewWriter(w), nil
+	case CompressionZstd:
+		return zstd.NewWriter(w)
+	default:
+		return nil, fmt.Errorf("unknown compression %q", c)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2014 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aci
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/aci"
+)
+
+func TestCompression(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rkt-compression")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := NewBasicACI(dir, "example.com/app")
+	if err != nil {
+		t.Fatalf("error creating ACI: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.Seek(0, 0); err != nil {
+		t.Fatalf("error seeking ACI: %v", err)
+	}
+	tarData, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatalf("error reading ACI: %v", err)
+	}
+
+	tests := []struct {
+		compression Compression
+		ftype       aci.FileType
+	}{
+		{CompressionNone, aci.TypeTar},
+		{CompressionGzip, aci.TypeGzip},
+		{CompressionZstd, TypeZstd},
+	}
+
+	for i, tt := range tests {
+		var buf bytes.Buffer
+		w, err := NewCompressedWriter(&buf, tt.compression)
+		if err != nil {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+			continue
+		}
+		if _, err := w.Write(tarData); err != nil {
+			t.Errorf("#%d: unexpected error compressing: %v", i, err)
+			continue
+		}
+		if err := w.Close(); err != nil {
+			t.Errorf("#%d: unexpected error compressing: %v", i, err)
+			continue
+		}
+		compressed := buf.Bytes()
+
+		ftype, err := DetectFileType(bytes.NewReader(compressed))
+		if err != nil {
+			t.Errorf("#%d: unexpected error detecting the file type: %v", i, err)
+			continue
+		}
+		if ftype != tt.ftype {
+			t.Errorf("#%d: expected file type %q, got %q", i, tt.ftype, ftype)
+		}
+
+		r, err := NewCompressedReader(bytes.NewReader(compressed))
+		if err != nil {
+			t.Errorf("#%d: unexpected error decompressing: %v", i, err)
+			continue
+		}
+		var out bytes.Buffer
+		_, err = io.Copy(&out, r)
+		r.Close()
+		if err != nil {
+			t.Errorf("#%d: unexpected error decompressing: %v", i, err)
+			continue
+		}
+		if !bytes.Equal(out.Bytes(), tarData) {
+			t.Errorf("#%d: decompressed ACI differs from the original one", i)
+		}
+
+		im, err := ManifestFromImage(bytes.NewReader(compressed))
+		if err != nil {
+			t.Errorf("#%d: unexpected error reading the manifest: %v", i, err)
+			continue
+		}
+		if im.Name.String() != "example.com/app" {
+			t.Errorf("#%d: expected image name %q, got %q", i, "example.com/app", im.Name)
+		}
+	}
+
+	if _, err := ParseCompression("lz4"); err == nil {
+		t.Errorf("expected an error parsing an unknown compression")
+	}
+}
@@ -28,27 +28,27 @@ import (
 // Given an imageID, start with the matching image available in the store,
 // build its dependency list and render it inside dir
 func RenderACIWithImageID(imageID types.Hash, dir string, ap acirenderer.ACIRegistry, uidRange *uid.UidRange) error {
-	renderedACI, err := acirenderer.GetRenderedACIWithImageID(imageID, ap)
+	imgs, err := acirenderer.CreateDepListFromImageID(imageID, ap)
 	if err != nil {
 		return err
 	}
-	return renderImage(renderedACI, dir, ap, uidRange)
+	return RenderACIFromList(imgs, dir, ap, uidRange)
 }
 
 // Given an image app name and optional labels, get the best matching image
 // available in the store, build its dependency list and render it inside dir
 func RenderACI(name types.ACIdentifier, labels types.Labels, dir string, ap acirenderer.ACIRegistry, uidRange *uid.UidRange) error {
-	renderedACI, err := acirenderer.GetRenderedACI(name, labels, ap)
+	imgs, err := acirenderer.CreateDepListFromNameLabels(name, labels, ap)
 	if err != nil {
 		return err
 	}
-	return renderImage(renderedACI, dir, ap, uidRange)
+	return RenderACIFromList(imgs, dir, ap, uidRange)
 }
 
 // Given an already populated dependency list, it will extract, under the provided
 // directory, the rendered ACI
 func RenderACIFromList(imgs acirenderer.Images, dir string, ap acirenderer.ACIProvider, uidRange *uid.UidRange) error {
-	renderedACI, err := acirenderer.GetRenderedACIFromList(imgs, ap)
+	renderedACI, err := getRenderedACI(imgs, ap)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,294 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aci
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"syscall"
+
+	"github.com/coreos/rkt/pkg/fileutil"
+	ptar "github.com/coreos/rkt/pkg/tar"
+	"github.com/coreos/rkt/pkg/uid"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/pkg/acirenderer"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/pkg/device"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+)
+
+// maxRenderWorkers is the maximum number of images of a dependency chain
+// rendered at the same time.
+const maxRenderWorkers = 4
+
+// TreeFinder finds the trees already rendered for the images, so their
+// files can be copied instead of being extracted again from the ACIs.
+type TreeFinder interface {
+	// FindTree returns the directory of the rendered tree of the image
+	// with the given key, holding its manifest and rootfs directory, and
+	// a function to call once the tree is not used anymore. It returns
+	// false if the image has no rendered tree available.
+	FindTree(key string) (dir string, release func(), ok bool)
+}
+
+// RenderACITree renders the image with the given ID and its dependencies
+// inside dir, without shifting the owners of the files, like
+// RenderACIWithImageID.
+//
+// The images of the dependency chain are rendered by several workers, each
+// image providing distinct files. The files of a dependency with a tree
+// found by trees are copied from this tree, which holds the same files,
+// rather than extracted from its ACI. If the parallel rendering fails, for
+// example because a hard link points to a file of another image not
+// rendered yet, dir is emptied and the images are extracted again one after
+// the other, in order.
+func RenderACITree(imageID types.Hash, dir string, ap acirenderer.ACIRegistry, trees TreeFinder) error {
+	imgs, err := acirenderer.CreateDepListFromImageID(imageID, ap)
+	if err != nil {
+		return err
+	}
+	renderedACI, err := getRenderedACI(imgs, ap)
+	if err != nil {
+		return err
+	}
+	if len(renderedACI) == 1 {
+		return renderImage(renderedACI, dir, ap, uid.NewBlankUidRange())
+	}
+
+	if err := renderParallel(renderedACI, dir, ap, trees); err == nil {
+		return nil
+	}
+	if err := emptyDir(dir); err != nil {
+		return err
+	}
+	return renderImage(renderedACI, dir, ap, uid.NewBlankUidRange())
+}
+
+// renderSource is where the files of an image of the dependency chain are
+// taken from: a rendered tree of the image, or else its ACI.
+type renderSource struct {
+	treeDir string
+	release func()
+	aci     io.ReadCloser
+}
+
+func (rs *renderSource) close() {
+	if rs.release != nil {
+		rs.release()
+	}
+	if rs.aci != nil {
+		rs.aci.Close()
+	}
+}
+
+// renderParallel renders the images of renderedACI at the same time. The
+// sources of the images are all looked up before starting, as ap and trees
+// may not be safe for concurrent use. The tree of the upper image is the one
+// being rendered.
+func renderParallel(renderedACI acirenderer.RenderedACI, dir string, ap acirenderer.ACIProvider, trees TreeFinder) error {
+	sources := make([]*renderSource, len(renderedACI))
+	defer func() {
+		for _, src := range sources {
+			if src != nil {
+				src.close()
+			}
+		}
+	}()
+	for i, ra := range renderedACI {
+		src := &renderSource{}
+		if i > 0 && trees != nil {
+			src.treeDir, src.release, _ = trees.FindTree(ra.Key)
+		}
+		if src.treeDir == "" {
+			rs, err := ap.ReadStream(ra.Key)
+			if err != nil {
+				return err
+			}
+			src.aci = rs
+		}
+		sources[i] = src
+	}
+
+	workers := runtime.NumCPU()
+	if workers > maxRenderWorkers {
+		workers = maxRenderWorkers
+	}
+
+	var (
+		next = make(chan int)
+		errs = make([]error, len(renderedACI))
+		wg   sync.WaitGroup
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				errs[i] = renderFiles(sources[i], dir, renderedACI[i].FileMap)
+			}
+		}()
+	}
+	for i := range renderedACI {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("error rendering image %s: %v", renderedACI[i].Key, err)
+		}
+	}
+	return nil
+}
+
+// renderFiles writes the files of an image of the dependency chain in dir.
+func renderFiles(src *renderSource, dir string, files map[string]struct{}) error {
+	if src.treeDir != "" {
+		return copyFiles(src.treeDir, dir, files)
+	}
+	if err := ptar.ExtractTar(src.aci, dir, false, uid.NewBlankUidRange(), files); err != nil {
+		return fmt.Errorf("error extracting ACI: %v", err)
+	}
+	return nil
+}
+
+// copyFiles copies the files of src listed in files, relative to src, to
+// dest with their owners, permissions, extended attributes and times. The
+// missing parent directories are created, and the existing directories are
+// kept, as other images write in dest at the same time. The holes of sparse
+// files are only kept when their data blocks are shared with a reflink,
+// otherwise they are written as zeros.
+func copyFiles(src, dest string, files map[string]struct{}) error {
+	// the parent directories are sorted before their children
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	dirs := make(map[string][]syscall.Timespec)
+	// the files hard linked together in src are linked again in dest
+	links := make(map[uint64]string)
+	for _, name := range names {
+		srcPath := filepath.Join(src, name)
+		target := filepath.Join(dest, name)
+		info, err := os.Lstat(srcPath)
+		if err != nil {
+			return err
+		}
+		mode := info.Mode()
+		stat := info.Sys().(*syscall.Stat_t)
+
+		if err := os.MkdirAll(filepath.Dir(target), ptar.DEFAULT_DIR_MODE); err != nil {
+			return err
+		}
+		switch {
+		case mode.IsDir():
+			if err := os.Mkdir(target, mode.Perm()); err != nil && !os.IsExist(err) {
+				return err
+			}
+		case mode.IsRegular() && stat.Nlink > 1 && links[stat.Ino] != "":
+			if err := os.Link(links[stat.Ino], target); err != nil {
+				return err
+			}
+			continue
+		case mode.IsRegular():
+			if err := fileutil.CopyRegularFile(srcPath, target); err != nil {
+				return err
+			}
+			if stat.Nlink > 1 {
+				links[stat.Ino] = target
+			}
+		case mode&os.ModeSymlink != 0:
+			if err := fileutil.CopySymlink(srcPath, target); err != nil {
+				return err
+			}
+		case mode&os.ModeDevice != 0:
+			dev := device.Makedev(device.Major(stat.Rdev), device.Minor(stat.Rdev))
+			typ := uint32(syscall.S_IFBLK)
+			if mode&os.ModeCharDevice != 0 {
+				typ = syscall.S_IFCHR
+			}
+			if err := syscall.Mknod(target, uint32(mode.Perm())|typ, int(dev)); err != nil {
+				return err
+			}
+		case mode&os.ModeNamedPipe != 0:
+			if err := syscall.Mkfifo(target, uint32(mode.Perm())); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported mode: %v", mode)
+		}
+
+		if err := os.Lchown(target, int(stat.Uid), int(stat.Gid)); err != nil {
+			return err
+		}
+		ts := []syscall.Timespec{
+			{Sec: int64(stat.Atim.Sec), Nsec: int64(stat.Atim.Nsec)},
+			{Sec: int64(stat.Mtim.Sec), Nsec: int64(stat.Mtim.Nsec)},
+		}
+		if mode&os.ModeSymlink != 0 {
+			if err := fileutil.CopyXattrs(srcPath, target); err != nil {
+				return err
+			}
+			if err := fileutil.LUtimesNano(target, ts); err != nil {
+				return err
+			}
+			continue
+		}
+		// lchown(2) can change the mode of the file, chmod after it
+		if err := os.Chmod(target, mode); err != nil {
+			return err
+		}
+		// and it drops the file capabilities, set them after it
+		if err := fileutil.CopyXattrs(srcPath, target); err != nil {
+			return err
+		}
+		if mode.IsDir() {
+			dirs[target] = ts
+		} else if err := syscall.UtimesNano(target, ts); err != nil {
+			return err
+		}
+	}
+
+	// the times of the directories change when files are written in
+	// them, restore them last
+	for dir, ts := range dirs {
+		if err := syscall.UtimesNano(dir, ts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// emptyDir removes the contents of dir.
+func emptyDir(dir string) error {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		if err := os.RemoveAll(filepath.Join(dir, info.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
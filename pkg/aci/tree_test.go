@@ -0,0 +1,131 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aci
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/coreos/rkt/pkg/fileutil"
+)
+
+func TestCopyFiles(t *testing.T) {
+	src, err := ioutil.TempDir("", "rkt-tree-src")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(src)
+	dest, err := ioutil.TempDir("", "rkt-tree-dest")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dest)
+
+	old := time.Unix(1000000000, 0)
+	mustDo := func(err error) {
+		if err != nil {
+			t.Fatalf("error creating source tree: %v", err)
+		}
+	}
+	mustDo(os.MkdirAll(filepath.Join(src, "rootfs/etc"), 0750))
+	mustDo(os.MkdirAll(filepath.Join(src, "rootfs/skipped"), 0755))
+	mustDo(ioutil.WriteFile(filepath.Join(src, "rootfs/etc/a"), []byte("a"), 0600))
+	mustDo(os.Link(filepath.Join(src, "rootfs/etc/a"), filepath.Join(src, "rootfs/etc/b")))
+	mustDo(os.Symlink("a", filepath.Join(src, "rootfs/etc/c")))
+	mustDo(os.Chtimes(filepath.Join(src, "rootfs/etc/a"), old, old))
+	mustDo(os.Chtimes(filepath.Join(src, "rootfs/etc"), old, old))
+
+	files := map[string]struct{}{
+		"rootfs/etc":   {},
+		"rootfs/etc/a": {},
+		"rootfs/etc/b": {},
+		"rootfs/etc/c": {},
+	}
+	if err := copyFiles(src, dest, files); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		path    string
+		mode    os.FileMode
+		modTime time.Time
+	}{
+		{"rootfs/etc", os.ModeDir | 0750, old},
+		{"rootfs/etc/a", 0600, old},
+		{"rootfs/etc/b", 0600, old},
+		{"rootfs/etc/c", os.ModeSymlink | 0777, time.Time{}},
+	}
+	for i, tt := range tests {
+		info, err := os.Lstat(filepath.Join(dest, tt.path))
+		if err != nil {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+			continue
+		}
+		if info.Mode() != tt.mode {
+			t.Errorf("#%d: expected mode %v for %s, got %v", i, tt.mode, tt.path, info.Mode())
+		}
+		if !tt.modTime.IsZero() && !info.ModTime().Equal(tt.modTime) {
+			t.Errorf("#%d: expected time %v for %s, got %v", i, tt.modTime, tt.path, info.ModTime())
+		}
+	}
+
+	a, errA := os.Stat(filepath.Join(dest, "rootfs/etc/a"))
+	b, errB := os.Stat(filepath.Join(dest, "rootfs/etc/b"))
+	if errA != nil || errB != nil {
+		t.Fatalf("unexpected errors: %v, %v", errA, errB)
+	}
+	if a.Sys().(*syscall.Stat_t).Ino != b.Sys().(*syscall.Stat_t).Ino {
+		t.Errorf("expected rootfs/etc/b to be a hard link to rootfs/etc/a")
+	}
+	if _, err := os.Lstat(filepath.Join(dest, "rootfs/skipped")); !os.IsNotExist(err) {
+		t.Errorf("expected rootfs/skipped not to be copied, got: %v", err)
+	}
+}
+
+func TestCopyFilesXattrs(t *testing.T) {
+	src, err := ioutil.TempDir("", "rkt-tree-src")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(src)
+	dest, err := ioutil.TempDir("", "rkt-tree-dest")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dest)
+
+	const name, value = "user.rkt.test", "value"
+	if err := ioutil.WriteFile(filepath.Join(src, "a"), []byte("a"), 0600); err != nil {
+		t.Fatalf("error creating source file: %v", err)
+	}
+	if err := fileutil.Lsetxattr(filepath.Join(src, "a"), name, []byte(value), 0); err != nil {
+		t.Skipf("extended attributes not supported: %v", err)
+	}
+
+	if err := copyFiles(src, dest, map[string]struct{}{"a": {}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := fileutil.Lgetxattr(filepath.Join(dest, "a"), name)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(got) != value {
+		t.Errorf("expected xattr %s=%q, got %q", name, value, got)
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aci
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/pkg/acirenderer"
+)
+
+// PathWhitelist is the set of the files of an ACI allowed in the rendered
+// image by the pathWhitelist of an image manifest.
+type PathWhitelist struct {
+	// paths are the whitelisted paths, relative to the ACI root
+	paths map[string]struct{}
+	// parents are the parent directories of the whitelisted paths
+	parents map[string]struct{}
+}
+
+// NewPathWhitelist returns the PathWhitelist of the given pathWhitelist of
+// an image manifest, allowing all the files if it is empty.
+func NewPathWhitelist(pwl []string) (*PathWhitelist, error) {
+	w := &PathWhitelist{}
+	if len(pwl) == 0 {
+		return w, nil
+	}
+	w.paths = make(map[string]struct{})
+	w.parents = make(map[string]struct{})
+	for _, p := range pwl {
+		if !filepath.IsAbs(p) {
+			return nil, fmt.Errorf("invalid path %q in the path whitelist, must be absolute", p)
+		}
+		name := filepath.Join("rootfs", p)
+		w.paths[name] = struct{}{}
+		for dir := filepath.Dir(name); dir != "."; dir = filepath.Dir(dir) {
+			w.parents[dir] = struct{}{}
+		}
+	}
+	return w, nil
+}
+
+// Allows returns whether the file with the given name in the ACI, for
+// example "rootfs/etc/hosts", is allowed in the rendered image. The
+// directories are allowed when they are the parents of whitelisted paths.
+// The files outside the rootfs directory are always allowed.
+func (w *PathWhitelist) Allows(name string, dir bool) bool {
+	if w.paths == nil {
+		return true
+	}
+	name = filepath.Clean(name)
+	if name != "rootfs" && filepath.Dir(name) == "." {
+		return true
+	}
+	if _, ok := w.paths[name]; ok {
+		return true
+	}
+	_, ok := w.parents[name]
+	return ok && dir
+}
+
+// getRenderedACI returns the files of the images of imgs to render. The
+// directories not allowed by the path whitelist of their image or of one of
+// the upper images of their branch, which acirenderer keeps, are removed,
+// the other files not allowed being already left out by acirenderer. Every
+// upper image is checked, not only the top one acirenderer applies, so an
+// intermediate image cannot get the files its own whitelist excludes from
+// its dependencies.
+func getRenderedACI(imgs acirenderer.Images, ap acirenderer.ACIProvider) (acirenderer.RenderedACI, error) {
+	renderedACI, err := acirenderer.GetRenderedACIFromList(imgs, ap)
+	if err != nil {
+		return nil, err
+	}
+	whitelists := make([]*PathWhitelist, len(imgs))
+	for i, img := range imgs {
+		if whitelists[i], err = NewPathWhitelist(img.Im.PathWhitelist); err != nil {
+			return nil, fmt.Errorf("image %s: %v", img.Key, err)
+		}
+	}
+	// acirenderer returns the files of the images in the order of imgs
+	for i, ra := range renderedACI {
+		ws := append([]*PathWhitelist{whitelists[i]}, upperWhitelists(imgs, whitelists, i)...)
+		for name := range ra.FileMap {
+			for _, w := range ws {
+				if !w.Allows(name, true) {
+					delete(ra.FileMap, name)
+					break
+				}
+			}
+		}
+	}
+	return renderedACI, nil
+}
+
+// upperWhitelists returns the path whitelists of the upper images of the
+// image at pos in imgs, its parent, the parent of its parent and so on up
+// to the top image. imgs is sorted depth first, as acirenderer expects, so
+// the parent of an image is the closest image before it with a lower level.
+func upperWhitelists(imgs acirenderer.Images, whitelists []*PathWhitelist, pos int) []*PathWhitelist {
+	var ws []*PathWhitelist
+	level := imgs[pos].Level
+	for i := pos - 1; i >= 0; i-- {
+		if imgs[i].Level < level {
+			ws = append(ws, whitelists[i])
+			level = imgs[i].Level
+		}
+	}
+	return ws
+}
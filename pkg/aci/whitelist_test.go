@@ -0,0 +1,198 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aci
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/pkg/acirenderer"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+)
+
+func TestPathWhitelist(t *testing.T) {
+	if _, err := NewPathWhitelist([]string{"/etc/hosts", "bin/sh"}); err == nil {
+		t.Errorf("expected an error with a relative path")
+	}
+
+	w, err := NewPathWhitelist([]string{"/etc/ssl/certs", "/bin/sh"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	all, err := NewPathWhitelist(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tests := []struct {
+		name  string
+		dir   bool
+		allow bool
+	}{
+		{"manifest", false, true},
+		{"rootfs", true, true},
+		{"rootfs/bin/sh", false, true},
+		{"rootfs/bin", true, true},
+		{"rootfs/bin", false, false},
+		{"rootfs/bin/bash", false, false},
+		{"rootfs/etc/ssl/certs", true, true},
+		{"rootfs/etc/ssl/certs/ca.pem", false, false},
+		{"rootfs/etc/ssl/", true, true},
+		{"rootfs/tmp", true, false},
+	}
+	for i, tt := range tests {
+		if allow := w.Allows(tt.name, tt.dir); allow != tt.allow {
+			t.Errorf("#%d: expected %s allowed %t, got %t", i, tt.name, tt.allow, allow)
+		}
+		if !all.Allows(tt.name, tt.dir) {
+			t.Errorf("#%d: expected %s allowed without whitelist", i, tt.name)
+		}
+	}
+}
+
+type testACIProvider map[string][]byte
+
+func (p testACIProvider) ReadStream(key string) (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader(p[key])), nil
+}
+
+func (p testACIProvider) ResolveKey(key string) (string, error) {
+	return key, nil
+}
+
+func (p testACIProvider) HashToKey(h hash.Hash) string {
+	return fmt.Sprintf("sha512-%x", h.Sum(nil))
+}
+
+// add adds an ACI with the given directories and files to the provider
+// and returns its key.
+func (p testACIProvider) add(t *testing.T, dirs, files []string) string {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, d := range dirs {
+		if err := tw.WriteHeader(&tar.Header{Name: d, Mode: 0755, Typeflag: tar.TypeDir}); err != nil {
+			t.Fatalf("error creating test tar: %v", err)
+		}
+	}
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: f, Mode: 0644, Typeflag: tar.TypeReg}); err != nil {
+			t.Fatalf("error creating test tar: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("error creating test tar: %v", err)
+	}
+	key := fmt.Sprintf("sha512-%x", sha512.Sum512(buf.Bytes()))
+	p[key] = buf.Bytes()
+	return key
+}
+
+func TestGetRenderedACI(t *testing.T) {
+	p := testACIProvider{}
+	upperKey := p.add(t, []string{"rootfs", "rootfs/bin", "rootfs/tmp"}, []string{"manifest", "rootfs/bin/app"})
+	depKey := p.add(t, []string{"rootfs", "rootfs/etc", "rootfs/var", "rootfs/var/lib"}, []string{"manifest", "rootfs/etc/hosts", "rootfs/etc/shadow"})
+
+	imgs := acirenderer.Images{
+		{
+			Im:  &schema.ImageManifest{PathWhitelist: []string{"/bin/app", "/etc/hosts"}},
+			Key: upperKey,
+		},
+		{
+			Im:    &schema.ImageManifest{},
+			Key:   depKey,
+			Level: 1,
+		},
+	}
+	renderedACI, err := getRenderedACI(imgs, p)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []map[string]struct{}{
+		{"manifest": {}, "rootfs": {}, "rootfs/bin": {}, "rootfs/bin/app": {}},
+		// acirenderer leaves out the directories of the dependencies
+		// not whitelisted by the upper image, even the parents
+		{"rootfs": {}, "rootfs/etc/hosts": {}},
+	}
+	if len(renderedACI) != len(expected) {
+		t.Fatalf("expected %d images, got %d", len(expected), len(renderedACI))
+	}
+	for i, ra := range renderedACI {
+		if !reflect.DeepEqual(ra.FileMap, expected[i]) {
+			t.Errorf("#%d: expected files %v, got %v", i, expected[i], ra.FileMap)
+		}
+	}
+
+	imgs[0].Im.PathWhitelist = []string{"bin/app"}
+	if _, err := getRenderedACI(imgs, p); err == nil {
+		t.Errorf("expected an error with an invalid path whitelist")
+	}
+}
+
+func TestGetRenderedACIIntermediateWhitelist(t *testing.T) {
+	p := testACIProvider{}
+	upperKey := p.add(t, []string{"rootfs", "rootfs/bin"}, []string{"manifest", "rootfs/bin/app"})
+	midKey := p.add(t, []string{"rootfs", "rootfs/bin"}, []string{"manifest", "rootfs/bin/tool"})
+	baseKey := p.add(t, []string{"rootfs", "rootfs/etc"}, []string{"manifest", "rootfs/etc/hosts", "rootfs/etc/shadow"})
+	otherKey := p.add(t, []string{"rootfs", "rootfs/etc"}, []string{"manifest", "rootfs/etc/passwd"})
+
+	// acirenderer only applies the whitelist of the upper image to the
+	// base image, which the one of the intermediate image restricts more
+	imgs := acirenderer.Images{
+		{
+			Im:  &schema.ImageManifest{PathWhitelist: []string{"/bin/app", "/bin/tool", "/etc/hosts", "/etc/shadow", "/etc/passwd"}},
+			Key: upperKey,
+		},
+		{
+			Im:    &schema.ImageManifest{PathWhitelist: []string{"/bin/tool", "/etc/hosts"}},
+			Key:   midKey,
+			Level: 1,
+		},
+		{
+			Im:    &schema.ImageManifest{},
+			Key:   baseKey,
+			Level: 2,
+		},
+		// a dependency of the upper image, on another branch
+		{
+			Im:    &schema.ImageManifest{},
+			Key:   otherKey,
+			Level: 1,
+		},
+	}
+	renderedACI, err := getRenderedACI(imgs, p)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []map[string]struct{}{
+		{"manifest": {}, "rootfs": {}, "rootfs/bin": {}, "rootfs/bin/app": {}},
+		{"rootfs": {}, "rootfs/bin/tool": {}},
+		{"rootfs": {}, "rootfs/etc/hosts": {}},
+		{"rootfs": {}, "rootfs/etc/passwd": {}},
+	}
+	if len(renderedACI) != len(expected) {
+		t.Fatalf("expected %d images, got %d", len(expected), len(renderedACI))
+	}
+	for i, ra := range renderedACI {
+		if !reflect.DeepEqual(ra.FileMap, expected[i]) {
+			t.Errorf("#%d: expected files %v, got %v", i, expected[i], ra.FileMap)
+		}
+	}
+}
@@ -17,6 +17,8 @@ package fileutil
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
+	"math"
 	"os"
 	"path/filepath"
 	"syscall"
@@ -27,6 +29,8 @@ import (
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/pkg/device"
 )
 
+// CopyRegularFile copies the content of src into dest. The data blocks are
+// shared with a reflink when the file system supports it.
 func CopyRegularFile(src, dest string) (err error) {
 	srcFile, err := os.Open(src)
 	if err != nil {
@@ -43,12 +47,39 @@ func CopyRegularFile(src, dest string) (err error) {
 			err = e
 		}
 	}()
+	if reflink(destFile, srcFile) == nil {
+		return nil
+	}
 	if _, err := io.Copy(destFile, srcFile); err != nil {
 		return err
 	}
 	return nil
 }
 
+// CanReflink returns whether the files of srcDir can be copied to destDir
+// with reflinks, which is the case when both directories are on the same
+// file system and this file system supports reflinks.
+func CanReflink(srcDir, destDir string) bool {
+	src, err := ioutil.TempFile(srcDir, ".reflink-probe-")
+	if err != nil {
+		return false
+	}
+	defer os.Remove(src.Name())
+	defer src.Close()
+	if _, err := src.Write([]byte("probe")); err != nil {
+		return false
+	}
+
+	dest, err := ioutil.TempFile(destDir, ".reflink-probe-")
+	if err != nil {
+		return false
+	}
+	defer os.Remove(dest.Name())
+	defer dest.Close()
+
+	return reflink(dest, src) == nil
+}
+
 func CopySymlink(src, dest string) error {
 	symTarget, err := os.Readlink(src)
 	if err != nil {
@@ -60,7 +91,69 @@ func CopySymlink(src, dest string) error {
 	return nil
 }
 
+// CopyXattrs copies the extended attributes of src to dest, without
+// following symlinks.
+func CopyXattrs(src, dest string) error {
+	names, err := Llistxattr(src)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		value, err := Lgetxattr(src, name)
+		if err != nil {
+			return err
+		}
+		if err := Lsetxattr(dest, name, value, 0); err != nil {
+			return fmt.Errorf("error setting xattr %q on %q: %v", name, dest, err)
+		}
+	}
+	return nil
+}
+
 func CopyTree(src, dest string, uidRange *uid.UidRange) error {
+	return copyTree(src, dest, false, uidRange.ShiftRange)
+}
+
+// CopyTreeOptions are the options of CopyTreeWithOptions.
+type CopyTreeOptions struct {
+	// Overwrite allows dest to exist. Its directories are kept and its
+	// other files are replaced by the files of src.
+	Overwrite bool
+	// UidShift and GidShift are added to the owners of the copied files.
+	UidShift uint32
+	GidShift uint32
+}
+
+// CopyTreeWithOptions copies src to dest as CopyTree, with separate shifts
+// of the user and group owners of the files.
+func CopyTreeWithOptions(src, dest string, opts CopyTreeOptions) error {
+	shift := func(uid, gid uint32) (uint32, uint32, error) {
+		if math.MaxUint32-opts.UidShift < uid || math.MaxUint32-opts.GidShift < gid {
+			return 0, 0, fmt.Errorf("uid %d or gid %d are out of range after shifting", uid, gid)
+		}
+		return uid + opts.UidShift, gid + opts.GidShift, nil
+	}
+	return copyTree(src, dest, opts.Overwrite, shift)
+}
+
+// removeExisting removes target if it exists and cannot be reused for a
+// file of the given mode: only an existing directory is kept for a
+// directory.
+func removeExisting(target string, mode os.FileMode) error {
+	info, err := os.Lstat(target)
+	switch {
+	case os.IsNotExist(err):
+		return nil
+	case err != nil:
+		return err
+	case info.IsDir() && mode.IsDir():
+		return nil
+	default:
+		return os.RemoveAll(target)
+	}
+}
+
+func copyTree(src, dest string, overwrite bool, shift func(uid, gid uint32) (uint32, uint32, error)) error {
 	cleanSrc := filepath.Clean(src)
 
 	dirs := make(map[string][]syscall.Timespec)
@@ -71,10 +164,15 @@ func CopyTree(src, dest string, uidRange *uid.UidRange) error {
 		rootLess := path[len(cleanSrc):]
 		target := filepath.Join(dest, rootLess)
 		mode := info.Mode()
+		if overwrite {
+			if err := removeExisting(target, mode); err != nil {
+				return err
+			}
+		}
 		switch {
 		case mode.IsDir():
 			err := os.Mkdir(target, mode.Perm())
-			if err != nil {
+			if err != nil && !(overwrite && os.IsExist(err)) {
 				return err
 			}
 
@@ -128,7 +226,7 @@ func CopyTree(src, dest string, uidRange *uid.UidRange) error {
 		var srcUid = info.Sys().(*syscall.Stat_t).Uid
 		var srcGid = info.Sys().(*syscall.Stat_t).Gid
 
-		shiftedUid, shiftedGid, err := uidRange.ShiftRange(srcUid, srcGid)
+		shiftedUid, shiftedGid, err := shift(srcUid, srcGid)
 		if err != nil {
 			return err
 		}
@@ -117,3 +117,113 @@ func TestCopyTree(t *testing.T) {
 	}
 	checkTree(t, dst, tr)
 }
+
+func TestCopyRegularFile(t *testing.T) {
+	td, err := ioutil.TempDir("", tstprefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(td)
+
+	src := filepath.Join(td, "src")
+	dst := filepath.Join(td, "dst")
+	content := []byte("some content")
+	if err := ioutil.WriteFile(src, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the content is either reflinked or copied, depending on the file
+	// system of the temporary directory
+	if err := CopyRegularFile(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	result, err := ioutil.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(result) != string(content) {
+		t.Errorf("got %q, want %q", result, content)
+	}
+
+	// modifying the copy must not modify the source
+	if err := ioutil.WriteFile(dst, []byte("other content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err = ioutil.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(result) != string(content) {
+		t.Errorf("source modified: got %q, want %q", result, content)
+	}
+
+	// the probe files must be removed
+	CanReflink(td, td)
+	files, err := ioutil.ReadDir(td)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Errorf("expected 2 files in %q, found %d", td, len(files))
+	}
+}
+
+func TestCopyTreeWithOptionsOverwrite(t *testing.T) {
+	td, err := ioutil.TempDir("", tstprefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(td)
+
+	src := filepath.Join(td, "src")
+	dst := filepath.Join(td, "dst")
+
+	srcTree := []tree{
+		{
+			path: "dir1",
+			dir:  true,
+		},
+		{
+			path: "dir1/foo",
+			dir:  false,
+		},
+	}
+	createTree(t, src, srcTree)
+	if err := ioutil.WriteFile(filepath.Join(src, "dir1/foo"), []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the destination already contains some files, one of them is
+	// replaced and the other is kept
+	dstTree := []tree{
+		{
+			path: "dir1",
+			dir:  true,
+		},
+		{
+			path: "dir1/foo",
+			dir:  false,
+		},
+		{
+			path: "dir1/other",
+			dir:  false,
+		},
+	}
+	createTree(t, dst, dstTree)
+
+	if err := CopyTreeWithOptions(src, dst, CopyTreeOptions{}); err == nil {
+		t.Errorf("expected an error copying into an existing tree without overwrite")
+	}
+
+	if err := CopyTreeWithOptions(src, dst, CopyTreeOptions{Overwrite: true}); err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, dst, dstTree)
+	content, err := ioutil.ReadFile(filepath.Join(dst, "dir1/foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "new" {
+		t.Errorf("got %q, want %q", content, "new")
+	}
+}
@@ -0,0 +1,35 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fileutil
+
+import (
+	"os"
+	"syscall"
+)
+
+// ficlone is the FICLONE ioctl, which makes a file share the data blocks of
+// another one until they are modified, see ioctl_ficlone(2). It is
+// supported by btrfs and by xfs with reflink=1.
+const ficlone = 0x40049409
+
+// reflink makes dest share the content of src. It fails if the file system
+// doesn't support reflinks or if the files are on different file systems.
+func reflink(dest, src *os.File) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, dest.Fd(), ficlone, src.Fd())
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -19,6 +19,7 @@
 package fileutil
 
 import (
+	"bytes"
 	"syscall"
 	"unsafe"
 )
@@ -75,3 +76,34 @@ func Lsetxattr(path string, attr string, data []byte, flags int) error {
 	}
 	return nil
 }
+
+// Llistxattr returns the names of the extended attributes of path, without
+// following symlinks.
+func Llistxattr(path string) ([]string, error) {
+	pathBytes, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+
+	sz, _, errno := syscall.Syscall(syscall.SYS_LLISTXATTR, uintptr(unsafe.Pointer(pathBytes)), 0, 0)
+	if errno != 0 {
+		return nil, errno
+	}
+	if sz == 0 {
+		return nil, nil
+	}
+	dest := make([]byte, sz)
+	sz, _, errno = syscall.Syscall(syscall.SYS_LLISTXATTR, uintptr(unsafe.Pointer(pathBytes)), uintptr(unsafe.Pointer(&dest[0])), uintptr(len(dest)))
+	if errno != 0 {
+		return nil, errno
+	}
+
+	// the names are NUL terminated
+	var names []string
+	for _, name := range bytes.Split(dest[:sz], []byte{0}) {
+		if len(name) > 0 {
+			names = append(names, string(name))
+		}
+	}
+	return names, nil
+}
@@ -37,6 +37,9 @@ type Config struct {
 	LocalPrefixPath  string
 	SystemRootPath   string
 	SystemPrefixPath string
+	// signing keys, the armored private keys signing the pushed images
+	LocalSigningPrefixPath  string
+	SystemSigningPrefixPath string
 }
 
 // A Keystore represents a repository of trusted public keys which can be
@@ -59,6 +62,9 @@ func NewConfig(systemPath, localPath string) *Config {
 		LocalPrefixPath:  filepath.Join(localPath, "trustedkeys", "prefix.d"),
 		SystemRootPath:   filepath.Join(systemPath, "trustedkeys", "root.d"),
 		SystemPrefixPath: filepath.Join(systemPath, "trustedkeys", "prefix.d"),
+
+		LocalSigningPrefixPath:  filepath.Join(localPath, "signingkeys", "prefix.d"),
+		SystemSigningPrefixPath: filepath.Join(systemPath, "signingkeys", "prefix.d"),
 	}
 }
 
@@ -298,6 +304,49 @@ func (ks *Keystore) loadKeyring(prefix string) (openpgp.KeyRing, error) {
 	return keyring, nil
 }
 
+// SigningKeyPath returns the path of the armored private key signing the
+// images named name, or an empty path if there is none. The key is the
+// single file of the signingkeys/prefix.d directory of the longest prefix of
+// name, the local directories taking precedence over the system ones.
+func (ks *Keystore) SigningKeyPath(name string) (string, error) {
+	acidentifier, err := types.NewACIdentifier(name)
+	if err != nil {
+		return "", err
+	}
+	for prefix := acidentifier.String(); prefix != "." && prefix != "/"; prefix = path.Dir(prefix) {
+		for _, dir := range []string{ks.LocalSigningPrefixPath, ks.SystemSigningPrefixPath} {
+			keyPath, err := signingKeyInDir(path.Join(dir, prefix))
+			if err != nil || keyPath != "" {
+				return keyPath, err
+			}
+		}
+	}
+	return "", nil
+}
+
+// signingKeyInDir returns the path of the signing key in dir, or an empty
+// path if dir has no key.
+func signingKeyInDir(dir string) (string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	var keyPath string
+	for _, info := range infos {
+		if !info.Mode().IsRegular() || info.Size() == 0 {
+			continue
+		}
+		if keyPath != "" {
+			return "", fmt.Errorf("several signing keys in %q", dir)
+		}
+		keyPath = path.Join(dir, info.Name())
+	}
+	return keyPath, nil
+}
+
 func fingerprintToFilename(fp [20]byte) string {
 	return fmt.Sprintf("%x", fp)
 }
@@ -101,6 +101,52 @@ func TestStoreTrustedKey(t *testing.T) {
 	}
 }
 
+func TestSigningKeyPath(t *testing.T) {
+	ks, ksPath, err := NewTestKeystore()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	defer os.RemoveAll(ksPath)
+
+	armoredPrivateKey := []byte(keystoretest.KeyMap["example.com"].ArmoredPrivateKey)
+	keys := []string{
+		filepath.Join(ks.SystemSigningPrefixPath, "example.com", "system.asc"),
+		filepath.Join(ks.LocalSigningPrefixPath, "example.com", "foo", "local.asc"),
+		filepath.Join(ks.SystemSigningPrefixPath, "example.com", "foo", "system.asc"),
+		filepath.Join(ks.LocalSigningPrefixPath, "example.org", "a.asc"),
+		filepath.Join(ks.LocalSigningPrefixPath, "example.org", "b.asc"),
+	}
+	for _, k := range keys {
+		if err := os.MkdirAll(filepath.Dir(k), 0755); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if err := ioutil.WriteFile(k, armoredPrivateKey, 0600); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		keyPath string
+		err     bool
+	}{
+		{"example.com/foo/bar", keys[1], false},
+		{"example.com/foo", keys[1], false},
+		{"example.com/baz", keys[0], false},
+		{"example.net/foo", "", false},
+		{"example.org/foo", "", true},
+	}
+	for i, tt := range tests {
+		keyPath, err := ks.SigningKeyPath(tt.name)
+		if (err != nil) != tt.err {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.err)
+		}
+		if keyPath != tt.keyPath {
+			t.Errorf("#%d: got key %q, want %q", i, keyPath, tt.keyPath)
+		}
+	}
+}
+
 func TestCheckSignature(t *testing.T) {
 	trustedPrefixKeys := []string{
 		"example.com/app",
@@ -24,6 +24,11 @@ func InitLabels(options []string) (string, string, error) {
 	return "", "", nil
 }
 
+// Enabled returns whether SELinux is enabled on the host.
+func Enabled() bool {
+	return false
+}
+
 func GenLabels(options string) (string, string, error) {
 	return "", "", nil
 }
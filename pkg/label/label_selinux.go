@@ -32,7 +32,15 @@ func InitLabels(options []string) (string, string, error) {
 	if !selinux.SelinuxEnabled() {
 		return "", "", nil
 	}
-	processLabel, mountLabel := selinux.GetLxcContexts()
+	// A level given in the options does not need a unique one to be
+	// reserved in the MCS storage directory.
+	level := ""
+	for _, opt := range options {
+		if strings.HasPrefix(opt, "level:") {
+			level = strings.TrimPrefix(opt, "level:")
+		}
+	}
+	processLabel, mountLabel := selinux.GetLxcContextsWithLevel(level)
 	if processLabel != "" {
 		pcon := selinux.NewContext(processLabel)
 		mcon := selinux.NewContext(mountLabel)
@@ -61,6 +69,11 @@ func InitLabels(options []string) (string, string, error) {
 	return processLabel, mountLabel, nil
 }
 
+// Enabled returns whether SELinux is enabled on the host.
+func Enabled() bool {
+	return selinux.SelinuxEnabled()
+}
+
 // DEPRECATED: The GenLabels function is only to be used during the transition to the official API.
 func GenLabels(options string) (string, string, error) {
 	return InitLabels(strings.Fields(options))
@@ -26,6 +26,7 @@ var (
 	ErrNotExist   = errors.New("file does not exist")
 	ErrPermission = errors.New("permission denied")
 	ErrNotRegular = errors.New("not a regular file")
+	ErrTimeout    = errors.New("timed out waiting for the lock")
 )
 
 // FileLock represents a lock on a regular file or a directory
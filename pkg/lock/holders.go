@@ -0,0 +1,129 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lock
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const procLocksPath = "/proc/locks"
+
+// Holder is a process holding, or waiting for, a lock on a file.
+type Holder struct {
+	PID       int
+	Exclusive bool
+	Waiting   bool
+}
+
+func (h Holder) String() string {
+	mode := "shared"
+	if h.Exclusive {
+		mode = "exclusive"
+	}
+	if h.Waiting {
+		return fmt.Sprintf("pid %d (%s, waiting)", h.PID, mode)
+	}
+	return fmt.Sprintf("pid %d (%s)", h.PID, mode)
+}
+
+// Holders returns the processes holding, or waiting for, a lock on the
+// regular file or directory at path, as listed by the kernel in /proc/locks.
+// The PID of a lock is the one of the process which took it, even if the
+// lock fd was then passed to another process.
+func Holders(path string) ([]Holder, error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		if err == syscall.ENOENT {
+			return nil, ErrNotExist
+		}
+		return nil, err
+	}
+
+	f, err := os.Open(procLocksPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseProcLocks(f, devMajor(st.Dev), devMinor(st.Dev), st.Ino)
+}
+
+// devMajor and devMinor decode a device number, as encoded by glibc.
+func devMajor(dev uint64) uint64 {
+	return ((dev >> 8) & 0xfff) | ((dev >> 32) &^ 0xfff)
+}
+
+func devMinor(dev uint64) uint64 {
+	return (dev & 0xff) | ((dev >> 12) &^ 0xff)
+}
+
+// parseProcLocks returns the holders of the flocks on the given inode, from
+// the content of /proc/locks, in which the lines are like:
+//
+// 1: FLOCK  ADVISORY  WRITE 1234 00:13:5678 0 EOF
+// 1: -> FLOCK  ADVISORY  READ  1235 00:13:5678 0 EOF
+//
+// the ones with "->" being the processes waiting for the lock.
+func parseProcLocks(r io.Reader, major, minor, ino uint64) ([]Holder, error) {
+	var holders []Holder
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		fields = fields[1:]
+		waiting := fields[0] == "->"
+		if waiting {
+			fields = fields[1:]
+		}
+		if len(fields) < 5 || fields[0] != "FLOCK" {
+			continue
+		}
+
+		id := strings.Split(fields[4], ":")
+		if len(id) != 3 {
+			continue
+		}
+		lmajor, err1 := strconv.ParseUint(id[0], 16, 64)
+		lminor, err2 := strconv.ParseUint(id[1], 16, 64)
+		lino, err3 := strconv.ParseUint(id[2], 10, 64)
+		if err1 != nil || err2 != nil || err3 != nil {
+			continue
+		}
+		if lmajor != major || lminor != minor || lino != ino {
+			continue
+		}
+
+		pid, err := strconv.Atoi(fields[3])
+		if err != nil {
+			continue
+		}
+		holders = append(holders, Holder{
+			PID:       pid,
+			Exclusive: fields[2] == "WRITE",
+			Waiting:   waiting,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", procLocksPath, err)
+	}
+	return holders, nil
+}
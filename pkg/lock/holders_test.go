@@ -0,0 +1,105 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lock
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseProcLocks(t *testing.T) {
+	procLocks := `1: POSIX  ADVISORY  WRITE 900 00:13:5678 0 EOF
+2: FLOCK  ADVISORY  WRITE 1234 00:13:5678 0 EOF
+2: -> FLOCK  ADVISORY  READ  1235 00:13:5678 0 EOF
+3: FLOCK  ADVISORY  READ  1300 fd:01:5678 0 EOF
+4: FLOCK  ADVISORY  READ  1301 00:13:42 0 EOF
+5: FLOCK  ADVISORY  READ  1302 fd:01:42 0 EOF
+6: FLOCK  ADVISORY  READ  1303 fd:01:42 0 EOF
+garbage
+`
+
+	tests := []struct {
+		major, minor, ino uint64
+		holders           []Holder
+	}{
+		{
+			0x00, 0x13, 5678,
+			[]Holder{
+				{PID: 1234, Exclusive: true},
+				{PID: 1235, Waiting: true},
+			},
+		},
+		{
+			0xfd, 0x01, 42,
+			[]Holder{
+				{PID: 1302},
+				{PID: 1303},
+			},
+		},
+		{
+			0xfd, 0x02, 42,
+			nil,
+		},
+	}
+
+	for i, tt := range tests {
+		holders, err := parseProcLocks(strings.NewReader(procLocks), tt.major, tt.minor, tt.ino)
+		if err != nil {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(holders, tt.holders) {
+			t.Errorf("#%d: expected holders %v, got %v", i, tt.holders, holders)
+		}
+	}
+}
+
+func TestHolders(t *testing.T) {
+	if _, err := os.Stat(procLocksPath); err != nil {
+		t.Skipf("%s not available: %v", procLocksPath, err)
+	}
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating tmpdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	holders, err := Holders(dir)
+	if err != nil {
+		t.Fatalf("error getting the lock holders: %v", err)
+	}
+	if len(holders) != 0 {
+		t.Fatalf("expected no holders, got %v", holders)
+	}
+
+	l, err := ExclusiveLock(dir, Dir)
+	if err != nil {
+		t.Fatalf("error taking exclusive lock: %v", err)
+	}
+	defer l.Close()
+
+	holders, err = Holders(dir)
+	if err != nil {
+		t.Fatalf("error getting the lock holders: %v", err)
+	}
+	expected := []Holder{{PID: os.Getpid(), Exclusive: true}}
+	if !reflect.DeepEqual(holders, expected) {
+		t.Fatalf("expected holders %v, got %v", expected, holders)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lock
+
+import (
+	"time"
+)
+
+// lockPollInterval is the interval between the attempts to take a lock with
+// a timeout, flock having no timeout of its own.
+const lockPollInterval = 50 * time.Millisecond
+
+// retryUntil calls try until it does not return ErrLocked, or until the
+// timeout expires, in which case it returns ErrTimeout.
+func retryUntil(timeout time.Duration, try func() error) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := try()
+		if err != ErrLocked {
+			return err
+		}
+		if !time.Now().Before(deadline) {
+			return ErrTimeout
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
+// ExclusiveLockTimeout takes an exclusive lock, like ExclusiveLock, but
+// returns ErrTimeout if it cannot be taken before the timeout expires.
+// A timeout of zero blocks like ExclusiveLock.
+func (l *FileLock) ExclusiveLockTimeout(timeout time.Duration) error {
+	if timeout <= 0 {
+		return l.ExclusiveLock()
+	}
+	return retryUntil(timeout, l.TryExclusiveLock)
+}
+
+// SharedLockTimeout takes a co-operative (shared) lock, like SharedLock, but
+// returns ErrTimeout if it cannot be taken before the timeout expires.
+// A timeout of zero blocks like SharedLock.
+func (l *FileLock) SharedLockTimeout(timeout time.Duration) error {
+	if timeout <= 0 {
+		return l.SharedLock()
+	}
+	return retryUntil(timeout, l.TrySharedLock)
+}
+
+// ExclusiveKeyLockTimeout takes an exclusive lock on a key, like
+// ExclusiveKeyLock, but returns ErrTimeout if it cannot be taken before the
+// timeout expires. A timeout of zero blocks like ExclusiveKeyLock.
+func (l *KeyLock) ExclusiveKeyLockTimeout(timeout time.Duration) error {
+	return l.lockTimeout(keyLockExclusive, timeout)
+}
+
+// ExclusiveKeyLockTimeout takes an exclusive lock on a key, giving up with
+// ErrTimeout after the timeout expires.
+// lockDir is the directory where the lock file will be created.
+func ExclusiveKeyLockTimeout(lockDir string, key string, timeout time.Duration) (*KeyLock, error) {
+	return createAndLockTimeout(lockDir, key, keyLockExclusive, timeout)
+}
+
+// SharedKeyLockTimeout takes a co-operative (shared) lock on a key, like
+// SharedKeyLock, but returns ErrTimeout if it cannot be taken before the
+// timeout expires. A timeout of zero blocks like SharedKeyLock.
+func (l *KeyLock) SharedKeyLockTimeout(timeout time.Duration) error {
+	return l.lockTimeout(keyLockShared, timeout)
+}
+
+// SharedKeyLockTimeout takes a co-operative (shared) lock on a key, giving
+// up with ErrTimeout after the timeout expires.
+// lockDir is the directory where the lock file will be created.
+func SharedKeyLockTimeout(lockDir string, key string, timeout time.Duration) (*KeyLock, error) {
+	return createAndLockTimeout(lockDir, key, keyLockShared, timeout)
+}
+
+func createAndLockTimeout(lockDir string, key string, mode keyLockMode, timeout time.Duration) (*KeyLock, error) {
+	keyLock, err := NewKeyLock(lockDir, key)
+	if err != nil {
+		return nil, err
+	}
+	if err := keyLock.lockTimeout(mode, timeout); err != nil {
+		keyLock.Close()
+		return nil, err
+	}
+	return keyLock, nil
+}
+
+func (l *KeyLock) lockTimeout(mode keyLockMode, timeout time.Duration) error {
+	if timeout <= 0 {
+		return l.lock(mode, defaultLockRetries)
+	}
+	return retryUntil(timeout, func() error {
+		return l.lock(mode|keyLockNonBlocking, defaultLockRetries)
+	})
+}
@@ -0,0 +1,83 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lock
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestExclusiveKeyLockTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating tmpdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	l1, err := SharedKeyLock(dir, "key01")
+	if err != nil {
+		t.Fatalf("error creating key lock: %v", err)
+	}
+
+	if _, err := ExclusiveKeyLockTimeout(dir, "key01", 100*time.Millisecond); err != ErrTimeout {
+		t.Fatalf("expected ErrTimeout, got %v", err)
+	}
+
+	l2, err := SharedKeyLockTimeout(dir, "key01", 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("error taking shared key lock: %v", err)
+	}
+	l2.Close()
+
+	// release the lock while the other one is waiting for it
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		l1.Close()
+	}()
+	l3, err := ExclusiveKeyLockTimeout(dir, "key01", 10*time.Second)
+	if err != nil {
+		t.Fatalf("error taking exclusive key lock: %v", err)
+	}
+	l3.Close()
+}
+
+func TestExclusiveLockTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating tmpdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	l1, err := ExclusiveLock(dir, Dir)
+	if err != nil {
+		t.Fatalf("error taking exclusive lock: %v", err)
+	}
+	defer l1.Close()
+
+	l2, err := NewLock(dir, Dir)
+	if err != nil {
+		t.Fatalf("error creating lock: %v", err)
+	}
+	defer l2.Close()
+
+	if err := l2.ExclusiveLockTimeout(100 * time.Millisecond); err != ErrTimeout {
+		t.Fatalf("expected ErrTimeout, got %v", err)
+	}
+	if err := l2.SharedLockTimeout(100 * time.Millisecond); err != ErrTimeout {
+		t.Fatalf("expected ErrTimeout, got %v", err)
+	}
+}
@@ -360,6 +360,13 @@ func FreeLxcContexts(scon string) {
 }
 
 func GetLxcContexts() (processLabel string, fileLabel string) {
+	return GetLxcContextsWithLevel("")
+}
+
+// GetLxcContextsWithLevel returns the process and file labels of the
+// containers with the given MCS level. If level is empty, a unique level is
+// reserved in the MCS storage directory.
+func GetLxcContextsWithLevel(level string) (processLabel string, fileLabel string) {
 	var (
 		val, key string
 		bufin    *bufio.Reader
@@ -412,7 +419,10 @@ func GetLxcContexts() (processLabel string, fileLabel string) {
 
 exit:
 	//	mcs := IntToMcs(os.Getpid(), 1024)
-	mcs := uniqMcs(1024)
+	mcs := level
+	if mcs == "" {
+		mcs = uniqMcs(1024)
+	}
 	scon := NewContext(processLabel)
 	scon["level"] = mcs
 	processLabel = scon.Get()
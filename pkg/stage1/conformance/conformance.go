@@ -0,0 +1,293 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+//+build linux
+
+// Package conformance is a test harness checking that a stage1 image follows
+// the contract with rkt, described in
+// Documentation/devel/stage1-implementors-guide.md. It runs the entrypoints
+// of the image the way rkt does, on a pod directory laid out like the ones
+// of rkt, so the implementors of custom stage1 images can run it from their
+// own test suites.
+package conformance
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/pborman/uuid"
+	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/pkg/stage1"
+)
+
+// defaultTimeout is how long the run entrypoint has to write the pid file
+// of the pod, and the other entrypoints to exit, by default.
+const defaultTimeout = 30 * time.Second
+
+// Config describes the stage1 image under test and the pod it runs.
+type Config struct {
+	// Manifest is the image manifest of the stage1 image
+	Manifest *schema.ImageManifest
+	// Rootfs is the rendered rootfs of the stage1 image
+	Rootfs string
+	// PodManifest is the pod run by the image, a pod without apps if nil
+	PodManifest *schema.PodManifest
+	// Prepare, if not nil, is called with the pod directory before the
+	// pod is run, for example to render the apps of the pod manifest
+	// in stage1/rootfs/opt/stage2
+	Prepare func(podDir string) error
+	// RunArgs are the arguments of the run entrypoint before the UUID
+	// of the pod, "--net=host" if nil
+	RunArgs []string
+	// EnterApp, if not empty, is the app of the pod entered with
+	// EnterCommand while the pod runs
+	EnterApp     types.ACName
+	EnterCommand []string
+	// Timeout is how long the run entrypoint has to write the pid file,
+	// and the other entrypoints to exit, 30 seconds if zero
+	Timeout time.Duration
+}
+
+// Run checks the stage1 image described by cfg and fails the test if it
+// does not follow the contract with rkt.
+func Run(t *testing.T, cfg Config) {
+	if err := Check(cfg); err != nil {
+		t.Fatalf("stage1 conformance: %v", err)
+	}
+}
+
+// Check checks the stage1 image described by cfg:
+//  - its manifest declares the entrypoints, which are executable files;
+//  - the run entrypoint, executed in the pod directory with the pod locked,
+//    writes the pid or the ppid file of a running process;
+//  - the enter entrypoint, if cfg.EnterApp is set, runs the command, which
+//    must succeed, in the app;
+//  - the gc entrypoint exits successfully once the pod is stopped.
+func Check(cfg Config) error {
+	if cfg.Timeout == 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if err := stage1.Validate(cfg.Manifest, cfg.Rootfs); err != nil {
+		return err
+	}
+
+	podDir, err := ioutil.TempDir("", "stage1-conformance")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(podDir)
+
+	podUUID, err := types.NewUUID(uuid.New())
+	if err != nil {
+		return err
+	}
+	if err := preparePodDir(podDir, cfg); err != nil {
+		return fmt.Errorf("error preparing the pod directory: %v", err)
+	}
+
+	run, err := startPod(podDir, podUUID, cfg)
+	if err != nil {
+		return err
+	}
+	pid, err := waitPodPid(podDir, run, cfg.Timeout)
+	if err == nil && cfg.EnterApp != "" {
+		err = enterPod(podDir, pid, cfg)
+	}
+	stopPod(run, cfg.Timeout)
+	if err != nil {
+		return err
+	}
+
+	return runEntrypoint(podDir, cfg, stage1.GCEntrypoint, []string{podUUID.String()})
+}
+
+// preparePodDir lays out podDir like rkt does before running a pod: the pod
+// manifest, and the manifest and the rootfs of the stage1 image.
+func preparePodDir(podDir string, cfg Config) error {
+	pm := cfg.PodManifest
+	if pm == nil {
+		pm = schema.BlankPodManifest()
+	}
+	pmb, err := json.Marshal(pm)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(common.PodManifestPath(podDir), pmb, 0640); err != nil {
+		return err
+	}
+
+	imb, err := json.Marshal(cfg.Manifest)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(common.Stage1ImagePath(podDir), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(common.Stage1ManifestPath(podDir), imb, 0644); err != nil {
+		return err
+	}
+	rootfs, err := filepath.Abs(cfg.Rootfs)
+	if err != nil {
+		return err
+	}
+	if err := os.Symlink(rootfs, common.Stage1RootfsPath(podDir)); err != nil {
+		return err
+	}
+
+	if cfg.Prepare != nil {
+		return cfg.Prepare(podDir)
+	}
+	return nil
+}
+
+// entrypointCommand returns the command executing the named entrypoint of
+// the stage1 image in podDir.
+func entrypointCommand(podDir string, cfg Config, name string, args ...string) (*exec.Cmd, error) {
+	ep, err := stage1.GetEntrypoint(cfg.Manifest, name)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(filepath.Join(common.Stage1RootfsPath(podDir), ep), args...)
+	cmd.Dir = podDir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd, nil
+}
+
+// startPod starts the run entrypoint with the pod directory locked, the
+// lock being passed in RKT_LOCK_FD.
+func startPod(podDir string, podUUID *types.UUID, cfg Config) (*exec.Cmd, error) {
+	runArgs := cfg.RunArgs
+	if runArgs == nil {
+		runArgs = []string{"--net=host"}
+	}
+	cmd, err := entrypointCommand(podDir, cfg, stage1.RunEntrypoint, append(runArgs, podUUID.String())...)
+	if err != nil {
+		return nil, err
+	}
+
+	lock, err := os.Open(podDir)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Close()
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		return nil, fmt.Errorf("error locking the pod directory: %v", err)
+	}
+	// the first extra file is the fd 3 of the entrypoint
+	cmd.ExtraFiles = []*os.File{lock}
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=3", common.EnvLockFd))
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("error starting the run entrypoint: %v", err)
+	}
+	return cmd, nil
+}
+
+// waitPodPid waits for the run entrypoint to write the pid or the ppid file
+// of the pod, and returns the pid of the process running the pod.
+func waitPodPid(podDir string, run *exec.Cmd, timeout time.Duration) (int, error) {
+	exited := make(chan error, 1)
+	go func() {
+		_, err := run.Process.Wait()
+		exited <- err
+	}()
+
+	deadline := time.After(timeout)
+	for {
+		for _, name := range []string{"pid", "ppid"} {
+			pid, err := readPidFile(filepath.Join(podDir, name))
+			if err != nil {
+				continue
+			}
+			if err := syscall.Kill(pid, 0); err != nil {
+				return 0, fmt.Errorf("the %s file holds %d, which is not a running process: %v", name, pid, err)
+			}
+			return pid, nil
+		}
+		select {
+		case err := <-exited:
+			return 0, fmt.Errorf("the run entrypoint exited without writing the pid or the ppid file of the pod (%v)", err)
+		case <-deadline:
+			return 0, fmt.Errorf("the run entrypoint did not write the pid or the ppid file of the pod within %v", timeout)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+func readPidFile(path string) (int, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(b)))
+}
+
+// enterPod runs the enter command in the app of the pod, and checks that it
+// succeeds.
+func enterPod(podDir string, pid int, cfg Config) error {
+	args := []string{fmt.Sprintf("--pid=%d", pid), fmt.Sprintf("--appname=%s", cfg.EnterApp), "--"}
+	args = append(args, cfg.EnterCommand...)
+	return runEntrypoint(podDir, cfg, stage1.EnterEntrypoint, args)
+}
+
+// stopPod stops the run entrypoint, killing it if it does not exit within
+// the timeout after SIGTERM.
+func stopPod(run *exec.Cmd, timeout time.Duration) {
+	run.Process.Signal(syscall.SIGTERM)
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); time.Sleep(100 * time.Millisecond) {
+		if err := run.Process.Signal(syscall.Signal(0)); err != nil {
+			return
+		}
+	}
+	run.Process.Kill()
+}
+
+// runEntrypoint runs the named entrypoint with the given arguments, and
+// checks that it exits successfully within the timeout.
+func runEntrypoint(podDir string, cfg Config, name string, args []string) error {
+	cmd, err := entrypointCommand(podDir, cfg, name, args...)
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("error starting the %s entrypoint: %v", name, err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("the %s entrypoint failed: %v", name, err)
+		}
+		return nil
+	case <-time.After(cfg.Timeout):
+		cmd.Process.Kill()
+		return fmt.Errorf("the %s entrypoint did not exit within %v", name, cfg.Timeout)
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+//+build linux
+
+package conformance
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/pkg/stage1"
+)
+
+// fakeStage1 writes a stage1 rootfs with shell entrypoints in dir, with the
+// given run entrypoint, and returns its manifest.
+func fakeStage1(t *testing.T, dir, run string) *schema.ImageManifest {
+	scripts := map[string]string{
+		"run": run,
+		// skip the flags until the separator and run the command
+		"enter": "#!/bin/sh\nwhile [ \"$1\" != -- ]; do shift; done\nshift\nexec \"$@\"\n",
+		"gc":    "#!/bin/sh\nexit 0\n",
+	}
+	for name, script := range scripts {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+			t.Fatalf("error writing the %s entrypoint: %v", name, err)
+		}
+	}
+
+	im := schema.BlankImageManifest()
+	im.Name = *types.MustACIdentifier("example.com/stage1-fake")
+	stage1.SetEntrypoints(im, "/run", "/enter", "/gc")
+	return im
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		run string
+		err bool
+	}{
+		// the pid file of a running process
+		{"#!/bin/sh\n[ -n \"$RKT_LOCK_FD\" ] || exit 1\necho $$ > pid\nexec sleep 30\n", false},
+		// no pid file
+		{"#!/bin/sh\nexit 0\n", true},
+		// the pid file of a process which is not running
+		{"#!/bin/sh\necho 999999999 > pid\nexec sleep 30\n", true},
+	}
+
+	for i, tt := range tests {
+		dir, err := ioutil.TempDir("", "stage1-conformance-test")
+		if err != nil {
+			t.Fatalf("error creating tempdir: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		cfg := Config{
+			Manifest:     fakeStage1(t, dir, tt.run),
+			Rootfs:       dir,
+			EnterApp:     "app",
+			EnterCommand: []string{"true"},
+			Timeout:      5 * time.Second,
+		}
+		err = Check(cfg)
+		if (err != nil) != tt.err {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stage1
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+)
+
+// Pod is a pod as prepared by rkt for the stage1 entrypoints: its manifest
+// and the manifests of the images of its apps.
+type Pod struct {
+	Root     string // root directory where the pod is located
+	UUID     types.UUID
+	Manifest *schema.PodManifest
+	Images   map[string]*schema.ImageManifest // image manifests by app name
+}
+
+// LoadPod loads the Pod Manifest (as prepared by stage0) of the pod rooted in
+// root and its associated Image Manifests. The apps without an app section in
+// the pod manifest get the one of their image.
+func LoadPod(root string, uuid *types.UUID) (*Pod, error) {
+	p := &Pod{
+		Root:   root,
+		UUID:   *uuid,
+		Images: make(map[string]*schema.ImageManifest),
+	}
+
+	buf, err := ioutil.ReadFile(common.PodManifestPath(p.Root))
+	if err != nil {
+		return nil, fmt.Errorf("failed reading pod manifest: %v", err)
+	}
+
+	pm := &schema.PodManifest{}
+	if err := json.Unmarshal(buf, pm); err != nil {
+		return nil, fmt.Errorf("failed unmarshalling pod manifest: %v", err)
+	}
+	p.Manifest = pm
+	if err := ResolvePodVolumes(p.Manifest, p.Root); err != nil {
+		return nil, err
+	}
+
+	for i, app := range p.Manifest.Apps {
+		ampath := common.ImageManifestPath(p.Root, app.Name)
+		buf, err := ioutil.ReadFile(ampath)
+		if err != nil {
+			return nil, fmt.Errorf("failed reading app manifest %q: %v", ampath, err)
+		}
+
+		am := &schema.ImageManifest{}
+		if err = json.Unmarshal(buf, am); err != nil {
+			return nil, fmt.Errorf("failed unmarshalling app manifest %q: %v", ampath, err)
+		}
+
+		if _, ok := p.Images[app.Name.String()]; ok {
+			return nil, fmt.Errorf("got multiple definitions for app: %v", app.Name)
+		}
+		if app.App == nil {
+			p.Manifest.Apps[i].App = am.App
+		}
+		p.Images[app.Name.String()] = am
+	}
+
+	return p, nil
+}
+
+// ResolvePodVolumes makes absolute the sources of the host volumes of pm
+// listed in common.PodVolumesAnnotation, which are relative to the root of
+// the pod.
+func ResolvePodVolumes(pm *schema.PodManifest, root string) error {
+	value, ok := pm.Annotations.Get(common.PodVolumesAnnotation)
+	if !ok {
+		return nil
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return fmt.Errorf("cannot get pod's root absolute path: %v", err)
+	}
+	names := make(map[string]bool)
+	for _, name := range strings.Split(value, ",") {
+		names[name] = true
+	}
+	for i, vol := range pm.Volumes {
+		if vol.Kind == "host" && names[vol.Name.String()] {
+			pm.Volumes[i].Source = filepath.Join(absRoot, vol.Source)
+		}
+	}
+	return nil
+}
+
+// WritePid writes the PID of the process that is PID 1 in the container of
+// the pod rooted in root, so rkt can enter the pod.
+func WritePid(root string, pid int) error {
+	return writePidFile(filepath.Join(root, "pid"), pid)
+}
+
+// WritePpid writes the PID of the parent of the process that is PID 1 in the
+// container of the pod rooted in root, so rkt can enter the pod. The parent
+// must have a single child.
+func WritePpid(root string, pid int) error {
+	return writePidFile(filepath.Join(root, "ppid"), pid)
+}
+
+func writePidFile(path string, pid int) error {
+	if err := ioutil.WriteFile(path, []byte(fmt.Sprintf("%d\n", pid)), 0644); err != nil {
+		return fmt.Errorf("cannot write %s file: %v", filepath.Base(path), err)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stage1
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+)
+
+func TestResolvePodVolumes(t *testing.T) {
+	pm := &schema.PodManifest{
+		Volumes: []types.Volume{
+			{Name: "rkt-secret-token", Kind: "host", Source: "/secrets/token"},
+			{Name: "data", Kind: "host", Source: "/secrets/token"},
+			{Name: "cache", Kind: "empty"},
+		},
+	}
+	pm.Annotations.Set(common.PodVolumesAnnotation, "rkt-secret-token,cache")
+
+	if err := ResolvePodVolumes(pm, "/var/lib/rkt/pods/run/uuid"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i, want := range []string{
+		filepath.Join("/var/lib/rkt/pods/run/uuid", "secrets/token"),
+		"/secrets/token",
+		"",
+	} {
+		if got := pm.Volumes[i].Source; got != want {
+			t.Errorf("#%d: got source %q, want %q", i, got, want)
+		}
+	}
+}
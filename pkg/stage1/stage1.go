@@ -0,0 +1,135 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package stage1 implements the contract between rkt and the stage1 images,
+// as described in Documentation/devel/stage1-implementors-guide.md. It is
+// used by rkt and by the bundled stage1, and can be used by third parties
+// to implement their own stage1 images.
+package stage1
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+)
+
+const (
+	// RunEntrypoint is executed by 'rkt run' and 'rkt run-prepared'
+	RunEntrypoint = "coreos.com/rkt/stage1/run"
+	// EnterEntrypoint is executed by 'rkt enter'
+	EnterEntrypoint = "coreos.com/rkt/stage1/enter"
+	// GCEntrypoint is executed by 'rkt gc'
+	GCEntrypoint = "coreos.com/rkt/stage1/gc"
+	// PauseEntrypoint is executed by 'rkt pause' and 'rkt resume'
+	PauseEntrypoint = "coreos.com/rkt/stage1/pause"
+	// MDSTokenEntrypoint is executed by 'rkt metadata-service rotate-token'
+	MDSTokenEntrypoint = "coreos.com/rkt/stage1/mds-token"
+)
+
+var (
+	// Entrypoints are the entrypoints every stage1 image must provide
+	Entrypoints = []string{RunEntrypoint, EnterEntrypoint, GCEntrypoint}
+	// OptionalEntrypoints are the entrypoints a stage1 image may provide,
+	// rkt reports the corresponding commands as unsupported otherwise
+	OptionalEntrypoints = []string{PauseEntrypoint, MDSTokenEntrypoint}
+)
+
+// GetEntrypoint returns the path, relative to the rootfs of the stage1
+// image, of the named entrypoint declared in the manifest of the image.
+func GetEntrypoint(im *schema.ImageManifest, name string) (string, error) {
+	if ep, ok := im.Annotations.Get(name); ok {
+		return ep, nil
+	}
+
+	return "", fmt.Errorf("entrypoint %q not found", name)
+}
+
+// SetEntrypoints declares the entrypoints of a stage1 image in its manifest.
+// The paths are relative to the rootfs of the image.
+func SetEntrypoints(im *schema.ImageManifest, run, enter, gc string) {
+	im.Annotations.Set(types.ACIdentifier(RunEntrypoint), run)
+	im.Annotations.Set(types.ACIdentifier(EnterEntrypoint), enter)
+	im.Annotations.Set(types.ACIdentifier(GCEntrypoint), gc)
+}
+
+// Validate checks that a stage1 image fulfills the contract with rkt: its
+// manifest declares all the entrypoints, and they are executable files in
+// rootfs, the rendered rootfs of the image. The optional entrypoints are only
+// checked when they are declared.
+func Validate(im *schema.ImageManifest, rootfs string) error {
+	for _, name := range append(Entrypoints, OptionalEntrypoints...) {
+		ep, err := GetEntrypoint(im, name)
+		if err != nil {
+			if isOptionalEntrypoint(name) {
+				continue
+			}
+			return fmt.Errorf("invalid stage1 image %q: %v", im.Name, err)
+		}
+		if !filepath.IsAbs(ep) {
+			return fmt.Errorf("invalid stage1 image %q: entrypoint %q must be an absolute path, got %q", im.Name, name, ep)
+		}
+
+		fi, err := statInRootfs(rootfs, ep)
+		if err != nil {
+			return fmt.Errorf("invalid stage1 image %q: entrypoint %q: %v", im.Name, name, err)
+		}
+		if !fi.Mode().IsRegular() || fi.Mode()&0111 == 0 {
+			return fmt.Errorf("invalid stage1 image %q: entrypoint %q (%s) is not an executable file", im.Name, name, ep)
+		}
+	}
+
+	return nil
+}
+
+func isOptionalEntrypoint(name string) bool {
+	for _, n := range OptionalEntrypoints {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// maxSymlinks is the maximum number of symlinks followed by statInRootfs
+const maxSymlinks = 16
+
+// statInRootfs returns the FileInfo of path in rootfs, following the symlinks
+// like if rootfs was the root directory: entrypoints are often symlinks with
+// absolute targets.
+func statInRootfs(rootfs, path string) (os.FileInfo, error) {
+	for i := 0; i < maxSymlinks; i++ {
+		fi, err := os.Lstat(filepath.Join(rootfs, path))
+		if err != nil {
+			return nil, err
+		}
+		if fi.Mode()&os.ModeSymlink == 0 {
+			return fi, nil
+		}
+
+		target, err := os.Readlink(filepath.Join(rootfs, path))
+		if err != nil {
+			return nil, err
+		}
+		if filepath.IsAbs(target) {
+			path = target
+		} else {
+			path = filepath.Join(filepath.Dir(path), target)
+		}
+	}
+
+	return nil, fmt.Errorf("too many levels of symbolic links")
+}
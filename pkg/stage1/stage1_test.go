@@ -0,0 +1,148 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stage1
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+)
+
+func TestValidate(t *testing.T) {
+	rootfs, err := ioutil.TempDir("", "stage1-test")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(rootfs)
+
+	if err := os.MkdirAll(filepath.Join(rootfs, "usr/bin"), 0755); err != nil {
+		t.Fatalf("error creating dir: %v", err)
+	}
+	for _, f := range []struct {
+		path string
+		mode os.FileMode
+	}{
+		{"init", 0755},
+		{"usr/bin/multicall", 0755},
+		{"manifest.txt", 0644},
+	} {
+		if err := ioutil.WriteFile(filepath.Join(rootfs, f.path), nil, f.mode); err != nil {
+			t.Fatalf("error writing file: %v", err)
+		}
+	}
+	// absolute symlinks are resolved in the rootfs
+	if err := os.Symlink("/usr/bin/multicall", filepath.Join(rootfs, "enter")); err != nil {
+		t.Fatalf("error creating symlink: %v", err)
+	}
+	if err := os.Symlink("usr/bin/multicall", filepath.Join(rootfs, "gc")); err != nil {
+		t.Fatalf("error creating symlink: %v", err)
+	}
+	if err := os.Symlink("/bin/sh", filepath.Join(rootfs, "host-sh")); err != nil {
+		t.Fatalf("error creating symlink: %v", err)
+	}
+
+	tests := []struct {
+		run, enter, gc string
+		valid          bool
+	}{
+		{"/init", "/enter", "/gc", true},
+		{"/init", "/enter", "", false},
+		{"/missing", "/enter", "/gc", false},
+		{"/init", "/manifest.txt", "/gc", false},
+		{"/init", "/usr/bin", "/gc", false},
+		{"init", "/enter", "/gc", false},
+		// the symlink target does not exist in the rootfs
+		{"/init", "/host-sh", "/gc", false},
+	}
+
+	for i, tt := range tests {
+		im := &schema.ImageManifest{Name: "example.com/stage1"}
+		SetEntrypoints(im, tt.run, tt.enter, tt.gc)
+		if tt.gc == "" {
+			im.Annotations = im.Annotations[:2]
+		}
+
+		err := Validate(im, rootfs)
+		if tt.valid && err != nil {
+			t.Errorf("#%d: expected valid image, got error: %v", i, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("#%d: expected invalid image", i)
+		}
+	}
+}
+
+func TestLoadPod(t *testing.T) {
+	root, err := ioutil.TempDir("", "stage1-test")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	podManifest := `{"acKind": "PodManifest", "acVersion": "0.7.1", "apps": [
+		{"name": "app-a", "image": {"id": "sha512-aaaa"}},
+		{"name": "app-b", "image": {"id": "sha512-bbbb"}, "app": {"exec": ["/b"], "user": "0", "group": "0"}}
+	]}`
+	imageManifest := `{"acKind": "ImageManifest", "acVersion": "0.7.1", "name": "example.com/%s",
+		"app": {"exec": ["/image"], "user": "0", "group": "0"}}`
+
+	if err := ioutil.WriteFile(filepath.Join(root, "pod"), []byte(podManifest), 0644); err != nil {
+		t.Fatalf("error writing pod manifest: %v", err)
+	}
+	for _, name := range []string{"app-a", "app-b"} {
+		path := common.ImageManifestPath(root, types.ACName(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("error creating dir: %v", err)
+		}
+		manifest := []byte(fmt.Sprintf(imageManifest, name))
+		if err := ioutil.WriteFile(path, manifest, 0644); err != nil {
+			t.Fatalf("error writing image manifest: %v", err)
+		}
+	}
+
+	uuid, err := types.NewUUID("6733c3a4-fa3a-4f2c-9c2f-a5ea7a2b29b2")
+	if err != nil {
+		t.Fatalf("error creating UUID: %v", err)
+	}
+	p, err := LoadPod(root, uuid)
+	if err != nil {
+		t.Fatalf("error loading pod: %v", err)
+	}
+
+	if len(p.Images) != 2 || p.Images["app-a"].Name != "example.com/app-a" {
+		t.Errorf("unexpected image manifests: %v", p.Images)
+	}
+	// the app section of the image is used when the pod manifest has none
+	if exec := p.Manifest.Apps[0].App.Exec; len(exec) != 1 || exec[0] != "/image" {
+		t.Errorf("expected the exec of the image for app-a, got %v", exec)
+	}
+	if exec := p.Manifest.Apps[1].App.Exec; len(exec) != 1 || exec[0] != "/b" {
+		t.Errorf("expected the exec of the pod manifest for app-b, got %v", exec)
+	}
+
+	if err := WritePpid(root, 42); err != nil {
+		t.Fatalf("error writing ppid: %v", err)
+	}
+	ppid, err := ioutil.ReadFile(filepath.Join(root, "ppid"))
+	if err != nil || string(ppid) != "42\n" {
+		t.Errorf("unexpected ppid file: %q, %v", ppid, err)
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright 2014 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tar
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+	"syscall"
+
+	"github.com/coreos/rkt/pkg/fileutil"
+)
+
+const (
+	// maxExtractWorkers bounds the number of workers writing the regular
+	// files while the tarball is read.
+	maxExtractWorkers = 8
+	// maxBufferedFileSize is the size of the largest regular files read
+	// in memory and written by the workers. The bigger files are written
+	// while reading the tarball.
+	maxBufferedFileSize = 1 << 20
+	// sparseBlockSize is the size of the blocks of zeros which are not
+	// written, but left as holes, so the sparse files are restored
+	// sparsely.
+	sparseBlockSize = 4096
+	// sparseCopySize is the size of the chunks read when writing a file.
+	sparseCopySize = 32 * sparseBlockSize
+)
+
+func extractWorkers() int {
+	n := runtime.NumCPU()
+	if n > maxExtractWorkers {
+		n = maxExtractWorkers
+	}
+	return n
+}
+
+// fileJob is a regular file whose contents were read from the tarball, to be
+// written by a worker.
+type fileJob struct {
+	f    *os.File
+	path string
+	hdr  *tar.Header
+	data []byte
+}
+
+// workerPool writes the regular files, and restores their metadata, in
+// parallel with the reading of the tarball.
+type workerPool struct {
+	jobs    chan fileJob
+	wg      sync.WaitGroup
+	editor  FilePermissionsEditor
+	pending map[string]struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+func newWorkerPool(workers int, editor FilePermissionsEditor) *workerPool {
+	wp := &workerPool{
+		jobs:    make(chan fileJob, workers),
+		editor:  editor,
+		pending: make(map[string]struct{}),
+	}
+	for i := 0; i < workers; i++ {
+		go wp.work()
+	}
+	return wp
+}
+
+func (wp *workerPool) work() {
+	for job := range wp.jobs {
+		err := writeSparse(job.f, bytes.NewReader(job.data))
+		if cerr := job.f.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = finishFile(job.path, job.hdr, wp.editor)
+		}
+		if err != nil {
+			wp.mu.Lock()
+			if wp.err == nil {
+				wp.err = err
+			}
+			wp.mu.Unlock()
+		}
+		wp.wg.Done()
+	}
+}
+
+// submit queues the writing of a regular file. The pool takes the ownership
+// of f.
+func (wp *workerPool) submit(job fileJob) {
+	wp.pending[job.path] = struct{}{}
+	wp.wg.Add(1)
+	wp.jobs <- job
+}
+
+// isPending returns whether a file submitted since the last wait has the
+// given path.
+func (wp *workerPool) isPending(path string) bool {
+	_, ok := wp.pending[path]
+	return ok
+}
+
+// wait waits for the submitted files to be written, returning the first
+// error of the workers.
+func (wp *workerPool) wait() error {
+	wp.wg.Wait()
+	wp.pending = make(map[string]struct{})
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+	return wp.err
+}
+
+// close waits for the submitted files to be written and stops the workers.
+func (wp *workerPool) close() error {
+	err := wp.wait()
+	close(wp.jobs)
+	return err
+}
+
+// writeSparse copies r to f, leaving holes instead of writing the blocks of
+// zeros, and sets the size of f to the size of the copied data.
+func writeSparse(f *os.File, r io.Reader) error {
+	buf := make([]byte, sparseCopySize)
+	var off int64
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			if werr := writeNonZeroBlocks(f, buf[:n], off); werr != nil {
+				return werr
+			}
+			off += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return f.Truncate(off)
+}
+
+// writeNonZeroBlocks writes the blocks of buf which are not only zeros at
+// the offset off of f, coalescing the consecutive ones in a single write.
+func writeNonZeroBlocks(f *os.File, buf []byte, off int64) error {
+	start := -1
+	for i := 0; i < len(buf); i += sparseBlockSize {
+		end := i + sparseBlockSize
+		if end > len(buf) {
+			end = len(buf)
+		}
+		if isZero(buf[i:end]) {
+			if start >= 0 {
+				if _, err := f.WriteAt(buf[start:i], off+int64(start)); err != nil {
+					return err
+				}
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		if _, err := f.WriteAt(buf[start:], off+int64(start)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// finishFile restores the owner, the extended attributes and the times of
+// an extracted entry.
+func finishFile(p string, hdr *tar.Header, editor FilePermissionsEditor) error {
+	if editor != nil {
+		if err := editor(p, hdr.Uid, hdr.Gid, hdr.Typeflag, hdr.FileInfo()); err != nil {
+			return err
+		}
+	}
+
+	// The extended attributes are set after the owner, as changing it
+	// drops the security.capability attribute.
+	if err := setXattrs(p, hdr); err != nil {
+		return err
+	}
+
+	// Restore entry atime and mtime.
+	// Use special function LUtimesNano not available on go's syscall package because we
+	// have to restore symlink's times and not the referenced file times.
+	ts := HdrToTimespec(hdr)
+	if hdr.Typeflag != tar.TypeSymlink {
+		if err := syscall.UtimesNano(p, ts); err != nil {
+			return err
+		}
+	} else {
+		if err := fileutil.LUtimesNano(p, ts); err != nil && err != ErrNotSupportedPlatform {
+			return err
+		}
+	}
+	return nil
+}
+
+// setXattrs sets the extended attributes of the entry on the extracted file.
+// The attributes are skipped when the file system does not support them,
+// when the namespace of the attribute, like security or trusted, requires
+// privileges we do not have, or when the type of the file, like symlinks
+// for the user namespace, does not support them.
+func setXattrs(p string, hdr *tar.Header) error {
+	regular := hdr.Typeflag == tar.TypeReg || hdr.Typeflag == tar.TypeRegA || hdr.Typeflag == tar.TypeDir
+	for name, value := range hdr.Xattrs {
+		err := fileutil.Lsetxattr(p, name, []byte(value), 0)
+		switch {
+		case err == nil:
+		case err == syscall.ENOTSUP:
+		case err == syscall.EPERM && (os.Geteuid() != 0 || !regular):
+		default:
+			return fmt.Errorf("error setting extended attribute %q on %q: %v", name, p, err)
+		}
+	}
+	return nil
+}
@@ -77,13 +77,38 @@ func ExtractTarInsecure(tr *tar.Reader, target string, overwrite bool, pwl PathW
 	um := syscall.Umask(0)
 	defer syscall.Umask(um)
 
+	// The regular files are written by a pool of workers, while the
+	// other entries are extracted in order.
+	pool := newWorkerPool(extractWorkers(), editor)
+	dirhdrs, err := extractEntries(tr, target, overwrite, pwl, editor, pool)
+	if perr := pool.close(); err == nil && perr != nil {
+		err = fmt.Errorf("error extracting tarball: %v", perr)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Restore dirs atime and mtime. This has to be done after extracting
+	// as a file extraction will change its parent directory's times.
+	for _, hdr := range dirhdrs {
+		p := filepath.Join(target, hdr.Name)
+		if err := syscall.UtimesNano(p, HdrToTimespec(hdr)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractEntries extracts the entries of the tarball, returning the headers
+// of the directories, whose times must be restored once all the entries are
+// extracted.
+func extractEntries(tr *tar.Reader, target string, overwrite bool, pwl PathWhitelistMap, editor FilePermissionsEditor, pool *workerPool) ([]*tar.Header, error) {
 	var dirhdrs []*tar.Header
-Tar:
 	for {
 		hdr, err := tr.Next()
 		switch err {
 		case io.EOF:
-			break Tar
+			return dirhdrs, nil
 		case nil:
 			if pwl != nil {
 				relpath := filepath.Clean(hdr.Name)
@@ -91,36 +116,36 @@ Tar:
 					continue
 				}
 			}
-			err = extractFile(tr, target, hdr, overwrite, editor)
+			err = extractFile(tr, target, hdr, overwrite, editor, pool)
 			if err != nil {
-				return fmt.Errorf("error extracting tarball: %v", err)
+				return nil, fmt.Errorf("error extracting tarball: %v", err)
 			}
 			if hdr.Typeflag == tar.TypeDir {
 				dirhdrs = append(dirhdrs, hdr)
 			}
 		default:
-			return fmt.Errorf("error extracting tarball: %v", err)
-		}
-	}
-
-	// Restore dirs atime and mtime. This has to be done after extracting
-	// as a file extraction will change its parent directory's times.
-	for _, hdr := range dirhdrs {
-		p := filepath.Join(target, hdr.Name)
-		if err := syscall.UtimesNano(p, HdrToTimespec(hdr)); err != nil {
-			return err
+			return nil, fmt.Errorf("error extracting tarball: %v", err)
 		}
 	}
-	return nil
 }
 
 // extractFile extracts the file described by hdr from the given tarball into
 // the target directory.
 // If overwrite is true, existing files will be overwritten.
-func extractFile(tr *tar.Reader, target string, hdr *tar.Header, overwrite bool, editor FilePermissionsEditor) error {
+// If pool is not nil, the small regular files are written by its workers.
+func extractFile(tr *tar.Reader, target string, hdr *tar.Header, overwrite bool, editor FilePermissionsEditor, pool *workerPool) error {
 	p := filepath.Join(target, hdr.Name)
 	fi := hdr.FileInfo()
 	typ := hdr.Typeflag
+
+	// Wait for the files being written when a hard link may point to
+	// one of them, or when one of them is replaced.
+	if pool != nil && (typ == tar.TypeLink || pool.isPending(p)) {
+		if err := pool.wait(); err != nil {
+			return err
+		}
+	}
+
 	if overwrite {
 		info, err := os.Lstat(p)
 		switch {
@@ -129,6 +154,13 @@ func extractFile(tr *tar.Reader, target string, hdr *tar.Header, overwrite bool,
 			// If the old and new paths are both dirs do nothing or
 			// RemoveAll will remove all dir's contents
 			if !info.IsDir() || typ != tar.TypeDir {
+				// the files being written may be in
+				// the removed dir
+				if pool != nil {
+					if err := pool.wait(); err != nil {
+						return err
+					}
+				}
 				err := os.RemoveAll(p)
 				if err != nil {
 					return err
@@ -145,16 +177,26 @@ func extractFile(tr *tar.Reader, target string, hdr *tar.Header, overwrite bool,
 	}
 	switch {
 	case typ == tar.TypeReg || typ == tar.TypeRegA:
-		f, err := os.OpenFile(p, os.O_CREATE|os.O_RDWR, fi.Mode())
+		f, err := os.OpenFile(p, os.O_CREATE|os.O_RDWR|os.O_TRUNC, fi.Mode())
 		if err != nil {
 			return err
 		}
-		_, err = io.Copy(f, tr)
-		if err != nil {
+		if pool != nil && hdr.Size <= maxBufferedFileSize {
+			data, err := ioutil.ReadAll(tr)
+			if err != nil {
+				f.Close()
+				return err
+			}
+			pool.submit(fileJob{f: f, path: p, hdr: hdr, data: data})
+			return nil
+		}
+		if err := writeSparse(f, tr); err != nil {
 			f.Close()
 			return err
 		}
-		f.Close()
+		if err := f.Close(); err != nil {
+			return err
+		}
 	case typ == tar.TypeDir:
 		if err := os.MkdirAll(p, fi.Mode()); err != nil {
 			return err
@@ -169,7 +211,7 @@ func extractFile(tr *tar.Reader, target string, hdr *tar.Header, overwrite bool,
 		}
 		dir.Close()
 	case typ == tar.TypeLink:
-		dest := filepath.Join("/", hdr.Linkname)
+		dest := filepath.Join(target, hdr.Linkname)
 		if err := os.Link(dest, p); err != nil {
 			return err
 		}
@@ -198,27 +240,7 @@ func extractFile(tr *tar.Reader, target string, hdr *tar.Header, overwrite bool,
 		return fmt.Errorf("unsupported type: %v", typ)
 	}
 
-	if editor != nil {
-		if err := editor(p, hdr.Uid, hdr.Gid, hdr.Typeflag, fi); err != nil {
-			return err
-		}
-	}
-
-	// Restore entry atime and mtime.
-	// Use special function LUtimesNano not available on go's syscall package because we
-	// have to restore symlink's times and not the referenced file times.
-	ts := HdrToTimespec(hdr)
-	if hdr.Typeflag != tar.TypeSymlink {
-		if err := syscall.UtimesNano(p, ts); err != nil {
-			return err
-		}
-	} else {
-		if err := fileutil.LUtimesNano(p, ts); err != nil && err != ErrNotSupportedPlatform {
-			return err
-		}
-	}
-
-	return nil
+	return finishFile(p, hdr, editor)
 }
 
 // extractFileFromTar extracts a regular file from the given tar, returning its
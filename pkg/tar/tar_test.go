@@ -22,9 +22,12 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"syscall"
 	"testing"
 	"time"
 
+	"github.com/coreos/rkt/pkg/fileutil"
 	"github.com/coreos/rkt/pkg/multicall"
 	"github.com/coreos/rkt/pkg/sys"
 	"github.com/coreos/rkt/pkg/uid"
@@ -681,6 +684,128 @@ func TestExtractTarTimes(t *testing.T) {
 	}
 }
 
+func TestExtractTarInsecureFidelity(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "rkt-temp-dir")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// check if the file system of tmpdir supports the user xattrs
+	xattrsSupported := true
+	if err := fileutil.Lsetxattr(tmpdir, "user.rkt.test", []byte("test"), 0); err != nil {
+		xattrsSupported = false
+	}
+
+	sparse := strings.Repeat("\x00", 2*maxBufferedFileSize) + "end" + strings.Repeat("\x00", maxBufferedFileSize)
+	entries := []*testTarEntry{
+		{
+			header: &tar.Header{
+				Name:     "folder/",
+				Typeflag: tar.TypeDir,
+			},
+		},
+		{
+			contents: sparse,
+			header: &tar.Header{
+				Name: "folder/sparse",
+				Size: int64(len(sparse)),
+			},
+		},
+		{
+			contents: "xattr",
+			header: &tar.Header{
+				Name:   "folder/xattr",
+				Size:   5,
+				Xattrs: map[string]string{"user.rkt.test": "value"},
+			},
+		},
+	}
+	// enough small files to keep all the workers busy
+	for i := 0; i < 4*maxExtractWorkers; i++ {
+		contents := fmt.Sprintf("file %d", i)
+		entries = append(entries, &testTarEntry{
+			contents: contents,
+			header: &tar.Header{
+				Name: fmt.Sprintf("folder/file%d", i),
+				Size: int64(len(contents)),
+			},
+		})
+	}
+	entries = append(entries, &testTarEntry{
+		header: &tar.Header{
+			Name:     "folder/hardlink",
+			Typeflag: tar.TypeLink,
+			Linkname: "folder/file3",
+		},
+	})
+
+	testTarPath, err := newTestTar(entries)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.Remove(testTarPath)
+	containerTar, err := os.Open(testTarPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer containerTar.Close()
+
+	// the tarball is extracted out of a chroot, so the hard links must be
+	// relative to the target
+	if err := ExtractTarInsecure(tar.NewReader(containerTar), tmpdir, false, nil, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for i := 0; i < 4*maxExtractWorkers; i++ {
+		buf, err := ioutil.ReadFile(filepath.Join(tmpdir, fmt.Sprintf("folder/file%d", i)))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if expected := fmt.Sprintf("file %d", i); string(buf) != expected {
+			t.Errorf("unexpected contents, wanted: %s, got: %s", expected, buf)
+		}
+	}
+
+	fi1, err := os.Stat(filepath.Join(tmpdir, "folder/file3"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fi2, err := os.Stat(filepath.Join(tmpdir, "folder/hardlink"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !os.SameFile(fi1, fi2) {
+		t.Errorf("folder/hardlink is not a hard link of folder/file3")
+	}
+
+	sparsePath := filepath.Join(tmpdir, "folder/sparse")
+	buf, err := ioutil.ReadFile(sparsePath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(buf) != sparse {
+		t.Errorf("unexpected contents of the sparse file")
+	}
+	fi, err := os.Stat(sparsePath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok && st.Blocks*512 >= fi.Size() {
+		t.Errorf("the sparse file was not restored sparsely: %d bytes allocated for %d bytes", st.Blocks*512, fi.Size())
+	}
+
+	if xattrsSupported {
+		value, err := fileutil.Lgetxattr(filepath.Join(tmpdir, "folder/xattr"), "user.rkt.test")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if string(value) != "value" {
+			t.Errorf("unexpected value of the xattr, wanted: value, got: %s", value)
+		}
+	}
+}
+
 func checkTime(path string, time time.Time) error {
 	info, err := os.Lstat(path)
 	if err != nil {
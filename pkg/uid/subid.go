@@ -0,0 +1,78 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uid
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	SubUidFile = "/etc/subuid"
+	SubGidFile = "/etc/subgid"
+)
+
+// LookupSubordinateRange returns the first range of subordinate IDs of a user
+// in a file in the format of /etc/subuid and /etc/subgid, see subuid(5). The
+// user is matched by name or by numeric ID.
+func LookupSubordinateRange(path string, name string, id uint32) (*UidRange, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, err := parseSubordinateRange(f, name, id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return r, nil
+}
+
+func parseSubordinateRange(r io.Reader, name string, id uint32) (*UidRange, error) {
+	idStr := strconv.FormatUint(uint64(id), 10)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// NAME_OR_ID:START:COUNT
+		fields := strings.Split(line, ":")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid line %q", line)
+		}
+		if fields[0] != idStr && (name == "" || fields[0] != name) {
+			continue
+		}
+		start, err := strconv.ParseUint(fields[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid start in line %q", line)
+		}
+		count, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil || count == 0 {
+			return nil, fmt.Errorf("invalid count in line %q", line)
+		}
+		return &UidRange{Shift: uint32(start), Count: uint32(count)}, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("no subordinate IDs for user %q (%d)", name, id)
+}
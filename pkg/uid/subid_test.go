@@ -0,0 +1,56 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uid
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSubordinateRange(t *testing.T) {
+	const contents = `
+# comment
+alice:100000:65536
+1001:165536:65536
+bob:231072:65536
+bob:296608:65536
+`
+	tests := []struct {
+		name     string
+		id       uint32
+		contents string
+		expected *UidRange
+		werr     bool
+	}{
+		{"alice", 1000, contents, &UidRange{100000, 65536}, false},
+		{"carol", 1001, contents, &UidRange{165536, 65536}, false},
+		{"bob", 1002, contents, &UidRange{231072, 65536}, false},
+		{"", 1001, contents, &UidRange{165536, 65536}, false},
+		{"dave", 1003, contents, nil, true},
+		{"alice", 1000, "alice:100000", nil, true},
+		{"alice", 1000, "alice:100000:0", nil, true},
+	}
+
+	for i, tt := range tests {
+		r, err := parseSubordinateRange(strings.NewReader(tt.contents), tt.name, tt.id)
+		if gerr := (err != nil); gerr != tt.werr {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.werr)
+		}
+		if !reflect.DeepEqual(r, tt.expected) {
+			t.Errorf("#%d: got %v, want %v", i, r, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+// Package vsock implements stream sockets of the AF_VSOCK address family,
+// connecting virtual machines and their host without a network.
+package vsock
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	// CIDAny is the context ID listening on all the context IDs
+	CIDAny uint32 = 0xffffffff
+	// CIDHost is the context ID of the host, as seen from its guests
+	CIDHost uint32 = 2
+
+	afVsock = 40
+)
+
+// sockaddrVM is struct sockaddr_vm of linux/vm_sockets.h
+type sockaddrVM struct {
+	family    uint16
+	reserved1 uint16
+	port      uint32
+	cid       uint32
+	zero      [4]uint8
+}
+
+// Addr is the address of a vsock socket.
+type Addr struct {
+	CID  uint32
+	Port uint32
+}
+
+// Network returns "vsock".
+func (a *Addr) Network() string {
+	return "vsock"
+}
+
+// String returns the address as CID:PORT.
+func (a *Addr) String() string {
+	return fmt.Sprintf("%d:%d", a.CID, a.Port)
+}
+
+// ParseAddr parses an address written as CID:PORT.
+func ParseAddr(s string) (*Addr, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid vsock address %q, must be CID:PORT", s)
+	}
+	cid, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vsock CID %q", parts[0])
+	}
+	port, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vsock port %q", parts[1])
+	}
+	return &Addr{CID: uint32(cid), Port: uint32(port)}, nil
+}
+
+func (a *Addr) sockaddr() *sockaddrVM {
+	return &sockaddrVM{family: afVsock, port: a.Port, cid: a.CID}
+}
+
+// Listen listens on port for the connections to any context ID of the
+// machine.
+func Listen(port uint32) (net.Listener, error) {
+	fd, err := syscall.Socket(afVsock, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+
+	addr := &Addr{CID: CIDAny, Port: port}
+	sa := addr.sockaddr()
+	if _, _, errno := syscall.Syscall(syscall.SYS_BIND, uintptr(fd), uintptr(unsafe.Pointer(sa)), unsafe.Sizeof(*sa)); errno != 0 {
+		syscall.Close(fd)
+		return nil, os.NewSyscallError("bind", errno)
+	}
+	if err := syscall.Listen(fd, syscall.SOMAXCONN); err != nil {
+		syscall.Close(fd)
+		return nil, os.NewSyscallError("listen", err)
+	}
+
+	return &listener{fd: fd, addr: addr}, nil
+}
+
+// Dial connects to addr.
+func Dial(addr *Addr) (net.Conn, error) {
+	fd, err := syscall.Socket(afVsock, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+
+	sa := addr.sockaddr()
+	for {
+		_, _, errno := syscall.Syscall(syscall.SYS_CONNECT, uintptr(fd), uintptr(unsafe.Pointer(sa)), unsafe.Sizeof(*sa))
+		if errno == syscall.EINTR {
+			continue
+		}
+		if errno != 0 {
+			syscall.Close(fd)
+			return nil, os.NewSyscallError("connect", errno)
+		}
+		break
+	}
+
+	return newConn(fd, &Addr{CID: CIDAny}, addr), nil
+}
+
+type listener struct {
+	fd   int
+	addr *Addr
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	for {
+		var sa sockaddrVM
+		salen := uint32(unsafe.Sizeof(sa))
+		nfd, _, errno := syscall.Syscall6(syscall.SYS_ACCEPT4, uintptr(l.fd), uintptr(unsafe.Pointer(&sa)), uintptr(unsafe.Pointer(&salen)), syscall.SOCK_CLOEXEC, 0, 0)
+		if errno == syscall.EINTR || errno == syscall.ECONNABORTED {
+			continue
+		}
+		if errno != 0 {
+			return nil, os.NewSyscallError("accept", errno)
+		}
+		return newConn(int(nfd), l.addr, &Addr{CID: sa.cid, Port: sa.port}), nil
+	}
+}
+
+// Close stops listening. The shutdown wakes up the blocked Accept calls.
+func (l *listener) Close() error {
+	syscall.Shutdown(l.fd, syscall.SHUT_RDWR)
+	return syscall.Close(l.fd)
+}
+
+func (l *listener) Addr() net.Addr {
+	return l.addr
+}
+
+// conn is a connected vsock socket. The file descriptor is blocking, so
+// the deadlines are not supported.
+type conn struct {
+	*os.File
+	local  *Addr
+	remote *Addr
+}
+
+func newConn(fd int, local, remote *Addr) *conn {
+	return &conn{
+		File:   os.NewFile(uintptr(fd), "vsock:"+remote.String()),
+		local:  local,
+		remote: remote,
+	}
+}
+
+func (c *conn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *conn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// CloseWrite shuts down the writing side of the connection, so the peer
+// reads EOF.
+func (c *conn) CloseWrite() error {
+	return syscall.Shutdown(int(c.Fd()), syscall.SHUT_WR)
+}
+
+func (c *conn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *conn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *conn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package vsock
+
+import (
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+func TestParseAddr(t *testing.T) {
+	tests := []struct {
+		addr    string
+		want    *Addr
+		wantErr bool
+	}{
+		{"2:2375", &Addr{CID: 2, Port: 2375}, false},
+		{"4294967295:122", &Addr{CID: CIDAny, Port: 122}, false},
+		{"3", nil, true},
+		{"3:122:1", nil, true},
+		{"host:122", nil, true},
+		{"3:-1", nil, true},
+		{"4294967296:122", nil, true},
+	}
+
+	for i, tt := range tests {
+		addr, err := ParseAddr(tt.addr)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("#%d: got error %v, want error %t", i, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(addr, tt.want) {
+			t.Errorf("#%d: got %v, want %v", i, addr, tt.want)
+		}
+		if addr != nil && addr.String() != tt.addr {
+			t.Errorf("#%d: got string %q, want %q", i, addr.String(), tt.addr)
+		}
+	}
+}
+
+func TestSockaddrVMLayout(t *testing.T) {
+	// struct sockaddr_vm is 16 bytes, with the port at offset 4 and the
+	// context ID at offset 8
+	var sa sockaddrVM
+	if size := unsafe.Sizeof(sa); size != 16 {
+		t.Errorf("got size %d, want 16", size)
+	}
+	if off := unsafe.Offsetof(sa.port); off != 4 {
+		t.Errorf("got port offset %d, want 4", off)
+	}
+	if off := unsafe.Offsetof(sa.cid); off != 8 {
+		t.Errorf("got cid offset %d, want 8", off)
+	}
+}
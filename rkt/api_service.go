@@ -16,21 +16,23 @@ package main
 
 import (
 	"encoding/json"
-	"fmt"
 	"log"
 	"net"
 	"os"
 	"os/signal"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/cobra"
 	"github.com/coreos/rkt/Godeps/_workspace/src/golang.org/x/net/context"
 	"github.com/coreos/rkt/Godeps/_workspace/src/google.golang.org/grpc"
+	"github.com/coreos/rkt/Godeps/_workspace/src/google.golang.org/grpc/credentials"
 	"github.com/coreos/rkt/api/v1alpha"
 	"github.com/coreos/rkt/common"
 	"github.com/coreos/rkt/store"
@@ -40,34 +42,53 @@ import (
 var (
 	supportedAPIVersion = "1.0.0-alpha"
 	cmdAPIService       = &cobra.Command{
-		Use:   "api-service [--listen-client-url=localhost:15441]",
+		Use:   "api-service [--listen=tcp://localhost:15441]",
 		Short: "Run API service (experimental, DO NOT USE IT)",
 		Run:   runWrapper(runAPIService),
 	}
 
 	flagAPIServiceListenClientURL string
+	flagAPIServiceListen          []string
+	flagAPIServiceControl         bool
+	flagAPIServiceControlSocket   string
+	flagAPIServiceAllowedUIDs     = idList{0}
+	flagAPIServiceAllowedGIDs     idList
+	flagAPIServiceTLSCertFile     string
+	flagAPIServiceTLSKeyFile      string
+	flagAPIServiceTLSClientCAFile string
 )
 
 func init() {
 	cmdRkt.AddCommand(cmdAPIService)
-	cmdAPIService.Flags().StringVar(&flagAPIServiceListenClientURL, "--listen-client-url", common.APIServiceListenClientURL, "address to listen on client API requests")
+	cmdAPIService.Flags().StringSliceVar(&flagAPIServiceListen, "listen", []string{"tcp://" + common.APIServiceListenClientURL}, "addresses to listen on client API requests, in the form tcp://HOST:PORT or unix:///PATH")
+	cmdAPIService.Flags().StringVar(&flagAPIServiceListenClientURL, "listen-client-url", "", "address to listen on client API requests")
+	cmdAPIService.Flags().MarkDeprecated("listen-client-url", "use --listen=tcp://HOST:PORT instead")
+	cmdAPIService.Flags().BoolVar(&flagAPIServiceControl, "enable-control-api", false, "serve the control API, which can run, stop and remove pods, fetch images and execute commands in pods")
+	cmdAPIService.Flags().StringVar(&flagAPIServiceControlSocket, "control-socket", common.APIServiceControlSocket, "unix socket to listen on control API requests")
+	cmdAPIService.Flags().Var(&flagAPIServiceAllowedUIDs, "control-allowed-uids", "comma-separated list of user IDs allowed to connect to the control socket")
+	cmdAPIService.Flags().Var(&flagAPIServiceAllowedGIDs, "control-allowed-gids", "comma-separated list of group IDs allowed to connect to the control socket")
+	cmdAPIService.Flags().StringVar(&flagAPIServiceTLSCertFile, "tls-cert-file", "", "TLS certificate of the service, enables TLS on the TCP addresses")
+	cmdAPIService.Flags().StringVar(&flagAPIServiceTLSKeyFile, "tls-key-file", "", "TLS private key of the service")
+	cmdAPIService.Flags().StringVar(&flagAPIServiceTLSClientCAFile, "tls-client-ca-file", "", "CA certificates used to verify the clients. If set, the control API is also served on the TCP addresses")
 }
 
 // v1AlphaAPIServer implements v1Alpha.APIServer interface.
 type v1AlphaAPIServer struct {
-	store *store.Store
+	store  *store.Store
+	events *eventWatcher
 }
 
 var _ v1alpha.PublicAPIServer = &v1AlphaAPIServer{}
 
 func newV1AlphaAPIServer() (*v1AlphaAPIServer, error) {
-	s, err := store.NewStore(globalFlags.Dir)
+	s, err := newStore()
 	if err != nil {
 		return nil, err
 	}
 
 	return &v1AlphaAPIServer{
-		store: s,
+		store:  s,
+		events: newEventWatcher(s),
 	}, nil
 }
 
@@ -98,6 +119,19 @@ func containsKeyValue(actualKVs valueGetter, requiredKVs []*v1alpha.KeyValue) bo
 	return false
 }
 
+// containsAllKeyValues returns true if the user annotations or labels of a
+// pod, depending on prefix, contain all of the key-value pairs listed in
+// requiredKVs, otherwise it returns false.
+func containsAllKeyValues(annotations types.Annotations, prefix string, requiredKVs []*v1alpha.KeyValue) bool {
+	for _, requiredKV := range requiredKVs {
+		actualValue, ok := annotations.Get(prefix + requiredKV.Key)
+		if !ok || actualValue != requiredKV.Value {
+			return false
+		}
+	}
+	return true
+}
+
 // containsString tries to find a string in a string array which satisfies the checkFunc.
 // The checkFunc takes two strings, and returns whether the two strings satisfy the
 // given condition.
@@ -121,6 +155,18 @@ func hasBaseName(name, baseName string) bool {
 	return path.Base(name) == baseName
 }
 
+// hasDigest returns whether the image id has the digest, which can be
+// abbreviated and omit the hash algorithm.
+func hasDigest(id, digest string) bool {
+	if digest == "" {
+		return false
+	}
+	if i := strings.Index(id, "-"); i >= 0 && !strings.Contains(digest, "-") {
+		id = id[i+1:]
+	}
+	return strings.HasPrefix(id, digest)
+}
+
 // hasIntersection returns true if there's any two-string pair from array a and
 // array b that satisfy the checkFunc.
 //
@@ -191,6 +237,29 @@ func filterPod(pod *v1alpha.Pod, manifest *schema.PodManifest, filter *v1alpha.P
 		}
 	}
 
+	// Filter according to the image digests.
+	if len(filter.ImageDigests) > 0 {
+		var ids []string
+		for _, app := range pod.Apps {
+			ids = append(ids, app.Image.Id)
+		}
+		if !hasIntersection(ids, filter.ImageDigests, hasDigest) {
+			return true
+		}
+	}
+
+	// Filter according to the creation time.
+	if filter.CreatedAfter > 0 {
+		if pod.CreatedAt <= filter.CreatedAfter {
+			return true
+		}
+	}
+	if filter.CreatedBefore > 0 {
+		if pod.CreatedAt == 0 || pod.CreatedAt >= filter.CreatedBefore {
+			return true
+		}
+	}
+
 	// Filter according to the network names.
 	if len(filter.NetworkNames) > 0 {
 		var names []string
@@ -209,6 +278,14 @@ func filterPod(pod *v1alpha.Pod, manifest *schema.PodManifest, filter *v1alpha.P
 		}
 	}
 
+	// Filter according to the user annotations and labels.
+	if !containsAllKeyValues(manifest.Annotations, common.UserAnnotationPrefix, filter.UserAnnotations) {
+		return true
+	}
+	if !containsAllKeyValues(manifest.Annotations, common.UserLabelPrefix, filter.UserLabels) {
+		return true
+	}
+
 	return false
 }
 
@@ -296,6 +373,23 @@ func getNetworks(p *pod) []*v1alpha.Network {
 	return networks
 }
 
+// getUserKeyValues returns the user annotations or labels, depending on
+// prefix, of a pod as a sorted list of key-value pairs.
+func getUserKeyValues(manifest *schema.PodManifest, prefix string) []*v1alpha.KeyValue {
+	kvs := getUserKVs(manifest.Annotations, prefix)
+	var keys []string
+	for k := range kvs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var result []*v1alpha.KeyValue
+	for _, k := range keys {
+		result = append(result, &v1alpha.KeyValue{Key: k, Value: kvs[k]})
+	}
+	return result
+}
+
 // getBasicPod returns *v1alpha.Pod with basic pod information, it also returns a *schema.PodManifest
 // object.
 func getBasicPod(p *pod) (*v1alpha.Pod, *schema.PodManifest, error) {
@@ -314,6 +408,13 @@ func getBasicPod(p *pod) (*v1alpha.Pod, *schema.PodManifest, error) {
 		return nil, nil, err
 	}
 
+	var createdAt int64
+	if created, err := p.getCreationTime(); err != nil {
+		return nil, nil, err
+	} else if !created.IsZero() {
+		createdAt = created.Unix()
+	}
+
 	return &v1alpha.Pod{
 		Id:       p.uuid.String(),
 		Pid:      int32(pid),
@@ -321,6 +422,10 @@ func getBasicPod(p *pod) (*v1alpha.Pod, *schema.PodManifest, error) {
 		Apps:     apps,
 		Manifest: data,
 		Networks: getNetworks(p), // Get pod's network.
+
+		UserAnnotations: getUserKeyValues(manifest, common.UserAnnotationPrefix),
+		UserLabels:      getUserKeyValues(manifest, common.UserLabelPrefix),
+		CreatedAt:       createdAt,
 	}, manifest, nil
 }
 
@@ -486,6 +591,13 @@ func filterImage(image *v1alpha.Image, manifest *schema.ImageManifest, filter *v
 		}
 	}
 
+	// Filter according to the digests.
+	if len(filter.Digests) > 0 {
+		if !containsString(image.Id, filter.Digests, hasDigest) {
+			return true
+		}
+	}
+
 	// Filter according to the image name prefixes.
 	if len(filter.Prefixes) > 0 {
 		if !containsString(image.Name, filter.Prefixes, strings.HasPrefix) {
@@ -565,12 +677,44 @@ func (s *v1AlphaAPIServer) InspectImage(ctx context.Context, request *v1alpha.In
 	return &v1alpha.InspectImageResponse{Image: image}, nil
 }
 
-func (s *v1AlphaAPIServer) GetLogs(request *v1alpha.GetLogsRequest, server v1alpha.PublicAPI_GetLogsServer) error {
-	return fmt.Errorf("not implemented yet")
-}
-
 func (s *v1AlphaAPIServer) ListenEvents(request *v1alpha.ListenEventsRequest, server v1alpha.PublicAPI_ListenEventsServer) error {
-	return fmt.Errorf("not implemented yet")
+	ch := s.events.subscribe()
+	defer s.events.unsubscribe(ch)
+
+	// Close the stream once the until_time is reached.
+	var until <-chan time.Time
+	if request.Filter != nil && request.Filter.UntilTime > 0 {
+		d := time.Unix(request.Filter.UntilTime, 0).Sub(time.Now())
+		if d <= 0 {
+			return nil
+		}
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		until = timer.C
+	}
+
+	for {
+		select {
+		case <-server.Context().Done():
+			return nil
+		case <-until:
+			return nil
+		case events := <-ch:
+			var filtered []*v1alpha.Event
+			for _, event := range events {
+				if !filterEvent(event, request.Filter) {
+					filtered = append(filtered, event)
+				}
+			}
+			if len(filtered) == 0 {
+				continue
+			}
+			if err := server.Send(&v1alpha.ListenEventsResponse{Events: filtered}); err != nil {
+				log.Printf("Failed to send events: %v", err)
+				return err
+			}
+		}
+	}
 }
 
 func runAPIService(cmd *cobra.Command, args []string) (exit int) {
@@ -580,14 +724,23 @@ func runAPIService(cmd *cobra.Command, args []string) (exit int) {
 
 	log.Print("API service starting...")
 
-	tcpl, err := net.Listen("tcp", flagAPIServiceListenClientURL)
-	if err != nil {
-		stderr("api-service: %v", err)
+	var serverOpts []grpc.ServerOption
+	if flagAPIServiceTLSCertFile != "" || flagAPIServiceTLSKeyFile != "" {
+		tlsConfig, err := newServerTLSConfig(flagAPIServiceTLSCertFile, flagAPIServiceTLSKeyFile, flagAPIServiceTLSClientCAFile)
+		if err != nil {
+			stderr("api-service: %v", err)
+			return 1
+		}
+		serverOpts = append(serverOpts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	} else if flagAPIServiceTLSClientCAFile != "" {
+		stderr("api-service: --tls-client-ca-file requires --tls-cert-file and --tls-key-file")
 		return 1
 	}
-	defer tcpl.Close()
 
-	publicServer := grpc.NewServer() // TODO(yifan): Add TLS credential option.
+	listenAddrs := flagAPIServiceListen
+	if flagAPIServiceListenClientURL != "" {
+		listenAddrs = []string{"tcp://" + flagAPIServiceListenClientURL}
+	}
 
 	v1AlphaAPIServer, err := newV1AlphaAPIServer()
 	if err != nil {
@@ -595,11 +748,56 @@ func runAPIService(cmd *cobra.Command, args []string) (exit int) {
 		return 1
 	}
 
-	v1alpha.RegisterPublicAPIServer(publicServer, v1AlphaAPIServer)
+	// TCP addresses are secured with TLS if configured, unix sockets
+	// rely on the permissions of the socket file.
+	tcpServer := grpc.NewServer(serverOpts...)
+	v1alpha.RegisterPublicAPIServer(tcpServer, v1AlphaAPIServer)
+	// The control API is only served over TCP when the clients are authenticated.
+	if flagAPIServiceControl && flagAPIServiceTLSClientCAFile != "" {
+		v1alpha.RegisterControlAPIServer(tcpServer, v1AlphaAPIServer)
+	}
 
-	go publicServer.Serve(tcpl)
+	unixServer := grpc.NewServer()
+	v1alpha.RegisterPublicAPIServer(unixServer, v1AlphaAPIServer)
 
-	log.Printf("API service running on %v...", flagAPIServiceListenClientURL)
+	for _, addr := range listenAddrs {
+		l, err := listenAPIAddress(addr)
+		if err != nil {
+			stderr("api-service: %v", err)
+			return 1
+		}
+		defer l.Close()
+
+		if _, ok := l.(*net.UnixListener); ok {
+			go unixServer.Serve(l)
+		} else {
+			go tcpServer.Serve(l)
+		}
+
+		log.Printf("API service running on %v...", addr)
+	}
+
+	stopEvents := make(chan struct{})
+	defer close(stopEvents)
+	go v1AlphaAPIServer.events.run(stopEvents)
+
+	if flagAPIServiceControl {
+		unixl, err := listenUnixWithPeerCred(flagAPIServiceControlSocket, flagAPIServiceAllowedUIDs, flagAPIServiceAllowedGIDs)
+		if err != nil {
+			stderr("api-service: %v", err)
+			return 1
+		}
+		defer os.Remove(flagAPIServiceControlSocket)
+		defer unixl.Close()
+
+		controlServer := grpc.NewServer()
+		v1alpha.RegisterPublicAPIServer(controlServer, v1AlphaAPIServer)
+		v1alpha.RegisterControlAPIServer(controlServer, v1AlphaAPIServer)
+
+		go controlServer.Serve(unixl)
+
+		log.Printf("API service control socket listening on %v...", flagAPIServiceControlSocket)
+	}
 
 	<-exitCh
 
@@ -0,0 +1,226 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// idList implements the flag.Value interface for a comma-separated list of
+// numeric user or group IDs.
+type idList []int
+
+func (l *idList) String() string {
+	var ids []string
+	for _, id := range *l {
+		ids = append(ids, strconv.Itoa(id))
+	}
+	return strings.Join(ids, ",")
+}
+
+func (l *idList) Set(value string) error {
+	var ids idList
+	for _, s := range strings.Split(value, ",") {
+		if s == "" {
+			continue
+		}
+		id, err := strconv.Atoi(s)
+		if err != nil || id < 0 {
+			return fmt.Errorf("invalid id %q", s)
+		}
+		ids = append(ids, id)
+	}
+	*l = ids
+	return nil
+}
+
+func (l *idList) Type() string {
+	return "idList"
+}
+
+func (l idList) contains(id int) bool {
+	for _, i := range l {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+// peerCredListener is a net.Listener on a unix socket which only accepts
+// the connections of the peers whose user or group is allowed. The
+// credentials of the peers are checked with SO_PEERCRED.
+type peerCredListener struct {
+	net.Listener
+	allowedUIDs idList
+	allowedGIDs idList
+}
+
+// listenUnixWithPeerCred creates a unix socket at path and returns a
+// listener on it that only accepts the allowed peers.
+func listenUnixWithPeerCred(path string, allowedUIDs, allowedGIDs idList) (net.Listener, error) {
+	l, err := listenUnix(path, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	return &peerCredListener{
+		Listener:    l,
+		allowedUIDs: allowedUIDs,
+		allowedGIDs: allowedGIDs,
+	}, nil
+}
+
+func (l *peerCredListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		cred, err := getPeerCred(conn)
+		if err != nil {
+			log.Printf("Rejecting connection: cannot get peer credentials: %v", err)
+			conn.Close()
+			continue
+		}
+		if !l.allowed(cred) {
+			log.Printf("Rejecting connection from unauthorized peer (pid %d, uid %d, gid %d)", cred.Pid, cred.Uid, cred.Gid)
+			conn.Close()
+			continue
+		}
+
+		return conn, nil
+	}
+}
+
+func (l *peerCredListener) allowed(cred *syscall.Ucred) bool {
+	return l.allowedUIDs.contains(int(cred.Uid)) || l.allowedGIDs.contains(int(cred.Gid))
+}
+
+// getPeerCred returns the credentials of the process at the other end of a
+// unix socket connection.
+func getPeerCred(conn net.Conn) (*syscall.Ucred, error) {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil, fmt.Errorf("not a unix socket connection")
+	}
+
+	f, err := uc.File()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return syscall.GetsockoptUcred(int(f.Fd()), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+}
+
+// listenUnix creates a unix socket at path with the given permissions and
+// returns a listener on it.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	// Remove a stale socket left over by a previous instance.
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// parseListenAddress splits an address of the form tcp://HOST:PORT or
+// unix:///PATH into its network and address parts.
+func parseListenAddress(addr string) (network string, address string, err error) {
+	parts := strings.SplitN(addr, "://", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid address %q, must be in the form tcp://HOST:PORT or unix:///PATH", addr)
+	}
+
+	switch parts[0] {
+	case "tcp":
+		return "tcp", parts[1], nil
+	case "unix":
+		if !filepath.IsAbs(parts[1]) {
+			return "", "", fmt.Errorf("invalid address %q, the path of the unix socket must be absolute", addr)
+		}
+		return "unix", parts[1], nil
+	default:
+		return "", "", fmt.Errorf("invalid address %q, unsupported scheme %q", addr, parts[0])
+	}
+}
+
+// listenAPIAddress returns a listener on an address of the form tcp://HOST:PORT
+// or unix:///PATH. The unix sockets are only accessible to root and the group
+// of the socket file.
+func listenAPIAddress(addr string) (net.Listener, error) {
+	network, address, err := parseListenAddress(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if network == "unix" {
+		return listenUnix(address, 0660)
+	}
+	return net.Listen(network, address)
+}
+
+// newServerTLSConfig returns the TLS configuration of the api service.
+// If clientCAFile is not empty, then the clients must present a certificate
+// signed by one of the CAs in that file.
+func newServerTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load certificate: %v", err)
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if clientCAFile != "" {
+		pem, err := ioutil.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read client CA file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid certificate found in client CA file %q", clientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
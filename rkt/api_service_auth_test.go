@@ -0,0 +1,111 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestIDList(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected idList
+		err      bool
+	}{
+		{"0", idList{0}, false},
+		{"0,1000,1001", idList{0, 1000, 1001}, false},
+		{"", nil, false},
+		{"root", nil, true},
+		{"-1", nil, true},
+	}
+
+	for i, tt := range tests {
+		var l idList
+		err := l.Set(tt.in)
+		if (err != nil) != tt.err {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+			continue
+		}
+		if !tt.err && !reflect.DeepEqual(l, tt.expected) {
+			t.Errorf("#%d: got %v, want %v", i, l, tt.expected)
+		}
+	}
+}
+
+func TestParseListenAddress(t *testing.T) {
+	tests := []struct {
+		addr    string
+		network string
+		address string
+		err     bool
+	}{
+		{"tcp://localhost:15441", "tcp", "localhost:15441", false},
+		{"unix:///run/rkt/api.sock", "unix", "/run/rkt/api.sock", false},
+		{"unix://run/rkt/api.sock", "", "", true},
+		{"localhost:15441", "", "", true},
+		{"http://localhost:15441", "", "", true},
+		{"tcp://", "", "", true},
+	}
+
+	for i, tt := range tests {
+		network, address, err := parseListenAddress(tt.addr)
+		if (err != nil) != tt.err {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+			continue
+		}
+		if network != tt.network || address != tt.address {
+			t.Errorf("#%d: got (%q, %q), want (%q, %q)", i, network, address, tt.network, tt.address)
+		}
+	}
+}
+
+func TestPeerCredListener(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rkt-api-test-")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "api.sock")
+
+	l, err := listenUnixWithPeerCred(path, idList{os.Getuid()}, nil)
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	defer l.Close()
+
+	accepted := make(chan error, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			conn.Close()
+		}
+		accepted <- err
+	}()
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("error connecting: %v", err)
+	}
+	defer conn.Close()
+
+	if err := <-accepted; err != nil {
+		t.Errorf("expected the connection of an allowed user to be accepted: %v", err)
+	}
+}
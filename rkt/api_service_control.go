@@ -0,0 +1,244 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/Godeps/_workspace/src/golang.org/x/net/context"
+	"github.com/coreos/rkt/api/v1alpha"
+)
+
+const (
+	// runPodTimeout is how long RunPod() waits for the pod to be started.
+	runPodTimeout = 5 * time.Minute
+	// runPodPollInterval is how often RunPod() checks whether the pod has been started.
+	runPodPollInterval = 100 * time.Millisecond
+)
+
+// rktGlobalArgs returns the global flags that the api service passes to the
+// rkt commands it executes, so they operate on the same data and configuration.
+func rktGlobalArgs() []string {
+	args := []string{
+		fmt.Sprintf("--dir=%s", globalFlags.Dir),
+		fmt.Sprintf("--system-config=%s", globalFlags.SystemConfigDir),
+		fmt.Sprintf("--local-config=%s", globalFlags.LocalConfigDir),
+	}
+	if globalFlags.InsecureSkipVerify {
+		args = append(args, "--insecure-skip-verify")
+	}
+	if len(globalFlags.InsecureOptions) > 0 {
+		args = append(args, fmt.Sprintf("--insecure-options=%s", globalFlags.InsecureOptions.String()))
+	}
+	if globalFlags.Debug {
+		args = append(args, "--debug")
+	}
+	return args
+}
+
+// RunPod runs 'rkt run' in the background, as running a pod replaces the
+// process with stage1, and waits for the pod to be started.
+func (s *v1AlphaAPIServer) RunPod(ctx context.Context, request *v1alpha.RunPodRequest) (*v1alpha.RunPodResponse, error) {
+	if len(request.Images) == 0 {
+		return nil, fmt.Errorf("no image specified")
+	}
+
+	tmpDir, err := ioutil.TempDir("", "rkt-api-run-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+	uuidFile := filepath.Join(tmpDir, "uuid")
+
+	args := rktGlobalArgs()
+	args = append(args, "run", fmt.Sprintf("--uuid-file-save=%s", uuidFile))
+	if request.PullPolicy != "" {
+		var policy pullPolicy
+		if err := policy.Set(request.PullPolicy); err != nil {
+			return nil, err
+		}
+		args = append(args, fmt.Sprintf("--pull-policy=%s", policy))
+	}
+	args = append(args, request.Args...)
+	args = append(args, request.Images...)
+
+	cmd := exec.Command("/proc/self/exe", args...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	// Do not let the pod die with the api service.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		log.Printf("Failed to start rkt run: %v", err)
+		return nil, err
+	}
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	timeout := time.After(runPodTimeout)
+	ticker := time.NewTicker(runPodPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case err := <-exited:
+			// The pod might have run and exited already.
+			if uuid, rerr := readUUIDFromFile(uuidFile); rerr == nil && err == nil {
+				return &v1alpha.RunPodResponse{PodId: uuid.String()}, nil
+			}
+			return nil, fmt.Errorf("rkt run exited before starting the pod: %v", err)
+		case <-timeout:
+			return nil, fmt.Errorf("timed out waiting for the pod to start")
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+			uuid, err := readUUIDFromFile(uuidFile)
+			if err != nil {
+				continue
+			}
+			p, err := getPod(uuid)
+			if err != nil {
+				continue
+			}
+			started := p.isRunning() || p.isExited
+			p.Close()
+			if started {
+				return &v1alpha.RunPodResponse{PodId: uuid.String()}, nil
+			}
+		}
+	}
+}
+
+func (s *v1AlphaAPIServer) StopPod(ctx context.Context, request *v1alpha.StopPodRequest) (*v1alpha.StopPodResponse, error) {
+	uuid, err := types.NewUUID(request.Id)
+	if err != nil {
+		log.Printf("Invalid pod id %q: %v", request.Id, err)
+		return nil, err
+	}
+
+	p, err := getPod(uuid)
+	if err != nil {
+		log.Printf("Failed to get pod %q: %v", request.Id, err)
+		return nil, err
+	}
+	defer p.Close()
+
+	if !p.isRunning() {
+		return nil, fmt.Errorf("pod %q isn't currently running", request.Id)
+	}
+
+	pid, err := p.getPID()
+	if err != nil {
+		log.Printf("Unable to determine the pid for pod %q: %v", request.Id, err)
+		return nil, err
+	}
+
+	// systemd-nspawn shuts the pod down gracefully on SIGTERM.
+	sig := syscall.SIGTERM
+	if request.Force {
+		sig = syscall.SIGKILL
+	}
+	if err := syscall.Kill(pid, sig); err != nil {
+		log.Printf("Failed to stop pod %q: %v", request.Id, err)
+		return nil, err
+	}
+
+	return &v1alpha.StopPodResponse{}, nil
+}
+
+func (s *v1AlphaAPIServer) RemovePod(ctx context.Context, request *v1alpha.RemovePodRequest) (*v1alpha.RemovePodResponse, error) {
+	uuid, err := types.NewUUID(request.Id)
+	if err != nil {
+		log.Printf("Invalid pod id %q: %v", request.Id, err)
+		return nil, err
+	}
+
+	p, err := getPod(uuid)
+	if err != nil {
+		log.Printf("Failed to get pod %q: %v", request.Id, err)
+		return nil, err
+	}
+	defer p.Close()
+
+	if !removePod(p) {
+		return nil, fmt.Errorf("failed to remove pod %q in state %q", request.Id, p.getState())
+	}
+
+	return &v1alpha.RemovePodResponse{}, nil
+}
+
+func (s *v1AlphaAPIServer) FetchImage(ctx context.Context, request *v1alpha.FetchImageRequest) (*v1alpha.FetchImageResponse, error) {
+	if request.Name == "" {
+		return nil, fmt.Errorf("no image specified")
+	}
+	if request.StoreOnly && request.NoStore {
+		return nil, fmt.Errorf("both store_only and no_store specified")
+	}
+	policy := pullPolicyNew
+	switch {
+	case request.PullPolicy != "":
+		if request.StoreOnly || request.NoStore {
+			return nil, fmt.Errorf("pull_policy cannot be used with store_only or no_store")
+		}
+		if err := policy.Set(request.PullPolicy); err != nil {
+			return nil, err
+		}
+	case request.StoreOnly:
+		policy = pullPolicyNever
+	case request.NoStore:
+		policy = pullPolicyUpdate
+	}
+
+	config, err := getConfig()
+	if err != nil {
+		log.Printf("Cannot get configuration: %v", err)
+		return nil, err
+	}
+
+	ft := &fetcher{
+		imageActionData: imageActionData{
+			s:                  s.store,
+			ks:                 getKeystore(),
+			headers:            config.AuthPerHost,
+			dockerAuth:         config.DockerCredentialsPerRegistry,
+			dockerHelpers:      config.DockerCredentialHelpers,
+			archFallbacks:      config.ArchFallbacks,
+			insecureSkipVerify: globalFlags.InsecureSkipVerify,
+			debug:              globalFlags.Debug,
+		},
+		storeOnly: policy.storeOnly(),
+		noStore:   policy.noStore(),
+		noCache:   policy.noCache(),
+		withDeps:  true,
+	}
+
+	hash, err := ft.fetchImage(request.Name, "")
+	if err != nil {
+		log.Printf("Failed to fetch image %q: %v", request.Name, err)
+		return nil, err
+	}
+
+	return &v1alpha.FetchImageResponse{Id: hash}, nil
+}
@@ -0,0 +1,341 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/coreos/rkt/api/v1alpha"
+	"github.com/coreos/rkt/store"
+)
+
+// eventPollInterval is how often the pods and images on the machine
+// are inspected for changes.
+const eventPollInterval = time.Second
+
+// podSnapshot records the observable state of a pod at a given time.
+type podSnapshot struct {
+	state      v1alpha.PodState
+	apps       []string
+	exitedApps map[string]int
+}
+
+// imageSnapshot maps image IDs to image names.
+type imageSnapshot map[string]string
+
+// eventWatcher periodically takes snapshots of the pods and images on the
+// machine and broadcasts the differences as events to its subscribers.
+//
+// rkt has no long running daemon that could emit the events when they happen,
+// so the api service has to infer them from the on-disk state.
+type eventWatcher struct {
+	store *store.Store
+
+	pods   map[string]*podSnapshot
+	images imageSnapshot
+
+	mu          sync.Mutex
+	subscribers map[chan []*v1alpha.Event]struct{}
+}
+
+func newEventWatcher(s *store.Store) *eventWatcher {
+	return &eventWatcher{
+		store:       s,
+		subscribers: make(map[chan []*v1alpha.Event]struct{}),
+	}
+}
+
+// subscribe registers a new subscriber. The returned channel receives
+// every batch of events until unsubscribe is called.
+func (w *eventWatcher) subscribe() chan []*v1alpha.Event {
+	ch := make(chan []*v1alpha.Event, 16)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.subscribers[ch] = struct{}{}
+	return ch
+}
+
+func (w *eventWatcher) unsubscribe(ch chan []*v1alpha.Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.subscribers, ch)
+}
+
+// broadcast sends the events to all subscribers. Slow subscribers
+// that have a full queue miss the batch rather than stalling the others.
+func (w *eventWatcher) broadcast(events []*v1alpha.Event) {
+	if len(events) == 0 {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for ch := range w.subscribers {
+		select {
+		case ch <- events:
+		default:
+			log.Printf("Dropping %d events for a slow subscriber", len(events))
+		}
+	}
+}
+
+// run takes the initial snapshots and then polls for changes until stop
+// is closed. The initial state of the machine does not generate events.
+func (w *eventWatcher) run(stop <-chan struct{}) {
+	var err error
+	if w.pods, err = snapshotPods(); err != nil {
+		log.Printf("Failed to take pods snapshot: %v", err)
+	}
+	if w.images, err = snapshotImages(w.store); err != nil {
+		log.Printf("Failed to take images snapshot: %v", err)
+	}
+
+	ticker := time.NewTicker(eventPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			w.poll()
+		}
+	}
+}
+
+func (w *eventWatcher) poll() {
+	now := time.Now().Unix()
+	var events []*v1alpha.Event
+
+	pods, err := snapshotPods()
+	if err != nil {
+		log.Printf("Failed to take pods snapshot: %v", err)
+	} else {
+		events = append(events, diffPodSnapshots(w.pods, pods, now)...)
+		w.pods = pods
+	}
+
+	images, err := snapshotImages(w.store)
+	if err != nil {
+		log.Printf("Failed to take images snapshot: %v", err)
+	} else {
+		events = append(events, diffImageSnapshots(w.images, images, now)...)
+		w.images = images
+	}
+
+	w.broadcast(events)
+}
+
+// snapshotPods returns the current snapshots of all the pods, keyed by the pods' uuids.
+func snapshotPods() (map[string]*podSnapshot, error) {
+	pods := make(map[string]*podSnapshot)
+	if err := walkPods(includeMostDirs, func(p *pod) {
+		snap := &podSnapshot{
+			state:      getPodState(p),
+			exitedApps: make(map[string]int),
+		}
+		if apps, err := p.getApps(); err == nil {
+			for _, app := range apps {
+				snap.apps = append(snap.apps, app.Name.String())
+			}
+		}
+		if snap.state == v1alpha.PodState_POD_STATE_RUNNING || snap.state == v1alpha.PodState_POD_STATE_EXITED {
+			if statuses, err := p.getExitStatuses(); err == nil {
+				snap.exitedApps = statuses
+			}
+		}
+		pods[p.uuid.String()] = snap
+	}); err != nil {
+		return nil, err
+	}
+	return pods, nil
+}
+
+// snapshotImages returns the IDs and names of all the images in the store.
+func snapshotImages(s *store.Store) (imageSnapshot, error) {
+	aciInfos, err := s.GetAllACIInfos(nil, false)
+	if err != nil {
+		return nil, err
+	}
+
+	images := make(imageSnapshot)
+	for _, aciInfo := range aciInfos {
+		images[aciInfo.BlobKey] = aciInfo.Name
+	}
+	return images, nil
+}
+
+// podStateEventType returns the event type that a transition into the given
+// state generates, or EVENT_TYPE_UNDEFINED if the transition is not reported.
+func podStateEventType(state v1alpha.PodState) v1alpha.EventType {
+	switch state {
+	case v1alpha.PodState_POD_STATE_PREPARED:
+		return v1alpha.EventType_EVENT_TYPE_POD_PREPARED
+	case v1alpha.PodState_POD_STATE_ABORTED_PREPARE:
+		return v1alpha.EventType_EVENT_TYPE_POD_PREPARE_ABORTED
+	case v1alpha.PodState_POD_STATE_RUNNING:
+		return v1alpha.EventType_EVENT_TYPE_POD_STARTED
+	case v1alpha.PodState_POD_STATE_EXITED:
+		return v1alpha.EventType_EVENT_TYPE_POD_EXITED
+	case v1alpha.PodState_POD_STATE_GARBAGE:
+		return v1alpha.EventType_EVENT_TYPE_POD_GARBAGE_COLLECTED
+	default:
+		return v1alpha.EventType_EVENT_TYPE_UNDEFINED
+	}
+}
+
+// diffPodSnapshots returns the events that lead from the old snapshots to the new ones.
+func diffPodSnapshots(oldPods, newPods map[string]*podSnapshot, now int64) []*v1alpha.Event {
+	var events []*v1alpha.Event
+
+	for _, id := range sortedPodIDs(newPods) {
+		snap := newPods[id]
+		prev, existed := oldPods[id]
+
+		if !existed || prev.state != snap.state {
+			if typ := podStateEventType(snap.state); typ != v1alpha.EventType_EVENT_TYPE_UNDEFINED {
+				events = append(events, &v1alpha.Event{Type: typ, Id: id, From: id, Time: now})
+			}
+			if snap.state == v1alpha.PodState_POD_STATE_RUNNING {
+				for _, app := range snap.apps {
+					events = append(events, &v1alpha.Event{Type: v1alpha.EventType_EVENT_TYPE_APP_STARTED, Id: id, From: app, Time: now})
+				}
+			}
+		}
+
+		for _, app := range snap.apps {
+			exitCode, exited := snap.exitedApps[app]
+			if !exited {
+				continue
+			}
+			if existed {
+				if _, alreadyExited := prev.exitedApps[app]; alreadyExited {
+					continue
+				}
+			}
+			events = append(events, &v1alpha.Event{
+				Type: v1alpha.EventType_EVENT_TYPE_APP_EXITED,
+				Id:   id,
+				From: app,
+				Time: now,
+				Data: []*v1alpha.KeyValue{{Key: "exit_code", Value: strconv.Itoa(exitCode)}},
+			})
+		}
+	}
+
+	// Pods that are gone have been garbage collected.
+	for _, id := range sortedPodIDs(oldPods) {
+		if _, ok := newPods[id]; !ok {
+			events = append(events, &v1alpha.Event{Type: v1alpha.EventType_EVENT_TYPE_POD_GARBAGE_COLLECTED, Id: id, From: id, Time: now})
+		}
+	}
+
+	return events
+}
+
+// diffImageSnapshots returns the image imported and removed events that
+// lead from the old snapshot to the new one.
+func diffImageSnapshots(oldImages, newImages imageSnapshot, now int64) []*v1alpha.Event {
+	var events []*v1alpha.Event
+
+	for _, id := range sortedImageIDs(newImages) {
+		if _, ok := oldImages[id]; !ok {
+			events = append(events, &v1alpha.Event{Type: v1alpha.EventType_EVENT_TYPE_IMAGE_IMPORTED, Id: id, From: newImages[id], Time: now})
+		}
+	}
+	for _, id := range sortedImageIDs(oldImages) {
+		if _, ok := newImages[id]; !ok {
+			events = append(events, &v1alpha.Event{Type: v1alpha.EventType_EVENT_TYPE_IMAGE_REMOVED, Id: id, From: oldImages[id], Time: now})
+		}
+	}
+
+	return events
+}
+
+func sortedPodIDs(pods map[string]*podSnapshot) []string {
+	var ids []string
+	for id := range pods {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func sortedImageIDs(images imageSnapshot) []string {
+	var ids []string
+	for id := range images {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// filterEvent returns true if the event doesn't satisfy the filter, which means
+// it should be filtered and not be returned.
+// It returns false if the filter is nil or the event satisfies the filter, which
+// means it should be returned.
+func filterEvent(event *v1alpha.Event, filter *v1alpha.EventFilter) bool {
+	// No filters, return directly.
+	if filter == nil {
+		return false
+	}
+
+	// Filter according to the types.
+	if len(filter.Types) > 0 {
+		foundType := false
+		for _, typ := range filter.Types {
+			if event.Type == typ {
+				foundType = true
+				break
+			}
+		}
+		if !foundType {
+			return true
+		}
+	}
+
+	// Filter according to the ids.
+	if len(filter.Ids) > 0 {
+		if !containsString(event.Id, filter.Ids, stringsEqual) {
+			return true
+		}
+	}
+
+	// Filter according to the names.
+	if len(filter.Names) > 0 {
+		if !containsString(event.From, filter.Names, stringsEqual) {
+			return true
+		}
+	}
+
+	// Filter according to the time.
+	if filter.SinceTime > 0 {
+		if event.Time < filter.SinceTime {
+			return true
+		}
+	}
+	if filter.UntilTime > 0 {
+		if event.Time > filter.UntilTime {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,130 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coreos/rkt/api/v1alpha"
+)
+
+func eventTypes(events []*v1alpha.Event) []v1alpha.EventType {
+	var types []v1alpha.EventType
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	return types
+}
+
+func TestDiffPodSnapshots(t *testing.T) {
+	tests := []struct {
+		old      map[string]*podSnapshot
+		new      map[string]*podSnapshot
+		expected []v1alpha.EventType
+	}{
+		// Nothing changed.
+		{
+			map[string]*podSnapshot{"pod-a": {state: v1alpha.PodState_POD_STATE_PREPARED}},
+			map[string]*podSnapshot{"pod-a": {state: v1alpha.PodState_POD_STATE_PREPARED}},
+			nil,
+		},
+		// New prepared pod.
+		{
+			map[string]*podSnapshot{},
+			map[string]*podSnapshot{"pod-a": {state: v1alpha.PodState_POD_STATE_PREPARED}},
+			[]v1alpha.EventType{v1alpha.EventType_EVENT_TYPE_POD_PREPARED},
+		},
+		// Pod started, with its apps.
+		{
+			map[string]*podSnapshot{"pod-a": {state: v1alpha.PodState_POD_STATE_PREPARED, apps: []string{"app-a"}}},
+			map[string]*podSnapshot{"pod-a": {state: v1alpha.PodState_POD_STATE_RUNNING, apps: []string{"app-a"}}},
+			[]v1alpha.EventType{v1alpha.EventType_EVENT_TYPE_POD_STARTED, v1alpha.EventType_EVENT_TYPE_APP_STARTED},
+		},
+		// App exited while the pod keeps running.
+		{
+			map[string]*podSnapshot{"pod-a": {state: v1alpha.PodState_POD_STATE_RUNNING, apps: []string{"app-a", "app-b"}}},
+			map[string]*podSnapshot{"pod-a": {state: v1alpha.PodState_POD_STATE_RUNNING, apps: []string{"app-a", "app-b"}, exitedApps: map[string]int{"app-b": 1}}},
+			[]v1alpha.EventType{v1alpha.EventType_EVENT_TYPE_APP_EXITED},
+		},
+		// Pod exited, the app exit was already reported.
+		{
+			map[string]*podSnapshot{"pod-a": {state: v1alpha.PodState_POD_STATE_RUNNING, apps: []string{"app-a"}, exitedApps: map[string]int{"app-a": 0}}},
+			map[string]*podSnapshot{"pod-a": {state: v1alpha.PodState_POD_STATE_EXITED, apps: []string{"app-a"}, exitedApps: map[string]int{"app-a": 0}}},
+			[]v1alpha.EventType{v1alpha.EventType_EVENT_TYPE_POD_EXITED},
+		},
+		// Pod is gone.
+		{
+			map[string]*podSnapshot{"pod-a": {state: v1alpha.PodState_POD_STATE_EXITED}},
+			map[string]*podSnapshot{},
+			[]v1alpha.EventType{v1alpha.EventType_EVENT_TYPE_POD_GARBAGE_COLLECTED},
+		},
+	}
+
+	for i, tt := range tests {
+		result := eventTypes(diffPodSnapshots(tt.old, tt.new, 0))
+		if !reflect.DeepEqual(result, tt.expected) {
+			t.Errorf("#%d: got %v, want %v", i, result, tt.expected)
+		}
+	}
+}
+
+func TestDiffImageSnapshots(t *testing.T) {
+	old := imageSnapshot{"sha512-a": "example.com/a", "sha512-b": "example.com/b"}
+	new := imageSnapshot{"sha512-b": "example.com/b", "sha512-c": "example.com/c"}
+
+	events := diffImageSnapshots(old, new, 0)
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	if events[0].Type != v1alpha.EventType_EVENT_TYPE_IMAGE_IMPORTED || events[0].Id != "sha512-c" {
+		t.Errorf("unexpected first event: %v", events[0])
+	}
+	if events[1].Type != v1alpha.EventType_EVENT_TYPE_IMAGE_REMOVED || events[1].From != "example.com/a" {
+		t.Errorf("unexpected second event: %v", events[1])
+	}
+}
+
+func TestFilterEvent(t *testing.T) {
+	event := &v1alpha.Event{
+		Type: v1alpha.EventType_EVENT_TYPE_APP_EXITED,
+		Id:   "pod-a",
+		From: "app-a",
+		Time: 100,
+	}
+
+	tests := []struct {
+		filter   *v1alpha.EventFilter
+		filtered bool
+	}{
+		{nil, false},
+		{&v1alpha.EventFilter{Types: []v1alpha.EventType{v1alpha.EventType_EVENT_TYPE_APP_EXITED}}, false},
+		{&v1alpha.EventFilter{Types: []v1alpha.EventType{v1alpha.EventType_EVENT_TYPE_POD_EXITED}}, true},
+		{&v1alpha.EventFilter{Ids: []string{"pod-b", "pod-a"}}, false},
+		{&v1alpha.EventFilter{Ids: []string{"pod-b"}}, true},
+		{&v1alpha.EventFilter{Names: []string{"app-a"}}, false},
+		{&v1alpha.EventFilter{Names: []string{"app-b"}}, true},
+		{&v1alpha.EventFilter{SinceTime: 50, UntilTime: 150}, false},
+		{&v1alpha.EventFilter{SinceTime: 150}, true},
+		{&v1alpha.EventFilter{UntilTime: 50}, true},
+	}
+
+	for i, tt := range tests {
+		result := filterEvent(event, tt.filter)
+		if result != tt.filtered {
+			t.Errorf("#%d: got %v, want %v", i, result, tt.filtered)
+		}
+	}
+}
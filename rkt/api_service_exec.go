@@ -0,0 +1,192 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"sync"
+	"syscall"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/api/v1alpha"
+	"github.com/coreos/rkt/stage0"
+)
+
+var _ v1alpha.ControlAPIServer = &v1AlphaAPIServer{}
+
+// execStreamWriter is an io.Writer that sends the written data to the
+// client of an Exec() call, either as stdout or as stderr.
+// The standard output and error of a command are copied concurrently,
+// so the writers of a same stream share a lock.
+type execStreamWriter struct {
+	server v1alpha.ControlAPI_ExecServer
+	mu     *sync.Mutex
+	stderr bool
+}
+
+func (w *execStreamWriter) Write(p []byte) (int, error) {
+	// The buffer is reused by the caller once Write returns.
+	data := make([]byte, len(p))
+	copy(data, p)
+
+	response := &v1alpha.ExecResponse{}
+	if w.stderr {
+		response.Stderr = data
+	} else {
+		response.Stdout = data
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.server.Send(response); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// getExecAppName returns the name of the app in which the command is executed.
+// If no name is requested, then the pod must contain a single app.
+func getExecAppName(p *pod, name string) (*types.ACName, error) {
+	if name != "" {
+		return types.NewACName(name)
+	}
+
+	apps, err := p.getApps()
+	if err != nil {
+		return nil, err
+	}
+	switch len(apps) {
+	case 0:
+		return nil, fmt.Errorf("pod contains zero apps")
+	case 1:
+		return &apps[0].Name, nil
+	default:
+		return nil, fmt.Errorf("pod contains multiple apps, the app name must be specified")
+	}
+}
+
+// getExitCode returns the exit code of a command from the error returned by cmd.Wait().
+func getExitCode(err error) (int, error) {
+	if err == nil {
+		return 0, nil
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			return status.ExitStatus(), nil
+		}
+	}
+	return -1, err
+}
+
+func (s *v1AlphaAPIServer) Exec(server v1alpha.ControlAPI_ExecServer) error {
+	request, err := server.Recv()
+	if err != nil {
+		return err
+	}
+	if len(request.Command) == 0 {
+		return fmt.Errorf("no command specified")
+	}
+
+	uuid, err := types.NewUUID(request.PodId)
+	if err != nil {
+		log.Printf("Invalid pod id %q: %v", request.PodId, err)
+		return err
+	}
+
+	p, err := getPod(uuid)
+	if err != nil {
+		log.Printf("Failed to get pod %q: %v", request.PodId, err)
+		return err
+	}
+	defer p.Close()
+
+	if !p.isRunning() {
+		return fmt.Errorf("pod %q isn't currently running", request.PodId)
+	}
+
+	podPID, err := p.getContainerPID1()
+	if err != nil {
+		log.Printf("Unable to determine the pid for pod %q: %v", request.PodId, err)
+		return err
+	}
+
+	appName, err := getExecAppName(p, request.AppName)
+	if err != nil {
+		return err
+	}
+
+	stage1TreeStoreID, err := p.getStage1TreeStoreID()
+	if err != nil {
+		log.Printf("Error getting stage1 treeStoreID for pod %q: %v", request.PodId, err)
+		return err
+	}
+	stage1RootFS := s.store.GetTreeStoreRootFS(stage1TreeStoreID)
+
+	cmd, err := stage0.EnterCommand(server.Context(), p.path(), podPID, *appName, stage1RootFS, request.Command, stage0.EnterConfig{})
+	if err != nil {
+		return err
+	}
+
+	var sendLock sync.Mutex
+	cmd.Stdout = &execStreamWriter{server: server, mu: &sendLock}
+	cmd.Stderr = &execStreamWriter{server: server, mu: &sendLock, stderr: true}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		log.Printf("Failed to execute command in pod %q: %v", request.PodId, err)
+		return err
+	}
+
+	// Forward the standard input until the client closes it or the stream ends.
+	go func(req *v1alpha.ExecRequest) {
+		defer stdin.Close()
+		for {
+			if len(req.Stdin) > 0 {
+				if _, err := stdin.Write(req.Stdin); err != nil {
+					return
+				}
+			}
+			if req.CloseStdin {
+				return
+			}
+			var err error
+			if req, err = server.Recv(); err != nil {
+				if err != io.EOF {
+					log.Printf("Failed to receive exec request: %v", err)
+				}
+				return
+			}
+		}
+	}(request)
+
+	exitCode, err := getExitCode(cmd.Wait())
+	if err != nil {
+		log.Printf("Failed to wait for command in pod %q: %v", request.PodId, err)
+		return err
+	}
+
+	sendLock.Lock()
+	defer sendLock.Unlock()
+	return server.Send(&v1alpha.ExecResponse{
+		Exited:   true,
+		ExitCode: int32(exitCode),
+	})
+}
@@ -0,0 +1,42 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestGetExitCode(t *testing.T) {
+	tests := []struct {
+		cmd      *exec.Cmd
+		exitCode int
+		err      bool
+	}{
+		{exec.Command("/bin/sh", "-c", "exit 0"), 0, false},
+		{exec.Command("/bin/sh", "-c", "exit 3"), 3, false},
+		{exec.Command("/non/existent/command"), -1, true},
+	}
+
+	for i, tt := range tests {
+		exitCode, err := getExitCode(tt.cmd.Run())
+		if (err != nil) != tt.err {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+		}
+		if exitCode != tt.exitCode {
+			t.Errorf("#%d: got exit code %d, want %d", i, exitCode, tt.exitCode)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/api/v1alpha"
+	"github.com/coreos/rkt/common"
+)
+
+const (
+	overlayJournalDirTemplate = "overlay/%s/upper/var/log/journal"
+	regularJournalDir         = "stage1/rootfs/var/log/journal"
+
+	// logsBatchSize is the maximum number of log lines sent in a single response.
+	logsBatchSize = 100
+	// logsFlushInterval is how long log lines are buffered before being sent.
+	logsFlushInterval = 100 * time.Millisecond
+)
+
+// journalctlArgs returns the journalctl arguments that read the logs
+// requested in the GetLogsRequest from the given journal directory.
+func journalctlArgs(request *v1alpha.GetLogsRequest, journalDir string) []string {
+	args := []string{
+		"--directory", journalDir,
+		"--output", "short-iso",
+		"--no-pager",
+	}
+	if request.AppName != "" {
+		// see ServiceUnitName in stage1/init
+		args = append(args, "--unit", request.AppName+".service")
+	}
+	if request.Lines > 0 {
+		args = append(args, "--lines", strconv.Itoa(int(request.Lines)))
+	}
+	if request.Follow {
+		args = append(args, "--follow")
+	}
+	if request.SinceTime > 0 {
+		args = append(args, "--since", time.Unix(request.SinceTime, 0).Format("2006-01-02 15:04:05"))
+	}
+	if request.UntilTime > 0 {
+		args = append(args, "--until", time.Unix(request.UntilTime, 0).Format("2006-01-02 15:04:05"))
+	}
+	return args
+}
+
+func (s *v1AlphaAPIServer) GetLogs(request *v1alpha.GetLogsRequest, server v1alpha.PublicAPI_GetLogsServer) error {
+	uuid, err := types.NewUUID(request.PodId)
+	if err != nil {
+		log.Printf("Invalid pod id %q: %v", request.PodId, err)
+		return err
+	}
+
+	p, err := getPod(uuid)
+	if err != nil {
+		log.Printf("Failed to get pod %q: %v", request.PodId, err)
+		return err
+	}
+	defer p.Close()
+
+	pm, err := p.getManifest()
+	if err != nil {
+		log.Printf("Failed to get the manifest of pod %q: %v", request.PodId, err)
+		return err
+	}
+
+	if request.AppName != "" {
+		appName, err := types.NewACName(request.AppName)
+		if err != nil {
+			return err
+		}
+		if pm.Apps.Get(*appName) == nil {
+			return fmt.Errorf("app %q not found in pod %q", request.AppName, request.PodId)
+		}
+	}
+
+	// the output of the apps run with --log-files is in their log files
+	if _, ok := pm.Annotations.Get(common.LogFilesMaxSizeAnnotation); ok {
+		return getLogFiles(request, p, server)
+	}
+
+	journalDir, err := p.getJournalDir()
+	if err != nil {
+		log.Printf("Failed to get journal directory for pod %q: %v", request.PodId, err)
+		return err
+	}
+
+	journalctl, err := exec.LookPath("journalctl")
+	if err != nil {
+		return fmt.Errorf("cannot find journalctl: %v", err)
+	}
+
+	cmd := exec.Command(journalctl, journalctlArgs(request, filepath.Join(p.path(), journalDir))...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		log.Printf("Failed to start journalctl: %v", err)
+		return err
+	}
+	defer cmd.Wait()
+
+	lines := make(chan string)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(logsFlushInterval)
+	defer ticker.Stop()
+
+	var batch []string
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := server.Send(&v1alpha.GetLogsResponse{Lines: batch})
+		batch = nil
+		return err
+	}
+
+	for {
+		select {
+		case <-server.Context().Done():
+			cmd.Process.Kill()
+			return nil
+		case <-ticker.C:
+			if err := flush(); err != nil {
+				cmd.Process.Kill()
+				return err
+			}
+		case line, ok := <-lines:
+			if !ok {
+				return flush()
+			}
+			batch = append(batch, line)
+			if len(batch) >= logsBatchSize {
+				if err := flush(); err != nil {
+					cmd.Process.Kill()
+					return err
+				}
+			}
+		}
+	}
+}
+
+// logFilesLines returns the lines of the log files in logsDir requested in
+// the GetLogsRequest: the lines of its app, or of all the apps tagged with
+// the name of their app, within its time range.
+func logFilesLines(request *v1alpha.GetLogsRequest, logsDir string) ([]string, error) {
+	apps, err := logFilesApps(logsDir)
+	if err != nil {
+		return nil, err
+	}
+	if request.AppName != "" {
+		var found []string
+		for _, app := range apps {
+			if app == request.AppName {
+				found = append(found, app)
+			}
+		}
+		apps = found
+	}
+
+	lines, err := mergeLogFiles(logsDir, apps, request.AppName == "")
+	if err != nil {
+		return nil, err
+	}
+
+	if request.SinceTime > 0 || request.UntilTime > 0 {
+		var inRange []string
+		for _, l := range lines {
+			t, err := time.Parse(time.RFC3339Nano, logTimestamp(l))
+			if err != nil {
+				continue
+			}
+			if request.SinceTime > 0 && t.Before(time.Unix(request.SinceTime, 0)) {
+				continue
+			}
+			if request.UntilTime > 0 && t.After(time.Unix(request.UntilTime, 0)) {
+				continue
+			}
+			inRange = append(inRange, l)
+		}
+		lines = inRange
+	}
+
+	if request.Lines > 0 && len(lines) > int(request.Lines) {
+		lines = lines[len(lines)-int(request.Lines):]
+	}
+	return lines, nil
+}
+
+// getLogFiles sends the lines of the log files of the pod requested in the
+// GetLogsRequest, in batches of logsBatchSize lines.
+func getLogFiles(request *v1alpha.GetLogsRequest, p *pod, server v1alpha.PublicAPI_GetLogsServer) error {
+	if request.Follow {
+		return fmt.Errorf("the log files of pod %q cannot be followed", request.PodId)
+	}
+
+	logsDir, err := p.getLogsDir()
+	if err != nil {
+		log.Printf("Failed to get log files directory for pod %q: %v", request.PodId, err)
+		return err
+	}
+
+	lines, err := logFilesLines(request, filepath.Join(p.path(), logsDir))
+	if err != nil {
+		log.Printf("Failed to read the log files of pod %q: %v", request.PodId, err)
+		return err
+	}
+
+	for len(lines) > 0 {
+		n := logsBatchSize
+		if len(lines) < n {
+			n = len(lines)
+		}
+		if err := server.Send(&v1alpha.GetLogsResponse{Lines: lines[:n]}); err != nil {
+			return err
+		}
+		lines = lines[n:]
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/coreos/rkt/api/v1alpha"
+)
+
+func TestJournalctlArgs(t *testing.T) {
+	base := []string{"--directory", "/journal", "--output", "short-iso", "--no-pager"}
+
+	tests := []struct {
+		request  *v1alpha.GetLogsRequest
+		expected []string
+	}{
+		{
+			&v1alpha.GetLogsRequest{},
+			base,
+		},
+		{
+			&v1alpha.GetLogsRequest{AppName: "redis", Lines: 10},
+			append(base, "--unit", "redis.service", "--lines", "10"),
+		},
+		{
+			&v1alpha.GetLogsRequest{Follow: true},
+			append(base, "--follow"),
+		},
+	}
+
+	for i, tt := range tests {
+		result := journalctlArgs(tt.request, "/journal")
+		if !reflect.DeepEqual(result, tt.expected) {
+			t.Errorf("#%d: got %v, want %v", i, result, tt.expected)
+		}
+	}
+}
+
+func TestLogFilesLines(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rkt-logs-test")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, content := range map[string]string{
+		"web/output.log":   "2016-01-02T15:04:07.000000000Z stdout y\n",
+		"web/output.log.1": "2016-01-02T15:04:05.000000000Z stdout z\n",
+		"db/output.log":    "2016-01-02T15:04:06.000000000Z stderr x\n2016-01-02T15:04:08.000000000Z stdout w\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("error creating %s: %v", filepath.Dir(path), err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("error writing %s: %v", name, err)
+		}
+	}
+	second := func(s int) int64 {
+		return time.Date(2016, 1, 2, 15, 4, s, 0, time.UTC).Unix()
+	}
+
+	tests := []struct {
+		request  *v1alpha.GetLogsRequest
+		expected []string
+	}{
+		{
+			&v1alpha.GetLogsRequest{},
+			[]string{
+				"2016-01-02T15:04:05.000000000Z web stdout z",
+				"2016-01-02T15:04:06.000000000Z db stderr x",
+				"2016-01-02T15:04:07.000000000Z web stdout y",
+				"2016-01-02T15:04:08.000000000Z db stdout w",
+			},
+		},
+		{
+			&v1alpha.GetLogsRequest{AppName: "web"},
+			[]string{
+				"2016-01-02T15:04:05.000000000Z stdout z",
+				"2016-01-02T15:04:07.000000000Z stdout y",
+			},
+		},
+		{
+			&v1alpha.GetLogsRequest{Lines: 1},
+			[]string{
+				"2016-01-02T15:04:08.000000000Z db stdout w",
+			},
+		},
+		{
+			&v1alpha.GetLogsRequest{SinceTime: second(6), UntilTime: second(7)},
+			[]string{
+				"2016-01-02T15:04:06.000000000Z db stderr x",
+				"2016-01-02T15:04:07.000000000Z web stdout y",
+			},
+		},
+	}
+
+	for i, tt := range tests {
+		result, err := logFilesLines(tt.request, dir)
+		if err != nil {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(result, tt.expected) {
+			t.Errorf("#%d: got %q, want %q", i, result, tt.expected)
+		}
+	}
+}
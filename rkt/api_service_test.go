@@ -188,6 +188,101 @@ func TestFilterPod(t *testing.T) {
 			},
 			false,
 		},
+		// Has all the user labels.
+		{
+			&v1alpha.Pod{},
+			&schema.PodManifest{
+				Annotations: []types.Annotation{
+					{"coreos.com/rkt/user-label/env", "prod"},
+					{"coreos.com/rkt/user-label/tier", "web"},
+				},
+			},
+			&v1alpha.PodFilter{
+				UserLabels: []*v1alpha.KeyValue{{"env", "prod"}, {"tier", "web"}},
+			},
+			false,
+		},
+		// Misses one of the user labels.
+		{
+			&v1alpha.Pod{},
+			&schema.PodManifest{
+				Annotations: []types.Annotation{{"coreos.com/rkt/user-label/env", "prod"}},
+			},
+			&v1alpha.PodFilter{
+				UserLabels: []*v1alpha.KeyValue{{"env", "prod"}, {"tier", "web"}},
+			},
+			true,
+		},
+		// A user label is not a user annotation.
+		{
+			&v1alpha.Pod{},
+			&schema.PodManifest{
+				Annotations: []types.Annotation{{"coreos.com/rkt/user-label/env", "prod"}},
+			},
+			&v1alpha.PodFilter{
+				UserAnnotations: []*v1alpha.KeyValue{{"env", "prod"}},
+			},
+			true,
+		},
+		// Has an image with one of the digests.
+		{
+			&v1alpha.Pod{
+				Apps: []*v1alpha.App{{Image: &v1alpha.Image{Id: "sha512-6d2c1f8e0a"}}},
+			},
+			&schema.PodManifest{},
+			&v1alpha.PodFilter{
+				ImageDigests: []string{"sha512-6d2c"},
+			},
+			false,
+		},
+		// Doesn't have an image with any of the digests.
+		{
+			&v1alpha.Pod{
+				Apps: []*v1alpha.App{{Image: &v1alpha.Image{Id: "sha512-6d2c1f8e0a"}}},
+			},
+			&schema.PodManifest{},
+			&v1alpha.PodFilter{
+				ImageDigests: []string{"1f8e"},
+			},
+			true,
+		},
+		// Satisfies 'created after' and 'created before'.
+		{
+			&v1alpha.Pod{CreatedAt: 1024},
+			&schema.PodManifest{},
+			&v1alpha.PodFilter{
+				CreatedAfter:  1023,
+				CreatedBefore: 1025,
+			},
+			false,
+		},
+		// Doesn't satisfy 'created after'.
+		{
+			&v1alpha.Pod{CreatedAt: 1024},
+			&schema.PodManifest{},
+			&v1alpha.PodFilter{
+				CreatedAfter: 1024,
+			},
+			true,
+		},
+		// Doesn't satisfy 'created before'.
+		{
+			&v1alpha.Pod{CreatedAt: 1024},
+			&schema.PodManifest{},
+			&v1alpha.PodFilter{
+				CreatedBefore: 1024,
+			},
+			true,
+		},
+		// Unknown creation time doesn't satisfy 'created before'.
+		{
+			&v1alpha.Pod{},
+			&schema.PodManifest{},
+			&v1alpha.PodFilter{
+				CreatedBefore: 1024,
+			},
+			true,
+		},
 	}
 
 	for i, tt := range tests {
@@ -419,6 +514,24 @@ func TestFilterImage(t *testing.T) {
 			},
 			true,
 		},
+		// Has one of the digests, abbreviated.
+		{
+			&v1alpha.Image{Id: "sha512-6d2c1f8e0a"},
+			&schema.ImageManifest{},
+			&v1alpha.ImageFilter{
+				Digests: []string{"sha512-0000", "6d2c1f8e"},
+			},
+			false,
+		},
+		// Doesn't have any of the digests.
+		{
+			&v1alpha.Image{Id: "sha512-6d2c1f8e0a"},
+			&schema.ImageManifest{},
+			&v1alpha.ImageFilter{
+				Digests: []string{"sha256-6d2c1f8e", "0a"},
+			},
+			true,
+		},
 		// Doesn't satisfy any filter conditions.
 		{
 			&v1alpha.Image{
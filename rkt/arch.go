@@ -0,0 +1,75 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/discovery"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/pflag"
+)
+
+var (
+	flagArch     string
+	flagQemuUser bool
+)
+
+// addArchFlag adds the flag selecting the arch of the images discovered and
+// looked up in the store by name.
+func addArchFlag(flags *pflag.FlagSet) {
+	flags.StringVar(&flagArch, "arch", "", "arch label of the images to discover and find in the store, for example aarch64 (default the arch of the host)")
+}
+
+// addQemuUserFlag adds the flag allowing the pods to run images built for
+// another arch.
+func addQemuUserFlag(flags *pflag.FlagSet) {
+	flags.BoolVar(&flagQemuUser, "qemu-user", false, "run the images built for another arch with the qemu-user-static emulator of the host, registered in binfmt_misc")
+}
+
+// imageArch returns the arch label of the images to fetch.
+func imageArch() string {
+	if flagArch != "" {
+		return flagArch
+	}
+	return defaultArch
+}
+
+// defaultArchFallbacks are, for an arch, the archs of the images which run on
+// it too, tried in order when discovery finds no image for it. They can be
+// overridden in the archFallback configuration.
+var defaultArchFallbacks = map[string][]string{
+	"aarch64": []string{"armv7l", "armv6l"},
+	"armv7l":  []string{"armv6l"},
+}
+
+// getArchFallbacks returns the archs of the images to try when there is none
+// for arch, the configured ones taking precedence over the default ones.
+func getArchFallbacks(arch string, configured map[string][]string) []string {
+	if fallbacks, ok := configured[arch]; ok {
+		return fallbacks
+	}
+	return defaultArchFallbacks[arch]
+}
+
+// hasArchLabel returns whether the arch label of the image name is given
+// explicitly, in which case no fallback is tried.
+func hasArchLabel(img string) bool {
+	app, err := discovery.NewAppFromString(img)
+	if err != nil {
+		return false
+	}
+	_, ok := app.Labels["arch"]
+	return ok
+}
@@ -0,0 +1,311 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/cobra"
+	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/common/cgroup"
+	"github.com/coreos/rkt/store"
+)
+
+var (
+	cmdCheckHost = &cobra.Command{
+		Use:   "check-host",
+		Short: "Check that the host can run pods",
+		Long: `Checks the kernel features, the store and the configuration used by rkt, and
+prints how to fix the problems found. The exit status is 1 if a check failed.`,
+		Run: runWrapper(runCheckHost),
+	}
+	flagCheckHostHashTrees bool
+)
+
+func init() {
+	cmdRkt.AddCommand(cmdCheckHost)
+	cmdCheckHost.Flags().BoolVar(&flagCheckHostHashTrees, "hash-trees", false, "hash the rendered images of the store to detect corrupted files, reading all of them")
+}
+
+// hostCheckStatus is the result of a host check
+type hostCheckStatus string
+
+const (
+	hostCheckOK   hostCheckStatus = "ok"
+	hostCheckWarn hostCheckStatus = "warning"
+	hostCheckFail hostCheckStatus = "failed"
+)
+
+// hostCheckResult is the result of a host check, with what to do to fix the
+// problem found if it did not pass.
+type hostCheckResult struct {
+	status hostCheckStatus
+	detail string
+	hint   string
+}
+
+func checkOK() hostCheckResult {
+	return hostCheckResult{status: hostCheckOK}
+}
+
+func checkWarn(detail, hint string) hostCheckResult {
+	return hostCheckResult{status: hostCheckWarn, detail: detail, hint: hint}
+}
+
+func checkFail(detail, hint string) hostCheckResult {
+	return hostCheckResult{status: hostCheckFail, detail: detail, hint: hint}
+}
+
+// hostCheck is a check of a feature of the host needed by rkt
+type hostCheck struct {
+	name string
+	run  func() hostCheckResult
+}
+
+// hostChecks are the checks run by rkt check-host, in order. The features
+// only needed by some options are warnings rather than failures.
+var hostChecks = []hostCheck{
+	{"namespaces", checkNamespaces},
+	{"cgroups", checkCgroups},
+	{"overlay filesystem", checkOverlay},
+	{"user namespaces", checkUserNS},
+	{"iptables", checkIptables},
+	{"configuration", checkConfig},
+	{"store", checkStore},
+}
+
+func runCheckHost(cmd *cobra.Command, args []string) (exit int) {
+	if len(args) != 0 {
+		cmd.Usage()
+		return 1
+	}
+
+	if failed := runHostChecks(hostChecks, os.Stdout); failed > 0 {
+		stderr("check-host: %d check(s) failed", failed)
+		return 1
+	}
+	return 0
+}
+
+// runHostChecks runs the checks and prints their results to w. It returns
+// the number of checks which failed.
+func runHostChecks(checks []hostCheck, w io.Writer) int {
+	failed := 0
+	for _, c := range checks {
+		r := c.run()
+		if r.status == hostCheckOK {
+			fmt.Fprintf(w, "%s: %s\n", c.name, r.status)
+			continue
+		}
+		if r.status == hostCheckFail {
+			failed++
+		}
+		fmt.Fprintf(w, "%s: %s: %s\n", c.name, r.status, r.detail)
+		if r.hint != "" {
+			fmt.Fprintf(w, "  %s\n", r.hint)
+		}
+	}
+	return failed
+}
+
+// podNamespaces are the namespaces created by the stage1 for a pod
+var podNamespaces = []string{"mnt", "uts", "ipc", "net", "pid"}
+
+func checkNamespaces() hostCheckResult {
+	var missing []string
+	for _, ns := range podNamespaces {
+		if _, err := os.Stat(filepath.Join("/proc/self/ns", ns)); err != nil {
+			missing = append(missing, ns)
+		}
+	}
+	if len(missing) > 0 {
+		return checkFail(fmt.Sprintf("the kernel does not support the %s namespaces", strings.Join(missing, ", ")),
+			"enable CONFIG_NAMESPACES and the namespaces options of the kernel")
+	}
+	return checkOK()
+}
+
+func checkCgroups() hostCheckResult {
+	if _, err := os.Stat("/sys/fs/cgroup"); err != nil {
+		return checkFail("/sys/fs/cgroup is not mounted",
+			"mount the cgroup hierarchies in /sys/fs/cgroup, as systemd does")
+	}
+	if _, err := cgroup.GetEnabledCgroups(); err != nil {
+		return checkFail(fmt.Sprintf("cannot get the cgroup controllers: %v", err),
+			"enable CONFIG_CGROUPS in the kernel")
+	}
+	var missing []string
+	for _, c := range []string{"cpu", "memory"} {
+		if !cgroup.IsIsolatorSupported(c) {
+			missing = append(missing, c)
+		}
+	}
+	if len(missing) > 0 {
+		return checkWarn(fmt.Sprintf("the %s cgroup controllers are not available, their resource isolators cannot be used", strings.Join(missing, ", ")),
+			"enable the controllers in the kernel, for the memory one with the cgroup_enable=memory boot option on some distributions")
+	}
+	return checkOK()
+}
+
+func checkOverlay() hostCheckResult {
+	if err := common.CheckOverlay(globalFlags.Dir); err != nil {
+		return checkWarn(err.Error(),
+			"the images are copied in the pods instead, which is slower; enable CONFIG_OVERLAY_FS or move the data directory with --dir")
+	}
+	return checkOK()
+}
+
+func checkUserNS() hostCheckResult {
+	if !common.SupportsUserNS() {
+		return checkWarn("the kernel does not support user namespaces, --private-users cannot be used",
+			"enable CONFIG_USER_NS in the kernel")
+	}
+	if v, ok := readSysctl("/proc/sys/user/max_user_namespaces"); ok && v == 0 {
+		return checkWarn("user namespaces are disabled by the user.max_user_namespaces sysctl",
+			"set it with: sysctl -w user.max_user_namespaces=15000")
+	}
+	return checkOK()
+}
+
+// readSysctl reads the integer value of a sysctl file. It returns false if
+// the file does not exist or is not an integer.
+func readSysctl(path string) (int64, bool) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	v, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
+
+func checkIptables() hostCheckResult {
+	if _, err := exec.LookPath("iptables"); err != nil {
+		return checkWarn("iptables is not installed, the pods of the default network cannot reach the outside nor forward ports",
+			"install iptables, or use --net=host")
+	}
+	return checkOK()
+}
+
+func checkConfig() hostCheckResult {
+	cfg, err := getConfig()
+	if err != nil {
+		return checkFail(err.Error(),
+			fmt.Sprintf("fix the configuration files in %s and %s", globalFlags.SystemConfigDir, globalFlags.LocalConfigDir))
+	}
+
+	var problems []string
+	if img := cfg.Defaults.Stage1Image; filepath.IsAbs(img) {
+		if _, err := os.Stat(img); err != nil {
+			problems = append(problems, fmt.Sprintf("the default stage1 image %q cannot be read: %v", img, err))
+		}
+	}
+	for _, c := range []struct {
+		name    string
+		command []string
+	}{
+		{"the scan command", cfg.ScanCommand},
+		{"the onPrepare hook", cfg.Hooks.OnPrepare},
+		{"the onRun hook", cfg.Hooks.OnRun},
+		{"the onExit hook", cfg.Hooks.OnExit},
+		{"the onGC hook", cfg.Hooks.OnGC},
+	} {
+		if len(c.command) == 0 {
+			continue
+		}
+		if _, err := exec.LookPath(c.command[0]); err != nil {
+			problems = append(problems, fmt.Sprintf("%s %q cannot be run: %v", c.name, c.command[0], err))
+		}
+	}
+	if len(problems) > 0 {
+		return checkFail(strings.Join(problems, "; "),
+			"fix the paths in the configuration, see rkt config --json for the files they come from")
+	}
+	return checkOK()
+}
+
+// checkStore checks the store without opening it, which would create or
+// migrate it: the database must be readable and the rendered images fully
+// rendered. They are also hashed with --hash-trees.
+func checkStore() hostCheckResult {
+	casDir := filepath.Join(globalFlags.Dir, "cas")
+	if _, err := os.Stat(casDir); os.IsNotExist(err) {
+		// created by the first image fetched
+		return checkOK()
+	} else if err != nil {
+		return checkFail(fmt.Sprintf("cannot access the store: %v", err),
+			fmt.Sprintf("check the permissions of %s, run rkt as root", globalFlags.Dir))
+	}
+
+	db, err := os.Open(filepath.Join(casDir, "db", store.DbFilename))
+	if err != nil && !os.IsNotExist(err) {
+		return checkFail(fmt.Sprintf("cannot read the store database: %v", err),
+			fmt.Sprintf("check the permissions of %s, run rkt as root", globalFlags.Dir))
+	}
+	if db != nil {
+		db.Close()
+	}
+
+	ids, err := listTreeStoreIDs(filepath.Join(casDir, "tree"))
+	if err != nil {
+		return checkFail(fmt.Sprintf("cannot list the tree stores: %v", err),
+			fmt.Sprintf("check the permissions of %s", globalFlags.Dir))
+	}
+	var broken []string
+	for _, id := range ids {
+		_, err := os.Stat(filepath.Join(casDir, "tree", id, "rendered"))
+		if err == nil && flagCheckHostHashTrees {
+			err = store.CheckTree(globalFlags.Dir, id)
+		}
+		if err != nil {
+			broken = append(broken, id)
+		}
+	}
+	if len(broken) > 0 {
+		return checkWarn(fmt.Sprintf("%d rendered image(s) are corrupted: %s", len(broken), strings.Join(broken, ", ")),
+			"they are rendered again by the next pods using them, or with rkt image prerender")
+	}
+	return checkOK()
+}
+
+// listTreeStoreIDs returns the ids of the rendered images in the tree store
+// directory dir, none if it does not exist.
+func listTreeStoreIDs(dir string) ([]string, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, fi := range fis {
+		if fi.IsDir() {
+			ids = append(ids, fi.Name())
+		}
+	}
+	return ids, nil
+}
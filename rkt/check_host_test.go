@@ -0,0 +1,105 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunHostChecks(t *testing.T) {
+	tests := []struct {
+		checks []hostCheck
+		failed int
+		output string
+	}{
+		{
+			checks: []hostCheck{
+				{"a", checkOK},
+			},
+			failed: 0,
+			output: "a: ok\n",
+		},
+		{
+			checks: []hostCheck{
+				{"a", checkOK},
+				{"b", func() hostCheckResult { return checkWarn("b is missing", "install b") }},
+			},
+			failed: 0,
+			output: "a: ok\nb: warning: b is missing\n  install b\n",
+		},
+		{
+			checks: []hostCheck{
+				{"a", func() hostCheckResult { return checkFail("a is broken", "") }},
+				{"b", func() hostCheckResult { return checkFail("b is broken", "fix b") }},
+			},
+			failed: 2,
+			output: "a: failed: a is broken\nb: failed: b is broken\n  fix b\n",
+		},
+	}
+
+	for i, tt := range tests {
+		var out bytes.Buffer
+		failed := runHostChecks(tt.checks, &out)
+		if failed != tt.failed {
+			t.Errorf("#%d: expected %d failed checks, got %d", i, tt.failed, failed)
+		}
+		if out.String() != tt.output {
+			t.Errorf("#%d: expected output %q, got %q", i, tt.output, out.String())
+		}
+	}
+}
+
+func TestCheckStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rkt-check-host")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	oldDir := globalFlags.Dir
+	defer func() { globalFlags.Dir = oldDir }()
+	globalFlags.Dir = dir
+
+	// the store is not created
+	if r := checkStore(); r.status != hostCheckOK {
+		t.Errorf("expected %s without store, got %s: %s", hostCheckOK, r.status, r.detail)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "cas")); !os.IsNotExist(err) {
+		t.Errorf("the store was created: %v", err)
+	}
+
+	// a rendered image and a partially rendered one
+	tree := filepath.Join(dir, "cas", "tree")
+	for _, id := range []string{"deps-rendered", "deps-partial"} {
+		if err := os.MkdirAll(filepath.Join(tree, id), 0755); err != nil {
+			t.Fatalf("error creating tree store: %v", err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(tree, "deps-rendered", "rendered"), nil, 0644); err != nil {
+		t.Fatalf("error writing rendered file: %v", err)
+	}
+	r := checkStore()
+	if r.status != hostCheckWarn || r.detail != "1 rendered image(s) are corrupted: deps-partial" {
+		t.Errorf("expected a warning for deps-partial, got %s: %s", r.status, r.detail)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "cas", "db")); !os.IsNotExist(err) {
+		t.Errorf("the store database was created: %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/cobra"
+	"github.com/coreos/rkt/stage0"
+)
+
+var (
+	cmdCheckpoint = &cobra.Command{
+		Use:   "checkpoint [--leave-running] UUID",
+		Short: "Checkpoint a running pod with CRIU (experimental)",
+		Long:  `The processes of the pod are dumped in its directory and the pod exits, unless --leave-running is given. It can be restored with "rkt restore".`,
+		Run:   runWrapper(runCheckpoint),
+	}
+	cmdRestore = &cobra.Command{
+		Use:   "restore UUID",
+		Short: "Restore a checkpointed pod with CRIU (experimental)",
+		Run:   runWrapper(runRestore),
+	}
+	flagLeaveRunning bool
+)
+
+func init() {
+	cmdRkt.AddCommand(cmdCheckpoint)
+	cmdRkt.AddCommand(cmdRestore)
+	cmdCheckpoint.Flags().BoolVar(&flagLeaveRunning, "leave-running", false, "keep the pod running after the checkpoint")
+}
+
+// checkCheckpointSupported returns an error if the pod cannot be
+// checkpointed: the processes of the kvm flavor are in a virtual machine, and
+// CRIU cannot dump the network namespaces connected to the host.
+func checkCheckpointSupported(p *pod) error {
+	flavor, err := os.Readlink(filepath.Join(p.path(), "flavor"))
+	if err != nil {
+		return fmt.Errorf("cannot get the stage1 flavor: %v", err)
+	}
+	if flavor == "kvm" {
+		return fmt.Errorf("the kvm stage1 flavor is not supported")
+	}
+	if len(p.nets) > 0 {
+		return fmt.Errorf("pods with contained networking are not supported, use --net=host or --net=none")
+	}
+	return nil
+}
+
+func runCheckpoint(cmd *cobra.Command, args []string) (exit int) {
+	if len(args) != 1 {
+		cmd.Usage()
+		return 1
+	}
+
+	p, err := getPodFromUUIDString(args[0])
+	if err != nil {
+		stderr("checkpoint: problem retrieving pod: %v", err)
+		return 1
+	}
+	defer p.Close()
+
+	if !p.isRunning() {
+		stderr("checkpoint: pod %q isn't currently running", p.uuid)
+		return 1
+	}
+	if p.isPaused() {
+		stderr("checkpoint: pod %q is paused", p.uuid)
+		return 1
+	}
+	if err := checkCheckpointSupported(p); err != nil {
+		stderr("checkpoint: cannot checkpoint pod %q: %v", p.uuid, err)
+		return 1
+	}
+
+	podPID, err := p.getContainerPID1()
+	if err != nil {
+		stderr("checkpoint: unable to determine the pid for pod %q: %v", p.uuid, err)
+		return 1
+	}
+
+	if err := stage0.Checkpoint(p.path(), podPID, flagLeaveRunning, globalFlags.Debug); err != nil {
+		stderr("checkpoint: %v", err)
+		return 1
+	}
+
+	stdout("Checkpointed pod %q in %s", p.uuid, stage0.CheckpointPath(p.path()))
+	return 0
+}
+
+func runRestore(cmd *cobra.Command, args []string) (exit int) {
+	if len(args) != 1 {
+		cmd.Usage()
+		return 1
+	}
+
+	p, err := getPodFromUUIDString(args[0])
+	if err != nil {
+		stderr("restore: problem retrieving pod: %v", err)
+		return 1
+	}
+	defer p.Close()
+
+	// the exited pods are only garbage collected after a grace period
+	if !p.isExited || p.isExitedGarbage {
+		stderr("restore: pod %q is not exited", p.uuid)
+		return 1
+	}
+
+	if err := p.TryExclusiveLock(); err != nil {
+		stderr("restore: cannot lock pod %q: %v", p.uuid, err)
+		return 1
+	}
+
+	lfd, err := p.Fd()
+	if err != nil {
+		stderr("restore: unable to get lock fd: %v", err)
+		return 1
+	}
+
+	if err := stage0.Restore(p.path(), lfd, globalFlags.Debug); err != nil {
+		stderr("restore: %v", err)
+		return 1
+	}
+	// not reached when stage0.Restore execs criu
+	return 0
+}
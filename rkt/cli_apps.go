@@ -19,10 +19,16 @@ package main
 import (
 	"fmt"
 	"net/url"
+	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
+	"github.com/coreos/rkt/common"
 	"github.com/coreos/rkt/common/apps"
+	"github.com/coreos/rkt/common/iolimit"
+	"github.com/coreos/rkt/common/rlimit"
+	"github.com/coreos/rkt/common/volplugin"
 
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
@@ -155,11 +161,156 @@ func (ae *appExec) Set(s string) error {
 	return nil
 }
 
-// appMount is for --mount flags in the form of: --mount volume=VOLNAME,target=PATH
+// appReadOnlyRootFS is for aci --readonly-rootfs
+type appReadOnlyRootFS apps.Apps
+
+func (ar *appReadOnlyRootFS) Set(s string) error {
+	app := (*apps.Apps)(ar).Last()
+	if app == nil {
+		return fmt.Errorf("--readonly-rootfs must follow an image")
+	}
+	ro, err := strconv.ParseBool(s)
+	if err != nil {
+		return fmt.Errorf("invalid value in --readonly-rootfs flag %q: %v", s, err)
+	}
+	app.ReadOnlyRootFS = &ro
+
+	return nil
+}
+
+func (ar *appReadOnlyRootFS) String() string {
+	app := (*apps.Apps)(ar).Last()
+	if app == nil || app.ReadOnlyRootFS == nil {
+		return "false"
+	}
+	return strconv.FormatBool(*app.ReadOnlyRootFS)
+}
+
+func (ar *appReadOnlyRootFS) Type() string {
+	return "appReadOnlyRootFS"
+}
+
+// appSeccomp is for aci --seccomp
+type appSeccomp apps.Apps
+
+func (as *appSeccomp) Set(s string) error {
+	app := (*apps.Apps)(as).Last()
+	if app == nil {
+		return fmt.Errorf("--seccomp must follow an image")
+	}
+	if app.SeccompProfile != "" {
+		return fmt.Errorf("--seccomp specified multiple times for the same image")
+	}
+	app.SeccompProfile = s
+
+	return nil
+}
+
+func (as *appSeccomp) String() string {
+	app := (*apps.Apps)(as).Last()
+	if app == nil {
+		return ""
+	}
+	return app.SeccompProfile
+}
+
+func (as *appSeccomp) Type() string {
+	return "appSeccomp"
+}
+
+// appAppArmor is for aci --apparmor
+type appAppArmor apps.Apps
+
+func (aa *appAppArmor) Set(s string) error {
+	app := (*apps.Apps)(aa).Last()
+	if app == nil {
+		return fmt.Errorf("--apparmor must follow an image")
+	}
+	if app.AppArmor != "" {
+		return fmt.Errorf("--apparmor specified multiple times for the same image")
+	}
+	if s == "" || strings.ContainsAny(s, " \t\n") {
+		return fmt.Errorf("invalid AppArmor profile name %q", s)
+	}
+	app.AppArmor = s
+
+	return nil
+}
+
+func (aa *appAppArmor) String() string {
+	app := (*apps.Apps)(aa).Last()
+	if app == nil {
+		return ""
+	}
+	return app.AppArmor
+}
+
+func (aa *appAppArmor) Type() string {
+	return "appAppArmor"
+}
+
+// appBoolOption is for the per-app boolean flags hardening the preceding
+// image, such as --no-new-privileges
+type appBoolOption struct {
+	apps  *apps.Apps
+	name  string
+	field func(*apps.App) **bool
+}
+
+func (ab *appBoolOption) Set(s string) error {
+	app := ab.apps.Last()
+	if app == nil {
+		return fmt.Errorf("--%s must follow an image", ab.name)
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return fmt.Errorf("invalid value in --%s flag %q: %v", ab.name, s, err)
+	}
+	*ab.field(app) = &b
+
+	return nil
+}
+
+func (ab *appBoolOption) String() string {
+	app := ab.apps.Last()
+	if app == nil || *ab.field(app) == nil {
+		return "false"
+	}
+	return strconv.FormatBool(**ab.field(app))
+}
+
+func (ab *appBoolOption) Type() string {
+	return "appBoolOption"
+}
+
+// addAppHardeningFlags adds the per-app flags hardening the apps.
+func addAppHardeningFlags(flags *pflag.FlagSet) {
+	for _, f := range []struct {
+		name  string
+		usage string
+		field func(*apps.App) **bool
+	}{
+		{"no-new-privileges", "prevent the processes of the preceding image from gaining privileges, e.g. with setuid binaries", func(a *apps.App) **bool { return &a.NoNewPrivileges }},
+		{"mask-proc-paths", "hide the sensitive paths of /proc from the preceding image and make the others read-only", func(a *apps.App) **bool { return &a.MaskProcPaths }},
+		{"readonly-sys", "mount /sys read-only in the preceding image", func(a *apps.App) **bool { return &a.ReadOnlySys }},
+	} {
+		flags.Var(&appBoolOption{apps: &rktApps, name: f.name, field: f.field}, f.name, f.usage)
+		flags.Lookup(f.name).NoOptDefVal = "true"
+	}
+}
+
+// addAppOneShotFlag adds the per-app flag making an app a one-shot app.
+func addAppOneShotFlag(flags *pflag.FlagSet) {
+	flags.Var(&appBoolOption{apps: &rktApps, name: "oneshot", field: func(a *apps.App) **bool { return &a.OneShot }}, "oneshot", "complete the pod when the preceding image exits successfully, stopping the apps which are not one-shot")
+	flags.Lookup("oneshot").NoOptDefVal = "true"
+}
+
+// appMount is for --mount flags in the form of: --mount volume=VOLNAME,target=PATH[,readOnly=BOOL]
 type appMount apps.Apps
 
 func (al *appMount) Set(s string) error {
 	mount := schema.Mount{}
+	var readOnly *bool // overrides the readOnly setting of the volume for this mount
 
 	// this is intentionally made similar to types.VolumeFromString()
 	// TODO(iaguis) use MakeQueryString() when appc/spec#520 is merged
@@ -181,6 +332,12 @@ func (al *appMount) Set(s string) error {
 			mount.Volume = *mv
 		case "target":
 			mount.Path = val[0]
+		case "readOnly":
+			ro, err := strconv.ParseBool(val[0])
+			if err != nil {
+				return fmt.Errorf("invalid readOnly value %q in --mount flag %q: %v", val[0], s, err)
+			}
+			readOnly = &ro
 		default:
 			return fmt.Errorf("unknown mount parameter %q", key)
 		}
@@ -189,9 +346,21 @@ func (al *appMount) Set(s string) error {
 	as := (*apps.Apps)(al)
 	if as.Count() == 0 {
 		as.Mounts = append(as.Mounts, mount)
+		if readOnly != nil {
+			if as.ReadOnlyMounts == nil {
+				as.ReadOnlyMounts = make(map[string]bool)
+			}
+			as.ReadOnlyMounts[mount.Path] = *readOnly
+		}
 	} else {
 		app := as.Last()
 		app.Mounts = append(app.Mounts, mount)
+		if readOnly != nil {
+			if app.ReadOnlyMounts == nil {
+				app.ReadOnlyMounts = make(map[string]bool)
+			}
+			app.ReadOnlyMounts[mount.Path] = *readOnly
+		}
 	}
 
 	return nil
@@ -222,16 +391,327 @@ func (al *appMount) Type() string {
 	return "appMount"
 }
 
+// appUlimit is for --ulimit flags in the form of: --ulimit RESOURCE=SOFT[:HARD]
+type appUlimit apps.Apps
+
+func (au *appUlimit) Set(s string) error {
+	name, limit, err := rlimit.Parse(s)
+	if err != nil {
+		return fmt.Errorf("invalid value in --ulimit flag: %v", err)
+	}
+
+	as := (*apps.Apps)(au)
+	if as.Count() == 0 {
+		if as.Rlimits == nil {
+			as.Rlimits = make(rlimit.Limits)
+		}
+		as.Rlimits[name] = limit
+	} else {
+		app := as.Last()
+		if app.Rlimits == nil {
+			app.Rlimits = make(rlimit.Limits)
+		}
+		app.Rlimits[name] = limit
+	}
+
+	return nil
+}
+
+func (au *appUlimit) String() string {
+	as := (*apps.Apps)(au)
+	if app := as.Last(); app != nil {
+		return app.Rlimits.String()
+	}
+	return as.Rlimits.String()
+}
+
+func (au *appUlimit) Type() string {
+	return "appUlimit"
+}
+
+// appIOLimit is for --io-limit flags in the form of:
+// --io-limit DEVICE:KEY=VALUE[,KEY=VALUE...]
+type appIOLimit apps.Apps
+
+func (al *appIOLimit) Set(s string) error {
+	device, limit, err := iolimit.Parse(s)
+	if err != nil {
+		return fmt.Errorf("invalid value in --io-limit flag: %v", err)
+	}
+
+	as := (*apps.Apps)(al)
+	limits := iolimit.Limits{device: limit}
+	if as.Count() == 0 {
+		as.IOLimits = as.IOLimits.Merge(limits)
+	} else {
+		app := as.Last()
+		app.IOLimits = app.IOLimits.Merge(limits)
+	}
+
+	return nil
+}
+
+func (al *appIOLimit) String() string {
+	as := (*apps.Apps)(al)
+	if app := as.Last(); app != nil {
+		return app.IOLimits.String()
+	}
+	return as.IOLimits.String()
+}
+
+func (al *appIOLimit) Type() string {
+	return "appIOLimit"
+}
+
+// defaultSecretsDir is the directory of the secrets in the apps, when their
+// target is not specified
+const defaultSecretsDir = "/run/secrets"
+
+// appsSecret is for --secret flags in the form
+// NAME,source=file:PATH|env:VAR[,target=PATH][,mode=MODE][,uid=UID][,gid=GID]
+type appsSecret apps.Apps
+
+func (as *appsSecret) Set(s string) error {
+	parts := strings.Split(s, ",")
+	name, err := types.NewACName(parts[0])
+	if err != nil {
+		return fmt.Errorf("invalid secret name %q in --secret flag %q: %v", parts[0], s, err)
+	}
+	sec := apps.Secret{
+		Name:   *name,
+		Target: filepath.Join(defaultSecretsDir, name.String()),
+		Mode:   0400,
+	}
+
+	for _, p := range parts[1:] {
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("invalid secret parameter %q in --secret flag %q", p, s)
+		}
+		switch kv[0] {
+		case "source":
+			switch {
+			case strings.HasPrefix(kv[1], "file:"):
+				sec.File = strings.TrimPrefix(kv[1], "file:")
+			case strings.HasPrefix(kv[1], "env:"):
+				sec.Env = strings.TrimPrefix(kv[1], "env:")
+			default:
+				return fmt.Errorf("invalid secret source %q in --secret flag %q, must be file:PATH or env:VAR", kv[1], s)
+			}
+		case "target":
+			if !filepath.IsAbs(kv[1]) {
+				return fmt.Errorf("invalid secret target %q in --secret flag %q, must be an absolute path", kv[1], s)
+			}
+			sec.Target = kv[1]
+		case "mode":
+			mode, err := strconv.ParseUint(kv[1], 8, 32)
+			if err != nil || mode&^0777 != 0 {
+				return fmt.Errorf("invalid secret mode %q in --secret flag %q", kv[1], s)
+			}
+			sec.Mode = os.FileMode(mode)
+		case "uid", "gid":
+			id, err := strconv.ParseUint(kv[1], 10, 32)
+			if err != nil {
+				return fmt.Errorf("invalid secret %s %q in --secret flag %q", kv[0], kv[1], s)
+			}
+			if kv[0] == "uid" {
+				sec.Uid = uint32(id)
+			} else {
+				sec.Gid = uint32(id)
+			}
+		default:
+			return fmt.Errorf("unknown secret parameter %q in --secret flag %q", kv[0], s)
+		}
+	}
+	if sec.File == "" && sec.Env == "" {
+		return fmt.Errorf("no source in --secret flag %q", s)
+	}
+
+	(*apps.Apps)(as).Secrets = append((*apps.Apps)(as).Secrets, sec)
+	return nil
+}
+
+func (as *appsSecret) String() string {
+	var ss []string
+	for _, sec := range (*apps.Apps)(as).Secrets {
+		ss = append(ss, sec.Name.String()+":"+sec.Target)
+	}
+	return strings.Join(ss, " ")
+}
+
+func (as *appsSecret) Type() string {
+	return "appsSecret"
+}
+
 // appsVolume is for --volume flags in the form name,kind=host,source=/tmp,readOnly=true (defined by appc)
+// Empty volumes additionally accept [,medium=memory][,size=SIZE][,mode=MODE][,uid=UID][,gid=GID]
+// Volumes mounted by a volume driver are in the form name,kind=plugin,driver=DRIVER[,opt=KEY=VALUE...][,readOnly=true]
+// Network volumes are in the form name,kind=nfs|cifs,source=SOURCE[,secret=NAME][,opt=OPTION...][,readOnly=true]
 type appsVolume apps.Apps
 
 func (al *appsVolume) Set(s string) error {
-	vol, err := types.VolumeFromString(s)
+	// the empty dir, plugin and network volume parameters are not known
+	// to appc, strip them before parsing the rest of the volume
+	var (
+		parts    = strings.Split(s, ",")
+		volume   = parts[:1]
+		emptyDir *apps.EmptyDir
+		plugin   = &apps.PluginVolume{}
+		isPlugin bool
+		// driver is only valid with kind=plugin
+		hasPluginParams bool
+		// opt is only valid with kind=plugin, nfs or cifs
+		opts []string
+		// the source and secret are kept for the network volumes
+		netVol = &common.NetworkVolume{}
+		source string
+	)
+	for _, p := range parts[1:] {
+		kv := strings.SplitN(p, "=", 2)
+		switch {
+		case p == "kind="+volplugin.Kind:
+			// parsed as an empty volume, which has no source either
+			isPlugin = true
+			volume = append(volume, "kind=empty")
+			continue
+		case p == "kind="+common.VolumeKindNFS || p == "kind="+common.VolumeKindCIFS:
+			// parsed as an empty volume too
+			if netVol.Kind != "" && netVol.Kind != kv[1] {
+				return fmt.Errorf("multiple kinds in --volume flag %q", s)
+			}
+			netVol.Kind = kv[1]
+			volume = append(volume, "kind=empty")
+			continue
+		case kv[0] == "driver" || kv[0] == "opt" || kv[0] == "secret":
+			if len(kv) != 2 || kv[1] == "" {
+				return fmt.Errorf("invalid volume parameter %q in --volume flag %q", p, s)
+			}
+			switch kv[0] {
+			case "driver":
+				hasPluginParams = true
+				plugin.Driver = kv[1]
+			case "opt":
+				opts = append(opts, kv[1])
+			case "secret":
+				netVol.Secret = kv[1]
+			}
+			continue
+		case kv[0] == "source":
+			// the kind is not known yet
+			source = p
+			continue
+		}
+		switch kv[0] {
+		case "medium", "size", "mode", "uid", "gid":
+		default:
+			volume = append(volume, p)
+			continue
+		}
+		if len(kv) != 2 {
+			return fmt.Errorf("invalid volume parameter %q in --volume flag %q", p, s)
+		}
+		if emptyDir == nil {
+			emptyDir = &apps.EmptyDir{Mode: 0755}
+		}
+		switch kv[0] {
+		case "medium":
+			if kv[1] != apps.EmptyDirMediumMemory {
+				return fmt.Errorf("invalid volume medium %q in --volume flag %q, must be %q", kv[1], s, apps.EmptyDirMediumMemory)
+			}
+			emptyDir.Medium = kv[1]
+		case "size":
+			if err := common.ValidateMemorySize(kv[1]); err != nil {
+				return fmt.Errorf("invalid volume size %q in --volume flag %q: %v", kv[1], s, err)
+			}
+			emptyDir.Size = kv[1]
+		case "mode":
+			mode, err := strconv.ParseUint(kv[1], 8, 32)
+			if err != nil || mode&^0777 != 0 {
+				return fmt.Errorf("invalid volume mode %q in --volume flag %q", kv[1], s)
+			}
+			emptyDir.Mode = os.FileMode(mode)
+		case "uid", "gid":
+			id, err := strconv.ParseUint(kv[1], 10, 32)
+			if err != nil {
+				return fmt.Errorf("invalid volume %s %q in --volume flag %q", kv[0], kv[1], s)
+			}
+			if kv[0] == "uid" {
+				emptyDir.Uid = uint32(id)
+			} else {
+				emptyDir.Gid = uint32(id)
+			}
+		}
+	}
+	if netVol.Kind == "" && source != "" {
+		volume = append(volume, source)
+	}
+
+	vol, err := types.VolumeFromString(strings.Join(volume, ","))
 	if err != nil {
 		return fmt.Errorf("invalid value in --volume flag %q: %v", s, err)
 	}
 
-	(*apps.Apps)(al).Volumes = append((*apps.Apps)(al).Volumes, *vol)
+	as := (*apps.Apps)(al)
+	if isPlugin && netVol.Kind != "" {
+		return fmt.Errorf("multiple kinds in --volume flag %q", s)
+	}
+	if hasPluginParams && !isPlugin {
+		return fmt.Errorf("driver is only valid for plugin volumes in --volume flag %q", s)
+	}
+	if len(opts) > 0 && !isPlugin && netVol.Kind == "" {
+		return fmt.Errorf("opt is only valid for plugin, nfs and cifs volumes in --volume flag %q", s)
+	}
+	if netVol.Secret != "" && netVol.Kind != common.VolumeKindCIFS {
+		return fmt.Errorf("secret is only valid for cifs volumes in --volume flag %q", s)
+	}
+	if isPlugin {
+		if plugin.Driver == "" {
+			return fmt.Errorf("no driver for the plugin volume in --volume flag %q", s)
+		}
+		for _, opt := range opts {
+			kv := strings.SplitN(opt, "=", 2)
+			if len(kv) != 2 || kv[0] == "" {
+				return fmt.Errorf("invalid volume option %q in --volume flag %q, must be KEY=VALUE", opt, s)
+			}
+			if plugin.Options == nil {
+				plugin.Options = make(map[string]string)
+			}
+			plugin.Options[kv[0]] = kv[1]
+		}
+		vol.Kind = volplugin.Kind
+		if as.PluginVolumes == nil {
+			as.PluginVolumes = make(map[types.ACName]*apps.PluginVolume)
+		}
+		as.PluginVolumes[vol.Name] = plugin
+	}
+	if netVol.Kind != "" {
+		netVol.Name = vol.Name.String()
+		netVol.Source = strings.TrimPrefix(source, "source=")
+		netVol.Options = opts
+		netVol.ReadOnly = vol.ReadOnly != nil && *vol.ReadOnly
+		if err := netVol.Validate(); err != nil {
+			return fmt.Errorf("invalid value in --volume flag %q: %v", s, err)
+		}
+		vol.Kind = netVol.Kind
+		if as.NetworkVolumes == nil {
+			as.NetworkVolumes = make(map[types.ACName]*common.NetworkVolume)
+		}
+		as.NetworkVolumes[vol.Name] = netVol
+	}
+	if emptyDir != nil {
+		if vol.Kind != "empty" {
+			return fmt.Errorf("medium, size, mode, uid and gid are only valid for empty volumes in --volume flag %q", s)
+		}
+		if emptyDir.Size != "" && emptyDir.Medium != apps.EmptyDirMediumMemory {
+			return fmt.Errorf("size requires medium=%s in --volume flag %q", apps.EmptyDirMediumMemory, s)
+		}
+		if as.EmptyDirs == nil {
+			as.EmptyDirs = make(map[types.ACName]*apps.EmptyDir)
+		}
+		as.EmptyDirs[vol.Name] = emptyDir
+	}
+
+	as.Volumes = append(as.Volumes, *vol)
 	return nil
 }
 
@@ -19,6 +19,9 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/common/apps"
+
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
 	flag "github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/pflag"
 )
@@ -82,6 +85,235 @@ func TestParseAppArgs(t *testing.T) {
 
 }
 
+func TestAppHardeningFlags(t *testing.T) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.SetInterspersed(false)
+	addAppHardeningFlags(flags)
+
+	rktApps.Reset()
+	args := "example.com/foo --no-new-privileges --readonly-sys=false example.com/bar --mask-proc-paths"
+	if err := parseApps(&rktApps, strings.Split(args, " "), flags, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got [][3]*bool
+	rktApps.Walk(func(app *apps.App) error {
+		got = append(got, [3]*bool{app.NoNewPrivileges, app.MaskProcPaths, app.ReadOnlySys})
+		return nil
+	})
+	yes, no := true, false
+	expected := [][3]*bool{
+		{&yes, nil, &no},
+		{nil, &yes, nil},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, want %v", got, expected)
+	}
+
+	rktApps.Reset()
+	if err := parseApps(&rktApps, []string{"--no-new-privileges", "example.com/foo"}, flags, true); err == nil {
+		t.Errorf("expected an error with a per-app flag before any image")
+	}
+}
+
+func TestAppsSecret(t *testing.T) {
+	tests := []struct {
+		in  string
+		ex  apps.Secret
+		err bool
+	}{
+		{
+			in: "token,source=env:TOKEN",
+			ex: apps.Secret{Name: "token", Env: "TOKEN", Target: "/run/secrets/token", Mode: 0400},
+		},
+		{
+			in: "tls-key,source=file:/etc/ssl/key.pem,target=/etc/app/key.pem,mode=0440,uid=1000,gid=100",
+			ex: apps.Secret{Name: "tls-key", File: "/etc/ssl/key.pem", Target: "/etc/app/key.pem", Mode: 0440, Uid: 1000, Gid: 100},
+		},
+		{in: "token", err: true},
+		{in: "Token,source=env:TOKEN", err: true},
+		{in: "token,source=TOKEN", err: true},
+		{in: "token,source=env:TOKEN,target=relative", err: true},
+		{in: "token,source=env:TOKEN,mode=0999", err: true},
+		{in: "token,source=env:TOKEN,uid=-1", err: true},
+		{in: "token,source=env:TOKEN,foo=bar", err: true},
+	}
+
+	for i, tt := range tests {
+		var as apps.Apps
+		err := (*appsSecret)(&as).Set(tt.in)
+		if tt.err {
+			if err == nil {
+				t.Errorf("#%d: expected an error for %q", i, tt.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: unexpected error for %q: %v", i, tt.in, err)
+			continue
+		}
+		if len(as.Secrets) != 1 || !reflect.DeepEqual(as.Secrets[0], tt.ex) {
+			t.Errorf("#%d: got %v, want %v", i, as.Secrets, tt.ex)
+		}
+	}
+}
+
+func TestAppsVolumeEmptyDir(t *testing.T) {
+	tests := []struct {
+		in  string
+		ex  *apps.EmptyDir
+		err bool
+	}{
+		{in: "cache,kind=empty"},
+		{
+			in: "cache,kind=empty,medium=memory,size=64m,mode=0770,uid=1000,gid=100",
+			ex: &apps.EmptyDir{Medium: "memory", Size: "64m", Mode: 0770, Uid: 1000, Gid: 100},
+		},
+		{
+			in: "cache,kind=empty,uid=1000",
+			ex: &apps.EmptyDir{Mode: 0755, Uid: 1000},
+		},
+		{in: "cache,kind=host,source=/tmp,uid=1000", err: true},
+		{in: "cache,kind=empty,medium=disk", err: true},
+		{in: "cache,kind=empty,size=64m", err: true},
+		{in: "cache,kind=empty,medium=memory,size=lots", err: true},
+		{in: "cache,kind=empty,mode=0999", err: true},
+		{in: "cache,kind=empty,gid", err: true},
+	}
+
+	for i, tt := range tests {
+		var as apps.Apps
+		err := (*appsVolume)(&as).Set(tt.in)
+		if tt.err {
+			if err == nil {
+				t.Errorf("#%d: expected an error for %q", i, tt.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: unexpected error for %q: %v", i, tt.in, err)
+			continue
+		}
+		if len(as.Volumes) != 1 || as.Volumes[0].Kind != "empty" {
+			t.Errorf("#%d: got volumes %v, want one empty volume", i, as.Volumes)
+		}
+		if ed := as.EmptyDirs["cache"]; !reflect.DeepEqual(ed, tt.ex) {
+			t.Errorf("#%d: got %v, want %v", i, ed, tt.ex)
+		}
+	}
+}
+
+func TestAppsVolumePlugin(t *testing.T) {
+	tests := []struct {
+		in  string
+		ex  *apps.PluginVolume
+		err bool
+	}{
+		{
+			in: "data,kind=plugin,driver=nfs",
+			ex: &apps.PluginVolume{Driver: "nfs"},
+		},
+		{
+			in: "data,kind=plugin,driver=nfs,opt=server=fs.example.com,opt=export=/srv/data=old,readOnly=true",
+			ex: &apps.PluginVolume{Driver: "nfs", Options: map[string]string{"server": "fs.example.com", "export": "/srv/data=old"}},
+		},
+		{in: "data,kind=plugin", err: true},
+		{in: "data,kind=plugin,driver=", err: true},
+		{in: "data,kind=plugin,driver=nfs,opt=server", err: true},
+		{in: "data,kind=plugin,driver=nfs,source=/srv", err: true},
+		{in: "data,kind=plugin,driver=nfs,medium=memory", err: true},
+		{in: "data,kind=empty,driver=nfs", err: true},
+		{in: "data,kind=host,source=/srv,opt=server=fs", err: true},
+	}
+
+	for i, tt := range tests {
+		var as apps.Apps
+		err := (*appsVolume)(&as).Set(tt.in)
+		if tt.err {
+			if err == nil {
+				t.Errorf("#%d: expected an error for %q", i, tt.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: unexpected error for %q: %v", i, tt.in, err)
+			continue
+		}
+		if len(as.Volumes) != 1 || as.Volumes[0].Kind != "plugin" {
+			t.Errorf("#%d: got volumes %v, want one plugin volume", i, as.Volumes)
+		}
+		if pv := as.PluginVolumes["data"]; !reflect.DeepEqual(pv, tt.ex) {
+			t.Errorf("#%d: got %v, want %v", i, pv, tt.ex)
+		}
+	}
+}
+
+func TestAppsVolumeNetwork(t *testing.T) {
+	tests := []struct {
+		in  string
+		ex  *common.NetworkVolume
+		err bool
+	}{
+		{
+			in: "data,kind=nfs,source=fs.example.com:/srv/data,opt=vers=4,opt=soft,readOnly=true",
+			ex: &common.NetworkVolume{Name: "data", Kind: "nfs", Source: "fs.example.com:/srv/data", Options: []string{"vers=4", "soft"}, ReadOnly: true},
+		},
+		{
+			in: "data,kind=cifs,source=//fs.example.com/data,secret=smb-creds",
+			ex: &common.NetworkVolume{Name: "data", Kind: "cifs", Source: "//fs.example.com/data", Secret: "smb-creds"},
+		},
+		{in: "data,kind=nfs", err: true},
+		{in: "data,kind=nfs,source=/srv/data", err: true},
+		{in: "data,kind=nfs,source=fs:/srv,secret=creds", err: true},
+		{in: "data,kind=nfs,source=fs:/srv,driver=nfs", err: true},
+		{in: "data,kind=nfs,source=fs:/srv,kind=cifs", err: true},
+		{in: "data,kind=cifs,source=//fs/data,opt=password=hunter2", err: true},
+	}
+
+	for i, tt := range tests {
+		var as apps.Apps
+		err := (*appsVolume)(&as).Set(tt.in)
+		if tt.err {
+			if err == nil {
+				t.Errorf("#%d: expected an error for %q", i, tt.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: unexpected error for %q: %v", i, tt.in, err)
+			continue
+		}
+		if len(as.Volumes) != 1 || as.Volumes[0].Kind != tt.ex.Kind {
+			t.Errorf("#%d: got volumes %v, want one %s volume", i, as.Volumes, tt.ex.Kind)
+		}
+		if nv := as.NetworkVolumes["data"]; !reflect.DeepEqual(nv, tt.ex) {
+			t.Errorf("#%d: got %+v, want %+v", i, nv, tt.ex)
+		}
+	}
+}
+
+func TestAppMountReadOnly(t *testing.T) {
+	var as apps.Apps
+	if err := (*appMount)(&as).Set("volume=data,target=/data,readOnly=true"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ro, ok := as.ReadOnlyMounts["/data"]; !ok || !ro {
+		t.Errorf("got global readOnly overrides %v, want /data read-only", as.ReadOnlyMounts)
+	}
+
+	as.Create("example.com/app")
+	if err := (*appMount)(&as).Set("volume=data,target=/data,readOnly=false"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ro, ok := as.Last().ReadOnlyMounts["/data"]; !ok || ro {
+		t.Errorf("got app readOnly overrides %v, want /data read-write", as.Last().ReadOnlyMounts)
+	}
+
+	if err := (*appMount)(&as).Set("volume=data,target=/data,readOnly=maybe"); err == nil {
+		t.Errorf("expected an error for an invalid readOnly value")
+	}
+}
+
 func TestParsePortFlag(t *testing.T) {
 	tests := []struct {
 		in  string
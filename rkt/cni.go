@@ -0,0 +1,120 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/pflag"
+	"github.com/coreos/rkt/common"
+)
+
+var (
+	flagCNIArgs         cniArgs
+	flagCNICapabilities cniCapabilities
+)
+
+// cniArgs implements the flag.Value interface to contain the CNI_ARGS
+// passed to all the network plugins of a pod, given as KEY=VALUE pairs
+type cniArgs []string
+
+func (a *cniArgs) Set(s string) error {
+	for _, kv := range strings.Split(s, ";") {
+		if i := strings.Index(kv, "="); i <= 0 {
+			return fmt.Errorf("%q must be specified as KEY=VALUE", kv)
+		}
+		*a = append(*a, kv)
+	}
+	return nil
+}
+
+func (a *cniArgs) String() string {
+	return strings.Join(*a, ";")
+}
+
+func (a *cniArgs) Type() string {
+	return "cniArgs"
+}
+
+// cniCapabilities implements the flag.Value interface to contain the
+// runtime config of the CNI capabilities passed to the network plugins of a
+// pod, given as NAME=JSON pairs
+type cniCapabilities map[string]json.RawMessage
+
+func (c *cniCapabilities) Set(s string) error {
+	pair := strings.SplitN(s, "=", 2)
+	if len(pair) != 2 || pair[0] == "" {
+		return fmt.Errorf("%q must be specified as NAME=JSON", s)
+	}
+	var v interface{}
+	if err := json.Unmarshal([]byte(pair[1]), &v); err != nil {
+		return fmt.Errorf("invalid runtime config of the %q capability: %v", pair[0], err)
+	}
+	if *c == nil {
+		*c = make(cniCapabilities)
+	}
+	if _, exists := (*c)[pair[0]]; exists {
+		return fmt.Errorf("%q already set", pair[0])
+	}
+	(*c)[pair[0]] = json.RawMessage(pair[1])
+	return nil
+}
+
+func (c *cniCapabilities) String() string {
+	var names []string
+	for name := range *c {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var kvs []string
+	for _, name := range names {
+		kvs = append(kvs, name+"="+string((*c)[name]))
+	}
+	return strings.Join(kvs, ",")
+}
+
+func (c *cniCapabilities) Type() string {
+	return "cniCapabilities"
+}
+
+// addCNIFlags adds the flags passing arguments to all the network plugins
+// of the pods. They are passed to stage1 as pod annotations.
+func addCNIFlags(flags *pflag.FlagSet) {
+	flags.Var(&flagCNIArgs, "cni-arg", "argument passed in CNI_ARGS to all the network plugins of the pod, in the form KEY=VALUE")
+	flags.Var(&flagCNICapabilities, "cni-capability", "runtime config of a CNI capability, passed to the network plugins declaring it, in the form NAME=JSON")
+}
+
+// cniFlagsSet returns whether any of the CNI flags is set.
+func cniFlagsSet() bool {
+	return len(flagCNIArgs) > 0 || len(flagCNICapabilities) > 0
+}
+
+// cniAnnotations returns the pod annotations corresponding to the CNI flags.
+func cniAnnotations() types.Annotations {
+	var annotations types.Annotations
+	if len(flagCNIArgs) > 0 {
+		annotations.Set(types.ACIdentifier(common.CNIArgsAnnotation), flagCNIArgs.String())
+	}
+	if len(flagCNICapabilities) > 0 {
+		// the values are valid JSON, checked by Set
+		b, _ := json.Marshal(flagCNICapabilities)
+		annotations.Set(types.ACIdentifier(common.CNICapabilitiesAnnotation), string(b))
+	}
+	return annotations
+}
@@ -0,0 +1,108 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/cobra"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/pflag"
+	"github.com/coreos/rkt/rkt/config"
+)
+
+var (
+	cmdConfig = &cobra.Command{
+		Use:   "config [--json]",
+		Short: "Print the effective configuration",
+		Long: `The configuration of the system directory is overridden by the one of the local directory.
+The passwords and tokens of the credentials are not printed.`,
+		Run: runWrapper(runConfig),
+	}
+	flagConfigJSON bool
+)
+
+func init() {
+	cmdRkt.AddCommand(cmdConfig)
+	cmdConfig.Flags().BoolVar(&flagConfigJSON, "json", false, "print the configuration in JSON, with the file each value comes from")
+}
+
+func runConfig(cmd *cobra.Command, args []string) (exit int) {
+	if len(args) != 0 {
+		cmd.Usage()
+		return 1
+	}
+
+	cfg, err := getConfig()
+	if err != nil {
+		stderr("config: cannot get configuration: %v", err)
+		return 1
+	}
+
+	entries := cfg.Entries()
+	if !flagConfigJSON {
+		for _, e := range entries {
+			stdout("%s=%s", e.Key, e.Value)
+		}
+		return 0
+	}
+
+	if entries == nil {
+		entries = []config.Entry{}
+	}
+	b, err := json.MarshalIndent(entries, "", "\t")
+	if err != nil {
+		stderr("config: cannot marshal the configuration: %v", err)
+		return 1
+	}
+	stdout("%s", b)
+
+	return 0
+}
+
+// applyConfigDefaults sets the flags of the command not given on the command
+// line to the defaults of the configuration. Only the flags registered in
+// names are set.
+func applyConfigDefaults(flags *pflag.FlagSet, names ...string) error {
+	cfg, err := getConfig()
+	if err != nil {
+		return fmt.Errorf("cannot get configuration: %v", err)
+	}
+
+	defaults := map[string]string{
+		stage1ImageFlagName: cfg.Defaults.Stage1Image,
+		"insecure-options":  strings.Join(cfg.Defaults.InsecureOptions, ","),
+		"net":               strings.Join(cfg.Defaults.Net, ","),
+		"expire-prepared":   cfg.Defaults.ExpirePrepared,
+		"dns":               cfg.Defaults.DNS,
+	}
+	for _, name := range names {
+		value, ok := defaults[name]
+		if !ok {
+			panic(fmt.Sprintf("no configuration default for flag --%s", name))
+		}
+		f := flags.Lookup(name)
+		if f == nil || f.Changed || value == "" {
+			continue
+		}
+		if err := flags.Set(name, value); err != nil {
+			return fmt.Errorf("invalid default --%s=%s in the configuration: %v", name, value, err)
+		}
+	}
+	return nil
+}
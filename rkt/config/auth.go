@@ -80,6 +80,21 @@ func (h *oAuthBearerTokenHeaderer) Header() http.Header {
 	return headers
 }
 
+// authType returns the type of the credentials of the headerer, as in the
+// "type" field of the auth configuration kind.
+func authType(h Headerer) string {
+	switch h := h.(type) {
+	case *basicAuthHeaderer:
+		return "basic"
+	case *oAuthBearerTokenHeaderer:
+		return "oauth"
+	case *credentialHelperHeaderer:
+		return "helper " + h.helper.Name
+	default:
+		return "unknown"
+	}
+}
+
 func (p *authV1JsonParser) parse(config *Config, raw []byte) error {
 	var auth authV1
 	if err := json.Unmarshal(raw, &auth); err != nil {
@@ -161,6 +176,9 @@ func (p *dockerAuthV1JsonParser) parse(config *Config, raw []byte) error {
 		if _, ok := config.DockerCredentialsPerRegistry[registry]; ok {
 			return fmt.Errorf("credentials for docker registry %q are already specified", registry)
 		}
+		if _, ok := config.DockerCredentialHelpers[registry]; ok {
+			return fmt.Errorf("credentials for docker registry %q are already specified", registry)
+		}
 		config.DockerCredentialsPerRegistry[registry] = basic
 	}
 	return nil
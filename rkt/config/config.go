@@ -43,6 +43,80 @@ type BasicCredentials struct {
 type Config struct {
 	AuthPerHost                  map[string]Headerer
 	DockerCredentialsPerRegistry map[string]BasicCredentials
+	// DockerCredentialHelpers are the helpers getting the credentials
+	// of the docker registries without static credentials
+	DockerCredentialHelpers map[string]*CredentialHelper
+	// OverlayMode is the default use of overlayfs by the pods, empty
+	// if not configured
+	OverlayMode string
+	// ScanCommand is the command run on the images of the pods before
+	// running them, empty if not configured
+	ScanCommand []string
+	// Hooks are the commands run on the host when the pods change state
+	Hooks Hooks
+	// ArchFallbacks are, for an arch, the archs of the images discovered
+	// when there is none for it, in order of preference
+	ArchFallbacks map[string][]string
+	// VolumeCleanupPlugins are, for a volume kind, the commands run on
+	// the host to release the resources of the volumes of that kind when
+	// their pods are garbage collected
+	VolumeCleanupPlugins map[string][]string
+	// VolumeDrivers are, by name, the commands mounting the volumes of
+	// kind plugin on the host
+	VolumeDrivers map[string][]string
+	// Defaults are the default values of the flags of the commands
+	// creating pods
+	Defaults Defaults
+	// StoreEncryption is where the key encrypting the images in the
+	// store comes from, nil if they are not encrypted
+	StoreEncryption *StoreEncryption
+	// Stage1Digests are the image IDs of the only stage1 images the
+	// pods may use, empty if any stage1 image may be used
+	Stage1Digests []string
+
+	// sources maps the keys of the entries to the files they come from
+	sources map[string]string
+}
+
+// Entry is a configured value, with the file it comes from.
+type Entry struct {
+	// Key identifies the value, the kind and a field or a host,
+	// for example "overlay.mode" or "auth.quay.io"
+	Key string `json:"key"`
+	// Value is the configured value, without the passwords and tokens
+	Value string `json:"value"`
+	// Source is the path of the configuration file
+	Source string `json:"source"`
+}
+
+// Defaults are the values used for the flags not given on the command
+// line, empty if not configured.
+type Defaults struct {
+	// Stage1Image is the default --stage1-image
+	Stage1Image string
+	// InsecureOptions is the default --insecure-options
+	InsecureOptions []string
+	// Net is the default --net, one network per element
+	Net []string
+	// ExpirePrepared is the default --expire-prepared of rkt prepare, a
+	// Go duration
+	ExpirePrepared string
+	// DNS is the default --dns of rkt fly
+	DNS string
+}
+
+// Hooks are the commands, absolute path followed by the arguments, run when
+// a pod reaches a state, empty if not configured.
+type Hooks struct {
+	// OnPrepare is run when a pod is prepared
+	OnPrepare []string
+	// OnRun is run before stage1 starts a pod
+	OnRun []string
+	// OnExit is run when the garbage collection or rkt rm finds a pod
+	// exited
+	OnExit []string
+	// OnGC is run before an exited or garbage pod is removed
+	OnGC []string
 }
 
 type configParser interface {
@@ -121,7 +195,9 @@ func GetConfigFrom(system, local string) (*Config, error) {
 		if err != nil {
 			return nil, err
 		}
-		mergeConfigs(cfg, subcfg)
+		if err := mergeConfigs(cfg, subcfg); err != nil {
+			return nil, fmt.Errorf("invalid configuration in %q: %v", cd, err)
+		}
 	}
 	return cfg, nil
 }
@@ -145,9 +221,88 @@ func newConfig() *Config {
 	return &Config{
 		AuthPerHost:                  make(map[string]Headerer),
 		DockerCredentialsPerRegistry: make(map[string]BasicCredentials),
+		DockerCredentialHelpers:      make(map[string]*CredentialHelper),
+		ArchFallbacks:                make(map[string][]string),
+		VolumeCleanupPlugins:         make(map[string][]string),
+		VolumeDrivers:                make(map[string][]string),
+		sources:                      make(map[string]string),
 	}
 }
 
+// Entries returns the configured values sorted by key, without the passwords
+// and tokens of the credentials.
+func (c *Config) Entries() []Entry {
+	var entries []Entry
+	for key, value := range c.values() {
+		entries = append(entries, Entry{
+			Key:    key,
+			Value:  value,
+			Source: c.sources[key],
+		})
+	}
+	sort.Sort(byKey(entries))
+	return entries
+}
+
+// values returns the configured values by key
+func (c *Config) values() map[string]string {
+	values := make(map[string]string)
+	add := func(key, value string) {
+		if value != "" {
+			values[key] = value
+		}
+	}
+
+	for host, h := range c.AuthPerHost {
+		add("auth."+host, authType(h))
+	}
+	for registry, creds := range c.DockerCredentialsPerRegistry {
+		add("dockerAuth."+registry, "user "+creds.User)
+	}
+	for registry, helper := range c.DockerCredentialHelpers {
+		add("dockerAuth."+registry, "helper "+helper.Name)
+	}
+	add("overlay.mode", c.OverlayMode)
+	add("scan.command", strings.Join(c.ScanCommand, " "))
+	add("hooks.onPrepare", strings.Join(c.Hooks.OnPrepare, " "))
+	add("hooks.onRun", strings.Join(c.Hooks.OnRun, " "))
+	add("hooks.onExit", strings.Join(c.Hooks.OnExit, " "))
+	add("hooks.onGC", strings.Join(c.Hooks.OnGC, " "))
+	for arch, fallbacks := range c.ArchFallbacks {
+		value := strings.Join(fallbacks, ",")
+		if value == "" {
+			value = "none"
+		}
+		add("archFallback."+arch, value)
+	}
+	for kind, command := range c.VolumeCleanupPlugins {
+		add("volumeCleanup."+kind, strings.Join(command, " "))
+	}
+	for driver, command := range c.VolumeDrivers {
+		add("volumeDriver."+driver, strings.Join(command, " "))
+	}
+	add("defaults.stage1Image", c.Defaults.Stage1Image)
+	add("defaults.insecureOptions", strings.Join(c.Defaults.InsecureOptions, ","))
+	add("defaults.net", strings.Join(c.Defaults.Net, ","))
+	add("defaults.expirePrepared", c.Defaults.ExpirePrepared)
+	add("defaults.dns", c.Defaults.DNS)
+	add("stage1Pin.digests", strings.Join(c.Stage1Digests, ","))
+	if c.StoreEncryption != nil {
+		add("storeEncryption.keySource", c.StoreEncryption.KeySource)
+		add("storeEncryption.path", c.StoreEncryption.Path)
+		add("storeEncryption.handle", c.StoreEncryption.Handle)
+		add("storeEncryption.command", strings.Join(c.StoreEncryption.Command, " "))
+	}
+
+	return values
+}
+
+type byKey []Entry
+
+func (k byKey) Len() int           { return len(k) }
+func (k byKey) Swap(i, j int)      { k[i], k[j] = k[j], k[i] }
+func (k byKey) Less(i, j int) bool { return k[i].Key < k[j].Key }
+
 func readConfigDir(config *Config, dir string) error {
 	for csd, kinds := range configSubDirs {
 		d := filepath.Join(dir, csd)
@@ -254,9 +409,17 @@ func parseConfigFile(config *Config, path string, kinds []string) error {
 	if err != nil {
 		return err
 	}
+	// A value can be set by only one file of a directory, so the
+	// values set by the parser come from this file
+	before := config.values()
 	if err := parser.parse(config, raw); err != nil {
 		return fmt.Errorf("failed to parse %q: %v", path, err)
 	}
+	for key := range config.values() {
+		if _, ok := before[key]; !ok {
+			config.sources[key] = path
+		}
+	}
 	return nil
 }
 
@@ -272,11 +435,95 @@ func getParser(kind, version string) (configParser, error) {
 	return parser, nil
 }
 
-func mergeConfigs(config *Config, subconfig *Config) {
+func mergeConfigs(config *Config, subconfig *Config) error {
+	for key, source := range subconfig.sources {
+		config.sources[key] = source
+	}
 	for host, headerer := range subconfig.AuthPerHost {
 		config.AuthPerHost[host] = headerer
 	}
+	// the credentials of a registry override both its static credentials
+	// and its helper
 	for registry, creds := range subconfig.DockerCredentialsPerRegistry {
 		config.DockerCredentialsPerRegistry[registry] = creds
+		delete(config.DockerCredentialHelpers, registry)
+	}
+	for registry, helper := range subconfig.DockerCredentialHelpers {
+		config.DockerCredentialHelpers[registry] = helper
+		delete(config.DockerCredentialsPerRegistry, registry)
+	}
+	if subconfig.OverlayMode != "" {
+		config.OverlayMode = subconfig.OverlayMode
+	}
+	if len(subconfig.ScanCommand) > 0 {
+		config.ScanCommand = subconfig.ScanCommand
+	}
+	for arch, fallbacks := range subconfig.ArchFallbacks {
+		config.ArchFallbacks[arch] = fallbacks
+	}
+	if len(subconfig.Hooks.OnPrepare) > 0 {
+		config.Hooks.OnPrepare = subconfig.Hooks.OnPrepare
+	}
+	if len(subconfig.Hooks.OnRun) > 0 {
+		config.Hooks.OnRun = subconfig.Hooks.OnRun
+	}
+	if len(subconfig.Hooks.OnExit) > 0 {
+		config.Hooks.OnExit = subconfig.Hooks.OnExit
+	}
+	if len(subconfig.Hooks.OnGC) > 0 {
+		config.Hooks.OnGC = subconfig.Hooks.OnGC
+	}
+	for kind, command := range subconfig.VolumeCleanupPlugins {
+		config.VolumeCleanupPlugins[kind] = command
+	}
+	for driver, command := range subconfig.VolumeDrivers {
+		config.VolumeDrivers[driver] = command
+	}
+	if subconfig.Defaults.Stage1Image != "" {
+		config.Defaults.Stage1Image = subconfig.Defaults.Stage1Image
+	}
+	if len(subconfig.Defaults.InsecureOptions) > 0 {
+		config.Defaults.InsecureOptions = subconfig.Defaults.InsecureOptions
+	}
+	if len(subconfig.Defaults.Net) > 0 {
+		config.Defaults.Net = subconfig.Defaults.Net
+	}
+	if subconfig.Defaults.ExpirePrepared != "" {
+		config.Defaults.ExpirePrepared = subconfig.Defaults.ExpirePrepared
+	}
+	if subconfig.Defaults.DNS != "" {
+		config.Defaults.DNS = subconfig.Defaults.DNS
+	}
+	if subconfig.StoreEncryption != nil {
+		config.StoreEncryption = subconfig.StoreEncryption
+	}
+	// the local pins can only narrow down the system ones, so that the
+	// local configuration cannot allow other stage1 images
+	if len(subconfig.Stage1Digests) > 0 {
+		digests := subconfig.Stage1Digests
+		if len(config.Stage1Digests) > 0 {
+			digests = intersectStrings(config.Stage1Digests, subconfig.Stage1Digests)
+			if len(digests) == 0 {
+				return fmt.Errorf("none of the stage1 digests %v is already pinned", subconfig.Stage1Digests)
+			}
+		}
+		config.Stage1Digests = digests
+	}
+	return nil
+}
+
+// intersectStrings returns the strings of a which are in b too, in the order
+// of a.
+func intersectStrings(a, b []string) []string {
+	inB := make(map[string]struct{})
+	for _, s := range b {
+		inB[s] = struct{}{}
+	}
+	var res []string
+	for _, s := range a {
+		if _, ok := inB[s]; ok {
+			res = append(res, s)
+		}
 	}
+	return res
 }
@@ -22,6 +22,7 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -224,6 +225,15 @@ func TestConfigLoading(t *testing.T) {
 	if !reflect.DeepEqual(result, expected) {
 		t.Error("Got unexpected results\nResult:\n", result, "\n\nExpected:\n", expected)
 	}
+
+	expectedEntries := []Entry{
+		{"auth.coreos.com", "basic", filepath.Join(dir, systemAuth, "coreos.json")},
+		{"auth.endocode.com", "basic", filepath.Join(dir, localAuth, "endocode.json")},
+		{"auth.tectonic.com", "basic", filepath.Join(dir, localAuth, "tectonic.json")},
+	}
+	if entries := cfg.Entries(); !reflect.DeepEqual(entries, expectedEntries) {
+		t.Errorf("Got unexpected entries %v, expected %v", entries, expectedEntries)
+	}
 }
 
 func writeBasicConfig(path, domain, user, pass string) error {
@@ -254,3 +264,393 @@ func writeBasicConfig(path, domain, user, pass string) error {
 	}
 	return ioutil.WriteFile(path, raw, 0600)
 }
+
+func TestOverlayConfigFormat(t *testing.T) {
+	tests := []struct {
+		contents string
+		expected string
+		fail     bool
+	}{
+		{`{"rktKind": "overlay", "rktVersion": "v1"}`, "", true},
+		{`{"rktKind": "overlay", "rktVersion": "v1", "mode": "foo"}`, "", true},
+		{`{"rktKind": "overlay", "rktVersion": "v1", "mode": "auto"}`, "auto", false},
+		{`{"rktKind": "overlay", "rktVersion": "v1", "mode": "disabled"}`, "disabled", false},
+	}
+	for _, tt := range tests {
+		cfg, err := getConfigFromContents(tt.contents, "overlay")
+		if vErr := verifyFailure(tt.fail, tt.contents, err); vErr != nil {
+			t.Errorf("%v", vErr)
+		} else if !tt.fail && cfg.OverlayMode != tt.expected {
+			t.Errorf("Got unexpected overlay mode %q, expected %q", cfg.OverlayMode, tt.expected)
+		}
+	}
+}
+
+func TestScanConfigFormat(t *testing.T) {
+	tests := []struct {
+		contents string
+		expected []string
+		fail     bool
+	}{
+		{`{"rktKind": "scan", "rktVersion": "v1"}`, nil, true},
+		{`{"rktKind": "scan", "rktVersion": "v1", "command": []}`, nil, true},
+		{`{"rktKind": "scan", "rktVersion": "v1", "command": ["clair-check"]}`, nil, true},
+		{`{"rktKind": "scan", "rktVersion": "v1", "command": ["/usr/bin/clair-check"]}`, []string{"/usr/bin/clair-check"}, false},
+		{`{"rktKind": "scan", "rktVersion": "v1", "command": ["/usr/bin/clair-check", "--severity=high"]}`, []string{"/usr/bin/clair-check", "--severity=high"}, false},
+	}
+	for _, tt := range tests {
+		cfg, err := getConfigFromContents(tt.contents, "scan")
+		if vErr := verifyFailure(tt.fail, tt.contents, err); vErr != nil {
+			t.Errorf("%v", vErr)
+		} else if !tt.fail && !reflect.DeepEqual(cfg.ScanCommand, tt.expected) {
+			t.Errorf("Got unexpected scan command %v, expected %v", cfg.ScanCommand, tt.expected)
+		}
+	}
+}
+
+func TestHooksConfigFormat(t *testing.T) {
+	tests := []struct {
+		contents string
+		expected Hooks
+		fail     bool
+	}{
+		{`{"rktKind": "hooks", "rktVersion": "v1"}`, Hooks{}, true},
+		{`{"rktKind": "hooks", "rktVersion": "v1", "onRun": []}`, Hooks{}, true},
+		{`{"rktKind": "hooks", "rktVersion": "v1", "onRun": ["register-dns"]}`, Hooks{}, true},
+		{`{"rktKind": "hooks", "rktVersion": "v1", "onRun": "/usr/bin/register-dns"}`, Hooks{}, true},
+		{`{"rktKind": "hooks", "rktVersion": "v1", "onRun": ["/usr/bin/register-dns"]}`, Hooks{OnRun: []string{"/usr/bin/register-dns"}}, false},
+		{`{"rktKind": "hooks", "rktVersion": "v1", "onPrepare": ["/usr/bin/fw", "open"], "onExit": ["/usr/bin/fw", "close"], "onGC": ["/usr/bin/fw", "purge"]}`, Hooks{OnPrepare: []string{"/usr/bin/fw", "open"}, OnExit: []string{"/usr/bin/fw", "close"}, OnGC: []string{"/usr/bin/fw", "purge"}}, false},
+	}
+	for _, tt := range tests {
+		cfg, err := getConfigFromContents(tt.contents, "hooks")
+		if vErr := verifyFailure(tt.fail, tt.contents, err); vErr != nil {
+			t.Errorf("%v", vErr)
+		} else if !tt.fail && !reflect.DeepEqual(cfg.Hooks, tt.expected) {
+			t.Errorf("Got unexpected hooks %+v, expected %+v", cfg.Hooks, tt.expected)
+		}
+	}
+}
+
+func TestArchFallbackConfigFormat(t *testing.T) {
+	tests := []struct {
+		contents string
+		expected map[string][]string
+		fail     bool
+	}{
+		{`{"rktKind": "archFallback", "rktVersion": "v1"}`, nil, true},
+		{`{"rktKind": "archFallback", "rktVersion": "v1", "fallbacks": {}}`, nil, true},
+		{`{"rktKind": "archFallback", "rktVersion": "v1", "fallbacks": {"aarch64": [""]}}`, nil, true},
+		{`{"rktKind": "archFallback", "rktVersion": "v1", "fallbacks": {"aarch64": ["aarch64"]}}`, nil, true},
+		{`{"rktKind": "archFallback", "rktVersion": "v1", "fallbacks": {"aarch64": ["armv7l", "armv6l"]}}`, map[string][]string{"aarch64": {"armv7l", "armv6l"}}, false},
+		{`{"rktKind": "archFallback", "rktVersion": "v1", "fallbacks": {"aarch64": [], "armv7l": ["armv6l"]}}`, map[string][]string{"aarch64": {}, "armv7l": {"armv6l"}}, false},
+	}
+	for _, tt := range tests {
+		cfg, err := getConfigFromContents(tt.contents, "archFallback")
+		if vErr := verifyFailure(tt.fail, tt.contents, err); vErr != nil {
+			t.Errorf("%v", vErr)
+		} else if !tt.fail && !reflect.DeepEqual(cfg.ArchFallbacks, tt.expected) {
+			t.Errorf("Got unexpected arch fallbacks %v, expected %v", cfg.ArchFallbacks, tt.expected)
+		}
+	}
+}
+
+func TestVolumeCleanupConfigFormat(t *testing.T) {
+	tests := []struct {
+		contents string
+		expected map[string][]string
+		fail     bool
+	}{
+		{`{"rktKind": "volumeCleanup", "rktVersion": "v1"}`, nil, true},
+		{`{"rktKind": "volumeCleanup", "rktVersion": "v1", "volumeKind": "plugin"}`, nil, true},
+		{`{"rktKind": "volumeCleanup", "rktVersion": "v1", "command": ["/usr/bin/release-volume"]}`, nil, true},
+		{`{"rktKind": "volumeCleanup", "rktVersion": "v1", "volumeKind": "csi", "command": ["/usr/bin/release-volume"]}`, nil, true},
+		{`{"rktKind": "volumeCleanup", "rktVersion": "v1", "volumeKind": "host", "command": ["/usr/bin/release-volume"]}`, nil, true},
+		{`{"rktKind": "volumeCleanup", "rktVersion": "v1", "volumeKind": "plugin", "command": ["release-volume"]}`, nil, true},
+		{`{"rktKind": "volumeCleanup", "rktVersion": "v1", "volumeKind": "plugin", "command": ["/usr/bin/release-volume", "--force"]}`, map[string][]string{"plugin": {"/usr/bin/release-volume", "--force"}}, false},
+	}
+	for _, tt := range tests {
+		cfg, err := getConfigFromContents(tt.contents, "volumeCleanup")
+		if vErr := verifyFailure(tt.fail, tt.contents, err); vErr != nil {
+			t.Errorf("%v", vErr)
+		} else if !tt.fail && !reflect.DeepEqual(cfg.VolumeCleanupPlugins, tt.expected) {
+			t.Errorf("Got unexpected volume cleanup plugins %v, expected %v", cfg.VolumeCleanupPlugins, tt.expected)
+		}
+	}
+}
+
+func TestVolumeDriverConfigFormat(t *testing.T) {
+	tests := []struct {
+		contents string
+		expected map[string][]string
+		fail     bool
+	}{
+		{`{"rktKind": "volumeDriver", "rktVersion": "v1"}`, nil, true},
+		{`{"rktKind": "volumeDriver", "rktVersion": "v1", "driver": "nfs"}`, nil, true},
+		{`{"rktKind": "volumeDriver", "rktVersion": "v1", "command": ["/usr/libexec/rkt-nfs"]}`, nil, true},
+		{`{"rktKind": "volumeDriver", "rktVersion": "v1", "driver": "nfs", "command": ["rkt-nfs"]}`, nil, true},
+		{`{"rktKind": "volumeDriver", "rktVersion": "v1", "driver": "nfs", "command": ["/usr/libexec/rkt-nfs", "--debug"]}`, map[string][]string{"nfs": {"/usr/libexec/rkt-nfs", "--debug"}}, false},
+	}
+	for _, tt := range tests {
+		cfg, err := getConfigFromContents(tt.contents, "volumeDriver")
+		if vErr := verifyFailure(tt.fail, tt.contents, err); vErr != nil {
+			t.Errorf("%v", vErr)
+		} else if !tt.fail && !reflect.DeepEqual(cfg.VolumeDrivers, tt.expected) {
+			t.Errorf("Got unexpected volume drivers %v, expected %v", cfg.VolumeDrivers, tt.expected)
+		}
+	}
+}
+
+func TestDefaultsConfigFormat(t *testing.T) {
+	tests := []struct {
+		contents string
+		expected Defaults
+		fail     bool
+	}{
+		{`{"rktKind": "defaults", "rktVersion": "v1"}`, Defaults{}, true},
+		{`{"rktKind": "defaults", "rktVersion": "v1", "net": [""]}`, Defaults{}, true},
+		{`{"rktKind": "defaults", "rktVersion": "v1", "net": "default"}`, Defaults{}, true},
+		{`{"rktKind": "defaults", "rktVersion": "v1", "stage1Image": "/usr/lib/rkt/stage1-kvm.aci"}`, Defaults{Stage1Image: "/usr/lib/rkt/stage1-kvm.aci"}, false},
+		{`{"rktKind": "defaults", "rktVersion": "v1", "insecureOptions": ["scan"], "net": ["net1:IP=10.1.1.2", "net2"]}`, Defaults{InsecureOptions: []string{"scan"}, Net: []string{"net1:IP=10.1.1.2", "net2"}}, false},
+		{`{"rktKind": "defaults", "rktVersion": "v1", "expirePrepared": "2h"}`, Defaults{ExpirePrepared: "2h"}, false},
+		{`{"rktKind": "defaults", "rktVersion": "v1", "expirePrepared": "2 hours"}`, Defaults{}, true},
+		{`{"rktKind": "defaults", "rktVersion": "v1", "expirePrepared": "0s"}`, Defaults{}, true},
+		{`{"rktKind": "defaults", "rktVersion": "v1", "dns": "8.8.8.8,8.8.4.4"}`, Defaults{DNS: "8.8.8.8,8.8.4.4"}, false},
+		{`{"rktKind": "defaults", "rktVersion": "v1", "dns": "resolver"}`, Defaults{}, true},
+	}
+	for _, tt := range tests {
+		cfg, err := getConfigFromContents(tt.contents, "defaults")
+		if vErr := verifyFailure(tt.fail, tt.contents, err); vErr != nil {
+			t.Errorf("%v", vErr)
+		} else if !tt.fail && !reflect.DeepEqual(cfg.Defaults, tt.expected) {
+			t.Errorf("Got unexpected defaults %+v, expected %+v", cfg.Defaults, tt.expected)
+		}
+	}
+}
+
+func TestCredentialHelperConfigFormat(t *testing.T) {
+	tests := []struct {
+		contents   string
+		domains    []string
+		registries []string
+		fail       bool
+	}{
+		{`{"rktKind": "credentialHelper", "rktVersion": "v1", "helper": "ecr-login"}`, nil, nil, true},
+		{`{"rktKind": "credentialHelper", "rktVersion": "v1", "registries": ["gcr.io"]}`, nil, nil, true},
+		{`{"rktKind": "credentialHelper", "rktVersion": "v1", "registries": ["gcr.io"], "helper": "bin/docker-credential-gcr"}`, nil, nil, true},
+		{`{"rktKind": "credentialHelper", "rktVersion": "v1", "registries": ["gcr.io"], "helper": "gcr"}`, nil, []string{"gcr.io"}, false},
+		{`{"rktKind": "credentialHelper", "rktVersion": "v1", "domains": ["example.com"], "registries": ["quay.io"], "helper": "/usr/bin/docker-credential-pass"}`, []string{"example.com"}, []string{"quay.io"}, false},
+	}
+	for _, tt := range tests {
+		cfg, err := getConfigFromContents(tt.contents, "credentialHelper")
+		if vErr := verifyFailure(tt.fail, tt.contents, err); vErr != nil {
+			t.Errorf("%v", vErr)
+			continue
+		}
+		if tt.fail {
+			continue
+		}
+		if len(cfg.AuthPerHost) != len(tt.domains) {
+			t.Errorf("Got unexpected domains %v, expected %v", cfg.AuthPerHost, tt.domains)
+		}
+		for _, d := range tt.domains {
+			if _, ok := cfg.AuthPerHost[d].(*credentialHelperHeaderer); !ok {
+				t.Errorf("Expected a credential helper for domain %q, got %v", d, cfg.AuthPerHost[d])
+			}
+		}
+		if len(cfg.DockerCredentialHelpers) != len(tt.registries) {
+			t.Errorf("Got unexpected registries %v, expected %v", cfg.DockerCredentialHelpers, tt.registries)
+		}
+		for _, r := range tt.registries {
+			if _, ok := cfg.DockerCredentialHelpers[r]; !ok {
+				t.Errorf("Expected a credential helper for registry %q", r)
+			}
+		}
+	}
+}
+
+func TestCredentialHelper(t *testing.T) {
+	dir, err := ioutil.TempDir("", tstprefix)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to create temporary directory: %v", err))
+	}
+	defer os.RemoveAll(dir)
+
+	// the helper counts its invocations, to check the cache
+	script := `#!/bin/sh
+read server
+echo run >> ` + filepath.Join(dir, "runs") + `
+case "$server" in
+	token.example.com) echo '{"ServerURL": "token.example.com", "Username": "<token>", "Secret": "sometoken"}' ;;
+	basic.example.com) echo '{"ServerURL": "basic.example.com", "Username": "foo", "Secret": "bar"}' ;;
+	*) echo "credentials not found in native keychain"; exit 1 ;;
+esac
+`
+	path := filepath.Join(dir, "docker-credential-test")
+	if err := ioutil.WriteFile(path, []byte(script), 0755); err != nil {
+		panic(fmt.Sprintf("Failed to write the helper: %v", err))
+	}
+	helper, err := newCredentialHelper(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		host     string
+		expected http.Header
+	}{
+		{"token.example.com", http.Header{authHeader: []string{"Bearer sometoken"}}},
+		// foo:bar
+		{"basic.example.com", http.Header{authHeader: []string{"Basic Zm9vOmJhcg=="}}},
+		{"unknown.example.com", http.Header{}},
+		{"token.example.com", http.Header{authHeader: []string{"Bearer sometoken"}}},
+	}
+	for _, tt := range tests {
+		h := &credentialHelperHeaderer{helper: helper, host: tt.host}
+		if headers := h.Header(); !reflect.DeepEqual(headers, tt.expected) {
+			t.Errorf("Got unexpected headers %v for %q, expected %v", headers, tt.host, tt.expected)
+		}
+	}
+
+	runs, err := ioutil.ReadFile(filepath.Join(dir, "runs"))
+	if err != nil {
+		t.Fatalf("Failed to read the runs of the helper: %v", err)
+	}
+	if n := strings.Count(string(runs), "run"); n != 3 {
+		t.Errorf("Expected the helper to run 3 times, got %d", n)
+	}
+}
+
+func TestStoreEncryptionConfigFormat(t *testing.T) {
+	tests := []struct {
+		contents string
+		expected *StoreEncryption
+		fail     bool
+	}{
+		{`{"rktKind": "storeEncryption", "rktVersion": "v1"}`, nil, true},
+		{`{"rktKind": "storeEncryption", "rktVersion": "v1", "keySource": "kms"}`, nil, true},
+		{`{"rktKind": "storeEncryption", "rktVersion": "v1", "keySource": "file"}`, nil, true},
+		{`{"rktKind": "storeEncryption", "rktVersion": "v1", "keySource": "file", "path": "store.key"}`, nil, true},
+		{`{"rktKind": "storeEncryption", "rktVersion": "v1", "keySource": "tpm"}`, nil, true},
+		{`{"rktKind": "storeEncryption", "rktVersion": "v1", "keySource": "exec", "command": ["get-key"]}`, nil, true},
+		{`{"rktKind": "storeEncryption", "rktVersion": "v1", "keySource": "file", "path": "/etc/rkt/store.key"}`, &StoreEncryption{KeySource: "file", Path: "/etc/rkt/store.key"}, false},
+		{`{"rktKind": "storeEncryption", "rktVersion": "v1", "keySource": "tpm", "handle": "0x81000001"}`, &StoreEncryption{KeySource: "tpm", Handle: "0x81000001"}, false},
+		{`{"rktKind": "storeEncryption", "rktVersion": "v1", "keySource": "exec", "command": ["/usr/bin/kms-get-key", "rkt-store"]}`, &StoreEncryption{KeySource: "exec", Command: []string{"/usr/bin/kms-get-key", "rkt-store"}}, false},
+	}
+	for _, tt := range tests {
+		cfg, err := getConfigFromContents(tt.contents, "storeEncryption")
+		if vErr := verifyFailure(tt.fail, tt.contents, err); vErr != nil {
+			t.Errorf("%v", vErr)
+		} else if !tt.fail && !reflect.DeepEqual(cfg.StoreEncryption, tt.expected) {
+			t.Errorf("Got unexpected store encryption %+v, expected %+v", cfg.StoreEncryption, tt.expected)
+		}
+	}
+}
+
+func TestStoreEncryptionKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", tstprefix)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to create temporary directory: %v", err))
+	}
+	defer os.RemoveAll(dir)
+
+	raw := strings.Repeat("k", 32)
+	hexKey := strings.Repeat("6b", 32)
+	files := map[string]string{
+		"raw":   raw,
+		"hex":   hexKey + "\n",
+		"short": "k",
+		"bad":   strings.Repeat("zz", 32),
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0600); err != nil {
+			panic(fmt.Sprintf("Failed to write the key: %v", err))
+		}
+	}
+
+	tests := []struct {
+		enc  StoreEncryption
+		fail bool
+	}{
+		{StoreEncryption{KeySource: "file", Path: filepath.Join(dir, "raw")}, false},
+		{StoreEncryption{KeySource: "file", Path: filepath.Join(dir, "hex")}, false},
+		{StoreEncryption{KeySource: "file", Path: filepath.Join(dir, "short")}, true},
+		{StoreEncryption{KeySource: "file", Path: filepath.Join(dir, "bad")}, true},
+		{StoreEncryption{KeySource: "file", Path: filepath.Join(dir, "missing")}, true},
+		{StoreEncryption{KeySource: "exec", Command: []string{"/bin/sh", "-c", "echo " + hexKey}}, false},
+		{StoreEncryption{KeySource: "exec", Command: []string{"/bin/sh", "-c", "echo denied >&2; exit 1"}}, true},
+	}
+	for i, tt := range tests {
+		key, err := tt.enc.Key()
+		if tt.fail {
+			if err == nil {
+				t.Errorf("#%d: expected an error, got key %q", i, key)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+		} else if string(key) != raw {
+			t.Errorf("#%d: got key %q, expected %q", i, key, raw)
+		}
+	}
+}
+
+func TestStage1PinConfigFormat(t *testing.T) {
+	digest := "sha512-" + strings.Repeat("a", 64)
+	tests := []struct {
+		contents string
+		expected []string
+		fail     bool
+	}{
+		{`{"rktKind": "stage1Pin", "rktVersion": "v1"}`, nil, true},
+		{`{"rktKind": "stage1Pin", "rktVersion": "v1", "digests": []}`, nil, true},
+		{`{"rktKind": "stage1Pin", "rktVersion": "v1", "digests": ["sha512-aaaaaaaaaaaa"]}`, nil, true},
+		{`{"rktKind": "stage1Pin", "rktVersion": "v1", "digests": ["` + digest + `"]}`, []string{digest}, false},
+	}
+	for _, tt := range tests {
+		cfg, err := getConfigFromContents(tt.contents, "stage1Pin")
+		if vErr := verifyFailure(tt.fail, tt.contents, err); vErr != nil {
+			t.Errorf("%v", vErr)
+		} else if !tt.fail && !reflect.DeepEqual(cfg.Stage1Digests, tt.expected) {
+			t.Errorf("Got unexpected stage1 digests %v, expected %v", cfg.Stage1Digests, tt.expected)
+		}
+	}
+}
+
+func TestStage1PinMerge(t *testing.T) {
+	d1 := "sha512-" + strings.Repeat("a", 64)
+	d2 := "sha512-" + strings.Repeat("b", 64)
+	d3 := "sha512-" + strings.Repeat("c", 64)
+	tests := []struct {
+		system   []string
+		local    []string
+		expected []string
+		fail     bool
+	}{
+		{nil, nil, nil, false},
+		{[]string{d1, d2}, nil, []string{d1, d2}, false},
+		{nil, []string{d1}, []string{d1}, false},
+		// the local pins narrow down the system ones
+		{[]string{d1, d2}, []string{d2, d3}, []string{d2}, false},
+		// but cannot replace them
+		{[]string{d1}, []string{d3}, nil, true},
+	}
+	for i, tt := range tests {
+		cfg := newConfig()
+		system := newConfig()
+		system.Stage1Digests = tt.system
+		local := newConfig()
+		local.Stage1Digests = tt.local
+		err := mergeConfigs(cfg, system)
+		if err == nil {
+			err = mergeConfigs(cfg, local)
+		}
+		if (err != nil) != tt.fail {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.fail)
+			continue
+		}
+		if !tt.fail && !reflect.DeepEqual(cfg.Stage1Digests, tt.expected) {
+			t.Errorf("#%d: got stage1 digests %v, expected %v", i, cfg.Stage1Digests, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// credentialHelperPrefix is the prefix of the executables of the
+	// docker credential helpers
+	credentialHelperPrefix = "docker-credential-"
+	// credentialHelperTimeout is how long a helper may run
+	credentialHelperTimeout = 30 * time.Second
+	// tokenUsername is the username returned by the helpers for
+	// identity tokens, as in docker
+	tokenUsername = "<token>"
+)
+
+type credentialHelperV1JsonParser struct{}
+
+type credentialHelperV1 struct {
+	Domains    []string `json:"domains"`
+	Registries []string `json:"registries"`
+	Helper     string   `json:"helper"`
+}
+
+func init() {
+	addParser("credentialHelper", "v1", &credentialHelperV1JsonParser{})
+	registerSubDir("auth.d", []string{"credentialHelper"})
+}
+
+// CredentialHelper gets the credentials of a server from an executable
+// implementing the protocol of the docker credential helpers, when they are
+// needed.
+type CredentialHelper struct {
+	// Name is the name of the helper, as in the configuration
+	Name string
+
+	path  string
+	mutex sync.Mutex
+	cache map[string]BasicCredentials
+}
+
+func newCredentialHelper(name string) (*CredentialHelper, error) {
+	path := name
+	if !strings.Contains(name, "/") {
+		path = credentialHelperPrefix + name
+	} else if !filepath.IsAbs(name) {
+		return nil, fmt.Errorf("the credential helper %q must be a name or an absolute path", name)
+	}
+	return &CredentialHelper{
+		Name:  name,
+		path:  path,
+		cache: make(map[string]BasicCredentials),
+	}, nil
+}
+
+// Get runs the helper to get the credentials of the server. The credentials
+// are cached for the lifetime of the helper.
+func (h *CredentialHelper) Get(server string) (BasicCredentials, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if creds, ok := h.cache[server]; ok {
+		return creds, nil
+	}
+
+	path, err := exec.LookPath(h.path)
+	if err != nil {
+		return BasicCredentials{}, fmt.Errorf("credential helper %q not found: %v", h.Name, err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(path, "get")
+	cmd.Stdin = strings.NewReader(server)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return BasicCredentials{}, fmt.Errorf("failed to run credential helper %q: %v", h.Name, err)
+	}
+	timer := time.AfterFunc(credentialHelperTimeout, func() {
+		cmd.Process.Kill()
+	})
+	err = cmd.Wait()
+	timer.Stop()
+	if err != nil {
+		// the helpers print their errors on stdout
+		msg := strings.TrimSpace(stdout.String() + " " + stderr.String())
+		return BasicCredentials{}, fmt.Errorf("credential helper %q failed for %q: %v: %s", h.Name, server, err, msg)
+	}
+
+	var resp struct {
+		Username string
+		Secret   string
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return BasicCredentials{}, fmt.Errorf("invalid output of credential helper %q: %v", h.Name, err)
+	}
+	if resp.Secret == "" {
+		return BasicCredentials{}, fmt.Errorf("credential helper %q returned no secret for %q", h.Name, server)
+	}
+
+	creds := BasicCredentials{
+		User:     resp.Username,
+		Password: resp.Secret,
+	}
+	h.cache[server] = creds
+	return creds, nil
+}
+
+// credentialHelperHeaderer gets the credentials of a host from a credential
+// helper when the headers are needed.
+type credentialHelperHeaderer struct {
+	helper *CredentialHelper
+	host   string
+}
+
+func (h *credentialHelperHeaderer) Header() http.Header {
+	headers := make(http.Header)
+	creds, err := h.helper.Get(h.host)
+	if err != nil {
+		// Headerer cannot fail, the request is sent without
+		// credentials and should be rejected by the server
+		fmt.Fprintf(os.Stderr, "rkt: %v\n", err)
+		return headers
+	}
+
+	if creds.User == tokenUsername {
+		headers.Add(authHeader, "Bearer "+creds.Password)
+	} else {
+		encodedCreds := base64.StdEncoding.EncodeToString([]byte(creds.User + ":" + creds.Password))
+		headers.Add(authHeader, "Basic "+encodedCreds)
+	}
+
+	return headers
+}
+
+func (p *credentialHelperV1JsonParser) parse(config *Config, raw []byte) error {
+	var ch credentialHelperV1
+	if err := json.Unmarshal(raw, &ch); err != nil {
+		return err
+	}
+	if len(ch.Domains) == 0 && len(ch.Registries) == 0 {
+		return fmt.Errorf("no domains or registries specified")
+	}
+	if ch.Helper == "" {
+		return fmt.Errorf("no credential helper specified")
+	}
+	helper, err := newCredentialHelper(ch.Helper)
+	if err != nil {
+		return err
+	}
+	for _, domain := range ch.Domains {
+		if _, ok := config.AuthPerHost[domain]; ok {
+			return fmt.Errorf("auth for domain %q is already specified", domain)
+		}
+		config.AuthPerHost[domain] = &credentialHelperHeaderer{
+			helper: helper,
+			host:   domain,
+		}
+	}
+	for _, registry := range ch.Registries {
+		if _, ok := config.DockerCredentialsPerRegistry[registry]; ok {
+			return fmt.Errorf("credentials for docker registry %q are already specified", registry)
+		}
+		if _, ok := config.DockerCredentialHelpers[registry]; ok {
+			return fmt.Errorf("credentials for docker registry %q are already specified", registry)
+		}
+		config.DockerCredentialHelpers[registry] = helper
+	}
+	return nil
+}
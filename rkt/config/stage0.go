@@ -0,0 +1,316 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/common/volplugin"
+)
+
+const (
+	// OverlayAuto makes rkt use overlayfs when the host supports it
+	OverlayAuto = "auto"
+	// OverlayDisabled makes rkt never use overlayfs, as --no-overlay
+	OverlayDisabled = "disabled"
+)
+
+type overlayV1JsonParser struct{}
+
+type overlayV1 struct {
+	Mode string `json:"mode"`
+}
+
+type scanV1JsonParser struct{}
+
+type scanV1 struct {
+	Command []string `json:"command"`
+}
+
+type hooksV1JsonParser struct{}
+
+type hooksV1 struct {
+	OnPrepare []string `json:"onPrepare"`
+	OnRun     []string `json:"onRun"`
+	OnExit    []string `json:"onExit"`
+	OnGC      []string `json:"onGC"`
+}
+
+type archFallbackV1JsonParser struct{}
+
+type archFallbackV1 struct {
+	Fallbacks map[string][]string `json:"fallbacks"`
+}
+
+type volumeCleanupV1JsonParser struct{}
+
+type volumeCleanupV1 struct {
+	VolumeKind string   `json:"volumeKind"`
+	Command    []string `json:"command"`
+}
+
+type volumeDriverV1JsonParser struct{}
+
+type volumeDriverV1 struct {
+	Driver  string   `json:"driver"`
+	Command []string `json:"command"`
+}
+
+type defaultsV1JsonParser struct{}
+
+type defaultsV1 struct {
+	Stage1Image     string   `json:"stage1Image"`
+	InsecureOptions []string `json:"insecureOptions"`
+	Net             []string `json:"net"`
+	ExpirePrepared  string   `json:"expirePrepared"`
+	DNS             string   `json:"dns"`
+}
+
+type stage1PinV1JsonParser struct{}
+
+type stage1PinV1 struct {
+	Digests []string `json:"digests"`
+}
+
+func init() {
+	addParser("overlay", "v1", &overlayV1JsonParser{})
+	addParser("scan", "v1", &scanV1JsonParser{})
+	addParser("hooks", "v1", &hooksV1JsonParser{})
+	addParser("archFallback", "v1", &archFallbackV1JsonParser{})
+	addParser("volumeCleanup", "v1", &volumeCleanupV1JsonParser{})
+	addParser("volumeDriver", "v1", &volumeDriverV1JsonParser{})
+	addParser("defaults", "v1", &defaultsV1JsonParser{})
+	addParser("stage1Pin", "v1", &stage1PinV1JsonParser{})
+	registerSubDir("stage0.d", []string{"overlay", "scan", "hooks", "archFallback", "volumeCleanup", "volumeDriver", "defaults", "stage1Pin"})
+}
+
+func (p *overlayV1JsonParser) parse(config *Config, raw []byte) error {
+	var overlay overlayV1
+	if err := json.Unmarshal(raw, &overlay); err != nil {
+		return err
+	}
+	switch overlay.Mode {
+	case OverlayAuto, OverlayDisabled:
+	case "":
+		return fmt.Errorf("no overlay mode specified")
+	default:
+		return fmt.Errorf("unknown overlay mode %q, must be %q or %q", overlay.Mode, OverlayAuto, OverlayDisabled)
+	}
+	if config.OverlayMode != "" {
+		return fmt.Errorf("overlay mode is already specified")
+	}
+	config.OverlayMode = overlay.Mode
+	return nil
+}
+
+func (p *scanV1JsonParser) parse(config *Config, raw []byte) error {
+	var scan scanV1
+	if err := json.Unmarshal(raw, &scan); err != nil {
+		return err
+	}
+	if len(scan.Command) == 0 || scan.Command[0] == "" {
+		return fmt.Errorf("no scan command specified")
+	}
+	if !filepath.IsAbs(scan.Command[0]) {
+		return fmt.Errorf("the scan command %q must be an absolute path", scan.Command[0])
+	}
+	if len(config.ScanCommand) > 0 {
+		return fmt.Errorf("scan command is already specified")
+	}
+	config.ScanCommand = scan.Command
+	return nil
+}
+
+func (p *hooksV1JsonParser) parse(config *Config, raw []byte) error {
+	var hooks hooksV1
+	if err := json.Unmarshal(raw, &hooks); err != nil {
+		return err
+	}
+	if len(hooks.OnPrepare) == 0 && len(hooks.OnRun) == 0 && len(hooks.OnExit) == 0 && len(hooks.OnGC) == 0 {
+		return fmt.Errorf("no hooks specified")
+	}
+	for _, h := range []struct {
+		name    string
+		command []string
+		dest    *[]string
+	}{
+		{"onPrepare", hooks.OnPrepare, &config.Hooks.OnPrepare},
+		{"onRun", hooks.OnRun, &config.Hooks.OnRun},
+		{"onExit", hooks.OnExit, &config.Hooks.OnExit},
+		{"onGC", hooks.OnGC, &config.Hooks.OnGC},
+	} {
+		if len(h.command) == 0 {
+			continue
+		}
+		if !filepath.IsAbs(h.command[0]) {
+			return fmt.Errorf("the %s hook %q must be an absolute path", h.name, h.command[0])
+		}
+		if len(*h.dest) > 0 {
+			return fmt.Errorf("%s hook is already specified", h.name)
+		}
+		*h.dest = h.command
+	}
+	return nil
+}
+
+func (p *archFallbackV1JsonParser) parse(config *Config, raw []byte) error {
+	var fallback archFallbackV1
+	if err := json.Unmarshal(raw, &fallback); err != nil {
+		return err
+	}
+	if len(fallback.Fallbacks) == 0 {
+		return fmt.Errorf("no arch fallbacks specified")
+	}
+	for arch, fallbacks := range fallback.Fallbacks {
+		if arch == "" {
+			return fmt.Errorf("empty arch in the arch fallbacks")
+		}
+		for _, f := range fallbacks {
+			if f == "" || f == arch {
+				return fmt.Errorf("invalid fallback %q of arch %q", f, arch)
+			}
+		}
+		if _, ok := config.ArchFallbacks[arch]; ok {
+			return fmt.Errorf("the fallbacks of arch %q are already specified", arch)
+		}
+		// an empty list disables the built-in fallbacks of the arch
+		config.ArchFallbacks[arch] = append([]string{}, fallbacks...)
+	}
+	return nil
+}
+
+func (p *volumeCleanupV1JsonParser) parse(config *Config, raw []byte) error {
+	var cleanup volumeCleanupV1
+	if err := json.Unmarshal(raw, &cleanup); err != nil {
+		return err
+	}
+	// only the volumes mounted by drivers are cleaned up, the host and
+	// empty volumes are not provisioned by rkt
+	switch cleanup.VolumeKind {
+	case volplugin.Kind:
+	case "":
+		return fmt.Errorf("no volume kind specified")
+	default:
+		return fmt.Errorf("unsupported volume kind %q, must be %q", cleanup.VolumeKind, volplugin.Kind)
+	}
+	if len(cleanup.Command) == 0 || cleanup.Command[0] == "" {
+		return fmt.Errorf("no volume cleanup command specified")
+	}
+	if !filepath.IsAbs(cleanup.Command[0]) {
+		return fmt.Errorf("the volume cleanup command %q must be an absolute path", cleanup.Command[0])
+	}
+	if _, ok := config.VolumeCleanupPlugins[cleanup.VolumeKind]; ok {
+		return fmt.Errorf("the cleanup command of volume kind %q is already specified", cleanup.VolumeKind)
+	}
+	config.VolumeCleanupPlugins[cleanup.VolumeKind] = cleanup.Command
+	return nil
+}
+
+func (p *volumeDriverV1JsonParser) parse(config *Config, raw []byte) error {
+	var driver volumeDriverV1
+	if err := json.Unmarshal(raw, &driver); err != nil {
+		return err
+	}
+	if driver.Driver == "" {
+		return fmt.Errorf("no volume driver name specified")
+	}
+	if len(driver.Command) == 0 || driver.Command[0] == "" {
+		return fmt.Errorf("no volume driver command specified")
+	}
+	if !filepath.IsAbs(driver.Command[0]) {
+		return fmt.Errorf("the volume driver command %q must be an absolute path", driver.Command[0])
+	}
+	if _, ok := config.VolumeDrivers[driver.Driver]; ok {
+		return fmt.Errorf("the command of volume driver %q is already specified", driver.Driver)
+	}
+	config.VolumeDrivers[driver.Driver] = driver.Command
+	return nil
+}
+
+func (p *defaultsV1JsonParser) parse(config *Config, raw []byte) error {
+	var defaults defaultsV1
+	if err := json.Unmarshal(raw, &defaults); err != nil {
+		return err
+	}
+	if defaults.Stage1Image == "" && len(defaults.InsecureOptions) == 0 && len(defaults.Net) == 0 && defaults.ExpirePrepared == "" && defaults.DNS == "" {
+		return fmt.Errorf("no defaults specified")
+	}
+	for _, n := range defaults.Net {
+		if n == "" {
+			return fmt.Errorf("empty network in the default net")
+		}
+	}
+	if defaults.Stage1Image != "" {
+		if config.Defaults.Stage1Image != "" {
+			return fmt.Errorf("default stage1 image is already specified")
+		}
+		config.Defaults.Stage1Image = defaults.Stage1Image
+	}
+	if len(defaults.InsecureOptions) > 0 {
+		if len(config.Defaults.InsecureOptions) > 0 {
+			return fmt.Errorf("default insecure options are already specified")
+		}
+		config.Defaults.InsecureOptions = defaults.InsecureOptions
+	}
+	if len(defaults.Net) > 0 {
+		if len(config.Defaults.Net) > 0 {
+			return fmt.Errorf("default net is already specified")
+		}
+		config.Defaults.Net = defaults.Net
+	}
+	if defaults.ExpirePrepared != "" {
+		if d, err := time.ParseDuration(defaults.ExpirePrepared); err != nil || d <= 0 {
+			return fmt.Errorf("invalid default prepared expiration %q, must be a positive duration", defaults.ExpirePrepared)
+		}
+		if config.Defaults.ExpirePrepared != "" {
+			return fmt.Errorf("default prepared expiration is already specified")
+		}
+		config.Defaults.ExpirePrepared = defaults.ExpirePrepared
+	}
+	if defaults.DNS != "" {
+		if _, _, err := common.ParseFlyDNS(defaults.DNS); err != nil {
+			return fmt.Errorf("invalid default dns %q: %v", defaults.DNS, err)
+		}
+		if config.Defaults.DNS != "" {
+			return fmt.Errorf("default dns is already specified")
+		}
+		config.Defaults.DNS = defaults.DNS
+	}
+	return nil
+}
+
+func (p *stage1PinV1JsonParser) parse(config *Config, raw []byte) error {
+	var pin stage1PinV1
+	if err := json.Unmarshal(raw, &pin); err != nil {
+		return err
+	}
+	if len(pin.Digests) == 0 {
+		return fmt.Errorf("no stage1 digests specified")
+	}
+	if len(config.Stage1Digests) > 0 {
+		return fmt.Errorf("stage1 digests are already specified")
+	}
+	for _, d := range pin.Digests {
+		if err := common.ValidateStage1Digest(d); err != nil {
+			return err
+		}
+	}
+	config.Stage1Digests = pin.Digests
+	return nil
+}
@@ -0,0 +1,165 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/coreos/rkt/common"
+)
+
+const (
+	// StoreKeyFile reads the store encryption key from a file
+	StoreKeyFile = "file"
+	// StoreKeyTPM unseals the store encryption key from a TPM object
+	StoreKeyTPM = "tpm"
+	// StoreKeyExec gets the store encryption key from the output of a
+	// command, for example a client of a key management service
+	StoreKeyExec = "exec"
+
+	// storeKeyTimeout is how long getting the key may take
+	storeKeyTimeout = 30 * time.Second
+	// tpmUnsealCommand unseals the TPM objects
+	tpmUnsealCommand = "tpm2_unseal"
+)
+
+type storeEncryptionV1JsonParser struct{}
+
+type storeEncryptionV1 struct {
+	KeySource string   `json:"keySource"`
+	Path      string   `json:"path"`
+	Handle    string   `json:"handle"`
+	Command   []string `json:"command"`
+}
+
+func init() {
+	addParser("storeEncryption", "v1", &storeEncryptionV1JsonParser{})
+	registerSubDir("stage0.d", []string{"storeEncryption"})
+}
+
+// StoreEncryption is where the key encrypting the images in the store
+// comes from. Only the field of its key source is set.
+type StoreEncryption struct {
+	// KeySource is StoreKeyFile, StoreKeyTPM or StoreKeyExec
+	KeySource string
+	// Path is the file containing the key
+	Path string
+	// Handle is the handle or context file of the TPM object sealing
+	// the key
+	Handle string
+	// Command is the command, absolute path followed by the arguments,
+	// printing the key
+	Command []string
+}
+
+func (p *storeEncryptionV1JsonParser) parse(config *Config, raw []byte) error {
+	var enc storeEncryptionV1
+	if err := json.Unmarshal(raw, &enc); err != nil {
+		return err
+	}
+	if config.StoreEncryption != nil {
+		return fmt.Errorf("store encryption is already specified")
+	}
+	switch enc.KeySource {
+	case StoreKeyFile:
+		if !filepath.IsAbs(enc.Path) {
+			return fmt.Errorf("the store encryption key file %q must be an absolute path", enc.Path)
+		}
+	case StoreKeyTPM:
+		if enc.Handle == "" {
+			return fmt.Errorf("no TPM handle of the store encryption key specified")
+		}
+	case StoreKeyExec:
+		if len(enc.Command) == 0 || enc.Command[0] == "" {
+			return fmt.Errorf("no store encryption key command specified")
+		}
+		if !filepath.IsAbs(enc.Command[0]) {
+			return fmt.Errorf("the store encryption key command %q must be an absolute path", enc.Command[0])
+		}
+	case "":
+		return fmt.Errorf("no store encryption key source specified")
+	default:
+		return fmt.Errorf("unknown store encryption key source %q, must be %q, %q or %q", enc.KeySource, StoreKeyFile, StoreKeyTPM, StoreKeyExec)
+	}
+	config.StoreEncryption = &StoreEncryption{
+		KeySource: enc.KeySource,
+		Path:      enc.Path,
+		Handle:    enc.Handle,
+		Command:   enc.Command,
+	}
+	return nil
+}
+
+// Key gets the key encrypting the images in the store, either
+// common.StoreKeySize raw bytes or their hex encoding.
+func (e *StoreEncryption) Key() ([]byte, error) {
+	var (
+		out []byte
+		err error
+	)
+	switch e.KeySource {
+	case StoreKeyFile:
+		out, err = ioutil.ReadFile(e.Path)
+	case StoreKeyTPM:
+		out, err = runStoreKeyCommand(tpmUnsealCommand, "-c", e.Handle)
+	case StoreKeyExec:
+		out, err = runStoreKeyCommand(e.Command[0], e.Command[1:]...)
+	default:
+		err = fmt.Errorf("unknown key source %q", e.KeySource)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseStoreKey(out)
+}
+
+func runStoreKeyCommand(name string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to run %q: %v", name, err)
+	}
+	timer := time.AfterFunc(storeKeyTimeout, func() {
+		cmd.Process.Kill()
+	})
+	err := cmd.Wait()
+	timer.Stop()
+	if err != nil {
+		return nil, fmt.Errorf("%q failed: %v: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// parseStoreKey returns the key in b, raw or hex encoded.
+func parseStoreKey(b []byte) ([]byte, error) {
+	if len(b) == common.StoreKeySize {
+		return b, nil
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil || len(key) != common.StoreKeySize {
+		return nil, fmt.Errorf("the store encryption key must be %d bytes, raw or hex encoded", common.StoreKeySize)
+	}
+	return key, nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/pflag"
+)
+
+func TestApplyConfigDefaults(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rkt-config-test")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	system := filepath.Join(dir, "system")
+	local := filepath.Join(dir, "local")
+	for path, contents := range map[string]string{
+		filepath.Join(system, "stage0.d", "defaults.json"): `{"rktKind": "defaults", "rktVersion": "v1", "stage1Image": "/usr/lib/rkt/stage1-kvm.aci", "net": ["net1", "net2"]}`,
+		filepath.Join(local, "stage0.d", "defaults.json"):  `{"rktKind": "defaults", "rktVersion": "v1", "net": ["host"]}`,
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("error creating config dir: %v", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatalf("error writing config: %v", err)
+		}
+	}
+
+	oldSystem, oldLocal := globalFlags.SystemConfigDir, globalFlags.LocalConfigDir
+	globalFlags.SystemConfigDir, globalFlags.LocalConfigDir = system, local
+	defer func() {
+		globalFlags.SystemConfigDir, globalFlags.LocalConfigDir = oldSystem, oldLocal
+	}()
+
+	tests := []struct {
+		args  []string
+		image string
+		net   string
+	}{
+		{nil, "/usr/lib/rkt/stage1-kvm.aci", "host"},
+		{[]string{"--stage1-image=/tmp/stage1.aci"}, "/tmp/stage1.aci", "host"},
+		{[]string{"--net=default"}, "/usr/lib/rkt/stage1-kvm.aci", "default"},
+	}
+
+	for i, tt := range tests {
+		flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+		image := flags.String(stage1ImageFlagName, "/usr/lib/rkt/stage1.aci", "")
+		net := flags.String("net", "", "")
+		if err := flags.Parse(tt.args); err != nil {
+			t.Fatalf("#%d: error parsing flags: %v", i, err)
+		}
+
+		if err := applyConfigDefaults(flags, stage1ImageFlagName, "net"); err != nil {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+			continue
+		}
+		if *image != tt.image {
+			t.Errorf("#%d: got stage1 image %q, want %q", i, *image, tt.image)
+		}
+		if *net != tt.net {
+			t.Errorf("#%d: got net %q, want %q", i, *net, tt.net)
+		}
+	}
+}
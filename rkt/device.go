@@ -0,0 +1,90 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/pflag"
+	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/common/device"
+	"github.com/coreos/rkt/stage0"
+	"github.com/coreos/rkt/store"
+)
+
+var flagDevices deviceList
+
+// deviceList implements the flag.Value interface to contain the host
+// devices exposed to the apps of a pod
+type deviceList []*device.Device
+
+func (dl *deviceList) Set(s string) error {
+	d, err := device.Parse(s)
+	if err != nil {
+		return err
+	}
+	if err := d.CheckHost(); err != nil {
+		return err
+	}
+	*dl = append(*dl, d)
+	return nil
+}
+
+func (dl *deviceList) String() string {
+	var ds []string
+	for _, d := range *dl {
+		ds = append(ds, d.String())
+	}
+	return strings.Join(ds, " ")
+}
+
+func (dl *deviceList) Type() string {
+	return "deviceList"
+}
+
+// addDeviceFlag adds the flag exposing host devices to the apps of the pods.
+// They are passed to stage1 as a pod annotation.
+func addDeviceFlag(flags *pflag.FlagSet) {
+	flags.Var(&flagDevices, "device", "host device exposed to the apps, in the form HOSTPATH[:PODPATH][:PERMS] with PERMS a combination of r, w and m (default rwm). Not supported by the kvm stage1")
+}
+
+// deviceAnnotations returns the pod annotations corresponding to the device
+// flags.
+func deviceAnnotations() types.Annotations {
+	var annotations types.Annotations
+	if len(flagDevices) > 0 {
+		annotations.Set(types.ACIdentifier(common.DevicesAnnotation), device.FormatList(flagDevices))
+	}
+	return annotations
+}
+
+// checkDevicesStage1 checks that the stage1 image s1img supports the device
+// flags, before the pod is created: the kvm flavor does not pass the host
+// devices through to the virtual machine.
+func checkDevicesStage1(s *store.Store, s1img types.Hash) error {
+	if len(flagDevices) == 0 {
+		return nil
+	}
+	flavor, err := stage0.Stage1Flavor(s, s1img)
+	if err != nil {
+		return err
+	}
+	if flavor == "kvm" {
+		return fmt.Errorf("--device is not supported by the kvm stage1 flavor")
+	}
+	return nil
+}
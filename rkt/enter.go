@@ -19,22 +19,27 @@ package main
 import (
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/cobra"
+	"github.com/coreos/rkt/Godeps/_workspace/src/golang.org/x/crypto/ssh/terminal"
 	"github.com/coreos/rkt/common"
 	"github.com/coreos/rkt/stage0"
-	"github.com/coreos/rkt/store"
 )
 
 var (
 	cmdEnter = &cobra.Command{
-		Use:   "enter [--app=APPNAME] UUID [CMD [ARGS ...]]",
+		Use:   "enter [--app=APPNAME] [--env=NAME=VALUE ...] [--working-dir=DIR] UUID [CMD [ARGS ...]]",
 		Short: "Enter the namespaces of an app within a rkt pod",
+		Long:  `Without a terminal on its standard input, a command must be given. rkt exits with the exit status of the command.`,
 		Run:   runWrapper(runEnter),
 	}
-	flagAppName string
+	flagAppName    string
+	flagEnterEnv   envMap
+	flagWorkingDir string
 )
 
 const (
@@ -44,6 +49,8 @@ const (
 func init() {
 	cmdRkt.AddCommand(cmdEnter)
 	cmdEnter.Flags().StringVar(&flagAppName, "app", "", "name of the app to enter within the specified pod")
+	cmdEnter.Flags().VarP(&flagEnterEnv, "env", "e", "environment variable to set for the command, overriding the environment of the app, in the form name=value")
+	cmdEnter.Flags().StringVarP(&flagWorkingDir, "working-dir", "w", "", "absolute working directory of the command in the app (default /)")
 
 	// Disable interspersed flags to stop parsing after the first non flag
 	// argument. This is need to permit to correctly handle
@@ -69,6 +76,11 @@ func runEnter(cmd *cobra.Command, args []string) (exit int) {
 		return 1
 	}
 
+	if flagWorkingDir != "" && !filepath.IsAbs(flagWorkingDir) {
+		stderr("The working directory %q must be absolute", flagWorkingDir)
+		return 1
+	}
+
 	podPID, err := p.getContainerPID1()
 	if err != nil {
 		stderr("Unable to determine the pid for pod %q: %v", p.uuid, err)
@@ -87,7 +99,7 @@ func runEnter(cmd *cobra.Command, args []string) (exit int) {
 		return 1
 	}
 
-	s, err := store.NewStore(globalFlags.Dir)
+	s, err := newStore()
 	if err != nil {
 		stderr("Cannot open store: %v", err)
 		return 1
@@ -101,7 +113,11 @@ func runEnter(cmd *cobra.Command, args []string) (exit int) {
 
 	stage1RootFS := s.GetTreeStoreRootFS(stage1TreeStoreID)
 
-	if err = stage0.Enter(p.path(), podPID, *appName, stage1RootFS, argv); err != nil {
+	cfg := stage0.EnterConfig{
+		Env:        flagEnterEnv.Strings(),
+		WorkingDir: flagWorkingDir,
+	}
+	if err = stage0.Enter(p.path(), podPID, *appName, stage1RootFS, argv, cfg); err != nil {
 		stderr("Enter failed: %v", err)
 		return 1
 	}
@@ -110,14 +126,10 @@ func runEnter(cmd *cobra.Command, args []string) (exit int) {
 }
 
 // getAppName returns the app name to enter
-// If one was supplied in the flags then it's simply returned
+// If one was supplied in the flags then it's returned if the PM contains it
 // If the PM contains a single app, that app's name is returned
 // If the PM has multiple apps, the names are printed and an error is returned
 func getAppName(p *pod) (*types.ACName, error) {
-	if flagAppName != "" {
-		return types.NewACName(flagAppName)
-	}
-
 	// figure out the app name, or show a list if multiple are present
 	b, err := ioutil.ReadFile(common.PodManifestPath(p.path()))
 	if err != nil {
@@ -129,6 +141,21 @@ func getAppName(p *pod) (*types.ACName, error) {
 		return nil, fmt.Errorf("invalid pod manifest: %v", err)
 	}
 
+	if flagAppName != "" {
+		name, err := types.NewACName(flagAppName)
+		if err != nil {
+			return nil, err
+		}
+		if m.Apps.Get(*name) != nil {
+			return name, nil
+		}
+		stderr("Pod contains the following apps:")
+		for _, ra := range m.Apps {
+			stderr("\t%v", ra.Name)
+		}
+		return nil, fmt.Errorf("app %q not found in pod", flagAppName)
+	}
+
 	switch len(m.Apps) {
 	case 0:
 		return nil, fmt.Errorf("pod contains zero apps")
@@ -149,6 +176,10 @@ func getAppName(p *pod) (*types.ACName, error) {
 func getEnterArgv(p *pod, cmdArgs []string) ([]string, error) {
 	var argv []string
 	if len(cmdArgs) < 2 {
+		// do not wait for a shell reading the commands of a script
+		if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+			return nil, fmt.Errorf("no command specified and the standard input is not a terminal")
+		}
 		stderr("No command specified, assuming %q", defaultCmd)
 		argv = []string{defaultCmd}
 	} else {
@@ -15,11 +15,12 @@
 package main
 
 import (
+	"fmt"
+	"os"
 	"runtime"
 
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
 	"github.com/coreos/rkt/common/apps"
-	"github.com/coreos/rkt/store"
 
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/cobra"
 )
@@ -33,8 +34,14 @@ var (
 	cmdFetch = &cobra.Command{
 		Use:   "fetch IMAGE_URL...",
 		Short: "Fetch image(s) and store them in the local store",
-		Run:   runWrapper(runFetch),
+		Long: `The images listed in the file given with --prefetch-list, one per line, are fetched
+concurrently with the images given as arguments, with a shared progress bar.`,
+		Run: runWrapper(runFetch),
 	}
+	flagPrefetchList string
+	flagPrefetchJobs int
+
+	flagRenderInBackground bool
 )
 
 func init() {
@@ -45,8 +52,11 @@ func init() {
 	cmdFetch.Flags().SetInterspersed(false)
 
 	cmdFetch.Flags().Var((*appAsc)(&rktApps), "signature", "local signature file to use in validating the preceding image")
-	cmdFetch.Flags().BoolVar(&flagStoreOnly, "store-only", false, "use only available images in the store (do not discover or download from remote URLs)")
-	cmdFetch.Flags().BoolVar(&flagNoStore, "no-store", false, "fetch images ignoring the local store")
+	addPullPolicyFlag(cmdFetch.Flags())
+	addArchFlag(cmdFetch.Flags())
+	cmdFetch.Flags().StringVar(&flagPrefetchList, "prefetch-list", "", "file listing images to fetch concurrently, one per line")
+	cmdFetch.Flags().IntVar(&flagPrefetchJobs, "prefetch-jobs", 4, "number of images of the prefetch list fetched at the same time")
+	cmdFetch.Flags().BoolVar(&flagRenderInBackground, "render-in-background", false, "render the fetched images in the tree store in the background, instead of when a pod first uses them")
 }
 
 func runFetch(cmd *cobra.Command, args []string) (exit int) {
@@ -55,53 +65,108 @@ func runFetch(cmd *cobra.Command, args []string) (exit int) {
 		return 1
 	}
 
-	if rktApps.Count() < 1 {
-		stderr("fetch: must provide at least one image")
-		return 1
+	var prefetch []string
+	if flagPrefetchList != "" {
+		f, err := os.Open(flagPrefetchList)
+		if err != nil {
+			stderr("fetch: cannot open prefetch list: %v", err)
+			return 1
+		}
+		prefetch, err = readPrefetchList(f)
+		f.Close()
+		if err != nil {
+			stderr("fetch: cannot read prefetch list %q: %v", flagPrefetchList, err)
+			return 1
+		}
 	}
 
-	if flagStoreOnly && flagNoStore {
-		stderr("both --store-only and --no-store specified")
+	if rktApps.Count() < 1 && len(prefetch) < 1 {
+		stderr("fetch: must provide at least one image")
 		return 1
 	}
 
-	s, err := store.NewStore(globalFlags.Dir)
+	policy, err := getPullPolicy(cmd.Flags())
 	if err != nil {
-		stderr("fetch: cannot open store: %v", err)
+		stderr("fetch: %v", err)
 		return 1
 	}
+
 	ks := getKeystore()
 	config, err := getConfig()
 	if err != nil {
 		stderr("fetch: cannot get configuration: %v", err)
 		return 1
 	}
-	ft := &fetcher{
-		imageActionData: imageActionData{
-			s:                  s,
-			ks:                 ks,
-			headers:            config.AuthPerHost,
-			dockerAuth:         config.DockerCredentialsPerRegistry,
-			insecureSkipVerify: globalFlags.InsecureSkipVerify,
-			debug:              globalFlags.Debug,
-		},
-		storeOnly: flagStoreOnly,
-		noStore:   flagNoStore,
-		withDeps:  true,
+	// newFetcher opens a store for each fetcher, since the store cannot
+	// be used by several goroutines at the same time
+	newFetcher := func() (*fetcher, error) {
+		s, err := newStore()
+		if err != nil {
+			return nil, fmt.Errorf("cannot open store: %v", err)
+		}
+		return &fetcher{
+			imageActionData: imageActionData{
+				s:                  s,
+				ks:                 ks,
+				headers:            config.AuthPerHost,
+				dockerAuth:         config.DockerCredentialsPerRegistry,
+				dockerHelpers:      config.DockerCredentialHelpers,
+				archFallbacks:      config.ArchFallbacks,
+				insecureSkipVerify: globalFlags.InsecureSkipVerify,
+				debug:              globalFlags.Debug,
+			},
+			storeOnly: policy.storeOnly(),
+			noStore:   policy.noStore(),
+			noCache:   policy.noCache(),
+			withDeps:  true,
+		}, nil
 	}
 
-	err = rktApps.Walk(func(app *apps.App) error {
-		hash, err := ft.fetchImage(app.Image, app.Asc)
+	var fetched []string
+	if len(prefetch) > 0 {
+		// the images given as arguments, which can have a
+		// signature file, are fetched one by one afterwards
+		hashes, err := prefetchImages(newFetcher, prefetch, flagPrefetchJobs)
 		if err != nil {
-			return err
+			stderr("fetch: %v", err)
+			return 1
+		}
+		for _, hash := range hashes {
+			stdout("%s", types.ShortHash(hash))
+		}
+		fetched = append(fetched, hashes...)
+	}
+
+	if rktApps.Count() > 0 {
+		ft, err := newFetcher()
+		if err != nil {
+			stderr("fetch: %v", err)
+			return 1
+		}
+		defer ft.s.Close()
+
+		err = rktApps.Walk(func(app *apps.App) error {
+			hash, err := ft.fetchImage(app.Image, app.Asc)
+			if err != nil {
+				return err
+			}
+			stdout("%s", types.ShortHash(hash))
+			fetched = append(fetched, hash)
+			return nil
+		})
+		if err != nil {
+			stderr("%v", err)
+			return 1
+		}
+	}
+
+	// the images are otherwise rendered in the tree store by the first
+	// pod using them
+	if flagRenderInBackground {
+		if err := prerenderInBackground(fetched); err != nil {
+			stderr("fetch: cannot start rendering the images in the background: %v", err)
+			return 1
 		}
-		shortHash := types.ShortHash(hash)
-		stdout(shortHash)
-		return nil
-	})
-	if err != nil {
-		stderr("%v", err)
-		return 1
 	}
 
 	return
@@ -726,3 +726,49 @@ func TestUseCached(t *testing.T) {
 		t.Errorf("expected useCached to return true")
 	}
 }
+
+func TestNewDiscoveryAppArch(t *testing.T) {
+	defer func() { flagArch = "" }()
+
+	flagArch = "aarch64"
+	tests := []struct {
+		in   string
+		arch string
+	}{
+		{"example.com/app", "aarch64"},
+		{"example.com/app:1.0.0,arch=armv7l", "armv7l"},
+	}
+	for i, tt := range tests {
+		app := newDiscoveryApp(tt.in)
+		if app == nil {
+			t.Fatalf("#%d: unexpected nil app", i)
+		}
+		if arch := app.Labels["arch"]; arch != tt.arch {
+			t.Errorf("#%d: got arch %q, want %q", i, arch, tt.arch)
+		}
+	}
+}
+
+func TestGetArchFallbacks(t *testing.T) {
+	configured := map[string][]string{
+		"aarch64": []string{},
+		"amd64":   []string{"i386"},
+	}
+	tests := []struct {
+		arch       string
+		configured map[string][]string
+		fallbacks  []string
+	}{
+		{"aarch64", nil, []string{"armv7l", "armv6l"}},
+		{"aarch64", configured, []string{}},
+		{"armv7l", configured, []string{"armv6l"}},
+		{"amd64", nil, nil},
+		{"amd64", configured, []string{"i386"}},
+	}
+	for i, tt := range tests {
+		fallbacks := getArchFallbacks(tt.arch, tt.configured)
+		if !reflect.DeepEqual(fallbacks, tt.fallbacks) {
+			t.Errorf("#%d: got fallbacks %v, want %v", i, fallbacks, tt.fallbacks)
+		}
+	}
+}
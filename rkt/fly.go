@@ -0,0 +1,436 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/cobra"
+	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/common/apps"
+	"github.com/coreos/rkt/pkg/lock"
+	"github.com/coreos/rkt/pkg/uid"
+	"github.com/coreos/rkt/stage0"
+	"github.com/coreos/rkt/store"
+)
+
+const (
+	// flyStage1ImageName is the name of the fly stage1 image, looked
+	// for in the directory of the default stage1 image and in the
+	// directory of rkt itself.
+	flyStage1ImageName = "stage1-fly.aci"
+)
+
+var (
+	cmdFly = &cobra.Command{
+		Use:   "fly [command]",
+		Short: "Run host tools with the fly stage1",
+		Long: `The fly stage1 runs the app of a pod directly on the host, in a chroot of its
+image, without the isolation of a container. It is meant for the tools which
+manage the host, and need its network, devices and file systems.`,
+	}
+	cmdFlyRun = &cobra.Command{
+		Use:   "run [--volume=name,kind=host,...] [--mount volume=VOL,target=PATH] IMAGE [-- image-args...[---]]",
+		Short: "Run an image on the host with the fly stage1",
+		Long: `IMAGE should be a string referencing an image; either a hash, local file on disk, or URL.
+
+The app uses the network of the host, and the /proc, /dev and /sys of the host
+are mounted in its rootfs. Unless --default-volumes=false is given, the
+following host directories are mounted at the same path, if they exist and are
+not the target of another mount: ` + flyDefaultVolumesHelp() + `.`,
+		Run: runWrapper(runFlyRun),
+	}
+	flagFlyDefaultVolumes bool
+	flagFlyUID            string
+	flagFlyGID            string
+	flagFlyMountsAllow    string
+	flagFlyDNS            string
+)
+
+// flyHostVolume is a host directory mounted in the apps run with rkt fly by
+// default.
+type flyHostVolume struct {
+	name     types.ACName
+	path     string
+	readOnly bool
+}
+
+var flyDefaultVolumes = []flyHostVolume{
+	{"fly-host-run", "/run", false},
+	{"fly-host-var-log", "/var/log", false},
+	{"fly-host-etc-ssl-certs", "/etc/ssl/certs", true},
+	{"fly-host-lib-modules", "/lib/modules", true},
+}
+
+func init() {
+	cmdRkt.AddCommand(cmdFly)
+	cmdFly.AddCommand(cmdFlyRun)
+
+	cmdFlyRun.Flags().String(stage1ImageFlagName, flyStage1ImageName, "fly stage1 image to use. Local paths and http/https URLs are supported. By default, rkt uses the one embedded in it or, if it has none, looks for a file called \""+flyStage1ImageName+"\" in the directory of the default stage1 image, then in the same directory as rkt itself")
+	cmdFlyRun.Flags().BoolVar(&flagFlyDefaultVolumes, "default-volumes", true, "mount the default host directories in the app")
+	cmdFlyRun.Flags().BoolVar(&flagInheritEnv, "inherit-env", false, "inherit all environment variables not set by apps")
+	cmdFlyRun.Flags().BoolVar(&flagNoOverlay, "no-overlay", false, "disable overlay filesystem, overriding the configuration")
+	cmdFlyRun.Flags().Var(&flagExplicitEnv, "set-env", "an environment variable to set for apps in the form name=value")
+	cmdFlyRun.Flags().BoolVar(&flagInteractive, "interactive", false, "run the app interactively")
+	cmdFlyRun.Flags().StringVar(&flagFlyUID, "fly-uid", "", "numeric uid the app runs as, overriding the user of the image")
+	cmdFlyRun.Flags().StringVar(&flagFlyGID, "fly-gid", "", "numeric gid the app runs as, overriding the group of the image")
+	cmdFlyRun.Flags().StringVar(&flagFlyDNS, "dns", common.FlyDNSHost, "resolv.conf and hosts files of the app: 'host' for the ones of the host, 'none' for no name server, or a comma-separated list of name server IPs; specific to rkt fly")
+	cmdFlyRun.Flags().StringVar(&flagFlyMountsAllow, "fly-mounts-allow", "", "comma-separated list of the host paths the volumes of the pod can be in")
+	addMountProfileFlag(cmdFlyRun.Flags())
+	addPullPolicyFlag(cmdFlyRun.Flags())
+	cmdFlyRun.Flags().StringVar(&flagUUIDFileSave, "uuid-file-save", "", "write out pod UUID to specified file")
+	cmdFlyRun.Flags().StringVar(&flagPodUUID, "uuid", "", "UUID of the pod, instead of a random one. It must be a version 4 UUID, not used by another pod")
+	cmdFlyRun.Flags().Var((*appsVolume)(&rktApps), "volume", "volumes to make available in the pod")
+
+	// per-app flags
+	cmdFlyRun.Flags().Var((*appAsc)(&rktApps), "signature", "local signature file to use in validating the preceding image")
+	cmdFlyRun.Flags().Var((*appExec)(&rktApps), "exec", "override the exec command for the preceding image")
+	cmdFlyRun.Flags().Var((*appMount)(&rktApps), "mount", "mount point binding a volume to a path within an app")
+	cmdFlyRun.Flags().Var((*appAppArmor)(&rktApps), "apparmor", "name of the AppArmor profile confining the preceding image")
+
+	// Disable interspersed flags to stop parsing after the first non flag
+	// argument. All the subsequent parsing will be done by parseApps.
+	cmdFlyRun.Flags().SetInterspersed(false)
+}
+
+func flyDefaultVolumesHelp() string {
+	var paths []string
+	for _, v := range flyDefaultVolumes {
+		paths = append(paths, v.path)
+	}
+	return strings.Join(paths, ", ")
+}
+
+// addFlyDefaultVolumes adds the host volumes in defaults, and their mounts,
+// to the apps. The paths which do not exist on the host, or are already the
+// target of a mount, are skipped. If allow is not nil, the paths which are
+// not in the host paths it allows are skipped too.
+func addFlyDefaultVolumes(al *apps.Apps, defaults []flyHostVolume, allow []string) {
+	mounted := make(map[string]bool)
+	for _, m := range al.Mounts {
+		mounted[filepath.Clean(m.Path)] = true
+	}
+	if app := al.Last(); app != nil {
+		for _, m := range app.Mounts {
+			mounted[filepath.Clean(m.Path)] = true
+		}
+	}
+	named := make(map[types.ACName]bool)
+	for _, v := range al.Volumes {
+		named[v.Name] = true
+	}
+
+	for _, d := range defaults {
+		if mounted[d.path] || named[d.name] {
+			continue
+		}
+		if _, err := os.Stat(d.path); err != nil {
+			continue
+		}
+		if allow != nil {
+			if ok, err := common.IsFlyMountAllowed(d.path, allow); err != nil || !ok {
+				continue
+			}
+		}
+		readOnly := d.readOnly
+		al.Volumes = append(al.Volumes, types.Volume{
+			Name:     d.name,
+			Kind:     "host",
+			Source:   d.path,
+			ReadOnly: &readOnly,
+		})
+		al.Mounts = append(al.Mounts, schema.Mount{Volume: d.name, Path: d.path})
+	}
+}
+
+// flyIDAnnotations returns the pod annotations overriding the user and
+// group of the app, or an error if the uid or gid given is not numeric.
+func flyIDAnnotations(uid, gid string) (types.Annotations, error) {
+	var annotations types.Annotations
+	for _, id := range []struct {
+		flag, value, annotation string
+	}{
+		{"fly-uid", uid, common.FlyUIDAnnotation},
+		{"fly-gid", gid, common.FlyGIDAnnotation},
+	} {
+		if id.value == "" {
+			continue
+		}
+		if n, err := strconv.Atoi(id.value); err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid --%s %q, must be a numeric id", id.flag, id.value)
+		}
+		annotations.Set(types.ACIdentifier(id.annotation), id.value)
+	}
+	return annotations, nil
+}
+
+// getFlyStage1Hash returns the hash of the fly stage1 image given with
+// --stage1-image, of the one embedded in the rkt binary, or of the one
+// installed along with rkt, fetched according to the pull policy.
+func getFlyStage1Hash(s *store.Store, cmd *cobra.Command, policy pullPolicy) (*types.Hash, error) {
+	fn := &finder{
+		imageActionData: imageActionData{
+			s: s,
+		},
+		storeOnly: policy.storeOnly(),
+		noStore:   policy.noStore(),
+		noCache:   policy.noCache(),
+	}
+
+	imageFlag := cmd.Flags().Lookup(stage1ImageFlagName)
+	if imageFlag.Changed {
+		return getCustomStage1Hash(fn, imageFlag.Value.String())
+	}
+
+	var errs []string
+	s1img, err := getEmbeddedFlyStage1Hash(fn)
+	if s1img != nil {
+		return s1img, nil
+	}
+	if err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	var paths []string
+	if dir := filepath.Dir(defaultStage1Image); filepath.IsAbs(dir) {
+		paths = append(paths, filepath.Join(dir, flyStage1ImageName))
+	}
+	if exePath, err := os.Readlink("/proc/self/exe"); err == nil {
+		paths = append(paths, filepath.Join(filepath.Dir(exePath), flyStage1ImageName))
+	}
+
+	for _, path := range paths {
+		s1img, err := fn.findImage(path, "")
+		if err == nil {
+			return s1img, nil
+		}
+		errs = append(errs, err.Error())
+	}
+	return nil, fmt.Errorf("cannot find the fly stage1 image %q, use --%s: %s", flyStage1ImageName, stage1ImageFlagName, strings.Join(errs, ", "))
+}
+
+func runFlyRun(cmd *cobra.Command, args []string) (exit int) {
+	if err := applyConfigDefaults(cmd.Flags(), "dns"); err != nil {
+		stderr("fly: %v", err)
+		return 1
+	}
+
+	err := parseApps(&rktApps, args, cmd.Flags(), true)
+	if err != nil {
+		stderr("fly: error parsing app image arguments: %v", err)
+		return 1
+	}
+
+	policy, err := getPullPolicy(cmd.Flags())
+	if err != nil {
+		stderr("fly: %v", err)
+		return 1
+	}
+
+	if rktApps.Count() != 1 {
+		stderr("fly: must provide exactly one image")
+		return 1
+	}
+
+	if err := validateMountProfileFlag(); err != nil {
+		stderr("fly: %v", err)
+		return 1
+	}
+
+	podAnnotations, err := flyIDAnnotations(flagFlyUID, flagFlyGID)
+	if err != nil {
+		stderr("fly: %v", err)
+		return 1
+	}
+
+	var mountsAllow []string
+	if cmd.Flags().Lookup("fly-mounts-allow").Changed {
+		if mountsAllow, err = common.ParseFlyMountsAllow(flagFlyMountsAllow); err != nil {
+			stderr("fly: invalid --fly-mounts-allow: %v", err)
+			return 1
+		}
+		podAnnotations.Set(common.FlyMountsAllowAnnotation, strings.Join(mountsAllow, ","))
+	}
+
+	if cmd.Flags().Lookup("dns").Changed {
+		if _, _, err := common.ParseFlyDNS(flagFlyDNS); err != nil {
+			stderr("fly: invalid --dns: %v", err)
+			return 1
+		}
+		podAnnotations.Set(common.FlyDNSAnnotation, flagFlyDNS)
+	}
+
+	// the DNS mode mounts its own resolv.conf
+	addMountProfiles(&rktApps, flagMountProfiles, cmd.Flags().Lookup("dns").Changed)
+	if flagFlyDefaultVolumes {
+		addFlyDefaultVolumes(&rktApps, flyDefaultVolumes, mountsAllow)
+	}
+
+	s, err := newStore()
+	if err != nil {
+		stderr("fly: cannot open store: %v", err)
+		return 1
+	}
+
+	config, err := getConfig()
+	if err != nil {
+		stderr("fly: cannot get configuration: %v", err)
+		return 1
+	}
+	fn := &finder{
+		imageActionData: imageActionData{
+			s:                  s,
+			headers:            config.AuthPerHost,
+			dockerAuth:         config.DockerCredentialsPerRegistry,
+			dockerHelpers:      config.DockerCredentialHelpers,
+			archFallbacks:      config.ArchFallbacks,
+			insecureSkipVerify: globalFlags.InsecureSkipVerify,
+			debug:              globalFlags.Debug,
+		},
+		storeOnly: policy.storeOnly(),
+		noStore:   policy.noStore(),
+		noCache:   policy.noCache(),
+		withDeps:  false,
+	}
+
+	s1img, err := getFlyStage1Hash(s, cmd, policy)
+	if err != nil {
+		stderr("fly: %v", err)
+		return 1
+	}
+
+	fn.ks = getKeystore()
+	fn.withDeps = true
+	if err := fn.findImages(&rktApps); err != nil {
+		stderr("fly: %v", err)
+		return 1
+	}
+
+	podUUID, err := getNewPodUUID()
+	if err != nil {
+		stderr("fly: %v", err)
+		return 1
+	}
+	p, err := newPod(podUUID)
+	if err != nil {
+		stderr("Error creating new pod: %v", err)
+		return 1
+	}
+
+	// if requested, write out pod UUID early so "rkt rm" can
+	// clean it up even if something goes wrong
+	if flagUUIDFileSave != "" {
+		if err := writeUUIDToFile(p.uuid, flagUUIDFileSave); err != nil {
+			stderr("Error saving pod UUID to file: %v", err)
+			return 1
+		}
+	}
+
+	cfg := stage0.CommonConfig{
+		Store:         s,
+		Stage1Image:   *s1img,
+		UUID:          p.uuid,
+		Debug:         globalFlags.Debug,
+		Stage1Digests: config.Stage1Digests,
+	}
+
+	overlay, noOverlayReason := useOverlay(cmd.Flags(), config.OverlayMode)
+	pcfg := stage0.PrepareConfig{
+		CommonConfig:    cfg,
+		UseOverlay:      overlay,
+		NoOverlayReason: noOverlayReason,
+		PrivateUsers:    uid.NewBlankUidRange(),
+		InheritEnv:      flagInheritEnv,
+		ExplicitEnv:     flagExplicitEnv.Strings(),
+		Apps:            &rktApps,
+		Annotations:     podAnnotations,
+		VolumeDrivers:   config.VolumeDrivers,
+	}
+
+	if globalFlags.Debug {
+		stage0.InitDebug()
+	}
+
+	keyLock, err := lock.SharedKeyLock(lockDir(), common.PrepareLock)
+	if err != nil {
+		stderr("rkt: cannot get shared prepare lock: %v", err)
+		return 1
+	}
+	err = stage0.Prepare(pcfg, p.path(), p.uuid)
+	if err != nil {
+		stderr("fly: error setting up stage0: %v", err)
+		keyLock.Close()
+		return 1
+	}
+	keyLock.Close()
+
+	apps, err := p.getApps()
+	if err != nil {
+		stderr("fly: cannot get the appList in the pod manifest: %v", err)
+		return 1
+	}
+
+	if err := scanImages(s, config, apps); err != nil {
+		stderr("fly: %v", err)
+		return 1
+	}
+
+	// get the lock fd for run
+	lfd, err := p.Fd()
+	if err != nil {
+		stderr("Error getting pod lock fd: %v", err)
+		return 1
+	}
+
+	// skip prepared by jumping directly to run, we own this pod
+	if err := p.xToRun(); err != nil {
+		stderr("fly: unable to transition to run: %v", err)
+		return 1
+	}
+
+	rktgid, err := common.LookupGid(common.RktGroup)
+	if err != nil {
+		stderr("fly: group %q not found, will use default gid when rendering images", common.RktGroup)
+		rktgid = -1
+	}
+
+	// the fly stage1 only supports the network of the host
+	var hostNet common.NetList
+	if err := hostNet.Set("host"); err != nil {
+		stderr("fly: %v", err)
+		return 1
+	}
+
+	rcfg := stage0.RunConfig{
+		CommonConfig: cfg,
+		Net:          hostNet,
+		LockFd:       lfd,
+		Interactive:  flagInteractive,
+		LocalConfig:  globalFlags.LocalConfigDir,
+		RktGid:       rktgid,
+		Apps:         apps,
+	}
+	stage0.Run(rcfg, p.path(), globalFlags.Dir) // execs, never returns
+
+	return 1
+}
@@ -0,0 +1,97 @@
+// Copyright 2016 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/version"
+)
+
+const (
+	// flyEmbedMagic ends the fly stage1 image appended to the rkt
+	// binary by stage1_fly/stage1_fly.mk, keep them in sync
+	flyEmbedMagic = "rkt-stage1-fly01"
+	// flyEmbedSizeLen is the length of the zero-padded decimal size
+	// of the appended image, written just before flyEmbedMagic
+	flyEmbedSizeLen    = 20
+	flyEmbedTrailerLen = flyEmbedSizeLen + len(flyEmbedMagic)
+	flyStage1Name      = "coreos.com/rkt/stage1-fly"
+)
+
+// embeddedFlyStage1 returns a reader of the fly stage1 image appended
+// to the given rkt binary, or nil if the binary has none.
+func embeddedFlyStage1(exe io.ReaderAt, exeSize int64) (*io.SectionReader, error) {
+	if exeSize < int64(flyEmbedTrailerLen) {
+		return nil, nil
+	}
+	trailer := make([]byte, flyEmbedTrailerLen)
+	if _, err := exe.ReadAt(trailer, exeSize-int64(flyEmbedTrailerLen)); err != nil {
+		return nil, err
+	}
+	if string(trailer[flyEmbedSizeLen:]) != flyEmbedMagic {
+		return nil, nil
+	}
+	size, err := strconv.ParseInt(string(trailer[:flyEmbedSizeLen]), 10, 64)
+	if err != nil || size <= 0 || size > exeSize-int64(flyEmbedTrailerLen) {
+		return nil, fmt.Errorf("invalid size %q of the embedded fly stage1 image", trailer[:flyEmbedSizeLen])
+	}
+	return io.NewSectionReader(exe, exeSize-int64(flyEmbedTrailerLen)-size, size), nil
+}
+
+// getEmbeddedFlyStage1Hash returns the hash of the fly stage1 image
+// embedded in the rkt binary, importing it in the store unless an image
+// of the same version is already there. It returns nil if the binary
+// was built without it.
+func getEmbeddedFlyStage1Hash(fn *finder) (*types.Hash, error) {
+	exe, err := os.Open("/proc/self/exe")
+	if err != nil {
+		return nil, err
+	}
+	defer exe.Close()
+	info, err := exe.Stat()
+	if err != nil {
+		return nil, err
+	}
+	aci, err := embeddedFlyStage1(exe, info.Size())
+	if err != nil || aci == nil {
+		return nil, err
+	}
+
+	// as for the default stage1, the version is meaningless if rkt
+	// was built from a dirty git tree
+	if !strings.HasSuffix(version.Version, "-dirty") && !fn.noStore {
+		storeOnly := fn.storeOnly
+		fn.storeOnly = true
+		s1img, _ := fn.findImage(fmt.Sprintf("%s:%s", flyStage1Name, version.Version), "")
+		fn.storeOnly = storeOnly
+		if s1img != nil {
+			return s1img, nil
+		}
+	}
+
+	key, err := fn.s.WriteACI(aci, false)
+	if err != nil {
+		return nil, fmt.Errorf("cannot import the embedded fly stage1 image: %v", err)
+	}
+	return types.NewHash(key)
+}
@@ -0,0 +1,164 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/common/apps"
+)
+
+func TestAddFlyDefaultVolumes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rkt-fly-test-")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	run := filepath.Join(dir, "run")
+	log := filepath.Join(dir, "log")
+	missing := filepath.Join(dir, "missing")
+	for _, d := range []string{run, log} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatalf("error creating %q: %v", d, err)
+		}
+	}
+	defaults := []flyHostVolume{
+		{"run", run, false},
+		{"log", log, true},
+		{"missing", missing, false},
+	}
+
+	tests := []struct {
+		mounts  []schema.Mount
+		volumes []types.ACName
+		allow   []string
+		added   []string
+	}{
+		{nil, nil, nil, []string{run, log}},
+		// the paths which are already mounted are skipped
+		{[]schema.Mount{{Volume: "mine", Path: run + "/"}}, []types.ACName{"mine"}, nil, []string{log}},
+		// and so are the volumes with the same name
+		{nil, []types.ACName{"log"}, nil, []string{run}},
+		// and the paths which are not allowed
+		{nil, nil, []string{log}, []string{log}},
+		{nil, nil, []string{}, nil},
+	}
+
+	for i, tt := range tests {
+		al := &apps.Apps{Mounts: tt.mounts}
+		for _, name := range tt.volumes {
+			al.Volumes = append(al.Volumes, types.Volume{Name: name, Kind: "empty"})
+		}
+
+		addFlyDefaultVolumes(al, defaults, tt.allow)
+
+		var added []string
+		for _, m := range al.Mounts[len(tt.mounts):] {
+			added = append(added, m.Path)
+		}
+		if !reflect.DeepEqual(added, tt.added) {
+			t.Errorf("#%d: expected mounts %v to be added, got %v", i, tt.added, added)
+		}
+		for _, v := range al.Volumes[len(tt.volumes):] {
+			if v.Kind != "host" || v.ReadOnly == nil || *v.ReadOnly != (v.Name == "log") {
+				t.Errorf("#%d: unexpected volume %v", i, v)
+			}
+		}
+		if err := al.Validate(); err != nil {
+			t.Errorf("#%d: unexpected error validating the apps: %v", i, err)
+		}
+	}
+}
+
+func TestFlyIDAnnotations(t *testing.T) {
+	tests := []struct {
+		uid  string
+		gid  string
+		want types.Annotations
+		werr bool
+	}{
+		{"", "", nil, false},
+		{"500", "", types.Annotations{{Name: common.FlyUIDAnnotation, Value: "500"}}, false},
+		{"0", "0", types.Annotations{{Name: common.FlyUIDAnnotation, Value: "0"}, {Name: common.FlyGIDAnnotation, Value: "0"}}, false},
+		{"etcd", "", nil, true},
+		{"", "-1", nil, true},
+	}
+
+	for i, tt := range tests {
+		annotations, err := flyIDAnnotations(tt.uid, tt.gid)
+		if gotErr := err != nil; gotErr != tt.werr {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.werr)
+			continue
+		}
+		if !reflect.DeepEqual(annotations, tt.want) {
+			t.Errorf("#%d: got %v, want %v", i, annotations, tt.want)
+		}
+	}
+}
+
+func TestEmbeddedFlyStage1(t *testing.T) {
+	exe := []byte("ELF binary")
+	aci := []byte("stage1 fly image")
+	trailer := func(size int) string {
+		return fmt.Sprintf("%020d%s", size, flyEmbedMagic)
+	}
+
+	tests := []struct {
+		data    string
+		aci     string
+		errored bool
+	}{
+		{string(exe), "", false},
+		{"", "", false},
+		{string(exe) + string(aci) + trailer(len(aci)), string(aci), false},
+		{string(aci) + trailer(len(aci)), string(aci), false},
+		{string(exe) + string(aci) + trailer(0), "", true},
+		{string(aci) + trailer(len(aci)+1), "", true},
+		{string(exe) + "xx" + trailer(1)[2:], "", true},
+	}
+
+	for i, tt := range tests {
+		r := bytes.NewReader([]byte(tt.data))
+		sr, err := embeddedFlyStage1(r, int64(len(tt.data)))
+		if (err != nil) != tt.errored {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.errored)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		var got string
+		if sr != nil {
+			b, err := ioutil.ReadAll(sr)
+			if err != nil {
+				t.Fatalf("#%d: unexpected error reading the image: %v", i, err)
+			}
+			got = string(b)
+		}
+		if got != tt.aci {
+			t.Errorf("#%d: got image %q, want %q", i, got, tt.aci)
+		}
+	}
+}
@@ -18,6 +18,7 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"syscall"
@@ -25,6 +26,7 @@ import (
 
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/cobra"
 	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/pkg/lock"
 	"github.com/coreos/rkt/stage0"
 	"github.com/coreos/rkt/store"
 )
@@ -36,53 +38,113 @@ const (
 
 var (
 	cmdGC = &cobra.Command{
-		Use:   "gc [--grace-period=duration] [--expire-prepared=duration]",
+		Use:   "gc [--grace-period=duration] [--expire-prepared=duration] [--with-images] [--daemon [--interval=duration]]",
 		Short: "Garbage-collect rkt pods no longer in use",
 		Run:   runWrapper(runGC),
 	}
 	flagGracePeriod        time.Duration
 	flagPreparedExpiration time.Duration
+	flagGCWithImages       bool
+	flagGCImageGracePeriod time.Duration
+	flagLockTimeout        time.Duration
+	flagGCDaemon           bool
+	flagGCInterval         time.Duration
+	flagGCJitter           time.Duration
 )
 
 func init() {
 	cmdRkt.AddCommand(cmdGC)
 	cmdGC.Flags().DurationVar(&flagGracePeriod, "grace-period", defaultGracePeriod, "duration to wait before discarding inactive pods from garbage")
 	cmdGC.Flags().DurationVar(&flagPreparedExpiration, "expire-prepared", defaultPreparedExpiration, "duration to wait before expiring prepared pods")
+	cmdGC.Flags().BoolVar(&flagGCWithImages, "with-images", false, "also garbage collect the images and treestores no longer used by any pod, as 'rkt image gc' does")
+	cmdGC.Flags().DurationVar(&flagGCImageGracePeriod, "image-grace-period", defaultImageGracePeriod, "with --with-images, duration to wait since an image was last used before removing it")
+	cmdGC.Flags().DurationVar(&flagLockTimeout, "lock-timeout", 0, "duration to wait for the locks held by other rkt processes before giving up, 0 to wait indefinitely")
+	cmdGC.Flags().BoolVar(&flagGCDaemon, "daemon", false, "keep running and garbage collect periodically")
+	cmdGC.Flags().DurationVar(&flagGCInterval, "interval", defaultGCInterval, "with --daemon, duration between two garbage collection passes")
+	cmdGC.Flags().DurationVar(&flagGCJitter, "jitter", defaultGCJitter, "with --daemon, maximum random duration added to the interval, so the passes of several hosts are spread")
 }
 
 func runGC(cmd *cobra.Command, args []string) (exit int) {
-	if err := renameExited(); err != nil {
-		stderr("Failed to rename exited pods: %v", err)
+	if flagGCDaemon {
+		return runGCDaemon()
+	}
+
+	// Serialize with the other passes, 'rkt gc --daemon' ones included
+	gcLock, err := lock.ExclusiveKeyLockTimeout(lockDir(), common.GCLock, flagLockTimeout)
+	if err != nil {
+		stderr("Cannot get the gc lock: %v", err)
 		return 1
 	}
+	defer gcLock.Close()
 
-	if err := renameAborted(); err != nil {
-		stderr("Failed to rename aborted pods: %v", err)
+	if err := gcPass(); err != nil {
+		stderr("%v", err)
 		return 1
 	}
 
+	return
+}
+
+// gcPass garbage collects the pods and, with --with-images, the images. The
+// caller must hold the gc lock.
+func gcPass() error {
+	var s *store.Store
+	if flagGCWithImages {
+		var err error
+		s, err = newStore()
+		if err != nil {
+			return fmt.Errorf("Cannot open store: %v", err)
+		}
+		defer s.Close()
+
+		// Block the creation of new pods during both phases, so the
+		// images and treestores collected after the pods are not
+		// referenced by a pod prepared in the meantime.
+		keyLock, err := exclusivePrepareLock(flagLockTimeout)
+		if err != nil {
+			return fmt.Errorf("Cannot get exclusive prepare lock: %v", err)
+		}
+		defer keyLock.Close()
+	}
+
+	if err := renameExited(); err != nil {
+		return fmt.Errorf("Failed to rename exited pods: %v", err)
+	}
+
+	if err := renameAborted(); err != nil {
+		return fmt.Errorf("Failed to rename aborted pods: %v", err)
+	}
+
 	if err := renameExpired(flagPreparedExpiration); err != nil {
-		stderr("Failed to rename expired prepared pods: %v", err)
-		return 1
+		return fmt.Errorf("Failed to rename expired prepared pods: %v", err)
 	}
 
 	if err := emptyExitedGarbage(flagGracePeriod); err != nil {
-		stderr("Failed to empty exitedGarbage: %v", err)
-		return 1
+		return fmt.Errorf("Failed to empty exitedGarbage: %v", err)
 	}
 
 	if err := emptyGarbage(); err != nil {
-		stderr("Failed to empty garbage: %v", err)
-		return 1
+		return fmt.Errorf("Failed to empty garbage: %v", err)
 	}
 
-	return
+	if err := unregisterUnusedQemuUser(); err != nil {
+		stderr("Failed to unregister qemu-user emulators: %v", err)
+	}
+
+	if flagGCWithImages {
+		if err := gcImages(s, flagGCImageGracePeriod); err != nil {
+			return fmt.Errorf("Failed to garbage collect images: %v", err)
+		}
+	}
+
+	return nil
 }
 
 // renameExited renames exited pods to the exitedGarbage directory
 func renameExited() error {
 	if err := walkPods(includeRunDir, func(p *pod) {
 		if p.isExited {
+			runHookFromConfig(hookOnExit, p)
 			stderr("Moving pod %q to garbage", p.uuid)
 			if err := p.xToExitedGarbage(); err != nil && err != os.ErrNotExist {
 				stderr("Rename error: %v", err)
@@ -108,7 +170,8 @@ func emptyExitedGarbage(gracePeriod time.Duration) error {
 		}
 
 		if expiration := time.Unix(st.Ctim.Unix()).Add(gracePeriod); time.Now().After(expiration) {
-			if err := p.ExclusiveLock(); err != nil {
+			if err := p.waitExclusiveLock(flagLockTimeout); err != nil {
+				stderr("Skipping pod %q: %v", p.uuid, err)
 				return
 			}
 			stdout("Garbage collecting pod %q", p.uuid)
@@ -139,7 +202,9 @@ func renameAborted() error {
 	return nil
 }
 
-// renameExpired renames expired prepared pods to the garbage directory
+// renameExpired renames expired prepared pods to the garbage directory. The
+// pods prepared with their own expiration expire after it, the others after
+// preparedExpiration.
 func renameExpired(preparedExpiration time.Duration) error {
 	if err := walkPods(includePreparedDir, func(p *pod) {
 		st := &syscall.Stat_t{}
@@ -151,7 +216,16 @@ func renameExpired(preparedExpiration time.Duration) error {
 			return
 		}
 
-		if expiration := time.Unix(st.Ctim.Unix()).Add(preparedExpiration); time.Now().After(expiration) {
+		podExpiration, err := p.getPreparedExpiration()
+		if err != nil {
+			stderr("Warning: unable to get the expiration of prepared pod %q, using the default: %v", p.uuid, err)
+			podExpiration = 0
+		}
+		if podExpiration == 0 {
+			podExpiration = preparedExpiration
+		}
+
+		if expiration := time.Unix(st.Ctim.Unix()).Add(podExpiration); time.Now().After(expiration) {
 			stderr("Moving expired prepared pod %q to garbage", p.uuid)
 			if err := p.xToGarbage(); err != nil && err != os.ErrNotExist {
 				stderr("Rename error: %v", err)
@@ -166,7 +240,8 @@ func renameExpired(preparedExpiration time.Duration) error {
 // emptyGarbage discards everything from garbageDir()
 func emptyGarbage() error {
 	if err := walkPods(includeGarbageDir, func(p *pod) {
-		if err := p.ExclusiveLock(); err != nil {
+		if err := p.waitExclusiveLock(flagLockTimeout); err != nil {
+			stderr("Skipping pod %q: %v", p.uuid, err)
 			return
 		}
 		stdout("Garbage collecting pod %q", p.uuid)
@@ -179,6 +254,23 @@ func emptyGarbage() error {
 	return nil
 }
 
+// unregisterUnusedQemuUser removes the qemu-user emulators registered in
+// binfmt_misc by the pods once no remaining pod runs apps of their arch.
+func unregisterUnusedQemuUser() error {
+	var inUse []string
+	if err := walkPods(includeRunDir|includePrepareDir|includePreparedDir, func(p *pod) {
+		archs, err := stage0.QemuUserArchs(p.path())
+		if err != nil {
+			stderr("Cannot read the qemu-user archs of pod %q: %v", p.uuid, err)
+			return
+		}
+		inUse = append(inUse, archs...)
+	}); err != nil {
+		return err
+	}
+	return stage0.UnregisterQemuUser(inUse)
+}
+
 // deletePod cleans up files and resource associated with the pod
 // pod must be under exclusive lock and be in either ExitedGarbage
 // or Garbage state
@@ -187,13 +279,17 @@ func deletePod(p *pod) {
 		panic(fmt.Sprintf("logic error: deletePod called with non-garbage pod %q (status %q)", p.uuid, p.getState()))
 	}
 
+	s, err := newStore()
+	if err != nil {
+		stderr("Cannot open store: %v", err)
+		return
+	}
+	defer s.Close()
+
+	runHookFromConfig(hookOnGC, p)
+	cleanupPodVolumes(p)
+
 	if p.isExitedGarbage {
-		s, err := store.NewStore(globalFlags.Dir)
-		if err != nil {
-			stderr("Cannot open store: %v", err)
-			return
-		}
-		defer s.Close()
 		stage1TreeStoreID, err := p.getStage1TreeStoreID()
 		if err != nil {
 			stderr("Error getting stage1 treeStoreID: %v", err)
@@ -236,7 +332,46 @@ func deletePod(p *pod) {
 		}
 	}
 
+	secrets := common.SecretsPath(p.path())
+	if err := syscall.Unmount(secrets, 0); err != nil {
+		// the pod might have no secrets, or the machine could have
+		// been rebooted and mounts lost.
+		// ignore "does not exist" and "not a mount point" errors
+		if err != syscall.ENOENT && err != syscall.EINVAL {
+			stderr("Error unmounting secrets at %v: %v", secrets, err)
+			return
+		}
+	}
+
+	emptyDirs := common.EmptyDirsPath(p.path())
+	if eds, err := ioutil.ReadDir(emptyDirs); err == nil {
+		for _, ed := range eds {
+			path := filepath.Join(emptyDirs, ed.Name())
+			// only the empty volumes with the memory medium are
+			// on a tmpfs, ignore "not a mount point" errors
+			if err := syscall.Unmount(path, 0); err != nil && err != syscall.ENOENT && err != syscall.EINVAL {
+				stderr("Error unmounting empty volume at %v: %v", path, err)
+				return
+			}
+		}
+	}
+
+	if err := unmountPluginVolumes(p); err != nil {
+		stderr("Error unmounting the plugin volumes of pod %q: %v", p.uuid, err)
+		return
+	}
+
 	if err := os.RemoveAll(p.path()); err != nil {
 		stderr("Unable to remove pod %q: %v", p.uuid, err)
+		return
+	}
+
+	// the files labeled with the SELinux MCS level of the pod are gone,
+	// so it can be reused by new pods.
+	if err := s.ReleaseMCSLevel(p.uuid.String()); err != nil {
+		stderr("Unable to release the SELinux MCS level of pod %q: %v", p.uuid, err)
+	}
+	if err := s.ReleasePodRefs(p.uuid.String()); err != nil {
+		stderr("Unable to release the images of pod %q: %v", p.uuid, err)
 	}
 }
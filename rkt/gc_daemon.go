@@ -0,0 +1,91 @@
+// Copyright 2014 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"math/rand"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/pkg/lock"
+)
+
+const (
+	defaultGCInterval = time.Hour
+	defaultGCJitter   = 5 * time.Minute
+)
+
+// runGCDaemon runs a gc pass after a random part of the jitter, and then
+// every interval plus a random part of the jitter, until rkt is interrupted.
+// A pass is skipped when another one holds the gc lock.
+func runGCDaemon() (exit int) {
+	if flagGCInterval <= 0 {
+		stderr("The gc interval must be positive")
+		return 1
+	}
+	if flagGCJitter < 0 {
+		stderr("The gc jitter must not be negative")
+		return 1
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	delay := gcDelay(0, flagGCJitter, rnd)
+	for {
+		select {
+		case <-time.After(delay):
+		case <-sigCh:
+			return
+		}
+
+		gcDaemonPass()
+		delay = gcDelay(flagGCInterval, flagGCJitter, rnd)
+		stderr("Next garbage collection in %v", delay)
+	}
+}
+
+func gcDaemonPass() {
+	gcLock, err := lock.TryExclusiveKeyLock(lockDir(), common.GCLock)
+	switch err {
+	case nil:
+		defer gcLock.Close()
+	case lock.ErrLocked:
+		stderr("Skipping garbage collection: another pass is running")
+		return
+	default:
+		stderr("Cannot get the gc lock: %v", err)
+		return
+	}
+
+	if err := gcPass(); err != nil {
+		stderr("%v", err)
+	}
+}
+
+// gcDelay returns interval plus a random duration in [0, jitter).
+func gcDelay(interval, jitter time.Duration, rnd *rand.Rand) time.Duration {
+	if jitter <= 0 {
+		return interval
+	}
+	return interval + time.Duration(rnd.Int63n(int64(jitter)))
+}
@@ -0,0 +1,45 @@
+// Copyright 2014 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestGCDelay(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	tests := []struct {
+		interval time.Duration
+		jitter   time.Duration
+	}{
+		{time.Hour, 0},
+		{time.Hour, 5 * time.Minute},
+		{0, time.Second},
+		{time.Minute, time.Nanosecond},
+	}
+
+	for i, tt := range tests {
+		for j := 0; j < 100; j++ {
+			d := gcDelay(tt.interval, tt.jitter, rnd)
+			if d < tt.interval || (tt.jitter > 0 && d >= tt.interval+tt.jitter) || (tt.jitter == 0 && d != tt.interval) {
+				t.Fatalf("#%d: delay %v out of [%v, %v)", i, d, tt.interval, tt.interval+tt.jitter)
+			}
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2014 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coreos/rkt/common"
+)
+
+func TestRenameExpired(t *testing.T) {
+	d, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating tmpdir: %v", err)
+	}
+	defer os.RemoveAll(d)
+	oldDir, oldInitialized := globalFlags.Dir, podsInitialized
+	defer func() {
+		globalFlags.Dir, podsInitialized = oldDir, oldInitialized
+	}()
+	globalFlags.Dir = d
+	podsInitialized = false
+	if err := initPods(); err != nil {
+		t.Fatalf("error initializing pods: %v", err)
+	}
+
+	tests := []struct {
+		uuid       string
+		expiration string // empty for the gc default
+		expired    bool
+	}{
+		{"aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa", "", true},
+		{"bbbbbbbb-bbbb-bbbb-bbbb-bbbbbbbbbbbb", "1ns", true},
+		{"cccccccc-cccc-cccc-cccc-cccccccccccc", "1h", false},
+		// an unparsable expiration falls back to the gc default
+		{"dddddddd-dddd-dddd-dddd-dddddddddddd", "soon", true},
+	}
+
+	for _, tt := range tests {
+		dir := filepath.Join(preparedDir(), tt.uuid)
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			t.Fatalf("error creating pod directory: %v", err)
+		}
+		if tt.expiration != "" {
+			if err := ioutil.WriteFile(filepath.Join(dir, common.PreparedExpirationFilename), []byte(tt.expiration), 0600); err != nil {
+				t.Fatalf("error writing the prepared expiration: %v", err)
+			}
+		}
+	}
+	// make sure the pods expiring after 1ns did
+	time.Sleep(time.Millisecond)
+
+	if err := renameExpired(time.Nanosecond); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for i, tt := range tests {
+		_, err := os.Stat(filepath.Join(garbageDir(), tt.uuid))
+		if expired := err == nil; expired != tt.expired {
+			t.Errorf("#%d: expected pod expired to be %t, got %t", i, tt.expired, expired)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/pflag"
+	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/common/gpu"
+)
+
+var flagGPUs gpuSpec
+
+// gpuSpec implements the flag.Value interface to contain the NVIDIA GPUs
+// exposed to the apps of a pod
+type gpuSpec struct {
+	spec *gpu.Spec
+}
+
+func (gs *gpuSpec) Set(s string) error {
+	spec, err := gpu.ParseSpec(s)
+	if err != nil {
+		return err
+	}
+	gs.spec = spec
+	return nil
+}
+
+func (gs *gpuSpec) String() string {
+	if gs.spec == nil {
+		return ""
+	}
+	return gs.spec.String()
+}
+
+func (gs *gpuSpec) Type() string {
+	return "gpuSpec"
+}
+
+// addGPUFlag adds the flag exposing NVIDIA GPUs to the apps of the pods. They
+// are passed to stage1 as a pod annotation, which locates the devices and
+// the driver on the host.
+func addGPUFlag(flags *pflag.FlagSet) {
+	flags.Var(&flagGPUs, "gpus", "NVIDIA GPUs exposed to the apps, with their driver: \"all\" or a comma-separated list of GPU indices")
+}
+
+// gpuFlagSet returns whether the GPU flag is set.
+func gpuFlagSet() bool {
+	return flagGPUs.spec != nil
+}
+
+// gpuAnnotations returns the pod annotations corresponding to the GPU flag.
+func gpuAnnotations() types.Annotations {
+	var annotations types.Annotations
+	if gpuFlagSet() {
+		annotations.Set(types.ACIdentifier(common.GPUsAnnotation), flagGPUs.String())
+	}
+	return annotations
+}
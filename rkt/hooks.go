@@ -0,0 +1,153 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/rkt/config"
+)
+
+// The events of the pod lifecycle triggering a hook
+const (
+	hookOnPrepare = "on-prepare"
+	hookOnRun     = "on-run"
+	hookOnExit    = "on-exit"
+	hookOnGC      = "on-gc"
+)
+
+// hookInput describes the pod to the hooks, on their standard input.
+type hookInput struct {
+	Event string `json:"event"`
+	UUID  string `json:"uuid"`
+	// Manifest is the pod manifest, missing if the pod was not prepared
+	Manifest json.RawMessage `json:"manifest,omitempty"`
+	// Networks are the networks of an exited pod
+	Networks []hookNetwork `json:"networks,omitempty"`
+	// AppExitStatuses are the exit statuses of the apps of an exited pod
+	AppExitStatuses map[string]int `json:"appExitStatuses,omitempty"`
+}
+
+type hookNetwork struct {
+	Name   string `json:"name"`
+	IfName string `json:"ifName"`
+	IP     string `json:"ip"`
+}
+
+// hookCommand returns the command of the hook configured for event, nil if
+// there is none.
+func hookCommand(hooks config.Hooks, event string) []string {
+	switch event {
+	case hookOnPrepare:
+		return hooks.OnPrepare
+	case hookOnRun:
+		return hooks.OnRun
+	case hookOnExit:
+		return hooks.OnExit
+	case hookOnGC:
+		return hooks.OnGC
+	}
+	return nil
+}
+
+// runHook runs the hook of the configuration for event, if any, with the
+// pod UUID as last argument and the description of the pod on its standard
+// input. The hooks of the events preceding the start of the pod can prevent
+// it by failing, the callers of the others only warn about the failures.
+func runHook(cfg *config.Config, event string, p *pod) error {
+	command := hookCommand(cfg.Hooks, event)
+	if len(command) == 0 {
+		return nil
+	}
+
+	in, err := getHookInput(event, p)
+	if err != nil {
+		return fmt.Errorf("cannot describe pod %s to the %s hook: %v", p.uuid, event, err)
+	}
+	b, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	args := append(append([]string{}, command[1:]...), in.UUID)
+	cmd := exec.Command(command[0], args...)
+	cmd.Stdin = bytes.NewReader(b)
+	// the standard output of rkt run belongs to the apps
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"RKT_HOOK="+event,
+		"RKT_POD_UUID="+in.UUID,
+	)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s hook %q failed for pod %s: %v", event, command[0], in.UUID, err)
+	}
+	return nil
+}
+
+// runHookFromConfig loads the configuration and runs the hook for event,
+// printing the errors, for the callers which only warn about them.
+func runHookFromConfig(event string, p *pod) {
+	cfg, err := getConfig()
+	if err != nil {
+		stderr("Cannot get configuration to run the %s hook of pod %q: %v", event, p.uuid, err)
+		return
+	}
+	if err := runHook(cfg, event, p); err != nil {
+		stderr("Warning: %v", err)
+	}
+}
+
+func getHookInput(event string, p *pod) (*hookInput, error) {
+	in := &hookInput{
+		Event: event,
+		UUID:  p.uuid.String(),
+	}
+
+	pmb, err := p.readFile(common.PodManifestPath(""))
+	switch {
+	case err == nil:
+		in.Manifest = json.RawMessage(pmb)
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+
+	if !p.isExited {
+		return in, nil
+	}
+	if err := p.loadNets(); err != nil {
+		return nil, err
+	}
+	for _, n := range p.nets {
+		in.Networks = append(in.Networks, hookNetwork{
+			Name:   n.NetName,
+			IfName: n.IfName,
+			IP:     n.IP.String(),
+		})
+	}
+	// stage1 may have failed before writing any exit status
+	if stats, err := p.getExitStatuses(); err == nil {
+		in.AppExitStatuses = stats
+	}
+
+	return in, nil
+}
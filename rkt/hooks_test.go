@@ -0,0 +1,81 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coreos/rkt/rkt/config"
+)
+
+func TestRunHook(t *testing.T) {
+	d, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating tmpdir: %v", err)
+	}
+	defer os.RemoveAll(d)
+	globalFlags.Dir = d
+	podsInitialized = false
+
+	p, err := newPod(nil)
+	if err != nil {
+		t.Fatalf("error creating pod: %v", err)
+	}
+	defer p.Close()
+
+	out := filepath.Join(d, "hook")
+	cfg := &config.Config{
+		Hooks: config.Hooks{
+			OnPrepare: []string{"/bin/sh", "-c", `cat > "$0.in"; echo "$RKT_HOOK $1" > "$0.args"`, out},
+			OnRun:     []string{"/bin/false"},
+		},
+	}
+
+	if err := runHook(cfg, hookOnPrepare, p); err != nil {
+		t.Fatalf("unexpected error running the hook: %v", err)
+	}
+	args, err := ioutil.ReadFile(out + ".args")
+	if err != nil {
+		t.Fatalf("error reading the arguments of the hook: %v", err)
+	}
+	if expected := "on-prepare " + p.uuid.String() + "\n"; string(args) != expected {
+		t.Errorf("expected arguments %q, got %q", expected, args)
+	}
+	var in hookInput
+	b, err := ioutil.ReadFile(out + ".in")
+	if err != nil {
+		t.Fatalf("error reading the input of the hook: %v", err)
+	}
+	if err := json.Unmarshal(b, &in); err != nil {
+		t.Fatalf("invalid input of the hook %q: %v", b, err)
+	}
+	if in.Event != hookOnPrepare || in.UUID != p.uuid.String() || in.Manifest != nil {
+		t.Errorf("unexpected input of the hook %+v", in)
+	}
+
+	if err := runHook(cfg, hookOnRun, p); err == nil {
+		t.Errorf("expected an error from a failing hook")
+	}
+	// no hook configured
+	if err := runHook(cfg, hookOnExit, p); err != nil {
+		t.Errorf("unexpected error without hook: %v", err)
+	}
+}
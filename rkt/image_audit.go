@@ -0,0 +1,163 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/coreos/rkt/pkg/aci"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/cobra"
+)
+
+var (
+	cmdImageAudit = &cobra.Command{
+		Use:   "audit IMAGE",
+		Short: "Report the files of an image which may be unsafe",
+		Long: `IMAGE should be a string referencing an image; either a hash or an image name.
+
+The files of the image left out by its path whitelist when it is rendered, the setuid and setgid files and the world-writable files are printed. The world-writable directories with the sticky bit, like /tmp, are not reported. The dependencies of the image are not audited.`,
+		Run: runWrapper(runImageAudit),
+	}
+)
+
+const (
+	auditOutsideWhitelist = "outside path whitelist"
+	auditSetuid           = "setuid"
+	auditSetgid           = "setgid"
+	auditWorldWritable    = "world-writable"
+)
+
+func init() {
+	cmdImage.AddCommand(cmdImageAudit)
+	cmdImageAudit.Flags().BoolVar(&flagNoLegend, "no-legend", false, "suppress a legend with the list")
+}
+
+// imageAuditFinding is a file of an image which may be unsafe.
+type imageAuditFinding struct {
+	// Path is the path of the file in the rootfs of the image
+	Path string
+	// Mode is the mode of the file
+	Mode os.FileMode
+	// Issues are why the file may be unsafe
+	Issues []string
+}
+
+func runImageAudit(cmd *cobra.Command, args []string) (exit int) {
+	if len(args) != 1 {
+		cmd.Usage()
+		return 1
+	}
+
+	s, err := newStore()
+	if err != nil {
+		stderr("image audit: cannot open store: %v", err)
+		return 1
+	}
+	defer s.Close()
+
+	key, err := getStoreKeyFromAppOrHash(s, args[0])
+	if err != nil {
+		stderr("image audit: %v", err)
+		return 1
+	}
+
+	im, err := s.GetImageManifest(key)
+	if err != nil {
+		stderr("image audit: cannot get image manifest: %v", err)
+		return 1
+	}
+	rs, err := s.ReadStream(key)
+	if err != nil {
+		stderr("image audit: cannot read image: %v", err)
+		return 1
+	}
+	defer rs.Close()
+
+	findings, err := auditImage(rs, im)
+	if err != nil {
+		stderr("image audit: %v", err)
+		return 1
+	}
+
+	tabBuffer := new(bytes.Buffer)
+	tabOut := getTabOutWithWriter(tabBuffer)
+	if !flagNoLegend {
+		fmt.Fprintf(tabOut, "PATH\tMODE\tISSUES\n")
+	}
+	for _, f := range findings {
+		fmt.Fprintf(tabOut, "%s\t%v\t%s\n", f.Path, f.Mode, strings.Join(f.Issues, ","))
+	}
+	tabOut.Flush()
+	stdout("%s", tabBuffer.String())
+	return 0
+}
+
+// auditImage returns the files of the rootfs of the ACI read from r, in the
+// order of the ACI, which are left out by the path whitelist of its image
+// manifest im, setuid, setgid or world-writable.
+func auditImage(r io.Reader, im *schema.ImageManifest) ([]imageAuditFinding, error) {
+	pwl, err := aci.NewPathWhitelist(im.PathWhitelist)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []imageAuditFinding
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading image: %v", err)
+		}
+		name := filepath.Clean(hdr.Name)
+		if !strings.HasPrefix(name, "rootfs/") {
+			continue
+		}
+
+		mode := hdr.FileInfo().Mode()
+		var issues []string
+		if !pwl.Allows(name, mode.IsDir()) {
+			issues = append(issues, auditOutsideWhitelist)
+		}
+		if mode&os.ModeSetuid != 0 {
+			issues = append(issues, auditSetuid)
+		}
+		if mode&os.ModeSetgid != 0 {
+			issues = append(issues, auditSetgid)
+		}
+		worldWritable := mode&0002 != 0 && mode&os.ModeSymlink == 0
+		if worldWritable && !(mode.IsDir() && mode&os.ModeSticky != 0) {
+			issues = append(issues, auditWorldWritable)
+		}
+		if len(issues) > 0 {
+			findings = append(findings, imageAuditFinding{
+				Path:   strings.TrimPrefix(name, "rootfs"),
+				Mode:   mode,
+				Issues: issues,
+			})
+		}
+	}
+	return findings, nil
+}
@@ -0,0 +1,92 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+)
+
+func TestAuditImage(t *testing.T) {
+	files := []struct {
+		name     string
+		mode     int64
+		typeflag byte
+	}{
+		{"manifest", 0666, tar.TypeReg},
+		{"rootfs", 0755, tar.TypeDir},
+		{"rootfs/bin", 0755, tar.TypeDir},
+		{"rootfs/bin/app", 0755, tar.TypeReg},
+		{"rootfs/bin/su", 04755, tar.TypeReg},
+		{"rootfs/bin/wall", 02755, tar.TypeReg},
+		{"rootfs/tmp", 01777, tar.TypeDir},
+		{"rootfs/data", 0777, tar.TypeDir},
+		{"rootfs/bin/sh", 0777, tar.TypeSymlink},
+		{"rootfs/etc/shadow", 0666, tar.TypeReg},
+	}
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range files {
+		hdr := &tar.Header{Name: f.name, Mode: f.mode, Typeflag: f.typeflag}
+		if f.typeflag == tar.TypeSymlink {
+			hdr.Linkname = "app"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("error creating test tar: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("error creating test tar: %v", err)
+	}
+
+	tests := []struct {
+		pwl      []string
+		expected []imageAuditFinding
+	}{
+		{
+			nil,
+			[]imageAuditFinding{
+				{"/bin/su", os.ModeSetuid | 0755, []string{auditSetuid}},
+				{"/bin/wall", os.ModeSetgid | 0755, []string{auditSetgid}},
+				{"/data", os.ModeDir | 0777, []string{auditWorldWritable}},
+				{"/etc/shadow", 0666, []string{auditWorldWritable}},
+			},
+		},
+		{
+			[]string{"/bin/app", "/bin/sh", "/tmp"},
+			[]imageAuditFinding{
+				{"/bin/su", os.ModeSetuid | 0755, []string{auditOutsideWhitelist, auditSetuid}},
+				{"/bin/wall", os.ModeSetgid | 0755, []string{auditOutsideWhitelist, auditSetgid}},
+				{"/data", os.ModeDir | 0777, []string{auditOutsideWhitelist, auditWorldWritable}},
+				{"/etc/shadow", 0666, []string{auditOutsideWhitelist, auditWorldWritable}},
+			},
+		},
+	}
+	for i, tt := range tests {
+		findings, err := auditImage(bytes.NewReader(buf.Bytes()), &schema.ImageManifest{PathWhitelist: tt.pwl})
+		if err != nil {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(findings, tt.expected) {
+			t.Errorf("#%d: expected findings %v, got %v", i, tt.expected, findings)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/aci"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/cobra"
+	"github.com/coreos/rkt/Godeps/_workspace/src/golang.org/x/crypto/openpgp"
+)
+
+var (
+	cmdImageBuild = &cobra.Command{
+		Use:   "build DIRECTORY",
+		Short: "Build an ACI from a directory and import it into the store",
+		Long: `DIRECTORY must contain the image manifest in a file named "manifest" and the root filesystem of the image in a directory named "rootfs".
+
+The ACI is compressed with gzip. It is written to the file given with --output, signed with the private key given with --sign-key, if any.`,
+		Run: runWrapper(runImageBuild),
+	}
+	flagBuildOutput    string
+	flagBuildOverwrite bool
+	flagBuildSignKey   string
+	flagBuildOwnerRoot bool
+)
+
+func init() {
+	cmdImage.AddCommand(cmdImageBuild)
+	cmdImageBuild.Flags().StringVar(&flagBuildOutput, "output", "", "also write the ACI to this file")
+	cmdImageBuild.Flags().BoolVar(&flagBuildOverwrite, "overwrite", false, "overwrite the output ACI file and its signature")
+	cmdImageBuild.Flags().StringVar(&flagBuildSignKey, "sign-key", "", "armored private key signing the output ACI file, the signature is written next to it with the .asc extension")
+	cmdImageBuild.Flags().BoolVar(&flagBuildOwnerRoot, "owner-root", false, "set the owner of all the files in the ACI to root")
+}
+
+func runImageBuild(cmd *cobra.Command, args []string) (exit int) {
+	if len(args) != 1 {
+		cmd.Usage()
+		return 1
+	}
+	dir := args[0]
+
+	if flagBuildSignKey != "" && flagBuildOutput == "" {
+		stderr("image build: --sign-key requires --output")
+		return 1
+	}
+
+	im, err := readBuildManifest(dir)
+	if err != nil {
+		stderr("image build: %v", err)
+		return 1
+	}
+
+	s, err := newStore()
+	if err != nil {
+		stderr("image build: cannot open store: %v", err)
+		return 1
+	}
+	defer s.Close()
+
+	f, err := s.TmpFile()
+	if err != nil {
+		stderr("image build: error creating temporary file: %v", err)
+		return 1
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if err := buildACI(dir, *im, f, flagBuildOwnerRoot); err != nil {
+		stderr("image build: error building ACI: %v", err)
+		return 1
+	}
+
+	if flagBuildOutput != "" {
+		if err := writeBuildOutput(f, flagBuildOutput, flagBuildSignKey, flagBuildOverwrite); err != nil {
+			stderr("image build: %v", err)
+			return 1
+		}
+	}
+
+	if _, err := f.Seek(0, 0); err != nil {
+		stderr("image build: error seeking ACI: %v", err)
+		return 1
+	}
+	key, err := s.WriteACI(f, true)
+	if err != nil {
+		stderr("image build: error importing ACI: %v", err)
+		return 1
+	}
+
+	stdout("%s", key)
+	return 0
+}
+
+// readBuildManifest validates the layout of the image directory and returns
+// its manifest.
+func readBuildManifest(dir string) (*schema.ImageManifest, error) {
+	if err := aci.ValidateLayout(dir); err != nil {
+		if e, ok := err.(aci.ErrOldVersion); ok {
+			stderr("image build: warning: %v, please update the manifest", e)
+		} else {
+			return nil, fmt.Errorf("invalid image directory: %v", err)
+		}
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, aci.ManifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read image manifest: %v", err)
+	}
+	im := &schema.ImageManifest{}
+	if err := im.UnmarshalJSON(b); err != nil {
+		return nil, fmt.Errorf("cannot load image manifest: %v", err)
+	}
+	return im, nil
+}
+
+// buildACI writes to w the gzip compressed ACI with the manifest im and
+// the root filesystem of the image directory dir.
+func buildACI(dir string, im schema.ImageManifest, w io.Writer, ownerRoot bool) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	iw := aci.NewImageWriter(im, tw)
+
+	var walkerCb aci.TarHeaderWalkFunc
+	if ownerRoot {
+		walkerCb = func(hdr *tar.Header) bool {
+			hdr.Uid, hdr.Gid = 0, 0
+			hdr.Uname, hdr.Gname = "root", "root"
+			return true
+		}
+	}
+
+	if err := filepath.Walk(dir, aci.BuildWalker(dir, iw, walkerCb)); err != nil {
+		return err
+	}
+	// closes the tar writer too
+	if err := iw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// writeBuildOutput copies the built ACI to the output file and, if a
+// signing key is given, writes the signature of the ACI next to it.
+func writeBuildOutput(f *os.File, output, signKey string, overwrite bool) error {
+	var signature []byte
+	if signKey != "" {
+		if _, err := f.Seek(0, 0); err != nil {
+			return fmt.Errorf("error seeking ACI: %v", err)
+		}
+		var err error
+		if signature, err = signACI(f, signKey); err != nil {
+			return fmt.Errorf("error signing ACI: %v", err)
+		}
+	}
+
+	if _, err := f.Seek(0, 0); err != nil {
+		return fmt.Errorf("error seeking ACI: %v", err)
+	}
+	if err := writeOutputFile(output, f, overwrite); err != nil {
+		return err
+	}
+	if signature != nil {
+		if err := writeOutputFile(output+".asc", bytes.NewReader(signature), overwrite); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeOutputFile writes the content of r to the file path, which must not
+// exist unless overwrite is true.
+func writeOutputFile(path string, r io.Reader, overwrite bool) error {
+	mode := os.O_CREATE | os.O_WRONLY
+	if overwrite {
+		mode |= os.O_TRUNC
+	} else {
+		mode |= os.O_EXCL
+	}
+	out, err := os.OpenFile(path, mode, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("output file %s exists (try --overwrite)", path)
+		}
+		return fmt.Errorf("unable to open output file %s: %v", path, err)
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return fmt.Errorf("error writing output file %s: %v", path, err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("error closing output file %s: %v", path, err)
+	}
+	return nil
+}
+
+// signACI returns the armored detached signature of the ACI read from r,
+// made with the first private key of the armored key ring in keyFile.
+func signACI(r io.Reader, keyFile string) ([]byte, error) {
+	kf, err := os.Open(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	defer kf.Close()
+
+	entityList, err := openpgp.ReadArmoredKeyRing(kf)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read private key: %v", err)
+	}
+
+	var signer *openpgp.Entity
+	for _, e := range entityList {
+		if e.PrivateKey != nil {
+			signer = e
+			break
+		}
+	}
+	if signer == nil {
+		return nil, errors.New("no private key found")
+	}
+	if signer.PrivateKey.Encrypted {
+		return nil, errors.New("encrypted private keys are not supported")
+	}
+
+	signature := &bytes.Buffer{}
+	if err := openpgp.ArmoredDetachSign(signature, signer, r, nil); err != nil {
+		return nil, err
+	}
+	return signature.Bytes(), nil
+}
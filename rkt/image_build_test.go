@@ -0,0 +1,104 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/coreos/rkt/pkg/keystore/keystoretest"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/golang.org/x/crypto/openpgp"
+)
+
+const testBuildManifest = `{"acKind":"ImageManifest","acVersion":"0.7.0","name":"example.com/test"}`
+
+func TestBuildACI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rkt-image-build-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "manifest"), []byte(testBuildManifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "rootfs", "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "rootfs", "bin", "app"), []byte("app"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	im, err := readBuildManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := buildACI(dir, *im, buf, true); err != nil {
+		t.Fatal(err)
+	}
+	image := buf.Bytes()
+
+	gr, err := gzip.NewReader(bytes.NewReader(image))
+	if err != nil {
+		t.Fatalf("the ACI is not compressed: %v", err)
+	}
+	found := make(map[string]bool)
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Uid != 0 || hdr.Gid != 0 {
+			t.Errorf("%s: got owner %d:%d, want 0:0", hdr.Name, hdr.Uid, hdr.Gid)
+		}
+		found[strings.TrimSuffix(hdr.Name, "/")] = true
+	}
+	for _, name := range []string{"manifest", "rootfs", "rootfs/bin", "rootfs/bin/app"} {
+		if !found[name] {
+			t.Errorf("%s not found in the ACI", name)
+		}
+	}
+
+	keyFile := filepath.Join(dir, "key")
+	key := keystoretest.KeyMap["example.com"]
+	if err := ioutil.WriteFile(keyFile, []byte(key.ArmoredPrivateKey), 0600); err != nil {
+		t.Fatal(err)
+	}
+	signature, err := signACI(bytes.NewReader(image), keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring, err := openpgp.ReadArmoredKeyRing(strings.NewReader(key.ArmoredPublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader(image), bytes.NewReader(signature)); err != nil {
+		t.Errorf("invalid signature: %v", err)
+	}
+}
@@ -16,9 +16,11 @@ package main
 
 import (
 	"encoding/json"
+	"sort"
 
-	"github.com/coreos/rkt/store"
-
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/pkg/acirenderer"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/cobra"
 )
 
@@ -30,11 +32,13 @@ var (
 		Run:   runWrapper(runImageCatManifest),
 	}
 	flagPrettyPrint bool
+	flagRendered    bool
 )
 
 func init() {
 	cmdImage.AddCommand(cmdImageCatManifest)
 	cmdImageCatManifest.Flags().BoolVar(&flagPrettyPrint, "pretty-print", false, "apply indent to format the output")
+	cmdImageCatManifest.Flags().BoolVar(&flagRendered, "rendered", false, "print the manifest after the resolution of the image dependencies")
 }
 
 func runImageCatManifest(cmd *cobra.Command, args []string) (exit int) {
@@ -43,7 +47,7 @@ func runImageCatManifest(cmd *cobra.Command, args []string) (exit int) {
 		return 1
 	}
 
-	s, err := store.NewStore(globalFlags.Dir)
+	s, err := newStore()
 	if err != nil {
 		stderr("image cat-manifest: cannot open store: %v", err)
 		return 1
@@ -61,6 +65,20 @@ func runImageCatManifest(cmd *cobra.Command, args []string) (exit int) {
 		return 1
 	}
 
+	if flagRendered {
+		hash, err := types.NewHash(key)
+		if err != nil {
+			stderr("image cat-manifest: invalid image key %q: %v", key, err)
+			return 1
+		}
+		images, err := acirenderer.CreateDepListFromImageID(*hash, s)
+		if err != nil {
+			stderr("image cat-manifest: cannot resolve the image dependencies: %v", err)
+			return 1
+		}
+		manifest = renderedImageManifest(images)
+	}
+
 	var b []byte
 	if flagPrettyPrint {
 		b, err = json.MarshalIndent(manifest, "", "\t")
@@ -75,3 +93,56 @@ func runImageCatManifest(cmd *cobra.Command, args []string) (exit int) {
 	stdout(string(b))
 	return 0
 }
+
+// renderedImageManifest returns the manifest of the first image of the
+// flattened dependency list, as the image looks once its dependencies are
+// resolved:
+// - the labels missing from the image are inherited from its dependencies,
+// the nearest dependency winning
+// - the image IDs of the direct dependencies are set to the resolved images
+// - the path whitelist is the one applied to the whole rendered image, which
+// is the one of the image itself, the whitelists of the dependencies only
+// filtering their own files and the ones of their dependencies
+func renderedImageManifest(images acirenderer.Images) *schema.ImageManifest {
+	top := images[0]
+	im := *top.Im
+
+	deps := make(acirenderer.Images, len(images)-1)
+	copy(deps, images[1:])
+	sort.Stable(imagesByLevel(deps))
+
+	im.Labels = append(types.Labels(nil), top.Im.Labels...)
+	for _, dep := range deps {
+		for _, l := range dep.Im.Labels {
+			if _, ok := im.Labels.Get(l.Name.String()); !ok {
+				im.Labels = append(im.Labels, l)
+			}
+		}
+	}
+
+	im.Dependencies = append(types.Dependencies(nil), top.Im.Dependencies...)
+	for i, d := range im.Dependencies {
+		if d.ImageID != nil && !d.ImageID.Empty() {
+			continue
+		}
+		for _, dep := range deps {
+			if dep.Level != 1 || dep.Im.Name != d.ImageName {
+				continue
+			}
+			if id, err := types.NewHash(dep.Key); err == nil {
+				im.Dependencies[i].ImageID = id
+			}
+			break
+		}
+	}
+
+	return &im
+}
+
+// imagesByLevel sorts the images of a flattened dependency list by their
+// distance from the rendered image.
+type imagesByLevel acirenderer.Images
+
+func (l imagesByLevel) Len() int           { return len(l) }
+func (l imagesByLevel) Less(i, j int) bool { return l[i].Level < l[j].Level }
+func (l imagesByLevel) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
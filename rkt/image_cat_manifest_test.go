@@ -0,0 +1,99 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/pkg/acirenderer"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+)
+
+const (
+	testBaseKey = "sha512-1111111111111111111111111111111111111111111111111111111111111111"
+	testLibKey  = "sha512-2222222222222222222222222222222222222222222222222222222222222222"
+)
+
+func TestRenderedImageManifest(t *testing.T) {
+	app := &schema.ImageManifest{
+		Name: "example.com/app",
+		Labels: types.Labels{
+			{Name: "version", Value: "1.0"},
+		},
+		Dependencies: types.Dependencies{
+			{ImageName: "example.com/base"},
+			{ImageName: "example.com/lib"},
+		},
+		PathWhitelist: []string{"/app"},
+	}
+	base := &schema.ImageManifest{
+		Name: "example.com/base",
+		Labels: types.Labels{
+			{Name: "version", Value: "0.1"},
+			{Name: "os", Value: "linux"},
+		},
+		Dependencies: types.Dependencies{
+			{ImageName: "example.com/arch"},
+		},
+		PathWhitelist: []string{"/base"},
+	}
+	lib := &schema.ImageManifest{
+		Name: "example.com/lib",
+	}
+	arch := &schema.ImageManifest{
+		Name: "example.com/arch",
+		Labels: types.Labels{
+			{Name: "os", Value: "freebsd"},
+			{Name: "arch", Value: "amd64"},
+		},
+	}
+
+	// the order of CreateDepListFromImageID
+	images := acirenderer.Images{
+		{Im: app, Key: "sha512-0000000000000000000000000000000000000000000000000000000000000000", Level: 0},
+		{Im: lib, Key: testLibKey, Level: 1},
+		{Im: base, Key: testBaseKey, Level: 1},
+		{Im: arch, Key: "sha512-3333333333333333333333333333333333333333333333333333333333333333", Level: 2},
+	}
+
+	im := renderedImageManifest(images)
+
+	wantLabels := types.Labels{
+		{Name: "version", Value: "1.0"},
+		{Name: "os", Value: "linux"},
+		{Name: "arch", Value: "amd64"},
+	}
+	if !reflect.DeepEqual(im.Labels, wantLabels) {
+		t.Errorf("got labels %v, want %v", im.Labels, wantLabels)
+	}
+
+	for i, want := range []string{testBaseKey, testLibKey} {
+		id := im.Dependencies[i].ImageID
+		if id == nil || id.String() != want {
+			t.Errorf("#%d: got dependency image ID %v, want %s", i, id, want)
+		}
+	}
+
+	if !reflect.DeepEqual(im.PathWhitelist, []string{"/app"}) {
+		t.Errorf("got path whitelist %v, want %v", im.PathWhitelist, []string{"/app"})
+	}
+
+	// the original manifest must not be modified
+	if len(app.Labels) != 1 || app.Dependencies[0].ImageID != nil {
+		t.Errorf("the manifest of the image was modified")
+	}
+}
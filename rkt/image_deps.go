@@ -0,0 +1,211 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/coreos/rkt/store"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/dustin/go-humanize"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/cobra"
+)
+
+var (
+	cmdImageDeps = &cobra.Command{
+		Use:   "deps IMAGE",
+		Short: "Print the dependency tree of an image",
+		Long: `IMAGE should be a string referencing an image; either a hash or an image name.
+
+The dependencies are resolved from the local store like when the image is rendered. The dependencies missing from the store are printed as not cached.`,
+		Run: runWrapper(runImageDeps),
+	}
+)
+
+func init() {
+	cmdImage.AddCommand(cmdImageDeps)
+	cmdImageDeps.Flags().BoolVar(&flagNoLegend, "no-legend", false, "suppress a legend with the list")
+	cmdImageDeps.Flags().BoolVar(&flagFullOutput, "full", false, "use long output format")
+}
+
+// imageDepsRegistry is the part of the store used to resolve the
+// dependencies of an image.
+type imageDepsRegistry interface {
+	ResolveKey(key string) (string, error)
+	GetACI(name types.ACIdentifier, labels types.Labels) (string, error)
+	GetImageManifest(key string) (*schema.ImageManifest, error)
+	GetACISize(key string) (int64, error)
+}
+
+// imageDep is an image of the dependency tree.
+type imageDep struct {
+	// Name is the image name, with its version label if any
+	Name string
+	// Key is the key of the image in the store, or the image ID of the
+	// dependency if it's not cached
+	Key string
+	// Size is the size of the ACI file
+	Size int64
+	// Level is the distance from the top image
+	Level int
+	// Cached is false when the dependency is not in the store
+	Cached bool
+	// Cycle is true when the image is one of its own dependencies, its
+	// dependencies are not resolved again
+	Cycle bool
+}
+
+func runImageDeps(cmd *cobra.Command, args []string) (exit int) {
+	if len(args) != 1 {
+		cmd.Usage()
+		return 1
+	}
+
+	s, err := newStore()
+	if err != nil {
+		stderr("image deps: cannot open store: %v", err)
+		return 1
+	}
+	defer s.Close()
+
+	key, err := getStoreKeyFromAppOrHash(s, args[0])
+	if err != nil {
+		stderr("image deps: %v", err)
+		return 1
+	}
+
+	deps, err := getImageDeps(s, key)
+	if err != nil {
+		stderr("image deps: cannot resolve the image dependencies: %v", err)
+		return 1
+	}
+
+	tabBuffer := new(bytes.Buffer)
+	tabOut := getTabOutWithWriter(tabBuffer)
+	if !flagNoLegend {
+		fmt.Fprintf(tabOut, "NAME\tIMAGE ID\tSIZE\tCACHED\n")
+	}
+	for _, dep := range deps {
+		name := strings.Repeat("  ", dep.Level) + dep.Name
+		if dep.Cycle {
+			name += " (cycle)"
+		}
+		id := dep.Key
+		if !flagFullOutput {
+			id = shortImageID(id)
+		}
+		size := ""
+		if dep.Cached {
+			size = humanize.IBytes(uint64(dep.Size))
+		}
+		fmt.Fprintf(tabOut, "%s\t%s\t%s\t%t\n", name, id, size, dep.Cached)
+	}
+	tabOut.Flush()
+	stdout("%s", tabBuffer.String())
+	return 0
+}
+
+// getImageDeps returns the dependency tree of the image with the given key,
+// depth first, in the order of the dependencies in the image manifests. The
+// dependencies shared by several images are repeated under each of them.
+func getImageDeps(r imageDepsRegistry, key string) ([]imageDep, error) {
+	im, err := r.GetImageManifest(key)
+	if err != nil {
+		return nil, err
+	}
+	size, err := r.GetACISize(key)
+	if err != nil {
+		return nil, err
+	}
+	top := imageDep{
+		Name:   imageDepName(im.Name, im.Labels),
+		Key:    key,
+		Size:   size,
+		Cached: true,
+	}
+	return appendImageDeps([]imageDep{top}, r, im, 1, map[string]bool{key: true})
+}
+
+func appendImageDeps(deps []imageDep, r imageDepsRegistry, im *schema.ImageManifest, level int, parents map[string]bool) ([]imageDep, error) {
+	for _, d := range im.Dependencies {
+		dep := imageDep{
+			Name:  imageDepName(d.ImageName, d.Labels),
+			Level: level,
+		}
+		var key string
+		var err error
+		if d.ImageID != nil && !d.ImageID.Empty() {
+			dep.Key = d.ImageID.String()
+			key, err = r.ResolveKey(dep.Key)
+		} else {
+			key, err = r.GetACI(d.ImageName, d.Labels)
+		}
+		if _, ok := err.(store.ACINotFoundError); ok || err == store.ErrKeyNotFound {
+			deps = append(deps, dep)
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("cannot find the dependency %q: %v", dep.Name, err)
+		}
+
+		depIm, err := r.GetImageManifest(key)
+		if err != nil {
+			return nil, err
+		}
+		dep.Size, err = r.GetACISize(key)
+		if err != nil {
+			return nil, err
+		}
+		dep.Name = imageDepName(depIm.Name, depIm.Labels)
+		dep.Key = key
+		dep.Cached = true
+		if parents[key] {
+			dep.Cycle = true
+			deps = append(deps, dep)
+			continue
+		}
+		deps = append(deps, dep)
+
+		parents[key] = true
+		deps, err = appendImageDeps(deps, r, depIm, level+1, parents)
+		if err != nil {
+			return nil, err
+		}
+		delete(parents, key)
+	}
+	return deps, nil
+}
+
+// imageDepName returns the image name followed by its version label, if any.
+func imageDepName(name types.ACIdentifier, labels types.Labels) string {
+	if version, ok := labels.Get("version"); ok {
+		return fmt.Sprintf("%s:%s", name, version)
+	}
+	return name.String()
+}
+
+// shortImageID returns the short form of the image ID, [HASH_ALGO]-[FIRST 12
+// CHAR], for example sha512-123456789012.
+func shortImageID(id string) string {
+	pos := strings.Index(id, "-")
+	trimLength := pos + 13
+	if pos > 0 && trimLength < len(id) {
+		return id[:trimLength]
+	}
+	return id
+}
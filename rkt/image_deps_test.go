@@ -0,0 +1,105 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/rkt/store"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+)
+
+type testImageDepsRegistry map[string]*schema.ImageManifest
+
+func (r testImageDepsRegistry) ResolveKey(key string) (string, error) {
+	if _, ok := r[key]; !ok {
+		return "", store.ErrKeyNotFound
+	}
+	return key, nil
+}
+
+func (r testImageDepsRegistry) GetACI(name types.ACIdentifier, labels types.Labels) (string, error) {
+	for key, im := range r {
+		if im.Name == name {
+			return key, nil
+		}
+	}
+	return "", store.ACINotFoundError{}
+}
+
+func (r testImageDepsRegistry) GetImageManifest(key string) (*schema.ImageManifest, error) {
+	im, ok := r[key]
+	if !ok {
+		return nil, fmt.Errorf("no image %q", key)
+	}
+	return im, nil
+}
+
+func (r testImageDepsRegistry) GetACISize(key string) (int64, error) {
+	return int64(len(key)), nil
+}
+
+func TestGetImageDeps(t *testing.T) {
+	const (
+		appKey  = "sha512-00"
+		baseKey = "sha512-11"
+		libKey  = "sha512-22"
+	)
+	missingID, err := types.NewHash("sha512-3333333333333333333333333333333333333333333333333333333333333333")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	r := testImageDepsRegistry{
+		appKey: &schema.ImageManifest{
+			Name:   "example.com/app",
+			Labels: types.Labels{{Name: "version", Value: "1.0"}},
+			Dependencies: types.Dependencies{
+				{ImageName: "example.com/base"},
+				{ImageName: "example.com/lib"},
+				{ImageName: "example.com/missing", ImageID: missingID},
+			},
+		},
+		baseKey: &schema.ImageManifest{
+			Name: "example.com/base",
+			Dependencies: types.Dependencies{
+				{ImageName: "example.com/lib"},
+				{ImageName: "example.com/app"},
+			},
+		},
+		libKey: &schema.ImageManifest{
+			Name: "example.com/lib",
+		},
+	}
+
+	deps, err := getImageDeps(r, appKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []imageDep{
+		{Name: "example.com/app:1.0", Key: appKey, Size: 9, Level: 0, Cached: true},
+		{Name: "example.com/base", Key: baseKey, Size: 9, Level: 1, Cached: true},
+		{Name: "example.com/lib", Key: libKey, Size: 9, Level: 2, Cached: true},
+		{Name: "example.com/app:1.0", Key: appKey, Size: 9, Level: 2, Cached: true, Cycle: true},
+		{Name: "example.com/lib", Key: libKey, Size: 9, Level: 1, Cached: true},
+		{Name: "example.com/missing", Key: missingID.String(), Level: 1},
+	}
+	if !reflect.DeepEqual(deps, want) {
+		t.Errorf("got deps %+v, want %+v", deps, want)
+	}
+}
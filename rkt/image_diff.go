@@ -0,0 +1,309 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha512"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/cobra"
+)
+
+var (
+	cmdImageDiff = &cobra.Command{
+		Use:   "diff IMAGE1 IMAGE2",
+		Short: "Print the differences between two images",
+		Long: `IMAGE1 and IMAGE2 should be strings referencing images; either hashes or image names.
+
+The differences of the labels, exec, environment and isolators of the image manifests, and the files added, removed or changed in the rootfs, are printed. The files are compared by type, mode, owner and content hash. The dependencies of the images are not compared.`,
+		Run: runWrapper(runImageDiff),
+	}
+)
+
+const (
+	diffAdded   = "added"
+	diffRemoved = "removed"
+	diffChanged = "changed"
+)
+
+func init() {
+	cmdImage.AddCommand(cmdImageDiff)
+	cmdImageDiff.Flags().BoolVar(&flagNoLegend, "no-legend", false, "suppress a legend with the list")
+	cmdImageDiff.Flags().BoolVar(&flagFullOutput, "full", false, "use long output format")
+}
+
+// imageDiff is a difference between two images.
+type imageDiff struct {
+	// Change is diffAdded, diffRemoved or diffChanged
+	Change string
+	// Item is what differs, for example "label version" or
+	// "file /etc/hosts"
+	Item string
+	// Old is the value in the first image, empty if added
+	Old string
+	// New is the value in the second image, empty if removed
+	New string
+}
+
+// imageFile is a file of the rootfs of an image.
+type imageFile struct {
+	Mode os.FileMode
+	Uid  int
+	Gid  int
+	// Hash is the hash of the content of a regular file
+	Hash string
+	// Link is the target of a symlink or a hard link
+	Link string
+}
+
+func runImageDiff(cmd *cobra.Command, args []string) (exit int) {
+	if len(args) != 2 {
+		cmd.Usage()
+		return 1
+	}
+
+	s, err := newStore()
+	if err != nil {
+		stderr("image diff: cannot open store: %v", err)
+		return 1
+	}
+	defer s.Close()
+
+	var (
+		manifests [2]*schema.ImageManifest
+		files     [2]map[string]imageFile
+	)
+	for i, arg := range args {
+		key, err := getStoreKeyFromAppOrHash(s, arg)
+		if err != nil {
+			stderr("image diff: %v", err)
+			return 1
+		}
+		manifests[i], err = s.GetImageManifest(key)
+		if err != nil {
+			stderr("image diff: cannot get image manifest of %q: %v", arg, err)
+			return 1
+		}
+		rs, err := s.ReadStream(key)
+		if err != nil {
+			stderr("image diff: cannot read image %q: %v", arg, err)
+			return 1
+		}
+		files[i], err = readImageFiles(rs)
+		rs.Close()
+		if err != nil {
+			stderr("image diff: cannot read image %q: %v", arg, err)
+			return 1
+		}
+	}
+
+	diffs := diffImageManifests(manifests[0], manifests[1])
+	diffs = append(diffs, diffImageFiles(files[0], files[1], flagFullOutput)...)
+
+	tabBuffer := new(bytes.Buffer)
+	tabOut := getTabOutWithWriter(tabBuffer)
+	if !flagNoLegend {
+		fmt.Fprintf(tabOut, "CHANGE\tITEM\tIMAGE1\tIMAGE2\n")
+	}
+	for _, d := range diffs {
+		fmt.Fprintf(tabOut, "%s\t%s\t%s\t%s\n", d.Change, d.Item, d.Old, d.New)
+	}
+	tabOut.Flush()
+	stdout("%s", tabBuffer.String())
+	return 0
+}
+
+// diffImageManifests returns the differences between the labels, exec,
+// environment and isolators of the image manifests a and b.
+func diffImageManifests(a, b *schema.ImageManifest) []imageDiff {
+	var diffs []imageDiff
+	if a.Name != b.Name {
+		diffs = append(diffs, imageDiff{diffChanged, "name", a.Name.String(), b.Name.String()})
+	}
+	diffs = append(diffs, diffValues("label", manifestLabels(a), manifestLabels(b))...)
+	diffs = append(diffs, diffValues("", manifestExec(a), manifestExec(b))...)
+	diffs = append(diffs, diffValues("env", manifestEnv(a), manifestEnv(b))...)
+	diffs = append(diffs, diffValues("isolator", manifestIsolators(a), manifestIsolators(b))...)
+	return diffs
+}
+
+func manifestLabels(im *schema.ImageManifest) map[string]string {
+	labels := make(map[string]string)
+	for _, l := range im.Labels {
+		labels[l.Name.String()] = l.Value
+	}
+	return labels
+}
+
+func manifestExec(im *schema.ImageManifest) map[string]string {
+	exec := make(map[string]string)
+	if im.App != nil && len(im.App.Exec) > 0 {
+		exec["exec"] = strings.Join(im.App.Exec, " ")
+	}
+	return exec
+}
+
+func manifestEnv(im *schema.ImageManifest) map[string]string {
+	env := make(map[string]string)
+	if im.App != nil {
+		for _, e := range im.App.Environment {
+			env[e.Name] = e.Value
+		}
+	}
+	return env
+}
+
+func manifestIsolators(im *schema.ImageManifest) map[string]string {
+	isolators := make(map[string]string)
+	if im.App != nil {
+		for _, iso := range im.App.Isolators {
+			value := ""
+			if iso.ValueRaw != nil {
+				value = string(*iso.ValueRaw)
+			}
+			isolators[iso.Name.String()] = value
+		}
+	}
+	return isolators
+}
+
+// diffValues returns the differences between the values of a and b, by
+// key, sorted by key. The items are the kind followed by the keys.
+func diffValues(kind string, a, b map[string]string) []imageDiff {
+	keys := make(map[string]struct{})
+	for k := range a {
+		keys[k] = struct{}{}
+	}
+	for k := range b {
+		keys[k] = struct{}{}
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	var diffs []imageDiff
+	for _, k := range sorted {
+		item := strings.TrimSpace(kind + " " + k)
+		va, inA := a[k]
+		vb, inB := b[k]
+		switch {
+		case !inA:
+			diffs = append(diffs, imageDiff{diffAdded, item, "", vb})
+		case !inB:
+			diffs = append(diffs, imageDiff{diffRemoved, item, va, ""})
+		case va != vb:
+			diffs = append(diffs, imageDiff{diffChanged, item, va, vb})
+		}
+	}
+	return diffs
+}
+
+// readImageFiles returns the files of the rootfs of the ACI read from r, by
+// path in the rootfs.
+func readImageFiles(r io.Reader) (map[string]imageFile, error) {
+	files := make(map[string]imageFile)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := filepath.Clean(hdr.Name)
+		if !strings.HasPrefix(name, "rootfs/") {
+			continue
+		}
+		f := imageFile{
+			Mode: hdr.FileInfo().Mode(),
+			Uid:  hdr.Uid,
+			Gid:  hdr.Gid,
+		}
+		switch hdr.Typeflag {
+		case tar.TypeReg, tar.TypeRegA:
+			hash := sha512.New()
+			if _, err := io.Copy(hash, tr); err != nil {
+				return nil, err
+			}
+			f.Hash = fmt.Sprintf("sha512-%x", hash.Sum(nil))
+		case tar.TypeSymlink:
+			f.Link = hdr.Linkname
+		case tar.TypeLink:
+			f.Link = "/" + strings.TrimPrefix(filepath.Clean(hdr.Linkname), "rootfs/")
+		}
+		files[strings.TrimPrefix(name, "rootfs")] = f
+	}
+	return files, nil
+}
+
+// diffImageFiles returns the files added, removed or changed between the
+// files of the images a and b, sorted by path. The hashes are shortened
+// unless full is true.
+func diffImageFiles(a, b map[string]imageFile, full bool) []imageDiff {
+	paths := make(map[string]struct{})
+	for path := range a {
+		paths[path] = struct{}{}
+	}
+	for path := range b {
+		paths[path] = struct{}{}
+	}
+	sorted := make([]string, 0, len(paths))
+	for path := range paths {
+		sorted = append(sorted, path)
+	}
+	sort.Strings(sorted)
+
+	var diffs []imageDiff
+	for _, path := range sorted {
+		item := "file " + path
+		fa, inA := a[path]
+		fb, inB := b[path]
+		switch {
+		case !inA:
+			diffs = append(diffs, imageDiff{diffAdded, item, "", fb.describe(full)})
+		case !inB:
+			diffs = append(diffs, imageDiff{diffRemoved, item, fa.describe(full), ""})
+		case fa != fb:
+			diffs = append(diffs, imageDiff{diffChanged, item, fa.describe(full), fb.describe(full)})
+		}
+	}
+	return diffs
+}
+
+// describe returns the mode, owner and hash or link target of the file. The
+// hash is shortened unless full is true.
+func (f imageFile) describe(full bool) string {
+	desc := fmt.Sprintf("%v %d:%d", f.Mode, f.Uid, f.Gid)
+	switch {
+	case f.Hash != "" && full:
+		desc += " " + f.Hash
+	case f.Hash != "":
+		desc += " " + shortImageID(f.Hash)
+	case f.Link != "":
+		desc += " -> " + f.Link
+	}
+	return desc
+}
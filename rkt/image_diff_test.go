@@ -0,0 +1,141 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+)
+
+func TestDiffImageManifests(t *testing.T) {
+	var a, b schema.ImageManifest
+	imj := `{
+		"acKind": "ImageManifest",
+		"acVersion": "0.7.1",
+		"name": "example.com/app",
+		"labels": [{"name": "version", "value": "1.0.0"}, {"name": "os", "value": "linux"}],
+		"app": {
+			"exec": ["/bin/app"],
+			"user": "0",
+			"group": "0",
+			"environment": [{"name": "MODE", "value": "fast"}, {"name": "OLD", "value": "1"}],
+			"isolators": [{"name": "resource/memory", "value": {"limit": "1G"}}]
+		}
+	}`
+	if err := json.Unmarshal([]byte(imj), &a); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	imj = `{
+		"acKind": "ImageManifest",
+		"acVersion": "0.7.1",
+		"name": "example.com/app",
+		"labels": [{"name": "version", "value": "1.1.0"}, {"name": "os", "value": "linux"}],
+		"app": {
+			"exec": ["/bin/app", "--serve"],
+			"user": "0",
+			"group": "0",
+			"environment": [{"name": "MODE", "value": "fast"}, {"name": "NEW", "value": "2"}],
+			"isolators": [{"name": "resource/memory", "value": {"limit": "2G"}}]
+		}
+	}`
+	if err := json.Unmarshal([]byte(imj), &b); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []imageDiff{
+		{diffChanged, "label version", "1.0.0", "1.1.0"},
+		{diffChanged, "exec", "/bin/app", "/bin/app --serve"},
+		{diffAdded, "env NEW", "", "2"},
+		{diffRemoved, "env OLD", "1", ""},
+		{diffChanged, "isolator resource/memory", `{"limit": "1G"}`, `{"limit": "2G"}`},
+	}
+	if diffs := diffImageManifests(&a, &b); !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("expected diffs %v, got %v", expected, diffs)
+	}
+	if diffs := diffImageManifests(&a, &a); len(diffs) != 0 {
+		t.Errorf("expected no diff with the same manifest, got %v", diffs)
+	}
+}
+
+func TestDiffImageFiles(t *testing.T) {
+	type file struct {
+		name     string
+		mode     int64
+		typeflag byte
+		data     string
+	}
+	readFiles := func(files []file) map[string]imageFile {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for _, f := range files {
+			hdr := &tar.Header{Name: f.name, Mode: f.mode, Typeflag: f.typeflag, Size: int64(len(f.data))}
+			if f.typeflag == tar.TypeSymlink {
+				hdr.Linkname, hdr.Size = f.data, 0
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				t.Fatalf("error creating test tar: %v", err)
+			}
+			if hdr.Size > 0 {
+				if _, err := tw.Write([]byte(f.data)); err != nil {
+					t.Fatalf("error creating test tar: %v", err)
+				}
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatalf("error creating test tar: %v", err)
+		}
+		imageFiles, err := readImageFiles(&buf)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return imageFiles
+	}
+
+	a := readFiles([]file{
+		{"manifest", 0644, tar.TypeReg, "a"},
+		{"rootfs", 0755, tar.TypeDir, ""},
+		{"rootfs/bin", 0755, tar.TypeDir, ""},
+		{"rootfs/bin/app", 0755, tar.TypeReg, "v1"},
+		{"rootfs/bin/old", 0755, tar.TypeReg, "old"},
+		{"rootfs/etc/config", 0644, tar.TypeReg, "same"},
+		{"rootfs/bin/sh", 0777, tar.TypeSymlink, "busybox"},
+	})
+	b := readFiles([]file{
+		{"manifest", 0644, tar.TypeReg, "b"},
+		{"rootfs", 0755, tar.TypeDir, ""},
+		{"rootfs/bin", 0755, tar.TypeDir, ""},
+		{"rootfs/bin/app", 0755, tar.TypeReg, "v2"},
+		{"rootfs/bin/new", 0755, tar.TypeReg, "new"},
+		{"rootfs/etc/config", 0600, tar.TypeReg, "same"},
+		{"rootfs/bin/sh", 0777, tar.TypeSymlink, "bash"},
+	})
+
+	expected := []imageDiff{
+		{diffChanged, "file /bin/app", "-rwxr-xr-x 0:0 sha512-d7f9aa6007b5", "-rwxr-xr-x 0:0 sha512-00a43ddeb17a"},
+		{diffAdded, "file /bin/new", "", "-rwxr-xr-x 0:0 sha512-aa54def9e0bb"},
+		{diffRemoved, "file /bin/old", "-rwxr-xr-x 0:0 sha512-a6d96fa05fb2", ""},
+		{diffChanged, "file /bin/sh", "Lrwxrwxrwx 0:0 -> busybox", "Lrwxrwxrwx 0:0 -> bash"},
+		{diffChanged, "file /etc/config", "-rw-r--r-- 0:0 sha512-d4d63b3d987d", "-rw------- 0:0 sha512-d4d63b3d987d"},
+	}
+	diffs := diffImageFiles(a, b, false)
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("expected diffs %v, got %v", expected, diffs)
+	}
+}
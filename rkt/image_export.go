@@ -15,10 +15,12 @@
 package main
 
 import (
+	"fmt"
 	"io"
 	"os"
+	"strings"
 
-	"github.com/coreos/rkt/store"
+	"github.com/coreos/rkt/pkg/aci"
 
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/cobra"
 )
@@ -30,12 +32,22 @@ var (
 		Long:  `IMAGE should be a string referencing an image: either a hash or an image name.`,
 		Run:   runWrapper(runImageExport),
 	}
-	flagOverwriteACI bool
+	flagOverwriteACI   bool
+	flagACICompression string
 )
 
 func init() {
 	cmdImage.AddCommand(cmdImageExport)
 	cmdImageExport.Flags().BoolVar(&flagOverwriteACI, "overwrite", false, "overwrite output ACI")
+	cmdImageExport.Flags().StringVar(&flagACICompression, "compression", string(aci.CompressionNone), fmt.Sprintf("compression of the output ACI, one of: %s", compressionsHelp()))
+}
+
+func compressionsHelp() string {
+	var cs []string
+	for _, c := range aci.Compressions {
+		cs = append(cs, string(c))
+	}
+	return strings.Join(cs, ", ")
 }
 
 func runImageExport(cmd *cobra.Command, args []string) (exit int) {
@@ -44,7 +56,13 @@ func runImageExport(cmd *cobra.Command, args []string) (exit int) {
 		return 1
 	}
 
-	s, err := store.NewStore(globalFlags.Dir)
+	compression, err := aci.ParseCompression(flagACICompression)
+	if err != nil {
+		stderr("image export: %v", err)
+		return 1
+	}
+
+	s, err := newStore()
 	if err != nil {
 		stderr("image export: cannot open store: %v", err)
 		return 1
@@ -56,12 +74,12 @@ func runImageExport(cmd *cobra.Command, args []string) (exit int) {
 		return 1
 	}
 
-	aci, err := s.ReadStream(key)
+	rs, err := s.ReadStream(key)
 	if err != nil {
 		stderr("image export: error reading image: %v", err)
 		return 1
 	}
-	defer aci.Close()
+	defer rs.Close()
 
 	mode := os.O_CREATE | os.O_WRONLY
 	if flagOverwriteACI {
@@ -86,11 +104,19 @@ func runImageExport(cmd *cobra.Command, args []string) (exit int) {
 		}
 	}()
 
-	_, err = io.Copy(f, aci)
+	w, err := aci.NewCompressedWriter(f, compression)
 	if err != nil {
+		stderr("image export: %v", err)
+		return 1
+	}
+	if _, err := io.Copy(w, rs); err != nil {
 		stderr("image export: error writing to output ACI file: %v", err)
 		return 1
 	}
+	if err := w.Close(); err != nil {
+		stderr("image export: error compressing the output ACI file: %v", err)
+		return 1
+	}
 
 	return 0
 }
@@ -23,7 +23,6 @@ import (
 	"github.com/coreos/rkt/pkg/fileutil"
 	"github.com/coreos/rkt/pkg/tar"
 	"github.com/coreos/rkt/pkg/uid"
-	"github.com/coreos/rkt/store"
 
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/cobra"
 )
@@ -37,12 +36,18 @@ var (
 	}
 	flagExtractRootfsOnly bool
 	flagExtractOverwrite  bool
+	flagExtractInPlace    bool
+	flagExtractUidShift   uint32
+	flagExtractGidShift   uint32
 )
 
 func init() {
 	cmdImage.AddCommand(cmdImageExtract)
 	cmdImageExtract.Flags().BoolVar(&flagExtractRootfsOnly, "rootfs-only", false, "extract rootfs only")
 	cmdImageExtract.Flags().BoolVar(&flagExtractOverwrite, "overwrite", false, "overwrite output directory")
+	cmdImageExtract.Flags().BoolVar(&flagExtractInPlace, "in-place", false, "extract into the existing output directory, replacing its files also in the image and keeping the others")
+	cmdImageExtract.Flags().Uint32Var(&flagExtractUidShift, "uid-shift", 0, "value added to the user owners of the files, e.g. for user-namespaced pods")
+	cmdImageExtract.Flags().Uint32Var(&flagExtractGidShift, "gid-shift", 0, "value added to the group owners of the files, e.g. for user-namespaced pods")
 }
 
 func runImageExtract(cmd *cobra.Command, args []string) (exit int) {
@@ -52,7 +57,12 @@ func runImageExtract(cmd *cobra.Command, args []string) (exit int) {
 	}
 	outputDir := args[1]
 
-	s, err := store.NewStore(globalFlags.Dir)
+	if flagExtractOverwrite && flagExtractInPlace {
+		stderr("image extract: --overwrite and --in-place cannot be used together")
+		return 1
+	}
+
+	s, err := newStore()
 	if err != nil {
 		stderr("image extract: cannot open store: %v", err)
 		return 1
@@ -77,7 +87,7 @@ func runImageExtract(cmd *cobra.Command, args []string) (exit int) {
 		return 1
 	}
 
-	if _, err := os.Stat(absOutputDir); err == nil {
+	if _, err := os.Stat(absOutputDir); err == nil && !flagExtractInPlace {
 		if !flagExtractOverwrite {
 			stderr("image extract: output directory exists (try --overwrite)")
 			return 1
@@ -95,11 +105,20 @@ func runImageExtract(cmd *cobra.Command, args []string) (exit int) {
 		}
 	}
 
+	// the files are copied from a temporary directory to the output
+	// directory when they are written in place or their owners are shifted
+	copyOpts := fileutil.CopyTreeOptions{
+		Overwrite: flagExtractInPlace,
+		UidShift:  flagExtractUidShift,
+		GidShift:  flagExtractGidShift,
+	}
+	copyFromTmp := copyOpts != fileutil.CopyTreeOptions{}
+
 	// if the user only asks for the rootfs we extract the image to a temporary
 	// directory and then move/copy the rootfs to the output directory, if not
 	// we just extract the image to the output directory
 	extractDir := absOutputDir
-	if flagExtractRootfsOnly {
+	if flagExtractRootfsOnly || copyFromTmp {
 		rktTmpDir, err := s.TmpDir()
 		if err != nil {
 			stderr("image extract: error creating rkt temporary directory: %v", err)
@@ -126,12 +145,22 @@ func runImageExtract(cmd *cobra.Command, args []string) (exit int) {
 		return 1
 	}
 
+	srcDir := extractDir
 	if flagExtractRootfsOnly {
-		rootfsDir := filepath.Join(extractDir, "rootfs")
-		if err := os.Rename(rootfsDir, absOutputDir); err != nil {
+		srcDir = filepath.Join(extractDir, "rootfs")
+	}
+
+	switch {
+	case copyFromTmp:
+		if err := fileutil.CopyTreeWithOptions(srcDir, absOutputDir, copyOpts); err != nil {
+			stderr("image extract: error copying ACI: %v", err)
+			return 1
+		}
+	case flagExtractRootfsOnly:
+		if err := os.Rename(srcDir, absOutputDir); err != nil {
 			if e, ok := err.(*os.LinkError); ok && e.Err == syscall.EXDEV {
 				// it's on a different device, fall back to copying
-				if err := fileutil.CopyTree(rootfsDir, absOutputDir, uid.NewBlankUidRange()); err != nil {
+				if err := fileutil.CopyTree(srcDir, absOutputDir, uid.NewBlankUidRange()); err != nil {
 					stderr("image extract: error copying ACI rootfs: %v", err)
 					return 1
 				}
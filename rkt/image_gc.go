@@ -18,9 +18,8 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/dustin/go-humanize"
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/cobra"
-	"github.com/coreos/rkt/common"
-	"github.com/coreos/rkt/pkg/lock"
 	"github.com/coreos/rkt/store"
 )
 
@@ -40,21 +39,24 @@ var (
 func init() {
 	cmdImage.AddCommand(cmdImageGc)
 	cmdImageGc.Flags().DurationVar(&flagImageGracePeriod, "grace-period", defaultImageGracePeriod, "duration to wait since an image was last used before removing it")
+	cmdImageGc.Flags().DurationVar(&flagLockTimeout, "lock-timeout", 0, "duration to wait for the locks held by other rkt processes before giving up, 0 to wait indefinitely")
 }
 
 func runGcImage(cmd *cobra.Command, args []string) (exit int) {
-	s, err := store.NewStore(globalFlags.Dir)
+	s, err := newStore()
 	if err != nil {
 		stderr("rkt: cannot open store: %v", err)
 		return 1
 	}
 
-	if err := gcTreeStore(s); err != nil {
-		stderr("rkt: failed to remove unreferenced treestores: %v", err)
+	keyLock, err := exclusivePrepareLock(flagLockTimeout)
+	if err != nil {
+		stderr("rkt: cannot get exclusive prepare lock: %v", err)
 		return 1
 	}
+	defer keyLock.Close()
 
-	if err := gcStore(s, flagImageGracePeriod); err != nil {
+	if err := gcImages(s, flagImageGracePeriod); err != nil {
 		stderr("rkt: %v", err)
 		return 1
 	}
@@ -62,23 +64,38 @@ func runGcImage(cmd *cobra.Command, args []string) (exit int) {
 	return 0
 }
 
-// gcTreeStore removes all treeStoreIDs not referenced by any non garbage
-// collected pod from the store.
-func gcTreeStore(s *store.Store) error {
-	// Take an exclusive lock to block other pods being created.
-	// This is needed to avoid races between the below steps (getting the
-	// list of referenced treeStoreIDs, getting the list of treeStoreIDs
-	// from the store, removal of unreferenced treeStoreIDs) and new
-	// pods/treeStores being created/referenced
-	keyLock, err := lock.ExclusiveKeyLock(lockDir(), common.PrepareLock)
+// gcImages removes the treestores and the images not referenced by any
+// non garbage collected pod from the store. The images referenced by no pod
+// are removed when they have not been used for gracePeriod.
+// The caller must hold the exclusive prepare lock, to block other pods being
+// created. This is needed to avoid races between the below steps (getting the
+// references of the pods, getting the list of treeStoreIDs and images from the
+// store, removal of the unreferenced ones) and new pods/treeStores being
+// created/referenced.
+func gcImages(s *store.Store, gracePeriod time.Duration) error {
+	refs, err := getPodReferences(s)
 	if err != nil {
-		return fmt.Errorf("cannot get exclusive prepare lock: %v", err)
+		return err
 	}
-	defer keyLock.Close()
-	referencedTreeStoreIDs, err := getReferencedTreeStoreIDs()
-	if err != nil {
-		return fmt.Errorf("cannot get referenced treestoreIDs: %v", err)
+
+	if err := gcTreeStore(s, refs.treeStoreIDs); err != nil {
+		return fmt.Errorf("failed to remove unreferenced treestores: %v", err)
+	}
+
+	if err := gcStore(s, gracePeriod, refs.imageKeys); err != nil {
+		return err
+	}
+
+	if err := gcDangling(s); err != nil {
+		return err
 	}
+
+	return nil
+}
+
+// gcTreeStore removes all treeStoreIDs not in referencedTreeStoreIDs from
+// the store.
+func gcTreeStore(s *store.Store, referencedTreeStoreIDs map[string]struct{}) error {
 	treeStoreIDs, err := s.GetTreeStoreIDs()
 	if err != nil {
 		return fmt.Errorf("cannot get treestoreIDs from the store: %v", err)
@@ -95,11 +112,61 @@ func gcTreeStore(s *store.Store) error {
 	return nil
 }
 
-func getReferencedTreeStoreIDs() (map[string]struct{}, error) {
-	treeStoreIDs := map[string]struct{}{}
+// gcDangling removes the entries of the store left behind by the images
+// not fully removed or imported.
+func gcDangling(s *store.Store) error {
+	report, err := s.RemoveDangling()
+	if err != nil {
+		return fmt.Errorf("failed to remove dangling store entries: %v", err)
+	}
+	for _, key := range report.Keys {
+		stderr("rkt: removed dangling blob and image manifest %q", key)
+	}
+	for _, aciURL := range report.Remotes {
+		stderr("rkt: removed dangling remote %q", aciURL)
+	}
+	if len(report.Keys) > 0 {
+		stderr("rkt: reclaimed %s from dangling store entries", humanize.IBytes(uint64(report.Size)))
+	}
+	return nil
+}
+
+// podReferences are the treestores and the images used by the pods which
+// are not garbage collected yet.
+type podReferences struct {
+	treeStoreIDs map[string]struct{}
+	imageKeys    map[string]struct{}
+	// the stage1 images are not kept by rkt image gc, their treestores
+	// are
+	stage1ImageKeys map[string]struct{}
+}
+
+// isImageUsed returns whether the image with the given key is an app image
+// or the stage1 image of a pod.
+func (refs *podReferences) isImageUsed(key string) bool {
+	_, app := refs.imageKeys[key]
+	_, stage1 := refs.stage1ImageKeys[key]
+	return app || stage1
+}
+
+// getPodReferences returns the treestores and the images referenced by the
+// pods which are preparing, prepared, running, or exited but not garbage
+// collected yet. The failed prepares are ignored, as they will only be
+// removed.
+// Any error is returned, as removing something still in use is worse than
+// not collecting anything.
+func getPodReferences(s *store.Store) (*podReferences, error) {
+	refs := &podReferences{
+		treeStoreIDs:    map[string]struct{}{},
+		imageKeys:       map[string]struct{}{},
+		stage1ImageKeys: map[string]struct{}{},
+	}
 	var walkErr error
-	// Consider pods in preparing, prepared, run, exitedgarbage state
 	if err := walkPods(includeMostDirs, func(p *pod) {
+		if walkErr != nil || p.isAbortedPrepare {
+			return
+		}
+
 		stage1TreeStoreID, err := p.getStage1TreeStoreID()
 		if err != nil {
 			walkErr = fmt.Errorf("cannot get stage1 treestoreID for pod %s: %v", p.uuid, err)
@@ -113,7 +180,42 @@ func getReferencedTreeStoreIDs() (map[string]struct{}, error) {
 		allTreeStoreIDs := append(appsTreeStoreIDs, stage1TreeStoreID)
 
 		for _, treeStoreID := range allTreeStoreIDs {
-			treeStoreIDs[treeStoreID] = struct{}{}
+			refs.treeStoreIDs[treeStoreID] = struct{}{}
+		}
+
+		hashes, err := p.getAppsHashes()
+		if err != nil {
+			walkErr = fmt.Errorf("cannot get app images for pod %s: %v", p.uuid, err)
+			return
+		}
+		for _, h := range hashes {
+			key, err := s.ResolveKey(h.String())
+			// the image may have been removed with 'rkt image rm'
+			if err == store.ErrKeyNotFound {
+				continue
+			}
+			if err != nil {
+				walkErr = fmt.Errorf("cannot resolve image ID %q of pod %s: %v", h, p.uuid, err)
+				return
+			}
+			refs.imageKeys[key] = struct{}{}
+		}
+
+		s1Hash, err := p.getStage1Hash()
+		if err != nil {
+			walkErr = fmt.Errorf("cannot get stage1 image for pod %s: %v", p.uuid, err)
+			return
+		}
+		if s1Hash != nil {
+			key, err := s.ResolveKey(s1Hash.String())
+			switch {
+			case err == store.ErrKeyNotFound:
+			case err != nil:
+				walkErr = fmt.Errorf("cannot resolve stage1 image ID %q of pod %s: %v", s1Hash, p.uuid, err)
+				return
+			default:
+				refs.stage1ImageKeys[key] = struct{}{}
+			}
 		}
 	}); err != nil {
 		return nil, fmt.Errorf("failed to get pod handles: %v", err)
@@ -121,10 +223,12 @@ func getReferencedTreeStoreIDs() (map[string]struct{}, error) {
 	if walkErr != nil {
 		return nil, walkErr
 	}
-	return treeStoreIDs, nil
+	return refs, nil
 }
 
-func gcStore(s *store.Store, gracePeriod time.Duration) error {
+// gcStore removes the images not used for gracePeriod from the store,
+// unless they are in referencedImageKeys.
+func gcStore(s *store.Store, gracePeriod time.Duration, referencedImageKeys map[string]struct{}) error {
 	var imagesToRemove []string
 	aciinfos, err := s.GetAllACIInfos([]string{"lastusedtime"}, true)
 	if err != nil {
@@ -134,10 +238,14 @@ func gcStore(s *store.Store, gracePeriod time.Duration) error {
 		if time.Now().Sub(ai.LastUsedTime) <= gracePeriod {
 			break
 		}
+		if _, ok := referencedImageKeys[ai.BlobKey]; ok {
+			stderr("rkt: image ID %q not removed: still used by a pod", ai.BlobKey)
+			continue
+		}
 		imagesToRemove = append(imagesToRemove, ai.BlobKey)
 	}
 
-	if err := rmImages(s, imagesToRemove); err != nil {
+	if err := rmImages(s, imagesToRemove, false); err != nil {
 		return err
 	}
 
@@ -0,0 +1,111 @@
+// Copyright 2014 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/pkg/aci"
+	"github.com/coreos/rkt/store"
+)
+
+// TestGetPodReferencesRemovedImage checks that an image of a pod removed
+// from the store doesn't prevent collecting the others.
+func TestGetPodReferencesRemovedImage(t *testing.T) {
+	d, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating tmpdir: %v", err)
+	}
+	defer os.RemoveAll(d)
+	oldDir, oldInitialized := globalFlags.Dir, podsInitialized
+	defer func() {
+		globalFlags.Dir, podsInitialized = oldDir, oldInitialized
+	}()
+	globalFlags.Dir = d
+	podsInitialized = false
+	if err := initPods(); err != nil {
+		t.Fatalf("error initializing pods: %v", err)
+	}
+
+	s, err := store.NewStore(filepath.Join(d, "cas"))
+	if err != nil {
+		t.Fatalf("error creating store: %v", err)
+	}
+	defer s.Close()
+
+	a, err := aci.NewBasicACI(d, "example.com/app")
+	if err != nil {
+		t.Fatalf("error creating image: %v", err)
+	}
+	defer a.Close()
+	if _, err := a.Seek(0, 0); err != nil {
+		t.Fatalf("error rewinding image: %v", err)
+	}
+	key, err := s.WriteACI(a, false)
+	if err != nil {
+		t.Fatalf("error writing image: %v", err)
+	}
+	h, err := types.NewHash(key)
+	if err != nil {
+		t.Fatalf("error parsing image ID: %v", err)
+	}
+	// the ID of an image which is not in the store
+	removed, err := types.NewHash("sha512-" + fmt.Sprintf("%0128x", 1))
+	if err != nil {
+		t.Fatalf("error parsing image ID: %v", err)
+	}
+
+	pm := schema.BlankPodManifest()
+	pm.Apps = schema.AppList{
+		{Name: *types.MustACName("app"), Image: schema.RuntimeImage{ID: *h}},
+		{Name: *types.MustACName("removed"), Image: schema.RuntimeImage{ID: *removed}},
+	}
+	b, err := json.Marshal(pm)
+	if err != nil {
+		t.Fatalf("error marshaling pod manifest: %v", err)
+	}
+	dir := filepath.Join(preparedDir(), "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatalf("error creating pod directory: %v", err)
+	}
+	if err := ioutil.WriteFile(common.PodManifestPath(dir), b, 0600); err != nil {
+		t.Fatalf("error writing pod manifest: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, common.Stage1TreeStoreIDFilename), []byte("stage1"), 0600); err != nil {
+		t.Fatalf("error writing stage1 treeStoreID: %v", err)
+	}
+
+	refs, err := getPodReferences(s)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := map[string]struct{}{key: {}}; !reflect.DeepEqual(refs.imageKeys, want) {
+		t.Errorf("expected referenced images %v, got %v", want, refs.imageKeys)
+	}
+	if want := map[string]struct{}{"stage1": {}}; !reflect.DeepEqual(refs.treeStoreIDs, want) {
+		t.Errorf("expected referenced treeStoreIDs %v, got %v", want, refs.treeStoreIDs)
+	}
+}
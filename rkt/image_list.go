@@ -24,7 +24,6 @@ import (
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/lastditch"
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/dustin/go-humanize"
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/cobra"
-	"github.com/coreos/rkt/store"
 )
 
 const (
@@ -35,6 +34,10 @@ const (
 	importTimeField   = "importtime"
 	lastUsedTimeField = "lastusedtime"
 	latestField       = "latest"
+	inUseField        = "inuse"
+
+	unusedFilter = "unused"
+	inUseFilter  = "in-use"
 )
 
 var (
@@ -45,6 +48,7 @@ var (
 		importTimeField:   struct{}{},
 		lastUsedTimeField: struct{}{},
 		latestField:       struct{}{},
+		inUseField:        struct{}{},
 	}
 
 	// map of valid fields and related header name
@@ -54,6 +58,7 @@ var (
 		importTimeField:   "IMPORT TIME",
 		lastUsedTimeField: "LAST USED",
 		latestField:       "LATEST",
+		inUseField:        "IN USE",
 	}
 
 	// map of valid sort fields containing the mapping between the provided field name
@@ -160,6 +165,28 @@ func (isa *ImagesSortAsc) Type() string {
 	return "imagesSortAsc"
 }
 
+// ImagesFilter selects the images listed by whether a pod uses them, empty
+// for all the images.
+type ImagesFilter string
+
+func (isf *ImagesFilter) Set(s string) error {
+	switch strings.ToLower(s) {
+	case unusedFilter, inUseFilter:
+		*isf = ImagesFilter(strings.ToLower(s))
+	default:
+		return fmt.Errorf("unknown filter %q", s)
+	}
+	return nil
+}
+
+func (isf *ImagesFilter) String() string {
+	return string(*isf)
+}
+
+func (isf *ImagesFilter) Type() string {
+	return "imagesFilter"
+}
+
 var (
 	cmdImageList = &cobra.Command{
 		Use:   "list",
@@ -169,6 +196,7 @@ var (
 	flagImagesFields     ImagesFields
 	flagImagesSortFields ImagesSortFields
 	flagImagesSortAsc    ImagesSortAsc
+	flagImagesFilter     ImagesFilter
 )
 
 func init() {
@@ -178,9 +206,10 @@ func init() {
 	flagImagesSortAsc = true
 
 	cmdImage.AddCommand(cmdImageList)
-	cmdImageList.Flags().Var(&flagImagesFields, "fields", `comma separated list of fields to display. Accepted values: "id", "name", "importtime", "lastusedtime", "latest"`)
+	cmdImageList.Flags().Var(&flagImagesFields, "fields", `comma separated list of fields to display. Accepted values: "id", "name", "importtime", "lastusedtime", "latest", "inuse"`)
 	cmdImageList.Flags().Var(&flagImagesSortFields, "sort", `sort the output according to the provided comma separated list of fields. Accepted values: "name", "importtime", "lastusedtime"`)
 	cmdImageList.Flags().Var(&flagImagesSortAsc, "order", `choose the sorting order if at least one sort field is provided (--sort). Accepted values: "asc", "desc"`)
+	cmdImageList.Flags().Var(&flagImagesFilter, "filter", `only list the images used, or not, by a pod which is not garbage collected yet, as the app image or the stage1 image. Accepted values: "unused", "in-use"`)
 	cmdImageList.Flags().BoolVar(&flagNoLegend, "no-legend", false, "suppress a legend with the list")
 	cmdImageList.Flags().BoolVar(&flagFullOutput, "full", false, "use long output format")
 }
@@ -198,7 +227,7 @@ func runImages(cmd *cobra.Command, args []string) int {
 		fmt.Fprintf(tabOut, "%s\n", strings.Join(headerFields, "\t"))
 	}
 
-	s, err := store.NewStore(globalFlags.Dir)
+	s, err := newStore()
 	if err != nil {
 		stderr("images: cannot open store: %v\n", err)
 		return 1
@@ -214,7 +243,20 @@ func runImages(cmd *cobra.Command, args []string) int {
 		return 1
 	}
 
+	// walking the pods is only needed to tell the images they use
+	var refs *podReferences
+	if flagImagesFilter != "" || hasImagesField(inUseField) {
+		if refs, err = getPodReferences(s); err != nil {
+			stderr("images: cannot get the images used by the pods: %v", err)
+			return 1
+		}
+	}
+
 	for _, aciInfo := range aciInfos {
+		inUse := refs != nil && refs.isImageUsed(aciInfo.BlobKey)
+		if (flagImagesFilter == unusedFilter && inUse) || (flagImagesFilter == inUseFilter && !inUse) {
+			continue
+		}
 		imj, err := s.GetImageManifestJSON(aciInfo.BlobKey)
 		if err != nil {
 			// ignore aciInfo with missing image manifest as it can be deleted in the meantime
@@ -233,13 +275,7 @@ func runImages(cmd *cobra.Command, args []string) int {
 			case idField:
 				hashKey := aciInfo.BlobKey
 				if !flagFullOutput {
-					// The short hash form is [HASH_ALGO]-[FIRST 12 CHAR]
-					// For example, sha512-123456789012
-					pos := strings.Index(hashKey, "-")
-					trimLength := pos + 13
-					if pos > 0 && trimLength < len(hashKey) {
-						hashKey = hashKey[:trimLength]
-					}
+					hashKey = shortImageID(hashKey)
 				}
 				fieldValue = hashKey
 			case nameField:
@@ -262,6 +298,8 @@ func runImages(cmd *cobra.Command, args []string) int {
 
 			case latestField:
 				fieldValue = fmt.Sprintf("%t", aciInfo.Latest)
+			case inUseField:
+				fieldValue = fmt.Sprintf("%t", inUse)
 			}
 			fieldValues = append(fieldValues, fieldValue)
 
@@ -287,6 +325,16 @@ func runImages(cmd *cobra.Command, args []string) int {
 	return 0
 }
 
+// hasImagesField returns whether the field is displayed.
+func hasImagesField(field string) bool {
+	for _, f := range flagImagesFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
 func newImgListLoadError(err error, imj []byte, blobKey string) error {
 	var lines []string
 	im := lastditch.ImageManifest{}
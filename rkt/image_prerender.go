@@ -0,0 +1,100 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"syscall"
+
+	"github.com/coreos/rkt/store"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/cobra"
+)
+
+var (
+	cmdImagePrerender = &cobra.Command{
+		Use:   "prerender IMAGE...",
+		Short: "Render stored images in the tree store ahead of their first use",
+		Long: `IMAGE should be a string referencing an image: either a hash or an image name.
+
+The images are otherwise rendered in the tree store when a pod first uses them.`,
+		Run: runWrapper(runImagePrerender),
+	}
+)
+
+func init() {
+	cmdImage.AddCommand(cmdImagePrerender)
+}
+
+func runImagePrerender(cmd *cobra.Command, args []string) (exit int) {
+	if len(args) < 1 {
+		cmd.Usage()
+		return 1
+	}
+
+	s, err := newStore()
+	if err != nil {
+		stderr("image prerender: cannot open store: %v", err)
+		return 1
+	}
+	defer s.Close()
+
+	for _, img := range args {
+		key, err := getStoreKeyFromAppOrHash(s, img)
+		if err != nil {
+			stderr("image prerender: %v", err)
+			exit = 1
+			continue
+		}
+		if _, err := renderTreeStore(s, key); err != nil {
+			stderr("image prerender: %v", err)
+			exit = 1
+		}
+	}
+	return
+}
+
+// renderTreeStore renders the image with the given key in the tree store,
+// or rebuilds it if it is in a bad state, and returns its tree store ID.
+func renderTreeStore(s *store.Store, key string) (string, error) {
+	id, err := s.RenderTreeStore(key, false)
+	if err != nil {
+		return "", fmt.Errorf("error rendering ACI: %v", err)
+	}
+	if err := s.CheckTreeStore(id); err != nil {
+		stderr("warning: tree cache is in a bad state. Rebuilding...")
+		if id, err = s.RenderTreeStore(key, true); err != nil {
+			return "", fmt.Errorf("error rendering ACI: %v", err)
+		}
+	}
+	return id, nil
+}
+
+// prerenderInBackground starts a detached 'rkt image prerender' rendering
+// the images in the tree store, and does not wait for it.
+func prerenderInBackground(hashes []string) error {
+	args := rktGlobalArgs()
+	args = append(args, "image", "prerender")
+	args = append(args, hashes...)
+
+	cmd := exec.Command("/proc/self/exe", args...)
+	// Do not let the rendering die with this rkt.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	return cmd.Process.Release()
+}
@@ -0,0 +1,397 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/coreos/rkt/pkg/aci"
+	"github.com/coreos/rkt/pkg/keystore"
+	"github.com/coreos/rkt/rkt/config"
+	"github.com/coreos/rkt/store"
+	"github.com/coreos/rkt/version"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/cobra"
+)
+
+var (
+	cmdImagePush = &cobra.Command{
+		Use:   "push IMAGE URL",
+		Short: "Push a stored image to a registry or an HTTP server",
+		Long: `IMAGE should be a string referencing an image: either a hash or an image name.
+
+URL is where the image is pushed:
+  http://HOST/PATH or https://HOST/PATH
+      the ACI is uploaded with a PUT request, and its signature next to it
+      with the .asc extension
+  acpush://HOST/PATH
+      the ACI, its manifest and its signature are uploaded with the ACI push
+      protocol, as implemented by quay.io, initiated at https://HOST/PATH
+  docker://[REGISTRY/]REPOSITORY[:TAG]
+      the image and its dependencies are pushed to a Docker Registry v2, one
+      layer per image
+
+The ACI is signed with the signing key of the keystore for the name of the
+image, if any. The credentials of the configuration are used for the host, or
+for the docker registry.`,
+		Run: runWrapper(runImagePush),
+	}
+	flagPushCompression string
+	flagPushOCI         bool
+)
+
+func init() {
+	cmdImage.AddCommand(cmdImagePush)
+	cmdImagePush.Flags().StringVar(&flagPushCompression, "compression", string(aci.CompressionGzip), fmt.Sprintf("compression of the pushed ACI, one of: %s", compressionsHelp()))
+	cmdImagePush.Flags().BoolVar(&flagPushOCI, "oci", false, "push an OCI image manifest, rather than a Docker one, to a docker registry")
+}
+
+func runImagePush(cmd *cobra.Command, args []string) (exit int) {
+	if len(args) != 2 {
+		cmd.Usage()
+		return 1
+	}
+
+	compression, err := aci.ParseCompression(flagPushCompression)
+	if err != nil {
+		stderr("image push: %v", err)
+		return 1
+	}
+
+	s, err := newStore()
+	if err != nil {
+		stderr("image push: cannot open store: %v", err)
+		return 1
+	}
+	defer s.Close()
+
+	config, err := getConfig()
+	if err != nil {
+		stderr("image push: cannot get configuration: %v", err)
+		return 1
+	}
+
+	key, err := getStoreKeyFromAppOrHash(s, args[0])
+	if err != nil {
+		stderr("image push: %v", err)
+		return 1
+	}
+
+	signKey, err := getPushSigningKey(s, key)
+	if err != nil {
+		stderr("image push: %v", err)
+		return 1
+	}
+
+	p := &pusher{
+		s:                  s,
+		headers:            config.AuthPerHost,
+		dockerAuth:         config.DockerCredentialsPerRegistry,
+		dockerHelpers:      config.DockerCredentialHelpers,
+		insecureSkipVerify: globalFlags.InsecureSkipVerify,
+		signKey:            signKey,
+		compression:        compression,
+		oci:                flagPushOCI,
+	}
+	if err := p.push(key, args[1]); err != nil {
+		stderr("image push: %v", err)
+		return 1
+	}
+	stdout("pushed %s to %s", key, args[1])
+	return 0
+}
+
+// getPushSigningKey returns the path of the signing key of the keystore for
+// the name of the image with the given key, or an empty path if the image is
+// pushed unsigned.
+func getPushSigningKey(s *store.Store, key string) (string, error) {
+	im, err := s.GetImageManifest(key)
+	if err != nil {
+		return "", fmt.Errorf("error getting the manifest of image %q: %v", key, err)
+	}
+	ks := keystore.New(keystore.NewConfig(globalFlags.SystemConfigDir, globalFlags.LocalConfigDir))
+	keyPath, err := ks.SigningKeyPath(im.Name.String())
+	if err != nil {
+		return "", fmt.Errorf("error looking up the signing key of %q: %v", im.Name, err)
+	}
+	return keyPath, nil
+}
+
+// pusher uploads the images of the store.
+type pusher struct {
+	s                  *store.Store
+	headers            map[string]config.Headerer
+	dockerAuth         map[string]config.BasicCredentials
+	dockerHelpers      map[string]*config.CredentialHelper
+	insecureSkipVerify bool
+	// signKey is the path of the armored private key signing the ACIs,
+	// if any
+	signKey     string
+	compression aci.Compression
+	// oci makes the images pushed to docker registries OCI images
+	oci bool
+}
+
+// push uploads the image with the given key to the URL, with the protocol
+// of its scheme.
+func (p *pusher) push(key, rawurl string) error {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return fmt.Errorf("invalid URL %q: %v", rawurl, err)
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return p.pushHTTP(key, u)
+	case "acpush":
+		u.Scheme = "https"
+		return p.pushACPush(key, u)
+	case "docker":
+		return p.pushDocker(key, strings.TrimPrefix(rawurl, "docker://"))
+	default:
+		return fmt.Errorf("unsupported URL scheme %q, must be one of http, https, acpush or docker", u.Scheme)
+	}
+}
+
+// writeACI writes the ACI of the image with the given key to a temporary
+// file, compressed. The file must be removed by the caller.
+func (p *pusher) writeACI(key string) (*os.File, error) {
+	rs, err := p.s.ReadStream(key)
+	if err != nil {
+		return nil, fmt.Errorf("error reading image: %v", err)
+	}
+	defer rs.Close()
+
+	f, err := p.s.TmpFile()
+	if err != nil {
+		return nil, fmt.Errorf("error creating temporary file: %v", err)
+	}
+	w, err := aci.NewCompressedWriter(f, p.compression)
+	if err == nil {
+		if _, err = io.Copy(w, rs); err == nil {
+			err = w.Close()
+		}
+	}
+	if err == nil {
+		_, err = f.Seek(0, os.SEEK_SET)
+	}
+	if err != nil {
+		removeTmpFile(f)
+		return nil, fmt.Errorf("error writing ACI: %v", err)
+	}
+	return f, nil
+}
+
+// signature returns the signature of the ACI file made with the signing
+// key, or nil if there is no signing key.
+func (p *pusher) signature(f *os.File) ([]byte, error) {
+	if p.signKey == "" {
+		return nil, nil
+	}
+	signature, err := signACI(f, p.signKey)
+	if err != nil {
+		return nil, fmt.Errorf("error signing ACI: %v", err)
+	}
+	if _, err := f.Seek(0, os.SEEK_SET); err != nil {
+		return nil, err
+	}
+	return signature, nil
+}
+
+func removeTmpFile(f *os.File) {
+	f.Close()
+	os.Remove(f.Name())
+}
+
+func (p *pusher) client() *http.Client {
+	transport := http.DefaultTransport
+	if p.insecureSkipVerify {
+		transport = &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}
+	}
+	return &http.Client{Transport: transport}
+}
+
+// upload sends size bytes read from body to the URL with the given method,
+// with the headers configured for the host. The response is returned if its
+// status code is one of expected.
+func (p *pusher) upload(method, url, contentType string, body io.Reader, size int64, expected ...int) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	addHostHeaders(req, p.headers)
+	req.Header.Add("User-Agent", fmt.Sprintf("rkt/%s", version.Version))
+
+	res, err := p.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, code := range expected {
+		if res.StatusCode == code {
+			return res, nil
+		}
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+	res.Body.Close()
+	return nil, fmt.Errorf("%s %s: bad HTTP status code: %d: %s", method, url, res.StatusCode, bytes.TrimSpace(msg))
+}
+
+// uploadFile puts the contents of f to the URL.
+func (p *pusher) uploadFile(url, contentType string, f *os.File) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	res, err := p.upload("PUT", url, contentType, f, fi.Size(), http.StatusOK, http.StatusCreated, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// uploadBytes puts b to the URL.
+func (p *pusher) uploadBytes(url, contentType string, b []byte) error {
+	res, err := p.upload("PUT", url, contentType, bytes.NewReader(b), int64(len(b)), http.StatusOK, http.StatusCreated, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// pushHTTP puts the ACI to the URL, and its signature next to it.
+func (p *pusher) pushHTTP(key string, u *url.URL) error {
+	f, err := p.writeACI(key)
+	if err != nil {
+		return err
+	}
+	defer removeTmpFile(f)
+	signature, err := p.signature(f)
+	if err != nil {
+		return err
+	}
+
+	if err := p.uploadFile(u.String(), "application/octet-stream", f); err != nil {
+		return fmt.Errorf("error uploading ACI: %v", err)
+	}
+	if signature != nil {
+		if err := p.uploadBytes(ascURLFromImgURL(u.String()), "text/plain", signature); err != nil {
+			return fmt.Errorf("error uploading signature: %v", err)
+		}
+	}
+	return nil
+}
+
+// acPushInitiate is the response of the server initiating an ACI push,
+// with the URLs the parts of the image are uploaded to.
+type acPushInitiate struct {
+	Version      string `json:"aci_push_version"`
+	Multipart    bool   `json:"multipart"`
+	ManifestURL  string `json:"upload_manifest_url"`
+	SignatureURL string `json:"upload_signature_url"`
+	ACIURL       string `json:"upload_aci_url"`
+	CompletedURL string `json:"completed_url"`
+}
+
+// acPushComplete is sent to the server to complete an ACI push.
+type acPushComplete struct {
+	Success      bool   `json:"success"`
+	Reason       string `json:"reason,omitempty"`
+	ServerReason string `json:"server_reason,omitempty"`
+}
+
+// pushACPush uploads the ACI, its manifest and its signature with the ACI
+// push protocol: the push is initiated with a POST to the URL, which
+// returns where to upload them, and completed with a POST once they are
+// uploaded.
+func (p *pusher) pushACPush(key string, u *url.URL) error {
+	manifest, err := p.s.GetImageManifestJSON(key)
+	if err != nil {
+		return err
+	}
+	f, err := p.writeACI(key)
+	if err != nil {
+		return err
+	}
+	defer removeTmpFile(f)
+	signature, err := p.signature(f)
+	if err != nil {
+		return err
+	}
+
+	res, err := p.upload("POST", u.String(), "", nil, 0, http.StatusOK, http.StatusCreated)
+	if err != nil {
+		return fmt.Errorf("error initiating the push: %v", err)
+	}
+	var initiate acPushInitiate
+	err = json.NewDecoder(res.Body).Decode(&initiate)
+	res.Body.Close()
+	if err != nil {
+		return fmt.Errorf("error decoding the response initiating the push: %v", err)
+	}
+	if initiate.CompletedURL == "" || initiate.ACIURL == "" {
+		return fmt.Errorf("the server did not return the upload URLs")
+	}
+
+	pushErr := p.uploadBytes(initiate.ManifestURL, "application/json", manifest)
+	if pushErr == nil && signature != nil {
+		if initiate.SignatureURL == "" {
+			pushErr = fmt.Errorf("the server does not accept signatures")
+		} else {
+			pushErr = p.uploadBytes(initiate.SignatureURL, "text/plain", signature)
+		}
+	}
+	if pushErr == nil {
+		pushErr = p.uploadFile(initiate.ACIURL, "application/octet-stream", f)
+	}
+
+	complete := acPushComplete{Success: pushErr == nil}
+	if pushErr != nil {
+		complete.Reason = pushErr.Error()
+	}
+	b, err := json.Marshal(complete)
+	if err != nil {
+		return err
+	}
+	res, err = p.upload("POST", initiate.CompletedURL, "application/json", bytes.NewReader(b), int64(len(b)), http.StatusOK, http.StatusCreated, http.StatusNoContent)
+	if pushErr != nil {
+		return fmt.Errorf("error uploading image: %v", pushErr)
+	}
+	if err != nil {
+		return fmt.Errorf("error completing the push: %v", err)
+	}
+	defer res.Body.Close()
+
+	var completed acPushComplete
+	if err := json.NewDecoder(res.Body).Decode(&completed); err == nil && !completed.Success {
+		return fmt.Errorf("the server rejected the image: %s", completed.ServerReason)
+	}
+	return nil
+}
@@ -0,0 +1,609 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/coreos/rkt/version"
+
+	dockercommon "github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/docker2aci/lib/common"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/pkg/acirenderer"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+)
+
+const (
+	dockerManifestMediaType = "application/vnd.docker.distribution.manifest.v2+json"
+	dockerConfigMediaType   = "application/vnd.docker.container.image.v1+json"
+	dockerLayerMediaType    = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+	ociManifestMediaType    = "application/vnd.oci.image.manifest.v1+json"
+	ociConfigMediaType      = "application/vnd.oci.image.config.v1+json"
+	ociLayerMediaType       = "application/vnd.oci.image.layer.v1.tar+gzip"
+
+	// the index name of the Docker Hub, and its registry
+	dockerHubIndex    = "index.docker.io"
+	dockerHubRegistry = "registry-1.docker.io"
+
+	// the annotations of the ACIs converted by docker2aci, with the
+	// entrypoint and the command of their docker image
+	dockerEntrypointAnnotation = "appc.io/docker/entrypoint"
+	dockerCmdAnnotation        = "appc.io/docker/cmd"
+)
+
+// dockerDescriptor describes a blob of a docker registry.
+type dockerDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Size      int64  `json:"size"`
+	Digest    string `json:"digest"`
+}
+
+// dockerManifest is a Docker image manifest, version 2 schema 2, or an OCI
+// image manifest.
+type dockerManifest struct {
+	SchemaVersion int                `json:"schemaVersion"`
+	MediaType     string             `json:"mediaType,omitempty"`
+	Config        dockerDescriptor   `json:"config"`
+	Layers        []dockerDescriptor `json:"layers"`
+}
+
+// dockerImageConfig is the configuration of a docker image.
+type dockerImageConfig struct {
+	Architecture string                `json:"architecture"`
+	Variant      string                `json:"variant,omitempty"`
+	OS           string                `json:"os"`
+	Config       dockerContainerConfig `json:"config"`
+	RootFS       dockerRootFS          `json:"rootfs"`
+	History      []dockerHistory       `json:"history"`
+}
+
+type dockerContainerConfig struct {
+	User         string              `json:"User,omitempty"`
+	Env          []string            `json:"Env,omitempty"`
+	Entrypoint   []string            `json:"Entrypoint,omitempty"`
+	Cmd          []string            `json:"Cmd,omitempty"`
+	WorkingDir   string              `json:"WorkingDir,omitempty"`
+	ExposedPorts map[string]struct{} `json:"ExposedPorts,omitempty"`
+	Volumes      map[string]struct{} `json:"Volumes,omitempty"`
+	Labels       map[string]string   `json:"Labels,omitempty"`
+}
+
+type dockerRootFS struct {
+	Type    string   `json:"type"`
+	DiffIDs []string `json:"diff_ids"`
+}
+
+type dockerHistory struct {
+	CreatedBy string `json:"created_by"`
+}
+
+// dockerArchs maps the arch labels of the ACIs to the architecture and
+// variant of the docker images.
+var dockerArchs = map[string][2]string{
+	"amd64":   {"amd64", ""},
+	"i386":    {"386", ""},
+	"aarch64": {"arm64", ""},
+	"armv7l":  {"arm", "v7"},
+	"armv6l":  {"arm", "v6"},
+	"ppc64le": {"ppc64le", ""},
+	"s390x":   {"s390x", ""},
+}
+
+// newDockerImageConfig returns the configuration of the docker image of the
+// ACI with the given manifest, with the layers of the given diff IDs. The
+// entrypoint and command of an ACI converted from a docker image are the
+// ones of the docker image, otherwise the exec command is the entrypoint.
+func newDockerImageConfig(im *schema.ImageManifest, diffIDs []string) (*dockerImageConfig, error) {
+	c := &dockerImageConfig{
+		OS:      "linux",
+		RootFS:  dockerRootFS{Type: "layers", DiffIDs: diffIDs},
+		History: make([]dockerHistory, len(diffIDs)),
+	}
+	for i := range c.History {
+		c.History[i].CreatedBy = fmt.Sprintf("rkt/%s image push", version.Version)
+	}
+
+	labels := make(map[string]string)
+	for _, l := range im.Labels {
+		switch l.Name {
+		case "os":
+			c.OS = l.Value
+		case "arch":
+			a, ok := dockerArchs[l.Value]
+			if !ok {
+				return nil, fmt.Errorf("arch %q has no docker equivalent", l.Value)
+			}
+			c.Architecture, c.Variant = a[0], a[1]
+		default:
+			labels[l.Name.String()] = l.Value
+		}
+	}
+	if c.Architecture == "" {
+		a := dockerArchs[defaultArch]
+		c.Architecture, c.Variant = a[0], a[1]
+	}
+	if len(labels) > 0 {
+		c.Config.Labels = labels
+	}
+
+	app := im.App
+	if app == nil {
+		return c, nil
+	}
+	if app.User != "" || app.Group != "" {
+		c.Config.User = app.User
+		if app.Group != "" {
+			c.Config.User += ":" + app.Group
+		}
+	}
+	for _, e := range app.Environment {
+		c.Config.Env = append(c.Config.Env, e.Name+"="+e.Value)
+	}
+	c.Config.WorkingDir = app.WorkingDirectory
+	c.Config.Entrypoint = app.Exec
+	if ep, ok := im.Annotations.Get(dockerEntrypointAnnotation); ok {
+		if err := json.Unmarshal([]byte(ep), &c.Config.Entrypoint); err != nil {
+			return nil, fmt.Errorf("invalid %s annotation: %v", dockerEntrypointAnnotation, err)
+		}
+		if cmd, ok := im.Annotations.Get(dockerCmdAnnotation); ok {
+			if err := json.Unmarshal([]byte(cmd), &c.Config.Cmd); err != nil {
+				return nil, fmt.Errorf("invalid %s annotation: %v", dockerCmdAnnotation, err)
+			}
+		}
+	}
+	for _, p := range app.Ports {
+		if c.Config.ExposedPorts == nil {
+			c.Config.ExposedPorts = make(map[string]struct{})
+		}
+		c.Config.ExposedPorts[fmt.Sprintf("%d/%s", p.Port, p.Protocol)] = struct{}{}
+	}
+	for _, mp := range app.MountPoints {
+		if c.Config.Volumes == nil {
+			c.Config.Volumes = make(map[string]struct{})
+		}
+		c.Config.Volumes[mp.Path] = struct{}{}
+	}
+	return c, nil
+}
+
+// dockerLayer is a layer of a docker image, written to a temporary file.
+type dockerLayer struct {
+	file *os.File
+	// digest is the digest of the compressed layer, and diffID the one
+	// of the uncompressed layer
+	digest string
+	diffID string
+	size   int64
+}
+
+func sha256Digest(h hash.Hash) string {
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// writeDockerLayer writes the files of an image of the dependency chain to a
+// gzipped docker layer, the files of its rootfs being moved to the root of
+// the layer. The file of the layer must be removed by the caller.
+func (p *pusher) writeDockerLayer(ra *acirenderer.ACIFiles) (*dockerLayer, error) {
+	rs, err := p.s.ReadStream(ra.Key)
+	if err != nil {
+		return nil, fmt.Errorf("error reading image: %v", err)
+	}
+	defer rs.Close()
+
+	f, err := p.s.TmpFile()
+	if err != nil {
+		return nil, fmt.Errorf("error creating temporary file: %v", err)
+	}
+	layer := &dockerLayer{file: f}
+	if err := writeLayerFiles(rs, f, ra.FileMap, layer); err != nil {
+		removeTmpFile(f)
+		return nil, fmt.Errorf("error writing docker layer of image %s: %v", ra.Key, err)
+	}
+	return layer, nil
+}
+
+// writeLayerFiles writes the files of the ACI read from r listed in files to
+// the layer written to f, and sets the digests and size of the layer.
+func writeLayerFiles(r io.Reader, f *os.File, files map[string]struct{}, layer *dockerLayer) error {
+	digest := sha256.New()
+	diffID := sha256.New()
+	gw := gzip.NewWriter(io.MultiWriter(f, digest))
+	tw := tar.NewWriter(io.MultiWriter(gw, diffID))
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name := filepath.Clean(hdr.Name)
+		if _, ok := files[name]; !ok || !strings.HasPrefix(name, "rootfs/") {
+			continue
+		}
+		hdr.Name = strings.TrimPrefix(name, "rootfs/")
+		if hdr.Typeflag == tar.TypeDir {
+			hdr.Name += "/"
+		}
+		if hdr.Typeflag == tar.TypeLink {
+			hdr.Linkname = strings.TrimPrefix(filepath.Clean(hdr.Linkname), "rootfs/")
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gw.Close(); err != nil {
+		return err
+	}
+
+	size, err := f.Seek(0, os.SEEK_CUR)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, os.SEEK_SET); err != nil {
+		return err
+	}
+	layer.digest = sha256Digest(digest)
+	layer.diffID = sha256Digest(diffID)
+	layer.size = size
+	return nil
+}
+
+// pushDocker pushes the image with the given key, and its dependencies, to
+// a docker registry as a docker image with a layer per image, from the
+// lowest dependency to the image.
+func (p *pusher) pushDocker(key, ref string) error {
+	parsed := dockercommon.ParseDockerURL(ref)
+	if parsed == nil {
+		return fmt.Errorf("empty docker image reference")
+	}
+	user, password, err := p.dockerCredentials(parsed.IndexURL)
+	if err != nil {
+		return err
+	}
+	registry := &dockerRegistry{
+		client:   p.client(),
+		base:     dockerRegistryURL(parsed.IndexURL),
+		repo:     dockerRepository(parsed.IndexURL, parsed.ImageName),
+		user:     user,
+		password: password,
+	}
+	if err := registry.authenticate(); err != nil {
+		return err
+	}
+
+	im, err := p.s.GetImageManifest(key)
+	if err != nil {
+		return err
+	}
+	hash, err := types.NewHash(key)
+	if err != nil {
+		return err
+	}
+	renderedACI, err := acirenderer.GetRenderedACIWithImageID(*hash, p.s)
+	if err != nil {
+		return fmt.Errorf("error resolving the dependencies of the image: %v", err)
+	}
+
+	manifestType, configType, layerType := dockerManifestMediaType, dockerConfigMediaType, dockerLayerMediaType
+	if p.oci {
+		manifestType, configType, layerType = ociManifestMediaType, ociConfigMediaType, ociLayerMediaType
+	}
+	manifest := dockerManifest{
+		SchemaVersion: 2,
+		MediaType:     manifestType,
+	}
+	var diffIDs []string
+	for i := len(renderedACI) - 1; i >= 0; i-- {
+		layer, err := p.writeDockerLayer(renderedACI[i])
+		if err != nil {
+			return err
+		}
+		err = registry.pushBlob(layer.digest, layer.file, layer.size)
+		removeTmpFile(layer.file)
+		if err != nil {
+			return fmt.Errorf("error pushing layer of image %s: %v", renderedACI[i].Key, err)
+		}
+		manifest.Layers = append(manifest.Layers, dockerDescriptor{MediaType: layerType, Size: layer.size, Digest: layer.digest})
+		diffIDs = append(diffIDs, layer.diffID)
+	}
+
+	config, err := newDockerImageConfig(im, diffIDs)
+	if err != nil {
+		return err
+	}
+	cb, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	cdigest := sha256.Sum256(cb)
+	manifest.Config = dockerDescriptor{
+		MediaType: configType,
+		Size:      int64(len(cb)),
+		Digest:    "sha256:" + hex.EncodeToString(cdigest[:]),
+	}
+	if err := registry.pushBlob(manifest.Config.Digest, bytes.NewReader(cb), manifest.Config.Size); err != nil {
+		return fmt.Errorf("error pushing image configuration: %v", err)
+	}
+
+	mb, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	if err := registry.pushManifest(parsed.Tag, manifestType, mb); err != nil {
+		return fmt.Errorf("error pushing image manifest: %v", err)
+	}
+	return nil
+}
+
+// dockerCredentials returns the configured credentials of the docker
+// registry with the given index name, empty if there are none.
+func (p *pusher) dockerCredentials(indexName string) (string, string, error) {
+	if creds, ok := p.dockerAuth[indexName]; ok {
+		return creds.User, creds.Password, nil
+	}
+	if helper, ok := p.dockerHelpers[indexName]; ok {
+		creds, err := helper.Get(indexName)
+		if err != nil {
+			return "", "", err
+		}
+		return creds.User, creds.Password, nil
+	}
+	return "", "", nil
+}
+
+// dockerRegistryURL returns the base URL of the registry API of the docker
+// index. As with docker, the registries on localhost are reached with
+// plain HTTP.
+func dockerRegistryURL(indexName string) string {
+	if indexName == dockerHubIndex {
+		return "https://" + dockerHubRegistry
+	}
+	host := indexName
+	if h, _, err := net.SplitHostPort(indexName); err == nil {
+		host = h
+	}
+	if host == "localhost" || host == "127.0.0.1" || host == "::1" {
+		return "http://" + indexName
+	}
+	return "https://" + indexName
+}
+
+// dockerRepository returns the repository of the image in the registry of
+// the docker index, the official images of the Docker Hub being in the
+// library namespace.
+func dockerRepository(indexName, imageName string) string {
+	if indexName == dockerHubIndex && !strings.Contains(imageName, "/") {
+		return "library/" + imageName
+	}
+	return imageName
+}
+
+// dockerRegistry pushes blobs and manifests to a repository of a docker
+// registry, with the version 2 of the registry API.
+type dockerRegistry struct {
+	client   *http.Client
+	base     string
+	repo     string
+	user     string
+	password string
+	// authorization is the Authorization header sent with the requests,
+	// once authenticated
+	authorization string
+}
+
+// authenticate gets the authorization to push to the repository, as
+// challenged by the registry: the credentials themselves with basic
+// authentication, or a token they grant with bearer authentication.
+func (r *dockerRegistry) authenticate() error {
+	res, err := r.do("GET", r.base+"/v2/", "", nil, 0)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized:
+	default:
+		return fmt.Errorf("%s is not a docker registry v2: bad HTTP status code: %d", r.base, res.StatusCode)
+	}
+
+	scheme, params := parseAuthChallenge(res.Header.Get("Www-Authenticate"))
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if r.user == "" {
+			return fmt.Errorf("the registry %s requires credentials", r.base)
+		}
+		req, _ := http.NewRequest("GET", r.base, nil)
+		req.SetBasicAuth(r.user, r.password)
+		r.authorization = req.Header.Get("Authorization")
+		return nil
+	case "bearer":
+		return r.getToken(params)
+	default:
+		return fmt.Errorf("unsupported authentication scheme %q of the registry %s", scheme, r.base)
+	}
+}
+
+// getToken gets a bearer token for the repository from the authorization
+// server of the challenge.
+func (r *dockerRegistry) getToken(params map[string]string) error {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return fmt.Errorf("invalid authentication realm %q", params["realm"])
+	}
+	q := realm.Query()
+	if service, ok := params["service"]; ok {
+		q.Set("service", service)
+	}
+	q.Set("scope", fmt.Sprintf("repository:%s:pull,push", r.repo))
+	realm.RawQuery = q.Encode()
+
+	req, err := http.NewRequest("GET", realm.String(), nil)
+	if err != nil {
+		return err
+	}
+	if r.user != "" {
+		req.SetBasicAuth(r.user, r.password)
+	}
+	res, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("cannot get a token from %s: bad HTTP status code: %d", realm.Host, res.StatusCode)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return fmt.Errorf("cannot decode the token from %s: %v", realm.Host, err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	r.authorization = "Bearer " + token.Token
+	return nil
+}
+
+// parseAuthChallenge parses the value of a WWW-Authenticate header, such as
+// `Bearer realm="https://auth.docker.io/token",service="registry.docker.io"`.
+func parseAuthChallenge(header string) (string, map[string]string) {
+	params := make(map[string]string)
+	parts := strings.SplitN(strings.TrimSpace(header), " ", 2)
+	if len(parts) < 2 {
+		return parts[0], params
+	}
+
+	rest := parts[1]
+	for rest != "" {
+		eq := strings.Index(rest, "=")
+		if eq < 0 {
+			break
+		}
+		name := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = strings.TrimSpace(rest[eq+1:])
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else if comma := strings.Index(rest, ","); comma >= 0 {
+			value, rest = rest[:comma], rest[comma:]
+		} else {
+			value, rest = rest, ""
+		}
+		params[name] = strings.TrimSpace(value)
+		rest = strings.TrimLeft(rest, ", ")
+	}
+	return parts[0], params
+}
+
+func (r *dockerRegistry) do(method, url, contentType string, body io.Reader, size int64) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if r.authorization != "" {
+		req.Header.Set("Authorization", r.authorization)
+	}
+	req.Header.Set("User-Agent", fmt.Sprintf("rkt/%s", version.Version))
+	return r.client.Do(req)
+}
+
+// expectStatus returns an error with the status code of the response if it is
+// not the expected one, and closes its body.
+func expectStatus(res *http.Response, expected int) error {
+	res.Body.Close()
+	if res.StatusCode != expected {
+		return fmt.Errorf("%s %s: bad HTTP status code: %d", res.Request.Method, res.Request.URL, res.StatusCode)
+	}
+	return nil
+}
+
+// pushBlob uploads a blob of the given digest and size, unless the
+// repository already has it.
+func (r *dockerRegistry) pushBlob(digest string, body io.Reader, size int64) error {
+	res, err := r.do("HEAD", fmt.Sprintf("%s/v2/%s/blobs/%s", r.base, r.repo, digest), "", nil, 0)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	res, err = r.do("POST", fmt.Sprintf("%s/v2/%s/blobs/uploads/", r.base, r.repo), "", nil, 0)
+	if err != nil {
+		return err
+	}
+	if err := expectStatus(res, http.StatusAccepted); err != nil {
+		return err
+	}
+	location, err := res.Request.URL.Parse(res.Header.Get("Location"))
+	if err != nil || res.Header.Get("Location") == "" {
+		return fmt.Errorf("invalid upload location %q", res.Header.Get("Location"))
+	}
+	q := location.Query()
+	q.Set("digest", digest)
+	location.RawQuery = q.Encode()
+
+	res, err = r.do("PUT", location.String(), "application/octet-stream", body, size)
+	if err != nil {
+		return err
+	}
+	return expectStatus(res, http.StatusCreated)
+}
+
+// pushManifest uploads the image manifest with the given tag.
+func (r *dockerRegistry) pushManifest(tag, mediaType string, manifest []byte) error {
+	res, err := r.do("PUT", fmt.Sprintf("%s/v2/%s/manifests/%s", r.base, r.repo, tag), mediaType, bytes.NewReader(manifest), int64(len(manifest)))
+	if err != nil {
+		return err
+	}
+	return expectStatus(res, http.StatusCreated)
+}
@@ -0,0 +1,337 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+)
+
+func TestParseAuthChallenge(t *testing.T) {
+	tests := []struct {
+		header string
+		scheme string
+		params map[string]string
+	}{
+		{
+			`Bearer realm="https://auth.docker.io/token",service="registry.docker.io"`,
+			"Bearer",
+			map[string]string{"realm": "https://auth.docker.io/token", "service": "registry.docker.io"},
+		},
+		{
+			`Basic realm="Registry Realm"`,
+			"Basic",
+			map[string]string{"realm": "Registry Realm"},
+		},
+		{
+			`Bearer realm="https://quay.io/v2/auth", service=quay.io, scope="repository:a/b:pull,push"`,
+			"Bearer",
+			map[string]string{"realm": "https://quay.io/v2/auth", "service": "quay.io", "scope": "repository:a/b:pull,push"},
+		},
+		{"Basic", "Basic", map[string]string{}},
+	}
+
+	for i, tt := range tests {
+		scheme, params := parseAuthChallenge(tt.header)
+		if scheme != tt.scheme {
+			t.Errorf("#%d: expected scheme %q, got %q", i, tt.scheme, scheme)
+		}
+		if !reflect.DeepEqual(params, tt.params) {
+			t.Errorf("#%d: expected params %v, got %v", i, tt.params, params)
+		}
+	}
+}
+
+func TestDockerRegistryURL(t *testing.T) {
+	tests := []struct {
+		index string
+		image string
+		url   string
+		repo  string
+	}{
+		{"index.docker.io", "busybox", "https://registry-1.docker.io", "library/busybox"},
+		{"index.docker.io", "coreos/etcd", "https://registry-1.docker.io", "coreos/etcd"},
+		{"quay.io", "coreos/etcd", "https://quay.io", "coreos/etcd"},
+		{"localhost:5000", "etcd", "http://localhost:5000", "etcd"},
+		{"127.0.0.1", "etcd", "http://127.0.0.1", "etcd"},
+	}
+
+	for i, tt := range tests {
+		if url := dockerRegistryURL(tt.index); url != tt.url {
+			t.Errorf("#%d: expected URL %q, got %q", i, tt.url, url)
+		}
+		if repo := dockerRepository(tt.index, tt.image); repo != tt.repo {
+			t.Errorf("#%d: expected repository %q, got %q", i, tt.repo, repo)
+		}
+	}
+}
+
+func TestNewDockerImageConfig(t *testing.T) {
+	im := &schema.ImageManifest{
+		Labels: types.Labels{
+			{Name: "version", Value: "1.0"},
+			{Name: "arch", Value: "armv7l"},
+			{Name: "os", Value: "linux"},
+		},
+		App: &types.App{
+			Exec:             types.Exec{"/bin/etcd", "--data-dir=/data"},
+			User:             "100",
+			Group:            "101",
+			WorkingDirectory: "/data",
+			Environment:      types.Environment{{Name: "PATH", Value: "/bin"}},
+			Ports:            []types.Port{{Name: "client", Protocol: "tcp", Port: 2379}},
+			MountPoints:      []types.MountPoint{{Name: "data", Path: "/data"}},
+		},
+	}
+
+	c, err := newDockerImageConfig(im, []string{"sha256:a", "sha256:b"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := &dockerImageConfig{
+		Architecture: "arm",
+		Variant:      "v7",
+		OS:           "linux",
+		Config: dockerContainerConfig{
+			User:         "100:101",
+			Env:          []string{"PATH=/bin"},
+			Entrypoint:   []string{"/bin/etcd", "--data-dir=/data"},
+			WorkingDir:   "/data",
+			ExposedPorts: map[string]struct{}{"2379/tcp": {}},
+			Volumes:      map[string]struct{}{"/data": {}},
+			Labels:       map[string]string{"version": "1.0"},
+		},
+		RootFS:  dockerRootFS{Type: "layers", DiffIDs: []string{"sha256:a", "sha256:b"}},
+		History: c.History,
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("expected config %+v, got %+v", want, c)
+	}
+	if len(c.History) != 2 {
+		t.Errorf("expected an history entry per layer, got %v", c.History)
+	}
+
+	// the entrypoint and command of a converted docker image are kept
+	im.Annotations.Set(dockerEntrypointAnnotation, `["/entrypoint.sh"]`)
+	im.Annotations.Set(dockerCmdAnnotation, `["etcd"]`)
+	c, err = newDockerImageConfig(im, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(c.Config.Entrypoint, []string{"/entrypoint.sh"}) || !reflect.DeepEqual(c.Config.Cmd, []string{"etcd"}) {
+		t.Errorf("unexpected entrypoint %v and command %v", c.Config.Entrypoint, c.Config.Cmd)
+	}
+
+	im.Labels = types.Labels{{Name: "arch", Value: "sparc"}}
+	if _, err := newDockerImageConfig(im, nil); err == nil {
+		t.Errorf("expected an error for an arch without docker equivalent")
+	}
+}
+
+func TestWriteLayerFiles(t *testing.T) {
+	aci := &bytes.Buffer{}
+	tw := tar.NewWriter(aci)
+	for _, e := range []struct {
+		hdr      tar.Header
+		contents string
+	}{
+		{tar.Header{Name: "manifest", Typeflag: tar.TypeReg}, "{}"},
+		{tar.Header{Name: "rootfs/", Typeflag: tar.TypeDir}, ""},
+		{tar.Header{Name: "rootfs/etc/", Typeflag: tar.TypeDir}, ""},
+		{tar.Header{Name: "rootfs/etc/a", Typeflag: tar.TypeReg}, "a"},
+		{tar.Header{Name: "rootfs/etc/b", Typeflag: tar.TypeLink, Linkname: "rootfs/etc/a"}, ""},
+		{tar.Header{Name: "rootfs/etc/other", Typeflag: tar.TypeReg}, "other"},
+	} {
+		e.hdr.Size = int64(len(e.contents))
+		e.hdr.Mode = 0644
+		if err := tw.WriteHeader(&e.hdr); err != nil {
+			t.Fatalf("error writing ACI: %v", err)
+		}
+		if _, err := io.WriteString(tw, e.contents); err != nil {
+			t.Fatalf("error writing ACI: %v", err)
+		}
+	}
+	tw.Close()
+
+	f, err := ioutil.TempFile("", "rkt-layer")
+	if err != nil {
+		t.Fatalf("error creating tempfile: %v", err)
+	}
+	defer removeTmpFile(f)
+
+	files := map[string]struct{}{
+		"manifest":     {},
+		"rootfs":       {},
+		"rootfs/etc":   {},
+		"rootfs/etc/a": {},
+		"rootfs/etc/b": {},
+	}
+	layer := &dockerLayer{}
+	if err := writeLayerFiles(aci, f, files, layer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	compressed, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatalf("error reading layer: %v", err)
+	}
+	if int64(len(compressed)) != layer.size {
+		t.Errorf("expected size %d, got %d", len(compressed), layer.size)
+	}
+	if d := sha256.Sum256(compressed); layer.digest != "sha256:"+hex.EncodeToString(d[:]) {
+		t.Errorf("unexpected digest %s", layer.digest)
+	}
+	gr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatalf("error decompressing layer: %v", err)
+	}
+	uncompressed, err := ioutil.ReadAll(gr)
+	if err != nil {
+		t.Fatalf("error decompressing layer: %v", err)
+	}
+	if d := sha256.Sum256(uncompressed); layer.diffID != "sha256:"+hex.EncodeToString(d[:]) {
+		t.Errorf("unexpected diff ID %s", layer.diffID)
+	}
+
+	var entries []string
+	tr := tar.NewReader(bytes.NewReader(uncompressed))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("error reading layer: %v", err)
+		}
+		entries = append(entries, hdr.Name+">"+hdr.Linkname)
+	}
+	want := []string{"etc/>", "etc/a>", "etc/b>etc/a"}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("expected layer entries %v, got %v", want, entries)
+	}
+}
+
+func TestDockerRegistryPush(t *testing.T) {
+	var (
+		blobs     = make(map[string][]byte)
+		manifests = make(map[string][]byte)
+		tokenAuth = "Bearer secret-token"
+	)
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || user != "user" || password != "pass" || r.URL.Query().Get("scope") != "repository:foo/bar:pull,push" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"token": "secret-token"}`)
+	})
+	mux.HandleFunc("/v2/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != tokenAuth {
+			w.Header().Set("Www-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, ts.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		path := strings.TrimPrefix(r.URL.Path, "/v2/foo/bar/")
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/v2/":
+		case r.Method == "HEAD" && strings.HasPrefix(path, "blobs/"):
+			if _, ok := blobs[strings.TrimPrefix(path, "blobs/")]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case r.Method == "POST" && path == "blobs/uploads/":
+			w.Header().Set("Location", "/v2/foo/bar/blobs/uploads/1?state=x")
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == "PUT" && path == "blobs/uploads/1":
+			if r.URL.Query().Get("state") != "x" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			b, _ := ioutil.ReadAll(r.Body)
+			blobs[r.URL.Query().Get("digest")] = b
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == "PUT" && strings.HasPrefix(path, "manifests/"):
+			if r.Header.Get("Content-Type") != dockerManifestMediaType {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			b, _ := ioutil.ReadAll(r.Body)
+			manifests[strings.TrimPrefix(path, "manifests/")] = b
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	registry := &dockerRegistry{
+		client:   http.DefaultClient,
+		base:     ts.URL,
+		repo:     "foo/bar",
+		user:     "user",
+		password: "pass",
+	}
+	if err := registry.authenticate(); err != nil {
+		t.Fatalf("unexpected error authenticating: %v", err)
+	}
+	if registry.authorization != tokenAuth {
+		t.Fatalf("expected authorization %q, got %q", tokenAuth, registry.authorization)
+	}
+
+	if err := registry.pushBlob("sha256:1", strings.NewReader("blob"), 4); err != nil {
+		t.Fatalf("unexpected error pushing blob: %v", err)
+	}
+	if string(blobs["sha256:1"]) != "blob" {
+		t.Errorf("expected blob to be pushed, got %v", blobs)
+	}
+	// a blob the repository has is not uploaded again
+	if err := registry.pushBlob("sha256:1", strings.NewReader("again"), 5); err != nil {
+		t.Fatalf("unexpected error pushing blob: %v", err)
+	}
+	if string(blobs["sha256:1"]) != "blob" {
+		t.Errorf("expected blob not to be uploaded again, got %v", blobs)
+	}
+
+	manifest, _ := json.Marshal(dockerManifest{SchemaVersion: 2, MediaType: dockerManifestMediaType})
+	if err := registry.pushManifest("v1", dockerManifestMediaType, manifest); err != nil {
+		t.Fatalf("unexpected error pushing manifest: %v", err)
+	}
+	if !bytes.Equal(manifests["v1"], manifest) {
+		t.Errorf("expected manifest %s, got %s", manifest, manifests["v1"])
+	}
+
+	registry.password = "wrong"
+	registry.authorization = ""
+	if err := registry.authenticate(); err == nil {
+		t.Errorf("expected an error authenticating with wrong credentials")
+	}
+}
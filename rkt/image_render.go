@@ -21,8 +21,6 @@ import (
 	"path/filepath"
 
 	"github.com/coreos/rkt/pkg/fileutil"
-	"github.com/coreos/rkt/pkg/uid"
-	"github.com/coreos/rkt/store"
 
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/cobra"
 )
@@ -36,12 +34,18 @@ var (
 	}
 	flagRenderRootfsOnly bool
 	flagRenderOverwrite  bool
+	flagRenderInPlace    bool
+	flagRenderUidShift   uint32
+	flagRenderGidShift   uint32
 )
 
 func init() {
 	cmdImage.AddCommand(cmdImageRender)
 	cmdImageRender.Flags().BoolVar(&flagRenderRootfsOnly, "rootfs-only", false, "render rootfs only")
 	cmdImageRender.Flags().BoolVar(&flagRenderOverwrite, "overwrite", false, "overwrite output directory")
+	cmdImageRender.Flags().BoolVar(&flagRenderInPlace, "in-place", false, "render into the existing output directory, replacing its files also in the image and keeping the others")
+	cmdImageRender.Flags().Uint32Var(&flagRenderUidShift, "uid-shift", 0, "value added to the user owners of the files, e.g. for user-namespaced pods")
+	cmdImageRender.Flags().Uint32Var(&flagRenderGidShift, "gid-shift", 0, "value added to the group owners of the files, e.g. for user-namespaced pods")
 }
 
 func runImageRender(cmd *cobra.Command, args []string) (exit int) {
@@ -51,7 +55,12 @@ func runImageRender(cmd *cobra.Command, args []string) (exit int) {
 	}
 	outputDir := args[1]
 
-	s, err := store.NewStore(globalFlags.Dir)
+	if flagRenderOverwrite && flagRenderInPlace {
+		stderr("image render: --overwrite and --in-place cannot be used together")
+		return 1
+	}
+
+	s, err := newStore()
 	if err != nil {
 		stderr("image render: cannot open store: %v", err)
 		return 1
@@ -63,21 +72,13 @@ func runImageRender(cmd *cobra.Command, args []string) (exit int) {
 		return 1
 	}
 
-	id, err := s.RenderTreeStore(key, false)
+	id, err := renderTreeStore(s, key)
 	if err != nil {
-		stderr("image render: error rendering ACI: %v", err)
+		stderr("image render: %v", err)
 		return 1
 	}
-	if err := s.CheckTreeStore(id); err != nil {
-		stderr("image render: warning: tree cache is in a bad state. Rebuilding...")
-		var err error
-		if id, err = s.RenderTreeStore(key, true); err != nil {
-			stderr("image render: error rendering ACI: %v", err)
-			return 1
-		}
-	}
 
-	if _, err := os.Stat(outputDir); err == nil {
+	if _, err := os.Stat(outputDir); err == nil && !flagRenderInPlace {
 		if !flagRenderOverwrite {
 			stderr("image render: output directory exists (try --overwrite)")
 			return 1
@@ -121,7 +122,12 @@ func runImageRender(cmd *cobra.Command, args []string) (exit int) {
 	}
 
 	cachedTreePath := s.GetTreeStoreRootFS(id)
-	if err := fileutil.CopyTree(cachedTreePath, rootfsOutDir, uid.NewBlankUidRange()); err != nil {
+	opts := fileutil.CopyTreeOptions{
+		Overwrite: flagRenderInPlace,
+		UidShift:  flagRenderUidShift,
+		GidShift:  flagRenderGidShift,
+	}
+	if err := fileutil.CopyTreeWithOptions(cachedTreePath, rootfsOutDir, opts); err != nil {
 		stderr("image render: error copying ACI rootfs: %v", err)
 		return 1
 	}
@@ -16,6 +16,7 @@ package main
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/cobra"
@@ -26,15 +27,21 @@ var (
 	cmdImageRm = &cobra.Command{
 		Use:   "rm IMAGEID...",
 		Short: "Remove image(s) with the given ID(s) from the local store",
-		Run:   runWrapper(runRmImage),
+		Long: `The images used by existing pods are not removed, unless --force is given.
+Removing them anyway may break the pods, for example when they are restarted.`,
+		Run: runWrapper(runRmImage),
 	}
+	flagForceImageRm bool
 )
 
 func init() {
 	cmdImage.AddCommand(cmdImageRm)
+	cmdImageRm.Flags().BoolVar(&flagForceImageRm, "force", false, "remove the images even if they are used by existing pods")
 }
 
-func rmImages(s *store.Store, images []string) error {
+// rmImages removes the images with the given IDs from the store. The images
+// used by existing pods are only removed if force is true.
+func rmImages(s *store.Store, images []string, force bool) error {
 	done := 0
 	errors := 0
 	staleErrors := 0
@@ -55,6 +62,19 @@ func rmImages(s *store.Store, images []string) error {
 			continue
 		}
 
+		pods, err := s.GetImagePods(key)
+		if err != nil {
+			stderr("rkt: cannot get the pods using image ID %q: %v", pkey, err)
+			continue
+		}
+		if len(pods) > 0 {
+			if !force {
+				stderr("rkt: image ID %q is used by pod(s) %s, not removing it (use --force to remove it anyway)", pkey, strings.Join(pods, ", "))
+				continue
+			}
+			stderr("rkt: warning: removing image ID %q used by pod(s) %s", pkey, strings.Join(pods, ", "))
+		}
+
 		if err = s.RemoveACI(key); err != nil {
 			if serr, ok := err.(*store.StoreRemovalError); ok {
 				staleErrors++
@@ -93,13 +113,13 @@ func runRmImage(cmd *cobra.Command, args []string) (exit int) {
 		return 1
 	}
 
-	s, err := store.NewStore(globalFlags.Dir)
+	s, err := newStore()
 	if err != nil {
 		stderr("rkt: cannot open store: %v", err)
 		return 1
 	}
 
-	if err := rmImages(s, args); err != nil {
+	if err := rmImages(s, args, flagForceImageRm); err != nil {
 		stderr("rKt: %v", err)
 		return 1
 	}
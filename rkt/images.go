@@ -35,6 +35,7 @@ import (
 	"time"
 
 	"github.com/coreos/rkt/common/apps"
+	"github.com/coreos/rkt/pkg/aci"
 	"github.com/coreos/rkt/pkg/keystore"
 	"github.com/coreos/rkt/rkt/config"
 	"github.com/coreos/rkt/rkt/pubkey"
@@ -44,7 +45,6 @@ import (
 
 	docker2aci "github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/docker2aci/lib"
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/docker2aci/lib/common"
-	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/aci"
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/discovery"
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/coreos/ioprogress"
@@ -57,6 +57,8 @@ type imageActionData struct {
 	ks                 *keystore.Keystore
 	headers            map[string]config.Headerer
 	dockerAuth         map[string]config.BasicCredentials
+	dockerHelpers      map[string]*config.CredentialHelper
+	archFallbacks      map[string][]string
 	insecureSkipVerify bool
 	debug              bool
 }
@@ -65,6 +67,7 @@ type finder struct {
 	imageActionData
 	storeOnly bool
 	noStore   bool
+	noCache   bool
 	withDeps  bool
 }
 
@@ -103,6 +106,7 @@ func (f *finder) findImage(img string, asc string) (*types.Hash, error) {
 		imageActionData: f.imageActionData,
 		storeOnly:       f.storeOnly,
 		noStore:         f.noStore,
+		noCache:         f.noCache,
 		withDeps:        f.withDeps,
 	}
 	key, err := ft.fetchImage(img, asc)
@@ -124,7 +128,11 @@ type fetcher struct {
 	imageActionData
 	storeOnly bool
 	noStore   bool
+	noCache   bool
 	withDeps  bool
+	// progress, if not nil, is the progress bar shared with other
+	// fetchers the downloads report to instead of drawing their own
+	progress *prefetchProgress
 }
 
 // fetchImage will take an image as either a URL or a name string and import it
@@ -228,10 +236,13 @@ func (f *fetcher) fetchSingleImage(img string, asc string) (string, error) {
 
 	switch u.Scheme {
 	case "":
-		// check if os and arch are valid early
+		// check if os and arch are valid early, the images for
+		// another arch can still run with --qemu-user
 		if app := newDiscoveryApp(img); app != nil {
 			if err := types.IsValidOSArch(app.Labels, stage0.ValidOSArch); err != nil {
-				return "", err
+				if types.IsValidOSArch(app.Labels, stage0.EmulatedOSArch) != nil {
+					return "", err
+				}
 			}
 		}
 		return f.fetchImageByName(img, ascFile)
@@ -266,20 +277,53 @@ func (f *fetcher) fetchImageByName(img string, ascFile *os.File) (string, error)
 		if app == nil {
 			return "", fmt.Errorf("invalid image name for discovery: %s", img)
 		}
-		stderr("rkt: searching for app image %s", img)
-		ep, err := discoverApp(app, true)
-		if err != nil {
-			return "", fmt.Errorf("discovery failed for %q: %v", img, err)
-		}
 		latest := false
 		// No specified version label, mark it as latest
 		if _, ok := app.Labels["version"]; !ok {
 			latest = true
 		}
-		return f.fetchImageFromEndpoints(app.Name.String(), ep, ascFile, latest)
+		archs := []string{app.Labels["arch"]}
+		if !hasArchLabel(img) {
+			archs = append(archs, getArchFallbacks(app.Labels["arch"], f.archFallbacks)...)
+		}
+		var err error
+		for i, arch := range archs {
+			if i > 0 {
+				stderr("rkt: trying the %s image instead", arch)
+			}
+			app.Labels["arch"] = arch
+			var key string
+			key, err = f.discoverAndFetchImage(img, app, ascFile, latest)
+			if err != nil {
+				if len(archs) > 1 {
+					stderr("rkt: %v", err)
+				}
+				continue
+			}
+			if i > 0 {
+				if err := f.s.SetACIInfoArch(key, arch); err != nil {
+					return "", fmt.Errorf("error recording the arch of the image: %v", err)
+				}
+			}
+			return key, nil
+		}
+		if len(archs) == 1 {
+			return "", err
+		}
+		return "", fmt.Errorf("no image found for arch %s nor its fallbacks %s", archs[0], strings.Join(archs[1:], ", "))
 	}
 
-	return "", fmt.Errorf("unable to fetch image for image name: %s", img)
+	return "", fmt.Errorf("unable to fetch image for image name %s: not in the local store and the pull policy forbids fetching it from remote", img)
+}
+
+// discoverAndFetchImage discovers the given app and fetches its image.
+func (f *fetcher) discoverAndFetchImage(img string, app *discovery.App, ascFile *os.File, latest bool) (string, error) {
+	stderr("rkt: searching for app image %s", img)
+	ep, err := discoverApp(app, true)
+	if err != nil {
+		return "", fmt.Errorf("discovery failed for %q: %v", img, err)
+	}
+	return f.fetchImageFromEndpoints(app.Name.String(), ep, ascFile, latest)
 }
 
 // fetchImageByURL will try fetch an image using an URL.
@@ -315,7 +359,7 @@ func (f *fetcher) fetchImageByURL(u *url.URL, ascFile *os.File) (string, error)
 		return f.fetchImageFromURL(u.String(), u.Scheme, ascFile, latest)
 	}
 
-	return "", fmt.Errorf("unable to fetch image for url %s", u.String())
+	return "", fmt.Errorf("unable to fetch image for url %s: not in the local store and the pull policy forbids fetching it from remote", u.String())
 }
 
 func (f *fetcher) fetchImageFromEndpoints(appName string, ep *discovery.Endpoints, ascFile *os.File, latest bool) (string, error) {
@@ -345,7 +389,7 @@ func (f *fetcher) fetchImageFrom(appName string, aciURL, ascURL, scheme string,
 		if err != nil {
 			return "", err
 		}
-		if ok && useCached(rem.DownloadTime, rem.CacheMaxAge) {
+		if ok && !f.noCache && useCached(rem.DownloadTime, rem.CacheMaxAge) {
 			stderr("rkt: using cached image from local store")
 			return rem.BlobKey, nil
 		}
@@ -356,7 +400,7 @@ func (f *fetcher) fetchImageFrom(appName string, aciURL, ascURL, scheme string,
 	}
 
 	var etag string
-	if rem != nil {
+	if rem != nil && !f.noCache {
 		etag = rem.ETag
 	}
 	entity, aciFile, cd, err := f.fetch(appName, aciURL, ascURL, ascFile, etag)
@@ -438,6 +482,13 @@ func (f *fetcher) fetch(appName string, aciURL, ascURL string, ascFile *os.File,
 		if creds, ok := f.dockerAuth[indexName]; ok {
 			user = creds.User
 			password = creds.Password
+		} else if helper, ok := f.dockerHelpers[indexName]; ok {
+			creds, err := helper.Get(indexName)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			user = creds.User
+			password = creds.Password
 		}
 		acis, err := docker2aci.Convert(registryURL, true, tmpDir, tmpDir, user, password)
 		if err != nil {
@@ -766,12 +817,15 @@ func (f *fetcher) downloadHTTP(url, label string, out writeSyncer, etag string)
 		)
 	}
 
-	reader := &ioprogress.Reader{
+	var reader io.Reader = &ioprogress.Reader{
 		Reader:       res.Body,
 		Size:         res.ContentLength,
 		DrawFunc:     ioprogress.DrawTerminalf(os.Stderr, fmtfunc),
 		DrawInterval: time.Second,
 	}
+	if f.progress != nil {
+		reader = f.progress.reader(res.Body)
+	}
 
 	if _, err := io.Copy(out, reader); err != nil {
 		return nil, fmt.Errorf("error copying %s: %v", label, err)
@@ -787,10 +841,19 @@ func (f *fetcher) downloadHTTP(url, label string, out writeSyncer, etag string)
 }
 
 func (f *fetcher) setHTTPHeaders(req *http.Request, etag string) {
+	addHostHeaders(req, f.headers)
+	if etag != "" {
+		req.Header.Add("If-None-Match", etag)
+	}
+	req.Header.Add("User-Agent", fmt.Sprintf("rkt/%s", version.Version))
+}
+
+// addHostHeaders adds to req the headers configured for its host, such as
+// credentials, which are only sent over a secure channel.
+func addHostHeaders(req *http.Request, headers map[string]config.Headerer) {
 	options := make(http.Header)
-	// Send credentials only over secure channel
 	if req.URL.Scheme == "https" {
-		if hostOpts, ok := f.headers[req.URL.Host]; ok {
+		if hostOpts, ok := headers[req.URL.Host]; ok {
 			options = hostOpts.Header()
 		}
 	}
@@ -799,10 +862,6 @@ func (f *fetcher) setHTTPHeaders(req *http.Request, etag string) {
 			req.Header.Add(k, e)
 		}
 	}
-	if etag != "" {
-		req.Header.Add("If-None-Match", etag)
-	}
-	req.Header.Add("User-Agent", fmt.Sprintf("rkt/%s", version.Version))
 }
 
 func ascURLFromImgURL(imgurl string) string {
@@ -823,7 +882,7 @@ func newDiscoveryApp(img string) *discovery.App {
 		return nil
 	}
 	if _, ok := app.Labels["arch"]; !ok {
-		app.Labels["arch"] = defaultArch
+		app.Labels["arch"] = imageArch()
 	}
 	if _, ok := app.Labels["os"]; !ok {
 		app.Labels["os"] = defaultOS
@@ -852,6 +911,11 @@ func getStoreKeyFromApp(s *store.Store, img string) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("cannot parse the image name %q: %v", img, err)
 	}
+	// the images are found regardless of their arch, unless one is
+	// requested
+	if _, ok := app.Labels["arch"]; !ok && flagArch != "" {
+		app.Labels["arch"] = flagArch
+	}
 	labels, err := types.LabelsFromMap(app.Labels)
 	if err != nil {
 		return "", fmt.Errorf("invalid labels in the image %q: %v", img, err)
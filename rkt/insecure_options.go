@@ -0,0 +1,78 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// insecureScan skips the scan of the images by the configured scan
+	// command before running them
+	insecureScan = "scan"
+
+	// insecureAll enables all the insecure options
+	insecureAll = "all"
+)
+
+// insecureOptionNames lists the valid insecure options
+var insecureOptionNames = []string{insecureScan}
+
+// insecureOptions implements the flag.Value interface to contain the
+// comma-separated list of security checks to skip.
+type insecureOptions map[string]bool
+
+func (o *insecureOptions) Set(value string) error {
+	opts := make(insecureOptions)
+	for _, name := range strings.Split(value, ",") {
+		switch {
+		case name == "":
+		case name == insecureAll:
+			for _, n := range insecureOptionNames {
+				opts[n] = true
+			}
+		case isInsecureOptionName(name):
+			opts[name] = true
+		default:
+			return fmt.Errorf("unknown insecure option %q, must be one of %q or %q", name, strings.Join(insecureOptionNames, ", "), insecureAll)
+		}
+	}
+	*o = opts
+	return nil
+}
+
+func (o *insecureOptions) String() string {
+	var names []string
+	for name := range *o {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func (o *insecureOptions) Type() string {
+	return "insecureOptions"
+}
+
+func isInsecureOptionName(name string) bool {
+	for _, n := range insecureOptionNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestInsecureOptions(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+		valid    bool
+	}{
+		{"", "", true},
+		{"scan", "scan", true},
+		{"scan,scan", "scan", true},
+		{"all", "scan", true},
+		{"foo", "", false},
+		{"scan,foo", "", false},
+	}
+
+	for i, tt := range tests {
+		var opts insecureOptions
+		err := opts.Set(tt.value)
+		if !tt.valid {
+			if err == nil {
+				t.Errorf("#%d: expected %q to be invalid", i, tt.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: expected %q to be valid, got error: %v", i, tt.value, err)
+			continue
+		}
+		if s := opts.String(); s != tt.expected {
+			t.Errorf("#%d: expected %q, got %q", i, tt.expected, s)
+		}
+	}
+}
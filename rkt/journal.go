@@ -0,0 +1,106 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/pflag"
+	"github.com/coreos/rkt/common"
+)
+
+var (
+	flagJournalMaxUse            string
+	flagJournalRateLimitBurst    string
+	flagJournalRateLimitInterval string
+)
+
+// addJournalFlags adds the flags limiting the journal of the pods, so a
+// log-spamming app cannot fill the disk of the host. They are passed to
+// stage1 as pod annotations.
+func addJournalFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&flagJournalMaxUse, "journal-max-use", "", "disk space the journal of the pod may use, in bytes with an optional k, m or g suffix")
+	flags.StringVar(&flagJournalRateLimitBurst, "journal-rate-limit-burst", "", "number of messages an app may log in each rate limit interval, 0 disables the rate limiting")
+	flags.StringVar(&flagJournalRateLimitInterval, "journal-rate-limit-interval", "", "rate limit interval of the journal of the pod, e.g. 30s, 0 disables the rate limiting")
+}
+
+// journalFlagsSet returns whether any of the journal flags is set.
+func journalFlagsSet() bool {
+	return flagJournalMaxUse != "" || flagJournalRateLimitBurst != "" || flagJournalRateLimitInterval != ""
+}
+
+// validateJournalFlags returns an error if the value of a journal flag is
+// invalid.
+func validateJournalFlags() error {
+	if flagJournalMaxUse != "" {
+		if err := common.ValidateMemorySize(flagJournalMaxUse); err != nil {
+			return err
+		}
+	}
+	if flagJournalRateLimitBurst != "" {
+		if n, err := strconv.Atoi(flagJournalRateLimitBurst); err != nil || n < 0 {
+			return fmt.Errorf("invalid journal rate limit burst %q", flagJournalRateLimitBurst)
+		}
+	}
+	if flagJournalRateLimitInterval != "" {
+		if d, err := time.ParseDuration(flagJournalRateLimitInterval); err != nil || d < 0 {
+			return fmt.Errorf("invalid journal rate limit interval %q", flagJournalRateLimitInterval)
+		}
+	}
+	return nil
+}
+
+// journalAnnotations returns the pod annotations corresponding to the
+// journal flags.
+func journalAnnotations() types.Annotations {
+	var annotations types.Annotations
+	if flagJournalMaxUse != "" {
+		annotations.Set(types.ACIdentifier(common.JournalMaxUseAnnotation), flagJournalMaxUse)
+	}
+	if flagJournalRateLimitBurst != "" {
+		annotations.Set(types.ACIdentifier(common.JournalRateLimitBurstAnnotation), flagJournalRateLimitBurst)
+	}
+	if flagJournalRateLimitInterval != "" {
+		annotations.Set(types.ACIdentifier(common.JournalRateLimitIntervalAnnotation), flagJournalRateLimitInterval)
+	}
+	return annotations
+}
+
+// printJournalLimits prints the journal limits applied to the pod, as found
+// in its pod manifest.
+func printJournalLimits(p *pod) error {
+	pm, err := p.getManifest()
+	if err != nil {
+		return err
+	}
+	for _, l := range []struct {
+		key        string
+		annotation string
+	}{
+		{"journal-max-use", common.JournalMaxUseAnnotation},
+		{"journal-rate-limit-burst", common.JournalRateLimitBurstAnnotation},
+		{"journal-rate-limit-interval", common.JournalRateLimitIntervalAnnotation},
+	} {
+		if v, ok := pm.Annotations.Get(l.annotation); ok {
+			stdout("%s=%s", l.key, v)
+		}
+	}
+	return nil
+}
@@ -20,12 +20,15 @@ import (
 	"bytes"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/lastditch"
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/dustin/go-humanize"
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/cobra"
 	common "github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/common/cgroup"
 	"github.com/coreos/rkt/networking/netinfo"
 )
 
@@ -37,12 +40,14 @@ var (
 	}
 	flagNoLegend   bool
 	flagFullOutput bool
+	flagListFilter podKVFilterList
 )
 
 func init() {
 	cmdRkt.AddCommand(cmdList)
 	cmdList.Flags().BoolVar(&flagNoLegend, "no-legend", false, "suppress a legend with the list")
 	cmdList.Flags().BoolVar(&flagFullOutput, "full", false, "use long output format")
+	cmdList.Flags().Var(&flagListFilter, "filter", "only list the pods with the given user label or annotation, in the form label=NAME=VALUE or annotation=NAME=VALUE. Can be repeated, the pods must match all the filters")
 }
 
 func runList(cmd *cobra.Command, args []string) int {
@@ -52,7 +57,7 @@ func runList(cmd *cobra.Command, args []string) int {
 
 	if !flagNoLegend {
 		if flagFullOutput {
-			fmt.Fprintf(tabOut, "UUID\tAPP\tIMAGE NAME\tIMAGE ID\tSTATE\tNETWORKS\n")
+			fmt.Fprintf(tabOut, "UUID\tAPP\tIMAGE NAME\tIMAGE ID\tSTATE\tCREATED\tSTARTED\tEXITED\tMEMORY\tCPU\tNETWORKS\n")
 		} else {
 			fmt.Fprintf(tabOut, "UUID\tAPP\tIMAGE NAME\tSTATE\tNETWORKS\n")
 		}
@@ -80,6 +85,12 @@ func runList(cmd *cobra.Command, args []string) int {
 			}
 		}
 
+		// the pods without a manifest yet have no user labels or
+		// annotations, so they never match a filter
+		if len(flagListFilter) > 0 && !flagListFilter.matches(pm.Annotations) {
+			return
+		}
+
 		type printedApp struct {
 			uuid    string
 			appName string
@@ -87,15 +98,29 @@ func runList(cmd *cobra.Command, args []string) int {
 			imgID   string
 			state   string
 			nets    string
+			usage   podUsage
 		}
 
 		var appsToPrint []printedApp
 		uuid := p.uuid.String()
 		state := p.getState()
-		nets := fmtNets(p.nets)
-		if !flagFullOutput {
+		var usage podUsage
+		if flagFullOutput {
+			var err error
+			if usage, err = getPodUsage(p); err != nil {
+				errors = append(errors, newPodListUsageError(p, err))
+			}
+			// the networks of the exited pods are kept until they
+			// are garbage collected
+			if p.isExited && len(p.nets) == 0 {
+				if err := p.loadNets(); err != nil {
+					errors = append(errors, newPodListUsageError(p, err))
+				}
+			}
+		} else {
 			uuid = uuid[:8]
 		}
+		nets := fmtNets(p.nets)
 		for _, app := range pm.Apps {
 			imageName, err := getImageName(p, app.Name)
 			if err != nil {
@@ -115,6 +140,7 @@ func runList(cmd *cobra.Command, args []string) int {
 				imgID:   imageID,
 				state:   state,
 				nets:    nets,
+				usage:   usage,
 			})
 			// clear those variables so they won't be
 			// printed for another apps in the pod as they
@@ -122,13 +148,15 @@ func runList(cmd *cobra.Command, args []string) int {
 			uuid = ""
 			state = ""
 			nets = ""
+			usage = podUsage{}
 		}
 		// if we reached that point, then it means that the
 		// pod and all its apps are valid, so they can be
 		// printed
 		for _, app := range appsToPrint {
 			if flagFullOutput {
-				fmt.Fprintf(tabOut, "%s\t%s\t%s\t%s\t%s\t%s\n", app.uuid, app.appName, app.imgName, app.imgID, app.state, app.nets)
+				u := app.usage
+				fmt.Fprintf(tabOut, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", app.uuid, app.appName, app.imgName, app.imgID, app.state, u.created, u.started, u.exited, u.memory, u.cpu, app.nets)
 			} else {
 				fmt.Fprintf(tabOut, "%s\t%s\t%s\t%s\t%s\n", app.uuid, app.appName, app.imgName, app.state, app.nets)
 			}
@@ -193,6 +221,10 @@ func newPodListZeroAppsError(p *pod) error {
 	return fmt.Errorf("Pod %s contains zero apps", p.uuid.String())
 }
 
+func newPodListUsageError(p *pod, err error) error {
+	return fmt.Errorf("Unable to get the resource usage or the networks of pod %s: %v", p.uuid.String(), err)
+}
+
 func newPodListLoadImageManifestError(p *pod, err error) error {
 	return fmt.Errorf("pod %s ImageManifest could not be loaded: %v", p.uuid.String(), err)
 }
@@ -211,6 +243,62 @@ func fmtNets(nis []netinfo.NetInfo) string {
 	return strings.Join(parts, ", ")
 }
 
+// podUsage holds the timestamps and the resource usage of a pod, formatted
+// for the full output of rkt list. The fields are empty when they are not
+// known or do not apply to the state of the pod.
+type podUsage struct {
+	created string
+	started string
+	exited  string
+	memory  string
+	cpu     string
+}
+
+func getPodUsage(p *pod) (podUsage, error) {
+	var u podUsage
+
+	created, err := p.getCreationTime()
+	if err != nil {
+		return u, err
+	}
+	u.created = fmtTime(created)
+
+	started, err := p.getStartTime()
+	if err != nil {
+		return u, err
+	}
+	u.started = fmtTime(started)
+
+	exited, err := p.getExitTime()
+	if err != nil {
+		return u, err
+	}
+	u.exited = fmtTime(exited)
+
+	if !p.isRunning() {
+		return u, nil
+	}
+	pid, err := p.getContainerPID1()
+	if err != nil {
+		return u, err
+	}
+	usage, err := cgroup.GetUsage(pid)
+	if err != nil {
+		return u, err
+	}
+	u.memory = humanize.IBytes(usage.Memory)
+	u.cpu = (usage.CPU - usage.CPU%time.Millisecond).String()
+
+	return u, nil
+}
+
+func fmtTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(defaultTimeLayout)
+}
+
 func getImageName(p *pod, appName types.ACName) (string, error) {
 	aim, err := p.getAppsImageManifests()
 	if err != nil {
@@ -0,0 +1,129 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/pflag"
+	"github.com/coreos/rkt/common"
+)
+
+var (
+	flagTimezone string
+	flagLocale   string
+
+	// hostLocaleFiles are the files read, in order, to find the locale
+	// of the host before falling back to its LANG environment variable
+	hostLocaleFiles = []string{"/etc/locale.conf", "/etc/default/locale"}
+)
+
+// addLocalizationFlags adds the flags setting the timezone and the locale
+// of the apps. They are passed to stage1 as pod annotations.
+func addLocalizationFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&flagTimezone, "timezone", "", "timezone of the apps, \"host\" or a name like Europe/Berlin, setting /etc/localtime and /etc/timezone")
+	flags.StringVar(&flagLocale, "locale", "", "locale of the apps, \"host\" or a name like en_US.UTF-8, setting /etc/locale.conf and LANG")
+}
+
+// localizationFlagsSet returns whether any of the localization flags is set.
+func localizationFlagsSet() bool {
+	return flagTimezone != "" || flagLocale != ""
+}
+
+// validateLocalizationFlags returns an error if the value of a localization
+// flag is invalid. A "host" locale is replaced by the locale of the host.
+func validateLocalizationFlags() error {
+	if flagTimezone != "" {
+		if err := common.ValidateTimezone(flagTimezone); err != nil {
+			return err
+		}
+	}
+	if flagLocale == common.LocalizationHost {
+		locale, err := hostLocale()
+		if err != nil {
+			return err
+		}
+		flagLocale = locale
+	}
+	if flagLocale != "" {
+		if err := common.ValidateLocale(flagLocale); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// localizationAnnotations returns the pod annotations corresponding to the
+// localization flags.
+func localizationAnnotations() types.Annotations {
+	var annotations types.Annotations
+	if flagTimezone != "" {
+		annotations.Set(types.ACIdentifier(common.TimezoneAnnotation), flagTimezone)
+	}
+	if flagLocale != "" {
+		annotations.Set(types.ACIdentifier(common.LocaleAnnotation), flagLocale)
+	}
+	return annotations
+}
+
+// hostLocale returns the LANG of the host, as set in its locale
+// configuration or in the environment of rkt.
+func hostLocale() (string, error) {
+	for _, path := range hostLocaleFiles {
+		locale, err := readLocaleFile(path)
+		if err != nil {
+			return "", err
+		}
+		if locale != "" {
+			return locale, nil
+		}
+	}
+	if locale := os.Getenv("LANG"); locale != "" {
+		return locale, nil
+	}
+	return "", fmt.Errorf("cannot find the locale of the host, set it with --locale")
+}
+
+// readLocaleFile returns the value of LANG in the given shell-like
+// configuration file, or an empty string if the file does not exist or
+// does not set it.
+func readLocaleFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("cannot read the locale of the host: %v", err)
+	}
+	defer f.Close()
+
+	locale := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "LANG=") {
+			continue
+		}
+		locale = strings.Trim(strings.TrimPrefix(line, "LANG="), `"'`)
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("cannot read the locale of the host: %v", err)
+	}
+	return locale, nil
+}
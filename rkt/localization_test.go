@@ -0,0 +1,76 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHostLocale(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rkt-localization-test-")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	localeConf := filepath.Join(dir, "locale.conf")
+	defaultLocale := filepath.Join(dir, "default-locale")
+	oldFiles := hostLocaleFiles
+	hostLocaleFiles = []string{localeConf, defaultLocale}
+	defer func() { hostLocaleFiles = oldFiles }()
+	oldLang := os.Getenv("LANG")
+	defer os.Setenv("LANG", oldLang)
+
+	tests := []struct {
+		localeConf    string
+		defaultLocale string
+		lang          string
+		locale        string
+		werr          bool
+	}{
+		{"LANG=de_DE.UTF-8\nLC_TIME=C\n", "LANG=fr_FR.UTF-8\n", "C", "de_DE.UTF-8", false},
+		{"", "# generated\nLANG=\"fr_FR.UTF-8\"\n", "C", "fr_FR.UTF-8", false},
+		{"LC_TIME=C\n", "", "en_US.UTF-8", "en_US.UTF-8", false},
+		{"", "", "", "", true},
+	}
+
+	for i, tt := range tests {
+		os.Remove(localeConf)
+		os.Remove(defaultLocale)
+		if tt.localeConf != "" {
+			if err := ioutil.WriteFile(localeConf, []byte(tt.localeConf), 0644); err != nil {
+				t.Fatalf("error writing %q: %v", localeConf, err)
+			}
+		}
+		if tt.defaultLocale != "" {
+			if err := ioutil.WriteFile(defaultLocale, []byte(tt.defaultLocale), 0644); err != nil {
+				t.Fatalf("error writing %q: %v", defaultLocale, err)
+			}
+		}
+		os.Setenv("LANG", tt.lang)
+
+		locale, err := hostLocale()
+		if gotErr := err != nil; gotErr != tt.werr {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.werr)
+			continue
+		}
+		if locale != tt.locale {
+			t.Errorf("#%d: got locale %q, want %q", i, locale, tt.locale)
+		}
+	}
+}
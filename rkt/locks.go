@@ -0,0 +1,98 @@
+// Copyright 2014 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/pkg/lock"
+)
+
+// describeLockHolders returns the processes holding, or waiting for, the
+// lock on path, in a human readable form.
+func describeLockHolders(path string) string {
+	holders, err := lock.Holders(path)
+	if err != nil {
+		return fmt.Sprintf("unknown (%v)", err)
+	}
+	if len(holders) == 0 {
+		return "none"
+	}
+	var hs []string
+	for _, h := range holders {
+		hs = append(hs, h.String())
+	}
+	return strings.Join(hs, ", ")
+}
+
+// exclusivePrepareLock takes the exclusive prepare lock, blocking the
+// creation of new pods. If it is already held, the processes holding it are
+// reported, and it gives up after timeout, unless timeout is zero.
+func exclusivePrepareLock(timeout time.Duration) (*lock.KeyLock, error) {
+	keyLock, err := lock.TryExclusiveKeyLock(lockDir(), common.PrepareLock)
+	if err != lock.ErrLocked {
+		return keyLock, err
+	}
+
+	path := filepath.Join(lockDir(), common.PrepareLock)
+	stderr("Waiting for the prepare lock, held by %s", describeLockHolders(path))
+	keyLock, err = lock.ExclusiveKeyLockTimeout(lockDir(), common.PrepareLock, timeout)
+	if err == lock.ErrTimeout {
+		return nil, fmt.Errorf("timed out after %v waiting for the prepare lock, held by %s", timeout, describeLockHolders(path))
+	}
+	return keyLock, err
+}
+
+// waitExclusiveLock takes an exclusive lock on the pod. If it is already
+// held, the processes holding it are reported, and it gives up after
+// timeout, unless timeout is zero.
+func (p *pod) waitExclusiveLock(timeout time.Duration) error {
+	err := p.TryExclusiveLock()
+	if err != lock.ErrLocked {
+		return err
+	}
+
+	stderr("Waiting for the lock of pod %q, held by %s", p.uuid, describeLockHolders(p.path()))
+	if err := p.ExclusiveLockTimeout(timeout); err != nil {
+		if err == lock.ErrTimeout {
+			return fmt.Errorf("timed out after %v waiting for the lock of the pod, held by %s", timeout, describeLockHolders(p.path()))
+		}
+		return err
+	}
+	return nil
+}
+
+// printLocks prints the processes holding, or waiting for, the locks used
+// by rkt for the given pod, for debugging.
+func printLocks(p *pod) {
+	storeDir := filepath.Join(globalFlags.Dir, "cas")
+	for _, l := range []struct {
+		name string
+		path string
+	}{
+		{"pod", p.path()},
+		{"prepare", filepath.Join(lockDir(), common.PrepareLock)},
+		{"store", storeDir},
+		{"store-db", filepath.Join(storeDir, "db")},
+	} {
+		stdout("lock-%s=%s", l.name, describeLockHolders(l.path))
+	}
+}
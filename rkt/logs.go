@@ -0,0 +1,331 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/cobra"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/pflag"
+	"github.com/coreos/rkt/common"
+)
+
+var (
+	cmdLogs = &cobra.Command{
+		Use:   "logs [--app=APPNAME] [--lines=N] UUID",
+		Short: "Print the output of the apps of a pod run with --log-files",
+		Long: `The output of the apps is read from the log files written by the pod, and is available after the pod exits.
+
+Without --app, the lines of all the apps are merged and tagged with the name of their app.`,
+		Run: runWrapper(runLogs),
+	}
+	flagLogsApp   string
+	flagLogsLines int
+
+	flagLogFiles         bool
+	flagLogFilesMaxSize  string
+	flagLogFilesMaxFiles int
+
+	flagLogDriver        string
+	flagLogDriverAddress string
+)
+
+const (
+	overlayLogsDirTemplate = "overlay/%s/upper/rkt/logs"
+	regularLogsDir         = "stage1/rootfs/rkt/logs"
+
+	// logFileName is the log file of an app written by the log-writer of
+	// stage1, rotated to logFileName.1, logFileName.2, ...
+	logFileName = "output.log"
+)
+
+func init() {
+	cmdRkt.AddCommand(cmdLogs)
+	cmdLogs.Flags().StringVar(&flagLogsApp, "app", "", "print the output of this app only")
+	cmdLogs.Flags().IntVar(&flagLogsLines, "lines", 0, "print the last N lines only")
+}
+
+// addLogFilesFlags adds the flags duplicating the output of the apps into
+// log files in the pod directory, read by rkt logs. They are passed to
+// stage1 as pod annotations.
+func addLogFilesFlags(flags *pflag.FlagSet) {
+	flags.BoolVar(&flagLogFiles, "log-files", false, "duplicate the output of the apps into size-rotated log files in the pod directory, read by rkt logs")
+	flags.StringVar(&flagLogFilesMaxSize, "log-files-max-size", "10m", "size of a log file before it is rotated, in bytes with an optional k, m or g suffix")
+	flags.IntVar(&flagLogFilesMaxFiles, "log-files-max-files", 5, "number of rotated log files kept for each app")
+}
+
+// logFilesFlagsSet returns whether the log files are enabled.
+func logFilesFlagsSet() bool {
+	return flagLogFiles
+}
+
+// validateLogFilesFlags returns an error if the value of a log files flag
+// is invalid.
+func validateLogFilesFlags() error {
+	if !flagLogFiles {
+		return nil
+	}
+	if err := common.ValidateMemorySize(flagLogFilesMaxSize); err != nil {
+		return err
+	}
+	if flagLogFilesMaxFiles < 0 {
+		return fmt.Errorf("invalid number of rotated log files %d", flagLogFilesMaxFiles)
+	}
+	return nil
+}
+
+// logFilesAnnotations returns the pod annotations corresponding to the log
+// files flags.
+func logFilesAnnotations() types.Annotations {
+	var annotations types.Annotations
+	if flagLogFiles {
+		annotations.Set(types.ACIdentifier(common.LogFilesMaxSizeAnnotation), flagLogFilesMaxSize)
+		annotations.Set(types.ACIdentifier(common.LogFilesMaxFilesAnnotation), strconv.Itoa(flagLogFilesMaxFiles))
+	}
+	return annotations
+}
+
+// addLogDriverFlags adds the flags choosing where the log shim of stage1
+// sends the output of the apps. They are passed to stage1 as pod
+// annotations.
+func addLogDriverFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&flagLogDriver, "log-driver", common.LogDriverJournald, "where the output of the apps is sent: journald, syslog or fluentd")
+	flags.StringVar(&flagLogDriverAddress, "log-driver-address", "", "address of the syslog or fluentd server, as udp://HOST:PORT or tcp://HOST:PORT")
+}
+
+// logDriverFlagsSet returns whether a log driver flag is set.
+func logDriverFlagsSet() bool {
+	return flagLogDriver != common.LogDriverJournald || flagLogDriverAddress != ""
+}
+
+// validateLogDriverFlags returns an error if the log driver flags are
+// invalid. The log servers are reached from the network of the pod, so they
+// cannot be used without one.
+func validateLogDriverFlags() error {
+	if _, _, err := common.ParseLogDriverAddress(flagLogDriver, flagLogDriverAddress); err != nil {
+		return err
+	}
+	if flagLogDriver != common.LogDriverJournald && flagNet.None() {
+		return fmt.Errorf("the %s log driver cannot reach its server with --net=none", flagLogDriver)
+	}
+	return nil
+}
+
+// logDriverAnnotations returns the pod annotations corresponding to the log
+// driver flags. The default journald driver needs none.
+func logDriverAnnotations() types.Annotations {
+	var annotations types.Annotations
+	if flagLogDriver != common.LogDriverJournald {
+		annotations.Set(types.ACIdentifier(common.LogDriverAnnotation), flagLogDriver)
+		annotations.Set(types.ACIdentifier(common.LogDriverAddressAnnotation), flagLogDriverAddress)
+	}
+	return annotations
+}
+
+func runLogs(cmd *cobra.Command, args []string) (exit int) {
+	if len(args) != 1 {
+		cmd.Usage()
+		return 1
+	}
+
+	p, err := getPodFromUUIDString(args[0])
+	if err != nil {
+		stderr("Problem retrieving pod: %v", err)
+		return 1
+	}
+	defer p.Close()
+
+	if p.isEmbryo || p.isPreparing || p.isAbortedPrepare {
+		stderr("Pod %q has not run", p.uuid)
+		return 1
+	}
+
+	logsDir, err := p.getLogsDir()
+	if err != nil {
+		stderr("Unable to get the log files directory: %v", err)
+		return 1
+	}
+	logsDir = filepath.Join(p.path(), logsDir)
+
+	apps, err := logFilesApps(logsDir)
+	if err != nil {
+		stderr("Unable to read the log files: %v", err)
+		return 1
+	}
+	if len(apps) == 0 {
+		stderr("Pod %q has no log files, it must be run with --log-files", p.uuid)
+		return 1
+	}
+
+	if flagLogsApp != "" {
+		found := false
+		for _, app := range apps {
+			found = found || app == flagLogsApp
+		}
+		if !found {
+			stderr("App %q has no log files in pod %q", flagLogsApp, p.uuid)
+			return 1
+		}
+		apps = []string{flagLogsApp}
+	}
+
+	lines, err := mergeLogFiles(logsDir, apps, flagLogsApp == "")
+	if err != nil {
+		stderr("%v", err)
+		return 1
+	}
+
+	if flagLogsLines > 0 && len(lines) > flagLogsLines {
+		lines = lines[len(lines)-flagLogsLines:]
+	}
+	for _, l := range lines {
+		stdout("%s", l)
+	}
+
+	return 0
+}
+
+// logFilesApps returns the names of the apps having log files in logsDir.
+func logFilesApps(logsDir string) ([]string, error) {
+	dir, err := os.Open(logsDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+
+	apps, err := dir.Readdirnames(0)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(apps)
+	return apps, nil
+}
+
+// mergeLogFiles returns the lines of the log files of the apps in logsDir,
+// sorted by timestamp. With tag, the lines are tagged with the name of their
+// app.
+func mergeLogFiles(logsDir string, apps []string, tag bool) ([]string, error) {
+	var lines []string
+	for _, app := range apps {
+		appLines, err := readLogFiles(filepath.Join(logsDir, app))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the log files of app %q: %v", app, err)
+		}
+		if tag {
+			appLines = tagLogLines(appLines, app)
+		}
+		lines = append(lines, appLines...)
+	}
+	if len(apps) > 1 {
+		sort.Stable(byTimestamp(lines))
+	}
+	return lines, nil
+}
+
+// readLogFiles returns the lines of the log files in appLogsDir, from the
+// oldest to the most recent.
+func readLogFiles(appLogsDir string) ([]string, error) {
+	rotated, err := filepath.Glob(filepath.Join(appLogsDir, logFileName+".*"))
+	if err != nil {
+		return nil, err
+	}
+	var numbers []int
+	for _, r := range rotated {
+		n, err := strconv.Atoi(strings.TrimPrefix(filepath.Ext(r), "."))
+		if err != nil {
+			continue
+		}
+		numbers = append(numbers, n)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(numbers)))
+
+	var files []string
+	for _, n := range numbers {
+		files = append(files, filepath.Join(appLogsDir, fmt.Sprintf("%s.%d", logFileName, n)))
+	}
+	files = append(files, filepath.Join(appLogsDir, logFileName))
+
+	var lines []string
+	for _, path := range files {
+		f, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		r := bufio.NewReader(f)
+		for {
+			line, err := r.ReadString('\n')
+			if len(line) > 0 {
+				lines = append(lines, strings.TrimSuffix(line, "\n"))
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				f.Close()
+				return nil, err
+			}
+		}
+		f.Close()
+	}
+	return lines, nil
+}
+
+// tagLogLines inserts the name of the app after the timestamp of its log
+// lines.
+func tagLogLines(lines []string, app string) []string {
+	tagged := make([]string, 0, len(lines))
+	for _, l := range lines {
+		fields := strings.SplitN(l, " ", 2)
+		if len(fields) != 2 {
+			tagged = append(tagged, l)
+			continue
+		}
+		tagged = append(tagged, fields[0]+" "+app+" "+fields[1])
+	}
+	return tagged
+}
+
+// byTimestamp sorts log lines by their timestamp. The timestamps have a
+// fixed width and are in UTC, so they sort as strings.
+type byTimestamp []string
+
+func (l byTimestamp) Len() int      { return len(l) }
+func (l byTimestamp) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l byTimestamp) Less(i, j int) bool {
+	return logTimestamp(l[i]) < logTimestamp(l[j])
+}
+
+func logTimestamp(line string) string {
+	if i := strings.Index(line, " "); i >= 0 {
+		return line[:i]
+	}
+	return line
+}
@@ -0,0 +1,119 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/coreos/rkt/common"
+)
+
+func TestReadLogFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rkt-logs-test")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, content := range map[string]string{
+		"output.log":    "2016-01-02T15:04:05.000000004Z stdout e\n",
+		"output.log.1":  "2016-01-02T15:04:05.000000002Z stdout c\n2016-01-02T15:04:05.000000003Z stderr d\n",
+		"output.log.2":  "2016-01-02T15:04:05.000000001Z stdout b\n",
+		"output.log.10": "2016-01-02T15:04:05.000000000Z stdout a\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("error writing %s: %v", name, err)
+		}
+	}
+
+	lines, err := readLogFiles(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{
+		"2016-01-02T15:04:05.000000000Z stdout a",
+		"2016-01-02T15:04:05.000000001Z stdout b",
+		"2016-01-02T15:04:05.000000002Z stdout c",
+		"2016-01-02T15:04:05.000000003Z stderr d",
+		"2016-01-02T15:04:05.000000004Z stdout e",
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("got lines %q, want %q", lines, want)
+	}
+}
+
+func TestMergeLogLines(t *testing.T) {
+	lines := append(
+		tagLogLines([]string{
+			"2016-01-02T15:04:05.000000000Z stdout z",
+			"2016-01-02T15:04:07.000000000Z stdout y",
+		}, "web"),
+		tagLogLines([]string{
+			"2016-01-02T15:04:06.000000000Z stderr x",
+			"2016-01-02T15:04:07.000000000Z stdout w",
+		}, "db")...,
+	)
+	sort.Stable(byTimestamp(lines))
+
+	want := []string{
+		"2016-01-02T15:04:05.000000000Z web stdout z",
+		"2016-01-02T15:04:06.000000000Z db stderr x",
+		"2016-01-02T15:04:07.000000000Z web stdout y",
+		"2016-01-02T15:04:07.000000000Z db stdout w",
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("got lines %q, want %q", lines, want)
+	}
+}
+
+func TestValidateLogDriverFlags(t *testing.T) {
+	oldDriver, oldAddress, oldNet := flagLogDriver, flagLogDriverAddress, flagNet
+	defer func() {
+		flagLogDriver, flagLogDriverAddress, flagNet = oldDriver, oldAddress, oldNet
+	}()
+
+	tests := []struct {
+		driver  string
+		address string
+		net     string
+		err     bool
+	}{
+		{"journald", "", "none", false},
+		{"syslog", "udp://10.0.0.1:514", "default", false},
+		{"syslog", "udp://10.0.0.1:514", "host", false},
+		{"syslog", "udp://10.0.0.1:514", "none", true},
+		{"fluentd", "tcp://10.0.0.1:24224", "none", true},
+		{"fluentd", "", "default", true},
+	}
+
+	for i, tt := range tests {
+		flagLogDriver, flagLogDriverAddress = tt.driver, tt.address
+		flagNet = common.NetList{}
+		if err := flagNet.Set(tt.net); err != nil {
+			t.Fatalf("#%d: unexpected error: %v", i, err)
+		}
+		err := validateLogDriverFlags()
+		if gotErr := err != nil; gotErr != tt.err {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/pflag"
+	"github.com/coreos/rkt/common"
+)
+
+var (
+	flagMachineName      string
+	flagMachinedRegister bool
+
+	// machineNameRegexp matches the machine names accepted by
+	// systemd-machined, which follow the rules of host names.
+	machineNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-][a-zA-Z0-9_.-]{0,63}$`)
+)
+
+// addMachineFlags adds the flags configuring the registration of the pods
+// to systemd-machined. They are passed to stage1 as pod annotations.
+func addMachineFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&flagMachineName, "machine-name", "", "name of the pod in systemd-machined (default rkt-$UUID)")
+	flags.BoolVar(&flagMachinedRegister, "machined-register", true, "register the pod to systemd-machined, if available on the host")
+}
+
+// machineFlagsSet returns whether any of the machine flags is set.
+func machineFlagsSet() bool {
+	return flagMachineName != "" || !flagMachinedRegister
+}
+
+// validateMachineName returns an error if name is not a valid machine name.
+func validateMachineName(name string) error {
+	if !machineNameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid machine name %q: it must be at most 64 letters, digits, %q, %q or %q, and not start with %q", name, "-", "_", ".", ".")
+	}
+	return nil
+}
+
+// machineAnnotations returns the pod annotations corresponding to the
+// machine flags.
+func machineAnnotations() types.Annotations {
+	var annotations types.Annotations
+	if flagMachineName != "" {
+		annotations.Set(types.ACIdentifier(common.MachineNameAnnotation), flagMachineName)
+	}
+	if !flagMachinedRegister {
+		annotations.Set(types.ACIdentifier(common.MachinedRegisterAnnotation), "false")
+	}
+	return annotations
+}
@@ -0,0 +1,46 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateMachineName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"etcd", true},
+		{"web-1.example_com", true},
+		{"", false},
+		{".hidden", false},
+		{"with space", false},
+		{"with/slash", false},
+		{strings.Repeat("a", 64), true},
+		{strings.Repeat("a", 65), false},
+	}
+
+	for i, tt := range tests {
+		err := validateMachineName(tt.name)
+		if tt.valid && err != nil {
+			t.Errorf("#%d: expected %q to be valid, got error: %v", i, tt.name, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("#%d: expected %q to be invalid", i, tt.name)
+		}
+	}
+}
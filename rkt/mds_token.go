@@ -0,0 +1,106 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/cobra"
+	"github.com/coreos/rkt/stage0"
+	"github.com/coreos/rkt/store"
+)
+
+var (
+	cmdMDSRotateToken = &cobra.Command{
+		Use:   "rotate-token [--grace=DURATION] UUID...",
+		Short: "Rotate the metadata service tokens of running pods",
+		Long: `Each pod gets a new token, which the stage1 re-issues to its apps in AC_METADATA_URL.
+The token is not pushed to the running app processes: they only get the new
+URL when they are restarted, and rotate-token does not restart them. So the
+previous token is still accepted until the pod stops.
+
+With --grace, the previous token is revoked after the grace period instead,
+and the apps which were not restarted by then lose access to the metadata
+service.`,
+		Run: runWrapper(runMDSRotateToken),
+	}
+	flagMDSTokenGrace time.Duration
+)
+
+func init() {
+	cmdMetadataService.AddCommand(cmdMDSRotateToken)
+	cmdMDSRotateToken.Flags().DurationVar(&flagMDSTokenGrace, "grace", 0, "revoke the previous token after this period instead of when the pod stops, the apps must be restarted within it to keep access to the metadata service")
+}
+
+func runMDSRotateToken(cmd *cobra.Command, args []string) (exit int) {
+	if len(args) < 1 {
+		cmd.Usage()
+		return 1
+	}
+	if flagMDSTokenGrace < 0 {
+		stderr("rotate-token: the grace period must not be negative")
+		return 1
+	}
+	// without --grace, keep the previous token, the running apps still use it
+	grace := flagMDSTokenGrace
+	if !cmd.Flags().Lookup("grace").Changed {
+		grace = -1
+	}
+
+	s, err := newStore()
+	if err != nil {
+		stderr("rotate-token: cannot open store: %v", err)
+		return 1
+	}
+	defer s.Close()
+
+	for _, uuid := range args {
+		if err := rotatePodToken(s, uuid, grace); err != nil {
+			stderr("rotate-token: %v", err)
+			exit = 1
+			continue
+		}
+		stdout("%s", uuid)
+	}
+
+	return
+}
+
+func rotatePodToken(s *store.Store, uuid string, grace time.Duration) error {
+	p, err := getPodFromUUIDString(uuid)
+	if err != nil {
+		return fmt.Errorf("problem retrieving pod %q: %v", uuid, err)
+	}
+	defer p.Close()
+
+	if !p.isRunning() {
+		return fmt.Errorf("pod %q isn't currently running", p.uuid)
+	}
+
+	stage1TreeStoreID, err := p.getStage1TreeStoreID()
+	if err != nil {
+		return fmt.Errorf("error getting stage1 treeStoreID of pod %q: %v", p.uuid, err)
+	}
+	stage1RootFS := s.GetTreeStoreRootFS(stage1TreeStoreID)
+
+	if err := stage0.RotateMDSToken(p.path(), p.uuid, stage1RootFS, grace, globalFlags.Debug); err != nil {
+		return fmt.Errorf("failed to rotate the token of pod %q: %v", p.uuid, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/pflag"
+	"github.com/coreos/rkt/common"
+)
+
+var (
+	flagShmSize   string
+	flagHugepages string
+)
+
+// addMemoryFlags adds the flags configuring the shared memory of the pods.
+// They are passed to stage1 as pod annotations.
+func addMemoryFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&flagShmSize, "shm-size", "", "size of /dev/shm in the apps, in bytes with an optional k, m or g suffix (default half of the memory of the host)")
+	flags.StringVar(&flagHugepages, "hugepages", "", "mount a hugetlbfs on /dev/hugepages in the apps, with the given page size, e.g. 2M or 1G")
+	flags.Lookup("hugepages").NoOptDefVal = "default"
+}
+
+// memoryFlagsSet returns whether any of the memory flags is set.
+func memoryFlagsSet() bool {
+	return flagShmSize != "" || flagHugepages != ""
+}
+
+// validateMemoryFlags returns an error if the value of a memory flag is
+// invalid.
+func validateMemoryFlags() error {
+	if flagShmSize != "" {
+		if err := common.ValidateMemorySize(flagShmSize); err != nil {
+			return err
+		}
+	}
+	if flagHugepages != "" && flagHugepages != "default" {
+		if err := common.ValidateMemorySize(flagHugepages); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// memoryAnnotations returns the pod annotations corresponding to the memory
+// flags.
+func memoryAnnotations() types.Annotations {
+	var annotations types.Annotations
+	if flagShmSize != "" {
+		annotations.Set(types.ACIdentifier(common.ShmSizeAnnotation), flagShmSize)
+	}
+	if flagHugepages != "" {
+		annotations.Set(types.ACIdentifier(common.HugepagesAnnotation), flagHugepages)
+	}
+	return annotations
+}
@@ -32,12 +32,14 @@ import (
 	"strconv"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/gorilla/mux"
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/cobra"
 	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/pkg/vsock"
 )
 
 var (
@@ -53,6 +55,7 @@ var (
 	pods           = newPodStore()
 	errPodNotFound = errors.New("pod not found")
 	errAppNotFound = errors.New("app not found")
+	errTokenInUse  = errors.New("token already in use")
 
 	flagListenPort int
 
@@ -73,11 +76,15 @@ type mdsPod struct {
 	token    string
 	manifest *schema.PodManifest
 	apps     map[string]*schema.ImageManifest
+	// retired are the previous tokens of the pod, still accepted after a
+	// rotation until their expiry, or until the pod is removed
+	retired []string
 }
 
 type podStore struct {
 	byToken map[string]*mdsPod
 	byUUID  map[types.UUID]*mdsPod
+	expiry  map[string]time.Time
 	mutex   sync.Mutex
 }
 
@@ -85,6 +92,7 @@ func newPodStore() *podStore {
 	return &podStore{
 		byToken: make(map[string]*mdsPod),
 		byUUID:  make(map[types.UUID]*mdsPod),
+		expiry:  make(map[string]time.Time),
 	}
 }
 
@@ -128,15 +136,81 @@ func (ps *podStore) remove(u *types.UUID) error {
 
 	delete(ps.byUUID, *u)
 	delete(ps.byToken, p.token)
+	for _, t := range p.retired {
+		delete(ps.byToken, t)
+		delete(ps.expiry, t)
+	}
 
 	return nil
 }
 
-func (ps *podStore) getUUID(token string) (*types.UUID, error) {
+// rotateToken replaces the token of the pod. The running apps of the pod
+// only get the new token when they are restarted, so the previous token is
+// still accepted until the pod is removed when grace is negative, or for the
+// grace period otherwise.
+func (ps *podStore) rotateToken(u *types.UUID, token string, grace time.Duration) error {
 	ps.mutex.Lock()
 	defer ps.mutex.Unlock()
 
+	p, ok := ps.byUUID[*u]
+	if !ok {
+		return errPodNotFound
+	}
+	ps.expireTokens(p)
+	if _, ok := ps.byToken[token]; ok {
+		return errTokenInUse
+	}
+
+	switch {
+	case grace < 0:
+		p.retired = append(p.retired, p.token)
+	case grace > 0:
+		ps.expiry[p.token] = time.Now().Add(grace)
+		p.retired = append(p.retired, p.token)
+	default:
+		delete(ps.byToken, p.token)
+	}
+
+	p.token = token
+	ps.byToken[token] = p
+
+	return nil
+}
+
+// lookup returns the pod of the token. The mutex must be held.
+func (ps *podStore) lookup(token string) (*mdsPod, bool) {
 	p, ok := ps.byToken[token]
+	if !ok {
+		return nil, false
+	}
+
+	ps.expireTokens(p)
+	p, ok = ps.byToken[token]
+	return p, ok
+}
+
+// expireTokens removes the retired tokens of the pod whose grace period is
+// over. The tokens without grace period are kept until the pod is removed.
+// The mutex must be held.
+func (ps *podStore) expireTokens(p *mdsPod) {
+	now := time.Now()
+	retired := p.retired[:0]
+	for _, t := range p.retired {
+		if exp, ok := ps.expiry[t]; ok && now.After(exp) {
+			delete(ps.byToken, t)
+			delete(ps.expiry, t)
+			continue
+		}
+		retired = append(retired, t)
+	}
+	p.retired = retired
+}
+
+func (ps *podStore) getUUID(token string) (*types.UUID, error) {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	p, ok := ps.lookup(token)
 	if !ok {
 		return nil, errPodNotFound
 	}
@@ -147,7 +221,7 @@ func (ps *podStore) getPodManifest(token string) (*schema.PodManifest, error) {
 	ps.mutex.Lock()
 	defer ps.mutex.Unlock()
 
-	p, ok := ps.byToken[token]
+	p, ok := ps.lookup(token)
 	if !ok {
 		return nil, errPodNotFound
 	}
@@ -158,7 +232,7 @@ func (ps *podStore) getManifests(token, an string) (*schema.PodManifest, *schema
 	ps.mutex.Lock()
 	defer ps.mutex.Unlock()
 
-	p, ok := ps.byToken[token]
+	p, ok := ps.lookup(token)
 	if !ok {
 		return nil, nil, errPodNotFound
 	}
@@ -228,6 +302,49 @@ func handleUnregisterPod(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+func handleRotateToken(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	uuid, err := types.NewUUID(mux.Vars(r)["uuid"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "UUID is missing or malformed: %v", err)
+		return
+	}
+
+	token := queryValue(r.URL, "token")
+	if token == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "token missing")
+		return
+	}
+
+	// without grace period, the previous token is kept until the pod is
+	// removed, as the running apps still use it
+	grace := time.Duration(-1)
+	if g := queryValue(r.URL, "grace"); g != "" {
+		grace, err = time.ParseDuration(g)
+		if err != nil || grace < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "grace period %q is malformed", g)
+			return
+		}
+	}
+
+	switch err := pods.rotateToken(uuid, token, grace); err {
+	case nil:
+		w.WriteHeader(http.StatusOK)
+
+	case errPodNotFound:
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, err)
+
+	default:
+		w.WriteHeader(http.StatusConflict)
+		fmt.Fprint(w, err)
+	}
+}
+
 func handleRegisterApp(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
@@ -599,6 +716,7 @@ func runRegistrationServer(l net.Listener) {
 	r := mux.NewRouter()
 	r.HandleFunc("/pods/{uuid}", logReq(handleRegisterPod)).Methods("PUT")
 	r.HandleFunc("/pods/{uuid}", logReq(handleUnregisterPod)).Methods("DELETE")
+	r.HandleFunc("/pods/{uuid}/token", logReq(handleRotateToken)).Methods("POST")
 	r.HandleFunc("/pods/{uuid}/{app:.*}", logReq(handleRegisterApp)).Methods("PUT")
 
 	if err := http.Serve(l, r); err != nil {
@@ -655,8 +773,20 @@ func runMetadataService(cmd *cobra.Command, args []string) (exit int) {
 		return 1
 	}
 
+	// the kvm pods reach the metadata service over vsock when the host
+	// supports it, see stage1/init/kvm
+	vsockl, err := vsock.Listen(uint32(flagListenPort))
+	if err != nil {
+		log.Printf("Not listening on vsock port %v: %v", flagListenPort, err)
+	} else {
+		defer vsockl.Close()
+	}
+
 	go runRegistrationServer(unixl)
 	go runPublicServer(tcpl)
+	if vsockl != nil {
+		go runPublicServer(vsockl)
+	}
 
 	log.Print("Metadata service running...")
 
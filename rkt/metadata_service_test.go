@@ -17,6 +17,7 @@ package main
 import (
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
@@ -116,3 +117,62 @@ func TestPodStoreRemove(t *testing.T) {
 		t.Errorf("remove with unknown pod returned %v", err)
 	}
 }
+
+func TestPodStoreRotateToken(t *testing.T) {
+	ps, uuid, token, _ := setupPodStoreTest(t)
+
+	if err := ps.rotateToken(uuid, "new", time.Hour); err != nil {
+		t.Fatalf("rotateToken failed with %v", err)
+	}
+	for _, tok := range []string{token, "new"} {
+		if _, err := ps.getUUID(tok); err != nil {
+			t.Errorf("getUUID with token %q during the grace period returned %v", tok, err)
+		}
+	}
+
+	// expire the grace period of the previous token
+	ps.expiry[token] = time.Now().Add(-time.Second)
+	if _, err := ps.getUUID(token); err != errPodNotFound {
+		t.Errorf("getUUID with expired token returned %v", err)
+	}
+	if _, err := ps.getUUID("new"); err != nil {
+		t.Errorf("getUUID with new token returned %v", err)
+	}
+
+	if err := ps.rotateToken(uuid, "newer", 0); err != nil {
+		t.Fatalf("rotateToken failed with %v", err)
+	}
+	if _, err := ps.getUUID("new"); err != errPodNotFound {
+		t.Errorf("getUUID with token rotated without grace period returned %v", err)
+	}
+
+	if err := ps.rotateToken(uuid, "newer", 0); err != errTokenInUse {
+		t.Errorf("rotateToken with token in use returned %v", err)
+	}
+
+	uuid2, err := types.NewUUID("fe305d54-75b4-431b-adb2-eb6b9e546013")
+	if err != nil {
+		panic("bad uuid literal")
+	}
+	if err := ps.rotateToken(uuid2, "other", 0); err != errPodNotFound {
+		t.Errorf("rotateToken with unknown pod returned %v", err)
+	}
+
+	// without grace period, the previous token is kept until the pod is removed
+	if err := ps.rotateToken(uuid, "newest", -1); err != nil {
+		t.Fatalf("rotateToken failed with %v", err)
+	}
+	if _, err := ps.getUUID("newer"); err != nil {
+		t.Errorf("getUUID with token rotated while the pod runs returned %v", err)
+	}
+
+	if err := ps.rotateToken(uuid, "latest", time.Hour); err != nil {
+		t.Fatalf("rotateToken failed with %v", err)
+	}
+	if err := ps.remove(uuid); err != nil {
+		t.Fatalf("remove failed with %v", err)
+	}
+	if len(ps.byToken) != 0 || len(ps.expiry) != 0 {
+		t.Errorf("remove left tokens behind: %v %v", ps.byToken, ps.expiry)
+	}
+}
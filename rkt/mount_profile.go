@@ -0,0 +1,121 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/pflag"
+	"github.com/coreos/rkt/common/apps"
+)
+
+var flagMountProfiles []string
+
+// resolvConfPath is the resolv.conf of the host, which a pod with its own
+// DNS mode must not get from a profile
+const resolvConfPath = "/etc/resolv.conf"
+
+// profileVolume is a host path mounted read-only in all the apps by a mount
+// profile.
+type profileVolume struct {
+	name types.ACName
+	path string
+}
+
+// mountProfiles are, by name, the sets of host paths the images should not
+// need to bundle, mounted with --mount-profile.
+var mountProfiles = map[string][]profileVolume{
+	"host-tools": {
+		{"rkt-host-etc-resolv-conf", resolvConfPath},
+		{"rkt-host-etc-ssl-certs", "/etc/ssl/certs"},
+		{"rkt-host-usr-share-ca-certificates", "/usr/share/ca-certificates"},
+		{"rkt-host-etc-localtime", "/etc/localtime"},
+		{"rkt-host-usr-share-zoneinfo", "/usr/share/zoneinfo"},
+	},
+}
+
+// addMountProfileFlag adds the flag mounting the host paths of mount
+// profiles in the apps.
+func addMountProfileFlag(flags *pflag.FlagSet) {
+	flags.StringSliceVar(&flagMountProfiles, "mount-profile", nil, "mount the host paths of the given profiles read-only in all the apps, one of "+strings.Join(mountProfileNames(), ", "))
+}
+
+// mountProfileNames returns the names of the mount profiles, sorted.
+func mountProfileNames() []string {
+	var names []string
+	for name := range mountProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateMountProfileFlag returns an error if an unknown mount profile is
+// given.
+func validateMountProfileFlag() error {
+	for _, name := range flagMountProfiles {
+		if _, ok := mountProfiles[name]; !ok {
+			return fmt.Errorf("unknown mount profile %q, must be one of %s", name, strings.Join(mountProfileNames(), ", "))
+		}
+	}
+	return nil
+}
+
+// addMountProfiles adds the host volumes of the given mount profiles, and
+// their global read-only mounts, to the apps. The paths which do not exist
+// on the host, or are already the target of a global mount, are skipped.
+// The mounts of an app at the same paths take precedence as usual. With
+// dns, the pod has its own DNS mode and the resolv.conf of the host, which
+// would take precedence over it, is skipped too.
+func addMountProfiles(al *apps.Apps, profiles []string, dns bool) {
+	mounted := make(map[string]bool)
+	for _, m := range al.Mounts {
+		mounted[filepath.Clean(m.Path)] = true
+	}
+	named := make(map[types.ACName]bool)
+	for _, v := range al.Volumes {
+		named[v.Name] = true
+	}
+
+	for _, profile := range profiles {
+		for _, v := range mountProfiles[profile] {
+			if mounted[v.path] || named[v.name] {
+				continue
+			}
+			if dns && v.path == resolvConfPath {
+				continue
+			}
+			if _, err := os.Stat(v.path); err != nil {
+				continue
+			}
+			readOnly := true
+			al.Volumes = append(al.Volumes, types.Volume{
+				Name:     v.name,
+				Kind:     "host",
+				Source:   v.path,
+				ReadOnly: &readOnly,
+			})
+			al.Mounts = append(al.Mounts, schema.Mount{Volume: v.name, Path: v.path})
+			mounted[v.path] = true
+			named[v.name] = true
+		}
+	}
+}
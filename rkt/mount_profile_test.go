@@ -0,0 +1,115 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common/apps"
+)
+
+func TestAddMountProfiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rkt-mount-profile-test-")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	certs := filepath.Join(dir, "certs")
+	zoneinfo := filepath.Join(dir, "zoneinfo")
+	missing := filepath.Join(dir, "missing")
+	for _, d := range []string{certs, zoneinfo} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatalf("error creating %q: %v", d, err)
+		}
+	}
+	mountProfiles["test"] = []profileVolume{
+		{"certs", certs},
+		{"zoneinfo", zoneinfo},
+		{"missing", missing},
+	}
+	// the same path in another profile is only mounted once
+	mountProfiles["test-certs"] = []profileVolume{{"other-certs", certs}}
+	mountProfiles["test-dns"] = []profileVolume{{"resolv-conf", resolvConfPath}}
+	defer delete(mountProfiles, "test")
+	defer delete(mountProfiles, "test-certs")
+	defer delete(mountProfiles, "test-dns")
+	var resolvConf []string
+	if _, err := os.Stat(resolvConfPath); err == nil {
+		resolvConf = []string{resolvConfPath}
+	}
+
+	tests := []struct {
+		profiles []string
+		dns      bool
+		mounts   []schema.Mount
+		volumes  []types.ACName
+		added    []string
+	}{
+		{nil, false, nil, nil, nil},
+		{[]string{"test", "test-certs"}, false, nil, nil, []string{certs, zoneinfo}},
+		// the paths which are already mounted are skipped
+		{[]string{"test"}, false, []schema.Mount{{Volume: "mine", Path: certs + "/"}}, []types.ACName{"mine"}, []string{zoneinfo}},
+		// and so are the volumes with the same name
+		{[]string{"test"}, false, nil, []types.ACName{"zoneinfo"}, []string{certs}},
+		// and the resolv.conf of the host with a DNS mode
+		{[]string{"test-dns"}, false, nil, nil, resolvConf},
+		{[]string{"test-dns"}, true, nil, nil, nil},
+	}
+
+	for i, tt := range tests {
+		al := &apps.Apps{Mounts: tt.mounts}
+		for _, name := range tt.volumes {
+			al.Volumes = append(al.Volumes, types.Volume{Name: name, Kind: "empty"})
+		}
+
+		addMountProfiles(al, tt.profiles, tt.dns)
+
+		var added []string
+		for _, m := range al.Mounts[len(tt.mounts):] {
+			added = append(added, m.Path)
+		}
+		if !reflect.DeepEqual(added, tt.added) {
+			t.Errorf("#%d: expected mounts %v to be added, got %v", i, tt.added, added)
+		}
+		for _, v := range al.Volumes[len(tt.volumes):] {
+			if v.Kind != "host" || v.ReadOnly == nil || !*v.ReadOnly {
+				t.Errorf("#%d: unexpected volume %v", i, v)
+			}
+		}
+		if err := al.Validate(); err != nil {
+			t.Errorf("#%d: unexpected error validating the apps: %v", i, err)
+		}
+	}
+}
+
+func TestValidateMountProfileFlag(t *testing.T) {
+	defer func() { flagMountProfiles = nil }()
+
+	flagMountProfiles = []string{"host-tools"}
+	if err := validateMountProfileFlag(); err != nil {
+		t.Errorf("unexpected error for a known profile: %v", err)
+	}
+	flagMountProfiles = []string{"host-tools", "everything"}
+	if err := validateMountProfileFlag(); err == nil {
+		t.Errorf("expected an error for an unknown profile")
+	}
+}
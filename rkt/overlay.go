@@ -0,0 +1,40 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/pflag"
+	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/rkt/config"
+)
+
+// useOverlay returns whether a pod is prepared with overlayfs, and the
+// reason why it is not, which is recorded in the pod. An explicit
+// --no-overlay takes precedence over the overlay mode of the configuration.
+func useOverlay(flags *pflag.FlagSet, overlayMode string) (bool, string) {
+	if flags.Lookup("no-overlay").Changed {
+		if flagNoOverlay {
+			return false, "disabled with --no-overlay"
+		}
+	} else if overlayMode == config.OverlayDisabled {
+		return false, "disabled in the configuration"
+	}
+
+	if err := common.CheckOverlay(globalFlags.Dir); err != nil {
+		stderr("rkt: not using overlayfs: %v", err)
+		return false, err.Error()
+	}
+	return true, ""
+}
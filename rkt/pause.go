@@ -0,0 +1,97 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/cobra"
+	"github.com/coreos/rkt/stage0"
+)
+
+var (
+	cmdPause = &cobra.Command{
+		Use:   "pause UUID",
+		Short: "Pause all the processes of a running pod",
+		Long:  `The pod stays running and keeps its resources, but its processes do not get scheduled until "rkt resume".`,
+		Run:   runWrapper(runPause),
+	}
+	cmdResume = &cobra.Command{
+		Use:   "resume UUID",
+		Short: "Resume a pod paused by rkt pause",
+		Run:   runWrapper(runResume),
+	}
+)
+
+func init() {
+	cmdRkt.AddCommand(cmdPause)
+	cmdRkt.AddCommand(cmdResume)
+}
+
+func runPause(cmd *cobra.Command, args []string) (exit int) {
+	return pauseOrResume(cmd, args, false)
+}
+
+func runResume(cmd *cobra.Command, args []string) (exit int) {
+	return pauseOrResume(cmd, args, true)
+}
+
+func pauseOrResume(cmd *cobra.Command, args []string, resume bool) (exit int) {
+	if len(args) != 1 {
+		cmd.Usage()
+		return 1
+	}
+
+	p, err := getPodFromUUIDString(args[0])
+	if err != nil {
+		stderr("%s: problem retrieving pod: %v", cmd.Name(), err)
+		return 1
+	}
+	defer p.Close()
+
+	if !p.isRunning() {
+		stderr("%s: pod %q isn't currently running", cmd.Name(), p.uuid)
+		return 1
+	}
+	if p.isPaused() != resume {
+		if resume {
+			stderr("%s: pod %q is not paused", cmd.Name(), p.uuid)
+		} else {
+			stderr("%s: pod %q is already paused", cmd.Name(), p.uuid)
+		}
+		return 1
+	}
+
+	s, err := newStore()
+	if err != nil {
+		stderr("%s: cannot open store: %v", cmd.Name(), err)
+		return 1
+	}
+	defer s.Close()
+
+	stage1TreeStoreID, err := p.getStage1TreeStoreID()
+	if err != nil {
+		stderr("%s: error getting stage1 treeStoreID: %v", cmd.Name(), err)
+		return 1
+	}
+	stage1RootFS := s.GetTreeStoreRootFS(stage1TreeStoreID)
+
+	if err := stage0.Pause(p.path(), p.uuid, stage1RootFS, resume, globalFlags.Debug); err != nil {
+		stderr("%s: failed to %s pod %q: %v", cmd.Name(), cmd.Name(), p.uuid, err)
+		return 1
+	}
+
+	return 0
+}
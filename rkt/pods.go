@@ -17,6 +17,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -145,10 +146,11 @@ func walkPods(include includeMask, f func(*pod)) error {
 	return nil
 }
 
-// newPod creates a new pod directory in the "preparing" state, allocating a unique uuid for it in the process.
+// newPod creates a new pod directory in the "preparing" state, allocating a unique uuid for it in the process,
+// unless a uuid is given, in which case it fails if a pod with this uuid already exists.
 // The returned pod is always left in an exclusively locked state (preparing is locked in the prepared directory)
 // The pod must be closed using pod.Close()
-func newPod() (*pod, error) {
+func newPod(u *types.UUID) (*pod, error) {
 	if err := initPods(); err != nil {
 		return nil, err
 	}
@@ -160,9 +162,16 @@ func newPod() (*pod, error) {
 	}
 
 	var err error
-	p.uuid, err = types.NewUUID(uuid.New())
-	if err != nil {
-		return nil, fmt.Errorf("error creating UUID: %v", err)
+	if u != nil {
+		p.uuid = u
+		if p.exists() {
+			return nil, fmt.Errorf("a pod with UUID %q already exists", u)
+		}
+	} else {
+		p.uuid, err = types.NewUUID(uuid.New())
+		if err != nil {
+			return nil, fmt.Errorf("error creating UUID: %v", err)
+		}
 	}
 
 	err = os.Mkdir(p.embryoPath(), 0750)
@@ -176,6 +185,13 @@ func newPod() (*pod, error) {
 		return nil, err
 	}
 
+	created := time.Now().Format(time.RFC3339Nano)
+	if err := ioutil.WriteFile(filepath.Join(p.embryoPath(), common.CreatedFilename), []byte(created), 0640); err != nil {
+		p.Close()
+		os.RemoveAll(p.embryoPath())
+		return nil, fmt.Errorf("error writing the creation time of the pod: %v", err)
+	}
+
 	err = p.xToPreparing()
 	if err != nil {
 		return nil, err
@@ -267,20 +283,29 @@ func getPod(uuid *types.UUID) (*pod, error) {
 	p.FileLock = l
 
 	if p.isRunning() {
-		cfd, err := p.Fd()
-		if err != nil {
-			return nil, fmt.Errorf("error acquiring pod %v dir fd: %v", uuid, err)
-		}
-		p.nets, err = netinfo.LoadAt(cfd)
-		// ENOENT is ok -- assume running with --net=host
-		if err != nil && !os.IsNotExist(err) {
-			return nil, fmt.Errorf("error opening pod %v netinfo: %v", uuid, err)
+		if err := p.loadNets(); err != nil {
+			return nil, err
 		}
 	}
 
 	return p, nil
 }
 
+// loadNets loads the networks of the pod, written by stage1 when the pod
+// started, in p.nets. They stay in the pod's directory after it exited.
+func (p *pod) loadNets() error {
+	cfd, err := p.Fd()
+	if err != nil {
+		return fmt.Errorf("error acquiring pod %v dir fd: %v", p.uuid, err)
+	}
+	p.nets, err = netinfo.LoadAt(cfd)
+	// ENOENT is ok -- assume running with --net=host
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error opening pod %v netinfo: %v", p.uuid, err)
+	}
+	return nil
+}
+
 // getPodFromUUIDString attempts to resolve the supplied UUID and return a pod.
 // The pod must be closed using pod.Close()
 func getPodFromUUIDString(uuid string) (*pod, error) {
@@ -316,6 +341,24 @@ func (p *pod) path() string {
 	return p.runPath()
 }
 
+// exists returns whether the directory of the pod exists in any of the
+// states.
+func (p *pod) exists() bool {
+	for _, path := range []string{
+		p.embryoPath(),
+		p.preparePath(),
+		p.preparedPath(),
+		p.runPath(),
+		p.exitedGarbagePath(),
+		p.garbagePath(),
+	} {
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
 // embryoPath returns the path to the pod where it would be in the embryoDir in its embryonic state.
 func (p *pod) embryoPath() string {
 	return filepath.Join(embryoDir(), p.uuid.String())
@@ -874,6 +917,32 @@ func (p *pod) getStage1TreeStoreID() (string, error) {
 	return string(s1IDb), nil
 }
 
+// getStage1Hash returns the image ID of the stage1 image of the pod, nil
+// if the pod was prepared before it was recorded.
+func (p *pod) getStage1Hash() (*types.Hash, error) {
+	s1IDb, err := p.readFile(common.Stage1ImageIDFilename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return types.NewHash(string(s1IDb))
+}
+
+// getPreparedExpiration returns how long the pod stays prepared before
+// being garbage collected, 0 if it was prepared without one.
+func (p *pod) getPreparedExpiration() (time.Duration, error) {
+	b, err := p.readFile(common.PreparedExpirationFilename)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return time.ParseDuration(string(b))
+}
+
 // getAppTreeStoreIDs returns the treeStoreIDs of the apps images used in
 // this pod
 func (p *pod) getAppsTreeStoreIDs() ([]string, error) {
@@ -992,6 +1061,16 @@ func (p *pod) usesOverlay() bool {
 	return err == nil
 }
 
+// getNoOverlayReason returns why the pod was not prepared with overlayfs, or
+// an empty string if it is unknown.
+func (p *pod) getNoOverlayReason() string {
+	reason, err := p.readFile(common.OverlayDisabledFilename)
+	if err != nil {
+		return ""
+	}
+	return string(reason)
+}
+
 func (p *pod) getStatusDir() (string, error) {
 	if p.usesOverlay() {
 		// the pod uses overlay. Since the mount is in another mount
@@ -1010,6 +1089,48 @@ func (p *pod) getStatusDir() (string, error) {
 	return regularStatusDir, nil
 }
 
+// getHealthDir returns the path, relative to the pod's directory, of the
+// health statuses written by the health checks of the apps.
+func (p *pod) getHealthDir() (string, error) {
+	if p.usesOverlay() {
+		stage1TreeStoreID, err := p.getStage1TreeStoreID()
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf(overlayHealthDirTemplate, stage1TreeStoreID), nil
+	}
+
+	return regularHealthDir, nil
+}
+
+// getJournalDir returns the path, relative to the pod's directory, of the
+// journal written by the pod's systemd-journald.
+func (p *pod) getJournalDir() (string, error) {
+	if p.usesOverlay() {
+		stage1TreeStoreID, err := p.getStage1TreeStoreID()
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf(overlayJournalDirTemplate, stage1TreeStoreID), nil
+	}
+
+	return regularJournalDir, nil
+}
+
+// getLogsDir returns the path, relative to the pod's directory, of the log
+// files written by the apps run with --log-files.
+func (p *pod) getLogsDir() (string, error) {
+	if p.usesOverlay() {
+		stage1TreeStoreID, err := p.getStage1TreeStoreID()
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf(overlayLogsDirTemplate, stage1TreeStoreID), nil
+	}
+
+	return regularLogsDir, nil
+}
+
 // getExitStatuses returns a map of the statuses of the pod.
 func (p *pod) getExitStatuses() (map[string]int, error) {
 	statusDir, err := p.getStatusDir()
@@ -1033,6 +1154,234 @@ func (p *pod) getExitStatuses() (map[string]int, error) {
 	return stats, nil
 }
 
+// getHealthStatuses returns a map of the health statuses of the apps of the
+// pod which have a health check, "healthy" or "unhealthy".
+func (p *pod) getHealthStatuses() (map[string]string, error) {
+	healthDir, err := p.getHealthDir()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get health directory: %v", err)
+	}
+	// the directory is created by the first health check
+	if _, err := os.Stat(filepath.Join(p.path(), healthDir)); os.IsNotExist(err) {
+		return nil, nil
+	}
+	ls, err := p.getDirNames(healthDir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read health directory: %v", err)
+	}
+
+	health := make(map[string]string)
+	for _, name := range ls {
+		// hidden files hold the state of the health checks
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		buf, err := p.readFile(filepath.Join(healthDir, name))
+		if err != nil {
+			stderr("Unable to get health of app %q: %v", name, err)
+			continue
+		}
+		health[name] = strings.TrimSpace(string(buf))
+	}
+	return health, nil
+}
+
+// appState is the state of an app of a pod, as recorded by stage1 when the
+// app is created, started and exits.
+type appState struct {
+	State    string // created, running or exited
+	Created  time.Time
+	Started  time.Time
+	Exited   time.Time
+	ExitCode *int // nil unless the app exited
+	Restarts int  // number of times the app was started again
+}
+
+// parseAppState parses the state of an app written by stage1, as lines of
+// the form KEY=VALUE with the times as Unix timestamps. Empty values are
+// unknown or do not apply to the state of the app.
+func parseAppState(b []byte) (*appState, error) {
+	st := &appState{}
+	for _, line := range strings.Split(string(b), "\n") {
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			continue
+		}
+		var err error
+		switch kv[0] {
+		case "state":
+			st.State = kv[1]
+		case "created":
+			st.Created, err = parseUnixTime(kv[1])
+		case "started":
+			st.Started, err = parseUnixTime(kv[1])
+		case "exited":
+			st.Exited, err = parseUnixTime(kv[1])
+		case "exit_code":
+			var code int
+			code, err = strconv.Atoi(kv[1])
+			st.ExitCode = &code
+		case "restarts":
+			st.Restarts, err = strconv.Atoi(kv[1])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s in app state: %v", kv[0], err)
+		}
+	}
+	return st, nil
+}
+
+func parseUnixTime(s string) (time.Time, error) {
+	sec, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(sec, 0), nil
+}
+
+// getAppStateDir returns the path, relative to the pod's directory, of the
+// states of the apps written by stage1.
+func (p *pod) getAppStateDir() (string, error) {
+	if p.usesOverlay() {
+		stage1TreeStoreID, err := p.getStage1TreeStoreID()
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf(overlayAppStateDirTemplate, stage1TreeStoreID), nil
+	}
+
+	return regularAppStateDir, nil
+}
+
+// isTimedOut returns whether stage1 stopped the apps of the pod because it
+// exceeded its timeout.
+func (p *pod) isTimedOut() (bool, error) {
+	timedOutPath := regularTimedOutPath
+	if p.usesOverlay() {
+		stage1TreeStoreID, err := p.getStage1TreeStoreID()
+		if err != nil {
+			return false, err
+		}
+		timedOutPath = fmt.Sprintf(overlayTimedOutTemplate, stage1TreeStoreID)
+	}
+
+	_, err := os.Stat(filepath.Join(p.path(), timedOutPath))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// getCgroups returns the cgroups and systemd units of the pod and its apps,
+// nil if stage1 did not record them.
+func (p *pod) getCgroups() (*common.PodCgroups, error) {
+	if _, err := os.Stat(filepath.Join(p.path(), common.PodCgroupsFilename)); os.IsNotExist(err) {
+		return nil, nil
+	}
+	b, err := p.readFile(common.PodCgroupsFilename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the pod cgroups: %v", err)
+	}
+	var pc common.PodCgroups
+	if err := json.Unmarshal(b, &pc); err != nil {
+		return nil, fmt.Errorf("unable to parse the pod cgroups: %v", err)
+	}
+	return &pc, nil
+}
+
+// getAppStates returns a map of the states of the apps of the pod. It is
+// empty for the stage1s not recording them, like the fly one.
+func (p *pod) getAppStates() (map[string]*appState, error) {
+	stateDir, err := p.getAppStateDir()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get app state directory: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(p.path(), stateDir)); os.IsNotExist(err) {
+		return nil, nil
+	}
+	ls, err := p.getDirNames(stateDir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read app state directory: %v", err)
+	}
+
+	states := make(map[string]*appState)
+	for _, name := range ls {
+		buf, err := p.readFile(filepath.Join(stateDir, name))
+		if err != nil {
+			stderr("Unable to get state of app %q: %v", name, err)
+			continue
+		}
+		st, err := parseAppState(buf)
+		if err != nil {
+			stderr("Unable to get state of app %q: %v", name, err)
+			continue
+		}
+		states[name] = st
+	}
+	return states, nil
+}
+
+// readTimeFromFile reads a time written in the RFC3339Nano format in a file
+// of the pod's directory. It returns the zero time if the file does not
+// exist.
+func (p *pod) readTimeFromFile(path string) (time.Time, error) {
+	buf, err := p.readFile(path)
+	if os.IsNotExist(err) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339Nano, strings.TrimSpace(string(buf)))
+}
+
+// getCreationTime returns when the pod was created, or the zero time if it
+// was created by a version of rkt not recording it.
+func (p *pod) getCreationTime() (time.Time, error) {
+	return p.readTimeFromFile(common.CreatedFilename)
+}
+
+// getStartTime returns when stage0 started the pod, or the zero time if the
+// pod never ran.
+func (p *pod) getStartTime() (time.Time, error) {
+	return p.readTimeFromFile(common.StartedFilename)
+}
+
+// getExitTime returns when the pod exited, that is the modification time of
+// the last exit status written by stage1, or the zero time if the pod did
+// not exit.
+func (p *pod) getExitTime() (time.Time, error) {
+	var exited time.Time
+	if !p.isExited {
+		return exited, nil
+	}
+
+	statusDir, err := p.getStatusDir()
+	if err != nil {
+		return exited, fmt.Errorf("unable to get status directory: %v", err)
+	}
+	ls, err := ioutil.ReadDir(filepath.Join(p.path(), statusDir))
+	if os.IsNotExist(err) {
+		return exited, nil
+	}
+	if err != nil {
+		return exited, fmt.Errorf("unable to read status directory: %v", err)
+	}
+	for _, fi := range ls {
+		if fi.ModTime().After(exited) {
+			exited = fi.ModTime()
+		}
+	}
+	return exited, nil
+}
+
+// isPaused returns whether the pod was paused by 'rkt pause' and not resumed
+// since.
+func (p *pod) isPaused() bool {
+	_, err := os.Stat(filepath.Join(p.path(), common.PausedFilename))
+	return err == nil
+}
+
 // sync syncs the pod data. By now it calls a syncfs on the filesystem
 // containing the pod's directory.
 func (p *pod) sync() error {
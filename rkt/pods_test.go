@@ -18,7 +18,9 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/coreos/rkt/pkg/lock"
 )
@@ -195,3 +197,109 @@ func TestWalkPods(t *testing.T) {
 	}
 
 }
+
+func TestPodTimes(t *testing.T) {
+	d, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating tmpdir: %v", err)
+	}
+	defer os.RemoveAll(d)
+	globalFlags.Dir = d
+	podsInitialized = false
+
+	before := time.Now()
+	p, err := newPod(nil)
+	if err != nil {
+		t.Fatalf("error creating pod: %v", err)
+	}
+	defer p.Close()
+
+	created, err := p.getCreationTime()
+	if err != nil {
+		t.Fatalf("unexpected error getting the creation time: %v", err)
+	}
+	if created.Before(before) || created.After(time.Now()) {
+		t.Errorf("unexpected creation time %v", created)
+	}
+	started, err := p.getStartTime()
+	if err != nil {
+		t.Fatalf("unexpected error getting the start time: %v", err)
+	}
+	if !started.IsZero() {
+		t.Errorf("expected no start time for a pod being prepared, got %v", started)
+	}
+
+	// an exited pod, with the exit statuses of two apps
+	uuid := "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa"
+	statusDir := filepath.Join(runDir(), uuid, regularStatusDir)
+	if err := os.MkdirAll(statusDir, 0700); err != nil {
+		t.Fatalf("error creating status directory: %v", err)
+	}
+	exited := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i, app := range []string{"app1", "app2"} {
+		path := filepath.Join(statusDir, app)
+		if err := ioutil.WriteFile(path, []byte("0"), 0600); err != nil {
+			t.Fatalf("error writing exit status: %v", err)
+		}
+		mtime := exited.Add(time.Duration(i-1) * time.Minute)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatalf("error changing the times of the exit status: %v", err)
+		}
+	}
+
+	ep, err := getPodFromUUIDString(uuid)
+	if err != nil {
+		t.Fatalf("error getting pod: %v", err)
+	}
+	defer ep.Close()
+	got, err := ep.getExitTime()
+	if err != nil {
+		t.Fatalf("unexpected error getting the exit time: %v", err)
+	}
+	if !got.Equal(exited) {
+		t.Errorf("expected exit time %v, got %v", exited, got)
+	}
+}
+
+func TestParseAppState(t *testing.T) {
+	zero := 0
+	failed := 3
+	tests := []struct {
+		in       string
+		expected *appState
+		werr     bool
+	}{
+		{
+			"state=created\ncreated=1451703845\nrestarts=0\n",
+			&appState{State: "created", Created: time.Unix(1451703845, 0)},
+			false,
+		},
+		{
+			"state=running\ncreated=1451703845\nstarted=1451703846\nexited=\nexit_code=\nrestarts=2\n",
+			&appState{State: "running", Created: time.Unix(1451703845, 0), Started: time.Unix(1451703846, 0), Restarts: 2},
+			false,
+		},
+		{
+			"state=exited\ncreated=1451703845\nstarted=1451703846\nexited=1451703900\nexit_code=3\nrestarts=0\n",
+			&appState{State: "exited", Created: time.Unix(1451703845, 0), Started: time.Unix(1451703846, 0), Exited: time.Unix(1451703900, 0), ExitCode: &failed},
+			false,
+		},
+		{
+			"state=exited\nexit_code=0\n",
+			&appState{State: "exited", ExitCode: &zero},
+			false,
+		},
+		{"state=running\nstarted=yesterday\n", nil, true},
+		{"restarts=many\n", nil, true},
+	}
+
+	for i, tt := range tests {
+		st, err := parseAppState([]byte(tt.in))
+		if gerr := (err != nil); gerr != tt.werr {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.werr)
+		}
+		if !reflect.DeepEqual(st, tt.expected) {
+			t.Errorf("#%d: got %+v, want %+v", i, st, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/pflag"
+	"github.com/coreos/rkt/common/podtemplate"
+)
+
+var flagPodManifestVars templateVarMap
+
+// templateVarMap implements the flag.Value interface to contain the
+// variables of a pod manifest template, given as NAME=VALUE pairs
+type templateVarMap map[string]string
+
+func (m *templateVarMap) Set(s string) error {
+	name, value, err := podtemplate.ParseVar(s)
+	if err != nil {
+		return err
+	}
+	if *m == nil {
+		*m = make(templateVarMap)
+	}
+	if _, exists := (*m)[name]; exists {
+		return fmt.Errorf("%q already set", name)
+	}
+	(*m)[name] = value
+	return nil
+}
+
+func (m *templateVarMap) String() string {
+	var kvs []string
+	for name, value := range *m {
+		kvs = append(kvs, name+"="+value)
+	}
+	sort.Strings(kvs)
+	return strings.Join(kvs, ",")
+}
+
+func (m *templateVarMap) Type() string {
+	return "templateVarMap"
+}
+
+// addPodManifestVarFlag adds the flag setting the variables of the pod
+// manifest given with --pod-manifest, which is then rendered as a template.
+func addPodManifestVarFlag(flags *pflag.FlagSet) {
+	flags.Var(&flagPodManifestVars, "set", "variable of the pod manifest template given with --pod-manifest, in the form NAME=VALUE")
+}
@@ -0,0 +1,179 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/coreos/ioprogress"
+)
+
+// readPrefetchList returns the images listed in a prefetch list, one per
+// line. Blank lines and lines starting with # are ignored.
+func readPrefetchList(r io.Reader) ([]string, error) {
+	var images []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.ContainsAny(line, " \t") {
+			return nil, fmt.Errorf("invalid line %q, must be a single image", line)
+		}
+		images = append(images, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// prefetchProgress is a progress bar shared by the images fetched
+// concurrently, replacing the progress bar of each download.
+type prefetchProgress struct {
+	total int64
+	done  int64 // updated atomically
+	bytes int64 // updated atomically
+}
+
+// countingReader adds the bytes read to the downloaded bytes of a
+// prefetchProgress.
+type countingReader struct {
+	io.Reader
+	p *prefetchProgress
+}
+
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	atomic.AddInt64(&r.p.bytes, int64(n))
+	return n, err
+}
+
+// reader returns a reader reporting the bytes read from r to the progress
+// bar.
+func (p *prefetchProgress) reader(r io.Reader) io.Reader {
+	return &countingReader{Reader: r, p: p}
+}
+
+// imageDone counts an image as fetched.
+func (p *prefetchProgress) imageDone() {
+	atomic.AddInt64(&p.done, 1)
+}
+
+// draw draws the progress bar on w every interval until stop is closed.
+func (p *prefetchProgress) draw(w io.Writer, interval time.Duration, stop <-chan struct{}) {
+	prefix := "Fetching images"
+	fmtBytesSize := 24
+	barSize := int64(80 - len(prefix) - fmtBytesSize)
+	bar := ioprogress.DrawTextFormatBarForW(barSize, w)
+	draw := ioprogress.DrawTerminalf(w, func(done, total int64) string {
+		return fmt.Sprintf(
+			"%s: %s %d/%d, %s",
+			prefix,
+			bar(done, total),
+			done,
+			total,
+			ioprogress.ByteUnitStr(atomic.LoadInt64(&p.bytes)),
+		)
+	})
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		draw(atomic.LoadInt64(&p.done), p.total)
+		select {
+		case <-ticker.C:
+		case <-stop:
+			draw(atomic.LoadInt64(&p.done), p.total)
+			draw(-1, -1)
+			return
+		}
+	}
+}
+
+// prefetchImages fetches the images with up to jobs fetchers at the same
+// time, each fetcher opening its own store, and returns their hashes in the
+// order of the images. The downloads share a progress bar drawn on stderr.
+func prefetchImages(newFetcher func() (*fetcher, error), images []string, jobs int) ([]string, error) {
+	if jobs < 1 {
+		return nil, fmt.Errorf("invalid number of jobs %d", jobs)
+	}
+	if jobs > len(images) {
+		jobs = len(images)
+	}
+
+	progress := &prefetchProgress{total: int64(len(images))}
+	stop := make(chan struct{})
+	drawn := make(chan struct{})
+	go func() {
+		progress.draw(os.Stderr, time.Second, stop)
+		close(drawn)
+	}()
+
+	var (
+		hashes = make([]string, len(images))
+		errs   = make([]error, len(images))
+		next   = make(chan int)
+		wg     sync.WaitGroup
+	)
+	for j := 0; j < jobs; j++ {
+		ft, err := newFetcher()
+		if err != nil {
+			close(next)
+			wg.Wait()
+			close(stop)
+			<-drawn
+			return nil, err
+		}
+		ft.progress = progress
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer ft.s.Close()
+			for i := range next {
+				hashes[i], errs[i] = ft.fetchImage(images[i], "")
+				progress.imageDone()
+			}
+		}()
+	}
+	for i := range images {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	close(stop)
+	<-drawn
+
+	var failed []string
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", images[i], err))
+		}
+	}
+	if len(failed) > 0 {
+		return nil, fmt.Errorf("failed to fetch %d of %d images:\n%s", len(failed), len(images), strings.Join(failed, "\n"))
+	}
+	return hashes, nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadPrefetchList(t *testing.T) {
+	tests := []struct {
+		in     string
+		images []string
+		err    bool
+	}{
+		{
+			in:     "",
+			images: nil,
+		},
+		{
+			in:     "coreos.com/etcd:v2.0.0\n\n# the proxy\n  docker://nginx  \nhttps://example.com/app.aci\n",
+			images: []string{"coreos.com/etcd:v2.0.0", "docker://nginx", "https://example.com/app.aci"},
+		},
+		{
+			in:  "coreos.com/etcd:v2.0.0 --signature=etcd.asc\n",
+			err: true,
+		},
+	}
+
+	for i, tt := range tests {
+		images, err := readPrefetchList(strings.NewReader(tt.in))
+		if (err != nil) != tt.err {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.err)
+			continue
+		}
+		if !reflect.DeepEqual(images, tt.images) {
+			t.Errorf("#%d: got %v, want %v", i, images, tt.images)
+		}
+	}
+}
+
+func TestPrefetchProgressReader(t *testing.T) {
+	p := &prefetchProgress{total: 2}
+	for _, s := range []string{"hello", "world!"} {
+		if _, err := ioutil.ReadAll(p.reader(bytes.NewBufferString(s))); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		p.imageDone()
+	}
+	if p.bytes != 11 || p.done != 2 {
+		t.Errorf("got %d bytes and %d images, want 11 bytes and 2 images", p.bytes, p.done)
+	}
+}
@@ -18,14 +18,15 @@ package main
 
 import (
 	"os"
+	"time"
 
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/cobra"
 	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/common/timing"
 	"github.com/coreos/rkt/pkg/lock"
 	"github.com/coreos/rkt/pkg/uid"
 	"github.com/coreos/rkt/stage0"
-	"github.com/coreos/rkt/store"
 )
 
 var (
@@ -40,27 +41,56 @@ which will instead be appended to the preceding image app's exec arguments.
 End the image arguments with a lone "---" to resume argument parsing.`,
 		Run: runWrapper(runPrepare),
 	}
-	flagQuiet bool
+	flagQuiet          bool
+	flagExpirePrepared time.Duration
 )
 
 func init() {
 	cmdRkt.AddCommand(cmdPrepare)
 
 	addStage1ImageFlag(cmdPrepare.Flags())
+	addVMFlags(cmdPrepare.Flags())
+	addMachineFlags(cmdPrepare.Flags())
+	addDeviceFlag(cmdPrepare.Flags())
+	addGPUFlag(cmdPrepare.Flags())
+	addMemoryFlags(cmdPrepare.Flags())
+	addLocalizationFlags(cmdPrepare.Flags())
+	addTimeoutFlag(cmdPrepare.Flags())
+	addJournalFlags(cmdPrepare.Flags())
+	addLogFilesFlags(cmdPrepare.Flags())
+	addLogDriverFlags(cmdPrepare.Flags())
+	addUserAnnotationFlags(cmdPrepare.Flags())
+	addCNIFlags(cmdPrepare.Flags())
 	cmdPrepare.Flags().Var(&flagPorts, "port", "ports to expose on the host (needs contained networking with NAT)")
+	cmdPrepare.Flags().DurationVar(&flagExpirePrepared, "expire-prepared", 0, "duration after which rkt gc removes the pod if it has not been run, instead of the --expire-prepared of rkt gc")
 	cmdPrepare.Flags().BoolVar(&flagQuiet, "quiet", false, "suppress superfluous output on stdout, print only the UUID on success")
 	cmdPrepare.Flags().BoolVar(&flagInheritEnv, "inherit-env", false, "inherit all environment variables not set by apps")
-	cmdPrepare.Flags().BoolVar(&flagNoOverlay, "no-overlay", false, "disable overlay filesystem")
+	cmdPrepare.Flags().BoolVar(&flagNoOverlay, "no-overlay", false, "disable overlay filesystem, overriding the configuration")
+	cmdPrepare.Flags().BoolVar(&flagAuditJournal, "audit-journal", false, "send the audit events of the pod to the systemd journal, in addition to its audit log")
 	cmdPrepare.Flags().BoolVar(&flagPrivateUsers, "private-users", false, "run within user namespaces (experimental).")
 	cmdPrepare.Flags().Var(&flagExplicitEnv, "set-env", "an environment variable to set for apps in the form name=value")
-	cmdPrepare.Flags().BoolVar(&flagStoreOnly, "store-only", false, "use only available images in the store (do not discover or download from remote URLs)")
-	cmdPrepare.Flags().BoolVar(&flagNoStore, "no-store", false, "fetch images ignoring the local store")
-	cmdPrepare.Flags().StringVar(&flagPodManifest, "pod-manifest", "", "the path to the pod manifest. If it's non-empty, then only '--quiet' and '--no-overlay' will have effects")
+	addPullPolicyFlag(cmdPrepare.Flags())
+	addArchFlag(cmdPrepare.Flags())
+	addQemuUserFlag(cmdPrepare.Flags())
+	cmdPrepare.Flags().StringVar(&flagUUIDFileSave, "uuid-file-save", "", "write out pod UUID to specified file")
+	cmdPrepare.Flags().StringVar(&flagPodUUID, "uuid", "", "UUID of the pod, instead of a random one. It must be a version 4 UUID, not used by another pod")
+	cmdPrepare.Flags().StringVar(&flagPodManifest, "pod-manifest", "", "the path to the pod manifest. If it's non-empty, then only '--quiet', '--no-overlay' and '--expire-prepared' will have effects")
+	addPodManifestVarFlag(cmdPrepare.Flags())
 	cmdPrepare.Flags().Var((*appsVolume)(&rktApps), "volume", "volumes to make available in the pod")
+	cmdPrepare.Flags().Var((*appsSecret)(&rktApps), "secret", "secret to write on a tmpfs of the pod and mount read-only in the apps, in the form NAME,source=file:PATH|env:VAR[,target=PATH][,mode=MODE][,uid=UID][,gid=GID]")
 
 	// per-app flags
 	cmdPrepare.Flags().Var((*appExec)(&rktApps), "exec", "override the exec command for the preceding image")
 	cmdPrepare.Flags().Var((*appMount)(&rktApps), "mount", "mount point binding a volume to a path within an app")
+	cmdPrepare.Flags().Var((*appUlimit)(&rktApps), "ulimit", "resource limit of the preceding image, or of all the apps if no image precedes it, in the form RESOURCE=SOFT[:HARD]")
+	cmdPrepare.Flags().Var((*appIOLimit)(&rktApps), "io-limit", "disk IO limit of the preceding image, or of all the apps if no image precedes it, in the form DEVICE:KEY=VALUE[,KEY=VALUE...] with the keys read-bps, write-bps, read-iops and write-iops")
+	cmdPrepare.Flags().Var((*appReadOnlyRootFS)(&rktApps), "readonly-rootfs", "mount the rootfs of the preceding image read-only")
+	cmdPrepare.Flags().Var((*appSeccomp)(&rktApps), "seccomp", "seccomp profile file of the preceding image, in the docker format")
+	cmdPrepare.Flags().Var((*appAppArmor)(&rktApps), "apparmor", "name of the AppArmor profile confining the preceding image")
+	cmdPrepare.Flags().Lookup("readonly-rootfs").NoOptDefVal = "true"
+	addAppHardeningFlags(cmdPrepare.Flags())
+	addAppOneShotFlag(cmdPrepare.Flags())
+	addMountProfileFlag(cmdPrepare.Flags())
 
 	// Disable interspersed flags to stop parsing after the first non flag
 	// argument. This is need to permit to correctly handle
@@ -69,6 +99,11 @@ func init() {
 }
 
 func runPrepare(cmd *cobra.Command, args []string) (exit int) {
+	if err := applyConfigDefaults(cmd.Flags(), stage1ImageFlagName, "insecure-options", "expire-prepared"); err != nil {
+		stderr("prepare: %v", err)
+		return 1
+	}
+
 	var err error
 	origStdout := os.Stdout
 	privateUsers := uid.NewBlankUidRange()
@@ -79,8 +114,14 @@ func runPrepare(cmd *cobra.Command, args []string) (exit int) {
 		}
 	}
 
-	if flagStoreOnly && flagNoStore {
-		stderr("both --store-only and --no-store specified")
+	policy, err := getPullPolicy(cmd.Flags())
+	if err != nil {
+		stderr("prepare: %v", err)
+		return 1
+	}
+
+	if flagExpirePrepared < 0 {
+		stderr("prepare: --expire-prepared must not be negative")
 		return 1
 	}
 
@@ -97,17 +138,63 @@ func runPrepare(cmd *cobra.Command, args []string) (exit int) {
 		return 1
 	}
 
-	if len(flagPodManifest) > 0 && (len(flagPorts) > 0 || flagInheritEnv || !flagExplicitEnv.IsEmpty() || flagStoreOnly || flagNoStore) {
+	if flagPrivateUsers && len(rktApps.NetworkVolumes) > 0 {
+		stderr("prepare: nfs and cifs volumes cannot be mounted with --private-users")
+		return 1
+	}
+
+	if flagMachineName != "" {
+		if err := validateMachineName(flagMachineName); err != nil {
+			stderr("prepare: %v", err)
+			return 1
+		}
+	}
+
+	if err := validateTimeoutFlag(); err != nil {
+		stderr("prepare: %v", err)
+		return 1
+	}
+	if err := validateLocalizationFlags(); err != nil {
+		stderr("prepare: %v", err)
+		return 1
+	}
+	if err := validateMemoryFlags(); err != nil {
+		stderr("prepare: %v", err)
+		return 1
+	}
+	if err := validateJournalFlags(); err != nil {
+		stderr("prepare: %v", err)
+		return 1
+	}
+	if err := validateLogFilesFlags(); err != nil {
+		stderr("prepare: %v", err)
+		return 1
+	}
+	if err := validateLogDriverFlags(); err != nil {
+		stderr("prepare: %v", err)
+		return 1
+	}
+	if err := validateMountProfileFlag(); err != nil {
+		stderr("prepare: %v", err)
+		return 1
+	}
+
+	if len(flagPodManifest) > 0 && (len(flagPorts) > 0 || flagInheritEnv || !flagExplicitEnv.IsEmpty() || cmd.Flags().Lookup("pull-policy").Changed || flagStoreOnly || flagNoStore || vmFlagsSet() || machineFlagsSet() || len(flagDevices) > 0 || gpuFlagSet() || memoryFlagsSet() || localizationFlagsSet() || flagTimeout != "" || journalFlagsSet() || logFilesFlagsSet() || logDriverFlagsSet() || userAnnotationFlagsSet() || cniFlagsSet() || len(rktApps.Secrets) > 0 || len(flagMountProfiles) > 0 || len(rktApps.IOLimits) > 0 || len(rktApps.Rlimits) > 0) {
 		stderr("prepare: conflicting flags set with --pod-manifest (see --help)")
 		return 1
 	}
 
+	if len(flagPodManifestVars) > 0 && len(flagPodManifest) == 0 {
+		stderr("prepare: --set requires --pod-manifest")
+		return 1
+	}
+
 	if rktApps.Count() < 1 && len(flagPodManifest) == 0 {
 		stderr("prepare: must provide at least one image or specify the pod manifest")
 		return 1
 	}
 
-	s, err := store.NewStore(globalFlags.Dir)
+	s, err := newStore()
 	if err != nil {
 		stderr("prepare: cannot open store: %v", err)
 		return 1
@@ -123,15 +210,18 @@ func runPrepare(cmd *cobra.Command, args []string) (exit int) {
 			s:                  s,
 			headers:            config.AuthPerHost,
 			dockerAuth:         config.DockerCredentialsPerRegistry,
+			dockerHelpers:      config.DockerCredentialHelpers,
+			archFallbacks:      config.ArchFallbacks,
 			insecureSkipVerify: globalFlags.InsecureSkipVerify,
 			debug:              globalFlags.Debug,
 		},
-		storeOnly: flagStoreOnly,
-		noStore:   flagNoStore,
+		storeOnly: policy.storeOnly(),
+		noStore:   policy.noStore(),
+		noCache:   policy.noCache(),
 		withDeps:  false,
 	}
 
-	s1img, err := getStage1Hash(s, cmd)
+	s1img, err := getStage1Hash(s, cmd, policy)
 	if err != nil {
 		stderr("prepare: %v", err)
 		return 1
@@ -139,37 +229,89 @@ func runPrepare(cmd *cobra.Command, args []string) (exit int) {
 
 	fn.ks = getKeystore()
 	fn.withDeps = true
+	timings := timing.NewRecorder()
+	endResolve := timings.Start(timing.SpanResolveImages, nil)
 	if err := fn.findImages(&rktApps); err != nil {
 		stderr("prepare: %v", err)
 		return 1
 	}
+	endResolve()
 
-	p, err := newPod()
+	if err := checkDevicesStage1(s, *s1img); err != nil {
+		stderr("prepare: %v", err)
+		return 1
+	}
+
+	podUUID, err := getNewPodUUID()
+	if err != nil {
+		stderr("prepare: %v", err)
+		return 1
+	}
+	p, err := newPod(podUUID)
 	if err != nil {
 		stderr("prepare: error creating new pod: %v", err)
 		return 1
 	}
 
+	// if requested, write out pod UUID early so "rkt rm" can
+	// clean it up even if something goes wrong
+	if flagUUIDFileSave != "" {
+		if err := writeUUIDToFile(p.uuid, flagUUIDFileSave); err != nil {
+			stderr("prepare: error saving pod UUID to file: %v", err)
+			return 1
+		}
+	}
+
+	processLabel, mountLabel, err := allocatePodLabels(s, p.uuid)
+	if err != nil {
+		stderr("prepare: error initialising SELinux: %v", err)
+		return 1
+	}
+
 	cfg := stage0.CommonConfig{
-		Store:       s,
-		Stage1Image: *s1img,
-		UUID:        p.uuid,
-		Debug:       globalFlags.Debug,
+		MountLabel:    mountLabel,
+		ProcessLabel:  processLabel,
+		Store:         s,
+		Stage1Image:   *s1img,
+		UUID:          p.uuid,
+		Debug:         globalFlags.Debug,
+		Timings:       timings,
+		Stage1Digests: config.Stage1Digests,
 	}
 
+	overlay, noOverlayReason := useOverlay(cmd.Flags(), config.OverlayMode)
 	pcfg := stage0.PrepareConfig{
-		CommonConfig: cfg,
-		UseOverlay:   !flagNoOverlay && common.SupportsOverlay(),
-		PrivateUsers: privateUsers,
+		CommonConfig:    cfg,
+		UseOverlay:      overlay,
+		NoOverlayReason: noOverlayReason,
+		PrivateUsers:    privateUsers,
+		AuditJournal:    flagAuditJournal,
+		QemuUser:        flagQemuUser,
+		VolumeDrivers:   config.VolumeDrivers,
+		Expiration:      flagExpirePrepared,
 	}
 
 	if len(flagPodManifest) > 0 {
 		pcfg.PodManifest = flagPodManifest
+		pcfg.PodManifestVars = flagPodManifestVars
 	} else {
 		pcfg.Ports = []types.ExposedPort(flagPorts)
 		pcfg.InheritEnv = flagInheritEnv
 		pcfg.ExplicitEnv = flagExplicitEnv.Strings()
+		// no DNS flag, the apps get the resolv.conf of the profiles
+		addMountProfiles(&rktApps, flagMountProfiles, false)
 		pcfg.Apps = &rktApps
+		pcfg.Annotations = append(vmAnnotations(), machineAnnotations()...)
+		pcfg.Annotations = append(pcfg.Annotations, deviceAnnotations()...)
+		pcfg.Annotations = append(pcfg.Annotations, gpuAnnotations()...)
+		pcfg.Annotations = append(pcfg.Annotations, memoryAnnotations()...)
+		pcfg.Annotations = append(pcfg.Annotations, localizationAnnotations()...)
+		pcfg.Annotations = append(pcfg.Annotations, timeoutAnnotations()...)
+		pcfg.Annotations = append(pcfg.Annotations, journalAnnotations()...)
+		pcfg.Annotations = append(pcfg.Annotations, logFilesAnnotations()...)
+		pcfg.Annotations = append(pcfg.Annotations, logDriverAnnotations()...)
+		pcfg.Annotations = append(pcfg.Annotations, userAnnotations()...)
+		pcfg.Annotations = append(pcfg.Annotations, cniAnnotations()...)
 	}
 
 	if globalFlags.Debug {
@@ -188,6 +330,11 @@ func runPrepare(cmd *cobra.Command, args []string) (exit int) {
 	}
 	keyLock.Close()
 
+	if err := runHook(config, hookOnPrepare, p); err != nil {
+		stderr("prepare: %v", err)
+		return 1
+	}
+
 	if err := p.sync(); err != nil {
 		stderr("prepare: error syncing pod data: %v", err)
 		return 1
@@ -0,0 +1,110 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/pflag"
+)
+
+// pullPolicy defines when the images are fetched from remote instead of
+// being taken from the local store.
+type pullPolicy string
+
+const (
+	// pullPolicyNever uses only the images in the store
+	pullPolicyNever pullPolicy = "never"
+	// pullPolicyNew fetches the images missing from the store
+	pullPolicyNew pullPolicy = "new"
+	// pullPolicyUpdate fetches the images from remote, unless the
+	// caching headers of the previous download say they are still fresh
+	pullPolicyUpdate pullPolicy = "update"
+	// pullPolicyAlways downloads the images again, ignoring the caching
+	// headers
+	pullPolicyAlways pullPolicy = "always"
+)
+
+var (
+	flagPullPolicy = pullPolicyNew
+	// the deprecated flags, replaced by --pull-policy
+	flagStoreOnly bool
+	flagNoStore   bool
+)
+
+func (p *pullPolicy) Set(s string) error {
+	switch pp := pullPolicy(s); pp {
+	case pullPolicyNever, pullPolicyNew, pullPolicyUpdate, pullPolicyAlways:
+		*p = pp
+		return nil
+	}
+	return fmt.Errorf("unknown pull policy %q, expected one of never, new, update or always", s)
+}
+
+func (p *pullPolicy) String() string {
+	return string(*p)
+}
+
+func (p *pullPolicy) Type() string {
+	return "pullPolicy"
+}
+
+// storeOnly returns whether the images are only taken from the store.
+func (p pullPolicy) storeOnly() bool {
+	return p == pullPolicyNever
+}
+
+// noStore returns whether the images are fetched from remote even when they
+// are in the store.
+func (p pullPolicy) noStore() bool {
+	return p == pullPolicyUpdate || p == pullPolicyAlways
+}
+
+// noCache returns whether the images are downloaded again even when the
+// caching headers of the previous download say they are still fresh.
+func (p pullPolicy) noCache() bool {
+	return p == pullPolicyAlways
+}
+
+// addPullPolicyFlag adds the --pull-policy flag, along with the flags it
+// replaces.
+func addPullPolicyFlag(flags *pflag.FlagSet) {
+	flags.Var(&flagPullPolicy, "pull-policy", `when to fetch the images from remote: "never" uses only the images in the store, "new" fetches the images missing from the store, "update" fetches the images unless the caching headers of the previous download say they are still fresh, "always" downloads them again`)
+	flags.BoolVar(&flagStoreOnly, "store-only", false, "use only available images in the store (do not discover or download from remote URLs)")
+	flags.BoolVar(&flagNoStore, "no-store", false, "fetch images ignoring the local store")
+	flags.MarkDeprecated("store-only", "use --pull-policy=never instead")
+	flags.MarkDeprecated("no-store", "use --pull-policy=update instead")
+}
+
+// getPullPolicy returns the pull policy given with --pull-policy or with the
+// deprecated flags it replaces.
+func getPullPolicy(flags *pflag.FlagSet) (pullPolicy, error) {
+	if flagStoreOnly && flagNoStore {
+		return "", fmt.Errorf("both --store-only and --no-store specified")
+	}
+	deprecated := flagStoreOnly || flagNoStore
+	if deprecated && flags.Lookup("pull-policy").Changed {
+		return "", fmt.Errorf("--pull-policy cannot be used with --store-only or --no-store")
+	}
+	switch {
+	case flagStoreOnly:
+		return pullPolicyNever, nil
+	case flagNoStore:
+		return pullPolicyUpdate, nil
+	}
+	return flagPullPolicy, nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/pflag"
+)
+
+func TestGetPullPolicy(t *testing.T) {
+	tests := []struct {
+		args   []string
+		policy pullPolicy
+		fail   bool
+	}{
+		{nil, pullPolicyNew, false},
+		{[]string{"--pull-policy=never"}, pullPolicyNever, false},
+		{[]string{"--pull-policy=update"}, pullPolicyUpdate, false},
+		{[]string{"--pull-policy=always"}, pullPolicyAlways, false},
+		{[]string{"--pull-policy=sometimes"}, "", true},
+		{[]string{"--store-only"}, pullPolicyNever, false},
+		{[]string{"--no-store"}, pullPolicyUpdate, false},
+		{[]string{"--store-only", "--no-store"}, "", true},
+		{[]string{"--no-store", "--pull-policy=always"}, "", true},
+	}
+	for i, tt := range tests {
+		flagPullPolicy = pullPolicyNew
+		flagStoreOnly = false
+		flagNoStore = false
+		flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+		addPullPolicyFlag(flags)
+		err := flags.Parse(tt.args)
+		var policy pullPolicy
+		if err == nil {
+			policy, err = getPullPolicy(flags)
+		}
+		if tt.fail {
+			if err == nil {
+				t.Errorf("#%d: expected an error, got policy %q", i, policy)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+		} else if policy != tt.policy {
+			t.Errorf("#%d: got policy %q, want %q", i, policy, tt.policy)
+		}
+	}
+	flagPullPolicy = pullPolicyNew
+	flagStoreOnly = false
+	flagNoStore = false
+}
@@ -27,6 +27,7 @@ import (
 	"github.com/coreos/rkt/pkg/keystore"
 	"github.com/coreos/rkt/pkg/multicall"
 	"github.com/coreos/rkt/rkt/config"
+	"github.com/coreos/rkt/store"
 )
 
 const (
@@ -68,6 +69,7 @@ var (
 		Debug              bool
 		Help               bool
 		InsecureSkipVerify bool
+		InsecureOptions    insecureOptions
 		TrustKeysFromHttps bool
 	}{
 		Dir:             defaultDataDir,
@@ -89,6 +91,7 @@ func init() {
 	cmdRkt.PersistentFlags().Var((*absDir)(&globalFlags.SystemConfigDir), "system-config", "system configuration directory")
 	cmdRkt.PersistentFlags().Var((*absDir)(&globalFlags.LocalConfigDir), "local-config", "local configuration directory")
 	cmdRkt.PersistentFlags().BoolVar(&globalFlags.InsecureSkipVerify, "insecure-skip-verify", false, "skip all TLS, image or fingerprint verification")
+	cmdRkt.PersistentFlags().Var(&globalFlags.InsecureOptions, "insecure-options", fmt.Sprintf("comma-separated list of security checks to skip, among %q, or %q", strings.Join(insecureOptionNames, ", "), insecureAll))
 	cmdRkt.PersistentFlags().BoolVar(&globalFlags.TrustKeysFromHttps, "trust-keys-from-https", true, "automatically trust gpg keys fetched from https")
 }
 
@@ -176,6 +179,24 @@ func getConfig() (*config.Config, error) {
 	return config.GetConfigFrom(globalFlags.SystemConfigDir, globalFlags.LocalConfigDir)
 }
 
+// newStore opens the store, encrypting the images it writes with the
+// configured store encryption key if any.
+func newStore() (*store.Store, error) {
+	s, err := store.NewStore(globalFlags.Dir)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := getConfig()
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("cannot get configuration: %v", err)
+	}
+	if cfg.StoreEncryption != nil {
+		s.EnableEncryption(cfg.StoreEncryption.Key)
+	}
+	return s, nil
+}
+
 func lockDir() string {
 	return filepath.Join(globalFlags.Dir, "locks")
 }
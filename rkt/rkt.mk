@@ -3,10 +3,17 @@ LOCAL_NAME := $(patsubst %.mk,%,$(MK_FILENAME))
 $(call setup-stamp-file,RKT_STAMP)
 
 RKT_BINARY := $(BINDIR)/$(LOCAL_NAME)
+# when the fly flavor is built, its stage1 image is appended to this
+# binary to produce RKT_BINARY, see stage1_fly/stage1_fly.mk
+RKT_BINARY_WITHOUT_FLY := $(BUILDDIR)/$(LOCAL_NAME)-without-fly
 
 # variables for makelib/build_go_bin.mk
 BGB_STAMP := $(RKT_STAMP)
+ifneq ($(filter fly,$(call commas-to-spaces,$(RKT_STAGE1_FLAVORS))),)
+BGB_BINARY := $(RKT_BINARY_WITHOUT_FLY)
+else
 BGB_BINARY := $(RKT_BINARY)
+endif
 BGB_PKG_IN_REPO := $(call go-pkg-from-dir)
 BGB_GO_FLAGS := $(strip -ldflags "$(RKT_STAGE1_DEFAULT_NAME_LDFLAGS) $(RKT_STAGE1_DEFAULT_VERSION_LDFLAGS) $(RKT_STAGE1_DEFAULT_LOCATION_LDFLAGS) $(RKT_VERSION_LDFLAGS)" $(RKT_TAGS))
 
@@ -15,10 +22,11 @@ TOPLEVEL_STAMPS += $(RKT_STAMP)
 
 $(call generate-stamp-rule,$(RKT_STAMP))
 
-$(BGB_BINARY): $(MK_PATH) | $(BINDIR)
+$(BGB_BINARY): $(MK_PATH) | $(BINDIR) $(BUILDDIR)
 
 include makelib/build_go_bin.mk
 
 $(call undefine-namespaces,LOCAL)
 # RKT_STAMP deliberately not cleared
 # RKT_BINARY deliberately not cleared
+# RKT_BINARY_WITHOUT_FLY deliberately not cleared
@@ -18,6 +18,7 @@ package main
 
 import (
 	"os"
+	"time"
 
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/cobra"
@@ -25,16 +26,88 @@ import (
 
 var (
 	cmdRm = &cobra.Command{
-		Use:   "rm [--uuid-file=FILE] UUID ...",
+		Use:   "rm [--uuid-file=FILE] UUID ... | [--all-exited] [--older-than=duration] [--filter=label=NAME=VALUE]...",
 		Short: "Remove all files and resources associated with an exited pod",
-		Run:   runWrapper(runRm),
+		Long: `Without UUIDs, the pods to remove are selected with the filter flags instead.
+They only select exited pods and pods which are prepared or failed to
+prepare, never running pods, and a pod must match all of them.`,
+		Run: runWrapper(runRm),
 	}
-	flagUUIDFile string
+	flagUUIDFile    string
+	flagRmAllExited bool
+	flagRmOlderThan time.Duration
+	flagRmFilter    podKVFilterList
 )
 
 func init() {
 	cmdRkt.AddCommand(cmdRm)
 	cmdRm.Flags().StringVar(&flagUUIDFile, "uuid-file", "", "read pod UUID from file instead of argument")
+	cmdRm.Flags().BoolVar(&flagRmAllExited, "all-exited", false, "remove all the exited pods")
+	cmdRm.Flags().DurationVar(&flagRmOlderThan, "older-than", 0, "remove the pods which exited, or were prepared, longer ago than the given duration")
+	cmdRm.Flags().Var(&flagRmFilter, "filter", "remove the pods with the given user label or annotation, in the form label=NAME=VALUE or annotation=NAME=VALUE. Can be repeated, the pods must match all the filters")
+}
+
+// rmFilter selects the pods removed by rkt rm when no UUID is given.
+type rmFilter struct {
+	allExited bool
+	olderThan time.Duration
+	kvFilters podKVFilterList
+}
+
+// isSet returns whether any of the filters is set.
+func (f *rmFilter) isSet() bool {
+	return f.allExited || f.olderThan > 0 || len(f.kvFilters) > 0
+}
+
+// matches returns whether a removable pod is selected by the filters, given
+// whether it exited, when it exited or else was created, and its
+// annotations. The pods whose time is unknown are never older than a
+// duration.
+func (f *rmFilter) matches(exited bool, since time.Time, annotations types.Annotations, now time.Time) bool {
+	if f.allExited && !exited {
+		return false
+	}
+	if f.olderThan > 0 && (since.IsZero() || now.Sub(since) < f.olderThan) {
+		return false
+	}
+	return f.kvFilters.matches(annotations)
+}
+
+// selectPodsToRemove returns the UUIDs of the exited, prepared and aborted
+// pods selected by the filters.
+func selectPodsToRemove(f *rmFilter) ([]*types.UUID, error) {
+	var uuids []*types.UUID
+	now := time.Now()
+	err := walkPods(includeMostDirs, func(p *pod) {
+		exited := p.isExited || p.isExitedGarbage
+		if !exited && !p.isPrepared && !p.isAbortedPrepare {
+			return
+		}
+
+		var since time.Time
+		var err error
+		if exited {
+			since, err = p.getExitTime()
+		} else {
+			since, err = p.getCreationTime()
+		}
+		if err != nil {
+			stderr("Skipping %q: %v", p.uuid, err)
+			return
+		}
+
+		// a pod which failed to prepare may have no manifest, and so
+		// no user labels or annotations
+		var annotations types.Annotations
+		if pm, err := p.getManifest(); err == nil {
+			annotations = pm.Annotations
+		}
+
+		if f.matches(exited, since, annotations, now) {
+			uuids = append(uuids, p.uuid)
+		}
+	})
+	return uuids, err
 }
 
 func runRm(cmd *cobra.Command, args []string) (exit int) {
@@ -42,8 +115,21 @@ func runRm(cmd *cobra.Command, args []string) (exit int) {
 	var podUUIDs []*types.UUID
 	var err error
 
+	filter := &rmFilter{
+		allExited: flagRmAllExited,
+		olderThan: flagRmOlderThan,
+		kvFilters: flagRmFilter,
+	}
+
 	switch {
-	case len(args) == 0 && flagUUIDFile != "":
+	case len(args) == 0 && flagUUIDFile == "" && filter.isSet():
+		podUUIDs, err = selectPodsToRemove(filter)
+		if err != nil {
+			stderr("Unable to select the pods: %v", err)
+			return 1
+		}
+
+	case len(args) == 0 && flagUUIDFile != "" && !filter.isSet():
 		podUUID, err = readUUIDFromFile(flagUUIDFile)
 		if err != nil {
 			stderr("Unable to read UUID from file: %v", err)
@@ -51,7 +137,7 @@ func runRm(cmd *cobra.Command, args []string) (exit int) {
 		}
 		podUUIDs = append(podUUIDs, podUUID)
 
-	case len(args) > 0 && flagUUIDFile == "":
+	case len(args) > 0 && flagUUIDFile == "" && !filter.isSet():
 		for _, uuid := range args {
 			podUUID, err := resolveUUID(uuid)
 			if err != nil {
@@ -72,6 +158,7 @@ func runRm(cmd *cobra.Command, args []string) (exit int) {
 		if err != nil {
 			ret = 1
 			stderr("Cannot get pod: %v", err)
+			continue
 		}
 
 		if removePod(p) {
@@ -121,6 +208,7 @@ func removePod(p *pod) bool {
 	case p.isExitedGarbage, p.isGarbage:
 
 	case p.isExited:
+		runHookFromConfig(hookOnExit, p)
 		if err := p.xToExitedGarbage(); err != nil && err != os.ErrNotExist {
 			stderr("Rename error: %v", err)
 			return false
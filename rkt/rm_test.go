@@ -0,0 +1,60 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+)
+
+func TestRmFilterMatches(t *testing.T) {
+	now := time.Now()
+	prod := types.Annotations{{Name: common.UserLabelPrefix + "env", Value: "prod"}}
+	envFilter, err := parsePodKVFilter("label=env=prod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		filter      rmFilter
+		exited      bool
+		since       time.Time
+		annotations types.Annotations
+		match       bool
+	}{
+		{rmFilter{allExited: true}, true, now, nil, true},
+		{rmFilter{allExited: true}, false, now, nil, false},
+		{rmFilter{olderThan: time.Hour}, true, now.Add(-2 * time.Hour), nil, true},
+		{rmFilter{olderThan: time.Hour}, false, now.Add(-2 * time.Hour), nil, true},
+		{rmFilter{olderThan: time.Hour}, true, now.Add(-time.Minute), nil, false},
+		// unknown time
+		{rmFilter{olderThan: time.Hour}, true, time.Time{}, nil, false},
+		{rmFilter{kvFilters: podKVFilterList{envFilter}}, true, now, prod, true},
+		{rmFilter{kvFilters: podKVFilterList{envFilter}}, true, now, nil, false},
+		{rmFilter{allExited: true, olderThan: time.Hour, kvFilters: podKVFilterList{envFilter}}, true, now.Add(-2 * time.Hour), prod, true},
+		{rmFilter{allExited: true, olderThan: time.Hour, kvFilters: podKVFilterList{envFilter}}, false, now.Add(-2 * time.Hour), prod, false},
+	}
+
+	for i, tt := range tests {
+		if match := tt.filter.matches(tt.exited, tt.since, tt.annotations, now); match != tt.match {
+			t.Errorf("#%d: got match %t, want %t", i, match, tt.match)
+		}
+	}
+}
@@ -24,11 +24,10 @@ import (
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/cobra"
 	"github.com/coreos/rkt/common"
-	"github.com/coreos/rkt/pkg/label"
+	"github.com/coreos/rkt/common/timing"
 	"github.com/coreos/rkt/pkg/lock"
 	"github.com/coreos/rkt/pkg/uid"
 	"github.com/coreos/rkt/stage0"
-	"github.com/coreos/rkt/store"
 )
 
 var (
@@ -56,36 +55,65 @@ End the image arguments with a lone "---" to resume argument parsing.`,
 	flagExplicitEnv  envMap
 	flagInteractive  bool
 	flagNoOverlay    bool
-	flagStoreOnly    bool
-	flagNoStore      bool
 	flagPodManifest  string
 	flagMDSRegister  bool
 	flagUUIDFileSave string
+	flagPodUUID      string
+	flagAuditJournal bool
+	flagDryRun       bool
 )
 
 func init() {
 	cmdRkt.AddCommand(cmdRun)
 
 	addStage1ImageFlag(cmdRun.Flags())
+	addVMFlags(cmdRun.Flags())
+	addMachineFlags(cmdRun.Flags())
+	addDeviceFlag(cmdRun.Flags())
+	addGPUFlag(cmdRun.Flags())
+	addMemoryFlags(cmdRun.Flags())
+	addLocalizationFlags(cmdRun.Flags())
+	addTimeoutFlag(cmdRun.Flags())
+	addJournalFlags(cmdRun.Flags())
+	addLogFilesFlags(cmdRun.Flags())
+	addLogDriverFlags(cmdRun.Flags())
+	addUserAnnotationFlags(cmdRun.Flags())
+	addCNIFlags(cmdRun.Flags())
+	addTPMFlags(cmdRun.Flags())
 	cmdRun.Flags().Var(&flagPorts, "port", "ports to expose on the host (requires --net)")
 	cmdRun.Flags().Var(&flagNet, "net", "configure the pod's networking and optionally pass a list of user-configured networks to load and arguments to pass to them. syntax: --net[=n[:args], ...]")
 	cmdRun.Flags().Lookup("net").NoOptDefVal = "default"
 	cmdRun.Flags().BoolVar(&flagInheritEnv, "inherit-env", false, "inherit all environment variables not set by apps")
-	cmdRun.Flags().BoolVar(&flagNoOverlay, "no-overlay", false, "disable overlay filesystem")
+	cmdRun.Flags().BoolVar(&flagNoOverlay, "no-overlay", false, "disable overlay filesystem, overriding the configuration")
+	cmdRun.Flags().BoolVar(&flagAuditJournal, "audit-journal", false, "send the audit events of the pod to the systemd journal, in addition to its audit log")
 	cmdRun.Flags().BoolVar(&flagPrivateUsers, "private-users", false, "Run within user namespaces (experimental).")
 	cmdRun.Flags().Var(&flagExplicitEnv, "set-env", "an environment variable to set for apps in the form name=value")
+	cmdRun.Flags().BoolVar(&flagDryRun, "dry-run", false, "print the pod manifest, mounts, networks and stage1 units of the pod without running it")
 	cmdRun.Flags().BoolVar(&flagInteractive, "interactive", false, "run pod interactively. If true, only one image may be supplied.")
-	cmdRun.Flags().BoolVar(&flagStoreOnly, "store-only", false, "use only available images in the store (do not discover or download from remote URLs)")
-	cmdRun.Flags().BoolVar(&flagNoStore, "no-store", false, "fetch images ignoring the local store")
+	addPullPolicyFlag(cmdRun.Flags())
+	addArchFlag(cmdRun.Flags())
+	addQemuUserFlag(cmdRun.Flags())
 	cmdRun.Flags().StringVar(&flagPodManifest, "pod-manifest", "", "the path to the pod manifest. If it's non-empty, then only '--net', '--no-overlay' and '--interactive' will have effects")
+	addPodManifestVarFlag(cmdRun.Flags())
 	cmdRun.Flags().BoolVar(&flagMDSRegister, "mds-register", false, "register pod with metadata service. needs network connectivity to the host (--net=(default|default-restricted|host)")
 	cmdRun.Flags().StringVar(&flagUUIDFileSave, "uuid-file-save", "", "write out pod UUID to specified file")
+	cmdRun.Flags().StringVar(&flagPodUUID, "uuid", "", "UUID of the pod, instead of a random one. It must be a version 4 UUID, not used by another pod")
 	cmdRun.Flags().Var((*appsVolume)(&rktApps), "volume", "volumes to make available in the pod")
+	cmdRun.Flags().Var((*appsSecret)(&rktApps), "secret", "secret to write on a tmpfs of the pod and mount read-only in the apps, in the form NAME,source=file:PATH|env:VAR[,target=PATH][,mode=MODE][,uid=UID][,gid=GID]")
 
 	// per-app flags
 	cmdRun.Flags().Var((*appAsc)(&rktApps), "signature", "local signature file to use in validating the preceding image")
 	cmdRun.Flags().Var((*appExec)(&rktApps), "exec", "override the exec command for the preceding image")
 	cmdRun.Flags().Var((*appMount)(&rktApps), "mount", "mount point binding a volume to a path within an app")
+	cmdRun.Flags().Var((*appUlimit)(&rktApps), "ulimit", "resource limit of the preceding image, or of all the apps if no image precedes it, in the form RESOURCE=SOFT[:HARD]")
+	cmdRun.Flags().Var((*appIOLimit)(&rktApps), "io-limit", "disk IO limit of the preceding image, or of all the apps if no image precedes it, in the form DEVICE:KEY=VALUE[,KEY=VALUE...] with the keys read-bps, write-bps, read-iops and write-iops")
+	cmdRun.Flags().Var((*appReadOnlyRootFS)(&rktApps), "readonly-rootfs", "mount the rootfs of the preceding image read-only")
+	cmdRun.Flags().Var((*appSeccomp)(&rktApps), "seccomp", "seccomp profile file of the preceding image, in the docker format")
+	cmdRun.Flags().Var((*appAppArmor)(&rktApps), "apparmor", "name of the AppArmor profile confining the preceding image")
+	cmdRun.Flags().Lookup("readonly-rootfs").NoOptDefVal = "true"
+	addAppHardeningFlags(cmdRun.Flags())
+	addAppOneShotFlag(cmdRun.Flags())
+	addMountProfileFlag(cmdRun.Flags())
 
 	flagPorts = portList{}
 
@@ -96,6 +124,11 @@ func init() {
 }
 
 func runRun(cmd *cobra.Command, args []string) (exit int) {
+	if err := applyConfigDefaults(cmd.Flags(), stage1ImageFlagName, "insecure-options", "net"); err != nil {
+		stderr("run: %v", err)
+		return 1
+	}
+
 	privateUsers := uid.NewBlankUidRange()
 	err := parseApps(&rktApps, args, cmd.Flags(), true)
 	if err != nil {
@@ -103,8 +136,9 @@ func runRun(cmd *cobra.Command, args []string) (exit int) {
 		return 1
 	}
 
-	if flagStoreOnly && flagNoStore {
-		stderr("both --store-only and --no-store specified")
+	policy, err := getPullPolicy(cmd.Flags())
+	if err != nil {
+		stderr("run: %v", err)
 		return 1
 	}
 
@@ -113,9 +147,18 @@ func runRun(cmd *cobra.Command, args []string) (exit int) {
 			stderr("run: --private-users is not supported, kernel compiled without user namespace support")
 			return 1
 		}
+		if len(rktApps.NetworkVolumes) > 0 {
+			stderr("run: nfs and cifs volumes cannot be mounted with --private-users")
+			return 1
+		}
 		privateUsers.SetRandomUidRange(uid.DefaultRangeCount)
 	}
 
+	if err := validateTPMFlags(cmd.Flags()); err != nil {
+		stderr("run: %v", err)
+		return 1
+	}
+
 	if len(flagPorts) > 0 && flagNet.None() {
 		stderr("--port flag does not work with 'none' networking")
 		return 1
@@ -130,7 +173,43 @@ func runRun(cmd *cobra.Command, args []string) (exit int) {
 		return 1
 	}
 
-	if len(flagPodManifest) > 0 && (len(flagPorts) > 0 || flagInheritEnv || !flagExplicitEnv.IsEmpty() || rktApps.Count() > 0 || flagStoreOnly || flagNoStore) {
+	if flagMachineName != "" {
+		if err := validateMachineName(flagMachineName); err != nil {
+			stderr("run: %v", err)
+			return 1
+		}
+	}
+
+	if err := validateTimeoutFlag(); err != nil {
+		stderr("run: %v", err)
+		return 1
+	}
+	if err := validateLocalizationFlags(); err != nil {
+		stderr("run: %v", err)
+		return 1
+	}
+	if err := validateMemoryFlags(); err != nil {
+		stderr("run: %v", err)
+		return 1
+	}
+	if err := validateJournalFlags(); err != nil {
+		stderr("run: %v", err)
+		return 1
+	}
+	if err := validateLogFilesFlags(); err != nil {
+		stderr("run: %v", err)
+		return 1
+	}
+	if err := validateLogDriverFlags(); err != nil {
+		stderr("run: %v", err)
+		return 1
+	}
+	if err := validateMountProfileFlag(); err != nil {
+		stderr("run: %v", err)
+		return 1
+	}
+
+	if len(flagPodManifest) > 0 && (len(flagPorts) > 0 || flagInheritEnv || !flagExplicitEnv.IsEmpty() || rktApps.Count() > 0 || cmd.Flags().Lookup("pull-policy").Changed || flagStoreOnly || flagNoStore || vmFlagsSet() || machineFlagsSet() || len(flagDevices) > 0 || gpuFlagSet() || memoryFlagsSet() || localizationFlagsSet() || flagTimeout != "" || journalFlagsSet() || logFilesFlagsSet() || logDriverFlagsSet() || userAnnotationFlagsSet() || cniFlagsSet() || len(rktApps.Secrets) > 0 || len(flagMountProfiles) > 0 || len(rktApps.IOLimits) > 0 || len(rktApps.Rlimits) > 0) {
 		stderr("conflicting flags set with --pod-manifest (see --help)")
 		return 1
 	}
@@ -140,12 +219,17 @@ func runRun(cmd *cobra.Command, args []string) (exit int) {
 		return 1
 	}
 
+	if len(flagPodManifestVars) > 0 && len(flagPodManifest) == 0 {
+		stderr("run: --set requires --pod-manifest")
+		return 1
+	}
+
 	if rktApps.Count() < 1 && len(flagPodManifest) == 0 {
 		stderr("run: must provide at least one image or specify the pod manifest")
 		return 1
 	}
 
-	s, err := store.NewStore(globalFlags.Dir)
+	s, err := newStore()
 	if err != nil {
 		stderr("run: cannot open store: %v", err)
 		return 1
@@ -161,28 +245,99 @@ func runRun(cmd *cobra.Command, args []string) (exit int) {
 			s:                  s,
 			headers:            config.AuthPerHost,
 			dockerAuth:         config.DockerCredentialsPerRegistry,
+			dockerHelpers:      config.DockerCredentialHelpers,
+			archFallbacks:      config.ArchFallbacks,
 			insecureSkipVerify: globalFlags.InsecureSkipVerify,
 			debug:              globalFlags.Debug,
 		},
-		storeOnly: flagStoreOnly,
-		noStore:   flagNoStore,
+		// a dry run doesn't fetch the app images
+		storeOnly: policy.storeOnly() || flagDryRun,
+		noStore:   policy.noStore() && !flagDryRun,
+		noCache:   policy.noCache(),
 		withDeps:  false,
 	}
 
-	s1img, err := getStage1Hash(s, cmd)
-	if err != nil {
+	fn.ks = getKeystore()
+	fn.withDeps = true
+	timings := timing.NewRecorder()
+	endResolve := timings.Start(timing.SpanResolveImages, nil)
+	if err := fn.findImages(&rktApps); err != nil {
 		stderr("run: %v", err)
 		return 1
 	}
+	endResolve()
 
-	fn.ks = getKeystore()
-	fn.withDeps = true
-	if err := fn.findImages(&rktApps); err != nil {
+	cfg := stage0.CommonConfig{
+		Store:         s,
+		Debug:         globalFlags.Debug,
+		Timings:       timings,
+		Stage1Digests: config.Stage1Digests,
+	}
+
+	overlay, noOverlayReason := useOverlay(cmd.Flags(), config.OverlayMode)
+	pcfg := stage0.PrepareConfig{
+		CommonConfig:    cfg,
+		UseOverlay:      overlay,
+		NoOverlayReason: noOverlayReason,
+		PrivateUsers:    privateUsers,
+		AuditJournal:    flagAuditJournal,
+		QemuUser:        flagQemuUser,
+		VolumeDrivers:   config.VolumeDrivers,
+	}
+
+	if len(flagPodManifest) > 0 {
+		pcfg.PodManifest = flagPodManifest
+		pcfg.PodManifestVars = flagPodManifestVars
+	} else {
+		pcfg.Ports = []types.ExposedPort(flagPorts)
+		pcfg.InheritEnv = flagInheritEnv
+		pcfg.ExplicitEnv = flagExplicitEnv.Strings()
+		// no DNS flag, the apps get the resolv.conf of the profiles
+		addMountProfiles(&rktApps, flagMountProfiles, false)
+		pcfg.Apps = &rktApps
+		pcfg.Annotations = append(vmAnnotations(), machineAnnotations()...)
+		pcfg.Annotations = append(pcfg.Annotations, deviceAnnotations()...)
+		pcfg.Annotations = append(pcfg.Annotations, gpuAnnotations()...)
+		pcfg.Annotations = append(pcfg.Annotations, memoryAnnotations()...)
+		pcfg.Annotations = append(pcfg.Annotations, localizationAnnotations()...)
+		pcfg.Annotations = append(pcfg.Annotations, timeoutAnnotations()...)
+		pcfg.Annotations = append(pcfg.Annotations, journalAnnotations()...)
+		pcfg.Annotations = append(pcfg.Annotations, logFilesAnnotations()...)
+		pcfg.Annotations = append(pcfg.Annotations, logDriverAnnotations()...)
+		pcfg.Annotations = append(pcfg.Annotations, userAnnotations()...)
+		pcfg.Annotations = append(pcfg.Annotations, cniAnnotations()...)
+	}
+
+	if globalFlags.Debug {
+		stage0.InitDebug()
+	}
+
+	if flagDryRun {
+		if err := printDryRun(pcfg); err != nil {
+			stderr("run: %v", err)
+			return 1
+		}
+		return 0
+	}
+
+	// a dry run doesn't fetch the stage1 image either
+	s1img, err := getStage1Hash(s, cmd, policy)
+	if err != nil {
+		stderr("run: %v", err)
+		return 1
+	}
+	pcfg.Stage1Image = *s1img
+	if err := checkDevicesStage1(s, *s1img); err != nil {
 		stderr("run: %v", err)
 		return 1
 	}
 
-	p, err := newPod()
+	podUUID, err := getNewPodUUID()
+	if err != nil {
+		stderr("run: %v", err)
+		return 1
+	}
+	p, err := newPod(podUUID)
 	if err != nil {
 		stderr("Error creating new pod: %v", err)
 		return 1
@@ -197,39 +352,15 @@ func runRun(cmd *cobra.Command, args []string) (exit int) {
 		}
 	}
 
-	processLabel, mountLabel, err := label.InitLabels([]string{"mcsdir:/var/run/rkt/mcs"})
+	processLabel, mountLabel, err := allocatePodLabels(s, p.uuid)
 	if err != nil {
 		stderr("Error initialising SELinux: %v", err)
 		return 1
 	}
 
-	cfg := stage0.CommonConfig{
-		MountLabel:   mountLabel,
-		ProcessLabel: processLabel,
-		Store:        s,
-		Stage1Image:  *s1img,
-		UUID:         p.uuid,
-		Debug:        globalFlags.Debug,
-	}
-
-	pcfg := stage0.PrepareConfig{
-		CommonConfig: cfg,
-		UseOverlay:   !flagNoOverlay && common.SupportsOverlay(),
-		PrivateUsers: privateUsers,
-	}
-
-	if len(flagPodManifest) > 0 {
-		pcfg.PodManifest = flagPodManifest
-	} else {
-		pcfg.Ports = []types.ExposedPort(flagPorts)
-		pcfg.InheritEnv = flagInheritEnv
-		pcfg.ExplicitEnv = flagExplicitEnv.Strings()
-		pcfg.Apps = &rktApps
-	}
-
-	if globalFlags.Debug {
-		stage0.InitDebug()
-	}
+	pcfg.UUID = p.uuid
+	pcfg.MountLabel = mountLabel
+	pcfg.ProcessLabel = processLabel
 
 	keyLock, err := lock.SharedKeyLock(lockDir(), common.PrepareLock)
 	if err != nil {
@@ -244,6 +375,28 @@ func runRun(cmd *cobra.Command, args []string) (exit int) {
 	}
 	keyLock.Close()
 
+	apps, err := p.getApps()
+	if err != nil {
+		stderr("run: cannot get the appList in the pod manifest: %v", err)
+		return 1
+	}
+
+	// the pod stays prepared if an image is rejected, so it can still be
+	// run with --insecure-options=scan
+	if err := scanImages(s, config, apps); err != nil {
+		stderr("run: %v", err)
+		return 1
+	}
+
+	if err := runHook(config, hookOnPrepare, p); err != nil {
+		stderr("run: %v", err)
+		return 1
+	}
+	if err := runHook(config, hookOnRun, p); err != nil {
+		stderr("run: %v", err)
+		return 1
+	}
+
 	// get the lock fd for run
 	lfd, err := p.Fd()
 	if err != nil {
@@ -264,20 +417,17 @@ func runRun(cmd *cobra.Command, args []string) (exit int) {
 	}
 
 	rcfg := stage0.RunConfig{
-		CommonConfig: cfg,
+		CommonConfig: pcfg.CommonConfig,
 		Net:          flagNet,
 		LockFd:       lfd,
 		Interactive:  flagInteractive,
 		MDSRegister:  flagMDSRegister,
 		LocalConfig:  globalFlags.LocalConfigDir,
 		RktGid:       rktgid,
+		TPMMeasure:   flagTPMMeasure,
+		TPMPCR:       flagTPMPCR,
 	}
 
-	apps, err := p.getApps()
-	if err != nil {
-		stderr("run: cannot get the appList in the pod manifest: %v", err)
-		return 1
-	}
 	rcfg.Apps = apps
 	stage0.Run(rcfg, p.path(), globalFlags.Dir) // execs, never returns
 
@@ -0,0 +1,173 @@
+// Copyright 2014 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/pborman/uuid"
+	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/networking"
+	stage1lib "github.com/coreos/rkt/pkg/stage1"
+	"github.com/coreos/rkt/stage0"
+	initcommon "github.com/coreos/rkt/stage1/init/common"
+)
+
+// printDryRun prints what running the pod configured by pcfg would do: its
+// pod manifest, the mounts of its apps, the networks it would join and the
+// names of the service, socket and timer units stage1 would write for it,
+// not their content nor the mount units. Nothing is written, mounted or
+// fetched, the app images must already be in the store, and neither the
+// stage1 image nor the secrets are read.
+func printDryRun(pcfg stage0.PrepareConfig) error {
+	podUUID, err := getNewPodUUID()
+	if err != nil {
+		return err
+	}
+	if podUUID == nil {
+		podUUID, err = types.NewUUID(uuid.New())
+		if err != nil {
+			return fmt.Errorf("error creating UUID: %v", err)
+		}
+	}
+	pcfg.UUID = podUUID
+
+	// the directory the pod would be prepared in
+	dir := filepath.Join(prepareDir(), podUUID.String())
+	pm, err := stage0.PlanPodManifest(pcfg, dir)
+	if err != nil {
+		return fmt.Errorf("error planning the pod manifest: %v", err)
+	}
+
+	b, err := json.MarshalIndent(pm, "", "\t")
+	if err != nil {
+		return fmt.Errorf("error marshaling the pod manifest: %v", err)
+	}
+	stdout("pod manifest:")
+	stdout("%s", b)
+
+	apps, images, err := dryRunApps(pcfg, pm)
+	if err != nil {
+		return err
+	}
+
+	// the mounts are resolved in the directory the pod would run in
+	if err := stage1lib.ResolvePodVolumes(pm, filepath.Join(runDir(), podUUID.String())); err != nil {
+		return err
+	}
+	stdout("\nmounts:")
+	volumes := make(map[types.ACName]types.Volume)
+	for _, v := range pm.Volumes {
+		volumes[v.Name] = v
+	}
+	for _, ra := range apps {
+		for _, m := range initcommon.GenerateMounts(ra, volumes) {
+			vol := volumes[m.Volume]
+			stdout("app=%s path=%s volume=%s kind=%s source=%s readOnly=%t", ra.Name, m.Path, vol.Name, vol.Kind, vol.Source, initcommon.IsMountReadOnly(vol, ra.App.MountPoints))
+		}
+	}
+
+	stdout("\nnetworks:")
+	switch {
+	case flagNet.Host():
+		stdout("host")
+	case flagNet.None():
+		stdout("none")
+	default:
+		nets, err := networking.PlanNets(globalFlags.LocalConfigDir, flagNet)
+		if err != nil {
+			return fmt.Errorf("error planning the networks: %v", err)
+		}
+		for _, n := range nets {
+			stdout("name=%s type=%s conf=%s args=%s", n.Name, n.Type, n.ConfPath, n.Args)
+		}
+	}
+	for _, p := range pm.Ports {
+		stdout("port=%s hostPort=%d", p.Name, p.HostPort)
+	}
+
+	stdout("\nunits:")
+	oneShot, sidecars := 0, 0
+	for _, ra := range apps {
+		stdout("app=%s units=%s exec=%q", ra.Name, strings.Join(dryRunUnits(ra, images[ra.Name]), ","), ra.App.Exec)
+		ok, err := initcommon.GetAppBoolAnnotation(ra, images[ra.Name], common.OneShotAnnotation)
+		if err != nil {
+			return err
+		}
+		if ok {
+			oneShot++
+		} else {
+			sidecars++
+		}
+	}
+	if oneShot > 0 && sidecars > 0 {
+		stdout("pod units=%s", initcommon.StopSidecarsUnitName)
+	}
+	if _, ok := pm.Annotations.Get(common.TimeoutAnnotation); ok {
+		stdout("pod units=pod-timeout.timer,pod-timeout.service")
+	}
+
+	return nil
+}
+
+// dryRunApps returns the apps of pm, with the app section of their image
+// when they don't override it, as stage1 would run them, and the manifests
+// of their images.
+func dryRunApps(pcfg stage0.PrepareConfig, pm *schema.PodManifest) ([]*schema.RuntimeApp, map[types.ACName]*schema.ImageManifest, error) {
+	var apps []*schema.RuntimeApp
+	images := make(map[types.ACName]*schema.ImageManifest)
+	for i := range pm.Apps {
+		ra := pm.Apps[i]
+		im, err := pcfg.Store.GetImageManifest(ra.Image.ID.String())
+		if err != nil {
+			return nil, nil, fmt.Errorf("error getting the image manifest of app %q: %v", ra.Name, err)
+		}
+		if ra.App == nil {
+			if im.App == nil {
+				return nil, nil, fmt.Errorf("image of app %q has no app section", ra.Name)
+			}
+			ra.App = im.App
+		}
+		apps = append(apps, &ra)
+		images[ra.Name] = im
+	}
+	return apps, images, nil
+}
+
+// dryRunUnits returns the names of the service, socket and timer units
+// stage1 would write for an app.
+func dryRunUnits(ra *schema.RuntimeApp, im *schema.ImageManifest) []string {
+	units := []string{initcommon.ServiceUnitName(ra.Name), initcommon.ReaperUnitName(ra.Name), initcommon.AppStateUnitName(ra.Name)}
+	if !flagInteractive {
+		units = append(units, initcommon.LogUnitName(ra.Name))
+	}
+	for _, p := range ra.App.Ports {
+		if p.SocketActivated {
+			units = append(units, initcommon.SocketUnitName(ra.Name))
+			break
+		}
+	}
+	if initcommon.HasHealthCheck(ra, im) {
+		units = append(units, initcommon.HealthCheckTimerUnitName(ra.Name), initcommon.HealthCheckServiceUnitName(ra.Name))
+	}
+	return units
+}
@@ -17,10 +17,11 @@
 package main
 
 import (
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/cobra"
 	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/common/timing"
 	"github.com/coreos/rkt/stage0"
-	"github.com/coreos/rkt/store"
 )
 
 const (
@@ -29,9 +30,9 @@ const (
 
 var (
 	cmdRunPrepared = &cobra.Command{
-		Use:   "run-prepared UUID",
+		Use:   "run-prepared [--set-env=NAME=VALUE...] [--port=NAME:HOSTPORT...] UUID",
 		Short: "Run a prepared application pod in rkt",
-		Long:  "UUID must have been acquired via `rkt prepare`",
+		Long:  "UUID must have been acquired via `rkt prepare`.\n\nThe environment variables given with --set-env are set for all the apps, and the ports given with --port replace the ones exposed when the pod was prepared. These overrides are recorded in the pod manifest.",
 		Run:   runWrapper(runRunPrepared),
 	}
 )
@@ -43,6 +44,9 @@ func init() {
 	cmdRunPrepared.Flags().Lookup("net").NoOptDefVal = "default"
 	cmdRunPrepared.Flags().BoolVar(&flagInteractive, "interactive", false, "the pod is interactive")
 	cmdRunPrepared.Flags().BoolVar(&flagMDSRegister, "mds-register", false, "register pod with metadata service")
+	cmdRunPrepared.Flags().Var(&flagExplicitEnv, "set-env", "an environment variable to set for all the apps in the form name=value, overriding the one of the prepared pod")
+	cmdRunPrepared.Flags().Var(&flagPorts, "port", "ports to expose on the host (requires --net), overriding the ones of the prepared pod")
+	addTPMFlags(cmdRunPrepared.Flags())
 }
 
 func runRunPrepared(cmd *cobra.Command, args []string) (exit int) {
@@ -51,6 +55,25 @@ func runRunPrepared(cmd *cobra.Command, args []string) (exit int) {
 		return 1
 	}
 
+	if err := applyConfigDefaults(cmd.Flags(), "insecure-options", "net"); err != nil {
+		stderr("prepared-run: %v", err)
+		return 1
+	}
+
+	if err := validateTPMFlags(cmd.Flags()); err != nil {
+		stderr("prepared-run: %v", err)
+		return 1
+	}
+
+	if len(flagPorts) > 0 && flagNet.None() {
+		stderr("--port flag does not work with 'none' networking")
+		return 1
+	}
+	if len(flagPorts) > 0 && flagNet.Host() {
+		stderr("--port flag does not work with 'host' networking")
+		return 1
+	}
+
 	p, err := getPodFromUUIDString(args[0])
 	if err != nil {
 		stderr("prepared-run: problem retrieving pod: %v", err)
@@ -58,7 +81,7 @@ func runRunPrepared(cmd *cobra.Command, args []string) (exit int) {
 	}
 	defer p.Close()
 
-	s, err := store.NewStore(globalFlags.Dir)
+	s, err := newStore()
 	if err != nil {
 		stderr("prepared-run: cannot open store: %v", err)
 		return 1
@@ -69,6 +92,18 @@ func runRunPrepared(cmd *cobra.Command, args []string) (exit int) {
 		return 1
 	}
 
+	if flagNet.None() {
+		pm, err := p.getManifest()
+		if err != nil {
+			stderr("prepared-run: cannot get the pod manifest: %v", err)
+			return 1
+		}
+		if driver, ok := pm.Annotations.Get(common.LogDriverAnnotation); ok && driver != common.LogDriverJournald {
+			stderr("prepared-run: the %s log driver cannot reach its server with --net=none", driver)
+			return 1
+		}
+	}
+
 	if flagInteractive {
 		ac, err := p.getAppCount()
 		if err != nil {
@@ -91,20 +126,49 @@ func runRunPrepared(cmd *cobra.Command, args []string) (exit int) {
 		}
 	}
 
-	if err := p.xToRun(); err != nil {
-		stderr("prepared-run: cannot transition to run: %v", err)
+	overrides := stage0.PodOverrides{
+		ExplicitEnv: flagExplicitEnv.Strings(),
+		Ports:       []types.ExposedPort(flagPorts),
+	}
+	if err := stage0.OverridePodManifest(p.path(), overrides); err != nil {
+		stderr("prepared-run: cannot override the pod manifest: %v", err)
 		return 1
 	}
 
-	lfd, err := p.Fd()
+	apps, err := p.getApps()
 	if err != nil {
-		stderr("prepared-run: unable to get lock fd: %v", err)
+		stderr("prepared-run: unable to get app list: %v", err)
 		return 1
 	}
 
-	apps, err := p.getApps()
+	config, err := getConfig()
 	if err != nil {
-		stderr("prepared-run: unable to get app list: %v", err)
+		stderr("prepared-run: cannot get configuration: %v", err)
+		return 1
+	}
+	if err := scanImages(s, config, apps); err != nil {
+		stderr("prepared-run: %v", err)
+		return 1
+	}
+	if err := runHook(config, hookOnRun, p); err != nil {
+		stderr("prepared-run: %v", err)
+		return 1
+	}
+
+	processLabel, mountLabel, _, err := getPodLabels(s, p.uuid)
+	if err != nil {
+		stderr("prepared-run: error initialising SELinux: %v", err)
+		return 1
+	}
+
+	if err := p.xToRun(); err != nil {
+		stderr("prepared-run: cannot transition to run: %v", err)
+		return 1
+	}
+
+	lfd, err := p.Fd()
+	if err != nil {
+		stderr("prepared-run: unable to get lock fd: %v", err)
 		return 1
 	}
 
@@ -116,9 +180,13 @@ func runRunPrepared(cmd *cobra.Command, args []string) (exit int) {
 
 	rcfg := stage0.RunConfig{
 		CommonConfig: stage0.CommonConfig{
-			Store: s,
-			UUID:  p.uuid,
-			Debug: globalFlags.Debug,
+			MountLabel:    mountLabel,
+			ProcessLabel:  processLabel,
+			Store:         s,
+			UUID:          p.uuid,
+			Debug:         globalFlags.Debug,
+			Timings:       timing.NewRecorder(),
+			Stage1Digests: config.Stage1Digests,
 		},
 		Net:         flagNet,
 		LockFd:      lfd,
@@ -126,6 +194,8 @@ func runRunPrepared(cmd *cobra.Command, args []string) (exit int) {
 		MDSRegister: flagMDSRegister,
 		Apps:        apps,
 		RktGid:      rktgid,
+		TPMMeasure:  flagTPMMeasure,
+		TPMPCR:      flagTPMPCR,
 	}
 	if globalFlags.Debug {
 		stage0.InitDebug()
@@ -0,0 +1,83 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/rkt/config"
+	"github.com/coreos/rkt/store"
+)
+
+// scanImages runs the scan command of the configuration on each image of
+// the apps, with the image ID as last argument and the image manifest on
+// its standard input. An image is rejected, and the pod must not be run, if
+// the command fails, unless the scan is disabled with
+// --insecure-options=scan.
+func scanImages(s *store.Store, cfg *config.Config, apps schema.AppList) error {
+	if len(cfg.ScanCommand) == 0 {
+		return nil
+	}
+	if globalFlags.InsecureOptions[insecureScan] {
+		stderr("rkt: warning: not scanning the images, disabled with --insecure-options")
+		return nil
+	}
+
+	scanned := make(map[string]struct{})
+	for _, app := range apps {
+		id := app.Image.ID.String()
+		if _, ok := scanned[id]; ok {
+			continue
+		}
+		scanned[id] = struct{}{}
+
+		if err := scanImage(s, cfg.ScanCommand, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanImage runs the scan command on the image with the given ID.
+func scanImage(s *store.Store, command []string, id string) error {
+	mb, err := s.GetImageManifestJSON(id)
+	if err != nil {
+		return fmt.Errorf("cannot get the manifest of image %s: %v", id, err)
+	}
+	var im schema.ImageManifest
+	if err := json.Unmarshal(mb, &im); err != nil {
+		return fmt.Errorf("invalid manifest of image %s: %v", id, err)
+	}
+
+	args := append(append([]string{}, command[1:]...), id)
+	cmd := exec.Command(command[0], args...)
+	cmd.Stdin = bytes.NewReader(mb)
+	// the standard output of rkt run belongs to the apps
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"RKT_IMAGE_ID="+id,
+		"RKT_IMAGE_NAME="+im.Name.String(),
+	)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("image %s (%s) rejected by the scan command %q: %v", im.Name, id, command[0], err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/pkg/label"
+	"github.com/coreos/rkt/store"
+)
+
+// allocatePodLabels returns the SELinux process and mount labels of a new
+// pod. The MCS level of the labels is allocated in the store, so it is unique
+// among the pods until the pod is garbage collected.
+func allocatePodLabels(s *store.Store, uuid *types.UUID) (processLabel, mountLabel string, err error) {
+	if !label.Enabled() {
+		return "", "", nil
+	}
+	level, err := s.AllocateMCSLevel(uuid.String())
+	if err != nil {
+		return "", "", err
+	}
+	return label.InitLabels([]string{"level:" + level})
+}
+
+// getPodLabels returns the SELinux process and mount labels of a pod with
+// the MCS level allocated when it was prepared. found will be false if no
+// level is allocated to the pod.
+func getPodLabels(s *store.Store, uuid *types.UUID) (processLabel, mountLabel string, found bool, err error) {
+	if !label.Enabled() {
+		return "", "", false, nil
+	}
+	level, found, err := s.GetMCSLevel(uuid.String())
+	if err != nil || !found {
+		return "", "", false, err
+	}
+	processLabel, mountLabel, err = label.InitLabels([]string{"level:" + level})
+	if err != nil {
+		return "", "", false, err
+	}
+	return processLabel, mountLabel, true, nil
+}
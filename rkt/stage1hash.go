@@ -76,14 +76,18 @@ func stage1ImageFlagHelp() string {
 // it is absolute and then from the same directory where rkt binary
 // resides.
 //
+// The stage1 image is fetched according to the pull policy, the default one
+// is only looked up in the store when the policy allows it.
+//
 // The passed command must have "stage1-image" string flag registered.
-func getStage1Hash(s *store.Store, cmd *cobra.Command) (*types.Hash, error) {
+func getStage1Hash(s *store.Store, cmd *cobra.Command, policy pullPolicy) (*types.Hash, error) {
 	fn := &finder{
 		imageActionData: imageActionData{
 			s: s,
 		},
-		storeOnly: false,
-		noStore:   false,
+		storeOnly: policy.storeOnly(),
+		noStore:   policy.noStore(),
+		noCache:   policy.noCache(),
 		withDeps:  false,
 	}
 
@@ -115,12 +119,14 @@ func getDefaultStage1Hash(fn *finder, overridden bool) (*types.Hash, error) {
 
 func getDefaultStage1HashFromStore(fn *finder) *types.Hash {
 	// we make sure we've built rkt with a clean git tree,
-	// otherwise we don't know if something changed
-	if !strings.HasSuffix(defaultStage1Version, "-dirty") {
+	// otherwise we don't know if something changed, and that the
+	// pull policy does not ignore the store
+	if !strings.HasSuffix(defaultStage1Version, "-dirty") && !fn.noStore {
 		stage1AppName := fmt.Sprintf("%s:%s", defaultStage1Name, defaultStage1Version)
+		storeOnly := fn.storeOnly
 		fn.storeOnly = true
 		s1img, _ := fn.findImage(stage1AppName, "")
-		fn.storeOnly = false
+		fn.storeOnly = storeOnly
 		return s1img
 	}
 	return nil
@@ -16,26 +16,47 @@
 
 package main
 
-import "github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/cobra"
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/cobra"
+	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/common/timing"
+	"github.com/coreos/rkt/networking/netinfo"
+	"github.com/coreos/rkt/store"
+)
 
 var (
 	cmdStatus = &cobra.Command{
-		Use:   "status [--wait] UUID",
+		Use:   "status [--wait] [--locks] [--format=json] [--timings] UUID",
 		Short: "Check the status of a rkt pod",
 		Run:   runWrapper(runStatus),
 	}
-	flagWait bool
+	flagWait          bool
+	flagStatusLocks   bool
+	flagStatusFormat  string
+	flagStatusTimings bool
 )
 
 const (
-	overlayStatusDirTemplate = "overlay/%s/upper/rkt/status"
-	regularStatusDir         = "stage1/rootfs/rkt/status"
-	cmdStatusName            = "status"
+	overlayStatusDirTemplate   = "overlay/%s/upper/rkt/status"
+	regularStatusDir           = "stage1/rootfs/rkt/status"
+	overlayHealthDirTemplate   = "overlay/%s/upper/rkt/health"
+	regularHealthDir           = "stage1/rootfs/rkt/health"
+	overlayAppStateDirTemplate = "overlay/%s/upper/rkt/app-state"
+	regularAppStateDir         = "stage1/rootfs/rkt/app-state"
+	overlayTimedOutTemplate    = "overlay/%s/upper/rkt/timed-out"
+	regularTimedOutPath        = "stage1/rootfs/rkt/timed-out"
+	cmdStatusName              = "status"
 )
 
 func init() {
 	cmdRkt.AddCommand(cmdStatus)
 	cmdStatus.Flags().BoolVar(&flagWait, "wait", false, "toggle waiting for the pod to exit")
+	cmdStatus.Flags().BoolVar(&flagStatusLocks, "locks", false, "print the processes holding or waiting for the locks of the pod, of the prepare lock and of the store")
+	cmdStatus.Flags().StringVar(&flagStatusFormat, "format", "", "output format, \"json\" to print the status of the pod and of its apps as a JSON object")
+	cmdStatus.Flags().BoolVar(&flagStatusTimings, "timings", false, "print how long the phases of the startup of the pod took, as a JSON array, instead of its status")
 }
 
 func runStatus(cmd *cobra.Command, args []string) (exit int) {
@@ -43,6 +64,10 @@ func runStatus(cmd *cobra.Command, args []string) (exit int) {
 		cmd.Usage()
 		return 1
 	}
+	if flagStatusFormat != "" && flagStatusFormat != "json" {
+		stderr("Unknown format %q, must be \"json\"", flagStatusFormat)
+		return 1
+	}
 
 	p, err := getPodFromUUIDString(args[0])
 	if err != nil {
@@ -58,7 +83,33 @@ func runStatus(cmd *cobra.Command, args []string) (exit int) {
 		}
 	}
 
-	if err = printStatus(p); err != nil {
+	// the locks are printed first, as getting the status may block on
+	// the lock of the store db
+	if flagStatusLocks {
+		printLocks(p)
+	}
+
+	if flagStatusTimings {
+		if err := printTimings(p); err != nil {
+			stderr("Unable to print timings: %v", err)
+			return 1
+		}
+		return 0
+	}
+
+	s, err := newStore()
+	if err != nil {
+		stderr("Cannot open store: %v", err)
+		return 1
+	}
+	defer s.Close()
+
+	if flagStatusFormat == "json" {
+		err = printStatusJSON(p)
+	} else {
+		err = printStatus(s, p)
+	}
+	if err != nil {
 		stderr("Unable to print status: %v", err)
 		return 1
 	}
@@ -67,11 +118,31 @@ func runStatus(cmd *cobra.Command, args []string) (exit int) {
 }
 
 // printStatus prints the pod's pid and per-app status codes
-func printStatus(p *pod) error {
+func printStatus(s *store.Store, p *pod) error {
 	stdout("state=%s", p.getState())
 
+	processLabel, _, found, err := getPodLabels(s, p.uuid)
+	if err != nil {
+		return err
+	}
+	if found {
+		stdout("selinux-context=%s", processLabel)
+	}
+
+	if !p.isEmbryo && !p.isPreparing && !p.isAbortedPrepare && !p.isGarbage && !p.isGone {
+		overlay := p.usesOverlay()
+		stdout("overlay=%t", overlay)
+		if reason := p.getNoOverlayReason(); !overlay && reason != "" {
+			stdout("overlay-disabled-reason=%s", reason)
+		}
+		if err := printJournalLimits(p); err != nil {
+			return err
+		}
+	}
+
 	if p.isRunning() {
 		stdout("networks=%s", fmtNets(p.nets))
+		stdout("paused=%t", p.isPaused())
 	}
 
 	if !p.isEmbryo && !p.isPreparing && !p.isPrepared && !p.isAbortedPrepare && !p.isGarbage && !p.isGone {
@@ -86,9 +157,204 @@ func printStatus(p *pod) error {
 		}
 
 		stdout("pid=%d\nexited=%t", pid, p.isExited)
+		if timedOut, err := p.isTimedOut(); err != nil {
+			return err
+		} else if timedOut {
+			stdout("timed-out=true")
+		}
 		for app, stat := range stats {
 			stdout("app-%s=%d", app, stat)
 		}
 	}
+
+	if p.isRunning() {
+		pc, err := p.getCgroups()
+		if err != nil {
+			return err
+		}
+		if pc != nil {
+			stdout("cgroup=%s", pc.Cgroup)
+			if pc.Unit != "" {
+				stdout("unit=%s", pc.Unit)
+			}
+			for _, ac := range pc.Apps {
+				stdout("app-%s-unit=%s", ac.Name, ac.Unit)
+				if ac.Cgroup != "" {
+					stdout("app-%s-cgroup=%s", ac.Name, ac.Cgroup)
+				}
+			}
+		}
+
+		health, err := p.getHealthStatuses()
+		if err != nil {
+			return err
+		}
+		if len(health) > 0 {
+			healthy := true
+			for app, h := range health {
+				stdout("app-%s-health=%s", app, h)
+				healthy = healthy && h != "unhealthy"
+			}
+			stdout("healthy=%t", healthy)
+		}
+	}
 	return nil
 }
+
+// podStatus is the status of a pod printed by rkt status --format=json.
+type podStatus struct {
+	UUID     string            `json:"uuid"`
+	State    string            `json:"state"`
+	Networks []netinfo.NetInfo `json:"networks,omitempty"`
+	Paused   bool              `json:"paused,omitempty"`
+	PID      int               `json:"pid,omitempty"`
+	Exited   bool              `json:"exited"`
+	TimedOut bool              `json:"timedOut,omitempty"`
+	Healthy  *bool             `json:"healthy,omitempty"`
+	Cgroup   string            `json:"cgroup,omitempty"`
+	Unit     string            `json:"unit,omitempty"`
+	Apps     []appStatus       `json:"apps,omitempty"`
+}
+
+// appStatus is the status of an app in the output of rkt status
+// --format=json.
+type appStatus struct {
+	Name     string     `json:"name"`
+	State    string     `json:"state,omitempty"`
+	Created  *time.Time `json:"created,omitempty"`
+	Started  *time.Time `json:"started,omitempty"`
+	Exited   *time.Time `json:"exited,omitempty"`
+	ExitCode *int       `json:"exitCode,omitempty"`
+	Restarts int        `json:"restarts"`
+	Health   string     `json:"health,omitempty"`
+	Cgroup   string     `json:"cgroup,omitempty"`
+	Unit     string     `json:"unit,omitempty"`
+}
+
+// printStatusJSON prints the status of the pod and of its apps as a JSON
+// object.
+func printStatusJSON(p *pod) error {
+	status, err := getPodStatus(p)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(status, "", "\t")
+	if err != nil {
+		return err
+	}
+	stdout("%s", b)
+	return nil
+}
+
+func getPodStatus(p *pod) (*podStatus, error) {
+	status := &podStatus{
+		UUID:   p.uuid.String(),
+		State:  p.getState(),
+		Exited: p.isExited,
+	}
+	if p.isEmbryo || p.isPreparing || p.isAbortedPrepare || p.isGarbage || p.isGone {
+		return status, nil
+	}
+
+	if p.isRunning() {
+		status.Networks = p.nets
+		status.Paused = p.isPaused()
+	}
+
+	apps, err := p.getApps()
+	if err != nil {
+		return nil, err
+	}
+	states, err := p.getAppStates()
+	if err != nil {
+		return nil, err
+	}
+	stats := make(map[string]int)
+	if !p.isPrepared {
+		if status.PID, err = p.getPID(); err != nil {
+			return nil, err
+		}
+		if stats, err = p.getExitStatuses(); err != nil {
+			return nil, err
+		}
+		if status.TimedOut, err = p.isTimedOut(); err != nil {
+			return nil, err
+		}
+	}
+	health := make(map[string]string)
+	appCgroups := make(map[string]common.AppCgroup)
+	if p.isRunning() {
+		if health, err = p.getHealthStatuses(); err != nil {
+			return nil, err
+		}
+		pc, err := p.getCgroups()
+		if err != nil {
+			return nil, err
+		}
+		if pc != nil {
+			status.Cgroup = pc.Cgroup
+			status.Unit = pc.Unit
+			for _, ac := range pc.Apps {
+				appCgroups[ac.Name] = ac
+			}
+		}
+	}
+
+	for _, ra := range apps {
+		name := ra.Name.String()
+		as := appStatus{Name: name}
+		if st, ok := states[name]; ok {
+			as.State = st.State
+			as.Created = timeOrNil(st.Created)
+			as.Started = timeOrNil(st.Started)
+			as.Exited = timeOrNil(st.Exited)
+			as.ExitCode = st.ExitCode
+			as.Restarts = st.Restarts
+		}
+		// the stage1s not recording the state of the apps still write
+		// their exit status
+		if code, ok := stats[name]; ok && as.ExitCode == nil {
+			as.State = "exited"
+			as.ExitCode = &code
+		}
+		if h, ok := health[name]; ok {
+			as.Health = h
+			healthy := h != "unhealthy"
+			if status.Healthy != nil {
+				healthy = healthy && *status.Healthy
+			}
+			status.Healthy = &healthy
+		}
+		if ac, ok := appCgroups[name]; ok {
+			as.Cgroup = ac.Cgroup
+			as.Unit = ac.Unit
+		}
+		status.Apps = append(status.Apps, as)
+	}
+	return status, nil
+}
+
+// printTimings prints the spans of the timing report of the pod as a JSON
+// array.
+func printTimings(p *pod) error {
+	spans, err := timing.ReadReport(p.path())
+	if err != nil {
+		return err
+	}
+	if spans == nil {
+		spans = []timing.Span{}
+	}
+	b, err := json.MarshalIndent(spans, "", "\t")
+	if err != nil {
+		return err
+	}
+	stdout("%s", b)
+	return nil
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
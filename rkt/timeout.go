@@ -0,0 +1,54 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/pflag"
+	"github.com/coreos/rkt/common"
+)
+
+var flagTimeout string
+
+// addTimeoutFlag adds the flag limiting how long the pods run. It is passed
+// to stage1 as a pod annotation.
+func addTimeoutFlag(flags *pflag.FlagSet) {
+	flags.StringVar(&flagTimeout, "timeout", "", "stop the apps of the pod when it has run for this long, e.g. 2h, and mark it as timed out")
+}
+
+// validateTimeoutFlag returns an error if the value of the timeout flag is
+// invalid.
+func validateTimeoutFlag() error {
+	if flagTimeout == "" {
+		return nil
+	}
+	if d, err := time.ParseDuration(flagTimeout); err != nil || d <= 0 {
+		return fmt.Errorf("invalid timeout %q, must be a positive duration like 30m or 2h", flagTimeout)
+	}
+	return nil
+}
+
+// timeoutAnnotations returns the pod annotations corresponding to the
+// timeout flag.
+func timeoutAnnotations() types.Annotations {
+	var annotations types.Annotations
+	if flagTimeout != "" {
+		annotations.Set(types.ACIdentifier(common.TimeoutAnnotation), flagTimeout)
+	}
+	return annotations
+}
@@ -0,0 +1,48 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/pflag"
+	"github.com/coreos/rkt/stage0"
+)
+
+// tpmPCRCount is the number of PCRs of a TPM 2.0
+const tpmPCRCount = 24
+
+var (
+	flagTPMMeasure bool
+	flagTPMPCR     int
+)
+
+// addTPMFlags adds the flags configuring the measurement of the images of
+// the pods in the TPM when they are started.
+func addTPMFlags(flags *pflag.FlagSet) {
+	flags.BoolVar(&flagTPMMeasure, "tpm-measure", false, "extend a TPM PCR with the hashes of the stage1 and app images when starting the pod (requires tpm2-tools)")
+	flags.IntVar(&flagTPMPCR, "tpm-pcr", stage0.DefaultTPMPCR, "PCR extended by --tpm-measure")
+}
+
+// validateTPMFlags returns an error if the TPM flags are invalid.
+func validateTPMFlags(flags *pflag.FlagSet) error {
+	if flagTPMPCR < 0 || flagTPMPCR >= tpmPCRCount {
+		return fmt.Errorf("invalid PCR %d, must be between 0 and %d", flagTPMPCR, tpmPCRCount-1)
+	}
+	if flags.Lookup("tpm-pcr").Changed && !flagTPMMeasure {
+		return fmt.Errorf("--tpm-pcr requires --tpm-measure")
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/pflag"
+)
+
+func TestValidateTPMFlags(t *testing.T) {
+	tests := []struct {
+		args  []string
+		valid bool
+	}{
+		{nil, true},
+		{[]string{"--tpm-measure"}, true},
+		{[]string{"--tpm-measure", "--tpm-pcr=0"}, true},
+		{[]string{"--tpm-measure", "--tpm-pcr=23"}, true},
+		{[]string{"--tpm-measure", "--tpm-pcr=24"}, false},
+		{[]string{"--tpm-measure", "--tpm-pcr=-1"}, false},
+		{[]string{"--tpm-pcr=16"}, false},
+	}
+
+	for i, tt := range tests {
+		flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+		addTPMFlags(flags)
+		if err := flags.Parse(tt.args); err != nil {
+			t.Fatalf("#%d: unexpected error parsing %v: %v", i, tt.args, err)
+		}
+		err := validateTPMFlags(flags)
+		if tt.valid && err != nil {
+			t.Errorf("#%d: expected %v to be valid, got error: %v", i, tt.args, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("#%d: expected %v to be invalid", i, tt.args)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/pflag"
+	"github.com/coreos/rkt/common"
+)
+
+var (
+	flagUserAnnotations userKVMap
+	flagUserLabels      userKVMap
+)
+
+// userKVMap implements the flag.Value interface to contain the user
+// annotations or labels of a pod, given as NAME=VALUE pairs
+type userKVMap map[string]string
+
+func (m *userKVMap) Set(s string) error {
+	name, value, err := parseUserKV(s)
+	if err != nil {
+		return err
+	}
+	if *m == nil {
+		*m = make(userKVMap)
+	}
+	if _, exists := (*m)[name]; exists {
+		return fmt.Errorf("%q already set", name)
+	}
+	(*m)[name] = value
+	return nil
+}
+
+func (m *userKVMap) String() string {
+	var kvs []string
+	for _, name := range m.names() {
+		kvs = append(kvs, name+"="+(*m)[name])
+	}
+	return strings.Join(kvs, ",")
+}
+
+func (m *userKVMap) Type() string {
+	return "userKVMap"
+}
+
+// names returns the sorted names of the map, so the generated pod
+// manifests are stable.
+func (m *userKVMap) names() []string {
+	var names []string
+	for name := range *m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseUserKV parses a NAME=VALUE pair. The name must be a valid AC
+// identifier as it is stored in the name of a pod annotation.
+func parseUserKV(s string) (string, string, error) {
+	pair := strings.SplitN(s, "=", 2)
+	if len(pair) != 2 || pair[0] == "" {
+		return "", "", fmt.Errorf("%q must be specified as name=value", s)
+	}
+	if _, err := types.NewACIdentifier(pair[0]); err != nil {
+		return "", "", fmt.Errorf("invalid name %q: %v", pair[0], err)
+	}
+	return pair[0], pair[1], nil
+}
+
+// addUserAnnotationFlags adds the flags setting the user annotations and
+// labels of the pods. They are stored in the pod manifest as pod
+// annotations.
+func addUserAnnotationFlags(flags *pflag.FlagSet) {
+	flags.Var(&flagUserAnnotations, "user-annotation", "annotation of the pod, in the form NAME=VALUE")
+	flags.Var(&flagUserLabels, "user-label", "label of the pod, in the form NAME=VALUE")
+}
+
+// userAnnotationFlagsSet returns whether any of the user annotation or
+// label flags is set.
+func userAnnotationFlagsSet() bool {
+	return len(flagUserAnnotations) > 0 || len(flagUserLabels) > 0
+}
+
+// userAnnotations returns the pod annotations corresponding to the user
+// annotation and label flags.
+func userAnnotations() types.Annotations {
+	var annotations types.Annotations
+	for _, name := range flagUserAnnotations.names() {
+		annotations.Set(types.ACIdentifier(common.UserAnnotationPrefix+name), flagUserAnnotations[name])
+	}
+	for _, name := range flagUserLabels.names() {
+		annotations.Set(types.ACIdentifier(common.UserLabelPrefix+name), flagUserLabels[name])
+	}
+	return annotations
+}
+
+// getUserKVs returns the user annotations or the user labels, depending
+// on prefix, stored in the annotations of a pod manifest.
+func getUserKVs(annotations types.Annotations, prefix string) map[string]string {
+	kvs := make(map[string]string)
+	for _, a := range annotations {
+		name := a.Name.String()
+		if strings.HasPrefix(name, prefix) {
+			kvs[strings.TrimPrefix(name, prefix)] = a.Value
+		}
+	}
+	return kvs
+}
+
+// podKVFilter is a condition on a user label or annotation of a pod, in
+// the form label=NAME=VALUE or annotation=NAME=VALUE
+type podKVFilter struct {
+	prefix string
+	name   string
+	value  string
+}
+
+func parsePodKVFilter(s string) (*podKVFilter, error) {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid filter %q, must be label=NAME=VALUE or annotation=NAME=VALUE", s)
+	}
+
+	var prefix string
+	switch parts[0] {
+	case "label":
+		prefix = common.UserLabelPrefix
+	case "annotation":
+		prefix = common.UserAnnotationPrefix
+	default:
+		return nil, fmt.Errorf("invalid filter %q, unknown kind %q", s, parts[0])
+	}
+
+	name, value, err := parseUserKV(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %q: %v", s, err)
+	}
+	return &podKVFilter{
+		prefix: prefix,
+		name:   name,
+		value:  value,
+	}, nil
+}
+
+// matches returns whether the pod with the given annotations satisfies the
+// filter.
+func (f *podKVFilter) matches(annotations types.Annotations) bool {
+	value, ok := annotations.Get(f.prefix + f.name)
+	return ok && value == f.value
+}
+
+func (f *podKVFilter) String() string {
+	kind := "label"
+	if f.prefix == common.UserAnnotationPrefix {
+		kind = "annotation"
+	}
+	return fmt.Sprintf("%s=%s=%s", kind, f.name, f.value)
+}
+
+// podKVFilterList implements the flag.Value interface to contain the
+// filters of the listed pods. A pod must satisfy all of them.
+type podKVFilterList []*podKVFilter
+
+func (l *podKVFilterList) Set(s string) error {
+	f, err := parsePodKVFilter(s)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, f)
+	return nil
+}
+
+func (l *podKVFilterList) String() string {
+	var fs []string
+	for _, f := range *l {
+		fs = append(fs, f.String())
+	}
+	return strings.Join(fs, " ")
+}
+
+func (l *podKVFilterList) Type() string {
+	return "podKVFilterList"
+}
+
+// matches returns whether the pod with the given annotations satisfies all
+// the filters.
+func (l podKVFilterList) matches(annotations types.Annotations) bool {
+	for _, f := range l {
+		if !f.matches(annotations) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,99 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+)
+
+func TestUserKVMap(t *testing.T) {
+	tests := []struct {
+		in   []string
+		out  string
+		fail bool
+	}{
+		{[]string{"env=prod"}, "env=prod", false},
+		{[]string{"tier=web", "env=prod"}, "env=prod,tier=web", false},
+		{[]string{"example.com/owner=team a"}, "example.com/owner=team a", false},
+		{[]string{"empty="}, "empty=", false},
+		{[]string{"env"}, "", true},
+		{[]string{"=prod"}, "", true},
+		{[]string{"Env=prod"}, "", true},
+		{[]string{"env=prod", "env=dev"}, "", true},
+	}
+
+	for i, tt := range tests {
+		var m userKVMap
+		var err error
+		for _, s := range tt.in {
+			if err = m.Set(s); err != nil {
+				break
+			}
+		}
+		if (err != nil) != tt.fail {
+			t.Errorf("#%d: got error %v, want failure %v", i, err, tt.fail)
+			continue
+		}
+		if !tt.fail && m.String() != tt.out {
+			t.Errorf("#%d: got %q, want %q", i, m.String(), tt.out)
+		}
+	}
+}
+
+func TestPodKVFilter(t *testing.T) {
+	annotations := types.Annotations{
+		{Name: "coreos.com/rkt/user-label/env", Value: "prod"},
+		{Name: "coreos.com/rkt/user-annotation/owner", Value: "team-a"},
+	}
+
+	tests := []struct {
+		filters []string
+		match   bool
+		fail    bool
+	}{
+		{nil, true, false},
+		{[]string{"label=env=prod"}, true, false},
+		{[]string{"label=env=dev"}, false, false},
+		{[]string{"annotation=env=prod"}, false, false},
+		{[]string{"annotation=owner=team-a"}, true, false},
+		{[]string{"label=env=prod", "annotation=owner=team-a"}, true, false},
+		{[]string{"label=env=prod", "annotation=owner=team-b"}, false, false},
+		{[]string{"label=env"}, false, true},
+		{[]string{"image=env=prod"}, false, true},
+		{[]string{"env=prod"}, false, true},
+	}
+
+	for i, tt := range tests {
+		var l podKVFilterList
+		var err error
+		for _, s := range tt.filters {
+			if err = l.Set(s); err != nil {
+				break
+			}
+		}
+		if (err != nil) != tt.fail {
+			t.Errorf("#%d: got error %v, want failure %v", i, err, tt.fail)
+			continue
+		}
+		if tt.fail {
+			continue
+		}
+		if match := l.matches(annotations); match != tt.match {
+			t.Errorf("#%d: got match %v, want %v", i, match, tt.match)
+		}
+	}
+}
@@ -78,6 +78,31 @@ func readUUIDFromFile(path string) (*types.UUID, error) {
 	return types.NewUUID(string(uuid))
 }
 
+// parsePodUUID parses the uuid given to a new pod, which must be a random
+// (version 4) uuid as generated by rkt, in the canonical form.
+func parsePodUUID(s string) (*types.UUID, error) {
+	u, err := types.NewUUID(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid UUID %q: %v", s, err)
+	}
+	if u[6]>>4 != 4 || u[8]>>6 != 2 {
+		return nil, fmt.Errorf("invalid UUID %q: not a version 4 UUID", s)
+	}
+	if strings.ToLower(s) != u.String() {
+		return nil, fmt.Errorf("invalid UUID %q: not in the canonical form %q", s, u)
+	}
+	return u, nil
+}
+
+// getNewPodUUID returns the uuid given with --uuid, or nil if none was
+// given.
+func getNewPodUUID() (*types.UUID, error) {
+	if flagPodUUID == "" {
+		return nil, nil
+	}
+	return parsePodUUID(flagPodUUID)
+}
+
 func writeUUIDToFile(uuid *types.UUID, path string) error {
 	return ioutil.WriteFile(path, []byte(uuid.String()), 0644)
 }
@@ -0,0 +1,52 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import "testing"
+
+func TestParsePodUUID(t *testing.T) {
+	tests := []struct {
+		in  string
+		err bool
+	}{
+		{"6733c3a8-ebf4-4b2b-8e5f-ea0a4d8d5f6e", false},
+		{"6733C3A8-EBF4-4B2B-8E5F-EA0A4D8D5F6E", false},
+		// not a version 4 UUID
+		{"6733c3a8-ebf4-1b2b-8e5f-ea0a4d8d5f6e", true},
+		// not the RFC 4122 variant
+		{"6733c3a8-ebf4-4b2b-ce5f-ea0a4d8d5f6e", true},
+		// not in the canonical form
+		{"6733c3a8ebf44b2b8e5fea0a4d8d5f6e", true},
+		{"6733c3a8-ebf4-4b2b-8e5f", true},
+		{"", true},
+	}
+
+	for i, tt := range tests {
+		u, err := parsePodUUID(tt.in)
+		if tt.err {
+			if err == nil {
+				t.Errorf("#%d: expected an error for %q, got none", i, tt.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: unexpected error for %q: %v", i, tt.in, err)
+			continue
+		}
+		if u.String() != "6733c3a8-ebf4-4b2b-8e5f-ea0a4d8d5f6e" {
+			t.Errorf("#%d: unexpected UUID %q", i, u)
+		}
+	}
+}
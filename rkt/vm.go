@@ -0,0 +1,75 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strconv"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/spf13/pflag"
+	"github.com/coreos/rkt/common"
+)
+
+var (
+	flagVMHypervisor  string
+	flagVMCPUs        int
+	flagVMMemory      int
+	flagVMVolumeFS    string
+	flagVMVolumeCache string
+	flagVMVsock       bool
+)
+
+// addVMFlags adds the flags configuring the virtual machine of the pods
+// running with the kvm flavor of stage1. They are passed to stage1 as pod
+// annotations.
+func addVMFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&flagVMHypervisor, "vm-hypervisor", "", "hypervisor used by the kvm stage1: lkvm, qemu or cloud-hypervisor (default lkvm)")
+	flags.IntVar(&flagVMCPUs, "vm-cpus", 0, "number of vCPUs of the kvm stage1 virtual machine (default derived from the CPU isolators of the apps)")
+	flags.IntVar(&flagVMMemory, "vm-memory", 0, "memory in MiB of the kvm stage1 virtual machine (default derived from the memory isolators of the apps)")
+	flags.StringVar(&flagVMVolumeFS, "vm-volume-fs", "", "file system sharing the host volumes with the kvm stage1 virtual machine: 9p, virtiofs (qemu and cloud-hypervisor only) or auto, virtiofs if the stage1 guest kernel and the host support it (default 9p, virtiofs with cloud-hypervisor)")
+	flags.StringVar(&flagVMVolumeCache, "vm-volume-cache", "", "caching mode of the host volumes shared with the kvm stage1 virtual machine (none, loose, fscache or mmap with 9p; none, auto or always with virtiofs)")
+	flags.BoolVar(&flagVMVsock, "vm-vsock", false, "talk to the kvm stage1 virtual machine over vsock instead of the pod network (qemu only, needs a guest kernel with virtio-vsock)")
+}
+
+// vmFlagsSet returns whether any of the virtual machine flags is set.
+func vmFlagsSet() bool {
+	return flagVMHypervisor != "" || flagVMCPUs != 0 || flagVMMemory != 0 ||
+		flagVMVolumeFS != "" || flagVMVolumeCache != "" || flagVMVsock
+}
+
+// vmAnnotations returns the pod annotations corresponding to the virtual
+// machine flags.
+func vmAnnotations() types.Annotations {
+	var annotations types.Annotations
+	if flagVMHypervisor != "" {
+		annotations.Set(types.ACIdentifier(common.KVMHypervisorAnnotation), flagVMHypervisor)
+	}
+	if flagVMCPUs != 0 {
+		annotations.Set(types.ACIdentifier(common.KVMCPUsAnnotation), strconv.Itoa(flagVMCPUs))
+	}
+	if flagVMMemory != 0 {
+		annotations.Set(types.ACIdentifier(common.KVMMemoryAnnotation), strconv.Itoa(flagVMMemory))
+	}
+	if flagVMVolumeFS != "" {
+		annotations.Set(types.ACIdentifier(common.KVMVolumeFSAnnotation), flagVMVolumeFS)
+	}
+	if flagVMVolumeCache != "" {
+		annotations.Set(types.ACIdentifier(common.KVMVolumeCacheAnnotation), flagVMVolumeCache)
+	}
+	if flagVMVsock {
+		annotations.Set(types.ACIdentifier(common.KVMVsockAnnotation), "true")
+	}
+	return annotations
+}
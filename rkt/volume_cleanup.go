@@ -0,0 +1,159 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/common/volplugin"
+)
+
+// volumeCleanupInput describes a volume to its cleanup plugin, on its
+// standard input.
+type volumeCleanupInput struct {
+	UUID   string       `json:"uuid"`
+	Volume types.Volume `json:"volume"`
+	Driver string       `json:"driver"`
+}
+
+// runVolumeCleanupPlugins runs the cleanup plugin configured for the plugin
+// kind on each volume mounted by a driver, with the pod UUID and the volume
+// name as last arguments and the volume spec, the host volume the driver
+// mounted in the pod manifest, on its standard input. drivers are the
+// drivers of these volumes, by name: the other volumes of the pod, such as
+// the host volumes, are never cleaned up. A failing plugin doesn't prevent
+// the others from running, its error is returned with theirs.
+func runVolumeCleanupPlugins(plugins map[string][]string, uuid string, volumes []types.Volume, drivers map[types.ACName]string) []error {
+	var errs []error
+	for _, v := range volumes {
+		driver, ok := drivers[v.Name]
+		if !ok {
+			continue
+		}
+		command := plugins[volplugin.Kind]
+		if len(command) == 0 {
+			continue
+		}
+		b, err := json.Marshal(volumeCleanupInput{UUID: uuid, Volume: v, Driver: driver})
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		args := append(append([]string{}, command[1:]...), uuid, v.Name.String())
+		cmd := exec.Command(command[0], args...)
+		cmd.Stdin = bytes.NewReader(b)
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		cmd.Env = append(os.Environ(),
+			"RKT_POD_UUID="+uuid,
+			"RKT_VOLUME_NAME="+v.Name.String(),
+			"RKT_VOLUME_KIND="+volplugin.Kind,
+			"RKT_VOLUME_DRIVER="+driver,
+		)
+		if err := cmd.Run(); err != nil {
+			errs = append(errs, fmt.Errorf("cleanup plugin %q failed for volume %q of pod %s: %v", command[0], v.Name, uuid, err))
+		}
+	}
+	return errs
+}
+
+// cleanupPodVolumes runs the volume cleanup plugins of the configuration on
+// the volumes mounted by drivers of a garbage collected pod, printing the
+// errors. It must run before the volumes are unmounted, which removes their
+// records. Pods which were never prepared have no volumes to release.
+func cleanupPodVolumes(p *pod) {
+	cfg, err := getConfig()
+	if err != nil {
+		stderr("Cannot get configuration to clean up the volumes of pod %q: %v", p.uuid, err)
+		return
+	}
+	if len(cfg.VolumeCleanupPlugins) == 0 {
+		return
+	}
+
+	vols, err := volplugin.ReadVolumes(common.PluginVolumesPath(p.path()))
+	if err != nil {
+		stderr("Cannot read the plugin volumes of pod %q to clean them up: %v", p.uuid, err)
+		return
+	}
+	if len(vols) == 0 {
+		return
+	}
+	drivers := make(map[types.ACName]string)
+	for _, vol := range vols {
+		name, err := types.NewACName(vol.Name)
+		if err != nil {
+			stderr("Invalid plugin volume %q of pod %q, cannot clean it up: %v", vol.Name, p.uuid, err)
+			continue
+		}
+		drivers[*name] = vol.Driver
+	}
+
+	pmb, err := p.readFile(common.PodManifestPath(""))
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		stderr("Cannot read the manifest of pod %q to clean up its volumes: %v", p.uuid, err)
+		return
+	}
+	pm := &schema.PodManifest{}
+	if err := pm.UnmarshalJSON(pmb); err != nil {
+		stderr("Invalid manifest of pod %q, cannot clean up its volumes: %v", p.uuid, err)
+		return
+	}
+
+	for _, err := range runVolumeCleanupPlugins(cfg.VolumeCleanupPlugins, p.uuid.String(), pm.Volumes, drivers) {
+		stderr("Warning: %v", err)
+	}
+}
+
+// unmountPluginVolumes unmounts, with their drivers, the volumes mounted by
+// volume drivers when the pod was prepared. The pod directory must not be
+// removed if it fails, since it would remove the files of the volumes.
+func unmountPluginVolumes(p *pod) error {
+	dir := common.PluginVolumesPath(p.path())
+	vols, err := volplugin.ReadVolumes(dir)
+	if err != nil || len(vols) == 0 {
+		return err
+	}
+	cfg, err := getConfig()
+	if err != nil {
+		return fmt.Errorf("cannot get configuration: %v", err)
+	}
+	for _, vol := range vols {
+		command, ok := cfg.VolumeDrivers[vol.Driver]
+		if !ok {
+			return fmt.Errorf("no volume driver %q configured to unmount volume %q", vol.Driver, vol.Name)
+		}
+		drv := &volplugin.Driver{Name: vol.Driver, Command: command}
+		if err := drv.Unmount(volplugin.MountPath(dir, vol.Name)); err != nil {
+			return err
+		}
+		if err := volplugin.RemoveVolume(dir, vol); err != nil {
+			return err
+		}
+	}
+	return nil
+}
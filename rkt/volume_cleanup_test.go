@@ -0,0 +1,82 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+)
+
+func TestRunVolumeCleanupPlugins(t *testing.T) {
+	d, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating tmpdir: %v", err)
+	}
+	defer os.RemoveAll(d)
+
+	out := filepath.Join(d, "plugin")
+	plugins := map[string][]string{
+		"plugin": {"/bin/sh", "-c", `cat > "$0.$2.in"; echo "$RKT_VOLUME_KIND $RKT_VOLUME_DRIVER $1 $2" > "$0.$2.args"; test "$2" = data`, out},
+	}
+	// the volumes mounted by drivers are host volumes in the pod manifest
+	volumes := []types.Volume{
+		{Name: *types.MustACName("data"), Kind: "host", Source: "/plugin-volumes/data"},
+		{Name: *types.MustACName("shared"), Kind: "host", Source: "/plugin-volumes/shared"},
+		{Name: *types.MustACName("host"), Kind: "host", Source: "/srv/volumes/host"},
+		{Name: *types.MustACName("scratch"), Kind: "empty"},
+	}
+	drivers := map[types.ACName]string{
+		*types.MustACName("data"):   "nfs",
+		*types.MustACName("shared"): "nfs",
+	}
+	uuid := "6733c3e1-5c8e-4e54-9e5e-c7a0f4a3a4de"
+
+	errs := runVolumeCleanupPlugins(plugins, uuid, volumes, drivers)
+	if len(errs) != 1 {
+		t.Fatalf("expected an error from the failing plugin only, got %v", errs)
+	}
+
+	args, err := ioutil.ReadFile(out + ".data.args")
+	if err != nil {
+		t.Fatalf("error reading the arguments of the plugin: %v", err)
+	}
+	if expected := "plugin nfs " + uuid + " data\n"; string(args) != expected {
+		t.Errorf("expected arguments %q, got %q", expected, args)
+	}
+	var in volumeCleanupInput
+	b, err := ioutil.ReadFile(out + ".data.in")
+	if err != nil {
+		t.Fatalf("error reading the input of the plugin: %v", err)
+	}
+	if err := json.Unmarshal(b, &in); err != nil {
+		t.Fatalf("invalid input of the plugin %q: %v", b, err)
+	}
+	if in.UUID != uuid || in.Volume.Name.String() != "data" || in.Volume.Kind != "host" || in.Volume.Source != "/plugin-volumes/data" || in.Driver != "nfs" {
+		t.Errorf("unexpected input of the plugin %+v", in)
+	}
+	// only the volumes mounted by drivers are cleaned up
+	for _, name := range []string{"host", "scratch"} {
+		if _, err := os.Stat(out + "." + name + ".args"); !os.IsNotExist(err) {
+			t.Errorf("unexpected cleanup of volume %q not mounted by a driver", name)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package stage0
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const (
+	appArmorEnabledFile  = "/sys/module/apparmor/parameters/enabled"
+	appArmorProfilesFile = "/sys/kernel/security/apparmor/profiles"
+)
+
+// checkAppArmorProfile checks that AppArmor is enabled and that the profile
+// is loaded, so a pod doesn't fail to start because of it.
+func checkAppArmorProfile(name string) error {
+	enabled, err := ioutil.ReadFile(appArmorEnabledFile)
+	if err != nil || strings.TrimSpace(string(enabled)) != "Y" {
+		return fmt.Errorf("AppArmor is not enabled on the host")
+	}
+
+	f, err := os.Open(appArmorProfilesFile)
+	if err != nil {
+		// securityfs might not be mounted, let systemd check it
+		return nil
+	}
+	defer f.Close()
+
+	// lines of the form: NAME (MODE)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.LastIndex(line, " ("); i >= 0 {
+			line = line[:i]
+		}
+		if line == name {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("AppArmor profile %q is not loaded", name)
+}
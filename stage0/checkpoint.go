@@ -0,0 +1,121 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package stage0
+
+// Experimental checkpoint and restore of the pods with CRIU, see
+// https://criu.org
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/pkg/stage1"
+	"github.com/coreos/rkt/pkg/sys"
+)
+
+// criuCommonArgs are the arguments of both criu dump and criu restore
+var criuCommonArgs = []string{
+	"--manage-cgroups",
+	"--tcp-established",
+	"--ext-unix-sk",
+	"--file-locks",
+	"--ext-mount-map", "auto",
+}
+
+// CheckpointPath returns the path of the CRIU images of the pod rooted in
+// pdir
+func CheckpointPath(pdir string) string {
+	return filepath.Join(pdir, common.CheckpointDir)
+}
+
+func criuArgs(action string, pdir string, debug bool) []string {
+	args := []string{
+		action,
+		"--images-dir", CheckpointPath(pdir),
+		"--log-file", action + ".log",
+	}
+	args = append(args, criuCommonArgs...)
+	if debug {
+		args = append(args, "-v4")
+	}
+	return args
+}
+
+// Checkpoint dumps the processes of the running pod rooted in pdir, whose PID
+// 1 is podPID, to CRIU images in the pod directory. The pod exits once they
+// are dumped, unless leaveRunning is true.
+func Checkpoint(pdir string, podPID int, leaveRunning bool, debug bool) error {
+	criu, err := exec.LookPath("criu")
+	if err != nil {
+		return fmt.Errorf("cannot find criu: %v", err)
+	}
+
+	imagesDir := CheckpointPath(pdir)
+	if err := os.RemoveAll(imagesDir); err != nil {
+		return fmt.Errorf("error removing the previous checkpoint: %v", err)
+	}
+	if err := os.MkdirAll(imagesDir, 0700); err != nil {
+		return fmt.Errorf("error creating the checkpoint directory: %v", err)
+	}
+
+	args := criuArgs("dump", pdir, debug)
+	args = append(args, "--tree", strconv.Itoa(podPID), "--enable-external-sharing", "--enable-external-masters")
+	if leaveRunning {
+		args = append(args, "--leave-running")
+	}
+
+	cmd := exec.Command(criu, args...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("criu dump failed, see %s: %v", filepath.Join(imagesDir, "dump.log"), err)
+	}
+	return nil
+}
+
+// Restore restores the pod rooted in pdir from its checkpoint by exec()ing
+// criu, which stays the parent of the restored PID 1 of the pod like stage1
+// does, and keeps the lock of the pod open so it is seen as running.
+func Restore(pdir string, lockFd int, debug bool) error {
+	criu, err := exec.LookPath("criu")
+	if err != nil {
+		return fmt.Errorf("cannot find criu: %v", err)
+	}
+	if _, err := os.Stat(CheckpointPath(pdir)); err != nil {
+		return fmt.Errorf("cannot find the checkpoint of the pod: %v", err)
+	}
+
+	// after the exec, criu is the parent of the PID 1 of the pod
+	if err := os.Remove(filepath.Join(pdir, "pid")); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := stage1.WritePpid(pdir, os.Getpid()); err != nil {
+		return err
+	}
+
+	if err := sys.CloseOnExec(lockFd, false); err != nil {
+		return fmt.Errorf("error clearing FD_CLOEXEC on lock fd: %v", err)
+	}
+
+	args := append([]string{criu}, criuArgs("restore", pdir, debug)...)
+	return syscall.Exec(criu, args, os.Environ())
+}
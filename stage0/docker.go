@@ -0,0 +1,151 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stage0
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+)
+
+// dockerHealthConfig is the HEALTHCHECK of a docker image, as recorded by
+// docker2aci in the image manifest.
+type dockerHealthConfig struct {
+	Test     []string
+	Interval time.Duration
+	Timeout  time.Duration
+	Retries  int
+}
+
+// dockerExec returns the command of an app converted from a docker image
+// when it is run with the given arguments: like with docker, they replace
+// the cmd of the image and are passed to its entrypoint. It returns false if
+// the image is not a converted docker image or has no entrypoint.
+func dockerExec(am *schema.ImageManifest, args []string) (types.Exec, bool, error) {
+	val, ok := am.Annotations.Get(common.DockerEntrypointAnnotation)
+	if !ok {
+		return nil, false, nil
+	}
+	var entrypoint []string
+	if err := json.Unmarshal([]byte(val), &entrypoint); err != nil {
+		return nil, false, fmt.Errorf("invalid docker entrypoint %q: %v", val, err)
+	}
+	if len(entrypoint) == 0 {
+		return nil, false, nil
+	}
+
+	command := append(entrypoint, args...)
+	// same as docker2aci, non-absolute paths are run by the shell
+	if !filepath.IsAbs(command[0]) {
+		var quoted []string
+		for _, s := range command {
+			quoted = append(quoted, shellQuote(s))
+		}
+		command = []string{"/bin/sh", "-c", strings.Join(quoted, " ")}
+	}
+	return command, true, nil
+}
+
+// shellQuote quotes s as a single word for /bin/sh. Unlike double quotes,
+// single quotes keep $, ` and \ from being interpreted by the shell.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// dockerHealthCheckAnnotations returns the health check annotations of an
+// app converted from a docker image with a HEALTHCHECK. Like with docker,
+// the unhealthy apps are not restarted. The timeout of the check is not
+// supported, a check times out after its interval.
+func dockerHealthCheckAnnotations(am *schema.ImageManifest) (types.Annotations, error) {
+	val, ok := am.Annotations.Get(common.DockerHealthcheckAnnotation)
+	if !ok {
+		return nil, nil
+	}
+	var hc dockerHealthConfig
+	if err := json.Unmarshal([]byte(val), &hc); err != nil {
+		return nil, fmt.Errorf("invalid docker healthcheck %q: %v", val, err)
+	}
+	if len(hc.Test) == 0 || hc.Test[0] == "NONE" {
+		return nil, nil
+	}
+
+	var annotations types.Annotations
+	switch hc.Test[0] {
+	case "CMD":
+		if len(hc.Test) < 2 {
+			return nil, fmt.Errorf("invalid docker healthcheck %q: no command", val)
+		}
+		// the exec checks can't have quoted arguments, use the shell when
+		// an argument has spaces
+		quote := false
+		for _, arg := range hc.Test[1:] {
+			if strings.ContainsAny(arg, " \t\n") {
+				quote = true
+			}
+		}
+		if quote {
+			var quoted []string
+			for _, arg := range hc.Test[1:] {
+				quoted = append(quoted, shellQuote(arg))
+			}
+			annotations.Set(common.HealthCheckShellAnnotation, strings.Join(quoted, " "))
+		} else {
+			annotations.Set(common.HealthCheckExecAnnotation, strings.Join(hc.Test[1:], " "))
+		}
+	case "CMD-SHELL":
+		if len(hc.Test) != 2 {
+			return nil, fmt.Errorf("invalid docker healthcheck %q: CMD-SHELL requires a single command", val)
+		}
+		annotations.Set(common.HealthCheckShellAnnotation, hc.Test[1])
+	default:
+		return nil, fmt.Errorf("invalid docker healthcheck %q: unknown test %q", val, hc.Test[0])
+	}
+
+	if hc.Interval > 0 {
+		interval := hc.Interval
+		if interval < time.Second {
+			interval = time.Second
+		}
+		annotations.Set(common.HealthCheckIntervalAnnotation, interval.String())
+	}
+	if hc.Retries > 0 {
+		annotations.Set(common.HealthCheckRetriesAnnotation, strconv.Itoa(hc.Retries))
+	}
+	annotations.Set(common.HealthCheckActionAnnotation, "none")
+
+	return annotations, nil
+}
+
+// hasHealthCheck returns whether the annotations define a health check.
+func hasHealthCheck(annotations types.Annotations) bool {
+	for _, name := range []string{
+		common.HealthCheckExecAnnotation,
+		common.HealthCheckShellAnnotation,
+		common.HealthCheckTCPAnnotation,
+		common.HealthCheckHTTPAnnotation,
+	} {
+		if _, ok := annotations.Get(name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,220 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package stage0
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/common/apps"
+	"github.com/coreos/rkt/common/audit"
+	"github.com/coreos/rkt/pkg/label"
+)
+
+// Prefixes of the names of the volumes overriding the readOnly setting of a
+// volume for some mounts
+const (
+	readOnlyVolumePrefix  = "rkt-ro-"
+	readWriteVolumePrefix = "rkt-rw-"
+)
+
+// mountReadOnly returns the readOnly override of the mount of app at path,
+// the overrides of the app superseding the global ones like its mounts do.
+func mountReadOnly(al *apps.Apps, app *apps.App, path string) *bool {
+	for _, m := range app.Mounts {
+		if m.Path != path {
+			continue
+		}
+		if ro, ok := app.ReadOnlyMounts[path]; ok {
+			return &ro
+		}
+		return nil
+	}
+	if ro, ok := al.ReadOnlyMounts[path]; ok {
+		return &ro
+	}
+	return nil
+}
+
+// overriddenVolumes returns the names of the volumes whose readOnly setting
+// is overridden by at least one mount.
+func overriddenVolumes(al *apps.Apps) map[types.ACName]bool {
+	names := make(map[types.ACName]bool)
+	for _, m := range al.Mounts {
+		if _, ok := al.ReadOnlyMounts[m.Path]; ok {
+			names[m.Volume] = true
+		}
+	}
+	al.Walk(func(app *apps.App) error {
+		for _, m := range app.Mounts {
+			if _, ok := app.ReadOnlyMounts[m.Path]; ok {
+				names[m.Volume] = true
+			}
+		}
+		return nil
+	})
+	return names
+}
+
+// prepareEmptyDirs creates in the pod directory the empty volumes configured
+// with a medium, an owner or a mode, and the ones mounted with a readOnly
+// override, since all the mounts of such a volume must share the same
+// directory. It returns the volumes of the pod, where these empty volumes
+// are replaced by host volumes, and their names: their sources are relative
+// to the pod root, see common.PodVolumesAnnotation. The directories are
+// removed, and the tmpfs unmounted, when the pod is garbage collected.
+func prepareEmptyDirs(cfg PrepareConfig, dir string) ([]types.Volume, []types.ACName, error) {
+	overridden := overriddenVolumes(cfg.Apps)
+
+	var vols []types.Volume
+	var names []types.ACName
+	for _, vol := range cfg.Apps.Volumes {
+		ed, ok := cfg.Apps.EmptyDirs[vol.Name]
+		if vol.Kind != "empty" || (!ok && !overridden[vol.Name]) {
+			vols = append(vols, vol)
+			continue
+		}
+		if !ok {
+			ed = &apps.EmptyDir{Mode: 0755}
+		}
+
+		if err := prepareEmptyDir(cfg, dir, vol.Name, ed); err != nil {
+			return nil, nil, fmt.Errorf("error creating empty volume %q: %v", vol.Name, err)
+		}
+		vols = append(vols, types.Volume{
+			Name:     vol.Name,
+			Kind:     "host",
+			Source:   filepath.Join(common.EmptyDirsPath("/"), vol.Name.String()),
+			ReadOnly: vol.ReadOnly,
+		})
+		names = append(names, vol.Name)
+	}
+	return vols, names, nil
+}
+
+// prepareEmptyDir creates the directory of an empty volume, on its own tmpfs
+// if its medium is memory.
+func prepareEmptyDir(cfg PrepareConfig, dir string, name types.ACName, ed *apps.EmptyDir) error {
+	emptyDirsPath, err := filepath.Abs(common.EmptyDirsPath(dir))
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(emptyDirsPath, name.String())
+	if cfg.DryRun {
+		return nil
+	}
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return err
+	}
+
+	if ed.Medium == apps.EmptyDirMediumMemory {
+		opts := "mode=0700"
+		if ed.Size != "" {
+			opts += ",size=" + ed.Size
+		}
+		opts = label.FormatMountLabel(opts, cfg.MountLabel)
+		if err := syscall.Mount("tmpfs", path, "tmpfs", syscall.MS_NODEV|syscall.MS_NOSUID, opts); err != nil {
+			return fmt.Errorf("error mounting tmpfs: %v", err)
+		}
+		if err := audit.NewLogger(dir, *cfg.UUID).Log(audit.KindMount, "tmpfs", map[string]string{
+			"target": path,
+			"volume": name.String(),
+			"size":   ed.Size,
+		}); err != nil {
+			return err
+		}
+	}
+
+	uid, gid := ed.Uid, ed.Gid
+	if cfg.PrivateUsers != nil {
+		if uid, gid, err = cfg.PrivateUsers.ShiftRange(uid, gid); err != nil {
+			return fmt.Errorf("error shifting the owner: %v", err)
+		}
+	}
+	if err := os.Chown(path, int(uid), int(gid)); err != nil {
+		return fmt.Errorf("error changing the owner: %v", err)
+	}
+	if err := os.Chmod(path, ed.Mode); err != nil {
+		return fmt.Errorf("error changing the mode: %v", err)
+	}
+	return nil
+}
+
+// overrideReadOnlyMounts points the mounts of app with a readOnly override
+// to a volume sharing the source of their volume but with the given
+// readOnly setting. The volumes created this way are appended to aliases,
+// once.
+func overrideReadOnlyMounts(al *apps.Apps, app *apps.App, mounts []schema.Mount, vols []types.Volume, aliases *[]types.Volume) ([]schema.Mount, error) {
+	var res []schema.Mount
+	for _, m := range mounts {
+		ro := mountReadOnly(al, app, m.Path)
+		if ro == nil {
+			res = append(res, m)
+			continue
+		}
+
+		vol := findVolume(vols, m.Volume)
+		if vol == nil {
+			return nil, fmt.Errorf("no volume %q for the readOnly override of mount %q", m.Volume, m.Path)
+		}
+
+		prefix := readWriteVolumePrefix
+		if *ro {
+			prefix = readOnlyVolumePrefix
+		}
+		name := types.ACName(prefix + vol.Name.String())
+		if findVolume(*aliases, name) == nil {
+			alias := *vol
+			alias.Name = name
+			alias.ReadOnly = ro
+			*aliases = append(*aliases, alias)
+		}
+
+		res = append(res, schema.Mount{Volume: name, Path: m.Path})
+	}
+	return res, nil
+}
+
+// aliasedVolumes returns the names of the aliases, created by
+// overrideReadOnlyMounts, of the volumes called names.
+func aliasedVolumes(aliases []types.Volume, names []types.ACName) []types.ACName {
+	var res []types.ACName
+	for _, name := range names {
+		for _, prefix := range []string{readOnlyVolumePrefix, readWriteVolumePrefix} {
+			alias := types.ACName(prefix + name.String())
+			if findVolume(aliases, alias) != nil {
+				res = append(res, alias)
+			}
+		}
+	}
+	return res
+}
+
+// findVolume returns the volume called name in vols, or nil.
+func findVolume(vols []types.Volume, name types.ACName) *types.Volume {
+	for i := range vols {
+		if vols[i].Name == name {
+			return &vols[i]
+		}
+	}
+	return nil
+}
@@ -19,35 +19,73 @@ package stage0
 import (
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"syscall"
 
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/Godeps/_workspace/src/golang.org/x/net/context"
 )
 
+// EnterConfig holds the optional settings of the commands executed in an app
+type EnterConfig struct {
+	Env        []string // NAME=VALUE environment variables, overriding the environment of the app
+	WorkingDir string   // working directory of the command, / if empty
+}
+
 // Enter enters the pod/app by exec()ing the stage1's /enter similar to /init
 // /enter can expect to have its CWD set to the app root.
 // appName and command are supplied to /enter on argv followed by any arguments.
 // stage1Path is the path of the stage1 rootfs
-func Enter(cdir string, podPID int, appName types.ACName, stage1Path string, cmdline []string) error {
+func Enter(cdir string, podPID int, appName types.ACName, stage1Path string, cmdline []string, cfg EnterConfig) error {
 	if err := os.Chdir(cdir); err != nil {
 		return fmt.Errorf("error changing to dir: %v", err)
 	}
 
+	argv, err := getEnterArgv(cdir, podPID, appName, stage1Path, cmdline, cfg)
+	if err != nil {
+		return err
+	}
+	if err := syscall.Exec(argv[0], argv, os.Environ()); err != nil {
+		return fmt.Errorf("error execing enter: %v", err)
+	}
+
+	// never reached
+	return nil
+}
+
+// EnterCommand returns a command that enters the pod/app like Enter does,
+// but as a child process instead of replacing the current one.
+// The command is killed when ctx is done. The caller is responsible for
+// setting up the standard streams of the command and for starting it.
+func EnterCommand(ctx context.Context, cdir string, podPID int, appName types.ACName, stage1Path string, cmdline []string, cfg EnterConfig) (*exec.Cmd, error) {
+	argv, err := getEnterArgv(cdir, podPID, appName, stage1Path, cmdline, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Dir = cdir
+	return cmd, nil
+}
+
+// getEnterArgv returns the argv for the stage1's /enter entrypoint.
+func getEnterArgv(cdir string, podPID int, appName types.ACName, stage1Path string, cmdline []string, cfg EnterConfig) ([]string, error) {
 	ep, err := getStage1Entrypoint(cdir, enterEntrypoint)
 	if err != nil {
-		return fmt.Errorf("error determining 'enter' entrypoint: %v", err)
+		return nil, fmt.Errorf("error determining 'enter' entrypoint: %v", err)
 	}
 
 	argv := []string{filepath.Join(stage1Path, ep)}
 	argv = append(argv, fmt.Sprintf("--pid=%d", podPID))
 	argv = append(argv, fmt.Sprintf("--appname=%s", appName.String()))
+	for _, e := range cfg.Env {
+		argv = append(argv, fmt.Sprintf("--env=%s", e))
+	}
+	if cfg.WorkingDir != "" {
+		argv = append(argv, fmt.Sprintf("--workdir=%s", cfg.WorkingDir))
+	}
 	argv = append(argv, "--")
 	argv = append(argv, cmdline...)
-	if err := syscall.Exec(argv[0], argv, os.Environ()); err != nil {
-		return fmt.Errorf("error execing enter: %v", err)
-	}
-
-	// never reached
-	return nil
+	return argv, nil
 }
@@ -23,12 +23,15 @@ import (
 
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
 	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/pkg/stage1"
 )
 
 const (
-	enterEntrypoint = "coreos.com/rkt/stage1/enter"
-	runEntrypoint   = "coreos.com/rkt/stage1/run"
-	gcEntrypoint    = "coreos.com/rkt/stage1/gc"
+	enterEntrypoint    = stage1.EnterEntrypoint
+	runEntrypoint      = stage1.RunEntrypoint
+	gcEntrypoint       = stage1.GCEntrypoint
+	pauseEntrypoint    = stage1.PauseEntrypoint
+	mdsTokenEntrypoint = stage1.MDSTokenEntrypoint
 )
 
 // getStage1Entrypoint retrieves the named entrypoint from the stage1 manifest for a given pod
@@ -43,9 +46,5 @@ func getStage1Entrypoint(cdir string, entrypoint string) (string, error) {
 		return "", fmt.Errorf("error unmarshaling stage1 manifest: %v", err)
 	}
 
-	if ep, ok := s1m.Annotations.Get(entrypoint); ok {
-		return ep, nil
-	}
-
-	return "", fmt.Errorf("entrypoint %q not found", entrypoint)
+	return stage1.GetEntrypoint(&s1m, entrypoint)
 }
@@ -0,0 +1,74 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package stage0
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+)
+
+// prepareNetworkVolumes replaces in vols the volumes of kind nfs and cifs by
+// empty volumes, and returns the value of the annotation describing their
+// file systems to stage1, which mounts them in the pod. It is empty if
+// there are none.
+func prepareNetworkVolumes(cfg PrepareConfig, vols []types.Volume) ([]types.Volume, string, error) {
+	overridden := overriddenVolumes(cfg.Apps)
+	secrets := make(map[string]bool)
+	for _, sec := range cfg.Apps.Secrets {
+		secrets[sec.Name.String()] = true
+	}
+
+	var (
+		res     []types.Volume
+		netVols []common.NetworkVolume
+	)
+	for _, vol := range vols {
+		if !common.IsNetworkVolumeKind(vol.Kind) {
+			res = append(res, vol)
+			continue
+		}
+		nv, ok := cfg.Apps.NetworkVolumes[vol.Name]
+		if !ok {
+			return nil, "", fmt.Errorf("no source for %s volume %q", vol.Kind, vol.Name)
+		}
+		if nv.Secret != "" && !secrets[nv.Secret] {
+			return nil, "", fmt.Errorf("no secret %q for the credentials of volume %q", nv.Secret, vol.Name)
+		}
+		// the alias of the volume would be another empty volume
+		if overridden[vol.Name] {
+			return nil, "", fmt.Errorf("the readOnly setting of the mounts of %s volume %q cannot be overridden", vol.Kind, vol.Name)
+		}
+		netVols = append(netVols, *nv)
+		res = append(res, types.Volume{
+			Name:     vol.Name,
+			Kind:     "empty",
+			ReadOnly: vol.ReadOnly,
+		})
+	}
+	if len(netVols) == 0 {
+		return res, "", nil
+	}
+
+	b, err := json.Marshal(netVols)
+	if err != nil {
+		return nil, "", err
+	}
+	return res, string(b), nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package stage0
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+)
+
+// PodOverrides are the changes made to the pod manifest of a prepared pod
+// when it is run. They do not alter the rendered rootfs of the apps.
+type PodOverrides struct {
+	ExplicitEnv []string            `json:"env,omitempty"`   // set these environment variables for all the apps
+	Ports       []types.ExposedPort `json:"ports,omitempty"` // expose these ports, replacing the ones with the same name
+}
+
+// IsEmpty returns whether the overrides do not change the pod manifest.
+func (ov PodOverrides) IsEmpty() bool {
+	return len(ov.ExplicitEnv) == 0 && len(ov.Ports) == 0
+}
+
+// OverridePodManifest applies the overrides to the pod manifest of the
+// prepared pod in dir, and records them in an annotation of the pod.
+func OverridePodManifest(dir string, ov PodOverrides) error {
+	if ov.IsEmpty() {
+		return nil
+	}
+
+	fn := common.PodManifestPath(dir)
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return fmt.Errorf("error reading pod manifest: %v", err)
+	}
+	pm := &schema.PodManifest{}
+	if err := pm.UnmarshalJSON(b); err != nil {
+		return fmt.Errorf("error unmarshaling pod manifest: %v", err)
+	}
+
+	if err := overridePorts(pm, ov.Ports); err != nil {
+		return err
+	}
+	for i := range pm.Apps {
+		if app := pm.Apps[i].App; app != nil {
+			MergeEnvs(&app.Environment, false, ov.ExplicitEnv)
+		}
+	}
+
+	ovb, err := json.Marshal(ov)
+	if err != nil {
+		return fmt.Errorf("error marshalling overrides: %v", err)
+	}
+	pm.Annotations.Set(common.RunPreparedOverridesAnnotation, string(ovb))
+
+	pmb, err := json.Marshal(pm)
+	if err != nil {
+		return fmt.Errorf("error marshalling pod manifest: %v", err)
+	}
+	// the pod manifest is replaced atomically, so the pod is never left
+	// with a partial one
+	tmp := fn + ".tmp"
+	if err := ioutil.WriteFile(tmp, pmb, defaultRegularFilePerm); err != nil {
+		return fmt.Errorf("error writing pod manifest: %v", err)
+	}
+	if err := os.Rename(tmp, fn); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error writing pod manifest: %v", err)
+	}
+	return nil
+}
+
+// overridePorts sets the given ports in the pod manifest, replacing the
+// exposed ports with the same name. The ports must be declared by an app of
+// the pod, when the pod manifest contains the app manifests.
+func overridePorts(pm *schema.PodManifest, ports []types.ExposedPort) error {
+	declared := make(map[types.ACName]bool)
+	checkDeclared := true
+	for _, ra := range pm.Apps {
+		if ra.App == nil {
+			checkDeclared = false
+			break
+		}
+		for _, p := range ra.App.Ports {
+			declared[p.Name] = true
+		}
+	}
+
+	for _, port := range ports {
+		if checkDeclared && !declared[port.Name] {
+			return fmt.Errorf("no app of the pod declares the port %q", port.Name)
+		}
+		replaced := false
+		for i := range pm.Ports {
+			if pm.Ports[i].Name == port.Name {
+				pm.Ports[i] = port
+				replaced = true
+			}
+		}
+		if !replaced {
+			pm.Ports = append(pm.Ports, port)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package stage0
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+)
+
+// Pause pauses, or resumes if resume is true, the running pod by executing
+// the stage1's pause entrypoint with its CWD set to the pod root, and keeps
+// track of the paused pods in their directory.
+// stage1Path is the path of the stage1 rootfs
+func Pause(pdir string, uuid *types.UUID, stage1Path string, resume bool, debug bool) error {
+	ep, err := getStage1Entrypoint(pdir, pauseEntrypoint)
+	if err != nil {
+		return fmt.Errorf("the stage1 of the pod does not support pausing: %v", err)
+	}
+
+	args := []string{filepath.Join(stage1Path, ep)}
+	if debug {
+		args = append(args, "--debug")
+	}
+	if resume {
+		args = append(args, "--resume")
+	}
+	args = append(args, uuid.String())
+
+	c := exec.Cmd{
+		Path:   args[0],
+		Args:   args,
+		Stderr: os.Stderr,
+		Dir:    pdir,
+	}
+	if err := c.Run(); err != nil {
+		return err
+	}
+
+	pausedPath := filepath.Join(pdir, common.PausedFilename)
+	if resume {
+		if err := os.Remove(pausedPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return ioutil.WriteFile(pausedPath, nil, 0644)
+}
@@ -0,0 +1,197 @@
+// Copyright 2014 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package stage0
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/coreos/rkt/common"
+)
+
+const binfmtMiscDir = "/proc/sys/fs/binfmt_misc"
+
+// EmulatedOSArch are the os and arch labels of the images which can run on
+// the host with qemu-user, when requested.
+var EmulatedOSArch = map[string][]string{
+	"linux": []string{"aarch64", "armv6l", "armv7l"},
+}
+
+// qemuUserTarget is the qemu-user emulator of an arch, and the binfmt_misc
+// magic and mask matching its ELF executables, from qemu-binfmt-conf.sh.
+type qemuUserTarget struct {
+	name  string
+	magic string
+	mask  string
+}
+
+var qemuUserTargets = map[string]qemuUserTarget{
+	"aarch64": {
+		name:  "aarch64",
+		magic: `\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\xb7\x00`,
+		mask:  `\xff\xff\xff\xff\xff\xff\xff\x00\xff\xff\xff\xff\xff\xff\xff\xff\xfe\xff\xff\xff`,
+	},
+	"armv6l": {
+		name:  "arm",
+		magic: `\x7fELF\x01\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\x28\x00`,
+		mask:  `\xff\xff\xff\xff\xff\xff\xff\x00\xff\xff\xff\xff\xff\xff\xff\xff\xfe\xff\xff\xff`,
+	},
+	"armv7l": {
+		name:  "arm",
+		magic: `\x7fELF\x01\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\x28\x00`,
+		mask:  `\xff\xff\xff\xff\xff\xff\xff\x00\xff\xff\xff\xff\xff\xff\xff\xff\xfe\xff\xff\xff`,
+	},
+}
+
+// isEmulatedArch returns whether the image with the given os and arch labels
+// can run with qemu-user.
+func isEmulatedArch(imgOS, arch string) bool {
+	for _, a := range EmulatedOSArch[imgOS] {
+		if a == arch {
+			return true
+		}
+	}
+	return false
+}
+
+// addQemuUserArch records in the pod that its apps of the given arch run
+// with qemu-user.
+func addQemuUserArch(cdir string, arch string) error {
+	archs, err := readQemuUserArchs(cdir)
+	if err != nil {
+		return err
+	}
+	for _, a := range archs {
+		if a == arch {
+			return nil
+		}
+	}
+	archs = append(archs, arch)
+	data := []byte(strings.Join(archs, "\n") + "\n")
+	return ioutil.WriteFile(filepath.Join(cdir, common.QemuUserArchsFilename), data, defaultRegularFilePerm)
+}
+
+// readQemuUserArchs returns the archs of the apps of the pod running with
+// qemu-user.
+func readQemuUserArchs(cdir string) ([]string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(cdir, common.QemuUserArchsFilename))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(data)), nil
+}
+
+// binfmtRegistration returns the binfmt_misc registration of the qemu-user
+// emulator. The F flag makes the kernel open the emulator when it is
+// registered, so it does not need to exist in the file systems of the apps.
+func binfmtRegistration(entry string, t qemuUserTarget, interpreter string) string {
+	return fmt.Sprintf(":%s:M::%s:%s:%s:F", entry, t.magic, t.mask, interpreter)
+}
+
+// setupQemuUser makes sure the executables of arch run with the qemu-user
+// emulator of the host, registering qemu-ARCH-static in binfmt_misc unless
+// an emulator is already registered.
+func setupQemuUser(arch string) error {
+	t, ok := qemuUserTargets[arch]
+	if !ok {
+		return fmt.Errorf("no qemu-user emulator for arch %q", arch)
+	}
+	if _, err := os.Stat(filepath.Join(binfmtMiscDir, "register")); err != nil {
+		return fmt.Errorf("binfmt_misc is not available, it must be mounted on %s: %v", binfmtMiscDir, err)
+	}
+
+	// the entry of the distributions (qemu-user-static, systemd-binfmt)
+	// or the one registered by a previous pod
+	for _, entry := range []string{"qemu-" + t.name, "rkt-qemu-" + t.name} {
+		data, err := ioutil.ReadFile(filepath.Join(binfmtMiscDir, entry))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !binfmtEntryUsable(string(data)) {
+			return fmt.Errorf("the binfmt_misc entry %q must be enabled and have the F flag to run the apps of the pod", entry)
+		}
+		return nil
+	}
+
+	interpreter, err := exec.LookPath("qemu-" + t.name + "-static")
+	if err != nil {
+		return fmt.Errorf("cannot find the qemu-user emulator of arch %q: %v", arch, err)
+	}
+	reg := binfmtRegistration("rkt-qemu-"+t.name, t, interpreter)
+	if err := ioutil.WriteFile(filepath.Join(binfmtMiscDir, "register"), []byte(reg), 0200); err != nil {
+		return fmt.Errorf("error registering %s in binfmt_misc: %v", interpreter, err)
+	}
+	return nil
+}
+
+// QemuUserArchs returns the archs of the apps of the pod in cdir running
+// with qemu-user.
+func QemuUserArchs(cdir string) ([]string, error) {
+	return readQemuUserArchs(cdir)
+}
+
+// UnregisterQemuUser removes the binfmt_misc entries registered by rkt for
+// the qemu-user emulators which no arch in inUse needs anymore. The entries
+// of the distributions are left alone.
+func UnregisterQemuUser(inUse []string) error {
+	needed := make(map[string]bool)
+	for _, arch := range inUse {
+		if t, ok := qemuUserTargets[arch]; ok {
+			needed[t.name] = true
+		}
+	}
+	for _, t := range qemuUserTargets {
+		if needed[t.name] {
+			continue
+		}
+		entry := filepath.Join(binfmtMiscDir, "rkt-qemu-"+t.name)
+		if _, err := os.Stat(entry); err != nil {
+			continue
+		}
+		// writing -1 to an entry removes it
+		if err := ioutil.WriteFile(entry, []byte("-1"), 0200); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error unregistering %s from binfmt_misc: %v", entry, err)
+		}
+	}
+	return nil
+}
+
+// binfmtEntryUsable returns whether a binfmt_misc entry, read from
+// /proc/sys/fs/binfmt_misc/ENTRY, is enabled and opens its interpreter when
+// registered.
+func binfmtEntryUsable(entry string) bool {
+	enabled, fixBinary := false, false
+	for _, line := range strings.Split(entry, "\n") {
+		switch {
+		case line == "enabled":
+			enabled = true
+		case strings.HasPrefix(line, "flags: "):
+			fixBinary = strings.Contains(strings.TrimPrefix(line, "flags: "), "F")
+		}
+	}
+	return enabled && fixBinary
+}
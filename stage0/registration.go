@@ -24,6 +24,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"os/exec"
 	"path"
 	"path/filepath"
 	"syscall"
@@ -124,6 +125,59 @@ func unregisterPod(root string, uuid *types.UUID) error {
 	}
 }
 
+// RotateMDSToken replaces the metadata service token of the running pod in
+// pdir, and re-issues the new token to the apps of the pod with the stage1.
+// The running apps only get the new token when they are restarted, so the
+// previous token is still accepted by the metadata service until the pod stops
+// when grace is negative, or for the grace period otherwise.
+func RotateMDSToken(pdir string, uuid *types.UUID, stage1Path string, grace time.Duration, debug bool) error {
+	ep, err := getStage1Entrypoint(pdir, mdsTokenEntrypoint)
+	if err != nil {
+		return fmt.Errorf("the stage1 of the pod does not support rotating the metadata service token: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(pdir, mdsRegisteredFile)); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("the pod is not registered with the metadata service")
+		}
+		return err
+	}
+
+	token, err := generateMDSToken()
+	if err != nil {
+		return fmt.Errorf("failed to generate MDS token: %v", err)
+	}
+
+	pth := fmt.Sprintf("/pods/%v/token?token=%v", uuid, token)
+	if grace >= 0 {
+		pth += fmt.Sprintf("&grace=%v", grace)
+	}
+	if err := httpRequest("POST", pth, nil); err != nil {
+		return fmt.Errorf("failed to rotate the token with metadata svc: %v", err)
+	}
+
+	args := []string{filepath.Join(stage1Path, ep)}
+	if debug {
+		args = append(args, "--debug")
+	}
+	args = append(args, "--mds-token="+token, uuid.String())
+
+	c := exec.Cmd{
+		Path:   args[0],
+		Args:   args,
+		Stderr: os.Stderr,
+		Dir:    pdir,
+	}
+	if err := c.Run(); err != nil {
+		if grace >= 0 {
+			return fmt.Errorf("failed to re-issue the token to the pod, the previous token expires after %v: %v", grace, err)
+		}
+		return fmt.Errorf("failed to re-issue the token to the pod: %v", err)
+	}
+
+	return nil
+}
+
 func generateMDSToken() (string, error) {
 	bytes := make([]byte, 16)
 	_, err := rand.Read(bytes)
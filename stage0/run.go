@@ -37,13 +37,21 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/pkg/acirenderer"
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
 	"github.com/coreos/rkt/common"
 	"github.com/coreos/rkt/common/apps"
+	"github.com/coreos/rkt/common/audit"
+	"github.com/coreos/rkt/common/iolimit"
+	"github.com/coreos/rkt/common/podtemplate"
+	"github.com/coreos/rkt/common/rlimit"
+	"github.com/coreos/rkt/common/seccomp"
+	"github.com/coreos/rkt/common/timing"
 	"github.com/coreos/rkt/pkg/aci"
 	"github.com/coreos/rkt/pkg/fileutil"
 	"github.com/coreos/rkt/pkg/label"
+	"github.com/coreos/rkt/pkg/stage1"
 	"github.com/coreos/rkt/pkg/sys"
 	"github.com/coreos/rkt/pkg/uid"
 	"github.com/coreos/rkt/store"
@@ -66,13 +74,21 @@ var debugEnabled bool
 // configuration parameters required by Prepare
 type PrepareConfig struct {
 	CommonConfig
-	Apps         *apps.Apps          // apps to prepare
-	InheritEnv   bool                // inherit parent environment into apps
-	ExplicitEnv  []string            // always set these environment variables for all the apps
-	Ports        []types.ExposedPort // list of ports that rkt will expose on the host
-	UseOverlay   bool                // prepare pod with overlay fs
-	PodManifest  string              // use the pod manifest specified by the user, this will ignore flags such as '--volume', '--port', etc.
-	PrivateUsers *uid.UidRange       // User namespaces
+	Apps            *apps.Apps          // apps to prepare
+	InheritEnv      bool                // inherit parent environment into apps
+	ExplicitEnv     []string            // always set these environment variables for all the apps
+	Ports           []types.ExposedPort // list of ports that rkt will expose on the host
+	UseOverlay      bool                // prepare pod with overlay fs
+	NoOverlayReason string              // why the pod is not prepared with overlay fs, recorded in the pod
+	PodManifest     string              // use the pod manifest specified by the user, this will ignore flags such as '--volume', '--port', etc.
+	PodManifestVars map[string]string   // if set, the pod manifest is a template rendered with these variables
+	PrivateUsers    *uid.UidRange       // User namespaces
+	Annotations     types.Annotations   // annotations of the pod
+	AuditJournal    bool                // send the audit events of the pod to the journal too
+	QemuUser        bool                // run the apps built for another arch with qemu-user
+	VolumeDrivers   map[string][]string // commands of the volume drivers mounting the plugin volumes, by name
+	DryRun          bool                // compute the pod manifest without touching the host, see PlanPodManifest
+	Expiration      time.Duration       // how long the pod stays prepared before being garbage collected, 0 for the gc default
 }
 
 // configuration parameters needed by Run
@@ -85,6 +101,8 @@ type RunConfig struct {
 	Apps        schema.AppList // applications (prepare gets them via Apps)
 	LocalConfig string         // Path to local configuration
 	RktGid      int            // group id of the 'rkt' group, -1 if there's no rkt group.
+	TPMMeasure  bool           // whether to measure the images in a TPM PCR
+	TPMPCR      int            // PCR extended with the measurements of the images
 }
 
 // configuration shared by both Run and Prepare
@@ -93,8 +111,12 @@ type CommonConfig struct {
 	Stage1Image  types.Hash   // stage1 image containing usable /init and /enter entrypoints
 	UUID         *types.UUID  // UUID of the pod
 	Debug        bool
-	MountLabel   string // selinux label to use for fs
-	ProcessLabel string // selinux label to use for process
+	MountLabel   string           // selinux label to use for fs
+	ProcessLabel string           // selinux label to use for process
+	Timings      *timing.Recorder // records the phases of the startup of the pod, if not nil
+	// Stage1Digests are the image IDs of the only stage1 images allowed,
+	// any stage1 image is allowed if empty
+	Stage1Digests []string
 }
 
 func init() {
@@ -158,6 +180,50 @@ func deduplicateMPs(mounts []schema.Mount) []schema.Mount {
 	return res
 }
 
+// setRlimits sets the rlimits isolator of app, the given limits overriding
+// the ones of the image.
+func setRlimits(app *types.App, limits rlimit.Limits) error {
+	var isolators types.Isolators
+	for _, i := range app.Isolators {
+		if i.Name == rlimit.IsolatorName {
+			if r, ok := i.Value().(*rlimit.Rlimits); ok {
+				limits = r.Limits().Merge(limits)
+			}
+			continue
+		}
+		isolators = append(isolators, i)
+	}
+
+	i, err := limits.Isolator()
+	if err != nil {
+		return err
+	}
+	app.Isolators = append(isolators, *i)
+	return nil
+}
+
+// setIOLimits sets the io isolator of app, the given limits overriding the
+// ones of the image.
+func setIOLimits(app *types.App, limits iolimit.Limits) error {
+	var isolators types.Isolators
+	for _, i := range app.Isolators {
+		if i.Name == iolimit.IsolatorName {
+			if l, ok := i.Value().(*iolimit.IOLimits); ok {
+				limits = l.Limits().Merge(limits)
+			}
+			continue
+		}
+		isolators = append(isolators, i)
+	}
+
+	i, err := limits.Isolator()
+	if err != nil {
+		return err
+	}
+	app.Isolators = append(isolators, *i)
+	return nil
+}
+
 // MergeMounts combines the global and per-app mount slices
 func MergeMounts(mounts []schema.Mount, appMounts []schema.Mount) []schema.Mount {
 	ml := append(appMounts, mounts...)
@@ -179,6 +245,28 @@ func generatePodManifest(cfg PrepareConfig, dir string) ([]byte, error) {
 	}
 	pm.ACVersion = *v
 
+	secretVols, secretMounts, err := prepareSecrets(cfg, dir)
+	if err != nil {
+		return nil, err
+	}
+	vols, podVols, err := prepareEmptyDirs(cfg, dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, vol := range secretVols {
+		podVols = append(podVols, vol.Name)
+	}
+	vols, pluginVols, err := preparePluginVolumes(cfg, dir, vols)
+	if err != nil {
+		return nil, err
+	}
+	podVols = append(podVols, pluginVols...)
+	vols, netVols, err := prepareNetworkVolumes(cfg, vols)
+	if err != nil {
+		return nil, err
+	}
+	var aliasVols []types.Volume
+
 	if err := cfg.Apps.Walk(func(app *apps.App) error {
 		img := app.ImageID
 
@@ -190,8 +278,12 @@ func generatePodManifest(cfg PrepareConfig, dir string) ([]byte, error) {
 		if err != nil {
 			return fmt.Errorf("error converting image name to app name: %v", err)
 		}
-		if err := prepareAppImage(cfg, *appName, img, dir, cfg.UseOverlay); err != nil {
-			return fmt.Errorf("error setting up image %s: %v", img, err)
+		if !cfg.DryRun {
+			endRender := cfg.Timings.Start(timing.SpanRenderApp, map[string]string{"app": appName.String()})
+			if err := prepareAppImage(cfg, *appName, img, dir, cfg.UseOverlay); err != nil {
+				return fmt.Errorf("error setting up image %s: %v", img, err)
+			}
+			endRender()
 		}
 		if pm.Apps.Get(*appName) != nil {
 			return fmt.Errorf("error: multiple apps with name %s", am.Name)
@@ -199,6 +291,10 @@ func generatePodManifest(cfg PrepareConfig, dir string) ([]byte, error) {
 		if am.App == nil && app.Exec == "" {
 			return fmt.Errorf("error: image %s has no app section and --exec argument is not provided", img)
 		}
+		mounts, err := overrideReadOnlyMounts(cfg.Apps, app, MergeMounts(cfg.Apps.Mounts, app.Mounts), vols, &aliasVols)
+		if err != nil {
+			return err
+		}
 		ra := schema.RuntimeApp{
 			// TODO(vc): leverage RuntimeApp.Name for disambiguating the apps
 			Name: *appName,
@@ -209,7 +305,7 @@ func generatePodManifest(cfg PrepareConfig, dir string) ([]byte, error) {
 				Labels: am.Labels,
 			},
 			Annotations: am.Annotations,
-			Mounts:      MergeMounts(cfg.Apps.Mounts, app.Mounts),
+			Mounts:      append(mounts, secretMounts...),
 		}
 
 		if execOverride := app.Exec; execOverride != "" {
@@ -224,12 +320,76 @@ func generatePodManifest(cfg PrepareConfig, dir string) ([]byte, error) {
 		}
 
 		if execAppends := app.Args; execAppends != nil {
-			ra.App.Exec = append(ra.App.Exec, execAppends...)
+			dexec, ok, err := dockerExec(am, execAppends)
+			if err != nil {
+				return fmt.Errorf("error getting the command of %s: %v", img, err)
+			}
+			if ok && app.Exec == "" {
+				ra.App.Exec = dexec
+			} else {
+				ra.App.Exec = append(ra.App.Exec, execAppends...)
+			}
+		}
+
+		if !hasHealthCheck(ra.Annotations) {
+			hcAnnotations, err := dockerHealthCheckAnnotations(am)
+			if err != nil {
+				return fmt.Errorf("error getting the health check of %s: %v", img, err)
+			}
+			for _, a := range hcAnnotations {
+				ra.Annotations.Set(a.Name, a.Value)
+			}
 		}
 
 		if cfg.InheritEnv || len(cfg.ExplicitEnv) > 0 {
 			MergeEnvs(&ra.App.Environment, cfg.InheritEnv, cfg.ExplicitEnv)
 		}
+
+		if limits := cfg.Apps.Rlimits.Merge(app.Rlimits); len(limits) > 0 {
+			if err := setRlimits(ra.App, limits); err != nil {
+				return fmt.Errorf("error setting the resource limits of %s: %v", img, err)
+			}
+		}
+
+		if limits := cfg.Apps.IOLimits.Merge(app.IOLimits); len(limits) > 0 {
+			if err := setIOLimits(ra.App, limits); err != nil {
+				return fmt.Errorf("error setting the IO limits of %s: %v", img, err)
+			}
+		}
+
+		for _, opt := range []struct {
+			annotation types.ACIdentifier
+			val        *bool
+		}{
+			{common.ReadOnlyRootFSAnnotation, app.ReadOnlyRootFS},
+			{common.NoNewPrivilegesAnnotation, app.NoNewPrivileges},
+			{common.MaskProcPathsAnnotation, app.MaskProcPaths},
+			{common.ReadOnlySysAnnotation, app.ReadOnlySys},
+			{common.OneShotAnnotation, app.OneShot},
+		} {
+			if opt.val != nil {
+				ra.Annotations.Set(opt.annotation, strconv.FormatBool(*opt.val))
+			}
+		}
+
+		if app.SeccompProfile != "" {
+			b, err := ioutil.ReadFile(app.SeccompProfile)
+			if err != nil {
+				return fmt.Errorf("error reading the seccomp profile of %s: %v", img, err)
+			}
+			profile, err := seccomp.ParseProfile(b)
+			if err != nil {
+				return fmt.Errorf("error in the seccomp profile of %s: %v", img, err)
+			}
+			ra.Annotations.Set(common.SeccompProfileAnnotation, profile.String())
+		}
+
+		if app.AppArmor != "" {
+			if err := checkAppArmorProfile(app.AppArmor); err != nil {
+				return fmt.Errorf("error setting the AppArmor profile of %s: %v", img, err)
+			}
+			ra.Annotations.Set(common.AppArmorProfileAnnotation, app.AppArmor)
+		}
 		pm.Apps = append(pm.Apps, ra)
 		return nil
 	}); err != nil {
@@ -238,8 +398,23 @@ func generatePodManifest(cfg PrepareConfig, dir string) ([]byte, error) {
 
 	// TODO(jonboulle): check that app mountpoint expectations are
 	// satisfied here, rather than waiting for stage1
-	pm.Volumes = cfg.Apps.Volumes
+	pm.Volumes = append(append(vols, aliasVols...), secretVols...)
 	pm.Ports = cfg.Ports
+	pm.Annotations = cfg.Annotations
+	if netVols != "" {
+		pm.Annotations.Set(common.NetworkVolumesAnnotation, netVols)
+	}
+	podVols = append(podVols, aliasedVolumes(aliasVols, podVols)...)
+	if len(podVols) > 0 {
+		names := make([]string, len(podVols))
+		for i, name := range podVols {
+			names[i] = name.String()
+		}
+		pm.Annotations.Set(common.PodVolumesAnnotation, strings.Join(names, ","))
+	}
+	if !cfg.DryRun {
+		pm.Annotations.Set(common.Stage1DigestAnnotation, cfg.Stage1Image.String())
+	}
 
 	pmb, err := json.Marshal(pm)
 	if err != nil {
@@ -248,8 +423,8 @@ func generatePodManifest(cfg PrepareConfig, dir string) ([]byte, error) {
 	return pmb, nil
 }
 
-// validatePodManifest reads the user-specified pod manifest, prepares the app images
-// and validates the pod manifest. If the pod manifest passes validation, it returns
+// validatePodManifest reads the user-specified pod manifest, renders it if it is
+// a template, prepares the app images and validates the pod manifest. If the pod manifest passes validation, it returns
 // the manifest as []byte.
 // TODO(yifan): More validation in the future.
 func validatePodManifest(cfg PrepareConfig, dir string) ([]byte, error) {
@@ -257,6 +432,11 @@ func validatePodManifest(cfg PrepareConfig, dir string) ([]byte, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error reading pod manifest: %v", err)
 	}
+	if len(cfg.PodManifestVars) > 0 {
+		if pmb, err = podtemplate.Render(pmb, cfg.PodManifestVars); err != nil {
+			return nil, err
+		}
+	}
 	var pm schema.PodManifest
 	if err := json.Unmarshal(pmb, &pm); err != nil {
 		return nil, fmt.Errorf("error unmarshaling pod manifest: %v", err)
@@ -273,8 +453,10 @@ func validatePodManifest(cfg PrepareConfig, dir string) ([]byte, error) {
 		if err != nil {
 			return nil, fmt.Errorf("error getting the image manifest from store: %v", err)
 		}
-		if err := prepareAppImage(cfg, ra.Name, img.ID, dir, cfg.UseOverlay); err != nil {
-			return nil, fmt.Errorf("error setting up image %s: %v", img, err)
+		if !cfg.DryRun {
+			if err := prepareAppImage(cfg, ra.Name, img.ID, dir, cfg.UseOverlay); err != nil {
+				return nil, fmt.Errorf("error setting up image %s: %v", img, err)
+			}
 		}
 		if _, ok := appNames[ra.Name]; ok {
 			return nil, fmt.Errorf("multiple apps with same name %s", ra.Name)
@@ -284,18 +466,62 @@ func validatePodManifest(cfg PrepareConfig, dir string) ([]byte, error) {
 			return nil, fmt.Errorf("no app section in the pod manifest or the image manifest")
 		}
 	}
+
+	if !cfg.DryRun {
+		pm.Annotations.Set(common.Stage1DigestAnnotation, cfg.Stage1Image.String())
+	}
+	pmb, err = json.Marshal(pm)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling pod manifest: %v", err)
+	}
 	return pmb, nil
 }
 
+// PlanPodManifest returns the pod manifest of the pod which would be
+// prepared in dir with cfg, without touching the host: the images are not
+// rendered, the secrets are not read, and the secrets, the empty volumes and
+// the plugin volumes are neither written nor mounted, only their paths are
+// set in the volumes. The stage1 image is not resolved, so the manifest has
+// no stage1 digest annotation.
+func PlanPodManifest(cfg PrepareConfig, dir string) (*schema.PodManifest, error) {
+	cfg.DryRun = true
+
+	var pmb []byte
+	var err error
+	if cfg.PodManifest != "" {
+		pmb, err = validatePodManifest(cfg, dir)
+	} else {
+		pmb, err = generatePodManifest(cfg, dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	pm := &schema.PodManifest{}
+	if err := json.Unmarshal(pmb, pm); err != nil {
+		return nil, fmt.Errorf("error unmarshaling pod manifest: %v", err)
+	}
+	return pm, nil
+}
+
 // Prepare sets up a pod based on the given config.
 func Prepare(cfg PrepareConfig, dir string, uuid *types.UUID) error {
 	if err := os.MkdirAll(common.AppsInfoPath(dir), defaultRegularDirPerm); err != nil {
 		return fmt.Errorf("error creating apps info directory: %v", err)
 	}
+	if cfg.AuditJournal {
+		if err := audit.EnableJournal(dir); err != nil {
+			return fmt.Errorf("error enabling the audit journal: %v", err)
+		}
+	}
+	if err := checkStage1Digest(cfg.CommonConfig, cfg.Stage1Image); err != nil {
+		return err
+	}
 	debug("Preparing stage1")
+	endRender := cfg.Timings.Start(timing.SpanRenderStage1, nil)
 	if err := prepareStage1Image(cfg, cfg.Stage1Image, dir, cfg.UseOverlay); err != nil {
 		return fmt.Errorf("error preparing stage1: %v", err)
 	}
+	endRender()
 
 	var pmb []byte
 	var err error
@@ -321,6 +547,18 @@ func Prepare(cfg PrepareConfig, dir string, uuid *types.UUID) error {
 			return fmt.Errorf("error writing overlay marker file: %v", err)
 		}
 		defer f.Close()
+	} else if cfg.NoOverlayReason != "" {
+		// record why overlay is not used, for rkt status
+		if err := ioutil.WriteFile(filepath.Join(dir, common.OverlayDisabledFilename), []byte(cfg.NoOverlayReason), defaultRegularFilePerm); err != nil {
+			return fmt.Errorf("error writing overlay disabled file: %v", err)
+		}
+	}
+
+	if cfg.Expiration > 0 {
+		// record when the pod expires if it is not run, for rkt gc
+		if err := ioutil.WriteFile(filepath.Join(dir, common.PreparedExpirationFilename), []byte(cfg.Expiration.String()), defaultRegularFilePerm); err != nil {
+			return fmt.Errorf("error writing prepared expiration file: %v", err)
+		}
 	}
 
 	if cfg.PrivateUsers.Shift > 0 {
@@ -332,6 +570,12 @@ func Prepare(cfg PrepareConfig, dir string, uuid *types.UUID) error {
 		}
 	}
 
+	// the report only helps diagnosing slow starts, the pod is fine
+	// without it
+	if err := cfg.Timings.Flush(dir); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
 	return nil
 }
 
@@ -376,7 +620,22 @@ func Run(cfg RunConfig, dir string, dataDir string) {
 		log.Fatalf("error: %v", err)
 	}
 
+	// the pinned stage1 images may have changed since the pod was
+	// prepared
+	s1ID, err := ioutil.ReadFile(filepath.Join(dir, common.Stage1ImageIDFilename))
+	if err != nil {
+		log.Fatalf("error reading stage1 image ID: %v", err)
+	}
+	s1img, err := types.NewHash(string(s1ID))
+	if err != nil {
+		log.Fatalf("invalid stage1 image ID: %v", err)
+	}
+	if err := checkStage1Digest(cfg.CommonConfig, *s1img); err != nil {
+		log.Fatalf("error: %v", err)
+	}
+
 	debug("Setting up stage1")
+	endSetup := cfg.Timings.Start(timing.SpanSetupImages, nil)
 	if err := setupStage1Image(cfg, dir, useOverlay); err != nil {
 		log.Fatalf("error setting up stage1: %v", err)
 	}
@@ -387,6 +646,14 @@ func Run(cfg RunConfig, dir string, dataDir string) {
 			log.Fatalf("error setting up app image: %v", err)
 		}
 	}
+	endSetup()
+
+	if cfg.TPMMeasure {
+		debug("Measuring the images in the TPM")
+		if err := measureImages(cfg, dir); err != nil {
+			log.Fatalf("error measuring the images: %v", err)
+		}
+	}
 
 	destRootfs := common.Stage1RootfsPath(dir)
 	flavor, err := os.Readlink(filepath.Join(destRootfs, "flavor"))
@@ -400,6 +667,20 @@ func Run(cfg RunConfig, dir string, dataDir string) {
 		}
 	}
 
+	qemuUserArchs, err := readQemuUserArchs(dir)
+	if err != nil {
+		log.Fatalf("error reading the archs of the apps: %v", err)
+	}
+	if len(qemuUserArchs) > 0 && flavor == "kvm" {
+		log.Fatalf("the apps built for another arch cannot run with qemu-user in the kvm flavor")
+	}
+	for _, arch := range qemuUserArchs {
+		debug("Setting up qemu-user for arch %s", arch)
+		if err := setupQemuUser(arch); err != nil {
+			log.Fatalf("error setting up qemu-user: %v", err)
+		}
+	}
+
 	if err := os.Setenv(common.EnvLockFd, fmt.Sprintf("%v", cfg.LockFd)); err != nil {
 		log.Fatalf("setting lock fd environment: %v", err)
 	}
@@ -408,6 +689,17 @@ func Run(cfg RunConfig, dir string, dataDir string) {
 		log.Fatalf("setting SELinux context environment: %v", err)
 	}
 
+	// the exec of stage1 is timed by stage1, from the start time of the
+	// pod
+	if err := cfg.Timings.Flush(dir); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	started := time.Now().Format(time.RFC3339Nano)
+	if err := ioutil.WriteFile(filepath.Join(dir, common.StartedFilename), []byte(started), defaultRegularFilePerm); err != nil {
+		log.Fatalf("error writing the start time of the pod: %v", err)
+	}
+
 	debug("Pivoting to filesystem %s", dir)
 	if err := os.Chdir(dir); err != nil {
 		log.Fatalf("failed changing to dir: %v", err)
@@ -476,7 +768,17 @@ func prepareAppImage(cfg PrepareConfig, appName types.ACName, img types.Hash, cd
 	}
 
 	if err := types.IsValidOSArch(am.Labels.ToMap(), ValidOSArch); err != nil {
-		return err
+		imgOS, _ := am.Labels.Get("os")
+		imgArch, _ := am.Labels.Get("arch")
+		if !isEmulatedArch(imgOS, imgArch) {
+			return err
+		}
+		if !cfg.QemuUser {
+			return fmt.Errorf("%v: the image can run with qemu-user, see --qemu-user", err)
+		}
+		if err := addQemuUserArch(cdir, imgArch); err != nil {
+			return fmt.Errorf("error recording the arch of the image: %v", err)
+		}
 	}
 
 	appInfoDir := common.AppInfoPath(cdir, appName)
@@ -484,20 +786,17 @@ func prepareAppImage(cfg PrepareConfig, appName types.ACName, img types.Hash, cd
 		return fmt.Errorf("error creating apps info directory: %v", err)
 	}
 
+	// the tree store is only used by the pods prepared with overlay, the
+	// other ones get their own copy of the image
+	treeStoreID := ""
 	if useOverlay {
 		if cfg.PrivateUsers.Shift > 0 {
 			return fmt.Errorf("cannot use both overlay and user namespace: not implemented yet. (Try --no-overlay)")
 		}
-		treeStoreID, err := cfg.Store.RenderTreeStore(img.String(), false)
+		var err error
+		treeStoreID, err = renderTreeStore(cfg.CommonConfig, img)
 		if err != nil {
-			return fmt.Errorf("error rendering tree image: %v", err)
-		}
-		if err := cfg.Store.CheckTreeStore(treeStoreID); err != nil {
-			log.Printf("Warning: tree cache is in a bad state: %v. Rebuilding...", err)
-			var err error
-			if treeStoreID, err = cfg.Store.RenderTreeStore(img.String(), true); err != nil {
-				return fmt.Errorf("error rendering tree image: %v", err)
-			}
+			return err
 		}
 
 		if err := ioutil.WriteFile(common.AppTreeStoreIDPath(cdir, appName), []byte(treeStoreID), defaultRegularFilePerm); err != nil {
@@ -519,13 +818,97 @@ func prepareAppImage(cfg PrepareConfig, appName types.ACName, img types.Hash, cd
 			return fmt.Errorf("error shifting app %q's stage2 dir: %v", appName, err)
 		}
 
-		if err := aci.RenderACIWithImageID(img, ad, cfg.Store, cfg.PrivateUsers); err != nil {
+		if canReflinkFromStore(cfg.Store, ad) {
+			debug("Copying the tree of image %s with reflinks", img)
+			if err := copyTreeStoreImage(cfg, img, ad); err != nil {
+				return err
+			}
+		} else if err := aci.RenderACIWithImageID(img, ad, cfg.Store, cfg.PrivateUsers); err != nil {
 			return fmt.Errorf("error rendering ACI: %v", err)
 		}
 	}
 	if err := writeManifest(cfg.CommonConfig, img, appInfoDir); err != nil {
 		return err
 	}
+	return addPodRefs(cfg.CommonConfig, img, treeStoreID)
+}
+
+// addPodRefs records in the store that the pod uses the image and its
+// dependencies, through the treestore with the given ID if not empty, so
+// "rkt image rm" doesn't remove them while the pod exists.
+func addPodRefs(cfg CommonConfig, img types.Hash, treeStoreID string) error {
+	images, err := acirenderer.CreateDepListFromImageID(img, cfg.Store)
+	if err != nil {
+		return fmt.Errorf("error resolving the dependencies of image %s: %v", img, err)
+	}
+	for _, i := range images {
+		if err := cfg.Store.AddPodRef(cfg.UUID.String(), i.Key, treeStoreID); err != nil {
+			return fmt.Errorf("error recording the use of image %s: %v", i.Key, err)
+		}
+	}
+	return nil
+}
+
+// renderTreeStore renders the image in the tree store, or rebuilds it if the
+// rendered tree is in a bad state, and returns its treeStoreID.
+func renderTreeStore(cfg CommonConfig, img types.Hash) (string, error) {
+	treeStoreID, err := cfg.Store.RenderTreeStore(img.String(), false)
+	if err != nil {
+		return "", fmt.Errorf("error rendering tree image: %v", err)
+	}
+	if err := cfg.Store.CheckTreeStore(treeStoreID); err != nil {
+		log.Printf("Warning: tree cache is in a bad state: %v. Rebuilding...", err)
+		var err error
+		if treeStoreID, err = cfg.Store.RenderTreeStore(img.String(), true); err != nil {
+			return "", fmt.Errorf("error rendering tree image: %v", err)
+		}
+	}
+	return treeStoreID, nil
+}
+
+// Stage1Flavor returns the flavor of the stage1 image img, rendering it in
+// the tree store, or an empty string if it has no flavor.
+func Stage1Flavor(s *store.Store, img types.Hash) (string, error) {
+	treeStoreID, err := renderTreeStore(CommonConfig{Store: s}, img)
+	if err != nil {
+		return "", err
+	}
+	flavor, err := os.Readlink(filepath.Join(s.GetTreeStoreRootFS(treeStoreID), "flavor"))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading the stage1 flavor: %v", err)
+	}
+	return flavor, nil
+}
+
+// canReflinkFromStore returns whether the files of the tree store can be
+// copied to dir with reflinks, e.g. on btrfs or on xfs with reflink=1.
+func canReflinkFromStore(s *store.Store, dir string) bool {
+	tmpDir, err := s.TmpDir()
+	if err != nil {
+		return false
+	}
+	return fileutil.CanReflink(tmpDir, dir)
+}
+
+// copyTreeStoreImage renders the image in the tree store and copies it to
+// dest. When the files are copied with reflinks, this is much cheaper than
+// rendering the image in dest, and the rendered tree is reused by the next
+// pods.
+func copyTreeStoreImage(cfg PrepareConfig, img types.Hash, dest string) error {
+	treeStoreID, err := renderTreeStore(cfg.CommonConfig, img)
+	if err != nil {
+		return err
+	}
+
+	if err := fileutil.CopyTree(cfg.Store.GetTreeStoreRootFS(treeStoreID), filepath.Join(dest, "rootfs"), cfg.PrivateUsers); err != nil {
+		return fmt.Errorf("error copying tree image: %v", err)
+	}
+	if err := fileutil.CopyRegularFile(filepath.Join(cfg.Store.GetTreeStorePath(treeStoreID), "manifest"), filepath.Join(dest, "manifest")); err != nil {
+		return fmt.Errorf("error copying image manifest: %v", err)
+	}
 	return nil
 }
 
@@ -554,6 +937,15 @@ func setupAppImage(cfg RunConfig, appName types.ACName, img types.Hash, cdir str
 	return nil
 }
 
+// checkStage1Digest returns an error if the stage1 image with the given ID is
+// not one of the pinned stage1 images.
+func checkStage1Digest(cfg CommonConfig, img types.Hash) error {
+	if !common.Stage1DigestAllowed(img, cfg.Stage1Digests) {
+		return fmt.Errorf("stage1 image %s is not pinned in the configuration, refusing to use it", img)
+	}
+	return nil
+}
+
 // prepareStage1Image renders and verifies tree cache of the given hash
 // when using overlay.
 // When useOverlay is false, it attempts to render and expand the stage1.
@@ -563,25 +955,26 @@ func prepareStage1Image(cfg PrepareConfig, img types.Hash, cdir string, useOverl
 		return fmt.Errorf("error creating stage1 directory: %v", err)
 	}
 
-	treeStoreID, err := cfg.Store.RenderTreeStore(img.String(), false)
+	treeStoreID, err := renderTreeStore(cfg.CommonConfig, img)
 	if err != nil {
-		return fmt.Errorf("error rendering tree image: %v", err)
-	}
-	if err := cfg.Store.CheckTreeStore(treeStoreID); err != nil {
-		log.Printf("Warning: tree cache is in a bad state: %v. Rebuilding...", err)
-		var err error
-		if treeStoreID, err = cfg.Store.RenderTreeStore(img.String(), true); err != nil {
-			return fmt.Errorf("error rendering tree image: %v", err)
-		}
+		return err
 	}
 
 	if err := writeManifest(cfg.CommonConfig, img, s1); err != nil {
 		return fmt.Errorf("error writing manifest: %v", err)
 	}
 
+	cachedTreePath := cfg.Store.GetTreeStoreRootFS(treeStoreID)
+	s1m, err := cfg.Store.GetImageManifest(img.String())
+	if err != nil {
+		return fmt.Errorf("error getting stage1 manifest: %v", err)
+	}
+	if err := stage1.Validate(s1m, cachedTreePath); err != nil {
+		return err
+	}
+
 	if !useOverlay {
 		destRootfs := filepath.Join(s1, "rootfs")
-		cachedTreePath := cfg.Store.GetTreeStoreRootFS(treeStoreID)
 		if err := fileutil.CopyTree(cachedTreePath, destRootfs, cfg.PrivateUsers); err != nil {
 			return fmt.Errorf("error rendering ACI: %v", err)
 		}
@@ -591,7 +984,14 @@ func prepareStage1Image(cfg PrepareConfig, img types.Hash, cdir string, useOverl
 	if err := ioutil.WriteFile(fn, []byte(treeStoreID), defaultRegularFilePerm); err != nil {
 		return fmt.Errorf("error writing stage1 treeStoreID: %v", err)
 	}
-	return nil
+
+	fn = path.Join(cdir, common.Stage1ImageIDFilename)
+	if err := ioutil.WriteFile(fn, []byte(img.String()), defaultRegularFilePerm); err != nil {
+		return fmt.Errorf("error writing stage1 image ID: %v", err)
+	}
+
+	// the stage1 tree store is used by enter and gc even without overlay
+	return addPodRefs(cfg.CommonConfig, img, treeStoreID)
 }
 
 // setupStage1Image mounts the overlay filesystem for stage1.
@@ -712,5 +1112,9 @@ func overlayRender(cfg RunConfig, treeStoreID string, cdir string, dest string,
 		return fmt.Errorf("error mounting: %v", err)
 	}
 
-	return nil
+	return audit.NewLogger(cdir, *cfg.UUID).Log(audit.KindMount, "overlay", map[string]string{
+		"lowerdir": cachedTreePath,
+		"upperdir": upperDir,
+		"target":   destRootfs,
+	})
 }
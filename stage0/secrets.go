@@ -0,0 +1,136 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package stage0
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/common/apps"
+	"github.com/coreos/rkt/common/audit"
+	"github.com/coreos/rkt/pkg/label"
+)
+
+// secretVolumePrefix is the prefix of the names of the volumes of the secrets
+const secretVolumePrefix = "rkt-secret-"
+
+func secretVolumeName(sec apps.Secret) types.ACName {
+	return types.ACName(secretVolumePrefix + sec.Name.String())
+}
+
+// readSecret returns the value of a secret, read from its file or from the
+// environment of rkt.
+func readSecret(sec apps.Secret) ([]byte, error) {
+	if sec.File != "" {
+		return ioutil.ReadFile(sec.File)
+	}
+	val, ok := os.LookupEnv(sec.Env)
+	if !ok {
+		return nil, fmt.Errorf("environment variable %q not set", sec.Env)
+	}
+	return []byte(val), nil
+}
+
+// prepareSecrets writes the secrets on a tmpfs mounted in the pod directory,
+// so they are never stored on the disk of the host, and returns the volumes
+// and the mounts exposing them in the apps. The sources of the volumes are
+// relative to the pod root, see common.PodVolumesAnnotation. The tmpfs is
+// unmounted when the pod is garbage collected.
+func prepareSecrets(cfg PrepareConfig, dir string) ([]types.Volume, []schema.Mount, error) {
+	secrets := cfg.Apps.Secrets
+	if len(secrets) == 0 {
+		return nil, nil, nil
+	}
+
+	secretsPath, err := filepath.Abs(common.SecretsPath(dir))
+	if err != nil {
+		return nil, nil, err
+	}
+	// a dry run doesn't read the secrets, it only sets their paths
+	values := make([][]byte, len(secrets))
+	if !cfg.DryRun {
+		size := 0
+		for i, sec := range secrets {
+			val, err := readSecret(sec)
+			if err != nil {
+				return nil, nil, fmt.Errorf("error reading secret %q: %v", sec.Name, err)
+			}
+			values[i] = val
+			// each file takes at least one page
+			size += len(val) + os.Getpagesize()
+		}
+
+		if err := os.MkdirAll(secretsPath, 0700); err != nil {
+			return nil, nil, fmt.Errorf("error creating the secrets directory: %v", err)
+		}
+		opts := label.FormatMountLabel(fmt.Sprintf("mode=0700,size=%d", size), cfg.MountLabel)
+		if err := syscall.Mount("tmpfs", secretsPath, "tmpfs", syscall.MS_NODEV|syscall.MS_NOEXEC|syscall.MS_NOSUID, opts); err != nil {
+			return nil, nil, fmt.Errorf("error mounting the secrets tmpfs: %v", err)
+		}
+		if err := audit.NewLogger(dir, *cfg.UUID).Log(audit.KindMount, "tmpfs", map[string]string{
+			"target":  secretsPath,
+			"secrets": fmt.Sprint(len(secrets)),
+		}); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var vols []types.Volume
+	var mounts []schema.Mount
+	for i, sec := range secrets {
+		uid, gid := sec.Uid, sec.Gid
+		if cfg.PrivateUsers != nil {
+			if uid, gid, err = cfg.PrivateUsers.ShiftRange(uid, gid); err != nil {
+				return nil, nil, fmt.Errorf("error shifting the owner of secret %q: %v", sec.Name, err)
+			}
+		}
+
+		// the source of the volume is relative to the pod root
+		source := filepath.Join(common.SecretsPath("/"), sec.Name.String())
+		path := filepath.Join(secretsPath, sec.Name.String())
+		if !cfg.DryRun {
+			if err := ioutil.WriteFile(path, values[i], 0600); err != nil {
+				return nil, nil, fmt.Errorf("error writing secret %q: %v", sec.Name, err)
+			}
+			if err := os.Chown(path, int(uid), int(gid)); err != nil {
+				return nil, nil, fmt.Errorf("error changing the owner of secret %q: %v", sec.Name, err)
+			}
+			if err := os.Chmod(path, sec.Mode); err != nil {
+				return nil, nil, fmt.Errorf("error changing the mode of secret %q: %v", sec.Name, err)
+			}
+		}
+
+		readOnly := true
+		vols = append(vols, types.Volume{
+			Name:     secretVolumeName(sec),
+			Kind:     "host",
+			Source:   source,
+			ReadOnly: &readOnly,
+		})
+		mounts = append(mounts, schema.Mount{
+			Volume: secretVolumeName(sec),
+			Path:   sec.Target,
+		})
+	}
+	return vols, mounts, nil
+}
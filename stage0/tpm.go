@@ -0,0 +1,115 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package stage0
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+)
+
+// DefaultTPMPCR is the PCR extended with the measurements of the images of
+// the pods by default
+const DefaultTPMPCR = 15
+
+// tpmEvent is an entry of the TPM event log of a pod, recording an image
+// measured in a PCR. The digest extended in the sha256 bank of the PCR is
+// the SHA-256 of the image ID.
+type tpmEvent struct {
+	PCR       int    `json:"pcr"`
+	Algorithm string `json:"algorithm"`
+	Digest    string `json:"digest"`
+	Type      string `json:"type"`
+	App       string `json:"app,omitempty"`
+	ImageID   string `json:"imageID"`
+}
+
+// tpmMeasurement returns the event measuring an image in the given PCR.
+func tpmMeasurement(pcr int, kind string, app string, img types.Hash) tpmEvent {
+	digest := sha256.Sum256([]byte(img.String()))
+	return tpmEvent{
+		PCR:       pcr,
+		Algorithm: "sha256",
+		Digest:    hex.EncodeToString(digest[:]),
+		Type:      kind,
+		App:       app,
+		ImageID:   img.String(),
+	}
+}
+
+// podTPMMeasurements returns the events measuring the stage1 image and the
+// app images of the pod at dir, in that order.
+func podTPMMeasurements(cfg RunConfig, dir string) ([]tpmEvent, error) {
+	s1ID, err := ioutil.ReadFile(filepath.Join(dir, common.Stage1ImageIDFilename))
+	if err != nil {
+		return nil, fmt.Errorf("cannot get the stage1 image ID: %v", err)
+	}
+	s1Hash, err := types.NewHash(strings.TrimSpace(string(s1ID)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid stage1 image ID: %v", err)
+	}
+
+	events := []tpmEvent{tpmMeasurement(cfg.TPMPCR, "stage1", "", *s1Hash)}
+	for _, app := range cfg.Apps {
+		events = append(events, tpmMeasurement(cfg.TPMPCR, "app", app.Name.String(), app.Image.ID))
+	}
+	return events, nil
+}
+
+// measureImages extends the PCR of the configuration with the measurements
+// of the stage1 image and of the app images of the pod at dir, using
+// tpm2_pcrextend from tpm2-tools, and appends them to the TPM event log of
+// the pod.
+func measureImages(cfg RunConfig, dir string) error {
+	events, err := podTPMMeasurements(cfg, dir)
+	if err != nil {
+		return err
+	}
+
+	pcrextend, err := exec.LookPath("tpm2_pcrextend")
+	if err != nil {
+		return fmt.Errorf("cannot find tpm2_pcrextend: %v", err)
+	}
+
+	logFile, err := os.OpenFile(filepath.Join(dir, common.TPMEventLogFilename), os.O_WRONLY|os.O_CREATE|os.O_APPEND, defaultRegularFilePerm)
+	if err != nil {
+		return fmt.Errorf("error opening the TPM event log: %v", err)
+	}
+	defer logFile.Close()
+	enc := json.NewEncoder(logFile)
+
+	for _, e := range events {
+		debug("Measuring image %s in PCR %d", e.ImageID, e.PCR)
+		arg := fmt.Sprintf("%d:%s=%s", e.PCR, e.Algorithm, e.Digest)
+		if out, err := exec.Command(pcrextend, arg).CombinedOutput(); err != nil {
+			return fmt.Errorf("error extending PCR %d: %v: %s", e.PCR, err, out)
+		}
+		if err := enc.Encode(e); err != nil {
+			return fmt.Errorf("error writing the TPM event log: %v", err)
+		}
+	}
+	return nil
+}
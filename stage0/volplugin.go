@@ -0,0 +1,111 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package stage0
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/common/audit"
+	"github.com/coreos/rkt/common/volplugin"
+)
+
+// preparePluginVolumes mounts in the pod directory, with their drivers, the
+// volumes of kind plugin. It returns vols, the volumes of the pod, where
+// these volumes are replaced by host volumes, and their names: their sources
+// are relative to the pod root, see common.PodVolumesAnnotation. Each volume
+// is recorded before being mounted so it is unmounted when the pod is
+// garbage collected, even if the preparation fails later.
+func preparePluginVolumes(cfg PrepareConfig, dir string, vols []types.Volume) ([]types.Volume, []types.ACName, error) {
+	var res []types.Volume
+	var names []types.ACName
+	for _, vol := range vols {
+		if vol.Kind != volplugin.Kind {
+			res = append(res, vol)
+			continue
+		}
+		if err := preparePluginVolume(cfg, dir, vol); err != nil {
+			return nil, nil, fmt.Errorf("error mounting plugin volume %q: %v", vol.Name, err)
+		}
+		res = append(res, types.Volume{
+			Name:     vol.Name,
+			Kind:     "host",
+			Source:   volplugin.MountPath(common.PluginVolumesPath("/"), vol.Name.String()),
+			ReadOnly: vol.ReadOnly,
+		})
+		names = append(names, vol.Name)
+	}
+	return res, names, nil
+}
+
+// preparePluginVolume mounts a volume of kind plugin with its driver.
+func preparePluginVolume(cfg PrepareConfig, dir string, vol types.Volume) error {
+	pv, ok := cfg.Apps.PluginVolumes[vol.Name]
+	if !ok {
+		return fmt.Errorf("no driver specified")
+	}
+	command, ok := cfg.VolumeDrivers[pv.Driver]
+	if !ok {
+		return fmt.Errorf("no volume driver %q configured", pv.Driver)
+	}
+	pluginVolumesPath, err := filepath.Abs(common.PluginVolumesPath(dir))
+	if err != nil {
+		return err
+	}
+	path := volplugin.MountPath(pluginVolumesPath, vol.Name.String())
+	if cfg.DryRun {
+		return nil
+	}
+	drv := &volplugin.Driver{Name: pv.Driver, Command: command}
+
+	caps, err := drv.Capabilities()
+	if err != nil {
+		return err
+	}
+	req := volplugin.MountRequest{
+		Name:    vol.Name.String(),
+		Options: pv.Options,
+	}
+	// the mounts of the apps are read-only anyway, the driver only
+	// does it too if it can
+	if vol.ReadOnly != nil && *vol.ReadOnly && caps.ReadOnly {
+		req.ReadOnly = true
+	}
+
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return err
+	}
+	rec := volplugin.Volume{Name: vol.Name.String(), Driver: pv.Driver}
+	if err := volplugin.WriteVolume(pluginVolumesPath, rec); err != nil {
+		return err
+	}
+	if err := drv.Mount(path, req); err != nil {
+		volplugin.RemoveVolume(pluginVolumesPath, rec)
+		return err
+	}
+	if err := audit.NewLogger(dir, *cfg.UUID).Log(audit.KindMount, "plugin", map[string]string{
+		"target": path,
+		"volume": vol.Name.String(),
+		"driver": pv.Driver,
+	}); err != nil {
+		return err
+	}
+	return nil
+}
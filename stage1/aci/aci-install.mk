@@ -16,6 +16,8 @@ AMI_ACI_DIRS_RESTS := \
 	etc \
 	opt/stage2 \
 	rkt/status \
+	rkt/stopped \
+	rkt/app-state \
 	rkt/env
 # all the directories we want to be created in the ACI rootfs
 AMI_ACI_DIR_CHAINS := \
@@ -0,0 +1,52 @@
+#!/usr/bin/bash
+# Records a state transition of an app in /rkt/app-state/APP, read by
+# rkt status.
+#
+# usage: app-state.sh APP started|exited
+#
+# The file is created by stage1 init with the state "created". Starting an
+# app which already started, e.g. after a failed health check, counts as a
+# restart.
+
+SYSCTL=/usr/bin/systemctl
+STATE_DIR=/rkt/app-state
+
+app=$1
+transition=$2
+state_file="${STATE_DIR}/${app}"
+
+state=created
+created=
+started=
+exited=
+exit_code=
+restarts=0
+if [ -f "${state_file}" ]; then
+    source "${state_file}"
+fi
+
+printf -v now '%(%s)T' -1
+case "$transition" in
+    started)
+        if [ -n "$started" ]; then
+            restarts=$(( restarts + 1 ))
+        fi
+        state=running
+        started=$now
+        exited=
+        exit_code=
+        ;;
+    exited)
+        status=$(${SYSCTL} show --property ExecMainStatus "${app}.service")
+        state=exited
+        exited=$now
+        exit_code=${status#*=}
+        ;;
+    *)
+        echo "unknown app state transition: $transition" >&2
+        exit 1
+        ;;
+esac
+
+printf 'state=%s\ncreated=%s\nstarted=%s\nexited=%s\nexit_code=%s\nrestarts=%s\n' \
+    "$state" "$created" "$started" "$exited" "$exit_code" "$restarts" > "${state_file}"
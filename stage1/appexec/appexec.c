@@ -147,6 +147,22 @@ static void diag(const char *exe)
 	diag(itrp);
 }
 
+/* Redirect fd to the file at path, opened for writing, such as the FIFOs
+ * carrying the output of the app to its log unit */
+static void redirect(int fd, const char *path)
+{
+	int f;
+
+	pexit_if((f = open(path, O_WRONLY)) == -1,
+		"Unable to open \"%s\"", path);
+	if (f == fd)
+		return;
+	pexit_if(dup2(f, fd) == -1,
+		"Unable to redirect %i to \"%s\"", fd, path);
+	pexit_if(close(f) == -1,
+		"Close of %i [%s] failed", f, path);
+}
+
 /* Append env variables listed in keep_env to env_file if they're present in
  * current environment */
 void append_env(const char *env_file, const char **keep_env)
@@ -266,26 +282,66 @@ int main(int argc, char *argv[])
 	};
 
 	const char	*root, *cwd, *env, *uid_str, *gid_str, *exe;
-	char		**args;
+	const char	*prog = argv[0], *stdout_path = NULL, *stderr_path = NULL;
+	char		**args, **env_overrides;
+	int		n_env_overrides = 0, i;
 	uid_t		uid;
 	gid_t		*gids;
 	size_t		n_gids;
 
-	exit_if(argc < 7,
-		"Usage: %s /path/to/root /work/directory /env/file uid gid[,gid...] /to/exec [args ...]", argv[0]);
+	/* The leading --stdout=PATH and --stderr=PATH arguments redirect the
+	 * output of the app, to the FIFOs read by its log unit */
+	while (argc > 1) {
+		if (!strncmp(argv[1], "--stdout=", 9))
+			stdout_path = argv[1] + 9;
+		else if (!strncmp(argv[1], "--stderr=", 9))
+			stderr_path = argv[1] + 9;
+		else
+			break;
+		argv++;
+		argc--;
+	}
+
+	/* The following --env=NAME=VALUE arguments override the environment
+	 * of the app, they are passed by "rkt enter --env" */
+	env_overrides = &argv[1];
+	while (n_env_overrides + 1 < argc &&
+	       !strncmp(argv[n_env_overrides + 1], "--env=", 6))
+		n_env_overrides++;
 
-	root = argv[1];
-	cwd = argv[2];
-	env = argv[3];
-	uid_str = argv[4];
+	exit_if(argc - n_env_overrides < 7,
+		"Usage: %s [--stdout=PATH] [--stderr=PATH] [--env=NAME=VALUE ...] /path/to/root /work/directory /env/file uid gid[,gid...] /to/exec [args ...]", prog);
+
+	root = argv[n_env_overrides + 1];
+	cwd = argv[n_env_overrides + 2];
+	env = argv[n_env_overrides + 3];
+	uid_str = argv[n_env_overrides + 4];
 	uid = atoi(uid_str);
-	gid_str = argv[5];
-	args = &argv[6];
+	gid_str = argv[n_env_overrides + 5];
+	args = &argv[n_env_overrides + 6];
 	exe = args[0];
 
 	parse_gids(gid_str, &n_gids, &gids);
 	load_env(env, keep_env);
 
+	for (i = 0; i < n_env_overrides; i++) {
+		char *name = env_overrides[i] + 6;
+		char *value = strchr(name, '=');
+
+		exit_if(value == NULL || value == name,
+			"Malformed environment override: \"%s\"", name);
+		*value = '\0';
+		value++;
+		pexit_if(setenv(name, value, 1) == -1,
+			"Unable to set env variable: \"%s\"=\"%s\"", name, value);
+	}
+
+	/* the FIFOs are in the rootfs of stage1 */
+	if (stdout_path)
+		redirect(STDOUT_FILENO, stdout_path);
+	if (stderr_path)
+		redirect(STDERR_FILENO, stderr_path);
+
 	pexit_if(chroot(root) == -1, "Chroot \"%s\" failed", root);
 	pexit_if(chdir(cwd) == -1, "Chdir \"%s\" failed", cwd);
 	pexit_if(gids[0] > 0 && setresgid(gids[0], gids[0], gids[0]) == -1,
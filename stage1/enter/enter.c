@@ -63,6 +63,9 @@ int main(int argc, char *argv[])
 	int	fd;
 	int	pid = 0;
 	char *appname = NULL;
+	char *workdir = "/";
+	char *envs[argc];
+	int	n_envs = 0;
 	pid_t	child;
 	int	status;
 	int	root_fd;
@@ -76,10 +79,12 @@ int main(int argc, char *argv[])
 		static struct option long_options[] = {
 		   {"pid",     required_argument, 0,  'p' },
 		   {"appname", required_argument, 0,  'a' },
+		   {"env",     required_argument, 0,  'e' },
+		   {"workdir", required_argument, 0,  'w' },
 		   {0,         0,                 0,  0 }
 		};
 
-		c = getopt_long(argc, argv, "p:a:",
+		c = getopt_long(argc, argv, "p:a:e:w:",
 				long_options, &option_index);
 		if (c == -1)
 			break;
@@ -91,13 +96,20 @@ int main(int argc, char *argv[])
 		case 'a':
 			appname = optarg;
 			break;
+		case 'e':
+			envs[n_envs++] = optarg;
+			break;
+		case 'w':
+			workdir = optarg;
+			break;
 		case 0:
 			break;
 		case ':':   /* missing option argument */
 		case '?':
 		default:
 			fprintf(stderr, "Usage: %s --pid=1234 "
-					"--appname=name -- cmd [args...]",
+					"--appname=name [--env=NAME=VALUE ...] "
+					"[--workdir=/dir] -- cmd [args...]",
 					argv[0]);
 			exit(1);
 		}
@@ -136,8 +148,8 @@ int main(int argc, char *argv[])
 	if(child == 0) {
 		char		root[PATH_MAX];
 		char		env[PATH_MAX];
-		char		*args[APPEXEC_ARGV_FWD_OFFSET + argc - optind + 1 /* NULL terminator */];
-		int		argsind;
+		char		*args[APPEXEC_ARGV_FWD_OFFSET + n_envs + argc - optind + 1 /* NULL terminator */];
+		int		argsind, i;
 
 		/* Child goes on to execute /appexec */
 
@@ -149,13 +161,20 @@ int main(int argc, char *argv[])
 				 "/rkt/env/%s", appname) == sizeof(env),
 			"Env path overflow");
 
-		args[0] = "/appexec";
-		args[1] = root;
-		args[2] = "/";	/* TODO(vc): plumb this into app.WorkingDirectory */
-		args[3] = env;
-		args[4] = "0"; /* uid */
-		args[5] = "0"; /* gid */
-		argsind = APPEXEC_ARGV_FWD_OFFSET;
+		argsind = 0;
+		args[argsind++] = "/appexec";
+		for (i = 0; i < n_envs; i++) {
+			size_t len = strlen(envs[i]) + sizeof("--env=");
+
+			pexit_if((args[argsind] = malloc(len)) == NULL,
+				"Unable to allocate env argument");
+			snprintf(args[argsind++], len, "--env=%s", envs[i]);
+		}
+		args[argsind++] = root;
+		args[argsind++] = workdir;
+		args[argsind++] = env;
+		args[argsind++] = "0"; /* uid */
+		args[argsind++] = "0"; /* gid */
 		while (optind < argc)
 			args[argsind++] = argv[optind++];
 
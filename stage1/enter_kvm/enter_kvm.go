@@ -20,10 +20,14 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"syscall"
 
+	"github.com/coreos/rkt/Godeps/_workspace/src/golang.org/x/crypto/ssh/terminal"
+	"github.com/coreos/rkt/common"
 	"github.com/coreos/rkt/networking/netinfo"
 	"github.com/coreos/rkt/pkg/lock"
+	"github.com/coreos/rkt/stage1/init/kvm"
 )
 
 const (
@@ -34,13 +38,34 @@ const (
 )
 
 var (
-	podPid  string
-	appName string
+	podPid     string
+	appName    string
+	cmdWorkDir string
+	envs       envList
 )
 
+// envList implements the flag.Value interface for the repeated --env flag
+type envList []string
+
+func (l *envList) String() string {
+	return strings.Join(*l, " ")
+}
+
+func (l *envList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
 func init() {
 	flag.StringVar(&podPid, "pid", "", "podPID")
 	flag.StringVar(&appName, "appname", "", "application to use")
+	flag.StringVar(&cmdWorkDir, "workdir", "/", "working directory of the command")
+	flag.Var(&envs, "env", "environment variable of the command, NAME=VALUE")
+}
+
+// shellQuote quotes s for the remote shell executing the command
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
 }
 
 func getPodDefaultIP(workDir string) (string, error) {
@@ -68,17 +93,40 @@ func getPodDefaultIP(workDir string) (string, error) {
 	return nets[0].IP.String(), nil
 }
 
+// getGuestAddress returns the host to connect to with ssh to reach the
+// guest of the pod in workDir and, if it is reached over vsock, the proxy
+// command connecting to it.
+func getGuestAddress(workDir string) (string, string, error) {
+	cid, ok, err := kvm.ReadGuestCID(workDir)
+	if err != nil {
+		return "", "", fmt.Errorf("Cannot read vsock context ID: %v", err)
+	}
+	if ok {
+		proxy := filepath.Join(common.Stage1RootfsPath(workDir), kvm.VsockProxyBin)
+		return "localhost", fmt.Sprintf("%s - vsock:%d:%d", proxy, cid, kvm.VsockEnterPort), nil
+	}
+
+	podDefaultIP, err := getPodDefaultIP(workDir)
+	if err != nil {
+		return "", "", fmt.Errorf("Cannot load networking configuration: %v", err)
+	}
+	return podDefaultIP, "", nil
+}
+
 func getAppexecArgs() []string {
 	// Documentation/devel/stage1-implementors-guide.md#arguments-1
 	// also from ../enter/enter.c
-	args := []string{
-		"/appexec",
+	args := []string{"/appexec"}
+	for _, e := range envs {
+		args = append(args, shellQuote("--env="+e))
+	}
+	args = append(args,
 		fmt.Sprintf("/opt/stage2/%s/rootfs", appName),
-		"/", // as in ../enter/enter.c - this should be app.WorkingDirectory
+		shellQuote(cmdWorkDir),
 		fmt.Sprintf("/rkt/env/%s", appName),
 		"0", // uid
 		"0", // gid
-	}
+	)
 	return append(args, flag.Args()...)
 }
 
@@ -88,9 +136,11 @@ func execSSH() error {
 		return fmt.Errorf("Cannot get working directory: %v", err)
 	}
 
-	podDefaultIP, err := getPodDefaultIP(workDir)
+	// the guest is reached over vsock if the pod uses it, through the
+	// proxy of stage1, otherwise over the default network of the pod
+	host, proxyCommand, err := getGuestAddress(workDir)
 	if err != nil {
-		return fmt.Errorf("Cannot load networking configuration: %v", err)
+		return err
 	}
 
 	// escape from running pod directory into base directory
@@ -106,17 +156,26 @@ func execSSH() error {
 
 	// prepare args for ssh invocation
 	keyFile := filepath.Join(kvmSettingsDir, kvmPrivateKeyFilename)
+	// use a tty only if there is one, so the commands of scripts do not
+	// get a tty
+	ttyFlag := "-T"
+	if terminal.IsTerminal(int(os.Stdin.Fd())) {
+		ttyFlag = "-t"
+	}
 	args := []string{
 		"ssh",
-		"-t",          // use tty
+		ttyFlag,
 		"-i", keyFile, // use keyfile
 		"-l", "root", // login as user
 		"-p", kvmSSHPort, // port to connect
 		"-o", "StrictHostKeyChecking=no", // do not check changing host keys
 		"-o", "UserKnownHostsFile=/dev/null", // do not add host key to default knownhosts file
 		"-o", "LogLevel=quiet", // do not log minor informations
-		podDefaultIP,
 	}
+	if proxyCommand != "" {
+		args = append(args, "-o", "ProxyCommand="+proxyCommand)
+	}
+	args = append(args, host)
 	args = append(args, getAppexecArgs()...)
 
 	// this should not return in case of success
@@ -28,6 +28,7 @@ import (
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
 
 	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/common/cgroup"
 	"github.com/coreos/rkt/networking"
 )
 
@@ -61,6 +62,11 @@ func main() {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
+
+	// remove the freezer cgroup created by the pause entrypoint
+	if err := os.Remove(cgroup.PodFreezerCgroup(podID.String())); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove the freezer cgroup: %v", err)
+	}
 }
 
 func gcNetworking(podID *types.UUID) error {
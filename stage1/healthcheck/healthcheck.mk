@@ -0,0 +1,4 @@
+AIB_FLAVORS := $(STAGE1_FLAVORS)
+AIB_BINARY := $(MK_SRCDIR)/healthcheck.sh
+
+include stage1/makelib/aci_install_bin.mk
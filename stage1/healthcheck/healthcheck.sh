@@ -0,0 +1,78 @@
+#!/usr/bin/bash
+# Runs the health check of an app and records its result in /rkt/health/APP.
+#
+# usage: healthcheck.sh APP RETRIES ACTION exec COMMAND...
+#        healthcheck.sh APP RETRIES ACTION tcp HOST PORT
+#        healthcheck.sh APP RETRIES ACTION http HOST PORT PATH
+#
+# After RETRIES consecutive failures the app is marked unhealthy and, if
+# ACTION is "restart", restarted.
+
+SYSCTL=/usr/bin/systemctl
+HEALTH_DIR=/rkt/health
+# how long a tcp or http probe waits for a response, in seconds
+PROBE_TIMEOUT=10
+
+app=$1
+retries=$2
+action=$3
+kind=$4
+shift 4
+
+probe_tcp() {
+    exec 3<>"/dev/tcp/$1/$2" || return 1
+    exec 3<&-
+}
+
+probe_http() {
+    local status
+    exec 3<>"/dev/tcp/$1/$2" || return 1
+    printf 'GET %s HTTP/1.0\r\nHost: %s\r\n\r\n' "$3" "$1" >&3
+    read -r -t ${PROBE_TIMEOUT} status <&3
+    exec 3<&-
+    # status line: HTTP/1.x CODE REASON
+    status=${status#* }
+    status=${status%% *}
+    [[ "$status" =~ ^[23][0-9][0-9]$ ]]
+}
+
+case "$kind" in
+    exec)
+        "$@"
+        ;;
+    tcp)
+        probe_tcp "$@"
+        ;;
+    http)
+        probe_http "$@"
+        ;;
+    *)
+        echo "unknown health check kind: $kind" >&2
+        exit 1
+        ;;
+esac
+result=$?
+
+mkdir -p "${HEALTH_DIR}"
+failures_file="${HEALTH_DIR}/.${app}.failures"
+
+if [ $result -eq 0 ]; then
+    rm -f "${failures_file}"
+    echo healthy > "${HEALTH_DIR}/${app}"
+    exit 0
+fi
+
+failures=$(( $(cat "${failures_file}" 2>/dev/null || echo 0) + 1 ))
+echo "health check of ${app} failed (${failures}/${retries})" >&2
+if [ $failures -lt $retries ]; then
+    echo $failures > "${failures_file}"
+    exit 0
+fi
+
+rm -f "${failures_file}"
+echo unhealthy > "${HEALTH_DIR}/${app}"
+if [ "$action" = "restart" ]; then
+    echo "restarting ${app}" >&2
+    ${SYSCTL} restart "${app}.service"
+fi
+exit 0
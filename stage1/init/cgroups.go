@@ -0,0 +1,67 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/coreos/rkt/common"
+)
+
+// getPodCgroups returns the cgroups and units of the pod and its apps.
+// subcgroup is the system.slice of the pod, where systemd of stage1 runs
+// the services of the apps.
+func getPodCgroups(p *Pod, subcgroup, flavor string) common.PodCgroups {
+	podCgroup := "/" + strings.Trim(filepath.Dir(subcgroup), "/")
+	pc := common.PodCgroups{
+		Cgroup: podCgroup,
+		Apps:   []common.AppCgroup{},
+	}
+	if unit := filepath.Base(podCgroup); strings.HasSuffix(unit, ".scope") || strings.HasSuffix(unit, ".service") {
+		pc.Unit = unit
+	}
+	for _, ra := range p.Manifest.Apps {
+		ac := common.AppCgroup{
+			Name: ra.Name.String(),
+			Unit: ServiceUnitName(ra.Name),
+		}
+		// the apps of the kvm flavor run in the virtual machine, outside
+		// of the cgroups of the host
+		if flavor != "kvm" {
+			ac.Cgroup = "/" + strings.Trim(filepath.Join(subcgroup, ac.Unit), "/")
+		}
+		pc.Apps = append(pc.Apps, ac)
+	}
+	return pc
+}
+
+// writePodCgroups writes the cgroups and units of the pod in the pod
+// directory, read by rkt status.
+func writePodCgroups(p *Pod, subcgroup, flavor string) error {
+	b, err := json.Marshal(getPodCgroups(p, subcgroup, flavor))
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(p.Root, common.PodCgroupsFilename), b, 0644); err != nil {
+		return fmt.Errorf("error writing the pod cgroups: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/common"
+	stage1lib "github.com/coreos/rkt/pkg/stage1"
+)
+
+func TestGetPodCgroups(t *testing.T) {
+	p := &Pod{Pod: &stage1lib.Pod{
+		Manifest: &schema.PodManifest{
+			Apps: schema.AppList{{Name: "web"}, {Name: "db"}},
+		},
+	}}
+
+	tests := []struct {
+		subcgroup string
+		flavor    string
+		want      common.PodCgroups
+	}{
+		{
+			`machine.slice/machine-rkt\x2d1234.scope/system.slice`,
+			"coreos",
+			common.PodCgroups{
+				Cgroup: `/machine.slice/machine-rkt\x2d1234.scope`,
+				Unit:   `machine-rkt\x2d1234.scope`,
+				Apps: []common.AppCgroup{
+					{Name: "web", Cgroup: `/machine.slice/machine-rkt\x2d1234.scope/system.slice/web.service`, Unit: "web.service"},
+					{Name: "db", Cgroup: `/machine.slice/machine-rkt\x2d1234.scope/system.slice/db.service`, Unit: "db.service"},
+				},
+			},
+		},
+		{
+			"/system.slice/pod.service/system.slice",
+			"fly",
+			common.PodCgroups{
+				Cgroup: "/system.slice/pod.service",
+				Unit:   "pod.service",
+				Apps: []common.AppCgroup{
+					{Name: "web", Cgroup: "/system.slice/pod.service/system.slice/web.service", Unit: "web.service"},
+					{Name: "db", Cgroup: "/system.slice/pod.service/system.slice/db.service", Unit: "db.service"},
+				},
+			},
+		},
+		{
+			"/rkt/system.slice",
+			"kvm",
+			common.PodCgroups{
+				Cgroup: "/rkt",
+				Apps: []common.AppCgroup{
+					{Name: "web", Unit: "web.service"},
+					{Name: "db", Unit: "db.service"},
+				},
+			},
+		},
+	}
+
+	for i, tt := range tests {
+		got := getPodCgroups(p, tt.subcgroup, tt.flavor)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("#%d: got %+v, want %+v", i, got, tt.want)
+		}
+	}
+}
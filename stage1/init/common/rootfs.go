@@ -0,0 +1,93 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+)
+
+// GetAppAnnotation returns the value of an annotation of an app. The
+// annotation in the pod manifest overrides the one in the image manifest.
+func GetAppAnnotation(ra *schema.RuntimeApp, im *schema.ImageManifest, name string) (string, bool) {
+	if val, ok := ra.Annotations.Get(name); ok {
+		return val, true
+	}
+	if im != nil {
+		return im.Annotations.Get(name)
+	}
+	return "", false
+}
+
+// GetAppBoolAnnotation returns the value of a boolean annotation of an app,
+// false if it is not set.
+func GetAppBoolAnnotation(ra *schema.RuntimeApp, im *schema.ImageManifest, name string) (bool, error) {
+	val, ok := GetAppAnnotation(ra, im, name)
+	if !ok {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return false, fmt.Errorf("invalid value %q for annotation %q: %v", val, name, err)
+	}
+	return b, nil
+}
+
+// IsReadOnlyRootFS returns whether the rootfs of an app must be mounted
+// read-only.
+func IsReadOnlyRootFS(ra *schema.RuntimeApp, im *schema.ImageManifest) (bool, error) {
+	return GetAppBoolAnnotation(ra, im, common.ReadOnlyRootFSAnnotation)
+}
+
+// WritableMountPaths returns the paths in the app rootfs where the volumes
+// which are not read-only are mounted.
+func WritableMountPaths(ra *schema.RuntimeApp, volumes []types.Volume) []string {
+	vols := make(map[types.ACName]types.Volume)
+	for _, v := range volumes {
+		vols[v.Name] = v
+	}
+
+	var paths []string
+	seen := make(map[string]struct{})
+	add := func(volName types.ACName, path string) {
+		if _, ok := seen[path]; ok {
+			return
+		}
+		seen[path] = struct{}{}
+
+		vol, ok := vols[volName]
+		if !ok {
+			// implicit "empty" volume, see GenerateMounts
+			vol = types.Volume{Name: volName, Kind: "empty"}
+		}
+		if !IsMountReadOnly(vol, ra.App.MountPoints) {
+			paths = append(paths, path)
+		}
+	}
+
+	for _, m := range ra.Mounts {
+		add(m.Volume, m.Path)
+	}
+	for _, mp := range ra.App.MountPoints {
+		add(mp.Name, mp.Path)
+	}
+
+	return paths
+}
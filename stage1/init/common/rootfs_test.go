@@ -0,0 +1,86 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+)
+
+func TestIsReadOnlyRootFS(t *testing.T) {
+	ro := types.Annotations{{Name: common.ReadOnlyRootFSAnnotation, Value: "true"}}
+	rw := types.Annotations{{Name: common.ReadOnlyRootFSAnnotation, Value: "false"}}
+	invalid := types.Annotations{{Name: common.ReadOnlyRootFSAnnotation, Value: "maybe"}}
+
+	tests := []struct {
+		podAnnotations   types.Annotations
+		imageAnnotations types.Annotations
+		readOnly         bool
+		werr             bool
+	}{
+		{nil, nil, false, false},
+		{ro, nil, true, false},
+		{nil, ro, true, false},
+		// the pod manifest overrides the image manifest
+		{rw, ro, false, false},
+		{ro, rw, true, false},
+		{invalid, nil, false, true},
+	}
+
+	for i, tt := range tests {
+		ra := &schema.RuntimeApp{Annotations: tt.podAnnotations}
+		im := &schema.ImageManifest{Annotations: tt.imageAnnotations}
+
+		readOnly, err := IsReadOnlyRootFS(ra, im)
+		if gerr := (err != nil); gerr != tt.werr {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.werr)
+		}
+		if readOnly != tt.readOnly {
+			t.Errorf("#%d: got %t, want %t", i, readOnly, tt.readOnly)
+		}
+	}
+}
+
+func TestWritableMountPaths(t *testing.T) {
+	readOnly := true
+	volumes := []types.Volume{
+		{Name: "data", Kind: "host", Source: "/srv/data"},
+		{Name: "config", Kind: "host", Source: "/etc/app", ReadOnly: &readOnly},
+		{Name: "cache", Kind: "empty"},
+	}
+	ra := &schema.RuntimeApp{
+		App: &types.App{
+			MountPoints: []types.MountPoint{
+				{Name: "data", Path: "/data"},
+				{Name: "config", Path: "/config"},
+				{Name: "logs", Path: "/logs", ReadOnly: true},
+				{Name: "scratch", Path: "/scratch"},
+			},
+		},
+		Mounts: []schema.Mount{
+			{Volume: "cache", Path: "/data"},
+		},
+	}
+
+	expected := []string{"/data", "/scratch"}
+	paths := WritableMountPaths(ra, volumes)
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("got %v, want %v", paths, expected)
+	}
+}
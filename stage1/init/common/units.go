@@ -0,0 +1,83 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+)
+
+// StopSidecarsUnitName is the name of the systemd service stopping the apps
+// which are not one-shot once the one-shot apps exited successfully.
+const StopSidecarsUnitName = "stop-sidecars.service"
+
+// ServiceUnitName returns the name of the systemd service running an app in
+// stage1.
+func ServiceUnitName(appName types.ACName) string {
+	return appName.String() + ".service"
+}
+
+// ReaperUnitName returns the name of the systemd service reaping the
+// processes of an app in stage1 when it exits.
+func ReaperUnitName(appName types.ACName) string {
+	return "reaper-" + appName.String() + ".service"
+}
+
+// AppStateUnitName returns the name of the systemd service recording the
+// state transitions of an app in stage1.
+func AppStateUnitName(appName types.ACName) string {
+	return "app-state-" + appName.String() + ".service"
+}
+
+// LogUnitName returns the name of the systemd service sending the output of
+// an app in stage1 to the log driver of the pod.
+func LogUnitName(appName types.ACName) string {
+	return "log-" + appName.String() + ".service"
+}
+
+// SocketUnitName returns the name of the systemd socket activating an app
+// in stage1.
+func SocketUnitName(appName types.ACName) string {
+	return appName.String() + ".socket"
+}
+
+// HealthCheckServiceUnitName returns the name of the systemd service unit
+// running the health check of the given app.
+func HealthCheckServiceUnitName(appName types.ACName) string {
+	return "healthcheck-" + appName.String() + ".service"
+}
+
+// HealthCheckTimerUnitName returns the name of the systemd timer unit
+// scheduling the health check of the given app.
+func HealthCheckTimerUnitName(appName types.ACName) string {
+	return "healthcheck-" + appName.String() + ".timer"
+}
+
+// HasHealthCheck returns whether the annotations of an app define a health
+// check.
+func HasHealthCheck(ra *schema.RuntimeApp, im *schema.ImageManifest) bool {
+	for _, name := range []string{
+		common.HealthCheckExecAnnotation,
+		common.HealthCheckShellAnnotation,
+		common.HealthCheckTCPAnnotation,
+		common.HealthCheckHTTPAnnotation,
+	} {
+		if _, ok := GetAppAnnotation(ra, im, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/coreos/go-systemd/unit"
+	"github.com/coreos/rkt/common"
+)
+
+// appDependencies are the apps an app of the pod depends on.
+type appDependencies struct {
+	// apps started before the app
+	after []types.ACName
+	// apps which must exit successfully before the app starts
+	requires []types.ACName
+}
+
+// getAppDependencies returns the dependencies of the apps of the pod, set
+// in their annotations in the pod manifest. It returns an error if an app
+// depends on an unknown app or on itself, directly or not.
+func (p *Pod) getAppDependencies() (map[types.ACName]*appDependencies, error) {
+	deps := make(map[types.ACName]*appDependencies)
+	for _, ra := range p.Manifest.Apps {
+		d := &appDependencies{}
+		var err error
+		if d.after, err = p.parseAppDependencies(ra, common.AppAfterAnnotation); err != nil {
+			return nil, err
+		}
+		if d.requires, err = p.parseAppDependencies(ra, common.AppRequiresAnnotation); err != nil {
+			return nil, err
+		}
+		deps[ra.Name] = d
+	}
+
+	// a cycle would be broken by systemd at an arbitrary place
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[types.ACName]int)
+	var visit func(name types.ACName) error
+	visit = func(name types.ACName) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("the dependencies of app %q form a cycle", name)
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		for _, dep := range append(deps[name].after, deps[name].requires...) {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		return nil
+	}
+	for _, ra := range p.Manifest.Apps {
+		if err := visit(ra.Name); err != nil {
+			return nil, err
+		}
+	}
+
+	return deps, nil
+}
+
+// parseAppDependencies returns the apps listed in the given dependency
+// annotation of an app.
+func (p *Pod) parseAppDependencies(ra schema.RuntimeApp, annotation string) ([]types.ACName, error) {
+	val, ok := ra.Annotations.Get(annotation)
+	if !ok {
+		return nil, nil
+	}
+
+	var names []types.ACName
+	for _, s := range strings.Split(val, ",") {
+		name, err := types.NewACName(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s annotation of app %q: %v", annotation, ra.Name, err)
+		}
+		if *name == ra.Name {
+			return nil, fmt.Errorf("invalid %s annotation of app %q: an app cannot depend on itself", annotation, ra.Name)
+		}
+		if p.Manifest.Apps.Get(*name) == nil {
+			return nil, fmt.Errorf("invalid %s annotation of app %q: no app %q in the pod", annotation, ra.Name, *name)
+		}
+		names = append(names, *name)
+	}
+	return names, nil
+}
+
+// appDependencyOptions returns the options of the service unit of an app
+// which order it after the apps it depends on.
+func (p *Pod) appDependencyOptions(ra *schema.RuntimeApp) ([]*unit.UnitOption, error) {
+	deps, err := p.getAppDependencies()
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []*unit.UnitOption
+	for _, dep := range deps[ra.Name].after {
+		opts = append(opts, unit.NewUnitOption("Unit", "Wants", ServiceUnitName(dep)))
+		opts = append(opts, unit.NewUnitOption("Unit", "After", ServiceUnitName(dep)))
+	}
+	for _, dep := range deps[ra.Name].requires {
+		opts = append(opts, unit.NewUnitOption("Unit", "Requires", ServiceUnitName(dep)))
+		opts = append(opts, unit.NewUnitOption("Unit", "After", ServiceUnitName(dep)))
+	}
+	return opts, nil
+}
+
+// isAppRequired returns whether another app of the pod requires the app. It
+// is then a oneshot service, so the other app only starts once it has
+// exited successfully.
+func (p *Pod) isAppRequired(name types.ACName) (bool, error) {
+	deps, err := p.getAppDependencies()
+	if err != nil {
+		return false, err
+	}
+	for _, d := range deps {
+		for _, dep := range d.requires {
+			if dep == name {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/coreos/go-systemd/unit"
+	"github.com/coreos/rkt/common"
+	stage1lib "github.com/coreos/rkt/pkg/stage1"
+)
+
+func TestAppDependencyOptions(t *testing.T) {
+	tests := []struct {
+		// annotations of the apps "migrate", "main" and "logger"
+		annotations [3]map[string]string
+		opts        map[types.ACName][]*unit.UnitOption
+		err         bool
+	}{
+		{
+			[3]map[string]string{},
+			map[types.ACName][]*unit.UnitOption{},
+			false,
+		},
+		{
+			[3]map[string]string{
+				nil,
+				{
+					common.AppRequiresAnnotation: "migrate",
+					common.AppAfterAnnotation:    "logger",
+				},
+				nil,
+			},
+			map[types.ACName][]*unit.UnitOption{
+				"main": {
+					unit.NewUnitOption("Unit", "Wants", "logger.service"),
+					unit.NewUnitOption("Unit", "After", "logger.service"),
+					unit.NewUnitOption("Unit", "Requires", "migrate.service"),
+					unit.NewUnitOption("Unit", "After", "migrate.service"),
+				},
+			},
+			false,
+		},
+		{
+			[3]map[string]string{{common.AppAfterAnnotation: "main, logger"}},
+			map[types.ACName][]*unit.UnitOption{
+				"migrate": {
+					unit.NewUnitOption("Unit", "Wants", "main.service"),
+					unit.NewUnitOption("Unit", "After", "main.service"),
+					unit.NewUnitOption("Unit", "Wants", "logger.service"),
+					unit.NewUnitOption("Unit", "After", "logger.service"),
+				},
+			},
+			false,
+		},
+		// unknown app
+		{[3]map[string]string{{common.AppAfterAnnotation: "db"}}, nil, true},
+		// the app itself
+		{[3]map[string]string{{common.AppRequiresAnnotation: "migrate"}}, nil, true},
+		// invalid name
+		{[3]map[string]string{{common.AppRequiresAnnotation: "Main"}}, nil, true},
+		// cycle
+		{
+			[3]map[string]string{
+				{common.AppAfterAnnotation: "logger"},
+				{common.AppRequiresAnnotation: "migrate"},
+				{common.AppAfterAnnotation: "main"},
+			},
+			nil,
+			true,
+		},
+	}
+
+	for i, tt := range tests {
+		var apps schema.AppList
+		for j, name := range []types.ACName{"migrate", "main", "logger"} {
+			ra := schema.RuntimeApp{Name: name}
+			for k, v := range tt.annotations[j] {
+				ra.Annotations.Set(types.ACIdentifier(k), v)
+			}
+			apps = append(apps, ra)
+		}
+		p := &Pod{Pod: &stage1lib.Pod{
+			Manifest: &schema.PodManifest{Apps: apps},
+		}}
+
+		for j := range apps {
+			opts, err := p.appDependencyOptions(&apps[j])
+			if gotErr := err != nil; gotErr != tt.err {
+				t.Errorf("#%d: app %q: err==%v, want errstate %t", i, apps[j].Name, err, tt.err)
+				continue
+			}
+			if !unit.AllMatch(opts, tt.opts[apps[j].Name]) {
+				t.Errorf("#%d: app %q: got options %v, want %v", i, apps[j].Name, opts, tt.opts[apps[j].Name])
+			}
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/coreos/go-systemd/unit"
+	"github.com/coreos/rkt/common"
+	initcommon "github.com/coreos/rkt/stage1/init/common"
+)
+
+var (
+	// maskedProcFiles and maskedProcDirs are the sensitive paths of /proc
+	// which are hidden from the apps, the files by /dev/null and the
+	// directories by an empty read-only tmpfs.
+	maskedProcFiles = []string{
+		"/proc/kcore",
+		"/proc/keys",
+		"/proc/latency_stats",
+		"/proc/sched_debug",
+		"/proc/timer_list",
+		"/proc/timer_stats",
+	}
+	maskedProcDirs = []string{
+		"/proc/acpi",
+		"/proc/scsi",
+	}
+	// readOnlyProcPaths are the paths of /proc which are made read-only
+	// with the sensitive ones masked.
+	readOnlyProcPaths = []string{
+		"/proc/asound",
+		"/proc/bus",
+		"/proc/fs",
+		"/proc/irq",
+		"/proc/sys",
+		"/proc/sysrq-trigger",
+	}
+)
+
+// hardeningOptions returns the options of the service unit of an app which
+// set PR_SET_NO_NEW_PRIVS, mask the sensitive paths of /proc and make /sys
+// read-only, depending on the annotations of the app.
+func (p *Pod) hardeningOptions(ra *schema.RuntimeApp, im *schema.ImageManifest) ([]*unit.UnitOption, error) {
+	var opts []*unit.UnitOption
+	appRootfs := filepath.Join("/", common.RelAppRootfsPath(ra.Name))
+
+	noNewPrivs, err := initcommon.GetAppBoolAnnotation(ra, im, common.NoNewPrivilegesAnnotation)
+	if err != nil {
+		return nil, err
+	}
+	if noNewPrivs {
+		opts = append(opts, unit.NewUnitOption("Service", "NoNewPrivileges", "yes"))
+	}
+
+	readOnlySys, err := initcommon.GetAppBoolAnnotation(ra, im, common.ReadOnlySysAnnotation)
+	if err != nil {
+		return nil, err
+	}
+	if readOnlySys {
+		opts = append(opts, unit.NewUnitOption("Service", "ReadOnlyDirectories", "-"+filepath.Join(appRootfs, "sys")))
+	}
+
+	maskProc, err := initcommon.GetAppBoolAnnotation(ra, im, common.MaskProcPathsAnnotation)
+	if err != nil {
+		return nil, err
+	}
+	if maskProc {
+		for _, path := range readOnlyProcPaths {
+			opts = append(opts, unit.NewUnitOption("Service", "ReadOnlyDirectories", "-"+filepath.Join(appRootfs, path)))
+		}
+
+		type mask struct {
+			path    string
+			what    string
+			options string
+		}
+		var masks []mask
+		for _, path := range maskedProcFiles {
+			masks = append(masks, mask{path, "/dev/null", "bind,ro"})
+		}
+		for _, path := range maskedProcDirs {
+			masks = append(masks, mask{path, "tmpfs", "ro,size=0"})
+		}
+
+		for _, m := range masks {
+			where := filepath.Join(appRootfs, m.path)
+			mountUnit := unit.UnitNamePathEscape(where + ".mount")
+			mountOpts := []*unit.UnitOption{
+				unit.NewUnitOption("Unit", "Description", fmt.Sprintf("Mask %s", where)),
+				unit.NewUnitOption("Unit", "DefaultDependencies", "false"),
+				unit.NewUnitOption("Unit", "After", InstantiatedPrepareAppUnitName(ra.Name)),
+				unit.NewUnitOption("Mount", "What", m.what),
+				unit.NewUnitOption("Mount", "Where", where),
+				unit.NewUnitOption("Mount", "Options", m.options),
+			}
+			if m.what == "tmpfs" {
+				mountOpts = append(mountOpts, unit.NewUnitOption("Mount", "Type", "tmpfs"))
+			}
+			if err := p.writeUnit(mountUnit, mountOpts); err != nil {
+				return nil, err
+			}
+
+			// the paths missing on the host can't be masked, nor accessed
+			opts = append(opts, unit.NewUnitOption("Unit", "Wants", mountUnit))
+			opts = append(opts, unit.NewUnitOption("Unit", "After", mountUnit))
+		}
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,216 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/coreos/go-systemd/unit"
+	"github.com/coreos/rkt/common"
+	initcommon "github.com/coreos/rkt/stage1/init/common"
+)
+
+const (
+	healthCheckBin = "/healthcheck.sh"
+
+	healthCheckActionRestart = "restart"
+	healthCheckActionNone    = "none"
+
+	defaultHealthCheckInterval = 30 * time.Second
+	defaultHealthCheckRetries  = 3
+)
+
+// healthCheck is the health check of an app, run periodically by the systemd
+// of the pod.
+type healthCheck struct {
+	kind     string   // exec, tcp or http
+	args     []string // arguments of the probe for healthcheck.sh
+	interval time.Duration
+	retries  int
+	action   string // what to do when the app is unhealthy, restart or none
+}
+
+// getHealthCheck returns the health check defined by the annotations of an
+// app, or nil if the app has none.
+func getHealthCheck(ra *schema.RuntimeApp, im *schema.ImageManifest) (*healthCheck, error) {
+	hc := &healthCheck{
+		interval: defaultHealthCheckInterval,
+		retries:  defaultHealthCheckRetries,
+		action:   healthCheckActionRestart,
+	}
+
+	if val, ok := initcommon.GetAppAnnotation(ra, im, common.HealthCheckExecAnnotation); ok {
+		hc.kind = "exec"
+		hc.args = strings.Fields(val)
+		if len(hc.args) == 0 {
+			return nil, fmt.Errorf("empty health check command")
+		}
+	}
+	if val, ok := initcommon.GetAppAnnotation(ra, im, common.HealthCheckShellAnnotation); ok {
+		if hc.kind != "" {
+			return nil, fmt.Errorf("multiple health checks defined")
+		}
+		if strings.TrimSpace(val) == "" {
+			return nil, fmt.Errorf("empty health check command")
+		}
+		hc.kind = "exec"
+		hc.args = []string{"/bin/sh", "-c", val}
+	}
+	if val, ok := initcommon.GetAppAnnotation(ra, im, common.HealthCheckTCPAnnotation); ok {
+		if hc.kind != "" {
+			return nil, fmt.Errorf("multiple health checks defined")
+		}
+		hc.kind = "tcp"
+		host, port, err := parseHealthCheckHostPort(val, "")
+		if err != nil {
+			return nil, fmt.Errorf("invalid tcp health check %q: %v", val, err)
+		}
+		hc.args = []string{host, port}
+	}
+	if val, ok := initcommon.GetAppAnnotation(ra, im, common.HealthCheckHTTPAnnotation); ok {
+		if hc.kind != "" {
+			return nil, fmt.Errorf("multiple health checks defined")
+		}
+		hc.kind = "http"
+		u, err := url.Parse(val)
+		if err != nil || u.Scheme != "http" || u.Host == "" {
+			return nil, fmt.Errorf("invalid http health check %q: must be an http:// URL", val)
+		}
+		host, port, err := parseHealthCheckHostPort(u.Host, "80")
+		if err != nil {
+			return nil, fmt.Errorf("invalid http health check %q: %v", val, err)
+		}
+		path := u.RequestURI()
+		hc.args = []string{host, port, path}
+	}
+	if hc.kind == "" {
+		return nil, nil
+	}
+
+	if val, ok := initcommon.GetAppAnnotation(ra, im, common.HealthCheckIntervalAnnotation); ok {
+		interval, err := time.ParseDuration(val)
+		if err != nil || interval < time.Second {
+			return nil, fmt.Errorf("invalid health check interval %q: must be a duration of at least 1s", val)
+		}
+		hc.interval = interval
+	}
+	if val, ok := initcommon.GetAppAnnotation(ra, im, common.HealthCheckRetriesAnnotation); ok {
+		retries, err := strconv.Atoi(val)
+		if err != nil || retries < 1 {
+			return nil, fmt.Errorf("invalid health check retries %q: must be a positive integer", val)
+		}
+		hc.retries = retries
+	}
+	if val, ok := initcommon.GetAppAnnotation(ra, im, common.HealthCheckActionAnnotation); ok {
+		switch val {
+		case healthCheckActionRestart, healthCheckActionNone:
+			hc.action = val
+		default:
+			return nil, fmt.Errorf("invalid health check action %q: must be %q or %q", val, healthCheckActionRestart, healthCheckActionNone)
+		}
+	}
+
+	return hc, nil
+}
+
+// parseHealthCheckHostPort splits an address of the form [HOST:]PORT. The
+// host defaults to localhost, which is in the network namespace of the pod.
+func parseHealthCheckHostPort(addr string, defaultPort string) (string, string, error) {
+	host, port := "127.0.0.1", addr
+	if strings.Contains(addr, ":") {
+		var err error
+		if host, port, err = net.SplitHostPort(addr); err != nil {
+			return "", "", err
+		}
+	} else if defaultPort != "" {
+		host, port = addr, defaultPort
+	}
+	if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+		return "", "", fmt.Errorf("invalid port %q", port)
+	}
+	return host, port, nil
+}
+
+// HealthCheckServiceUnitName returns the name of the systemd service unit
+// running the health check of the given app.
+func HealthCheckServiceUnitName(appName types.ACName) string {
+	return initcommon.HealthCheckServiceUnitName(appName)
+}
+
+// HealthCheckTimerUnitName returns the name of the systemd timer unit
+// scheduling the health check of the given app.
+func HealthCheckTimerUnitName(appName types.ACName) string {
+	return initcommon.HealthCheckTimerUnitName(appName)
+}
+
+// writeHealthCheckUnits writes the units running the health check of an app
+// while the app is active. execWrap is the command executing a program in the
+// app, used by the exec probes.
+func (p *Pod) writeHealthCheckUnits(appName types.ACName, hc *healthCheck, execWrap []string) error {
+	args := []string{healthCheckBin, appName.String(), strconv.Itoa(hc.retries), hc.action, hc.kind}
+	if hc.kind == "exec" {
+		args = append(args, execWrap...)
+	}
+	args = append(args, hc.args...)
+	interval := fmt.Sprintf("%ds", int(hc.interval.Seconds()))
+
+	serviceOpts := []*unit.UnitOption{
+		unit.NewUnitOption("Unit", "Description", fmt.Sprintf("Health check of %s", appName)),
+		unit.NewUnitOption("Unit", "DefaultDependencies", "false"),
+		unit.NewUnitOption("Service", "Type", "oneshot"),
+		unit.NewUnitOption("Service", "ExecStart", quoteExec(args)),
+		unit.NewUnitOption("Service", "TimeoutStartSec", interval),
+	}
+	timerOpts := []*unit.UnitOption{
+		unit.NewUnitOption("Unit", "Description", fmt.Sprintf("Periodic health check of %s", appName)),
+		unit.NewUnitOption("Unit", "DefaultDependencies", "false"),
+		unit.NewUnitOption("Unit", "BindsTo", ServiceUnitName(appName)),
+		unit.NewUnitOption("Unit", "After", ServiceUnitName(appName)),
+		unit.NewUnitOption("Timer", "OnActiveSec", interval),
+		unit.NewUnitOption("Timer", "OnUnitActiveSec", interval),
+		unit.NewUnitOption("Timer", "AccuracySec", "1s"),
+		unit.NewUnitOption("Timer", "Unit", HealthCheckServiceUnitName(appName)),
+	}
+
+	unitsPath := filepath.Join(common.Stage1RootfsPath(p.Root), unitsDir)
+	for name, opts := range map[string][]*unit.UnitOption{
+		HealthCheckServiceUnitName(appName): serviceOpts,
+		HealthCheckTimerUnitName(appName):   timerOpts,
+	} {
+		file, err := os.OpenFile(filepath.Join(unitsPath, name), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to create unit file: %v", err)
+		}
+		_, err = io.Copy(file, unit.Serialize(opts))
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("failed to write unit file: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+)
+
+func TestGetHealthCheck(t *testing.T) {
+	tests := []struct {
+		annotations map[string]string
+		expected    *healthCheck
+		werr        bool
+	}{
+		{
+			nil,
+			nil,
+			false,
+		},
+		{
+			map[string]string{common.HealthCheckExecAnnotation: "/bin/check --quick"},
+			&healthCheck{"exec", []string{"/bin/check", "--quick"}, 30 * time.Second, 3, "restart"},
+			false,
+		},
+		{
+			map[string]string{common.HealthCheckShellAnnotation: "curl -f http://localhost/ || exit 1"},
+			&healthCheck{"exec", []string{"/bin/sh", "-c", "curl -f http://localhost/ || exit 1"}, 30 * time.Second, 3, "restart"},
+			false,
+		},
+		{
+			map[string]string{
+				common.HealthCheckShellAnnotation: "true",
+				common.HealthCheckExecAnnotation:  "/bin/check",
+			},
+			nil,
+			true,
+		},
+		{
+			map[string]string{
+				common.HealthCheckTCPAnnotation:      "5432",
+				common.HealthCheckIntervalAnnotation: "10s",
+				common.HealthCheckRetriesAnnotation:  "5",
+				common.HealthCheckActionAnnotation:   "none",
+			},
+			&healthCheck{"tcp", []string{"127.0.0.1", "5432"}, 10 * time.Second, 5, "none"},
+			false,
+		},
+		{
+			map[string]string{common.HealthCheckHTTPAnnotation: "http://localhost:8080/healthz?full=1"},
+			&healthCheck{"http", []string{"localhost", "8080", "/healthz?full=1"}, 30 * time.Second, 3, "restart"},
+			false,
+		},
+		{
+			map[string]string{common.HealthCheckHTTPAnnotation: "http://localhost"},
+			&healthCheck{"http", []string{"localhost", "80", "/"}, 30 * time.Second, 3, "restart"},
+			false,
+		},
+		{
+			map[string]string{common.HealthCheckHTTPAnnotation: "https://localhost/"},
+			nil,
+			true,
+		},
+		{
+			map[string]string{common.HealthCheckTCPAnnotation: "99999"},
+			nil,
+			true,
+		},
+		{
+			map[string]string{
+				common.HealthCheckExecAnnotation: "/bin/check",
+				common.HealthCheckTCPAnnotation:  "5432",
+			},
+			nil,
+			true,
+		},
+		{
+			map[string]string{
+				common.HealthCheckExecAnnotation:   "/bin/check",
+				common.HealthCheckActionAnnotation: "reboot",
+			},
+			nil,
+			true,
+		},
+		{
+			map[string]string{
+				common.HealthCheckExecAnnotation:     "/bin/check",
+				common.HealthCheckIntervalAnnotation: "10ms",
+			},
+			nil,
+			true,
+		},
+	}
+
+	for i, tt := range tests {
+		ra := &schema.RuntimeApp{}
+		for name, value := range tt.annotations {
+			ra.Annotations.Set(types.ACIdentifier(name), value)
+		}
+
+		hc, err := getHealthCheck(ra, nil)
+		if gerr := (err != nil); gerr != tt.werr {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.werr)
+		}
+		if !reflect.DeepEqual(hc, tt.expected) {
+			t.Errorf("#%d: got %v, want %v", i, hc, tt.expected)
+		}
+	}
+}
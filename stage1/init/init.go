@@ -72,6 +72,7 @@ import (
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 	"unsafe"
 
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/goaci/proj2aci"
@@ -82,7 +83,10 @@ import (
 
 	"github.com/coreos/rkt/common"
 	"github.com/coreos/rkt/common/cgroup"
+	"github.com/coreos/rkt/common/iolimit"
+	"github.com/coreos/rkt/common/timing"
 	"github.com/coreos/rkt/networking"
+	stage1lib "github.com/coreos/rkt/pkg/stage1"
 	"github.com/coreos/rkt/pkg/sys"
 	"github.com/coreos/rkt/stage1/init/kvm"
 )
@@ -94,6 +98,10 @@ const (
 	interpBin = "/usr/lib/ld-linux-x86-64.so.2"
 	// Path to the localtime file/symlink in host
 	localtimePath = "/etc/localtime"
+	// Directory of the virtiofsd sockets, relative to the pod root
+	virtiofsSocketDir = "virtiofs"
+	// How long to wait for virtiofsd to create its sockets
+	virtiofsdStartTimeout = 10 * time.Second
 )
 
 // mirrorLocalZoneInfo tries to reproduce the /etc/localtime target in stage1/ to satisfy systemd-nspawn
@@ -121,7 +129,7 @@ func mirrorLocalZoneInfo(root string) {
 		return
 	}
 
-	dest, err := os.OpenFile(destp, os.O_CREATE|os.O_WRONLY, 0644)
+	dest, err := os.OpenFile(destp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
 	if err != nil {
 		return
 	}
@@ -158,8 +166,17 @@ func init() {
 	}
 }
 
-// machinedRegister checks if nspawn should register the pod to machined
-func machinedRegister() bool {
+// machinedRegister checks if nspawn should register the pod to machined:
+// machined must be available and the registration not disabled for the pod
+func machinedRegister(p *Pod) bool {
+	if p.machinedRegisterDisabled() {
+		return false
+	}
+	return machinedAvailable()
+}
+
+// machinedAvailable checks if machined supports the registration of pods by nspawn
+func machinedAvailable() bool {
 	// machined has a D-Bus interface following versioning guidelines, see:
 	// http://www.freedesktop.org/wiki/Software/systemd/machined/
 	// Therefore we can just check if the D-Bus method we need exists and we
@@ -254,11 +271,96 @@ func installAssets() error {
 	return proj2aci.PrepareAssets(assets, "./stage1/rootfs/", nil)
 }
 
-// getArgsEnv returns the nspawn or lkvm args and env according to the flavor used
+// checkKVMGuestFeatures checks that the guest kernel of the stage1 image can
+// run the pod with the hypervisor it asks for, and returns its features
+func checkKVMGuestFeatures(p *Pod) (kvm.GuestFeatures, error) {
+	hypervisor, err := kvm.GetHypervisor(p.Manifest.Annotations)
+	if err != nil {
+		return nil, err
+	}
+	features, err := kvm.ReadGuestFeatures(common.Stage1RootfsPath(p.Root))
+	if err != nil {
+		return nil, err
+	}
+	return features, kvm.CheckHypervisor(hypervisor, features)
+}
+
+// getKVMVolumeOptions returns how the host volumes of the pod are shared with
+// the guest in the kvm flavor
+func getKVMVolumeOptions(p *Pod) (kvm.VolumeOptions, error) {
+	hypervisor, err := kvm.GetHypervisor(p.Manifest.Annotations)
+	if err != nil {
+		return kvm.VolumeOptions{}, err
+	}
+	features, err := kvm.ReadGuestFeatures(common.Stage1RootfsPath(p.Root))
+	if err != nil {
+		return kvm.VolumeOptions{}, err
+	}
+	_, err = lookupPath(kvm.VirtiofsdBin, os.Getenv("PATH"))
+	return kvm.GetVolumeOptions(p.Manifest.Annotations, hypervisor, features, err == nil)
+}
+
+// startVirtiofsd starts the virtiofsd daemons serving the host volumes to the
+// hypervisor when they are shared with virtio-fs, and the root filesystem
+// to cloud-hypervisor. They exit when the hypervisor disconnects.
+func startVirtiofsd(p *Pod) error {
+	hypervisor, err := kvm.GetHypervisor(p.Manifest.Annotations)
+	if err != nil {
+		return err
+	}
+	volumeOpts, err := getKVMVolumeOptions(p)
+	if err != nil {
+		return err
+	}
+	if volumeOpts.FSType != kvm.VolumeFSVirtiofs {
+		return nil
+	}
+
+	virtiofsdPath, err := lookupPath(kvm.VirtiofsdBin, os.Getenv("PATH"))
+	if err != nil {
+		return err
+	}
+	socketDir := filepath.Join(p.Root, virtiofsSocketDir)
+	if err := os.MkdirAll(socketDir, 0700); err != nil {
+		return fmt.Errorf("failed to create virtiofsd socket directory: %v", err)
+	}
+
+	cmds := kvm.VirtiofsdCommands(virtiofsdPath, socketDir, p.Manifest.Volumes, volumeOpts)
+	if hypervisor == kvm.HypervisorCloudHypervisor {
+		rootfs, err := filepath.Abs(common.Stage1RootfsPath(p.Root))
+		if err != nil {
+			return err
+		}
+		cmds = append(cmds, kvm.RootfsVirtiofsdCommand(virtiofsdPath, socketDir, rootfs))
+	}
+	for _, cmd := range cmds {
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		if err := cmd.Start(); err != nil {
+			return fmt.Errorf("failed to start virtiofsd: %v", err)
+		}
+	}
+
+	if hypervisor == kvm.HypervisorCloudHypervisor {
+		if err := kvm.WaitRootfsVirtiofsdSocket(socketDir, virtiofsdStartTimeout); err != nil {
+			return err
+		}
+	}
+	return kvm.WaitVirtiofsdSockets(socketDir, p.Manifest.Volumes, virtiofsdStartTimeout)
+}
+
+// getArgsEnv returns the nspawn, lkvm, qemu or cloud-hypervisor args and env according to the flavor used
 func getArgsEnv(p *Pod, flavor string, debug bool, n *networking.Networking) ([]string, []string, error) {
 	var args []string
 	env := os.Environ()
 
+	devices, err := p.getDevices()
+	if err != nil {
+		return nil, nil, err
+	}
+	// whether nspawn registers the pod to machined
+	register := false
+
 	// We store the pod's flavor so we can later garbage collect it correctly
 	if err := os.Symlink(flavor, filepath.Join(p.Root, flavorFile)); err != nil {
 		return nil, nil, fmt.Errorf("failed to create flavor symlink: %v", err)
@@ -267,22 +369,51 @@ func getArgsEnv(p *Pod, flavor string, debug bool, n *networking.Networking) ([]
 	switch flavor {
 	case "kvm":
 		if privateUsers != "" {
-			return nil, nil, fmt.Errorf("flag --private-users cannot be used with an lkvm stage1")
+			return nil, nil, fmt.Errorf("flag --private-users cannot be used with a kvm stage1")
+		}
+		if len(devices) > 0 {
+			return nil, nil, fmt.Errorf("flag --device cannot be used with a kvm stage1")
+		}
+
+		hypervisor, err := kvm.GetHypervisor(p.Manifest.Annotations)
+		if err != nil {
+			return nil, nil, err
 		}
 
 		// kernel and lkvm are relative path, because init has /var/lib/rkt/..../uuid as its working directory
 		// TODO: move to path.go
 		kernelPath := filepath.Join(common.Stage1RootfsPath(p.Root), "bzImage")
-		lkvmPath := filepath.Join(common.Stage1RootfsPath(p.Root), "lkvm")
 		netDescriptions := kvm.GetNetworkDescriptions(n)
-		lkvmNetArgs, kernelNetParams, err := kvm.GetKVMNetArgs(netDescriptions)
+		var hvNetArgs, kernelNetParams []string
+		switch hypervisor {
+		case kvm.HypervisorQemu:
+			hvNetArgs, kernelNetParams, err = kvm.GetQemuNetArgs(netDescriptions)
+		case kvm.HypervisorCloudHypervisor:
+			hvNetArgs, kernelNetParams, err = kvm.GetCloudHypervisorNetArgs(netDescriptions)
+		default:
+			hvNetArgs, kernelNetParams, err = kvm.GetKVMNetArgs(netDescriptions)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		cid, useVsock, err := kvm.ReadGuestCID(p.Root)
 		if err != nil {
 			return nil, nil, err
 		}
+		if useVsock {
+			hvNetArgs = append(hvNetArgs, kvm.GetQemuVsockArgs(cid)...)
+		}
 
-		// TODO: base on resource isolators
-		cpu := 1
-		mem := 128
+		cpu, mem, err := kvm.GetVMResources(p.Manifest.Annotations, p.Manifest.Apps)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		gpuAddrs, err := p.getGPUPCIAddresses()
+		if err != nil {
+			return nil, nil, err
+		}
 
 		kernelParams := []string{
 			"console=hvc0",
@@ -308,10 +439,78 @@ func getArgsEnv(p *Pod, flavor string, debug bool, n *networking.Networking) ([]
 			kernelParams = append(kernelParams, "quiet")
 		}
 
+		if hypervisor == kvm.HypervisorCloudHypervisor {
+			chPath, err := lookupPath(kvm.CloudHypervisorBin, os.Getenv("PATH"))
+			if err != nil {
+				return nil, nil, err
+			}
+
+			// the root filesystem and the host volumes are served by
+			// virtiofsd, see startVirtiofsd
+			socketDir := filepath.Join(p.Root, virtiofsSocketDir)
+			vmlinuxPath := filepath.Join(common.Stage1RootfsPath(p.Root), kvm.CloudHypervisorKernel)
+			chArgs, rootfsParams := kvm.GetCloudHypervisorArgs(vmlinuxPath, cpu, mem, socketDir, p.Manifest.Volumes)
+			kernelParams = append(kernelParams, rootfsParams...)
+
+			args = append(args, chPath)
+			args = append(args, chArgs...)
+			// MACHINEID will be available as environment variable
+			args = append(args, "--cmdline", strings.Join(kernelParams, " "))
+			args = append(args, hvNetArgs...)
+			args = append(args, kvm.GetCloudHypervisorVfioArgs(gpuAddrs)...)
+
+			return args, env, nil
+		}
+
+		if hypervisor == kvm.HypervisorQemu {
+			qemuPath, err := lookupPath(kvm.QemuBin, os.Getenv("PATH"))
+			if err != nil {
+				return nil, nil, err
+			}
+
+			// stage1/rootfs is relative to run/pods/uuid dir, this is a place where systemd resides
+			rootfsArgs, rootfsParams := kvm.GetQemuRootfsArgs(common.Stage1RootfsPath(p.Root))
+			kernelParams = append(kernelParams, rootfsParams...)
+
+			args = append(args, []string{
+				qemuPath,
+				"-name", p.GetMachineID(),
+				"-machine", "accel=kvm",
+				"-cpu", "host",
+				"-smp", strconv.Itoa(cpu),
+				"-m", strconv.Itoa(mem),
+				"-no-reboot",
+				"-kernel", kernelPath,
+				// MACHINEID will be available as environment variable
+				"-append", strings.Join(kernelParams, " "),
+			}...,
+			)
+			args = append(args, kvm.GetQemuConsoleArgs()...)
+			args = append(args, rootfsArgs...)
+			args = append(args, hvNetArgs...)
+			args = append(args, kvm.GetQemuVfioArgs(gpuAddrs)...)
+
+			volumeOpts, err := getKVMVolumeOptions(p)
+			if err != nil {
+				return nil, nil, err
+			}
+			if volumeOpts.FSType == kvm.VolumeFSVirtiofs {
+				// host volume sharing with virtio-fs, see startVirtiofsd
+				socketDir := filepath.Join(p.Root, virtiofsSocketDir)
+				args = append(args, kvm.VolumesToQemuVirtiofsArgs(socketDir, p.Manifest.Volumes, mem)...)
+			} else {
+				// host volume sharing with 9p
+				args = append(args, kvm.VolumesToQemuArgs(p.Manifest.Volumes)...)
+			}
+
+			return args, env, nil
+		}
+
+		lkvmPath := filepath.Join(common.Stage1RootfsPath(p.Root), "lkvm")
 		args = append(args, []string{
 			"./" + lkvmPath, // relative path
 			"run",
-			"--name", "rkt-" + p.UUID.String(),
+			"--name", p.GetMachineID(),
 			"--no-dhcp", // speed bootup
 			"--cpu", strconv.Itoa(cpu),
 			"--mem", strconv.Itoa(mem),
@@ -322,7 +521,8 @@ func getArgsEnv(p *Pod, flavor string, debug bool, n *networking.Networking) ([]
 			"--params", strings.Join(kernelParams, " "),
 		}...,
 		)
-		args = append(args, lkvmNetArgs...)
+		args = append(args, hvNetArgs...)
+		args = append(args, kvm.GetKVMVfioArgs(gpuAddrs)...)
 
 		if debug {
 			args = append(args, "--debug")
@@ -349,7 +549,8 @@ func getArgsEnv(p *Pod, flavor string, debug bool, n *networking.Networking) ([]
 			args = append(args, fmt.Sprintf("-Z%s", context))
 		}
 
-		if machinedRegister() {
+		register = machinedRegister(p)
+		if register {
 			args = append(args, fmt.Sprintf("--register=true"))
 		} else {
 			args = append(args, fmt.Sprintf("--register=false"))
@@ -366,7 +567,8 @@ func getArgsEnv(p *Pod, flavor string, debug bool, n *networking.Networking) ([]
 			args = append(args, fmt.Sprintf("-Z%s", context))
 		}
 
-		if machinedRegister() {
+		register = machinedRegister(p)
+		if register {
 			args = append(args, fmt.Sprintf("--register=true"))
 		} else {
 			args = append(args, fmt.Sprintf("--register=false"))
@@ -401,7 +603,8 @@ func getArgsEnv(p *Pod, flavor string, debug bool, n *networking.Networking) ([]
 
 		args = append(args, hostNspawnBin)
 		args = append(args, "--boot") // Launch systemd in the pod
-		args = append(args, fmt.Sprintf("--register=true"))
+		register = !p.machinedRegisterDisabled()
+		args = append(args, fmt.Sprintf("--register=%t", register))
 
 		if context := os.Getenv(common.EnvSELinuxContext); context != "" {
 			args = append(args, fmt.Sprintf("-Z%s", context))
@@ -445,6 +648,17 @@ func getArgsEnv(p *Pod, flavor string, debug bool, n *networking.Networking) ([]
 		args = append(args, "--keep-unit")
 	}
 
+	// The device cgroup of the scope registered to machined only allows
+	// the devices created by systemd-nspawn. Otherwise, the pod is in the
+	// cgroup of its parent and the devices must be allowed there.
+	if register && !keepUnit {
+		gpuDevices, _, err := p.getGPUDevices()
+		if err != nil {
+			return nil, nil, err
+		}
+		args = append(args, deviceAllowArgs(append(devices, gpuDevices...))...)
+	}
+
 	nsargs, err := p.PodToNspawnArgs()
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to generate nspawn args: %v", err)
@@ -508,23 +722,30 @@ func forwardedPorts(pod *Pod) ([]networking.ForwardedPort, error) {
 	return fps, nil
 }
 
-func writePpid(pid int) error {
-	// write ppid file as specified in
-	// Documentation/devel/stage1-implementors-guide.md
-	out, err := os.Getwd()
+// addExecSpan records the exec of stage1, from the start time of the pod
+// written by stage0 to the start of stage1.
+func addExecSpan(timings *timing.Recorder, root string, start time.Time) error {
+	b, err := ioutil.ReadFile(filepath.Join(root, common.StartedFilename))
 	if err != nil {
-		return fmt.Errorf("Cannot get current working directory: %v\n", err)
+		return err
 	}
-	// we are the parent of the process that is PID 1 in the container so we write our PID to "ppid"
-	err = ioutil.WriteFile(filepath.Join(out, "ppid"),
-		[]byte(fmt.Sprintf("%d\n", pid)), 0644)
+	started, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(b)))
 	if err != nil {
-		return fmt.Errorf("Cannot write ppid file: %v\n", err)
+		return err
 	}
+	timings.Add(timing.Span{
+		Name:     timing.SpanExecStage1,
+		Start:    started.UTC(),
+		Duration: start.Sub(started),
+	})
 	return nil
 }
 
 func stage1() int {
+	start := time.Now()
+	timings := timing.NewRecorder()
+	endInit := timings.Start(timing.SpanStage1Init, nil)
+
 	uuid, err := types.NewUUID(flag.Arg(0))
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "UUID is missing or malformed")
@@ -538,6 +759,10 @@ func stage1() int {
 		return 1
 	}
 
+	if err := addExecSpan(timings, p.Root, start); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to time the exec of stage1: %v\n", err)
+	}
+
 	// set close-on-exec flag on RKT_LOCK_FD so it gets correctly closed when invoking
 	// network plugins
 	lfd, err := common.GetRktLockFD()
@@ -559,6 +784,22 @@ func stage1() int {
 		return 3
 	}
 
+	// the host talks to the guest of the kvm flavor over vsock when the
+	// pod asks for it, so the pod does not need a network
+	useVsock := false
+	if flavor == "kvm" {
+		features, err := checkKVMGuestFeatures(p)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to check the guest kernel: %v\n", err)
+			return 6
+		}
+		useVsock, err = kvm.UseVsock(p.Manifest.Annotations, features)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to set up vsock: %v\n", err)
+			return 6
+		}
+	}
+
 	var n *networking.Networking
 	if netList.Contained() {
 		fps, err := forwardedPorts(p)
@@ -567,7 +808,15 @@ func stage1() int {
 			return 6
 		}
 
-		n, err = networking.Setup(root, p.UUID, fps, netList, localConfig, flavor)
+		pluginArgs, err := networking.GetPluginArgs(p.Manifest.Annotations)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 6
+		}
+
+		endNetwork := timings.Start(timing.SpanNetworkSetup, map[string]string{"networks": netList.String()})
+		n, err = networking.Setup(root, p.UUID, fps, netList, pluginArgs, localConfig, flavor)
+		endNetwork()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Failed to setup network: %v\n", err)
 			return 6
@@ -589,8 +838,8 @@ func stage1() int {
 			p.MetadataServiceURL = common.MetadataServicePublicURL(hostIP, mdsToken)
 		}
 	} else {
-		if flavor == "kvm" {
-			fmt.Fprintf(os.Stderr, "Flavor kvm requires private network configuration (try --net).\n")
+		if flavor == "kvm" && !useVsock {
+			fmt.Fprintln(os.Stderr, "Flavor kvm requires private network configuration (try --net), or vsock (try --vm-vsock).")
 			return 6
 		}
 		if len(mdsToken) > 0 {
@@ -598,6 +847,34 @@ func stage1() int {
 		}
 	}
 
+	if useVsock {
+		// the apps reach the metadata service through the vsock proxy
+		// listening on the loopback of the guest
+		if len(mdsToken) > 0 {
+			p.MetadataServiceURL = common.MetadataServicePublicURL(localhostIP, mdsToken)
+		}
+		if err := p.writeVsockUnits(len(mdsToken) > 0); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write vsock units: %v\n", err)
+			return 2
+		}
+		if err := kvm.WriteGuestCID(p.Root, kvm.GuestCID(&p.UUID)); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write vsock context ID: %v\n", err)
+			return 2
+		}
+	}
+
+	if flavor != "kvm" {
+		var appNames []types.ACName
+		for _, app := range p.Manifest.Apps {
+			appNames = append(appNames, app.Name)
+		}
+		p.InheritedSockets, err = getInheritedSockets(appNames)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to get the sockets passed by systemd: %v\n", err)
+			return 2
+		}
+	}
+
 	if err = p.WriteDefaultTarget(); err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to write default.target: %v\n", err)
 		return 2
@@ -637,16 +914,26 @@ func stage1() int {
 		log.Fatalf("Error making / a shared and slave mount: %v", err)
 	}
 
-	enabledCgroups, err := cgroup.GetEnabledCgroups()
+	unifiedCgroups, err := cgroup.IsUnified()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error getting cgroups: %v", err)
+		fmt.Fprintf(os.Stderr, "Error detecting the cgroup hierarchy: %v", err)
 		return 5
 	}
 
-	// mount host cgroups in the rkt mount namespace
-	if err := mountHostCgroups(enabledCgroups); err != nil {
-		log.Fatalf("Couldn't mount the host cgroups: %v\n", err)
-		return 5
+	var enabledCgroups map[int][]string
+	if !unifiedCgroups {
+		enabledCgroups, err = cgroup.GetEnabledCgroups()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error getting cgroups: %v", err)
+			return 5
+		}
+
+		// mount host cgroups in the rkt mount namespace
+		// the unified hierarchy is always mounted in /sys/fs/cgroup
+		if err := mountHostCgroups(enabledCgroups); err != nil {
+			log.Fatalf("Couldn't mount the host cgroups: %v\n", err)
+			return 5
+		}
 	}
 
 	var serviceNames []string
@@ -655,21 +942,53 @@ func stage1() int {
 	}
 	s1Root := common.Stage1RootfsPath(p.Root)
 	machineID := p.GetMachineID()
-	subcgroup, err := getContainerSubCgroup(machineID)
+	subcgroup, err := getContainerSubCgroup(machineID, machinedRegister(p), unifiedCgroups)
 	if err == nil {
-		if err := mountContainerCgroups(s1Root, enabledCgroups, subcgroup, serviceNames); err != nil {
+		if unifiedCgroups {
+			err = mountContainerUnifiedCgroups(s1Root, subcgroup, serviceNames)
+		} else {
+			err = mountContainerCgroups(s1Root, enabledCgroups, subcgroup, serviceNames)
+		}
+		if err != nil {
 			fmt.Fprintf(os.Stderr, "Couldn't mount the container cgroups: %v\n", err)
 			return 5
 		}
+		// the apps of the kvm flavor run in the virtual machine, outside
+		// of these cgroups
+		if flavor != "kvm" {
+			if err := setIOLimits(p, subcgroup); err != nil {
+				fmt.Fprintf(os.Stderr, "Couldn't set the IO limits of the apps: %v\n", err)
+				return 5
+			}
+		}
+		if err := writePodCgroups(p, subcgroup, flavor); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 5
+		}
 	} else {
 		fmt.Fprintf(os.Stderr, "Continuing with per-app isolators disabled: %v\n", err)
 	}
 
-	if err = writePpid(os.Getpid()); err != nil {
+	if flavor == "kvm" {
+		if err := startVirtiofsd(p); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to share volumes with virtio-fs: %v\n", err)
+			return 3
+		}
+	}
+
+	// we are the parent of the process that is PID 1 in the container so we write our PID to "ppid"
+	if err = stage1lib.WritePpid(p.Root, os.Getpid()); err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 		return 4
 	}
 
+	endInit()
+	// the report only helps diagnosing slow starts, the pod is fine
+	// without it
+	if err := timings.Flush(p.Root); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+
 	err = withClearedCloExec(lfd, func() error {
 		return syscall.Exec(args[0], args, env)
 	})
@@ -717,6 +1036,20 @@ func mountHostCgroups(enabledCgroups map[int][]string) error {
 	return nil
 }
 
+// setIOLimits throttles the disk IO of the apps with an io isolator.
+func setIOLimits(p *Pod, subcgroup string) error {
+	for _, ra := range p.Manifest.Apps {
+		for _, i := range ra.App.Isolators {
+			if l, ok := i.Value().(*iolimit.IOLimits); ok {
+				if err := cgroup.SetIOLimits(subcgroup, ServiceUnitName(ra.Name), l.Limits()); err != nil {
+					return fmt.Errorf("app %q: %v", ra.Name, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
 // mountContainerCgroups mounts the cgroup controllers hierarchy in the container's
 // namespace read-only, leaving the needed knobs in the subcgroup for each-app
 // read-write so systemd inside stage1 can apply isolators to them
@@ -731,7 +1064,21 @@ func mountContainerCgroups(s1Root string, enabledCgroups map[int][]string, subcg
 	return nil
 }
 
-func getContainerSubCgroup(machineID string) (string, error) {
+// mountContainerUnifiedCgroups mounts the unified cgroup hierarchy in the
+// container's namespace read-only, leaving the needed knobs in the subcgroup
+// for each-app read-write so systemd inside stage1 can apply isolators to them
+func mountContainerUnifiedCgroups(s1Root string, subcgroup string, serviceNames []string) error {
+	if err := cgroup.CreateUnifiedCgroups(s1Root); err != nil {
+		return fmt.Errorf("error creating container cgroups: %v\n", err)
+	}
+	if err := cgroup.RemountUnifiedCgroupsRO(s1Root, subcgroup, serviceNames); err != nil {
+		return fmt.Errorf("error restricting container cgroups: %v\n", err)
+	}
+
+	return nil
+}
+
+func getContainerSubCgroup(machineID string, register bool, unifiedCgroups bool) (string, error) {
 	var subcgroup string
 	fromUnit, err := isRunningFromUnitFile()
 	if err != nil {
@@ -752,7 +1099,7 @@ func getContainerSubCgroup(machineID string) (string, error) {
 		}
 		subcgroup = filepath.Join(slicePath, unit, "system.slice")
 	} else {
-		if machinedRegister() {
+		if register {
 			// we are not in the final cgroup yet: systemd-nspawn will move us
 			// to the correct cgroup later during registration so we can't
 			// look it up in /proc/self/cgroup
@@ -762,7 +1109,12 @@ func getContainerSubCgroup(machineID string) (string, error) {
 		} else {
 			// when registration is disabled the container will be directly
 			// under rkt's cgroup so we can look it up in /proc/self/cgroup
-			ownCgroupPath, err := cgroup.GetOwnCgroupPath("name=systemd")
+			var ownCgroupPath string
+			if unifiedCgroups {
+				ownCgroupPath, err = cgroup.GetOwnUnifiedCgroupPath()
+			} else {
+				ownCgroupPath, err = cgroup.GetOwnCgroupPath("name=systemd")
+			}
 			if err != nil {
 				return "", fmt.Errorf("could not get own cgroup path: %v", err)
 			}
@@ -771,7 +1123,12 @@ func getContainerSubCgroup(machineID string) (string, error) {
 			// ourselves to it
 			if ownCgroupPath == "/" {
 				ownCgroupPath = "/rkt"
-				if err := cgroup.JoinSubcgroup("systemd", ownCgroupPath); err != nil {
+				if unifiedCgroups {
+					err = cgroup.JoinUnifiedSubcgroup(ownCgroupPath)
+				} else {
+					err = cgroup.JoinSubcgroup("systemd", ownCgroupPath)
+				}
+				if err != nil {
 					return "", fmt.Errorf("error joining %s subcgroup: %v", ownCgroupPath, err)
 				}
 			}
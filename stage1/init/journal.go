@@ -0,0 +1,95 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/coreos/go-systemd/unit"
+	"github.com/coreos/rkt/common"
+)
+
+// journaldConfigPath is the drop-in of the journald of stage1 limiting the
+// journal of the pod.
+const journaldConfigPath = "/etc/systemd/journald.conf.d/rkt-limits.conf"
+
+// getJournalOptions returns the journald options of the journal limits
+// requested in the pod annotations.
+func (p *Pod) getJournalOptions() ([]*unit.UnitOption, error) {
+	var opts []*unit.UnitOption
+
+	if size, ok := p.Manifest.Annotations.Get(common.JournalMaxUseAnnotation); ok {
+		if err := common.ValidateMemorySize(size); err != nil {
+			return nil, fmt.Errorf("invalid journal max use: %v", err)
+		}
+		// journald only knows upper case suffixes
+		size = strings.ToUpper(size)
+		opts = append(opts,
+			unit.NewUnitOption("Journal", "SystemMaxUse", size),
+			unit.NewUnitOption("Journal", "RuntimeMaxUse", size))
+	}
+
+	if burst, ok := p.Manifest.Annotations.Get(common.JournalRateLimitBurstAnnotation); ok {
+		if n, err := strconv.Atoi(burst); err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid journal rate limit burst %q", burst)
+		}
+		opts = append(opts, unit.NewUnitOption("Journal", "RateLimitBurst", burst))
+	}
+
+	if interval, ok := p.Manifest.Annotations.Get(common.JournalRateLimitIntervalAnnotation); ok {
+		d, err := time.ParseDuration(interval)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid journal rate limit interval %q", interval)
+		}
+		opts = append(opts, unit.NewUnitOption("Journal", "RateLimitInterval", fmt.Sprintf("%dus", d/time.Microsecond)))
+	}
+
+	return opts, nil
+}
+
+// writeJournaldConfig writes the journald drop-in limiting the journal of
+// the pod, if any limit is requested.
+func (p *Pod) writeJournaldConfig() error {
+	opts, err := p.getJournalOptions()
+	if err != nil {
+		return err
+	}
+	if len(opts) == 0 {
+		return nil
+	}
+
+	path := filepath.Join(common.Stage1RootfsPath(p.Root), journaldConfigPath)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create journald configuration directory: %v", err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create journald configuration: %v", err)
+	}
+	defer file.Close()
+
+	if _, err = io.Copy(file, unit.Serialize(opts)); err != nil {
+		return fmt.Errorf("failed to write journald configuration: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+	stage1lib "github.com/coreos/rkt/pkg/stage1"
+)
+
+func TestGetJournalOptions(t *testing.T) {
+	tests := []struct {
+		annotations types.Annotations
+		options     []string
+		err         bool
+	}{
+		{nil, nil, false},
+		{
+			types.Annotations{{Name: common.JournalMaxUseAnnotation, Value: "512m"}},
+			[]string{"SystemMaxUse=512M", "RuntimeMaxUse=512M"},
+			false,
+		},
+		{
+			types.Annotations{
+				{Name: common.JournalRateLimitBurstAnnotation, Value: "100"},
+				{Name: common.JournalRateLimitIntervalAnnotation, Value: "30s"},
+			},
+			[]string{"RateLimitBurst=100", "RateLimitInterval=30000000us"},
+			false,
+		},
+		{
+			types.Annotations{{Name: common.JournalRateLimitIntervalAnnotation, Value: "0"}},
+			[]string{"RateLimitInterval=0us"},
+			false,
+		},
+		{
+			types.Annotations{{Name: common.JournalMaxUseAnnotation, Value: "1g\nStorage=none"}},
+			nil,
+			true,
+		},
+		{
+			types.Annotations{{Name: common.JournalRateLimitBurstAnnotation, Value: "-1"}},
+			nil,
+			true,
+		},
+		{
+			types.Annotations{{Name: common.JournalRateLimitIntervalAnnotation, Value: "30"}},
+			nil,
+			true,
+		},
+	}
+
+	for i, tt := range tests {
+		p := &Pod{Pod: &stage1lib.Pod{
+			Manifest: &schema.PodManifest{Annotations: tt.annotations},
+		}}
+		opts, err := p.getJournalOptions()
+		if tt.err {
+			if err == nil {
+				t.Errorf("#%d: expected error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+			continue
+		}
+		var options []string
+		for _, o := range opts {
+			if o.Section != "Journal" {
+				t.Errorf("#%d: unexpected section %q", i, o.Section)
+			}
+			options = append(options, o.Name+"="+o.Value)
+		}
+		if !reflect.DeepEqual(options, tt.options) {
+			t.Errorf("#%d: got options %v, want %v", i, options, tt.options)
+		}
+	}
+}
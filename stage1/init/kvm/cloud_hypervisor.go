@@ -0,0 +1,110 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvm
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+)
+
+const (
+	// CloudHypervisorBin is the cloud-hypervisor binary, looked up in the
+	// PATH of the host
+	CloudHypervisorBin = "cloud-hypervisor"
+
+	// CloudHypervisorKernel is the uncompressed kernel booted by
+	// cloud-hypervisor, in the stage1 rootfs
+	CloudHypervisorKernel = "vmlinux"
+
+	// rootfsVirtiofsTag is the virtio-fs tag of the root filesystem of
+	// the guest, which cannot be the name of a volume
+	rootfsVirtiofsTag = "/dev/root"
+	// rootfsVirtiofsSocket is the socket of the virtiofsd serving the root
+	// filesystem, which cannot be the socket of a volume
+	rootfsVirtiofsSocket = "_rootfs.sock"
+)
+
+// RootfsVirtiofsdCommand returns the virtiofsd command serving the rootfs
+// directory to cloud-hypervisor as the root filesystem of the guest,
+// listening on a socket in socketDir.
+func RootfsVirtiofsdCommand(virtiofsdPath, socketDir, rootfs string) *exec.Cmd {
+	return exec.Command(virtiofsdPath,
+		"--socket-path="+filepath.Join(socketDir, rootfsVirtiofsSocket),
+		"--shared-dir="+rootfs,
+	)
+}
+
+// WaitRootfsVirtiofsdSocket waits until the virtiofsd started with the
+// RootfsVirtiofsdCommand has created its socket.
+func WaitRootfsVirtiofsdSocket(socketDir string, timeout time.Duration) error {
+	return waitSocket(filepath.Join(socketDir, rootfsVirtiofsSocket), time.Now().Add(timeout))
+}
+
+// GetCloudHypervisorArgs returns the cloud-hypervisor arguments, without
+// the network ones, and the kernel parameters booting the guest from the
+// root filesystem and sharing the host volumes with the virtiofsd daemons
+// listening in socketDir.
+func GetCloudHypervisorArgs(kernelPath string, cpu, mem int, socketDir string, volumes []types.Volume) ([]string, []string) {
+	args := []string{
+		"--kernel", kernelPath,
+		"--cpus", "boot=" + strconv.Itoa(cpu),
+		// vhost-user needs the memory of the guest to be shared with
+		// virtiofsd
+		"--memory", fmt.Sprintf("size=%dM,shared=on", mem),
+		// hvc0, like with the other hypervisors
+		"--console", "tty",
+		"--serial", "off",
+	}
+
+	fs := []string{fmt.Sprintf("tag=%s,socket=%s", rootfsVirtiofsTag, filepath.Join(socketDir, rootfsVirtiofsSocket))}
+	for _, vol := range volumes {
+		if vol.Kind != "host" {
+			continue
+		}
+		fs = append(fs, fmt.Sprintf("tag=%s,socket=%s", vol.Name, virtiofsSocketPath(socketDir, vol)))
+	}
+	args = append(args, "--fs")
+	args = append(args, fs...)
+
+	kernelParams := []string{
+		"root=" + rootfsVirtiofsTag,
+		"rw",
+		"rootfstype=virtiofs",
+	}
+	return args, kernelParams
+}
+
+// GetCloudHypervisorNetArgs returns additional arguments that need to be
+// passed to kernel and cloud-hypervisor to configure networks properly.
+// The guest is connected to the tap interfaces created by rkt.
+func GetCloudHypervisorNetArgs(nds []netDescriber) ([]string, []string, error) {
+	var nets []string
+	var kernelParams []string
+
+	for i, nd := range nds {
+		kernelParams = append(kernelParams, kernelNetParam(i, nd))
+		nets = append(nets, "tap="+nd.IfName())
+	}
+
+	if len(nets) == 0 {
+		return nil, nil, nil
+	}
+	return append([]string{"--net"}, nets...), kernelParams, nil
+}
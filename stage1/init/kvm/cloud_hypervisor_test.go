@@ -0,0 +1,88 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvm
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+)
+
+func TestGetCloudHypervisorArgs(t *testing.T) {
+	volumes := []types.Volume{
+		{Name: *types.MustACName("data"), Kind: "host", Source: "/srv/data"},
+		{Name: *types.MustACName("tmp"), Kind: "empty"},
+	}
+	expectedArgs := []string{
+		"--kernel", "stage1/rootfs/vmlinux",
+		"--cpus", "boot=2",
+		"--memory", "size=512M,shared=on",
+		"--console", "tty",
+		"--serial", "off",
+		"--fs",
+		"tag=/dev/root,socket=/pod/virtiofs/_rootfs.sock",
+		"tag=data,socket=/pod/virtiofs/data.sock",
+	}
+	expectedKernel := []string{"root=/dev/root", "rw", "rootfstype=virtiofs"}
+
+	args, kernelParams := GetCloudHypervisorArgs("stage1/rootfs/vmlinux", 2, 512, "/pod/virtiofs", volumes)
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Errorf("expected args %v, got %v", expectedArgs, args)
+	}
+	if !reflect.DeepEqual(kernelParams, expectedKernel) {
+		t.Errorf("expected kernel params %v, got %v", expectedKernel, kernelParams)
+	}
+}
+
+func TestGetCloudHypervisorNetArgs(t *testing.T) {
+	nds := []netDescriber{
+		testNetDescriber{
+			net.ParseIP("1.1.1.1"),
+			net.ParseIP("2.2.2.2"),
+			net.ParseIP("255.255.255.0"),
+			"fooInt",
+			false,
+		},
+		testNetDescriber{
+			net.ParseIP("1.1.1.1"),
+			net.ParseIP("3.3.3.3"),
+			net.ParseIP("255.255.255.0"),
+			"barInt",
+			true,
+		},
+	}
+	expectedArgs := []string{"--net", "tap=fooInt", "tap=barInt"}
+	expectedKernel := []string{
+		"ip=2.2.2.2:::255.255.255.0::eth0:::",
+		"ip=3.3.3.3::1.1.1.1:255.255.255.0::eth1:::",
+	}
+
+	args, kernelParams, err := GetCloudHypervisorNetArgs(nds)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Errorf("expected cloud-hypervisor args %v, got %v", expectedArgs, args)
+	}
+	if !reflect.DeepEqual(kernelParams, expectedKernel) {
+		t.Errorf("expected kernel params %v, got %v", expectedKernel, kernelParams)
+	}
+
+	if args, kernelParams, err := GetCloudHypervisorNetArgs(nil); args != nil || kernelParams != nil || err != nil {
+		t.Errorf("expected no arguments without network, got %v, %v, %v", args, kernelParams, err)
+	}
+}
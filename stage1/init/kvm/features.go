@@ -0,0 +1,77 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvm
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// GuestFeaturesFilename is the file, in the stage1 rootfs, listing the
+	// features of the guest kernel, one per line. It is generated from the
+	// configuration of the kernel when the stage1 image is built. The
+	// guest kernel of a stage1 image without it has none of the features.
+	GuestFeaturesFilename = "guest-kernel-features"
+
+	// GuestFeatureVirtiofs is the virtio-fs support of the guest kernel
+	// (Linux >= 5.4)
+	GuestFeatureVirtiofs = "virtiofs"
+	// GuestFeatureVsock is the virtio-vsock support of the guest kernel
+	// (Linux >= 4.8)
+	GuestFeatureVsock = "vsock"
+)
+
+// GuestFeatures are the features of the guest kernel of a stage1 image.
+type GuestFeatures map[string]bool
+
+// ReadGuestFeatures reads the features of the guest kernel from the
+// GuestFeaturesFilename file of the stage1 rootfs.
+func ReadGuestFeatures(stage1Rootfs string) (GuestFeatures, error) {
+	features := make(GuestFeatures)
+
+	f, err := os.Open(filepath.Join(stage1Rootfs, GuestFeaturesFilename))
+	if os.IsNotExist(err) {
+		return features, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if feature := strings.TrimSpace(scanner.Text()); feature != "" {
+			features[feature] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", GuestFeaturesFilename, err)
+	}
+	return features, nil
+}
+
+// CheckHypervisor checks that the guest kernel can run with the hypervisor.
+// cloud-hypervisor boots the guest on a virtio-fs root filesystem, so the
+// guest kernel needs virtio-fs.
+func CheckHypervisor(hypervisor string, features GuestFeatures) error {
+	if hypervisor == HypervisorCloudHypervisor && !features[GuestFeatureVirtiofs] {
+		return fmt.Errorf("the %s hypervisor needs a stage1 image with a guest kernel supporting virtio-fs (Linux >= 5.4)", HypervisorCloudHypervisor)
+	}
+	return nil
+}
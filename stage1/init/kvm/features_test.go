@@ -0,0 +1,68 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvm
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadGuestFeatures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "features-test")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	features, err := ReadGuestFeatures(dir)
+	if err != nil || len(features) != 0 {
+		t.Errorf("expected no features without the file, got %v, %v", features, err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, GuestFeaturesFilename), []byte("virtiofs\n\nfoo\n"), 0644); err != nil {
+		t.Fatalf("error writing features: %v", err)
+	}
+	features, err = ReadGuestFeatures(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := GuestFeatures{GuestFeatureVirtiofs: true, "foo": true}
+	if !reflect.DeepEqual(features, expected) {
+		t.Errorf("expected %v, got %v", expected, features)
+	}
+}
+
+func TestCheckHypervisor(t *testing.T) {
+	tests := []struct {
+		hypervisor string
+		features   GuestFeatures
+		err        bool
+	}{
+		{HypervisorLkvm, GuestFeatures{}, false},
+		{HypervisorQemu, GuestFeatures{}, false},
+		{HypervisorCloudHypervisor, GuestFeatures{}, true},
+		{HypervisorCloudHypervisor, GuestFeatures{GuestFeatureVirtiofs: true}, false},
+	}
+
+	for i, tt := range tests {
+		err := CheckHypervisor(tt.hypervisor, tt.features)
+		if (err != nil) != tt.err {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+		}
+	}
+}
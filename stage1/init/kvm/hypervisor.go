@@ -0,0 +1,116 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+)
+
+const (
+	// HypervisorLkvm is the default hypervisor of the kvm flavor
+	HypervisorLkvm = "lkvm"
+	// HypervisorQemu is qemu with kvm acceleration
+	HypervisorQemu = "qemu"
+	// HypervisorCloudHypervisor is cloud-hypervisor, a lightweight VMM
+	// booting fast with a small footprint. It has no virtio-9p, so the
+	// root filesystem and the host volumes are shared with virtio-fs.
+	HypervisorCloudHypervisor = "cloud-hypervisor"
+
+	// QemuBin is the qemu binary, looked up in the PATH of the host
+	QemuBin = "qemu-system-x86_64"
+
+	// qemuRootTag is the 9p mount tag of the root filesystem of the guest
+	qemuRootTag = "/dev/root"
+)
+
+// GetHypervisor returns the hypervisor requested with the
+// common.KVMHypervisorAnnotation pod annotation, lkvm if none is requested.
+func GetHypervisor(annotations types.Annotations) (string, error) {
+	hypervisor, ok := annotations.Get(common.KVMHypervisorAnnotation)
+	if !ok {
+		return HypervisorLkvm, nil
+	}
+
+	switch hypervisor {
+	case HypervisorLkvm, HypervisorQemu, HypervisorCloudHypervisor:
+		return hypervisor, nil
+	default:
+		return "", fmt.Errorf("unsupported hypervisor %q, must be %q, %q or %q", hypervisor, HypervisorLkvm, HypervisorQemu, HypervisorCloudHypervisor)
+	}
+}
+
+// GetQemuRootfsArgs returns the qemu arguments and the kernel parameters
+// sharing the rootfs directory with the guest through virtio-9p and using
+// it as the root filesystem of the guest (lkvm does the same with --disk).
+func GetQemuRootfsArgs(rootfs string) ([]string, []string) {
+	qemuArgs := []string{
+		"-fsdev", fmt.Sprintf("local,id=root,path=%s,security_model=none", qemuEscape(rootfs)),
+		"-device", fmt.Sprintf("virtio-9p-pci,fsdev=root,mount_tag=%s", qemuRootTag),
+	}
+	kernelParams := []string{
+		"root=" + qemuRootTag,
+		"rw",
+		"rootfstype=9p",
+		"rootflags=trans=virtio,version=9p2000.L",
+	}
+	return qemuArgs, kernelParams
+}
+
+// qemuEscape escapes a value of a qemu option list, where a comma separates
+// the options unless it is doubled.
+func qemuEscape(val string) string {
+	return strings.Replace(val, ",", ",,", -1)
+}
+
+// GetQemuConsoleArgs returns the qemu arguments wiring the virtio console of
+// the guest (hvc0) to the standard input and output of qemu, so the output
+// of the pod and of its interactive app goes to the terminal like with lkvm.
+func GetQemuConsoleArgs() []string {
+	return []string{
+		"-nographic",
+		"-nodefaults",
+		"-chardev", "stdio,id=console,signal=off",
+		"-device", "virtio-serial-pci",
+		"-device", "virtconsole,chardev=console",
+	}
+}
+
+// VolumesToQemuArgs prepares argument list to be passed to qemu to configure
+// shared volumes (only for "host" kind) through virtio-9p, the mount tags are
+// the same as with lkvm.
+func VolumesToQemuArgs(volumes []types.Volume) []string {
+	var args []string
+
+	for i, vol := range volumes {
+		if vol.Kind != "host" {
+			continue
+		}
+		id := fmt.Sprintf("vol%d", i)
+		fsdev := fmt.Sprintf("local,id=%s,path=%s,security_model=none", id, qemuEscape(vol.Source))
+		if vol.ReadOnly != nil && *vol.ReadOnly {
+			fsdev += ",readonly"
+		}
+		args = append(args,
+			"-fsdev", fsdev,
+			"-device", fmt.Sprintf("virtio-9p-pci,fsdev=%s,mount_tag=%s", id, vol.Name),
+		)
+	}
+
+	return args
+}
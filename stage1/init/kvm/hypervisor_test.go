@@ -0,0 +1,90 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvm
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+)
+
+func TestGetHypervisor(t *testing.T) {
+	tests := []struct {
+		hypervisor string
+		expected   string
+		err        bool
+	}{
+		{"", HypervisorLkvm, false},
+		{"lkvm", HypervisorLkvm, false},
+		{"qemu", HypervisorQemu, false},
+		{"cloud-hypervisor", HypervisorCloudHypervisor, false},
+		{"xen", "", true},
+	}
+
+	for i, tt := range tests {
+		var annotations types.Annotations
+		if tt.hypervisor != "" {
+			annotations.Set(types.ACIdentifier(common.KVMHypervisorAnnotation), tt.hypervisor)
+		}
+		hypervisor, err := GetHypervisor(annotations)
+		if (err != nil) != tt.err {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+		}
+		if hypervisor != tt.expected {
+			t.Errorf("#%d: expected %q, got %q", i, tt.expected, hypervisor)
+		}
+	}
+}
+
+func TestVolumesToQemuArgs(t *testing.T) {
+	readOnly := true
+	volumes := []types.Volume{
+		{Name: *types.MustACName("data"), Kind: "host", Source: "/srv/data"},
+		{Name: *types.MustACName("tmp"), Kind: "empty"},
+		{Name: *types.MustACName("conf"), Kind: "host", Source: "/etc/app", ReadOnly: &readOnly},
+	}
+	expected := []string{
+		"-fsdev", "local,id=vol0,path=/srv/data,security_model=none",
+		"-device", "virtio-9p-pci,fsdev=vol0,mount_tag=data",
+		"-fsdev", "local,id=vol2,path=/etc/app,security_model=none,readonly",
+		"-device", "virtio-9p-pci,fsdev=vol2,mount_tag=conf",
+	}
+
+	args := VolumesToQemuArgs(volumes)
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected %v, got %v", expected, args)
+	}
+}
+
+func TestQemuArgsEscaping(t *testing.T) {
+	// a comma in a path must not start a new option of -fsdev
+	volumes := []types.Volume{
+		{Name: *types.MustACName("data"), Kind: "host", Source: "/srv/a,readonly"},
+	}
+	expected := []string{
+		"-fsdev", "local,id=vol0,path=/srv/a,,readonly,security_model=none",
+		"-device", "virtio-9p-pci,fsdev=vol0,mount_tag=data",
+	}
+	if args := VolumesToQemuArgs(volumes); !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected %v, got %v", expected, args)
+	}
+
+	args, _ := GetQemuRootfsArgs("/var/lib/rkt,x/pods/run/stage1/rootfs")
+	if expected := "local,id=root,path=/var/lib/rkt,,x/pods/run/stage1/rootfs,security_model=none"; args[1] != expected {
+		t.Errorf("expected %q, got %q", expected, args[1])
+	}
+}
@@ -107,13 +107,15 @@ func writeUnit(opts []*unit.UnitOption, unitPath string) error {
 }
 
 // PodToSystemdHostMountUnits create host shared remote file system
-// mounts (using e.g. 9p) according to https://www.kernel.org/doc/Documentation/filesystems/9p.txt.
+// mounts (using 9p or virtiofs, see volumeOpts) according to https://www.kernel.org/doc/Documentation/filesystems/9p.txt.
 // Additionally it creates required directories in stage1MntDir and then prepares
 // bind mount unit for each app.
 // "root" parameter is stage1 root filesystem path.
 // appNames are used to create before/required dependency between mount unit and
 // app service units.
-func PodToSystemdHostMountUnits(root string, volumes []types.Volume, appNames []types.ACName, unitsDir string) error {
+func PodToSystemdHostMountUnits(root string, volumes []types.Volume, volumeOpts VolumeOptions, appNames []types.ACName, unitsDir string) error {
+	fsType, fsOptions := volumeOpts.mountTypeOptions()
+
 	// pod volumes need to mount p9 qemu mount_tags
 	for _, vol := range volumes {
 		// only host shared volumes
@@ -136,11 +138,11 @@ func PodToSystemdHostMountUnits(root string, volumes []types.Volume, appNames []
 			}
 
 			_, err = installNewMountUnit(root,
-				name, // what (source) in 9p it is a channel tag which equals to volume.Name/mountPoint.name
+				name,                              // what (source) in 9p it is a channel tag which equals to volume.Name/mountPoint.name
 				filepath.Join(stage1MntDir, name), // where - destination
-				"9p",                            // fsType
-				"trans=virtio",                  // 9p specific options
-				strings.Join(serviceNames, " "), // space separated list of services for unit dependency
+				fsType,                            // 9p or virtiofs
+				fsOptions,                         // file system specific options
+				strings.Join(serviceNames, " "),   // space separated list of services for unit dependency
 				unitsDir,
 			)
 			if err != nil {
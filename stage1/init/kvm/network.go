@@ -22,9 +22,13 @@ import (
 )
 
 // GetNetworkDescriptions explicitly convert slice of activeNets to slice of netDescribers
-// which is slice required by GetKVMNetArgs
+// which is slice required by GetKVMNetArgs. A pod without network, reached
+// over vsock, has a nil Networking and no network descriptions.
 func GetNetworkDescriptions(n *networking.Networking) []netDescriber {
 	var nds []netDescriber
+	if n == nil {
+		return nds
+	}
 	for _, an := range n.GetActiveNetworks() {
 		nds = append(nds, an)
 	}
@@ -50,14 +54,7 @@ func GetKVMNetArgs(nds []netDescriber) ([]string, []string, error) {
 	var kernelParams []string
 
 	for i, nd := range nds {
-		// https://www.kernel.org/doc/Documentation/filesystems/nfs/nfsroot.txt
-		// ip=<client-ip>:<server-ip>:<gw-ip>:<netmask>:<hostname>:<device>:<autoconf>:<dns0-ip>:<dns1-ip>
-		var gw string
-		if nd.IPMasq() {
-			gw = nd.HostIP().String()
-		}
-		kernelParam := fmt.Sprintf("ip=%s::%s:%s::%s:::", nd.GuestIP(), gw, nd.Mask(), fmt.Sprintf(networking.IfNamePattern, i))
-		kernelParams = append(kernelParams, kernelParam)
+		kernelParams = append(kernelParams, kernelNetParam(i, nd))
 
 		lkvmArgs = append(lkvmArgs, "--network")
 		lkvmArg := fmt.Sprintf("mode=tap,tapif=%s,host_ip=%s,guest_ip=%s", nd.IfName(), nd.HostIP(), nd.GuestIP())
@@ -66,3 +63,35 @@ func GetKVMNetArgs(nds []netDescriber) ([]string, []string, error) {
 
 	return lkvmArgs, kernelParams, nil
 }
+
+// GetQemuNetArgs returns additional arguments that need to be passed to kernel
+// and qemu to configure networks properly. The guest is connected to the tap
+// interfaces created by rkt with virtio-net devices.
+func GetQemuNetArgs(nds []netDescriber) ([]string, []string, error) {
+	var qemuArgs []string
+	var kernelParams []string
+
+	for i, nd := range nds {
+		kernelParams = append(kernelParams, kernelNetParam(i, nd))
+
+		id := fmt.Sprintf("net%d", i)
+		qemuArgs = append(qemuArgs,
+			"-netdev", fmt.Sprintf("tap,id=%s,ifname=%s,script=no,downscript=no", id, nd.IfName()),
+			"-device", fmt.Sprintf("virtio-net-pci,netdev=%s", id),
+		)
+	}
+
+	return qemuArgs, kernelParams, nil
+}
+
+// kernelNetParam returns the kernel parameter configuring the i-th network
+// interface of the guest.
+func kernelNetParam(i int, nd netDescriber) string {
+	// https://www.kernel.org/doc/Documentation/filesystems/nfs/nfsroot.txt
+	// ip=<client-ip>:<server-ip>:<gw-ip>:<netmask>:<hostname>:<device>:<autoconf>:<dns0-ip>:<dns1-ip>
+	var gw string
+	if nd.IPMasq() {
+		gw = nd.HostIP().String()
+	}
+	return fmt.Sprintf("ip=%s::%s:%s::%s:::", nd.GuestIP(), gw, nd.Mask(), fmt.Sprintf(networking.IfNamePattern, i))
+}
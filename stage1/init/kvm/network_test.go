@@ -16,6 +16,7 @@ package kvm
 
 import (
 	"net"
+	"reflect"
 	"testing"
 )
 
@@ -114,3 +115,43 @@ func TestGetKVMNetArgs(t *testing.T) {
 		}
 	}
 }
+
+func TestGetQemuNetArgs(t *testing.T) {
+	nds := []netDescriber{
+		testNetDescriber{
+			net.ParseIP("1.1.1.1"),
+			net.ParseIP("2.2.2.2"),
+			net.ParseIP("255.255.255.0"),
+			"fooInt",
+			false,
+		},
+		testNetDescriber{
+			net.ParseIP("1.1.1.1"),
+			net.ParseIP("3.3.3.3"),
+			net.ParseIP("255.255.255.0"),
+			"barInt",
+			true,
+		},
+	}
+	expectedQemu := []string{
+		"-netdev", "tap,id=net0,ifname=fooInt,script=no,downscript=no",
+		"-device", "virtio-net-pci,netdev=net0",
+		"-netdev", "tap,id=net1,ifname=barInt,script=no,downscript=no",
+		"-device", "virtio-net-pci,netdev=net1",
+	}
+	expectedKernel := []string{
+		"ip=2.2.2.2:::255.255.255.0::eth0:::",
+		"ip=3.3.3.3::1.1.1.1:255.255.255.0::eth1:::",
+	}
+
+	gotQemu, gotKernel, err := GetQemuNetArgs(nds)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+	if !reflect.DeepEqual(gotQemu, expectedQemu) {
+		t.Errorf("expected qemu args %v, got %v", expectedQemu, gotQemu)
+	}
+	if !reflect.DeepEqual(gotKernel, expectedKernel) {
+		t.Errorf("expected kernel params %v, got %v", expectedKernel, gotKernel)
+	}
+}
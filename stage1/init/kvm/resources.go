@@ -0,0 +1,94 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvm
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+)
+
+const (
+	// systemMemory is the memory in MiB given to the VM for the kernel and
+	// systemd on top of the memory limits of the apps. It is all the memory
+	// of the VM when no app has a memory limit.
+	systemMemory = 128
+)
+
+// GetVMResources returns the number of vCPUs and the memory in MiB of the VM
+// running the pod. They are derived from the resource isolators of the apps,
+// unless they are overridden with the common.KVMCPUsAnnotation and
+// common.KVMMemoryAnnotation pod annotations.
+func GetVMResources(annotations types.Annotations, apps schema.AppList) (int, int, error) {
+	cpus, mem := getAppsResources(apps, runtime.NumCPU())
+
+	if v, ok := annotations.Get(common.KVMCPUsAnnotation); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return 0, 0, fmt.Errorf("invalid number of vCPUs %q", v)
+		}
+		cpus = n
+	}
+	if v, ok := annotations.Get(common.KVMMemoryAnnotation); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return 0, 0, fmt.Errorf("invalid amount of memory %q", v)
+		}
+		mem = n
+	}
+
+	return cpus, mem, nil
+}
+
+// getAppsResources returns the number of vCPUs and the memory in MiB needed
+// by the apps according to their limits. The number of vCPUs is at least 1
+// and at most hostCPUs.
+func getAppsResources(apps schema.AppList, hostCPUs int) (int, int) {
+	var milliCPUs, memBytes int64
+
+	for _, ra := range apps {
+		if ra.App == nil {
+			continue
+		}
+		for _, i := range ra.App.Isolators {
+			switch v := i.Value().(type) {
+			case *types.ResourceMemory:
+				if l := v.Limit(); l != nil {
+					memBytes += l.Value()
+				}
+			case *types.ResourceCPU:
+				if l := v.Limit(); l != nil {
+					milliCPUs += l.MilliValue()
+				}
+			}
+		}
+	}
+
+	// round up to whole vCPUs and MiB
+	cpus := int((milliCPUs + 999) / 1000)
+	if cpus < 1 {
+		cpus = 1
+	}
+	if cpus > hostCPUs {
+		cpus = hostCPUs
+	}
+	mem := systemMemory + int((memBytes+(1<<20)-1)>>20)
+
+	return cpus, mem
+}
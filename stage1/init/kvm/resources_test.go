@@ -0,0 +1,99 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvm
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+)
+
+func appWithIsolators(t *testing.T, isolators string) schema.RuntimeApp {
+	var app types.App
+	if err := json.Unmarshal([]byte(`{"exec": ["/app"], "user": "0", "group": "0", "isolators": `+isolators+`}`), &app); err != nil {
+		t.Fatalf("cannot unmarshal app: %v", err)
+	}
+	return schema.RuntimeApp{App: &app}
+}
+
+func TestGetAppsResources(t *testing.T) {
+	cpu1 := `{"name": "resource/cpu", "value": {"limit": "500m"}}`
+	cpu2 := `{"name": "resource/cpu", "value": {"limit": "2"}}`
+	mem1 := `{"name": "resource/memory", "value": {"limit": "256M"}}`
+	mem2 := `{"name": "resource/memory", "value": {"limit": "1G"}}`
+
+	tests := []struct {
+		apps        schema.AppList
+		hostCPUs    int
+		expectedCPU int
+		expectedMem int
+	}{
+		// no isolators
+		{
+			schema.AppList{appWithIsolators(t, `[]`)},
+			4, 1, 128,
+		},
+		// fraction of a CPU is rounded up
+		{
+			schema.AppList{appWithIsolators(t, `[`+cpu1+`, `+mem1+`]`)},
+			4, 1, 128 + 245,
+		},
+		// limits of the apps are added up
+		{
+			schema.AppList{
+				appWithIsolators(t, `[`+cpu1+`, `+mem1+`]`),
+				appWithIsolators(t, `[`+cpu2+`, `+mem2+`]`),
+			},
+			4, 3, 128 + 1198,
+		},
+		// no more vCPUs than host CPUs
+		{
+			schema.AppList{appWithIsolators(t, `[`+cpu2+`]`), appWithIsolators(t, `[`+cpu2+`]`)},
+			2, 2, 128,
+		},
+	}
+
+	for i, tt := range tests {
+		cpus, mem := getAppsResources(tt.apps, tt.hostCPUs)
+		if cpus != tt.expectedCPU {
+			t.Errorf("#%d: expected %d vCPUs, got %d", i, tt.expectedCPU, cpus)
+		}
+		if mem != tt.expectedMem {
+			t.Errorf("#%d: expected %d MiB, got %d", i, tt.expectedMem, mem)
+		}
+	}
+}
+
+func TestGetVMResourcesOverride(t *testing.T) {
+	var annotations types.Annotations
+	annotations.Set(types.ACIdentifier(common.KVMCPUsAnnotation), "3")
+	annotations.Set(types.ACIdentifier(common.KVMMemoryAnnotation), "1024")
+
+	cpus, mem, err := GetVMResources(annotations, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cpus != 3 || mem != 1024 {
+		t.Errorf("expected 3 vCPUs and 1024 MiB, got %d vCPUs and %d MiB", cpus, mem)
+	}
+
+	annotations.Set(types.ACIdentifier(common.KVMMemoryAnnotation), "lots")
+	if _, _, err := GetVMResources(annotations, nil); err == nil {
+		t.Errorf("expected an error with an invalid memory annotation")
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvm
+
+import "path/filepath"
+
+// pciDevicesDir is the sysfs directory of the PCI devices of the host
+const pciDevicesDir = "/sys/bus/pci/devices"
+
+// GetQemuVfioArgs returns the qemu arguments passing the PCI devices, bound
+// to the vfio-pci driver, through to the guest.
+func GetQemuVfioArgs(addrs []string) []string {
+	var args []string
+	for _, addr := range addrs {
+		args = append(args, "-device", "vfio-pci,host="+addr)
+	}
+	return args
+}
+
+// GetCloudHypervisorVfioArgs returns the cloud-hypervisor arguments passing
+// the PCI devices, bound to the vfio-pci driver, through to the guest.
+func GetCloudHypervisorVfioArgs(addrs []string) []string {
+	if len(addrs) == 0 {
+		return nil
+	}
+	args := []string{"--device"}
+	for _, addr := range addrs {
+		args = append(args, "path="+filepath.Join(pciDevicesDir, addr)+"/")
+	}
+	return args
+}
+
+// GetKVMVfioArgs returns the lkvm arguments passing the PCI devices, bound
+// to the vfio-pci driver, through to the guest.
+func GetKVMVfioArgs(addrs []string) []string {
+	var args []string
+	for _, addr := range addrs {
+		args = append(args, "--vfio-pci", addr)
+	}
+	return args
+}
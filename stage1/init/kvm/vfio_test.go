@@ -0,0 +1,50 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVfioArgs(t *testing.T) {
+	addrs := []string{"0000:01:00.0", "0000:02:00.0"}
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{
+			GetQemuVfioArgs(addrs),
+			[]string{"-device", "vfio-pci,host=0000:01:00.0", "-device", "vfio-pci,host=0000:02:00.0"},
+		},
+		{
+			GetCloudHypervisorVfioArgs(addrs),
+			[]string{"--device", "path=/sys/bus/pci/devices/0000:01:00.0/", "path=/sys/bus/pci/devices/0000:02:00.0/"},
+		},
+		{
+			GetKVMVfioArgs(addrs),
+			[]string{"--vfio-pci", "0000:01:00.0", "--vfio-pci", "0000:02:00.0"},
+		},
+		{
+			GetCloudHypervisorVfioArgs(nil),
+			nil,
+		},
+	}
+	for i, tt := range tests {
+		if !reflect.DeepEqual(tt.args, tt.want) {
+			t.Errorf("#%d: got %v, want %v", i, tt.args, tt.want)
+		}
+	}
+}
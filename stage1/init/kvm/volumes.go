@@ -0,0 +1,218 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvm
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+)
+
+const (
+	// VolumeFS9p shares the host volumes with virtio-9p, supported by lkvm
+	// and qemu
+	VolumeFS9p = "9p"
+	// VolumeFSVirtiofs shares the host volumes with virtio-fs, supported
+	// by qemu and cloud-hypervisor. It needs virtiofsd on the host and a
+	// guest kernel with virtiofs support (>= 5.4).
+	VolumeFSVirtiofs = "virtiofs"
+	// volumeFSAuto uses virtio-fs when both the guest kernel and the host
+	// support it, 9p otherwise
+	volumeFSAuto = "auto"
+
+	// VirtiofsdBin is the virtio-fs daemon, looked up in the PATH of the host
+	VirtiofsdBin = "virtiofsd"
+)
+
+var (
+	// valid caching modes, see the cache option in
+	// https://www.kernel.org/doc/Documentation/filesystems/9p.txt
+	// and the --cache option of virtiofsd
+	volumeCacheModes = map[string][]string{
+		VolumeFS9p:       {"none", "loose", "fscache", "mmap"},
+		VolumeFSVirtiofs: {"none", "auto", "always"},
+	}
+)
+
+// VolumeOptions describes how the host volumes are shared with the guest.
+type VolumeOptions struct {
+	FSType string // VolumeFS9p or VolumeFSVirtiofs
+	Cache  string // caching mode, empty for the default of the file system
+}
+
+// GetVolumeOptions returns how the host volumes are shared with the guest,
+// according to the common.KVMVolumeFSAnnotation and
+// common.KVMVolumeCacheAnnotation pod annotations. 9p is used by default.
+// features are the features of the guest kernel of the stage1 image, and
+// virtiofsAvailable tells whether virtiofsd is installed on the host.
+func GetVolumeOptions(annotations types.Annotations, hypervisor string, features GuestFeatures, virtiofsAvailable bool) (VolumeOptions, error) {
+	opts := VolumeOptions{FSType: VolumeFS9p}
+
+	fsType, _ := annotations.Get(common.KVMVolumeFSAnnotation)
+	if hypervisor == HypervisorCloudHypervisor {
+		// cloud-hypervisor has no virtio-9p
+		switch fsType {
+		case "", volumeFSAuto:
+			fsType = VolumeFSVirtiofs
+		case VolumeFS9p:
+			return opts, fmt.Errorf("9p volumes are not supported with the %q hypervisor", HypervisorCloudHypervisor)
+		}
+	}
+
+	switch fsType {
+	case "", VolumeFS9p:
+	case volumeFSAuto:
+		if hypervisor == HypervisorQemu && features[GuestFeatureVirtiofs] && virtiofsAvailable {
+			opts.FSType = VolumeFSVirtiofs
+		}
+	case VolumeFSVirtiofs:
+		if hypervisor != HypervisorQemu && hypervisor != HypervisorCloudHypervisor {
+			return opts, fmt.Errorf("virtiofs volumes are only supported with the %q and %q hypervisors", HypervisorQemu, HypervisorCloudHypervisor)
+		}
+		if !features[GuestFeatureVirtiofs] {
+			return opts, fmt.Errorf("virtiofs volumes need a stage1 image with a guest kernel supporting virtio-fs (Linux >= 5.4)")
+		}
+		if !virtiofsAvailable {
+			return opts, fmt.Errorf("virtiofs volumes need %s on the host", VirtiofsdBin)
+		}
+		opts.FSType = VolumeFSVirtiofs
+	default:
+		return opts, fmt.Errorf("unsupported volume file system %q, must be %q, %q or %q", fsType, VolumeFS9p, VolumeFSVirtiofs, volumeFSAuto)
+	}
+
+	if cache, ok := annotations.Get(common.KVMVolumeCacheAnnotation); ok {
+		valid := false
+		for _, mode := range volumeCacheModes[opts.FSType] {
+			if cache == mode {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return opts, fmt.Errorf("unsupported cache mode %q for %s volumes, must be one of %v", cache, opts.FSType, volumeCacheModes[opts.FSType])
+		}
+		opts.Cache = cache
+	}
+
+	return opts, nil
+}
+
+// mountTypeOptions returns the file system type and the options of the
+// guest mount units of the host volumes.
+func (o VolumeOptions) mountTypeOptions() (string, string) {
+	if o.FSType == VolumeFSVirtiofs {
+		// the caching mode is set on the host by virtiofsd
+		return "virtiofs", "defaults"
+	}
+
+	options := "trans=virtio"
+	if o.Cache != "" {
+		options += ",cache=" + o.Cache
+	}
+	return "9p", options
+}
+
+// virtiofsSocketPath returns the path of the vhost-user socket of virtiofsd
+// for a volume.
+func virtiofsSocketPath(socketDir string, vol types.Volume) string {
+	return filepath.Join(socketDir, vol.Name.String()+".sock")
+}
+
+// VirtiofsdCommands returns the virtiofsd commands serving the host volumes
+// to qemu, listening on sockets in socketDir.
+func VirtiofsdCommands(virtiofsdPath, socketDir string, volumes []types.Volume, opts VolumeOptions) []*exec.Cmd {
+	var cmds []*exec.Cmd
+
+	for _, vol := range volumes {
+		if vol.Kind != "host" {
+			continue
+		}
+		args := []string{
+			"--socket-path=" + virtiofsSocketPath(socketDir, vol),
+			"--shared-dir=" + vol.Source,
+		}
+		if opts.Cache != "" {
+			args = append(args, "--cache="+opts.Cache)
+		}
+		if vol.ReadOnly != nil && *vol.ReadOnly {
+			args = append(args, "--readonly")
+		}
+		cmds = append(cmds, exec.Command(virtiofsdPath, args...))
+	}
+
+	return cmds
+}
+
+// VolumesToQemuVirtiofsArgs prepares argument list to be passed to qemu to
+// connect the guest to the virtiofsd sockets in socketDir. The mount tags are
+// the volume names, like with 9p. vhost-user needs the memory of the guest
+// (in MiB) to be shared with virtiofsd.
+func VolumesToQemuVirtiofsArgs(socketDir string, volumes []types.Volume, mem int) []string {
+	var args []string
+
+	for i, vol := range volumes {
+		if vol.Kind != "host" {
+			continue
+		}
+		id := fmt.Sprintf("vol%d", i)
+		args = append(args,
+			"-chardev", fmt.Sprintf("socket,id=%s,path=%s", id, virtiofsSocketPath(socketDir, vol)),
+			"-device", fmt.Sprintf("vhost-user-fs-pci,chardev=%s,tag=%s", id, vol.Name),
+		)
+	}
+
+	if len(args) > 0 {
+		args = append(args,
+			"-object", fmt.Sprintf("memory-backend-memfd,id=mem,size=%dM,share=on", mem),
+			"-numa", "node,memdev=mem",
+		)
+	}
+
+	return args
+}
+
+// WaitVirtiofsdSockets waits until the virtiofsd daemons started with the
+// VirtiofsdCommands have created their sockets, so qemu can connect to them.
+func WaitVirtiofsdSockets(socketDir string, volumes []types.Volume, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	for _, vol := range volumes {
+		if vol.Kind != "host" {
+			continue
+		}
+		if err := waitSocket(virtiofsSocketPath(socketDir, vol), deadline); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func waitSocket(path string, deadline time.Time) error {
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for virtiofsd socket %q", path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvm
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+)
+
+func TestGetVolumeOptions(t *testing.T) {
+	tests := []struct {
+		fsType     string
+		cache      string
+		hypervisor string
+		guest      bool // the guest kernel supports virtio-fs
+		available  bool // virtiofsd is installed on the host
+
+		expected VolumeOptions
+		err      bool
+	}{
+		{"", "", HypervisorLkvm, true, false, VolumeOptions{FSType: VolumeFS9p}, false},
+		{"9p", "loose", HypervisorLkvm, true, false, VolumeOptions{FSType: VolumeFS9p, Cache: "loose"}, false},
+		{"9p", "always", HypervisorLkvm, true, false, VolumeOptions{}, true},
+		{"auto", "", HypervisorLkvm, true, true, VolumeOptions{FSType: VolumeFS9p}, false},
+		{"auto", "", HypervisorQemu, true, false, VolumeOptions{FSType: VolumeFS9p}, false},
+		{"auto", "always", HypervisorQemu, true, true, VolumeOptions{FSType: VolumeFSVirtiofs, Cache: "always"}, false},
+		{"virtiofs", "", HypervisorQemu, true, true, VolumeOptions{FSType: VolumeFSVirtiofs}, false},
+		{"virtiofs", "", HypervisorQemu, true, false, VolumeOptions{}, true},
+		{"virtiofs", "", HypervisorLkvm, true, true, VolumeOptions{}, true},
+		{"nfs", "", HypervisorQemu, true, true, VolumeOptions{}, true},
+		{"", "", HypervisorCloudHypervisor, true, true, VolumeOptions{FSType: VolumeFSVirtiofs}, false},
+		{"auto", "auto", HypervisorCloudHypervisor, true, true, VolumeOptions{FSType: VolumeFSVirtiofs, Cache: "auto"}, false},
+		{"", "", HypervisorCloudHypervisor, true, false, VolumeOptions{}, true},
+		{"9p", "", HypervisorCloudHypervisor, true, true, VolumeOptions{}, true},
+		{"auto", "", HypervisorQemu, false, true, VolumeOptions{FSType: VolumeFS9p}, false},
+		{"virtiofs", "", HypervisorQemu, false, true, VolumeOptions{}, true},
+	}
+
+	for i, tt := range tests {
+		var annotations types.Annotations
+		if tt.fsType != "" {
+			annotations.Set(types.ACIdentifier(common.KVMVolumeFSAnnotation), tt.fsType)
+		}
+		if tt.cache != "" {
+			annotations.Set(types.ACIdentifier(common.KVMVolumeCacheAnnotation), tt.cache)
+		}
+
+		features := GuestFeatures{GuestFeatureVirtiofs: tt.guest}
+		opts, err := GetVolumeOptions(annotations, tt.hypervisor, features, tt.available)
+		if (err != nil) != tt.err {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+			continue
+		}
+		if err == nil && opts != tt.expected {
+			t.Errorf("#%d: expected %+v, got %+v", i, tt.expected, opts)
+		}
+	}
+}
+
+func TestVolumesToQemuVirtiofsArgs(t *testing.T) {
+	volumes := []types.Volume{
+		{Name: *types.MustACName("tmp"), Kind: "empty"},
+		{Name: *types.MustACName("data"), Kind: "host", Source: "/srv/data"},
+	}
+	expected := []string{
+		"-chardev", "socket,id=vol1,path=/pod/virtiofs/data.sock",
+		"-device", "vhost-user-fs-pci,chardev=vol1,tag=data",
+		"-object", "memory-backend-memfd,id=mem,size=512M,share=on",
+		"-numa", "node,memdev=mem",
+	}
+
+	args := VolumesToQemuVirtiofsArgs("/pod/virtiofs", volumes, 512)
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected %v, got %v", expected, args)
+	}
+
+	if args := VolumesToQemuVirtiofsArgs("/pod/virtiofs", volumes[:1], 512); args != nil {
+		t.Errorf("expected no arguments without host volumes, got %v", args)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvm
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+)
+
+const (
+	// VhostVsockDevice is the device of the host giving vsock sockets to
+	// the virtual machines. Without it, the host talks to the guest over
+	// the network of the pod.
+	VhostVsockDevice = "/dev/vhost-vsock"
+
+	// VsockCIDFilename is the file, in the pod directory, holding the
+	// vsock context ID of the guest, written if the pod uses vsock
+	VsockCIDFilename = "vsock-cid"
+
+	// VsockEnterPort is the vsock port of the guest forwarded to its ssh
+	// server, used to enter the pod
+	VsockEnterPort = 122
+
+	// VsockProxyBin is the proxy between the vsock sockets and the TCP
+	// sockets, in the stage1 rootfs
+	VsockProxyBin = "/vsock-proxy"
+
+	// minGuestCID is the first context ID of the guests, the lower ones
+	// are reserved for the hypervisor and the host
+	minGuestCID = 3
+)
+
+// UseVsock returns whether the pod asked with the common.KVMVsockAnnotation
+// annotation to talk to its guest over vsock. It is opt-in because the guest
+// kernel must have virtio-vsock, which the kernel of the default stage1 image
+// lacks, and it is only supported with qemu on hosts giving vsock sockets to
+// the virtual machines. features are the features of the guest kernel.
+func UseVsock(annotations types.Annotations, features GuestFeatures) (bool, error) {
+	val, ok := annotations.Get(common.KVMVsockAnnotation)
+	if !ok {
+		return false, nil
+	}
+	use, err := strconv.ParseBool(val)
+	if err != nil {
+		return false, fmt.Errorf("invalid value %q for annotation %s: %v", val, common.KVMVsockAnnotation, err)
+	}
+	if !use {
+		return false, nil
+	}
+	hypervisor, err := GetHypervisor(annotations)
+	if err != nil {
+		return false, err
+	}
+	if hypervisor != HypervisorQemu {
+		return false, fmt.Errorf("vsock is only supported with the %s hypervisor", HypervisorQemu)
+	}
+	if !features[GuestFeatureVsock] {
+		return false, fmt.Errorf("vsock needs a stage1 image with a guest kernel supporting virtio-vsock (Linux >= 4.8)")
+	}
+	if _, err := os.Stat(VhostVsockDevice); err != nil {
+		return false, fmt.Errorf("vsock is not available on the host: %v", err)
+	}
+	return true, nil
+}
+
+// GuestCID returns the vsock context ID of the guest of the pod, derived
+// from its UUID so it is unique on the host in practice.
+func GuestCID(uuid *types.UUID) uint32 {
+	h := fnv.New32a()
+	h.Write(uuid[:])
+	// the context IDs 0xffffffff (any) and 0xfffffffe are reserved
+	return minGuestCID + h.Sum32()%(0xfffffffe-minGuestCID)
+}
+
+// GetQemuVsockArgs returns the qemu arguments giving a vsock device with
+// the context ID cid to the guest.
+func GetQemuVsockArgs(cid uint32) []string {
+	return []string{"-device", fmt.Sprintf("vhost-vsock-pci,guest-cid=%d", cid)}
+}
+
+// WriteGuestCID records the vsock context ID of the guest in the pod
+// directory.
+func WriteGuestCID(podRoot string, cid uint32) error {
+	return ioutil.WriteFile(filepath.Join(podRoot, VsockCIDFilename), []byte(strconv.FormatUint(uint64(cid), 10)), 0644)
+}
+
+// ReadGuestCID returns the vsock context ID of the guest recorded in the
+// pod directory, and false if the pod does not use vsock.
+func ReadGuestCID(podRoot string) (uint32, bool, error) {
+	b, err := ioutil.ReadFile(filepath.Join(podRoot, VsockCIDFilename))
+	if os.IsNotExist(err) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	cid, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 32)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid vsock context ID %q", b)
+	}
+	return uint32(cid), true, nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvm
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+)
+
+func TestGuestCID(t *testing.T) {
+	uuid1 := types.UUID{0x01}
+	uuid2 := types.UUID{0x02}
+
+	cid1 := GuestCID(&uuid1)
+	if cid1 < minGuestCID || cid1 >= 0xfffffffe {
+		t.Errorf("context ID %d out of range", cid1)
+	}
+	if cid := GuestCID(&uuid1); cid != cid1 {
+		t.Errorf("expected the same context ID for the same UUID, got %d and %d", cid1, cid)
+	}
+	if cid2 := GuestCID(&uuid2); cid2 == cid1 {
+		t.Errorf("expected different context IDs for different UUIDs, got %d", cid2)
+	}
+}
+
+func TestVsockArgs(t *testing.T) {
+	if args, expected := GetQemuVsockArgs(1234), []string{"-device", "vhost-vsock-pci,guest-cid=1234"}; !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected %v, got %v", expected, args)
+	}
+}
+
+func TestUseVsock(t *testing.T) {
+	tests := []struct {
+		annotations map[string]string
+		features    GuestFeatures
+		use         bool
+		err         bool
+	}{
+		{nil, nil, false, false},
+		{map[string]string{common.KVMVsockAnnotation: "false"}, nil, false, false},
+		{map[string]string{common.KVMVsockAnnotation: "yes please"}, nil, false, true},
+		{map[string]string{common.KVMVsockAnnotation: "true"}, nil, false, true},
+		{map[string]string{common.KVMVsockAnnotation: "true", common.KVMHypervisorAnnotation: HypervisorCloudHypervisor}, GuestFeatures{GuestFeatureVsock: true}, false, true},
+		// the guest kernel lacks virtio-vsock
+		{map[string]string{common.KVMVsockAnnotation: "true", common.KVMHypervisorAnnotation: HypervisorQemu}, GuestFeatures{}, false, true},
+	}
+
+	for i, tt := range tests {
+		var annotations types.Annotations
+		for name, val := range tt.annotations {
+			annotations.Set(types.ACIdentifier(name), val)
+		}
+		use, err := UseVsock(annotations, tt.features)
+		if use != tt.use || (err != nil) != tt.err {
+			t.Errorf("#%d: got %t, err==%v, want %t, errstate %t", i, use, err, tt.use, tt.err)
+		}
+	}
+}
+
+func TestGuestCIDFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vsock-test")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, ok, err := ReadGuestCID(dir); ok || err != nil {
+		t.Errorf("expected no context ID, got %t, %v", ok, err)
+	}
+	if err := WriteGuestCID(dir, 1234); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cid, ok, err := ReadGuestCID(dir)
+	if err != nil || !ok || cid != 1234 {
+		t.Errorf("expected context ID 1234, got %d, %t, %v", cid, ok, err)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/pkg/fileutil"
+)
+
+const (
+	// Directory of the tz database in host
+	zoneinfoDir = "/usr/share/zoneinfo"
+	// Path to the file with the name of the timezone in host and apps
+	timezonePath = "/etc/timezone"
+	// Path to the locale configuration in the apps
+	localeConfPath = "/etc/locale.conf"
+	// Directory of the generated localization files, relative to the pod
+	// root
+	localizationDir = "localization"
+)
+
+// localizationFile is a file generated by stage1 in the pod directory and
+// bound read-only in the apps.
+type localizationFile struct {
+	hostPath string
+	appPath  string
+}
+
+// localizationRequested returns whether the pod annotations set the
+// timezone or the locale of the apps.
+func (p *Pod) localizationRequested() bool {
+	_, hasTimezone := p.Manifest.Annotations.Get(common.TimezoneAnnotation)
+	_, hasLocale := p.Manifest.Annotations.Get(common.LocaleAnnotation)
+	return hasTimezone || hasLocale
+}
+
+// resolveTimezone returns the name of the timezone tz, empty if unknown,
+// and the path of its zone file, looking them up in the host rooted at
+// hostRoot. The "host" timezone is the one of the host's /etc/localtime.
+func resolveTimezone(hostRoot, tz string) (string, string, error) {
+	if err := common.ValidateTimezone(tz); err != nil {
+		return "", "", err
+	}
+
+	if tz != common.LocalizationHost {
+		zoneFile := filepath.Join(hostRoot, zoneinfoDir, tz)
+		if fi, err := os.Stat(zoneFile); err != nil || !fi.Mode().IsRegular() {
+			return "", "", fmt.Errorf("unknown timezone %q", tz)
+		}
+		return tz, zoneFile, nil
+	}
+
+	zoneFile := filepath.Join(hostRoot, localtimePath)
+	if _, err := os.Stat(zoneFile); err != nil {
+		return "", "", fmt.Errorf("cannot find the timezone of the host: %v", err)
+	}
+	// /etc/localtime usually links to the zone file in the tz database,
+	// otherwise the name may be in /etc/timezone
+	if target, err := os.Readlink(zoneFile); err == nil {
+		if i := strings.LastIndex(target, "zoneinfo/"); i != -1 {
+			name := target[i+len("zoneinfo/"):]
+			if common.ValidateTimezone(name) == nil {
+				return name, zoneFile, nil
+			}
+		}
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(hostRoot, timezonePath)); err == nil {
+		name := strings.TrimSpace(string(b))
+		if name != common.LocalizationHost && common.ValidateTimezone(name) == nil {
+			return name, zoneFile, nil
+		}
+	}
+	return "", zoneFile, nil
+}
+
+// writeLocalizationFiles generates the localization files requested in the
+// pod annotations, looking up the timezones in the host rooted at hostRoot,
+// and returns them.
+func (p *Pod) writeLocalizationFiles(hostRoot string) ([]localizationFile, error) {
+	tz, hasTimezone := p.Manifest.Annotations.Get(common.TimezoneAnnotation)
+	locale, hasLocale := p.Manifest.Annotations.Get(common.LocaleAnnotation)
+	if !hasTimezone && !hasLocale {
+		return nil, nil
+	}
+
+	// the files are bound in the apps by absolute paths, and p.Root is
+	// usually "."
+	absRoot, err := filepath.Abs(p.Root)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get pod's root absolute path: %v", err)
+	}
+	dir := filepath.Join(absRoot, localizationDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("cannot create localization directory: %v", err)
+	}
+	var files []localizationFile
+
+	if hasTimezone {
+		name, zoneFile, err := resolveTimezone(hostRoot, tz)
+		if err != nil {
+			return nil, err
+		}
+		localtime := filepath.Join(dir, "localtime")
+		if err := fileutil.CopyRegularFile(zoneFile, localtime); err != nil {
+			return nil, fmt.Errorf("cannot copy zone file %q: %v", zoneFile, err)
+		}
+		files = append(files, localizationFile{localtime, localtimePath})
+		if name != "" {
+			timezone := filepath.Join(dir, "timezone")
+			if err := ioutil.WriteFile(timezone, []byte(name+"\n"), 0644); err != nil {
+				return nil, fmt.Errorf("cannot write timezone file: %v", err)
+			}
+			files = append(files, localizationFile{timezone, timezonePath})
+		}
+	}
+
+	if hasLocale {
+		if err := common.ValidateLocale(locale); err != nil {
+			return nil, err
+		}
+		localeConf := filepath.Join(dir, "locale.conf")
+		if err := ioutil.WriteFile(localeConf, []byte("LANG="+locale+"\n"), 0644); err != nil {
+			return nil, fmt.Errorf("cannot write locale configuration: %v", err)
+		}
+		files = append(files, localizationFile{localeConf, localeConfPath})
+	}
+
+	return files, nil
+}
@@ -0,0 +1,152 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+	stage1lib "github.com/coreos/rkt/pkg/stage1"
+)
+
+// writeHostFile writes a file of the test host, creating its directory.
+func writeHostFile(t *testing.T, path, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("error creating %q: %v", filepath.Dir(path), err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("error writing %q: %v", path, err)
+	}
+}
+
+func TestResolveTimezone(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rkt-localization-test-")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	linked := filepath.Join(dir, "linked")
+	copied := filepath.Join(dir, "copied")
+	for _, host := range []string{linked, copied} {
+		writeHostFile(t, filepath.Join(host, zoneinfoDir, "Europe/Berlin"), "CET")
+		writeHostFile(t, filepath.Join(host, zoneinfoDir, "UTC"), "UTC")
+	}
+	if err := os.MkdirAll(filepath.Join(linked, "etc"), 0755); err != nil {
+		t.Fatalf("error creating etc: %v", err)
+	}
+	if err := os.Symlink("../usr/share/zoneinfo/Europe/Berlin", filepath.Join(linked, localtimePath)); err != nil {
+		t.Fatalf("error creating symlink: %v", err)
+	}
+	writeHostFile(t, filepath.Join(copied, localtimePath), "UTC")
+	writeHostFile(t, filepath.Join(copied, timezonePath), "Etc/UTC\n")
+
+	tests := []struct {
+		host     string
+		tz       string
+		name     string
+		zoneFile string
+		err      bool
+	}{
+		{linked, "host", "Europe/Berlin", filepath.Join(linked, localtimePath), false},
+		{copied, "host", "Etc/UTC", filepath.Join(copied, localtimePath), false},
+		{linked, "UTC", "UTC", filepath.Join(linked, zoneinfoDir, "UTC"), false},
+		{linked, "Mars/Olympus_Mons", "", "", true},
+		{linked, "Europe", "", "", true},
+		{linked, "../../etc/shadow", "", "", true},
+		{dir, "host", "", "", true},
+	}
+
+	for i, tt := range tests {
+		name, zoneFile, err := resolveTimezone(tt.host, tt.tz)
+		if gotErr := err != nil; gotErr != tt.err {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.err)
+			continue
+		}
+		if name != tt.name || zoneFile != tt.zoneFile {
+			t.Errorf("#%d: got %q, %q, want %q, %q", i, name, zoneFile, tt.name, tt.zoneFile)
+		}
+	}
+}
+
+func TestWriteLocalizationFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rkt-localization-test-")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	host := filepath.Join(dir, "host")
+	writeHostFile(t, filepath.Join(host, zoneinfoDir, "Asia/Tokyo"), "JST")
+
+	tests := []struct {
+		annotations types.Annotations
+		files       map[string]string
+		err         bool
+	}{
+		{nil, map[string]string{}, false},
+		{
+			types.Annotations{
+				{Name: common.TimezoneAnnotation, Value: "Asia/Tokyo"},
+				{Name: common.LocaleAnnotation, Value: "ja_JP.UTF-8"},
+			},
+			map[string]string{
+				localtimePath:  "JST",
+				timezonePath:   "Asia/Tokyo\n",
+				localeConfPath: "LANG=ja_JP.UTF-8\n",
+			},
+			false,
+		},
+		{types.Annotations{{Name: common.TimezoneAnnotation, Value: "Asia/Osaka"}}, nil, true},
+		{types.Annotations{{Name: common.LocaleAnnotation, Value: "C\nLC_ALL=C"}}, nil, true},
+	}
+
+	for i, tt := range tests {
+		root := filepath.Join(dir, "pod", strconv.Itoa(i))
+		p := &Pod{Pod: &stage1lib.Pod{
+			Root:     root,
+			Manifest: &schema.PodManifest{Annotations: tt.annotations},
+		}}
+		files, err := p.writeLocalizationFiles(host)
+		if gotErr := err != nil; gotErr != tt.err {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.err)
+			continue
+		}
+		if tt.err {
+			continue
+		}
+
+		got := make(map[string]string)
+		for _, f := range files {
+			b, err := ioutil.ReadFile(f.hostPath)
+			if err != nil {
+				t.Fatalf("#%d: error reading %q: %v", i, f.hostPath, err)
+			}
+			got[f.appPath] = string(b)
+		}
+		if !reflect.DeepEqual(got, tt.files) {
+			t.Errorf("#%d: got files %v, want %v", i, got, tt.files)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/coreos/go-systemd/unit"
+	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/pkg/uid"
+	initcommon "github.com/coreos/rkt/stage1/init/common"
+)
+
+const (
+	// logShimBin sends the output of an app to the log driver of the pod
+	// with fields identifying the pod, the app and its image
+	logShimBin = "/log-shim"
+	// logWriterBin duplicates the output of an app into log files
+	logWriterBin = "/log-writer"
+	// logsDir is where the log files of the apps are written, in a
+	// directory named after each app
+	logsDir = "/rkt/logs"
+	// logFIFOsDir is where the FIFOs carrying the output of the apps to
+	// their log units are created, in a directory named after each app
+	logFIFOsDir = "/rkt/log-fifos"
+)
+
+// getLogShimWrap returns the command sending the output of an app to the
+// log driver of the pod, journald by default, with the RKT_POD_UUID,
+// RKT_APP_NAME, RKT_IMAGE_NAME and RKT_IMAGE_DIGEST fields.
+func (p *Pod) getLogShimWrap(ra *schema.RuntimeApp, imgName types.ACIdentifier) ([]string, error) {
+	wrap := []string{logShimBin}
+	if driver, ok := p.Manifest.Annotations.Get(common.LogDriverAnnotation); ok {
+		address, _ := p.Manifest.Annotations.Get(common.LogDriverAddressAnnotation)
+		if _, _, err := common.ParseLogDriverAddress(driver, address); err != nil {
+			return nil, err
+		}
+		wrap = append(wrap, "--driver="+driver)
+		if address != "" {
+			wrap = append(wrap, "--address="+address)
+		}
+	}
+	return append(wrap,
+		"--identifier="+filepath.Base(ra.App.Exec[0]),
+		"--field=RKT_POD_UUID="+p.UUID.String(),
+		"--field=RKT_APP_NAME="+ra.Name.String(),
+		"--field=RKT_IMAGE_NAME="+imgName.String(),
+		"--field=RKT_IMAGE_DIGEST="+ra.Image.ID.String(),
+	), nil
+}
+
+// getLogWriterWrap returns the command duplicating the output of an app,
+// read as given by the input flags, into log files, if requested in the pod
+// annotations.
+func (p *Pod) getLogWriterWrap(appName types.ACName, input []string) ([]string, error) {
+	size, ok := p.Manifest.Annotations.Get(common.LogFilesMaxSizeAnnotation)
+	if !ok {
+		return nil, nil
+	}
+	if err := common.ValidateMemorySize(size); err != nil {
+		return nil, fmt.Errorf("invalid log files max size: %v", err)
+	}
+	wrap := []string{logWriterBin, "--max-size=" + size}
+
+	if files, ok := p.Manifest.Annotations.Get(common.LogFilesMaxFilesAnnotation); ok {
+		if n, err := strconv.Atoi(files); err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid log files max files %q", files)
+		}
+		wrap = append(wrap, "--max-files="+files)
+	}
+
+	wrap = append(wrap, input...)
+	return append(wrap, filepath.Join(logsDir, appName.String())), nil
+}
+
+// logFIFOPaths returns the paths of the FIFOs carrying the stdout and the
+// stderr of an app to its log unit, in the rootfs of stage1.
+func logFIFOPaths(appName types.ACName) (string, string) {
+	dir := filepath.Join(logFIFOsDir, appName.String())
+	return filepath.Join(dir, "stdout"), filepath.Join(dir, "stderr")
+}
+
+// getLogCommand returns the command of the log unit of an app, reading its
+// output from the FIFOs of logFIFOPaths: the log shim, reading the output
+// of the log writer when the log files are enabled.
+func (p *Pod) getLogCommand(ra *schema.RuntimeApp, imgName types.ACIdentifier) ([]string, error) {
+	stdoutFIFO, stderrFIFO := logFIFOPaths(ra.Name)
+	input := []string{"--stdout=" + stdoutFIFO, "--stderr=" + stderrFIFO}
+
+	cmd, err := p.getLogShimWrap(ra, imgName)
+	if err != nil {
+		return nil, err
+	}
+	writer, err := p.getLogWriterWrap(ra.Name, input)
+	if err != nil {
+		return nil, err
+	}
+	if writer == nil {
+		return append(cmd, input...), nil
+	}
+	// the log writer sends its own errors, and the output of the app,
+	// to the log shim
+	return append(cmd, writer...), nil
+}
+
+// writeLogUnit creates the FIFOs carrying the output of an app and writes
+// the service reading them, so the log shim and the log writer don't run in
+// the sandbox of the app. It returns the arguments of /appexec redirecting
+// the output of the app to the FIFOs.
+func (p *Pod) writeLogUnit(ra *schema.RuntimeApp, imgName types.ACIdentifier, privateUsers string) ([]string, error) {
+	cmd, err := p.getLogCommand(ra, imgName)
+	if err != nil {
+		return nil, err
+	}
+
+	uidRange := uid.NewBlankUidRange()
+	if err := uidRange.Deserialize([]byte(privateUsers)); err != nil {
+		return nil, err
+	}
+	stage1Root := common.Stage1RootfsPath(p.Root)
+	stdoutFIFO, stderrFIFO := logFIFOPaths(ra.Name)
+	if err := os.MkdirAll(filepath.Join(stage1Root, filepath.Dir(stdoutFIFO)), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create the log FIFOs directory: %v", err)
+	}
+	for _, fifo := range []string{stdoutFIFO, stderrFIFO} {
+		path := filepath.Join(stage1Root, fifo)
+		if err := syscall.Mkfifo(path, 0600); err != nil && !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to create log FIFO %q: %v", fifo, err)
+		}
+		if uidRange.Shift != 0 && uidRange.Count != 0 {
+			if err := os.Chown(path, int(uidRange.Shift), int(uidRange.Shift)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	opts := []*unit.UnitOption{
+		unit.NewUnitOption("Unit", "Description", fmt.Sprintf("%s Log", ra.Name)),
+		unit.NewUnitOption("Unit", "DefaultDependencies", "false"),
+		unit.NewUnitOption("Service", "ExecStart", quoteExec(cmd)),
+		// the log shim copies the output to the console
+		unit.NewUnitOption("Service", "StandardOutput", "console"),
+		unit.NewUnitOption("Service", "StandardError", "console"),
+	}
+	unitsPath := filepath.Join(stage1Root, unitsDir)
+	file, err := os.OpenFile(filepath.Join(unitsPath, initcommon.LogUnitName(ra.Name)), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create service unit file: %v", err)
+	}
+	defer file.Close()
+
+	if _, err = io.Copy(file, unit.Serialize(opts)); err != nil {
+		return nil, fmt.Errorf("failed to write service unit file: %v", err)
+	}
+
+	return []string{"--stdout=" + stdoutFIFO, "--stderr=" + stderrFIFO}, nil
+}
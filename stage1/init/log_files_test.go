@@ -0,0 +1,212 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+	stage1lib "github.com/coreos/rkt/pkg/stage1"
+)
+
+func TestGetLogWriterWrap(t *testing.T) {
+	tests := []struct {
+		annotations types.Annotations
+		wrap        []string
+		err         bool
+	}{
+		{nil, nil, false},
+		{
+			types.Annotations{{Name: common.LogFilesMaxSizeAnnotation, Value: "10m"}},
+			[]string{"/log-writer", "--max-size=10m", "/rkt/logs/foo"},
+			false,
+		},
+		{
+			types.Annotations{
+				{Name: common.LogFilesMaxSizeAnnotation, Value: "1g"},
+				{Name: common.LogFilesMaxFilesAnnotation, Value: "3"},
+			},
+			[]string{"/log-writer", "--max-size=1g", "--max-files=3", "/rkt/logs/foo"},
+			false,
+		},
+		{
+			types.Annotations{{Name: common.LogFilesMaxSizeAnnotation, Value: "huge"}},
+			nil,
+			true,
+		},
+		{
+			types.Annotations{
+				{Name: common.LogFilesMaxSizeAnnotation, Value: "10m"},
+				{Name: common.LogFilesMaxFilesAnnotation, Value: "-1"},
+			},
+			nil,
+			true,
+		},
+	}
+
+	for i, tt := range tests {
+		p := &Pod{Pod: &stage1lib.Pod{
+			Manifest: &schema.PodManifest{Annotations: tt.annotations},
+		}}
+		wrap, err := p.getLogWriterWrap(types.ACName("foo"), nil)
+		if tt.err {
+			if err == nil {
+				t.Errorf("#%d: expected error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(wrap, tt.wrap) {
+			t.Errorf("#%d: got wrap %v, want %v", i, wrap, tt.wrap)
+		}
+	}
+}
+
+func TestGetLogShimWrap(t *testing.T) {
+	uuid, err := types.NewUUID("6d0d9608-a744-4333-be21-942145a97a5a")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	digest, err := types.NewHash("sha512-" + strings.Repeat("a", 128))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ra := &schema.RuntimeApp{
+		Name:  "web",
+		Image: schema.RuntimeImage{ID: *digest},
+		App:   &types.App{Exec: types.Exec{"/usr/sbin/nginx", "-g", "daemon off;"}},
+	}
+	fields := []string{
+		"--identifier=nginx",
+		"--field=RKT_POD_UUID=6d0d9608-a744-4333-be21-942145a97a5a",
+		"--field=RKT_APP_NAME=web",
+		"--field=RKT_IMAGE_NAME=example.com/nginx",
+		"--field=RKT_IMAGE_DIGEST=sha512-" + strings.Repeat("a", 128),
+	}
+
+	tests := []struct {
+		annotations types.Annotations
+		wrap        []string
+		err         bool
+	}{
+		{nil, append([]string{"/log-shim"}, fields...), false},
+		{
+			types.Annotations{{Name: common.LogDriverAnnotation, Value: "journald"}},
+			append([]string{"/log-shim", "--driver=journald"}, fields...),
+			false,
+		},
+		{
+			types.Annotations{
+				{Name: common.LogDriverAnnotation, Value: "syslog"},
+				{Name: common.LogDriverAddressAnnotation, Value: "udp://10.0.0.1:514"},
+			},
+			append([]string{"/log-shim", "--driver=syslog", "--address=udp://10.0.0.1:514"}, fields...),
+			false,
+		},
+		{
+			types.Annotations{
+				{Name: common.LogDriverAnnotation, Value: "fluentd"},
+				{Name: common.LogDriverAddressAnnotation, Value: "tcp://10.0.0.1:24224"},
+			},
+			append([]string{"/log-shim", "--driver=fluentd", "--address=tcp://10.0.0.1:24224"}, fields...),
+			false,
+		},
+		{
+			types.Annotations{{Name: common.LogDriverAnnotation, Value: "fluentd"}},
+			nil,
+			true,
+		},
+		{
+			types.Annotations{{Name: common.LogDriverAnnotation, Value: "gelf"}},
+			nil,
+			true,
+		},
+	}
+
+	for i, tt := range tests {
+		p := &Pod{Pod: &stage1lib.Pod{
+			UUID:     *uuid,
+			Manifest: &schema.PodManifest{Annotations: tt.annotations},
+		}}
+		wrap, err := p.getLogShimWrap(ra, "example.com/nginx")
+		if gotErr := err != nil; gotErr != tt.err {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.err)
+			continue
+		}
+		if !reflect.DeepEqual(wrap, tt.wrap) {
+			t.Errorf("#%d: got wrap %v, want %v", i, wrap, tt.wrap)
+		}
+	}
+}
+
+func TestGetLogCommand(t *testing.T) {
+	uuid, err := types.NewUUID("6d0d9608-a744-4333-be21-942145a97a5a")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	digest, err := types.NewHash("sha512-" + strings.Repeat("a", 128))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ra := &schema.RuntimeApp{
+		Name:  "web",
+		Image: schema.RuntimeImage{ID: *digest},
+		App:   &types.App{Exec: types.Exec{"/usr/sbin/nginx"}},
+	}
+	shim := []string{
+		"/log-shim",
+		"--identifier=nginx",
+		"--field=RKT_POD_UUID=6d0d9608-a744-4333-be21-942145a97a5a",
+		"--field=RKT_APP_NAME=web",
+		"--field=RKT_IMAGE_NAME=example.com/nginx",
+		"--field=RKT_IMAGE_DIGEST=sha512-" + strings.Repeat("a", 128),
+	}
+	input := []string{"--stdout=/rkt/log-fifos/web/stdout", "--stderr=/rkt/log-fifos/web/stderr"}
+
+	tests := []struct {
+		annotations types.Annotations
+		cmd         []string
+	}{
+		{nil, append(append([]string(nil), shim...), input...)},
+		{
+			types.Annotations{{Name: common.LogFilesMaxSizeAnnotation, Value: "10m"}},
+			append(append(append([]string(nil), shim...), "/log-writer", "--max-size=10m"), append(input, "/rkt/logs/web")...),
+		},
+	}
+
+	for i, tt := range tests {
+		p := &Pod{Pod: &stage1lib.Pod{
+			UUID:     *uuid,
+			Manifest: &schema.PodManifest{Annotations: tt.annotations},
+		}}
+		cmd, err := p.getLogCommand(ra, "example.com/nginx")
+		if err != nil {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(cmd, tt.cmd) {
+			t.Errorf("#%d: got command %v, want %v", i, cmd, tt.cmd)
+		}
+	}
+}
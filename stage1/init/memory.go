@@ -0,0 +1,154 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/coreos/go-systemd/unit"
+	"github.com/coreos/rkt/common"
+)
+
+// memoryMount is a file system mounted once for the pod in stage1 and bind
+// mounted in all the apps, so they share its memory.
+type memoryMount struct {
+	podPath string // path in stage1
+	appPath string // path in the apps
+	fsType  string
+	options string
+}
+
+// getMemoryMounts returns the shared memory file systems requested in the
+// pod annotations.
+func (p *Pod) getMemoryMounts() ([]memoryMount, error) {
+	var mounts []memoryMount
+
+	if size, ok := p.Manifest.Annotations.Get(common.ShmSizeAnnotation); ok {
+		if err := common.ValidateMemorySize(size); err != nil {
+			return nil, fmt.Errorf("invalid shm size: %v", err)
+		}
+		mounts = append(mounts, memoryMount{
+			podPath: "/rkt/shm",
+			appPath: "/dev/shm",
+			fsType:  "tmpfs",
+			options: "mode=1777,size=" + size,
+		})
+	}
+
+	if pageSize, ok := p.Manifest.Annotations.Get(common.HugepagesAnnotation); ok {
+		options := "mode=1777"
+		if pageSize != "default" {
+			if err := common.ValidateMemorySize(pageSize); err != nil {
+				return nil, fmt.Errorf("invalid hugepages page size: %v", err)
+			}
+			options += ",pagesize=" + pageSize
+		}
+		mounts = append(mounts, memoryMount{
+			podPath: "/rkt/hugepages",
+			appPath: "/dev/hugepages",
+			fsType:  "hugetlbfs",
+			options: options,
+		})
+	}
+
+	return mounts, nil
+}
+
+// memoryMountUnitName returns the name of the mount unit of the pod file
+// system of m.
+func memoryMountUnitName(m memoryMount) string {
+	return unit.UnitNamePathEscape(m.podPath + ".mount")
+}
+
+func (p *Pod) writeUnit(name string, opts []*unit.UnitOption) error {
+	file, err := os.OpenFile(filepath.Join(common.Stage1RootfsPath(p.Root), unitsDir, name), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create unit file: %v", err)
+	}
+	defer file.Close()
+
+	if _, err = io.Copy(file, unit.Serialize(opts)); err != nil {
+		return fmt.Errorf("failed to write unit file: %v", err)
+	}
+	return nil
+}
+
+// writeMemoryMountUnits writes the mount units of the shared memory file
+// systems of the pod. They are pulled in by the apps.
+func (p *Pod) writeMemoryMountUnits() error {
+	mounts, err := p.getMemoryMounts()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range mounts {
+		opts := []*unit.UnitOption{
+			unit.NewUnitOption("Unit", "Description", fmt.Sprintf("Shared memory of the pod on %s", m.appPath)),
+			unit.NewUnitOption("Unit", "DefaultDependencies", "false"),
+			unit.NewUnitOption("Mount", "What", m.fsType),
+			unit.NewUnitOption("Mount", "Where", m.podPath),
+			unit.NewUnitOption("Mount", "Type", m.fsType),
+			unit.NewUnitOption("Mount", "Options", m.options),
+		}
+		if err := p.writeUnit(memoryMountUnitName(m), opts); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// appMemoryMountOptions writes the units bind mounting the shared memory
+// file systems of the pod in the rootfs of an app, over the mounts done by
+// prepare-app, and returns the options of the service unit of the app
+// depending on them.
+func (p *Pod) appMemoryMountOptions(ra *schema.RuntimeApp) ([]*unit.UnitOption, error) {
+	mounts, err := p.getMemoryMounts()
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []*unit.UnitOption
+	for _, m := range mounts {
+		podUnit := memoryMountUnitName(m)
+		where := filepath.Join("/", common.RelAppRootfsPath(ra.Name), m.appPath)
+		mountUnit := unit.UnitNamePathEscape(where + ".mount")
+		mountOpts := []*unit.UnitOption{
+			unit.NewUnitOption("Unit", "Description", fmt.Sprintf("Bind mount of %s on %s", m.podPath, where)),
+			unit.NewUnitOption("Unit", "DefaultDependencies", "false"),
+			unit.NewUnitOption("Unit", "Requires", podUnit),
+			unit.NewUnitOption("Unit", "After", podUnit),
+			unit.NewUnitOption("Unit", "After", InstantiatedPrepareAppUnitName(ra.Name)),
+			unit.NewUnitOption("Mount", "What", m.podPath),
+			unit.NewUnitOption("Mount", "Where", where),
+			unit.NewUnitOption("Mount", "Type", "bind"),
+			unit.NewUnitOption("Mount", "Options", "bind"),
+		}
+		if err := p.writeUnit(mountUnit, mountOpts); err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, unit.NewUnitOption("Unit", "Requires", mountUnit))
+		opts = append(opts, unit.NewUnitOption("Unit", "After", mountUnit))
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+	stage1lib "github.com/coreos/rkt/pkg/stage1"
+)
+
+func TestGetMemoryMounts(t *testing.T) {
+	tests := []struct {
+		annotations types.Annotations
+		options     []string
+		err         bool
+	}{
+		{nil, nil, false},
+		{
+			types.Annotations{{Name: common.ShmSizeAnnotation, Value: "512m"}},
+			[]string{"mode=1777,size=512m"},
+			false,
+		},
+		{
+			types.Annotations{{Name: common.HugepagesAnnotation, Value: "default"}},
+			[]string{"mode=1777"},
+			false,
+		},
+		{
+			types.Annotations{
+				{Name: common.ShmSizeAnnotation, Value: "1g"},
+				{Name: common.HugepagesAnnotation, Value: "2M"},
+			},
+			[]string{"mode=1777,size=1g", "mode=1777,pagesize=2M"},
+			false,
+		},
+		{
+			types.Annotations{{Name: common.ShmSizeAnnotation, Value: "1g,exec"}},
+			nil,
+			true,
+		},
+		{
+			types.Annotations{{Name: common.HugepagesAnnotation, Value: "huge"}},
+			nil,
+			true,
+		},
+	}
+
+	for i, tt := range tests {
+		p := &Pod{Pod: &stage1lib.Pod{
+			Manifest: &schema.PodManifest{Annotations: tt.annotations},
+		}}
+		mounts, err := p.getMemoryMounts()
+		if tt.err {
+			if err == nil {
+				t.Errorf("#%d: expected error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+			continue
+		}
+		var options []string
+		for _, m := range mounts {
+			options = append(options, m.options)
+		}
+		if !reflect.DeepEqual(options, tt.options) {
+			t.Errorf("#%d: got options %v, want %v", i, options, tt.options)
+		}
+	}
+}
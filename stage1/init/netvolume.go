@@ -0,0 +1,216 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/coreos/go-systemd/unit"
+	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/common/audit"
+	initcommon "github.com/coreos/rkt/stage1/init/common"
+)
+
+const (
+	// networkVolumesDir is where the network volumes are mounted in
+	// stage1, before being bind mounted in the apps
+	networkVolumesDir = "/rkt/volumes"
+	// podSecretsDir is where the secrets of the pod are bound in stage1,
+	// for the credentials of the cifs volumes
+	podSecretsDir = "/rkt/secrets"
+	// netVolumeMountBin mounts the network volumes in stage1, see
+	// stage1/netvolume-mount
+	netVolumeMountBin = "/netvolume-mount"
+)
+
+// getNetworkVolumes returns the network volumes described by the pod
+// annotations, by name.
+func (p *Pod) getNetworkVolumes() (map[types.ACName]common.NetworkVolume, error) {
+	value, ok := p.Manifest.Annotations.Get(common.NetworkVolumesAnnotation)
+	if !ok {
+		return nil, nil
+	}
+	vols, err := common.ParseNetworkVolumes(value)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[types.ACName]common.NetworkVolume)
+	for _, v := range vols {
+		byName[types.ACName(v.Name)] = v
+	}
+	return byName, nil
+}
+
+// networkVolumeUsesSecrets returns whether a network volume of the pod
+// reads its credentials from a secret, so the secrets must be bound in
+// stage1.
+func (p *Pod) networkVolumeUsesSecrets() (bool, error) {
+	vols, err := p.getNetworkVolumes()
+	if err != nil {
+		return false, err
+	}
+	for _, v := range vols {
+		if v.Secret != "" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// networkVolumeMountOptions returns the options passed to the kernel to
+// mount the file system of a network volume, whose server is at addr.
+func networkVolumeMountOptions(v common.NetworkVolume, addr string) string {
+	opts := append([]string{}, v.Options...)
+	if v.Kind == common.VolumeKindCIFS {
+		opts = append(opts, "ip="+addr)
+	} else {
+		opts = append(opts, "addr="+addr)
+	}
+	return strings.Join(opts, ",")
+}
+
+// networkVolumeMountArgs returns the command mounting the file system of a
+// network volume, whose server is at addr, in stage1.
+func networkVolumeMountArgs(v common.NetworkVolume, addr string) []string {
+	args := []string{netVolumeMountBin}
+	if v.ReadOnly {
+		args = append(args, "--read-only")
+	}
+	if v.Secret != "" {
+		args = append(args, "--credentials="+filepath.Join(podSecretsDir, v.Secret))
+	}
+	return append(args, v.Kind, v.Source, filepath.Join(networkVolumesDir, v.Name), networkVolumeMountOptions(v, addr))
+}
+
+// resolveNetworkVolumeHost returns the address of the server of a network
+// volume. The kernel does not resolve names, the host resolver is used.
+func resolveNetworkVolumeHost(v common.NetworkVolume) (string, error) {
+	host := v.Host()
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String(), nil
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve the server of volume %q: %v", v.Name, err)
+	}
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			return ip.String(), nil
+		}
+	}
+	return ips[0].String(), nil
+}
+
+// networkVolumeUnitName returns the name of the service mounting the file
+// system of a network volume in stage1.
+func networkVolumeUnitName(v common.NetworkVolume) string {
+	return fmt.Sprintf("network-volume-%s.service", v.Name)
+}
+
+// writeNetworkVolumeUnits writes the services mounting the file systems of
+// the network volumes in the pod, from its network. They are pulled in by
+// the apps mounting them.
+func (p *Pod) writeNetworkVolumeUnits() error {
+	vols, err := p.getNetworkVolumes()
+	if err != nil {
+		return err
+	}
+
+	for _, v := range vols {
+		addr, err := resolveNetworkVolumeHost(v)
+		if err != nil {
+			return err
+		}
+		where := filepath.Join(networkVolumesDir, v.Name)
+		opts := []*unit.UnitOption{
+			unit.NewUnitOption("Unit", "Description", fmt.Sprintf("%s volume %s", v.Kind, v.Name)),
+			unit.NewUnitOption("Unit", "DefaultDependencies", "false"),
+			unit.NewUnitOption("Service", "Type", "oneshot"),
+			unit.NewUnitOption("Service", "RemainAfterExit", "yes"),
+			unit.NewUnitOption("Service", "ExecStart", quoteExec(networkVolumeMountArgs(v, addr))),
+			unit.NewUnitOption("Service", "ExecStop", quoteExec([]string{netVolumeMountBin, "--unmount", where})),
+		}
+		if err := p.writeUnit(networkVolumeUnitName(v), opts); err != nil {
+			return err
+		}
+		if err := p.auditLog(audit.KindMount, v.Kind, map[string]string{
+			"volume": v.Name,
+			"source": v.Source,
+			"target": where,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// appNetworkVolumeOptions writes the units bind mounting the network
+// volumes mounted by an app in its rootfs, over the empty volumes bound by
+// systemd-nspawn, and returns the options of the service unit of the app
+// depending on them.
+func (p *Pod) appNetworkVolumeOptions(ra *schema.RuntimeApp) ([]*unit.UnitOption, error) {
+	netVols, err := p.getNetworkVolumes()
+	if err != nil || len(netVols) == 0 {
+		return nil, err
+	}
+
+	vols := make(map[types.ACName]types.Volume)
+	for _, v := range p.Manifest.Volumes {
+		vols[v.Name] = v
+	}
+
+	var opts []*unit.UnitOption
+	for _, m := range initcommon.GenerateMounts(ra, vols) {
+		nv, ok := netVols[m.Volume]
+		if !ok {
+			continue
+		}
+		podUnit := networkVolumeUnitName(nv)
+		what := filepath.Join(networkVolumesDir, nv.Name)
+		where := filepath.Join("/", common.RelAppRootfsPath(ra.Name), m.Path)
+		mountOptions := "bind"
+		if initcommon.IsMountReadOnly(vols[m.Volume], ra.App.MountPoints) {
+			mountOptions += ",ro"
+		}
+		mountUnit := unit.UnitNamePathEscape(where + ".mount")
+		mountOpts := []*unit.UnitOption{
+			unit.NewUnitOption("Unit", "Description", fmt.Sprintf("Bind mount of %s on %s", what, where)),
+			unit.NewUnitOption("Unit", "DefaultDependencies", "false"),
+			unit.NewUnitOption("Unit", "Requires", podUnit),
+			unit.NewUnitOption("Unit", "After", podUnit),
+			unit.NewUnitOption("Unit", "After", InstantiatedPrepareAppUnitName(ra.Name)),
+			unit.NewUnitOption("Mount", "What", what),
+			unit.NewUnitOption("Mount", "Where", where),
+			unit.NewUnitOption("Mount", "Type", "bind"),
+			unit.NewUnitOption("Mount", "Options", mountOptions),
+		}
+		if err := p.writeUnit(mountUnit, mountOpts); err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, unit.NewUnitOption("Unit", "Requires", mountUnit))
+		opts = append(opts, unit.NewUnitOption("Unit", "After", mountUnit))
+	}
+
+	return opts, nil
+}
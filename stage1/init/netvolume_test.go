@@ -0,0 +1,93 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+	stage1lib "github.com/coreos/rkt/pkg/stage1"
+)
+
+func TestNetworkVolumeMountArgs(t *testing.T) {
+	tests := []struct {
+		value   string
+		args    map[types.ACName][]string
+		secrets bool
+		err     bool
+	}{
+		{"", nil, false, false},
+		{
+			`[{"name": "data", "kind": "nfs", "source": "10.0.0.2:/srv/data", "options": ["vers=4"], "readOnly": true}]`,
+			map[types.ACName][]string{
+				"data": {"/netvolume-mount", "--read-only", "nfs", "10.0.0.2:/srv/data", "/rkt/volumes/data", "vers=4,addr=10.0.0.2"},
+			},
+			false,
+			false,
+		},
+		{
+			`[{"name": "data", "kind": "nfs", "source": "10.0.0.2:/srv/data"}, {"name": "share", "kind": "cifs", "source": "//10.0.0.3/share", "secret": "smb"}]`,
+			map[types.ACName][]string{
+				"data":  {"/netvolume-mount", "nfs", "10.0.0.2:/srv/data", "/rkt/volumes/data", "addr=10.0.0.2"},
+				"share": {"/netvolume-mount", "--credentials=/rkt/secrets/smb", "cifs", "//10.0.0.3/share", "/rkt/volumes/share", "ip=10.0.0.3"},
+			},
+			true,
+			false,
+		},
+		{`[{"name": "data", "kind": "nfs", "source": "/srv/data"}]`, nil, false, true},
+	}
+
+	for i, tt := range tests {
+		var annotations types.Annotations
+		if tt.value != "" {
+			annotations.Set(common.NetworkVolumesAnnotation, tt.value)
+		}
+		p := &Pod{Pod: &stage1lib.Pod{
+			Manifest: &schema.PodManifest{Annotations: annotations},
+		}}
+		vols, err := p.getNetworkVolumes()
+		if tt.err {
+			if err == nil {
+				t.Errorf("#%d: expected error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+			continue
+		}
+		if len(vols) != len(tt.args) {
+			t.Errorf("#%d: got %d volumes, want %d", i, len(vols), len(tt.args))
+		}
+		for name, args := range tt.args {
+			addr, err := resolveNetworkVolumeHost(vols[name])
+			if err != nil {
+				t.Errorf("#%d: unexpected error resolving volume %q: %v", i, name, err)
+				continue
+			}
+			if got := networkVolumeMountArgs(vols[name], addr); !reflect.DeepEqual(got, args) {
+				t.Errorf("#%d: got command %q for volume %q, want %q", i, got, name, args)
+			}
+		}
+		if secrets, _ := p.networkVolumeUsesSecrets(); secrets != tt.secrets {
+			t.Errorf("#%d: got secrets %t, want %t", i, secrets, tt.secrets)
+		}
+	}
+}
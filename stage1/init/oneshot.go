@@ -0,0 +1,117 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/coreos/go-systemd/unit"
+	"github.com/coreos/rkt/common"
+	initcommon "github.com/coreos/rkt/stage1/init/common"
+)
+
+// stopSidecarsUnit stops the apps which are not one-shot once the one-shot
+// apps exited successfully, so the pod completes.
+const stopSidecarsUnit = initcommon.StopSidecarsUnitName
+
+// getOneShotApps returns the one-shot apps of the pod and its other apps,
+// the sidecars.
+func (p *Pod) getOneShotApps() ([]types.ACName, []types.ACName, error) {
+	var oneShot, sidecars []types.ACName
+	for i := range p.Manifest.Apps {
+		ra := &p.Manifest.Apps[i]
+		ok, err := isOneShotApp(ra, p.Images[ra.Name.String()])
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			oneShot = append(oneShot, ra.Name)
+		} else {
+			sidecars = append(sidecars, ra.Name)
+		}
+	}
+	return oneShot, sidecars, nil
+}
+
+// isOneShotApp returns whether an app is a one-shot app.
+func isOneShotApp(ra *schema.RuntimeApp, im *schema.ImageManifest) (bool, error) {
+	return initcommon.GetAppBoolAnnotation(ra, im, common.OneShotAnnotation)
+}
+
+// writeOneShotUnits writes the unit stopping the sidecars of the pod when
+// it has one-shot apps. It is pulled in by the one-shot apps, and only runs
+// once they all exited successfully since they are oneshot services; a
+// failed one-shot app stops the pod like any other app.
+func (p *Pod) writeOneShotUnits() error {
+	oneShot, sidecars, err := p.getOneShotApps()
+	if err != nil {
+		return err
+	}
+	if len(oneShot) == 0 || len(sidecars) == 0 {
+		return nil
+	}
+
+	var names, services []string
+	for _, name := range sidecars {
+		names = append(names, name.String())
+		services = append(services, ServiceUnitName(name))
+	}
+	opts := []*unit.UnitOption{
+		unit.NewUnitOption("Unit", "Description", "Stop the sidecars of the one-shot apps"),
+		unit.NewUnitOption("Unit", "DefaultDependencies", "false"),
+		unit.NewUnitOption("Service", "Type", "oneshot"),
+		// the reapers record the sidecars as exited successfully rather
+		// than with the signal stopping them
+		unit.NewUnitOption("Service", "ExecStartPre", fmt.Sprintf("/reaper.sh --stopped %s", strings.Join(names, " "))),
+		unit.NewUnitOption("Service", "ExecStart", fmt.Sprintf("/usr/bin/systemctl stop --no-block %s", strings.Join(services, " "))),
+	}
+	for _, name := range oneShot {
+		opts = append(opts, unit.NewUnitOption("Unit", "Requires", ServiceUnitName(name)))
+		opts = append(opts, unit.NewUnitOption("Unit", "After", ServiceUnitName(name)))
+	}
+	return p.writeUnit(stopSidecarsUnit, opts)
+}
+
+// appOneShotOptions returns the options of the service unit of an app
+// which make it a oneshot service, completing when it exits, if it is a
+// one-shot app or required by another app.
+func (p *Pod) appOneShotOptions(ra *schema.RuntimeApp) ([]*unit.UnitOption, error) {
+	oneShot, err := isOneShotApp(ra, p.Images[ra.Name.String()])
+	if err != nil {
+		return nil, err
+	}
+	required, err := p.isAppRequired(ra.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []*unit.UnitOption
+	if oneShot || required {
+		opts = append(opts, unit.NewUnitOption("Service", "Type", "oneshot"))
+	}
+	if oneShot {
+		if _, sidecars, err := p.getOneShotApps(); err != nil {
+			return nil, err
+		} else if len(sidecars) > 0 {
+			opts = append(opts, unit.NewUnitOption("Unit", "Wants", stopSidecarsUnit))
+		}
+	}
+	return opts, nil
+}
@@ -0,0 +1,163 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/coreos/go-systemd/unit"
+	"github.com/coreos/rkt/common"
+	stage1lib "github.com/coreos/rkt/pkg/stage1"
+)
+
+func TestOneShotApps(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rkt-oneshot-test-")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		// annotations of the apps "job", "logger" and "proxy" in the
+		// pod manifest
+		annotations [3]map[string]string
+		// one-shot annotation of the image of "job"
+		imageOneShot string
+		opts         map[types.ACName][]*unit.UnitOption
+		// stopped by the stop-sidecars unit, if any
+		stopped string
+	}{
+		{
+			[3]map[string]string{},
+			"",
+			map[types.ACName][]*unit.UnitOption{},
+			"",
+		},
+		{
+			[3]map[string]string{{common.OneShotAnnotation: "true"}},
+			"",
+			map[types.ACName][]*unit.UnitOption{
+				"job": {
+					unit.NewUnitOption("Service", "Type", "oneshot"),
+					unit.NewUnitOption("Unit", "Wants", stopSidecarsUnit),
+				},
+			},
+			"logger.service proxy.service",
+		},
+		// set by the image, overridden in the pod manifest
+		{
+			[3]map[string]string{nil, {common.OneShotAnnotation: "true"}, {common.OneShotAnnotation: "true"}},
+			"false",
+			map[types.ACName][]*unit.UnitOption{
+				"logger": {
+					unit.NewUnitOption("Service", "Type", "oneshot"),
+					unit.NewUnitOption("Unit", "Wants", stopSidecarsUnit),
+				},
+				"proxy": {
+					unit.NewUnitOption("Service", "Type", "oneshot"),
+					unit.NewUnitOption("Unit", "Wants", stopSidecarsUnit),
+				},
+			},
+			"job.service",
+		},
+		// all the apps are one-shot, no sidecars to stop
+		{
+			[3]map[string]string{nil, {common.OneShotAnnotation: "true"}, {common.OneShotAnnotation: "true"}},
+			"true",
+			map[types.ACName][]*unit.UnitOption{
+				"job":    {unit.NewUnitOption("Service", "Type", "oneshot")},
+				"logger": {unit.NewUnitOption("Service", "Type", "oneshot")},
+				"proxy":  {unit.NewUnitOption("Service", "Type", "oneshot")},
+			},
+			"",
+		},
+		// a required app is a oneshot service too
+		{
+			[3]map[string]string{nil, nil, {common.AppRequiresAnnotation: "logger"}},
+			"",
+			map[types.ACName][]*unit.UnitOption{
+				"logger": {unit.NewUnitOption("Service", "Type", "oneshot")},
+			},
+			"",
+		},
+	}
+
+	for i, tt := range tests {
+		root := filepath.Join(dir, string(rune('a'+i)))
+		unitsPath := filepath.Join(common.Stage1RootfsPath(root), unitsDir)
+		if err := os.MkdirAll(unitsPath, 0755); err != nil {
+			t.Fatalf("error creating %q: %v", unitsPath, err)
+		}
+
+		var apps schema.AppList
+		for j, name := range []types.ACName{"job", "logger", "proxy"} {
+			ra := schema.RuntimeApp{Name: name}
+			for k, v := range tt.annotations[j] {
+				ra.Annotations.Set(types.ACIdentifier(k), v)
+			}
+			apps = append(apps, ra)
+		}
+		im := &schema.ImageManifest{}
+		if tt.imageOneShot != "" {
+			im.Annotations.Set(common.OneShotAnnotation, tt.imageOneShot)
+		}
+		p := &Pod{Pod: &stage1lib.Pod{
+			Root:     root,
+			Manifest: &schema.PodManifest{Apps: apps},
+			Images:   map[string]*schema.ImageManifest{"job": im},
+		}}
+
+		for j := range apps {
+			opts, err := p.appOneShotOptions(&apps[j])
+			if err != nil {
+				t.Errorf("#%d: app %q: unexpected error: %v", i, apps[j].Name, err)
+				continue
+			}
+			if !unit.AllMatch(opts, tt.opts[apps[j].Name]) {
+				t.Errorf("#%d: app %q: got options %v, want %v", i, apps[j].Name, opts, tt.opts[apps[j].Name])
+			}
+		}
+
+		if err := p.writeOneShotUnits(); err != nil {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(unitsPath, stopSidecarsUnit))
+		if tt.stopped == "" {
+			if err == nil {
+				t.Errorf("#%d: unexpected %s", i, stopSidecarsUnit)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: error reading %s: %v", i, stopSidecarsUnit, err)
+			continue
+		}
+		if want := "ExecStart=/usr/bin/systemctl stop --no-block " + tt.stopped + "\n"; !strings.Contains(string(b), want) {
+			t.Errorf("#%d: got unit %q, want it to contain %q", i, b, want)
+		}
+		if want := "ExecStartPre=/reaper.sh --stopped " + strings.Replace(tt.stopped, ".service", "", -1) + "\n"; !strings.Contains(string(b), want) {
+			t.Errorf("#%d: got unit %q, want it to contain %q", i, b, want)
+		}
+	}
+}
@@ -22,10 +22,12 @@ import (
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/coreos/go-systemd/unit"
 	"github.com/coreos/rkt/common"
+	initcommon "github.com/coreos/rkt/stage1/init/common"
 )
 
 const (
 	envDir          = "/rkt/env" // TODO(vc): perhaps this doesn't belong in /rkt?
+	appStateDir     = "/rkt/app-state"
 	unitsDir        = "/usr/lib/systemd/system"
 	defaultWantsDir = unitsDir + "/default.target.wants"
 	socketsWantsDir = unitsDir + "/sockets.target.wants"
@@ -33,7 +35,7 @@ const (
 
 // ServiceUnitName returns a systemd service unit name for the given app name.
 func ServiceUnitName(appName types.ACName) string {
-	return appName.String() + ".service"
+	return initcommon.ServiceUnitName(appName)
 }
 
 // ServiceUnitPath returns the path to the systemd service file for the given
@@ -48,6 +50,12 @@ func RelEnvFilePath(appName types.ACName) string {
 	return filepath.Join(envDir, appName.String())
 }
 
+// AppStateFilePath returns the path to the file recording the state of the
+// given app, see stage1/app-state/app-state.sh.
+func AppStateFilePath(root string, appName types.ACName) string {
+	return filepath.Join(common.Stage1RootfsPath(root), appStateDir, appName.String())
+}
+
 // EnvFilePath returns the path to the environment file for the given app name.
 func EnvFilePath(root string, appName types.ACName) string {
 	return filepath.Join(common.Stage1RootfsPath(root), RelEnvFilePath(appName))
@@ -69,7 +77,7 @@ func InstantiatedPrepareAppUnitName(appName types.ACName) string {
 
 // SocketUnitName returns a systemd socket unit name for the given app name.
 func SocketUnitName(appName types.ACName) string {
-	return appName.String() + ".socket"
+	return initcommon.SocketUnitName(appName)
 }
 
 // SocketUnitPath returns the path to the systemd socket file for the given app name.
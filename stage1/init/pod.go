@@ -18,7 +18,6 @@ package main
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -28,12 +27,19 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/coreos/go-systemd/unit"
 	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/common/audit"
 	"github.com/coreos/rkt/common/cgroup"
+	"github.com/coreos/rkt/common/cpuset"
+	"github.com/coreos/rkt/common/device"
+	"github.com/coreos/rkt/common/gpu"
+	"github.com/coreos/rkt/common/rlimit"
+	stage1lib "github.com/coreos/rkt/pkg/stage1"
 	"github.com/coreos/rkt/pkg/uid"
 	initcommon "github.com/coreos/rkt/stage1/init/common"
 	"github.com/coreos/rkt/stage1/init/kvm"
@@ -41,12 +47,12 @@ import (
 
 // Pod encapsulates a PodManifest and ImageManifests
 type Pod struct {
-	Root               string // root directory where the pod will be located
-	UUID               types.UUID
-	Manifest           *schema.PodManifest
-	Images             map[string]*schema.ImageManifest
+	*stage1lib.Pod
 	MetadataServiceURL string
 	Networks           []string
+	// InheritedSockets are the options of the socket units listening on
+	// the sockets passed to rkt by systemd, by app
+	InheritedSockets map[types.ACName][]*unit.UnitOption
 }
 
 const (
@@ -55,6 +61,10 @@ const (
 	sharedVolPerm = os.FileMode(0755)
 )
 
+// readOnlyRootFSTmpfsPaths are the paths where a tmpfs is mounted in the apps
+// with a read-only rootfs, as they need to be writable.
+var readOnlyRootFSTmpfsPaths = []string{"/tmp", "/run"}
+
 var (
 	defaultEnv = map[string]string{
 		"PATH":    "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
@@ -68,45 +78,11 @@ var (
 // LoadPod loads a Pod Manifest (as prepared by stage0) and
 // its associated Application Manifests, under $root/stage1/opt/stage1/$apphash
 func LoadPod(root string, uuid *types.UUID) (*Pod, error) {
-	p := &Pod{
-		Root:   root,
-		UUID:   *uuid,
-		Images: make(map[string]*schema.ImageManifest),
-	}
-
-	buf, err := ioutil.ReadFile(common.PodManifestPath(p.Root))
+	p, err := stage1lib.LoadPod(root, uuid)
 	if err != nil {
-		return nil, fmt.Errorf("failed reading pod manifest: %v", err)
+		return nil, err
 	}
-
-	pm := &schema.PodManifest{}
-	if err := json.Unmarshal(buf, pm); err != nil {
-		return nil, fmt.Errorf("failed unmarshalling pod manifest: %v", err)
-	}
-	p.Manifest = pm
-
-	for i, app := range p.Manifest.Apps {
-		ampath := common.ImageManifestPath(p.Root, app.Name)
-		buf, err := ioutil.ReadFile(ampath)
-		if err != nil {
-			return nil, fmt.Errorf("failed reading app manifest %q: %v", ampath, err)
-		}
-
-		am := &schema.ImageManifest{}
-		if err = json.Unmarshal(buf, am); err != nil {
-			return nil, fmt.Errorf("failed unmarshalling app manifest %q: %v", ampath, err)
-		}
-
-		if _, ok := p.Images[app.Name.String()]; ok {
-			return nil, fmt.Errorf("got multiple definitions for app: %v", app.Name)
-		}
-		if app.App == nil {
-			p.Manifest.Apps[i].App = am.App
-		}
-		p.Images[app.Name.String()] = am
-	}
-
-	return p, nil
+	return &Pod{Pod: p}, nil
 }
 
 // execEscape uses Golang's string quoting for ", \, \n, and regex for special cases
@@ -189,7 +165,7 @@ func (p *Pod) WritePrepareAppTemplate() error {
 	}
 
 	unitsPath := filepath.Join(common.Stage1RootfsPath(p.Root), unitsDir)
-	file, err := os.OpenFile(filepath.Join(unitsPath, "prepare-app@.service"), os.O_WRONLY|os.O_CREATE, 0644)
+	file, err := os.OpenFile(filepath.Join(unitsPath, "prepare-app@.service"), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
 		return fmt.Errorf("failed to create service unit file: %v", err)
 	}
@@ -217,7 +193,48 @@ func (p *Pod) writeAppReaper(appName string) error {
 	}
 
 	unitsPath := filepath.Join(common.Stage1RootfsPath(p.Root), unitsDir)
-	file, err := os.OpenFile(filepath.Join(unitsPath, fmt.Sprintf("reaper-%s.service", appName)), os.O_WRONLY|os.O_CREATE, 0644)
+	file, err := os.OpenFile(filepath.Join(unitsPath, fmt.Sprintf("reaper-%s.service", appName)), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create service unit file: %v", err)
+	}
+	defer file.Close()
+
+	if _, err = io.Copy(file, unit.Serialize(opts)); err != nil {
+		return fmt.Errorf("failed to write service unit file: %v", err)
+	}
+
+	return nil
+}
+
+// writeAppState records the initial state of an app, before its service is
+// started.
+func (p *Pod) writeAppState(appName types.ACName) error {
+	path := AppStateFilePath(p.Root, appName)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	state := fmt.Sprintf("state=created\ncreated=%d\nrestarts=0\n", time.Now().Unix())
+	return ioutil.WriteFile(path, []byte(state), 0644)
+}
+
+// writeAppStateUnit writes the service recording the state transitions of
+// an app with app-state.sh: it is started after the service of the app and
+// stopped when the app exits, so it records the exit status of the app.
+func (p *Pod) writeAppStateUnit(appName types.ACName) error {
+	serviceName := ServiceUnitName(appName)
+	opts := []*unit.UnitOption{
+		unit.NewUnitOption("Unit", "Description", fmt.Sprintf("%s State", appName)),
+		unit.NewUnitOption("Unit", "DefaultDependencies", "false"),
+		unit.NewUnitOption("Unit", "BindsTo", serviceName),
+		unit.NewUnitOption("Unit", "After", serviceName),
+		unit.NewUnitOption("Service", "Type", "oneshot"),
+		unit.NewUnitOption("Service", "RemainAfterExit", "yes"),
+		unit.NewUnitOption("Service", "ExecStart", fmt.Sprintf("/app-state.sh %s started", appName)),
+		unit.NewUnitOption("Service", "ExecStop", fmt.Sprintf("/app-state.sh %s exited", appName)),
+	}
+
+	unitsPath := filepath.Join(common.Stage1RootfsPath(p.Root), unitsDir)
+	file, err := os.OpenFile(filepath.Join(unitsPath, initcommon.AppStateUnitName(appName)), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
 		return fmt.Errorf("failed to create service unit file: %v", err)
 	}
@@ -257,10 +274,32 @@ func (p *Pod) appToSystemd(ra *schema.RuntimeApp, interactive bool, flavor strin
 	env := app.Environment
 
 	env.Set("AC_APP_NAME", appName.String())
+	if locale, ok := p.Manifest.Annotations.Get(common.LocaleAnnotation); ok {
+		// the locale of the pod is only a default for the app
+		if _, ok := env.Get("LANG"); !ok {
+			env.Set("LANG", locale)
+		}
+	}
 	if p.MetadataServiceURL != "" {
 		env.Set("AC_METADATA_URL", p.MetadataServiceURL)
 	}
 
+	// with kvm, the GPUs are passed through to the guest and the image
+	// brings the driver
+	if flavor != "kvm" {
+		gpus, err := p.getGPUs()
+		if err != nil {
+			return err
+		}
+		if gpus != nil {
+			setGPUEnv(&env, gpus)
+		}
+	}
+
+	if err := p.setUnixSocketEnv(appName, &env); err != nil {
+		return err
+	}
+
 	if err := p.writeEnvFile(env, appName, privateUsers); err != nil {
 		return fmt.Errorf("unable to write environment file: %v", err)
 	}
@@ -286,12 +325,21 @@ func (p *Pod) appToSystemd(ra *schema.RuntimeApp, interactive bool, flavor strin
 		}
 	}
 
-	execWrap := []string{"/appexec", common.RelAppRootfsPath(appName), workDir, RelEnvFilePath(appName), strconv.Itoa(uid), generateGidArg(gid, app.SupplementaryGIDs)}
+	execWrap := []string{"/appexec"}
+	if !interactive {
+		// the output of the app goes to its log unit
+		redirect, err := p.writeLogUnit(ra, imgName, privateUsers)
+		if err != nil {
+			return fmt.Errorf("failed to write the log service: %v", err)
+		}
+		execWrap = append(execWrap, redirect...)
+	}
+	execWrap = append(execWrap, common.RelAppRootfsPath(appName), workDir, RelEnvFilePath(appName), strconv.Itoa(uid), generateGidArg(gid, app.SupplementaryGIDs))
 	execStart := quoteExec(append(execWrap, app.Exec...))
 	opts := []*unit.UnitOption{
 		unit.NewUnitOption("Unit", "Description", fmt.Sprintf("Application=%v Image=%v", appName, imgName)),
 		unit.NewUnitOption("Unit", "DefaultDependencies", "false"),
-		unit.NewUnitOption("Unit", "Wants", fmt.Sprintf("reaper-%s.service", appName)),
+		unit.NewUnitOption("Unit", "Wants", initcommon.ReaperUnitName(appName)),
 		unit.NewUnitOption("Service", "Restart", "no"),
 		unit.NewUnitOption("Service", "ExecStart", execStart),
 		unit.NewUnitOption("Service", "User", "0"),
@@ -303,9 +351,12 @@ func (p *Pod) appToSystemd(ra *schema.RuntimeApp, interactive bool, flavor strin
 		opts = append(opts, unit.NewUnitOption("Service", "StandardOutput", "tty"))
 		opts = append(opts, unit.NewUnitOption("Service", "StandardError", "tty"))
 	} else {
-		opts = append(opts, unit.NewUnitOption("Service", "StandardOutput", "journal+console"))
-		opts = append(opts, unit.NewUnitOption("Service", "StandardError", "journal+console"))
-		opts = append(opts, unit.NewUnitOption("Service", "SyslogIdentifier", filepath.Base(app.Exec[0])))
+		// only the errors of /appexec go to the console, the output of
+		// the app goes to its log unit
+		opts = append(opts, unit.NewUnitOption("Service", "StandardOutput", "console"))
+		opts = append(opts, unit.NewUnitOption("Service", "StandardError", "console"))
+		opts = append(opts, unit.NewUnitOption("Unit", "Requires", initcommon.LogUnitName(appName)))
+		opts = append(opts, unit.NewUnitOption("Unit", "After", initcommon.LogUnitName(appName)))
 	}
 
 	// When an app fails, we shut down the pod
@@ -325,6 +376,17 @@ func (p *Pod) appToSystemd(ra *schema.RuntimeApp, interactive bool, flavor strin
 		opts = append(opts, unit.NewUnitOption("Service", typ, exec))
 	}
 
+	// record the state transitions of the app for rkt status, from a
+	// unit of its own so app-state.sh isn't subject to the sandbox of
+	// the app
+	if err := p.writeAppState(appName); err != nil {
+		return fmt.Errorf("failed to write the state of the app: %v", err)
+	}
+	if err := p.writeAppStateUnit(appName); err != nil {
+		return fmt.Errorf("failed to write the app state service: %v", err)
+	}
+	opts = append(opts, unit.NewUnitOption("Unit", "Wants", initcommon.AppStateUnitName(appName)))
+
 	// Some pre-start jobs take a long time, set the timeout to 0
 	opts = append(opts, unit.NewUnitOption("Service", "TimeoutStartSec", "0"))
 
@@ -347,10 +409,20 @@ func (p *Pod) appToSystemd(ra *schema.RuntimeApp, interactive bool, flavor strin
 			if err != nil {
 				return err
 			}
+		case *rlimit.Rlimits:
+			for _, d := range v.Limits().SystemdDirectives() {
+				opts = append(opts, unit.NewUnitOption("Service", d[0], d[1]))
+			}
+		case *cpuset.Cpuset:
+			opts, err = cgroup.AddCpusetIsolator(opts, v.CPUs(), v.Mems())
+			if err != nil {
+				return err
+			}
 		}
 	}
 
-	if len(saPorts) > 0 {
+	inheritedSockets := p.InheritedSockets[appName]
+	if len(saPorts) > 0 || len(inheritedSockets) > 0 {
 		sockopts := []*unit.UnitOption{
 			unit.NewUnitOption("Unit", "Description", fmt.Sprintf("Application=%v Image=%v %s", appName, imgName, "socket-activated ports")),
 			unit.NewUnitOption("Unit", "DefaultDependencies", "false"),
@@ -370,8 +442,9 @@ func (p *Pod) appToSystemd(ra *schema.RuntimeApp, interactive bool, flavor strin
 			}
 			sockopts = append(sockopts, unit.NewUnitOption("Socket", proto, fmt.Sprintf("%v", sap.Port)))
 		}
+		sockopts = append(sockopts, inheritedSockets...)
 
-		file, err := os.OpenFile(SocketUnitPath(p.Root, appName), os.O_WRONLY|os.O_CREATE, 0644)
+		file, err := os.OpenFile(SocketUnitPath(p.Root, appName), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 		if err != nil {
 			return fmt.Errorf("failed to create socket file: %v", err)
 		}
@@ -388,10 +461,86 @@ func (p *Pod) appToSystemd(ra *schema.RuntimeApp, interactive bool, flavor strin
 		opts = append(opts, unit.NewUnitOption("Unit", "Requires", SocketUnitName(appName)))
 	}
 
+	hc, err := getHealthCheck(ra, image)
+	if err != nil {
+		return err
+	}
+	if hc != nil {
+		if err := p.writeHealthCheckUnits(appName, hc, execWrap); err != nil {
+			return fmt.Errorf("failed to write health check units: %v", err)
+		}
+		opts = append(opts, unit.NewUnitOption("Unit", "Wants", HealthCheckTimerUnitName(appName)))
+	}
+
+	readOnly, err := initcommon.IsReadOnlyRootFS(ra, image)
+	if err != nil {
+		return err
+	}
+	if readOnly {
+		roOpts, err := p.readOnlyRootFSOptions(ra)
+		if err != nil {
+			return fmt.Errorf("failed to make the rootfs read-only: %v", err)
+		}
+		opts = append(opts, roOpts...)
+	}
+
+	hardeningOpts, err := p.hardeningOptions(ra, image)
+	if err != nil {
+		return fmt.Errorf("failed to harden the app: %v", err)
+	}
+	opts = append(opts, hardeningOpts...)
+
+	seccompOpts, err := seccompOptions(ra, image)
+	if err != nil {
+		return fmt.Errorf("failed to set the seccomp profile: %v", err)
+	}
+	opts = append(opts, seccompOpts...)
+
+	if profile, ok := initcommon.GetAppAnnotation(ra, image, common.AppArmorProfileAnnotation); ok {
+		opts = append(opts, unit.NewUnitOption("Service", "AppArmorProfile", profile))
+	}
+
+	memOpts, err := p.appMemoryMountOptions(ra)
+	if err != nil {
+		return fmt.Errorf("failed to mount the shared memory: %v", err)
+	}
+	opts = append(opts, memOpts...)
+
+	netVolOpts, err := p.appNetworkVolumeOptions(ra)
+	if err != nil {
+		return fmt.Errorf("failed to mount the network volumes: %v", err)
+	}
+	opts = append(opts, netVolOpts...)
+
+	socketOpts, err := p.appUnixSocketOptions(ra)
+	if err != nil {
+		return fmt.Errorf("failed to use the unix sockets: %v", err)
+	}
+	opts = append(opts, socketOpts...)
+
+	depOpts, err := p.appDependencyOptions(ra)
+	if err != nil {
+		return err
+	}
+	opts = append(opts, depOpts...)
+
+	oneShotOpts, err := p.appOneShotOptions(ra)
+	if err != nil {
+		return err
+	}
+	opts = append(opts, oneShotOpts...)
+
+	// the properties passed through come last to override the ones of rkt
+	propertiesOpts, err := unitPropertiesOptions(ra)
+	if err != nil {
+		return err
+	}
+	opts = append(opts, propertiesOpts...)
+
 	opts = append(opts, unit.NewUnitOption("Unit", "Requires", InstantiatedPrepareAppUnitName(appName)))
 	opts = append(opts, unit.NewUnitOption("Unit", "After", InstantiatedPrepareAppUnitName(appName)))
 
-	file, err := os.OpenFile(ServiceUnitPath(p.Root, appName), os.O_WRONLY|os.O_CREATE, 0644)
+	file, err := os.OpenFile(ServiceUnitPath(p.Root, appName), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
 		return fmt.Errorf("failed to create service unit file: %v", err)
 	}
@@ -421,6 +570,44 @@ func (p *Pod) appToSystemd(ra *schema.RuntimeApp, interactive bool, flavor strin
 	return nil
 }
 
+// readOnlyRootFSOptions returns the options of the service unit of an app
+// which make its rootfs read-only. The writable volumes, /dev and the paths in
+// readOnlyRootFSTmpfsPaths, where a tmpfs is mounted, stay writable.
+func (p *Pod) readOnlyRootFSOptions(ra *schema.RuntimeApp) ([]*unit.UnitOption, error) {
+	appRootfs := filepath.Join("/", common.RelAppRootfsPath(ra.Name))
+	opts := []*unit.UnitOption{
+		unit.NewUnitOption("Service", "ReadOnlyDirectories", appRootfs),
+		unit.NewUnitOption("Service", "ReadWriteDirectories", "-"+filepath.Join(appRootfs, "dev")),
+	}
+
+	for _, path := range initcommon.WritableMountPaths(ra, p.Manifest.Volumes) {
+		opts = append(opts, unit.NewUnitOption("Service", "ReadWriteDirectories", "-"+filepath.Join(appRootfs, path)))
+	}
+
+	for _, path := range readOnlyRootFSTmpfsPaths {
+		where := filepath.Join(appRootfs, path)
+		mountUnit := unit.UnitNamePathEscape(where + ".mount")
+		mountOpts := []*unit.UnitOption{
+			unit.NewUnitOption("Unit", "Description", fmt.Sprintf("Tmpfs for %s", where)),
+			unit.NewUnitOption("Unit", "DefaultDependencies", "false"),
+			unit.NewUnitOption("Unit", "After", InstantiatedPrepareAppUnitName(ra.Name)),
+			unit.NewUnitOption("Mount", "What", "tmpfs"),
+			unit.NewUnitOption("Mount", "Where", where),
+			unit.NewUnitOption("Mount", "Type", "tmpfs"),
+			unit.NewUnitOption("Mount", "Options", "mode=1777,strictatime"),
+		}
+		if err := p.writeUnit(mountUnit, mountOpts); err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, unit.NewUnitOption("Unit", "Requires", mountUnit))
+		opts = append(opts, unit.NewUnitOption("Unit", "After", mountUnit))
+		opts = append(opts, unit.NewUnitOption("Service", "ReadWriteDirectories", where))
+	}
+
+	return opts, nil
+}
+
 // writeEnvFile creates an environment file for given app name, the minimum
 // required environment variables by the appc spec will be set to sensible
 // defaults here if they're not provided by env.
@@ -461,6 +648,13 @@ func (p *Pod) writeEnvFile(env types.Environment, appName types.ACName, privateU
 func (p *Pod) PodToSystemd(interactive bool, flavor string, privateUsers string) error {
 
 	if flavor == "kvm" {
+		if _, ok := p.Manifest.Annotations.Get(common.NetworkVolumesAnnotation); ok {
+			return fmt.Errorf("nfs and cifs volumes are not supported by the kvm flavor")
+		}
+		if p.localizationRequested() {
+			return fmt.Errorf("the timezone and locale options are not supported by the kvm flavor")
+		}
+
 		// prepare all applications names to become dependency for mount units
 		// all host-shared folder has to become available before applications starts
 		var appNames []types.ACName
@@ -470,12 +664,45 @@ func (p *Pod) PodToSystemd(interactive bool, flavor string, privateUsers string)
 
 		// mount host volumes through some remote file system e.g. 9p to /mnt/volumeName location
 		// order is important here: podToSystemHostMountUnits prepares folders that are checked by each appToSystemdMountUnits later
-		err := kvm.PodToSystemdHostMountUnits(common.Stage1RootfsPath(p.Root), p.Manifest.Volumes, appNames, unitsDir)
+		volumeOpts, err := getKVMVolumeOptions(p)
+		if err != nil {
+			return err
+		}
+		err = kvm.PodToSystemdHostMountUnits(common.Stage1RootfsPath(p.Root), p.Manifest.Volumes, volumeOpts, appNames, unitsDir)
 		if err != nil {
 			return fmt.Errorf("failed to transform pod volumes into mount units: %v", err)
 		}
 	}
 
+	if err := p.writeMemoryMountUnits(); err != nil {
+		return fmt.Errorf("failed to write shared memory mount units: %v", err)
+	}
+
+	// the systemd of the pod, in its own user namespace, cannot mount
+	// network file systems
+	if _, ok := p.Manifest.Annotations.Get(common.NetworkVolumesAnnotation); ok && privateUsers != "" {
+		return fmt.Errorf("nfs and cifs volumes are not supported with private users")
+	}
+	if err := p.writeNetworkVolumeUnits(); err != nil {
+		return fmt.Errorf("failed to write network volume mount units: %v", err)
+	}
+
+	if err := p.writePodTimeoutUnits(); err != nil {
+		return fmt.Errorf("failed to write pod timeout units: %v", err)
+	}
+
+	if err := p.writeOneShotUnits(); err != nil {
+		return fmt.Errorf("failed to write one-shot apps units: %v", err)
+	}
+
+	if err := p.writeUnixSocketUnits(); err != nil {
+		return fmt.Errorf("failed to write unix socket units: %v", err)
+	}
+
+	if err := p.writeJournaldConfig(); err != nil {
+		return fmt.Errorf("failed to write journald configuration: %v", err)
+	}
+
 	for i := range p.Manifest.Apps {
 		ra := &p.Manifest.Apps[i]
 		if err := p.appToSystemd(ra, interactive, flavor, privateUsers); err != nil {
@@ -538,6 +765,15 @@ func (p *Pod) appToNspawnArgs(ra *schema.RuntimeApp) ([]string, error) {
 		opt[2] = ":"
 		opt[3] = filepath.Join(common.RelAppRootfsPath(appName), m.Path)
 
+		if err := p.auditLog(audit.KindMount, "bind", map[string]string{
+			"app":      appName.String(),
+			"volume":   vol.Name.String(),
+			"source":   opt[1],
+			"target":   m.Path,
+			"readOnly": strconv.FormatBool(opt[0] == "--bind-ro="),
+		}); err != nil {
+			return nil, err
+		}
 		args = append(args, strings.Join(opt, ""))
 	}
 
@@ -568,17 +804,179 @@ func (p *Pod) PodToNspawnArgs() ([]string, error) {
 		"--directory=" + common.Stage1RootfsPath(p.Root),
 	}
 
+	// the credentials of the network volumes are read by their mount
+	// helpers in stage1
+	if usesSecrets, err := p.networkVolumeUsesSecrets(); err != nil {
+		return nil, err
+	} else if usesSecrets {
+		absRoot, err := filepath.Abs(p.Root)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get pod's root absolute path: %v", err)
+		}
+		args = append(args, fmt.Sprintf("--bind-ro=%s:%s", common.SecretsPath(absRoot), podSecretsDir))
+	}
+
+	devices, err := p.getDevices()
+	if err != nil {
+		return nil, err
+	}
+	gpuDevices, driverFiles, err := p.getGPUDevices()
+	if err != nil {
+		return nil, err
+	}
+	devices = append(devices, gpuDevices...)
+
+	localizationFiles, err := p.writeLocalizationFiles("/")
+	if err != nil {
+		return nil, err
+	}
+
 	for i := range p.Manifest.Apps {
 		aa, err := p.appToNspawnArgs(&p.Manifest.Apps[i])
 		if err != nil {
 			return nil, err
 		}
 		args = append(args, aa...)
+
+		// bind the device nodes in the rootfs of every app
+		for _, d := range devices {
+			if err := p.auditLog(audit.KindDevice, "bind", map[string]string{
+				"app":    p.Manifest.Apps[i].Name.String(),
+				"source": d.HostPath,
+				"target": d.PodPath,
+				"perms":  d.Perms,
+			}); err != nil {
+				return nil, err
+			}
+			args = append(args, fmt.Sprintf("--bind=%s:%s", d.HostPath, filepath.Join(common.RelAppRootfsPath(p.Manifest.Apps[i].Name), d.PodPath)))
+		}
+
+		// bind the GPU driver read-only in the rootfs of every app
+		for _, f := range driverFiles {
+			if err := p.auditLog(audit.KindMount, "bind", map[string]string{
+				"app":      p.Manifest.Apps[i].Name.String(),
+				"source":   f.HostPath,
+				"target":   f.PodPath,
+				"readOnly": "true",
+			}); err != nil {
+				return nil, err
+			}
+			args = append(args, fmt.Sprintf("--bind-ro=%s:%s", f.HostPath, filepath.Join(common.RelAppRootfsPath(p.Manifest.Apps[i].Name), f.PodPath)))
+		}
+
+		// bind the generated timezone and locale files read-only in
+		// the rootfs of every app
+		for _, f := range localizationFiles {
+			if err := p.auditLog(audit.KindMount, "bind", map[string]string{
+				"app":      p.Manifest.Apps[i].Name.String(),
+				"source":   f.hostPath,
+				"target":   f.appPath,
+				"readOnly": "true",
+			}); err != nil {
+				return nil, err
+			}
+			args = append(args, fmt.Sprintf("--bind-ro=%s:%s", f.hostPath, filepath.Join(common.RelAppRootfsPath(p.Manifest.Apps[i].Name), f.appPath)))
+		}
 	}
 
 	return args, nil
 }
 
+// auditLog records a privileged operation performed for the pod in its
+// audit log.
+func (p *Pod) auditLog(kind, action string, fields map[string]string) error {
+	return audit.NewLogger(p.Root, p.UUID).Log(kind, action, fields)
+}
+
+// getDevices returns the host devices exposed to the apps, as requested in
+// the pod annotations. The devices must exist on the host.
+func (p *Pod) getDevices() ([]*device.Device, error) {
+	val, ok := p.Manifest.Annotations.Get(common.DevicesAnnotation)
+	if !ok {
+		return nil, nil
+	}
+	devices, err := device.ParseList(val)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range devices {
+		if err := d.CheckHost(); err != nil {
+			return nil, fmt.Errorf("cannot expose device %q: %v", d.HostPath, err)
+		}
+	}
+	return devices, nil
+}
+
+// getGPUs returns the NVIDIA GPUs exposed to the apps, as requested in the
+// pod annotations, or nil.
+func (p *Pod) getGPUs() (*gpu.Spec, error) {
+	val, ok := p.Manifest.Annotations.Get(common.GPUsAnnotation)
+	if !ok {
+		return nil, nil
+	}
+	return gpu.ParseSpec(val)
+}
+
+// getGPUDevices returns the device nodes of the GPUs exposed to the apps and
+// the files of their driver, found on the host.
+func (p *Pod) getGPUDevices() ([]*device.Device, []gpu.DriverFile, error) {
+	gpus, err := p.getGPUs()
+	if err != nil || gpus == nil {
+		return nil, nil, err
+	}
+	devices, err := gpu.Devices(gpus)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot expose the GPUs: %v", err)
+	}
+	files, err := gpu.DriverFiles()
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot expose the GPU driver: %v", err)
+	}
+	return devices, files, nil
+}
+
+// setGPUEnv sets the GPUs visible to an app and adds the driver bind-mounted
+// in its rootfs to its library and binary search paths.
+func setGPUEnv(env *types.Environment, gpus *gpu.Spec) {
+	env.Set(gpu.VisibleDevicesEnv, gpus.String())
+
+	ldPath := gpu.LibraryPath
+	if v, ok := env.Get("LD_LIBRARY_PATH"); ok && v != "" {
+		ldPath += ":" + v
+	}
+	env.Set("LD_LIBRARY_PATH", ldPath)
+
+	path, ok := env.Get("PATH")
+	if !ok {
+		path = defaultEnv["PATH"]
+	}
+	env.Set("PATH", path+":"+gpu.BinaryPath)
+}
+
+// getGPUPCIAddresses returns the PCI addresses of the GPUs passed through to
+// the guest of the kvm flavor.
+func (p *Pod) getGPUPCIAddresses() ([]string, error) {
+	gpus, err := p.getGPUs()
+	if err != nil || gpus == nil {
+		return nil, err
+	}
+	addrs, err := gpu.PCIAddresses(gpus)
+	if err != nil {
+		return nil, fmt.Errorf("cannot pass the GPUs through: %v", err)
+	}
+	return addrs, nil
+}
+
+// deviceAllowArgs returns the systemd-nspawn arguments adding the devices to
+// the device cgroup of the scope registered to machined.
+func deviceAllowArgs(devices []*device.Device) []string {
+	var args []string
+	for _, d := range devices {
+		args = append(args, fmt.Sprintf("--property=DeviceAllow=%s %s", d.HostPath, d.Perms))
+	}
+	return args
+}
+
 func (p *Pod) getFlavor() (flavor string, systemdVersion string, err error) {
 	flavor, err = os.Readlink(filepath.Join(common.Stage1RootfsPath(p.Root), "flavor"))
 	if err != nil {
@@ -609,7 +1007,21 @@ func (p *Pod) GetAppHashes() []types.Hash {
 }
 
 // GetMachineID returns the machine id string of the pod to be passed to
-// systemd-nspawn
+// systemd-nspawn: the name requested in the pod annotations or rkt-$UUID
 func (p *Pod) GetMachineID() string {
+	if name, ok := p.Manifest.Annotations.Get(common.MachineNameAnnotation); ok && name != "" {
+		return name
+	}
 	return "rkt-" + p.UUID.String()
 }
+
+// machinedRegisterDisabled returns whether the pod annotations disable the
+// registration of the pod to machined.
+func (p *Pod) machinedRegisterDisabled() bool {
+	val, ok := p.Manifest.Annotations.Get(common.MachinedRegisterAnnotation)
+	if !ok {
+		return false
+	}
+	register, err := strconv.ParseBool(val)
+	return err == nil && !register
+}
@@ -22,6 +22,8 @@ import (
 
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+	stage1lib "github.com/coreos/rkt/pkg/stage1"
 )
 
 const tstprefix = "pod-test"
@@ -150,7 +152,7 @@ func TestAppToNspawnArgsOverridesImageManifestReadOnly(t *testing.T) {
 		}
 		defer os.RemoveAll(tmpDir)
 
-		p := &Pod{Manifest: podManifest, Root: tmpDir}
+		p := &Pod{Pod: &stage1lib.Pod{Manifest: podManifest, Root: tmpDir}}
 		output, err := p.appToNspawnArgs(appManifest)
 		if err != nil {
 			t.Errorf("#%d: unexpected error: `%v`", i, err)
@@ -171,3 +173,41 @@ func hasBindROArg(output []string) bool {
 	}
 	return false
 }
+
+func TestGetMachineID(t *testing.T) {
+	uuid, err := types.NewUUID("6733c3a4-fa3a-4f2c-9c2f-a5ea7a2b29b2")
+	if err != nil {
+		t.Fatalf("error creating UUID: %v", err)
+	}
+
+	tests := []struct {
+		annotations types.Annotations
+		machineID   string
+		register    bool
+	}{
+		{nil, "rkt-6733c3a4-fa3a-4f2c-9c2f-a5ea7a2b29b2", true},
+		{
+			types.Annotations{{Name: common.MachineNameAnnotation, Value: "etcd"}},
+			"etcd",
+			true,
+		},
+		{
+			types.Annotations{{Name: common.MachinedRegisterAnnotation, Value: "false"}},
+			"rkt-6733c3a4-fa3a-4f2c-9c2f-a5ea7a2b29b2",
+			false,
+		},
+	}
+
+	for i, tt := range tests {
+		p := &Pod{Pod: &stage1lib.Pod{
+			UUID:     *uuid,
+			Manifest: &schema.PodManifest{Annotations: tt.annotations},
+		}}
+		if machineID := p.GetMachineID(); machineID != tt.machineID {
+			t.Errorf("#%d: got machine id %q, want %q", i, machineID, tt.machineID)
+		}
+		if register := !p.machinedRegisterDisabled(); register != tt.register {
+			t.Errorf("#%d: got registration %t, want %t", i, register, tt.register)
+		}
+	}
+}
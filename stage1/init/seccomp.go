@@ -0,0 +1,87 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/coreos/go-systemd/unit"
+	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/common/seccomp"
+	initcommon "github.com/coreos/rkt/stage1/init/common"
+)
+
+// appexecSyscalls are the system calls used by /appexec, and by the dynamic
+// loader before it, to redirect the output of an app to its log unit, enter
+// its rootfs and execute it. The filter of the service applies to them too,
+// so they are always allowed, and the profiles denying them are rejected.
+var appexecSyscalls = []string{
+	"access",
+	"arch_prctl",
+	"brk",
+	"chdir",
+	"chroot",
+	"close",
+	"dup2",
+	"dup3",
+	"execve",
+	"fstat",
+	"mmap",
+	"mprotect",
+	"munmap",
+	"open",
+	"openat",
+	"read",
+	"setgroups",
+	"setresgid",
+	"setresuid",
+	"stat",
+	"write",
+}
+
+// seccompOptions returns the options of the service unit of an app which
+// filter its system calls according to its seccomp profile, if any.
+func seccompOptions(ra *schema.RuntimeApp, im *schema.ImageManifest) ([]*unit.UnitOption, error) {
+	val, ok := initcommon.GetAppAnnotation(ra, im, common.SeccompProfileAnnotation)
+	if !ok {
+		return nil, nil
+	}
+
+	profile, err := seccomp.ParseProfile([]byte(val))
+	if err != nil {
+		return nil, err
+	}
+	filter, err := profile.Filter()
+	if err != nil {
+		return nil, err
+	}
+	if denied := filter.Denied(appexecSyscalls); len(denied) > 0 {
+		return nil, fmt.Errorf("the seccomp profile of %q denies the system calls %s, which are needed to start the app", ra.Name, strings.Join(denied, ", "))
+	}
+	if len(filter.Approximated) > 0 {
+		fmt.Fprintf(os.Stderr, "rkt: warning: the conditions on the arguments of the system calls %s in the seccomp profile of %q are not supported, they are allowed unconditionally\n", strings.Join(filter.Approximated, ", "), ra.Name)
+	}
+
+	var opts []*unit.UnitOption
+	for _, d := range filter.SystemdDirectives(appexecSyscalls) {
+		opts = append(opts, unit.NewUnitOption("Service", d[0], d[1]))
+	}
+	return opts, nil
+}
@@ -0,0 +1,125 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/coreos/go-systemd/unit"
+)
+
+// listenFdsStart is the first file descriptor passed with socket activation,
+// see sd_listen_fds(3)
+const listenFdsStart = 3
+
+// getInheritedSockets returns the options of the socket units listening on
+// the sockets passed to rkt by systemd, by app. The sockets are assigned to
+// the app whose name is their name in LISTEN_FDNAMES (see
+// FileDescriptorName= in systemd.socket(5)). The other sockets are left to
+// the systemd of the pod, which matches them with the socket-activated ports
+// of the apps.
+//
+// The file descriptors are left open on exec, so systemd-nspawn passes them
+// to the pod.
+func getInheritedSockets(apps []types.ACName) (map[types.ACName][]*unit.UnitOption, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	nfds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || nfds <= 0 {
+		return nil, nil
+	}
+	var names []string
+	if fdNames := os.Getenv("LISTEN_FDNAMES"); fdNames != "" {
+		names = strings.Split(fdNames, ":")
+	}
+
+	appNames := make(map[string]types.ACName)
+	for _, app := range apps {
+		appNames[app.String()] = app
+	}
+
+	sockets := make(map[types.ACName][]*unit.UnitOption)
+	for i := 0; i < nfds; i++ {
+		if i >= len(names) {
+			break
+		}
+		app, ok := appNames[names[i]]
+		if !ok {
+			continue
+		}
+
+		fd := listenFdsStart + i
+		opt, err := socketListenOption(fd)
+		if err != nil {
+			return nil, fmt.Errorf("cannot use socket %q (fd %d) for app %q: %v", names[i], fd, app, err)
+		}
+		log.Printf("passing socket %q (%s=%s) to app %q", names[i], opt.Name, opt.Value, app)
+		sockets[app] = append(sockets[app], opt)
+	}
+
+	return sockets, nil
+}
+
+// socketListenOption returns the option of a socket unit listening on the
+// address of the socket fd, so that systemd reuses the socket.
+func socketListenOption(fd int) (*unit.UnitOption, error) {
+	sotype, err := syscall.GetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_TYPE)
+	if err != nil {
+		return nil, fmt.Errorf("not a socket: %v", err)
+	}
+	var directive string
+	switch sotype {
+	case syscall.SOCK_STREAM:
+		directive = "ListenStream"
+	case syscall.SOCK_DGRAM:
+		directive = "ListenDatagram"
+	case syscall.SOCK_SEQPACKET:
+		directive = "ListenSequentialPacket"
+	default:
+		return nil, fmt.Errorf("unsupported socket type %d", sotype)
+	}
+
+	sa, err := syscall.Getsockname(fd)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get the socket address: %v", err)
+	}
+	var address string
+	switch sa := sa.(type) {
+	case *syscall.SockaddrInet4:
+		address = net.JoinHostPort(net.IP(sa.Addr[:]).String(), strconv.Itoa(sa.Port))
+	case *syscall.SockaddrInet6:
+		address = net.JoinHostPort(net.IP(sa.Addr[:]).String(), strconv.Itoa(sa.Port))
+	case *syscall.SockaddrUnix:
+		if sa.Name == "" {
+			return nil, fmt.Errorf("unbound unix socket")
+		}
+		address = sa.Name
+	default:
+		return nil, fmt.Errorf("unsupported socket address family")
+	}
+
+	return unit.NewUnitOption("Socket", directive, address), nil
+}
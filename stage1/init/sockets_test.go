@@ -0,0 +1,87 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSocketListenOption(t *testing.T) {
+	dir, err := ioutil.TempDir("", tstprefix)
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tcp, err := net.ListenTCP("tcp4", &net.TCPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	defer tcp.Close()
+	udp, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	defer udp.Close()
+	socketPath := filepath.Join(dir, "sock")
+	unix, err := net.ListenUnix("unix", &net.UnixAddr{Name: socketPath, Net: "unix"})
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	defer unix.Close()
+
+	tests := []struct {
+		socket interface {
+			File() (*os.File, error)
+		}
+		directive string
+		address   string
+	}{
+		{tcp, "ListenStream", tcp.Addr().String()},
+		{udp, "ListenDatagram", udp.LocalAddr().String()},
+		{unix, "ListenStream", socketPath},
+	}
+
+	for i, tt := range tests {
+		f, err := tt.socket.File()
+		if err != nil {
+			t.Fatalf("#%d: error getting the socket file: %v", i, err)
+		}
+		opt, err := socketListenOption(int(f.Fd()))
+		f.Close()
+		if err != nil {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+			continue
+		}
+		if opt.Name != tt.directive || opt.Value != tt.address {
+			t.Errorf("#%d: got %s=%s, want %s=%s", i, opt.Name, opt.Value, tt.directive, tt.address)
+		}
+	}
+
+	f, err := ioutil.TempFile(dir, "file")
+	if err != nil {
+		t.Fatalf("error creating file: %v", err)
+	}
+	defer f.Close()
+	if _, err := socketListenOption(int(f.Fd())); err == nil {
+		t.Errorf("expected an error for a regular file")
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/coreos/go-systemd/unit"
+	"github.com/coreos/rkt/common"
+)
+
+const (
+	podTimeoutTimerUnit   = "pod-timeout.timer"
+	podTimeoutServiceUnit = "pod-timeout.service"
+	// Path to the file marking the pod as timed out in stage1, read by
+	// rkt status
+	timedOutPath = "/rkt/timed-out"
+)
+
+// getPodTimeout returns how long the pod may run, zero if it is not
+// limited.
+func (p *Pod) getPodTimeout() (time.Duration, error) {
+	val, ok := p.Manifest.Annotations.Get(common.TimeoutAnnotation)
+	if !ok {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid timeout %q", val)
+	}
+	return d, nil
+}
+
+// writePodTimeoutUnits writes the timer stopping the apps of the pod once
+// its timeout is exceeded, and pulls it in by the default target. The apps
+// are stopped like by systemctl stop: they get SIGTERM, and SIGKILL if they
+// still run after their stop timeout. The pod then exits as usual once all
+// its apps are stopped.
+func (p *Pod) writePodTimeoutUnits() error {
+	timeout, err := p.getPodTimeout()
+	if err != nil || timeout == 0 {
+		return err
+	}
+
+	var services []string
+	for _, ra := range p.Manifest.Apps {
+		services = append(services, ServiceUnitName(ra.Name))
+	}
+	serviceOpts := []*unit.UnitOption{
+		unit.NewUnitOption("Unit", "Description", "Stop the apps of the timed out pod"),
+		unit.NewUnitOption("Unit", "DefaultDependencies", "false"),
+		unit.NewUnitOption("Service", "Type", "oneshot"),
+		unit.NewUnitOption("Service", "ExecStart", fmt.Sprintf("/usr/bin/bash -c \"echo %s > %s\"", timeout, timedOutPath)),
+		unit.NewUnitOption("Service", "ExecStart", fmt.Sprintf("/usr/bin/systemctl stop --no-block %s", strings.Join(services, " "))),
+	}
+	if err := p.writeUnit(podTimeoutServiceUnit, serviceOpts); err != nil {
+		return err
+	}
+
+	timerOpts := []*unit.UnitOption{
+		unit.NewUnitOption("Unit", "Description", fmt.Sprintf("Pod timeout of %s", timeout)),
+		unit.NewUnitOption("Unit", "DefaultDependencies", "false"),
+		unit.NewUnitOption("Timer", "OnActiveSec", fmt.Sprintf("%dms", timeout/time.Millisecond)),
+		unit.NewUnitOption("Timer", "AccuracySec", "1s"),
+	}
+	if err := p.writeUnit(podTimeoutTimerUnit, timerOpts); err != nil {
+		return err
+	}
+
+	wantPath := filepath.Join(common.Stage1RootfsPath(p.Root), defaultWantsDir, podTimeoutTimerUnit)
+	if err := os.MkdirAll(filepath.Dir(wantPath), 0755); err != nil {
+		return err
+	}
+	return os.Symlink(path.Join("..", podTimeoutTimerUnit), wantPath)
+}
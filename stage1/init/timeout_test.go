@@ -0,0 +1,102 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+	stage1lib "github.com/coreos/rkt/pkg/stage1"
+)
+
+func TestWritePodTimeoutUnits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rkt-timeout-test-")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		timeout string
+		// expected OnActiveSec of the timer, if any
+		onActive string
+		err      bool
+	}{
+		{"", "", false},
+		{"2h", "7200000ms", false},
+		{"1m30s", "90000ms", false},
+		{"0", "", true},
+		{"-1h", "", true},
+		{"2 hours", "", true},
+	}
+
+	for i, tt := range tests {
+		root := filepath.Join(dir, strconv.Itoa(i))
+		unitsPath := filepath.Join(common.Stage1RootfsPath(root), unitsDir)
+		if err := os.MkdirAll(unitsPath, 0755); err != nil {
+			t.Fatalf("error creating %q: %v", unitsPath, err)
+		}
+		var annotations types.Annotations
+		if tt.timeout != "" {
+			annotations.Set(common.TimeoutAnnotation, tt.timeout)
+		}
+		p := &Pod{Pod: &stage1lib.Pod{
+			Root: root,
+			Manifest: &schema.PodManifest{
+				Apps:        schema.AppList{{Name: "job"}, {Name: "logger"}},
+				Annotations: annotations,
+			},
+		}}
+
+		err := p.writePodTimeoutUnits()
+		if gotErr := err != nil; gotErr != tt.err {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.err)
+			continue
+		}
+
+		timer, err := ioutil.ReadFile(filepath.Join(common.Stage1RootfsPath(root), defaultWantsDir, podTimeoutTimerUnit))
+		if tt.onActive == "" {
+			if err == nil {
+				t.Errorf("#%d: unexpected %s", i, podTimeoutTimerUnit)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: error reading %s: %v", i, podTimeoutTimerUnit, err)
+			continue
+		}
+		if want := "OnActiveSec=" + tt.onActive + "\n"; !strings.Contains(string(timer), want) {
+			t.Errorf("#%d: got timer %q, want it to contain %q", i, timer, want)
+		}
+
+		service, err := ioutil.ReadFile(filepath.Join(unitsPath, podTimeoutServiceUnit))
+		if err != nil {
+			t.Errorf("#%d: error reading %s: %v", i, podTimeoutServiceUnit, err)
+			continue
+		}
+		if want := "ExecStart=/usr/bin/systemctl stop --no-block job.service logger.service\n"; !strings.Contains(string(service), want) {
+			t.Errorf("#%d: got service %q, want it to contain %q", i, service, want)
+		}
+	}
+}
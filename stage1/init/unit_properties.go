@@ -0,0 +1,136 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/coreos/go-systemd/unit"
+	"github.com/coreos/rkt/common"
+)
+
+// reservedUnitProperties are the directives of the service unit of an app
+// which rkt needs to run it in its rootfs, and which cannot be passed
+// through.
+var reservedUnitProperties = map[string]bool{
+	"ExecStart":        true,
+	"ExecStartPre":     true,
+	"ExecStartPost":    true,
+	"ExecReload":       true,
+	"ExecStop":         true,
+	"ExecStopPost":     true,
+	"User":             true,
+	"Group":            true,
+	"RootDirectory":    true,
+	"WorkingDirectory": true,
+	"EnvironmentFile":  true,
+}
+
+// allowedUnitProperties are the directives of the service unit of an app
+// which can be passed through, by section. They only tune how the app is
+// scheduled, restarted and stopped: the other directives, which systemd
+// keeps adding, could isolate the app or grant it privileges, so they are
+// rejected rather than listed.
+var allowedUnitProperties = map[string]map[string]bool{
+	"Unit": {
+		"Description":        true,
+		"Documentation":      true,
+		"StartLimitBurst":    true,
+		"StartLimitInterval": true,
+	},
+	"Service": {
+		"Environment":              true,
+		"TimeoutStartSec":          true,
+		"TimeoutStopSec":           true,
+		"TimeoutSec":               true,
+		"WatchdogSec":              true,
+		"SuccessExitStatus":        true,
+		"KillMode":                 true,
+		"KillSignal":               true,
+		"SendSIGKILL":              true,
+		"SendSIGHUP":               true,
+		"Nice":                     true,
+		"CPUSchedulingPolicy":      true,
+		"CPUSchedulingPriority":    true,
+		"CPUSchedulingResetOnFork": true,
+		"IOSchedulingClass":        true,
+		"IOSchedulingPriority":     true,
+		"SyslogIdentifier":         true,
+		"SyslogFacility":           true,
+		"SyslogLevel":              true,
+		"SyslogLevelPrefix":        true,
+	},
+}
+
+// allowedUnitPropertyPrefixes are the families of directives of the
+// [Service] section which can be passed through, such as the resource
+// limits and the restart policy.
+var allowedUnitPropertyPrefixes = []string{"Limit", "Restart"}
+
+func isAllowedUnitProperty(opt *unit.UnitOption) bool {
+	if allowedUnitProperties[opt.Section][opt.Name] {
+		return true
+	}
+	if opt.Section != "Service" {
+		return false
+	}
+	for _, p := range allowedUnitPropertyPrefixes {
+		if strings.HasPrefix(opt.Name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// unitPropertiesOptions returns the options of the service unit of an app
+// passed through by its UnitPropertiesAnnotation. Only the annotation in
+// the pod manifest is used, so an image cannot grant itself privileges.
+func unitPropertiesOptions(ra *schema.RuntimeApp) ([]*unit.UnitOption, error) {
+	val, ok := ra.Annotations.Get(common.UnitPropertiesAnnotation)
+	if !ok {
+		return nil, nil
+	}
+	return parseUnitProperties(val)
+}
+
+// parseUnitProperties parses systemd unit directives, in the [Service]
+// section unless a section header is given, and checks that they can be
+// passed through.
+func parseUnitProperties(val string) ([]*unit.UnitOption, error) {
+	if !strings.HasPrefix(strings.TrimSpace(val), "[") {
+		val = "[Service]\n" + val
+	}
+	opts, err := unit.Deserialize(strings.NewReader(val))
+	if err != nil {
+		return nil, fmt.Errorf("invalid unit properties: %v", err)
+	}
+
+	for _, opt := range opts {
+		if opt.Section != "Unit" && opt.Section != "Service" {
+			return nil, fmt.Errorf("invalid unit property %q: only the [Unit] and [Service] sections can be set", opt.Name)
+		}
+		if opt.Section == "Service" && reservedUnitProperties[opt.Name] {
+			return nil, fmt.Errorf("unit property %q is set by rkt and cannot be overridden", opt.Name)
+		}
+		if !isAllowedUnitProperty(opt) {
+			return nil, fmt.Errorf("unit property %q cannot be set, use the isolators and the annotations of rkt instead", opt.Name)
+		}
+	}
+	return opts, nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/coreos/go-systemd/unit"
+	"github.com/coreos/rkt/common"
+)
+
+func TestUnitPropertiesOptions(t *testing.T) {
+	tests := []struct {
+		value string
+		opts  []*unit.UnitOption
+		err   bool
+	}{
+		{"", nil, false},
+		{
+			"IOSchedulingClass=idle\nWatchdogSec=30",
+			[]*unit.UnitOption{
+				unit.NewUnitOption("Service", "IOSchedulingClass", "idle"),
+				unit.NewUnitOption("Service", "WatchdogSec", "30"),
+			},
+			false,
+		},
+		{
+			"[Unit]\nStartLimitBurst=3\n[Service]\nCPUSchedulingPolicy=batch\n",
+			[]*unit.UnitOption{
+				unit.NewUnitOption("Unit", "StartLimitBurst", "3"),
+				unit.NewUnitOption("Service", "CPUSchedulingPolicy", "batch"),
+			},
+			false,
+		},
+		{"ExecStart=/bin/sh", nil, true},
+		{"User=root", nil, true},
+		{"ReadOnlyDirectories=", nil, true},
+		{"CapabilityBoundingSet=CAP_SYS_ADMIN", nil, true},
+		{"NoNewPrivileges=no", nil, true},
+		{"SystemCallFilter=", nil, true},
+		{"AmbientCapabilities=CAP_SYS_ADMIN", nil, true},
+		{"PrivateDevices=no", nil, true},
+		{"[Unit]\nStartLimitAction=reboot-force", nil, true},
+		{
+			"Environment=DEBUG=1\nLimitNOFILE=4096\nTimeoutStopSec=30\nRestartSec=5",
+			[]*unit.UnitOption{
+				unit.NewUnitOption("Service", "Environment", "DEBUG=1"),
+				unit.NewUnitOption("Service", "LimitNOFILE", "4096"),
+				unit.NewUnitOption("Service", "TimeoutStopSec", "30"),
+				unit.NewUnitOption("Service", "RestartSec", "5"),
+			},
+			false,
+		},
+		{"[Install]\nWantedBy=default.target", nil, true},
+		{"[Service", nil, true},
+	}
+
+	for i, tt := range tests {
+		ra := &schema.RuntimeApp{Name: "app"}
+		if tt.value != "" {
+			ra.Annotations = types.Annotations{{Name: common.UnitPropertiesAnnotation, Value: tt.value}}
+		}
+		opts, err := unitPropertiesOptions(ra)
+		if gotErr := err != nil; gotErr != tt.err {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.err)
+			continue
+		}
+		if !unit.AllMatch(opts, tt.opts) {
+			t.Errorf("#%d: got options %v, want %v", i, opts, tt.opts)
+		}
+	}
+}
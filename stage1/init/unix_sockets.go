@@ -0,0 +1,227 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/coreos/go-systemd/unit"
+	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/common/unixsocket"
+)
+
+const (
+	// unixSocketsDir is the directory of stage1 containing the path
+	// sockets of the pod
+	unixSocketsDir = "/rkt/unix-sockets"
+	// appUnixSocketsDir is the directory of stage1 containing, for each
+	// app, a directory where the path sockets it uses are bind mounted,
+	// itself bind mounted in the app
+	appUnixSocketsDir = "/rkt/app-unix-sockets"
+)
+
+// getUnixSockets returns the unix sockets shared by the apps of the pod, as
+// declared by their unix-sockets isolators.
+func (p *Pod) getUnixSockets() ([]*unixsocket.PodSocket, error) {
+	apps := make(map[types.ACName]*unixsocket.UnixSockets)
+	for _, ra := range p.Manifest.Apps {
+		if ra.App == nil {
+			continue
+		}
+		for _, i := range ra.App.Isolators {
+			if u, ok := i.Value().(*unixsocket.UnixSockets); ok {
+				apps[ra.Name] = u
+			}
+		}
+	}
+	if len(apps) == 0 {
+		return nil, nil
+	}
+	return unixsocket.PodSockets(apps)
+}
+
+// unixSocketUnitName returns the name of the socket unit listening on s.
+func unixSocketUnitName(s *unixsocket.PodSocket) string {
+	return "unix-socket-" + s.Name.String() + ".socket"
+}
+
+// writeUnixSocketUnits writes the socket units listening on the unix sockets
+// of the pod, which activate the apps listening on them.
+func (p *Pod) writeUnixSocketUnits() error {
+	sockets, err := p.getUnixSockets()
+	if err != nil {
+		return err
+	}
+	if len(sockets) == 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Join(common.Stage1RootfsPath(p.Root), unixSocketsDir), 0755); err != nil {
+		return fmt.Errorf("failed to create the unix sockets directory: %v", err)
+	}
+	for _, s := range sockets {
+		address := s.AppAddress(&p.UUID)
+		if s.Kind == unixsocket.KindPath {
+			address = filepath.Join(unixSocketsDir, s.Name.String())
+		}
+		name := unixSocketUnitName(s)
+		opts := []*unit.UnitOption{
+			unit.NewUnitOption("Unit", "Description", fmt.Sprintf("Unix socket %s of the pod", s.Name)),
+			unit.NewUnitOption("Unit", "DefaultDependencies", "false"),
+			unit.NewUnitOption("Socket", "ListenStream", address),
+			unit.NewUnitOption("Socket", "FileDescriptorName", s.Name.String()),
+			// the apps connecting may run as any user
+			unit.NewUnitOption("Socket", "SocketMode", "0666"),
+			unit.NewUnitOption("Socket", "Service", ServiceUnitName(s.Listener)),
+		}
+		if err := p.writeUnit(name, opts); err != nil {
+			return err
+		}
+		if err := os.Symlink(filepath.Join("..", name), filepath.Join(common.Stage1RootfsPath(p.Root), socketsWantsDir, name)); err != nil {
+			return fmt.Errorf("failed to link socket want: %v", err)
+		}
+	}
+	return nil
+}
+
+// appUnixSockets returns the unix sockets of the pod the app listens on or
+// connects to.
+func (p *Pod) appUnixSockets(appName types.ACName) ([]*unixsocket.PodSocket, error) {
+	sockets, err := p.getUnixSockets()
+	if err != nil {
+		return nil, err
+	}
+	var appSockets []*unixsocket.PodSocket
+	for _, s := range sockets {
+		uses := s.Listener == appName
+		for _, c := range s.Connectors {
+			uses = uses || c == appName
+		}
+		if uses {
+			appSockets = append(appSockets, s)
+		}
+	}
+	return appSockets, nil
+}
+
+// setUnixSocketEnv sets the environment variables giving the addresses of
+// the unix sockets it uses to an app.
+func (p *Pod) setUnixSocketEnv(appName types.ACName, env *types.Environment) error {
+	sockets, err := p.appUnixSockets(appName)
+	if err != nil {
+		return err
+	}
+	for _, s := range sockets {
+		env.Set(s.EnvName(), s.AppAddress(&p.UUID))
+	}
+	return nil
+}
+
+// appUnixSocketOptions writes the units bind mounting the path sockets an app
+// uses in its rootfs, over the mounts done by prepare-app, and returns the
+// options of the service unit of the app depending on the sockets. The app
+// only sees these sockets: each one is bind mounted on a file of a
+// directory of its own in stage1, which is bind mounted in the app.
+func (p *Pod) appUnixSocketOptions(ra *schema.RuntimeApp) ([]*unit.UnitOption, error) {
+	sockets, err := p.appUnixSockets(ra.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []*unit.UnitOption
+	var socketMountUnits []string
+	dir := filepath.Join(appUnixSocketsDir, ra.Name.String())
+	for _, s := range sockets {
+		// the socket unit activates the listening app, and must listen
+		// before the connecting apps start
+		socketUnit := unixSocketUnitName(s)
+		opts = append(opts, unit.NewUnitOption("Unit", "Requires", socketUnit))
+		if s.Listener != ra.Name {
+			opts = append(opts, unit.NewUnitOption("Unit", "After", socketUnit))
+		}
+		if s.Kind != unixsocket.KindPath {
+			continue
+		}
+
+		what := filepath.Join(unixSocketsDir, s.Name.String())
+		where := filepath.Join(dir, s.Name.String())
+		// a socket can only be bind mounted on a file
+		if err := createMountPointFile(filepath.Join(common.Stage1RootfsPath(p.Root), where)); err != nil {
+			return nil, fmt.Errorf("failed to create the mount point of socket %q: %v", s.Name, err)
+		}
+		mountUnit := unit.UnitNamePathEscape(where + ".mount")
+		mountOpts := []*unit.UnitOption{
+			unit.NewUnitOption("Unit", "Description", fmt.Sprintf("Bind mount of %s on %s", what, where)),
+			unit.NewUnitOption("Unit", "DefaultDependencies", "false"),
+			unit.NewUnitOption("Unit", "Requires", socketUnit),
+			unit.NewUnitOption("Unit", "After", socketUnit),
+			unit.NewUnitOption("Mount", "What", what),
+			unit.NewUnitOption("Mount", "Where", where),
+			unit.NewUnitOption("Mount", "Type", "bind"),
+			unit.NewUnitOption("Mount", "Options", "bind"),
+		}
+		if err := p.writeUnit(mountUnit, mountOpts); err != nil {
+			return nil, err
+		}
+		socketMountUnits = append(socketMountUnits, mountUnit)
+	}
+	if len(socketMountUnits) == 0 {
+		return opts, nil
+	}
+
+	where := filepath.Join("/", common.RelAppRootfsPath(ra.Name), unixsocket.AppDir)
+	mountUnit := unit.UnitNamePathEscape(where + ".mount")
+	mountOpts := []*unit.UnitOption{
+		unit.NewUnitOption("Unit", "Description", fmt.Sprintf("Bind mount of %s on %s", dir, where)),
+		unit.NewUnitOption("Unit", "DefaultDependencies", "false"),
+		unit.NewUnitOption("Unit", "After", InstantiatedPrepareAppUnitName(ra.Name)),
+	}
+	for _, u := range socketMountUnits {
+		mountOpts = append(mountOpts, unit.NewUnitOption("Unit", "Requires", u))
+		mountOpts = append(mountOpts, unit.NewUnitOption("Unit", "After", u))
+	}
+	mountOpts = append(mountOpts,
+		unit.NewUnitOption("Mount", "What", dir),
+		unit.NewUnitOption("Mount", "Where", where),
+		unit.NewUnitOption("Mount", "Type", "bind"),
+		// the sockets are mounted in the directory
+		unit.NewUnitOption("Mount", "Options", "rbind"),
+	)
+	if err := p.writeUnit(mountUnit, mountOpts); err != nil {
+		return nil, err
+	}
+	opts = append(opts, unit.NewUnitOption("Unit", "Requires", mountUnit))
+	opts = append(opts, unit.NewUnitOption("Unit", "After", mountUnit))
+	return opts, nil
+}
+
+// createMountPointFile creates an empty file at path, and its parent
+// directories, to bind mount a file on.
+func createMountPointFile(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,123 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/coreos/go-systemd/unit"
+	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/common/unixsocket"
+	stage1lib "github.com/coreos/rkt/pkg/stage1"
+)
+
+func TestAppUnixSocketOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rkt-unix-sockets-test-")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	stage1Rootfs := common.Stage1RootfsPath(dir)
+	if err := os.MkdirAll(filepath.Join(stage1Rootfs, unitsDir), 0755); err != nil {
+		t.Fatalf("error creating the units directory: %v", err)
+	}
+
+	isolators := map[types.ACName]string{
+		"web":   `{"sockets": [{"name": "backend", "role": "listen"}, {"name": "admin", "role": "listen"}]}`,
+		"proxy": `{"sockets": [{"name": "backend", "role": "connect"}, {"name": "metrics", "role": "connect", "kind": "abstract"}]}`,
+		"stats": `{"sockets": [{"name": "metrics", "role": "listen", "kind": "abstract"}]}`,
+	}
+	pm := &schema.PodManifest{}
+	for _, name := range []types.ACName{"web", "proxy", "stats"} {
+		var iso types.Isolator
+		if err := iso.UnmarshalJSON([]byte(`{"name": "` + unixsocket.IsolatorName + `", "value": ` + isolators[name] + `}`)); err != nil {
+			t.Fatalf("invalid isolator: %v", err)
+		}
+		pm.Apps = append(pm.Apps, schema.RuntimeApp{
+			Name: name,
+			App:  &types.App{Isolators: types.Isolators{iso}},
+		})
+	}
+	p := &Pod{Pod: &stage1lib.Pod{Root: dir, Manifest: pm}}
+
+	ra := pm.Apps.Get("proxy")
+	opts, err := p.appUnixSocketOptions(ra)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the proxy only sees the backend socket, not the admin one
+	socketMount := "rkt-app\\x2dunix\\x2dsockets-proxy-backend.mount"
+	dirMount := unit.UnitNamePathEscape(filepath.Join("/", common.RelAppRootfsPath("proxy"), unixsocket.AppDir) + ".mount")
+	expected := []*unit.UnitOption{
+		unit.NewUnitOption("Unit", "Requires", "unix-socket-backend.socket"),
+		unit.NewUnitOption("Unit", "After", "unix-socket-backend.socket"),
+		unit.NewUnitOption("Unit", "Requires", "unix-socket-metrics.socket"),
+		unit.NewUnitOption("Unit", "After", "unix-socket-metrics.socket"),
+		unit.NewUnitOption("Unit", "Requires", dirMount),
+		unit.NewUnitOption("Unit", "After", dirMount),
+	}
+	if !reflect.DeepEqual(opts, expected) {
+		t.Errorf("got options %v, want %v", opts, expected)
+	}
+
+	if fi, err := os.Stat(filepath.Join(stage1Rootfs, appUnixSocketsDir, "proxy", "backend")); err != nil || !fi.Mode().IsRegular() {
+		t.Errorf("expected a mount point file for the backend socket: %v", err)
+	}
+	entries, err := ioutil.ReadDir(filepath.Join(stage1Rootfs, appUnixSocketsDir, "proxy"))
+	if err != nil || len(entries) != 1 {
+		t.Errorf("expected only the backend socket in the directory of the proxy: %v %v", entries, err)
+	}
+
+	f, err := os.Open(filepath.Join(stage1Rootfs, unitsDir, dirMount))
+	if err != nil {
+		t.Fatalf("cannot open the directory mount unit: %v", err)
+	}
+	defer f.Close()
+	dirOpts, err := unit.Deserialize(f)
+	if err != nil {
+		t.Fatalf("cannot parse the directory mount unit: %v", err)
+	}
+	for _, opt := range []*unit.UnitOption{
+		unit.NewUnitOption("Unit", "Requires", socketMount),
+		unit.NewUnitOption("Mount", "What", filepath.Join(appUnixSocketsDir, "proxy")),
+		unit.NewUnitOption("Mount", "Options", "rbind"),
+	} {
+		found := false
+		for _, o := range dirOpts {
+			found = found || reflect.DeepEqual(o, opt)
+		}
+		if !found {
+			t.Errorf("option %v not found in the directory mount unit", opt)
+		}
+	}
+
+	// no path socket, no mount
+	opts, err = p.appUnixSocketOptions(pm.Apps.Get("stats"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(opts) != 1 {
+		t.Errorf("got options %v, want only the requirement of the socket", opts)
+	}
+}
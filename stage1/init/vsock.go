@@ -0,0 +1,69 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/coreos/go-systemd/unit"
+	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/pkg/vsock"
+	"github.com/coreos/rkt/stage1/init/kvm"
+)
+
+const (
+	vsockEnterUnit    = "vsock-enter.service"
+	vsockMetadataUnit = "vsock-metadata.service"
+)
+
+// writeVsockUnits writes the units of the guest forwarding the vsock
+// connections of the host to its ssh server, used to enter the pod, and,
+// if mds is true, the connections of the apps to the metadata service of
+// the host.
+func (p *Pod) writeVsockUnits(mds bool) error {
+	units := map[string][]*unit.UnitOption{
+		vsockEnterUnit: {
+			unit.NewUnitOption("Unit", "Description", "Forward the vsock connections of the host to the ssh server"),
+			unit.NewUnitOption("Unit", "DefaultDependencies", "no"),
+			unit.NewUnitOption("Service", "ExecStart", fmt.Sprintf("%s vsock:%d tcp:127.0.0.1:%d", kvm.VsockProxyBin, kvm.VsockEnterPort, kvm.VsockEnterPort)),
+		},
+	}
+	if mds {
+		opts := []*unit.UnitOption{
+			unit.NewUnitOption("Unit", "Description", "Forward the connections to the metadata service over vsock"),
+			unit.NewUnitOption("Unit", "DefaultDependencies", "no"),
+			unit.NewUnitOption("Service", "ExecStart", fmt.Sprintf("%s tcp:%s:%d vsock:%d:%d", kvm.VsockProxyBin, localhostIP, common.MetadataServicePort, vsock.CIDHost, common.MetadataServicePort)),
+		}
+		for _, ra := range p.Manifest.Apps {
+			opts = append(opts, unit.NewUnitOption("Unit", "Before", ServiceUnitName(ra.Name)))
+		}
+		units[vsockMetadataUnit] = opts
+	}
+
+	for name, opts := range units {
+		if err := p.writeUnit(name, opts); err != nil {
+			return err
+		}
+		if err := os.Symlink(path.Join("..", name), filepath.Join(common.Stage1RootfsPath(p.Root), defaultWantsDir, name)); err != nil {
+			return fmt.Errorf("failed to link service want: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// dialTimeout is how long connecting to a log server may take
+	dialTimeout = 5 * time.Second
+	// writeTimeout is how long sending a line to a log server may take
+	// before the connection is dropped
+	writeTimeout = 5 * time.Second
+	// redialInterval is the time between two attempts to connect to a
+	// log server; the lines sent in between are dropped
+	redialInterval = 5 * time.Second
+	// queueSize is the number of lines waiting to be sent to a log
+	// server; the lines written while the queue is full are dropped
+	queueSize = 1024
+	// flushTimeout is how long the queued lines are sent when the
+	// connection is closed
+	flushTimeout = 5 * time.Second
+)
+
+// serverConn is a connection to a log server, reconnected when a write
+// fails. The lines are queued and sent by a goroutine, so a slow or
+// unreachable server never blocks the output of the app: when the queue is
+// full, the lines are dropped and counted.
+type serverConn struct {
+	network string
+	address string
+
+	queue   chan []byte
+	done    chan struct{}
+	dropped uint64
+
+	mu      sync.Mutex
+	started bool
+	closed  bool
+
+	// only used by the sending goroutine once started
+	conn     net.Conn
+	lastDial time.Time
+}
+
+func newServerConn(network, address string) *serverConn {
+	return &serverConn{
+		network: network,
+		address: address,
+		queue:   make(chan []byte, queueSize),
+		done:    make(chan struct{}),
+	}
+}
+
+// Open connects to the server and starts sending the queued lines. The
+// connection is retried later if it fails.
+func (c *serverConn) Open() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err := c.dial()
+	c.started = true
+	go c.send()
+	return err
+}
+
+// write queues b to be sent to the server, or drops it if the queue is
+// full.
+func (c *serverConn) write(b []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		atomic.AddUint64(&c.dropped, 1)
+		return nil
+	}
+	select {
+	case c.queue <- b:
+	default:
+		atomic.AddUint64(&c.dropped, 1)
+	}
+	return nil
+}
+
+// send sends the queued lines to the server, connecting to it again if it
+// was disconnected and the last attempt is old enough.
+func (c *serverConn) send() {
+	defer close(c.done)
+
+	for b := range c.queue {
+		if c.conn == nil {
+			if time.Since(c.lastDial) < redialInterval {
+				atomic.AddUint64(&c.dropped, 1)
+				continue
+			}
+			if err := c.dial(); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to connect to the %s log driver: %v\n", driver, err)
+				atomic.AddUint64(&c.dropped, 1)
+				continue
+			}
+		}
+		c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if _, err := c.conn.Write(b); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to send the output to the %s log driver: %v\n", driver, err)
+			c.conn.Close()
+			c.conn = nil
+			atomic.AddUint64(&c.dropped, 1)
+		}
+	}
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
+
+// Close sends the queued lines, for at most flushTimeout, and disconnects
+// from the server. It reports the number of dropped lines.
+func (c *serverConn) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.queue)
+	started := c.started
+	c.mu.Unlock()
+
+	if started {
+		select {
+		case <-c.done:
+		case <-time.After(flushTimeout):
+		}
+	}
+	if n := atomic.LoadUint64(&c.dropped); n > 0 {
+		fmt.Fprintf(os.Stderr, "%d lines of the output were not sent to the %s log driver\n", n, driver)
+	}
+	return nil
+}
+
+func (c *serverConn) dial() error {
+	c.lastDial = time.Now()
+	conn, err := net.DialTimeout(c.network, c.address, dialTimeout)
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	return nil
+}
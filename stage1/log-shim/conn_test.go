@@ -0,0 +1,82 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"bufio"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestServerConnSend(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	defer l.Close()
+
+	c := newServerConn("tcp", l.Addr().String())
+	if err := c.Open(); err != nil {
+		t.Fatalf("error connecting: %v", err)
+	}
+	server, err := l.Accept()
+	if err != nil {
+		t.Fatalf("error accepting: %v", err)
+	}
+	defer server.Close()
+
+	for _, line := range []string{"first\n", "second\n"} {
+		if err := c.write([]byte(line)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	c.Close()
+
+	server.SetReadDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(server)
+	for _, want := range []string{"first\n", "second\n"} {
+		got, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("error reading: %v", err)
+		}
+		if got != want {
+			t.Errorf("got line %q, want %q", got, want)
+		}
+	}
+}
+
+func TestServerConnQueueFull(t *testing.T) {
+	// not opened, nothing is sent
+	c := newServerConn("tcp", "127.0.0.1:0")
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < queueSize+10; i++ {
+			c.write([]byte("line\n"))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("writing to a full queue blocks")
+	}
+	if n := atomic.LoadUint64(&c.dropped); n != 10 {
+		t.Errorf("got %d dropped lines, want 10", n)
+	}
+}
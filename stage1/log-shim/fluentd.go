@@ -0,0 +1,136 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"time"
+)
+
+// fluentdWriter sends the lines to a fluentd server with the message mode of
+// its forward protocol, [TAG, TIME, RECORD] encoded with MessagePack. The
+// tag is rkt.IDENTIFIER, and the record has the line as log, the stream as
+// source and the fields with lowercase names.
+type fluentdWriter struct {
+	*serverConn
+	tag    string
+	fields fieldList
+}
+
+func newFluentdWriter(address, identifier string, fields fieldList) *fluentdWriter {
+	tag := "rkt"
+	if identifier != "" {
+		tag += "." + identifier
+	}
+	return &fluentdWriter{
+		serverConn: newServerConn("tcp", address),
+		tag:        tag,
+		fields:     fields,
+	}
+}
+
+func (fw *fluentdWriter) WriteLine(t time.Time, stream, line string) error {
+	return fw.write(fw.message(t, stream, line))
+}
+
+// message returns the forward protocol message of line, read from stream at
+// t.
+func (fw *fluentdWriter) message(t time.Time, stream, line string) []byte {
+	names, values := fw.fields.split()
+
+	var b bytes.Buffer
+	writeArrayHeader(&b, 3)
+	writeString(&b, fw.tag)
+	writeUint(&b, uint64(t.Unix()))
+	writeMapHeader(&b, 2+len(names))
+	writeString(&b, "log")
+	writeString(&b, line)
+	writeString(&b, "source")
+	writeString(&b, stream)
+	for i := range names {
+		writeString(&b, strings.ToLower(names[i]))
+		writeString(&b, values[i])
+	}
+	return b.Bytes()
+}
+
+// The MessagePack encoding of the types used by the messages.
+
+func writeArrayHeader(b *bytes.Buffer, n int) {
+	switch {
+	case n < 16:
+		b.WriteByte(0x90 | byte(n))
+	case n < 1<<16:
+		b.WriteByte(0xdc)
+		binary.Write(b, binary.BigEndian, uint16(n))
+	default:
+		b.WriteByte(0xdd)
+		binary.Write(b, binary.BigEndian, uint32(n))
+	}
+}
+
+func writeMapHeader(b *bytes.Buffer, n int) {
+	switch {
+	case n < 16:
+		b.WriteByte(0x80 | byte(n))
+	case n < 1<<16:
+		b.WriteByte(0xde)
+		binary.Write(b, binary.BigEndian, uint16(n))
+	default:
+		b.WriteByte(0xdf)
+		binary.Write(b, binary.BigEndian, uint32(n))
+	}
+}
+
+func writeString(b *bytes.Buffer, s string) {
+	n := len(s)
+	switch {
+	case n < 32:
+		b.WriteByte(0xa0 | byte(n))
+	case n < 1<<8:
+		b.WriteByte(0xd9)
+		b.WriteByte(byte(n))
+	case n < 1<<16:
+		b.WriteByte(0xda)
+		binary.Write(b, binary.BigEndian, uint16(n))
+	default:
+		b.WriteByte(0xdb)
+		binary.Write(b, binary.BigEndian, uint32(n))
+	}
+	b.WriteString(s)
+}
+
+func writeUint(b *bytes.Buffer, v uint64) {
+	switch {
+	case v < 1<<7:
+		b.WriteByte(byte(v))
+	case v < 1<<8:
+		b.WriteByte(0xcc)
+		b.WriteByte(byte(v))
+	case v < 1<<16:
+		b.WriteByte(0xcd)
+		binary.Write(b, binary.BigEndian, uint16(v))
+	case v < 1<<32:
+		b.WriteByte(0xce)
+		binary.Write(b, binary.BigEndian, uint32(v))
+	default:
+		b.WriteByte(0xcf)
+		binary.Write(b, binary.BigEndian, v)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFluentdMessage(t *testing.T) {
+	fw := newFluentdWriter("127.0.0.1:24224", "nginx", fieldList{"RKT_APP_NAME=web"})
+	ts := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	want := "\x93" +
+		"\xa9rkt.nginx" +
+		"\xce\x56\x87\x3e\x25" +
+		"\x83" +
+		"\xa3log\xa3one" +
+		"\xa6source\xa6stdout" +
+		"\xacrkt_app_name\xa3web"
+	if got := string(fw.message(ts, "stdout", "one")); got != want {
+		t.Errorf("got message %q, want %q", got, want)
+	}
+}
+
+func TestMessagePackEncoding(t *testing.T) {
+	tests := []struct {
+		write func(b *bytes.Buffer)
+		want  string
+	}{
+		{func(b *bytes.Buffer) { writeUint(b, 5) }, "\x05"},
+		{func(b *bytes.Buffer) { writeUint(b, 200) }, "\xcc\xc8"},
+		{func(b *bytes.Buffer) { writeUint(b, 1000) }, "\xcd\x03\xe8"},
+		{func(b *bytes.Buffer) { writeUint(b, 1<<40) }, "\xcf\x00\x00\x01\x00\x00\x00\x00\x00"},
+		{func(b *bytes.Buffer) { writeString(b, "") }, "\xa0"},
+		{func(b *bytes.Buffer) { writeString(b, strings.Repeat("a", 40)) }, "\xd9\x28" + strings.Repeat("a", 40)},
+		{func(b *bytes.Buffer) { writeString(b, strings.Repeat("a", 300)) }, "\xda\x01\x2c" + strings.Repeat("a", 300)},
+		{func(b *bytes.Buffer) { writeArrayHeader(b, 20) }, "\xdc\x00\x14"},
+		{func(b *bytes.Buffer) { writeMapHeader(b, 3) }, "\x83"},
+		{func(b *bytes.Buffer) { writeMapHeader(b, 20) }, "\xde\x00\x14"},
+	}
+
+	for i, tt := range tests {
+		var b bytes.Buffer
+		tt.write(&b)
+		if got := b.String(); got != tt.want {
+			t.Errorf("#%d: got %q, want %q", i, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	priorityInfo = 6
+	priorityErr  = 3
+)
+
+// journalSocket is where journald receives the entries sent with its native
+// protocol
+var journalSocket = "/run/systemd/journal/socket"
+
+// journalWriter sends the lines to the journal with the native protocol of
+// journald, the lines of stdout with the info priority and the ones of
+// stderr with the err priority.
+type journalWriter struct {
+	socket     string
+	identifier string
+	fields     fieldList
+
+	mu   sync.Mutex
+	conn *net.UnixConn
+}
+
+func (jw *journalWriter) Open() error {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: jw.socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	jw.mu.Lock()
+	jw.conn = conn
+	jw.mu.Unlock()
+	return nil
+}
+
+func (jw *journalWriter) WriteLine(t time.Time, stream, line string) error {
+	jw.mu.Lock()
+	defer jw.mu.Unlock()
+
+	if jw.conn == nil {
+		return nil
+	}
+	_, err := jw.conn.Write(jw.entry(stream, line))
+	return err
+}
+
+func (jw *journalWriter) Close() error {
+	jw.mu.Lock()
+	defer jw.mu.Unlock()
+
+	if jw.conn == nil {
+		return nil
+	}
+	err := jw.conn.Close()
+	jw.conn = nil
+	return err
+}
+
+// entry returns the datagram of the entry of line, read from stream. The
+// time of the entry is the one it is received by journald.
+func (jw *journalWriter) entry(stream, line string) []byte {
+	priority := priorityInfo
+	if stream == "stderr" {
+		priority = priorityErr
+	}
+
+	var b bytes.Buffer
+	appendField(&b, "MESSAGE", line)
+	appendField(&b, "PRIORITY", fmt.Sprintf("%d", priority))
+	if jw.identifier != "" {
+		appendField(&b, "SYSLOG_IDENTIFIER", jw.identifier)
+	}
+	names, values := jw.fields.split()
+	for i := range names {
+		appendField(&b, names[i], values[i])
+	}
+	return b.Bytes()
+}
+
+// appendField appends a field to b, in the binary form of the protocol when
+// its value spans several lines.
+func appendField(b *bytes.Buffer, name, value string) {
+	if !strings.Contains(value, "\n") {
+		fmt.Fprintf(b, "%s=%s\n", name, value)
+		return
+	}
+	b.WriteString(name)
+	b.WriteByte('\n')
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
@@ -0,0 +1,64 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJournalEntry(t *testing.T) {
+	jw := &journalWriter{
+		identifier: "nginx",
+		fields:     fieldList{"RKT_APP_NAME=web", "RKT_IMAGE_DIGEST=sha512-abc"},
+	}
+
+	tests := []struct {
+		stream string
+		line   string
+		want   string
+	}{
+		{
+			"stdout",
+			"listening on :80",
+			"MESSAGE=listening on :80\nPRIORITY=6\nSYSLOG_IDENTIFIER=nginx\nRKT_APP_NAME=web\nRKT_IMAGE_DIGEST=sha512-abc\n",
+		},
+		{
+			"stderr",
+			"a=b",
+			"MESSAGE=a=b\nPRIORITY=3\nSYSLOG_IDENTIFIER=nginx\nRKT_APP_NAME=web\nRKT_IMAGE_DIGEST=sha512-abc\n",
+		},
+		{
+			"stdout",
+			"two\nlines",
+			"MESSAGE\n\x09\x00\x00\x00\x00\x00\x00\x00two\nlines\nPRIORITY=6\nSYSLOG_IDENTIFIER=nginx\nRKT_APP_NAME=web\nRKT_IMAGE_DIGEST=sha512-abc\n",
+		},
+	}
+
+	for i, tt := range tests {
+		if got := string(jw.entry(tt.stream, tt.line)); got != tt.want {
+			t.Errorf("#%d: got entry %q, want %q", i, got, tt.want)
+		}
+	}
+}
+
+func TestJournalWriteLineNotConnected(t *testing.T) {
+	jw := &journalWriter{}
+	if err := jw.WriteLine(time.Now(), "stdout", "dropped"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
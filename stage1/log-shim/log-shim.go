@@ -0,0 +1,318 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/coreos/rkt/common"
+)
+
+// log-shim runs an app command, sending each line of its output to the log
+// driver of the pod with fields identifying the pod, the app and its image,
+// so the log pipelines can attribute the lines without parsing the machine
+// names. The lines are written to the output of log-shim too, which goes to
+// the console of the pod.
+//
+// The drivers are:
+//
+//	journald: the journal of the pod, with its native protocol
+//	syslog: a syslog server, in the RFC 5424 format over UDP or TCP
+//	fluentd: a fluentd server, with its forward protocol over TCP
+//
+// When the driver cannot reach where the lines are sent, they only go to
+// the console.
+//
+// Instead of running a command, log-shim can read the output of an app from
+// the FIFOs given by --stdout and --stderr, written by the app each time it
+// runs, until it is terminated. This is how stage1 runs it, in a service of
+// its own, so it isn't subject to the sandbox of the app.
+
+const (
+	// drainTimeout is how long the output of the processes left by the
+	// command, holding its pipes, is read after the command exits
+	drainTimeout = time.Second
+	// lineMax is the maximum length of a line sent to the log driver,
+	// the longer lines are split like journald splits the output of the
+	// services, so an entry always fits in a datagram of the journal
+	lineMax = 48 * 1024
+)
+
+var (
+	driver     string
+	address    string
+	identifier string
+	fields     fieldList
+	stdoutFIFO string
+	stderrFIFO string
+)
+
+// forwardedSignals are the signals forwarded to the command
+var forwardedSignals = []os.Signal{
+	syscall.SIGHUP,
+	syscall.SIGINT,
+	syscall.SIGQUIT,
+	syscall.SIGTERM,
+	syscall.SIGUSR1,
+	syscall.SIGUSR2,
+	syscall.SIGWINCH,
+}
+
+// logWriter sends the lines of the output of the command to a log driver.
+type logWriter interface {
+	// Open connects to where the lines are sent. The lines written
+	// while not connected are dropped.
+	Open() error
+	// WriteLine sends line, read from stream at t. It must not block
+	// for long, since the output of the command is not read meanwhile.
+	WriteLine(t time.Time, stream, line string) error
+	// Close sends the pending lines and disconnects.
+	Close() error
+}
+
+// fieldList is a list of fields given as KEY=VALUE flags, with the names of
+// the journal fields.
+type fieldList []string
+
+func (fl *fieldList) String() string {
+	return strings.Join(*fl, " ")
+}
+
+func (fl *fieldList) Set(s string) error {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 || !validFieldName(kv[0]) {
+		return fmt.Errorf("invalid field %q", s)
+	}
+	*fl = append(*fl, s)
+	return nil
+}
+
+// split returns the names and the values of the fields.
+func (fl fieldList) split() (names []string, values []string) {
+	for _, f := range fl {
+		kv := strings.SplitN(f, "=", 2)
+		names = append(names, kv[0])
+		values = append(values, kv[1])
+	}
+	return names, values
+}
+
+// validFieldName returns whether name is a valid name for a field set by a
+// client of journald: uppercase letters, digits and underscores, not
+// starting with an underscore, which is for the trusted fields.
+func validFieldName(name string) bool {
+	if name == "" || len(name) > 64 || name[0] == '_' || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9') && c != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+func init() {
+	flag.StringVar(&driver, "driver", common.LogDriverJournald, "Log driver: journald, syslog or fluentd")
+	flag.StringVar(&address, "address", "", "Address of the syslog or fluentd server, as udp://HOST:PORT or tcp://HOST:PORT")
+	flag.StringVar(&identifier, "identifier", "", "Identifier of the app in the entries")
+	flag.Var(&fields, "field", "Field added to the entries, as KEY=VALUE, can be repeated")
+	flag.StringVar(&stdoutFIFO, "stdout", "", "FIFO to read the stdout of the app from, instead of running a command")
+	flag.StringVar(&stderrFIFO, "stderr", "", "FIFO to read the stderr of the app from, instead of running a command")
+}
+
+func main() {
+	flag.Parse()
+
+	following := stdoutFIFO != "" || stderrFIFO != ""
+	if following == (flag.NArg() > 0) {
+		fmt.Fprintln(os.Stderr, "usage: log-shim [--driver=DRIVER] [--address=ADDRESS] [--identifier=ID] [--field=KEY=VALUE]... {--stdout=FIFO --stderr=FIFO | COMMAND [ARGS...]}")
+		os.Exit(1)
+	}
+
+	lw, err := newLogWriter(driver, address, identifier, fields)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := lw.Open(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to connect to the %s log driver: %v\n", driver, err)
+	}
+
+	var status int
+	if following {
+		status = follow(lw, stdoutFIFO, stderrFIFO)
+	} else {
+		status = run(lw, flag.Args())
+	}
+	// sends the lines still queued
+	lw.Close()
+	os.Exit(status)
+}
+
+// newLogWriter returns the writer of the log driver.
+func newLogWriter(driver, address, identifier string, fields fieldList) (logWriter, error) {
+	network, hostport, err := common.ParseLogDriverAddress(driver, address)
+	if err != nil {
+		return nil, err
+	}
+	switch driver {
+	case common.LogDriverSyslog:
+		return newSyslogWriter(network, hostport, identifier, fields), nil
+	case common.LogDriverFluentd:
+		return newFluentdWriter(hostport, identifier, fields), nil
+	default:
+		return &journalWriter{socket: journalSocket, identifier: identifier, fields: fields}, nil
+	}
+}
+
+// run runs args, copying its output to the output of log-shim and to lw. It
+// returns the exit status of the command, or re-raises the signal which
+// killed it.
+func run(lw logWriter, args []string) int {
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create pipe: %v\n", err)
+		return 1
+	}
+	stderrR, stderrW, err := os.Pipe()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create pipe: %v\n", err)
+		return 1
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = stdoutW
+	cmd.Stderr = stderrW
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, forwardedSignals...)
+
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to start %q: %v\n", args[0], err)
+		return 1
+	}
+	stdoutW.Close()
+	stderrW.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		copyLines(lw, "stdout", stdoutR, os.Stdout)
+	}()
+	go func() {
+		defer wg.Done()
+		copyLines(lw, "stderr", stderrR, os.Stderr)
+	}()
+
+	go func() {
+		for sig := range sigs {
+			cmd.Process.Signal(sig)
+		}
+	}()
+
+	cmd.Wait()
+
+	drained := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(drainTimeout):
+	}
+
+	status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus)
+	if !ok {
+		return 1
+	}
+	if status.Signaled() {
+		lw.Close()
+		signal.Reset(status.Signal())
+		syscall.Kill(os.Getpid(), status.Signal())
+		return 128 + int(status.Signal())
+	}
+	return status.ExitStatus()
+}
+
+// follow copies the lines read from the FIFOs stdoutPath and stderrPath,
+// either of which may be empty, to the output of log-shim and to lw, until
+// log-shim is terminated.
+func follow(lw logWriter, stdoutPath, stderrPath string) int {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	if stdoutPath != "" {
+		go followFIFO(lw, "stdout", stdoutPath, os.Stdout)
+	}
+	if stderrPath != "" {
+		go followFIFO(lw, "stderr", stderrPath, os.Stderr)
+	}
+	<-sigs
+	return 0
+}
+
+// followFIFO copies the lines read from the FIFO at path to w and to lw,
+// where they are tagged with stream. The FIFO is opened again each time its
+// writers close it, when the app exits, to read the output of its next run.
+func followFIFO(lw logWriter, stream, path string, w io.Writer) {
+	for {
+		// blocks until the app opens it
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to open %s: %v\n", path, err)
+			return
+		}
+		copyLines(lw, stream, f, w)
+		f.Close()
+	}
+}
+
+// copyLines copies the lines read from r to w and to lw, where they are
+// tagged with stream. The lines longer than lineMax are sent to lw in
+// several parts.
+func copyLines(lw logWriter, stream string, r io.Reader, w io.Writer) {
+	br := bufio.NewReaderSize(r, lineMax)
+	for {
+		line, err := br.ReadSlice('\n')
+		if len(line) > 0 {
+			w.Write(line)
+			if err := lw.WriteLine(time.Now(), stream, strings.TrimSuffix(string(line), "\n")); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to send the output to the %s log driver: %v\n", driver, err)
+			}
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return
+		}
+	}
+}
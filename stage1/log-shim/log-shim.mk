@@ -0,0 +1 @@
+include stage1/makelib/aci_simple_go_bin.mk
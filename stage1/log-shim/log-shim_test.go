@@ -0,0 +1,225 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFieldListSet(t *testing.T) {
+	tests := []struct {
+		field string
+		err   bool
+	}{
+		{"RKT_APP_NAME=web", false},
+		{"RKT_POD_UUID=", false},
+		{"A1_B=x=y", false},
+		{"rkt_app_name=web", true},
+		{"_PID=1", true},
+		{"1ABC=x", true},
+		{"RKT-APP=web", true},
+		{"RKT_APP_NAME", true},
+		{"=web", true},
+	}
+
+	for i, tt := range tests {
+		var fl fieldList
+		err := fl.Set(tt.field)
+		if gotErr := err != nil; gotErr != tt.err {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.err)
+		}
+	}
+}
+
+func TestNewLogWriter(t *testing.T) {
+	tests := []struct {
+		driver  string
+		address string
+		err     bool
+	}{
+		{"journald", "", false},
+		{"syslog", "udp://10.0.0.1:514", false},
+		{"syslog", "tcp://10.0.0.1:514", false},
+		{"fluentd", "tcp://10.0.0.1:24224", false},
+		{"fluentd", "udp://10.0.0.1:24224", true},
+		{"syslog", "", true},
+		{"gelf", "udp://10.0.0.1:12201", true},
+	}
+
+	for i, tt := range tests {
+		lw, err := newLogWriter(tt.driver, tt.address, "nginx", nil)
+		if gotErr := err != nil; gotErr != tt.err {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		var ok bool
+		switch tt.driver {
+		case "journald":
+			_, ok = lw.(*journalWriter)
+		case "syslog":
+			_, ok = lw.(*syslogWriter)
+		case "fluentd":
+			_, ok = lw.(*fluentdWriter)
+		}
+		if !ok {
+			t.Errorf("#%d: got writer %T for the %s driver", i, lw, tt.driver)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log-shim-test")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "socket")
+	journal, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("error listening on %q: %v", socket, err)
+	}
+	defer journal.Close()
+
+	jw := &journalWriter{socket: socket, fields: fieldList{"RKT_APP_NAME=web"}}
+	if err := jw.Open(); err != nil {
+		t.Fatalf("error connecting to the journal: %v", err)
+	}
+	defer jw.Close()
+
+	if status := run(jw, []string{"/bin/sh", "-c", "echo out; echo err >&2; exit 3"}); status != 3 {
+		t.Errorf("got exit status %d, want 3", status)
+	}
+
+	var entries []string
+	buf := make([]byte, 4096)
+	for i := 0; i < 2; i++ {
+		n, err := journal.Read(buf)
+		if err != nil {
+			t.Fatalf("error reading the journal: %v", err)
+		}
+		entries = append(entries, string(buf[:n]))
+	}
+	for _, want := range []string{
+		"MESSAGE=out\nPRIORITY=6\nRKT_APP_NAME=web\n",
+		"MESSAGE=err\nPRIORITY=3\nRKT_APP_NAME=web\n",
+	} {
+		found := false
+		for _, e := range entries {
+			found = found || e == want
+		}
+		if !found {
+			t.Errorf("entry %q not sent, got %q", want, strings.Join(entries, ", "))
+		}
+	}
+}
+
+// lineRecorder is a logWriter recording the lines written to it.
+type lineRecorder struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (lr *lineRecorder) Open() error  { return nil }
+func (lr *lineRecorder) Close() error { return nil }
+
+func (lr *lineRecorder) WriteLine(t time.Time, stream, line string) error {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	lr.lines = append(lr.lines, line)
+	return nil
+}
+
+func (lr *lineRecorder) count() int {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	return len(lr.lines)
+}
+
+func TestCopyLinesSplit(t *testing.T) {
+	long := strings.Repeat("x", lineMax+10)
+	out := long + "\nshort\n"
+
+	lr := &lineRecorder{}
+	var console bytes.Buffer
+	copyLines(lr, "stdout", strings.NewReader(out), &console)
+
+	if console.String() != out {
+		t.Errorf("the output copied to the console differs from the one of the command")
+	}
+	want := []string{strings.Repeat("x", lineMax), strings.Repeat("x", 10), "short"}
+	if len(lr.lines) != len(want) {
+		t.Fatalf("got %d lines, want %d", len(lr.lines), len(want))
+	}
+	for i := range want {
+		if lr.lines[i] != want[i] {
+			t.Errorf("#%d: got a line of %d bytes, want %d", i, len(lr.lines[i]), len(want[i]))
+		}
+	}
+}
+
+func TestFollowFIFO(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log-shim-test")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fifo := filepath.Join(dir, "stdout")
+	if err := syscall.Mkfifo(fifo, 0600); err != nil {
+		t.Fatalf("error creating FIFO: %v", err)
+	}
+
+	lr := &lineRecorder{}
+	go followFIFO(lr, "stdout", fifo, ioutil.Discard)
+
+	// the app runs twice, the FIFO is read again after it exits
+	for _, line := range []string{"first run\n", "second run\n"} {
+		f, err := os.OpenFile(fifo, os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatalf("error opening FIFO: %v", err)
+		}
+		if _, err := f.WriteString(line); err != nil {
+			t.Fatalf("error writing FIFO: %v", err)
+		}
+		f.Close()
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for lr.count() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	want := []string{"first run", "second run"}
+	if !reflect.DeepEqual(lr.lines, want) {
+		t.Errorf("got lines %q, want %q", lr.lines, want)
+	}
+}
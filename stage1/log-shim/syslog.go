@@ -0,0 +1,100 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// syslogFacility is the facility of the messages, user-level
+	syslogFacility = 1
+	// syslogSDID is the ID of the structured data element holding the
+	// fields, with the private enterprise number reserved for
+	// documentation by RFC 5612
+	syslogSDID = "rkt@32473"
+	// syslogTimeFormat is the timestamp of RFC 5424, with microseconds
+	syslogTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+// syslogWriter sends the lines to a syslog server in the RFC 5424 format,
+// one message per datagram over UDP and framed with octet counting, as
+// described by RFC 6587, over TCP. The fields are in a structured data
+// element, with lowercase names, the app identifier is the APP-NAME and the
+// stream the MSGID of the messages.
+type syslogWriter struct {
+	*serverConn
+	hostname   string
+	identifier string
+	fields     fieldList
+}
+
+func newSyslogWriter(network, address, identifier string, fields fieldList) *syslogWriter {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	return &syslogWriter{
+		serverConn: newServerConn(network, address),
+		hostname:   hostname,
+		identifier: identifier,
+		fields:     fields,
+	}
+}
+
+func (sw *syslogWriter) WriteLine(t time.Time, stream, line string) error {
+	msg := sw.message(t, stream, line)
+	if sw.network == "tcp" {
+		msg = append([]byte(fmt.Sprintf("%d ", len(msg))), msg...)
+	}
+	return sw.write(msg)
+}
+
+// message returns the syslog message of line, read from stream at t.
+func (sw *syslogWriter) message(t time.Time, stream, line string) []byte {
+	severity := priorityInfo
+	if stream == "stderr" {
+		severity = priorityErr
+	}
+	appName := sw.identifier
+	if appName == "" {
+		appName = "-"
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<%d>1 %s %s %s - %s ", syslogFacility*8+severity, t.UTC().Format(syslogTimeFormat), sw.hostname, appName, stream)
+	names, values := sw.fields.split()
+	if len(names) == 0 {
+		b.WriteString("-")
+	} else {
+		b.WriteString("[" + syslogSDID)
+		for i := range names {
+			fmt.Fprintf(&b, " %s=\"%s\"", strings.ToLower(names[i]), sdEscaper.Replace(values[i]))
+		}
+		b.WriteString("]")
+	}
+	b.WriteString(" " + line)
+	return b.Bytes()
+}
+
+// sdEscaper escapes the characters of the values of the structured data
+// parameters which must be escaped.
+var sdEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, `]`, `\]`)
@@ -0,0 +1,105 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSyslogMessage(t *testing.T) {
+	ts := time.Date(2016, 1, 2, 3, 4, 5, 678901000, time.UTC)
+
+	tests := []struct {
+		identifier string
+		fields     fieldList
+		stream     string
+		line       string
+		want       string
+	}{
+		{
+			"nginx",
+			fieldList{"RKT_APP_NAME=web", "RKT_IMAGE_NAME=example.com/nginx"},
+			"stdout",
+			"listening on :80",
+			`<14>1 2016-01-02T03:04:05.678901Z rkt-test nginx - stdout [rkt@32473 rkt_app_name="web" rkt_image_name="example.com/nginx"] listening on :80`,
+		},
+		{
+			"nginx",
+			fieldList{`RKT_APP_NAME=a"b]c\d`},
+			"stderr",
+			"failed",
+			`<11>1 2016-01-02T03:04:05.678901Z rkt-test nginx - stderr [rkt@32473 rkt_app_name="a\"b\]c\\d"] failed`,
+		},
+		{
+			"",
+			nil,
+			"stdout",
+			"bare",
+			`<14>1 2016-01-02T03:04:05.678901Z rkt-test - - stdout - bare`,
+		},
+	}
+
+	for i, tt := range tests {
+		sw := &syslogWriter{hostname: "rkt-test", identifier: tt.identifier, fields: tt.fields}
+		if got := string(sw.message(ts, tt.stream, tt.line)); got != tt.want {
+			t.Errorf("#%d: got message %q, want %q", i, got, tt.want)
+		}
+	}
+}
+
+func TestSyslogWriteLineTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	defer l.Close()
+
+	sw := newSyslogWriter("tcp", l.Addr().String(), "nginx", nil)
+	sw.hostname = "rkt-test"
+	if err := sw.Open(); err != nil {
+		t.Fatalf("error connecting: %v", err)
+	}
+	defer sw.Close()
+
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatalf("error accepting: %v", err)
+	}
+	defer conn.Close()
+
+	ts := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, line := range []string{"one", "two"} {
+		if err := sw.WriteLine(ts, "stdout", line); err != nil {
+			t.Fatalf("error writing %q: %v", line, err)
+		}
+	}
+
+	// the messages are framed with their length
+	msg := "<14>1 2016-01-02T03:04:05.000000Z rkt-test nginx - stdout - one"
+	want := "63 " + msg + "63 " + msg[:len(msg)-3] + "two"
+	buf := make([]byte, len(want))
+	if _, err := io.ReadFull(bufio.NewReader(conn), buf); err != nil {
+		t.Fatalf("error reading: %v", err)
+	}
+	if string(buf) != want {
+		t.Errorf("got %q, want %q", buf, want)
+	}
+}
@@ -0,0 +1,354 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// log-writer runs an app command, duplicating its output into size-rotated
+// log files in a directory, so the output is kept after the pod exits on
+// hosts without a persistent journal. Its own output still goes to the
+// journal of the pod.
+//
+// The log file is output.log, rotated to output.log.1, output.log.2, ...
+// output.log.1 being the most recent. Each line of the files is
+//
+//	TIMESTAMP STREAM LINE
+//
+// with TIMESTAMP in the RFC 3339 format with nanoseconds, in UTC and with
+// a fixed width so the lines sort by time, and STREAM either stdout or
+// stderr.
+//
+// Instead of running a command, log-writer can read the output of an app
+// from the FIFOs given by --stdout and --stderr, written by the app each
+// time it runs, until it is terminated.
+
+const (
+	logFileName   = "output.log"
+	logTimeFormat = "2006-01-02T15:04:05.000000000Z07:00"
+
+	// drainTimeout is how long the output of the processes left by the
+	// command, holding its pipes, is read after the command exits
+	drainTimeout = time.Second
+)
+
+var (
+	maxSize    string
+	maxFiles   int
+	stdoutFIFO string
+	stderrFIFO string
+)
+
+// forwardedSignals are the signals forwarded to the command
+var forwardedSignals = []os.Signal{
+	syscall.SIGHUP,
+	syscall.SIGINT,
+	syscall.SIGQUIT,
+	syscall.SIGTERM,
+	syscall.SIGUSR1,
+	syscall.SIGUSR2,
+	syscall.SIGWINCH,
+}
+
+func init() {
+	flag.StringVar(&maxSize, "max-size", "10m", "Maximum size of a log file, in bytes with an optional k, m or g suffix")
+	flag.IntVar(&maxFiles, "max-files", 5, "Number of rotated log files kept")
+	flag.StringVar(&stdoutFIFO, "stdout", "", "FIFO to read the stdout of the app from, instead of running a command")
+	flag.StringVar(&stderrFIFO, "stderr", "", "FIFO to read the stderr of the app from, instead of running a command")
+}
+
+func main() {
+	flag.Parse()
+
+	following := stdoutFIFO != "" || stderrFIFO != ""
+	if flag.NArg() < 1 || following == (flag.NArg() > 1) {
+		fmt.Fprintln(os.Stderr, "usage: log-writer [--max-size=SIZE] [--max-files=N] {--stdout=FIFO --stderr=FIFO DIR | DIR COMMAND [ARGS...]}")
+		os.Exit(1)
+	}
+
+	size, err := parseSize(maxSize)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if maxFiles < 0 {
+		fmt.Fprintf(os.Stderr, "invalid number of rotated log files %d\n", maxFiles)
+		os.Exit(1)
+	}
+
+	dir := flag.Arg(0)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create log directory: %v\n", err)
+		os.Exit(1)
+	}
+	lf := &logFile{path: filepath.Join(dir, logFileName), maxSize: size, maxFiles: maxFiles}
+
+	var status int
+	if following {
+		status = follow(lf, stdoutFIFO, stderrFIFO)
+	} else {
+		status = run(lf, flag.Args()[1:])
+	}
+	lf.Close()
+	os.Exit(status)
+}
+
+// run runs args, copying its output to the output of log-writer and to lf.
+// It returns the exit status of the command, or re-raises the signal which
+// killed it.
+func run(lf *logFile, args []string) int {
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create pipe: %v\n", err)
+		return 1
+	}
+	stderrR, stderrW, err := os.Pipe()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create pipe: %v\n", err)
+		return 1
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = stdoutW
+	cmd.Stderr = stderrW
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, forwardedSignals...)
+
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to start %q: %v\n", args[0], err)
+		return 1
+	}
+	stdoutW.Close()
+	stderrW.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		copyLines(lf, "stdout", stdoutR, os.Stdout)
+	}()
+	go func() {
+		defer wg.Done()
+		copyLines(lf, "stderr", stderrR, os.Stderr)
+	}()
+
+	go func() {
+		for sig := range sigs {
+			cmd.Process.Signal(sig)
+		}
+	}()
+
+	cmd.Wait()
+
+	drained := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(drainTimeout):
+	}
+
+	status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus)
+	if !ok {
+		return 1
+	}
+	if status.Signaled() {
+		lf.Close()
+		signal.Reset(status.Signal())
+		syscall.Kill(os.Getpid(), status.Signal())
+		return 128 + int(status.Signal())
+	}
+	return status.ExitStatus()
+}
+
+// follow copies the lines read from the FIFOs stdoutPath and stderrPath,
+// either of which may be empty, to the output of log-writer and to lf,
+// until log-writer is terminated.
+func follow(lf *logFile, stdoutPath, stderrPath string) int {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	if stdoutPath != "" {
+		go followFIFO(lf, "stdout", stdoutPath, os.Stdout)
+	}
+	if stderrPath != "" {
+		go followFIFO(lf, "stderr", stderrPath, os.Stderr)
+	}
+	<-sigs
+	return 0
+}
+
+// followFIFO copies the lines read from the FIFO at path to w and to lf,
+// where they are tagged with stream. The FIFO is opened again each time its
+// writers close it, when the app exits, to read the output of its next run.
+func followFIFO(lf *logFile, stream, path string, w io.Writer) {
+	for {
+		// blocks until the app opens it
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to open %s: %v\n", path, err)
+			return
+		}
+		copyLines(lf, stream, f, w)
+		f.Close()
+	}
+}
+
+// copyLines copies the lines read from r to w and to lf, where they are
+// tagged with stream.
+func copyLines(lf *logFile, stream string, r io.Reader, w io.Writer) {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if len(line) > 0 {
+			io.WriteString(w, line)
+			if err := lf.WriteLine(time.Now(), stream, strings.TrimSuffix(line, "\n")); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to write log file: %v\n", err)
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// logFile is a log file rotated when it exceeds maxSize, keeping maxFiles
+// rotated files.
+type logFile struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// WriteLine writes line, read from stream at t, to the log file.
+func (lf *logFile) WriteLine(t time.Time, stream, line string) error {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+
+	entry := fmt.Sprintf("%s %s %s\n", t.UTC().Format(logTimeFormat), stream, line)
+
+	if lf.file != nil && lf.size > 0 && lf.size+int64(len(entry)) > lf.maxSize {
+		if err := lf.rotate(); err != nil {
+			return err
+		}
+	}
+	if lf.file == nil {
+		if err := lf.open(); err != nil {
+			return err
+		}
+	}
+
+	n, err := io.WriteString(lf.file, entry)
+	lf.size += int64(n)
+	return err
+}
+
+// Close closes the log file.
+func (lf *logFile) Close() error {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+
+	if lf.file == nil {
+		return nil
+	}
+	err := lf.file.Close()
+	lf.file = nil
+	return err
+}
+
+func (lf *logFile) open() error {
+	f, err := os.OpenFile(lf.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	lf.file = f
+	lf.size = info.Size()
+	return nil
+}
+
+// rotate closes the log file and shifts the rotated files, dropping the
+// oldest one.
+func (lf *logFile) rotate() error {
+	if err := lf.file.Close(); err != nil {
+		return err
+	}
+	lf.file = nil
+
+	if lf.maxFiles == 0 {
+		return os.Remove(lf.path)
+	}
+	for i := lf.maxFiles - 1; i > 0; i-- {
+		err := os.Rename(rotatedPath(lf.path, i), rotatedPath(lf.path, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(lf.path, rotatedPath(lf.path, 1))
+}
+
+func rotatedPath(path string, i int) string {
+	return path + "." + strconv.Itoa(i)
+}
+
+// parseSize returns the number of bytes of size, optionally followed by a
+// k, m or g suffix.
+func parseSize(size string) (int64, error) {
+	n := size
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(size, "k"), strings.HasSuffix(size, "K"):
+		mult = 1 << 10
+	case strings.HasSuffix(size, "m"), strings.HasSuffix(size, "M"):
+		mult = 1 << 20
+	case strings.HasSuffix(size, "g"), strings.HasSuffix(size, "G"):
+		mult = 1 << 30
+	}
+	if mult != 1 {
+		n = n[:len(n)-1]
+	}
+	bytes, err := strconv.ParseInt(n, 10, 64)
+	if err != nil || bytes <= 0 {
+		return 0, fmt.Errorf("invalid log file size %q", size)
+	}
+	return bytes * mult, nil
+}
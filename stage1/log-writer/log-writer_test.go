@@ -0,0 +1,101 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		size    string
+		want    int64
+		wantErr bool
+	}{
+		{"512", 512, false},
+		{"4k", 4 << 10, false},
+		{"10M", 10 << 20, false},
+		{"1g", 1 << 30, false},
+		{"", 0, true},
+		{"0", 0, true},
+		{"m", 0, true},
+		{"1t", 0, true},
+	}
+
+	for i, tt := range tests {
+		got, err := parseSize(tt.size)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("#%d: got error %v, want error %t", i, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("#%d: got %d, want %d", i, got, tt.want)
+		}
+	}
+}
+
+func TestLogFileRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log-writer-test")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ts := time.Date(2016, 1, 2, 15, 4, 5, 6, time.UTC)
+	// each entry is 45 bytes, so a file holds two of them
+	lf := &logFile{path: filepath.Join(dir, logFileName), maxSize: 100, maxFiles: 2}
+	for _, line := range []string{"line-0", "line-1", "line-2", "line-3", "line-4", "line-5", "line-6"} {
+		if err := lf.WriteLine(ts, "stdout", line); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := lf.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name  string
+		lines []string
+	}{
+		{"output.log", []string{"line-6"}},
+		{"output.log.1", []string{"line-4", "line-5"}},
+		{"output.log.2", []string{"line-2", "line-3"}},
+	} {
+		content, err := ioutil.ReadFile(filepath.Join(dir, tt.name))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		var want []string
+		for _, l := range tt.lines {
+			want = append(want, "2016-01-02T15:04:05.000000006Z stdout "+l)
+		}
+		got := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "output.log.3")); !os.IsNotExist(err) {
+		t.Errorf("expected output.log.3 not to exist, got %v", err)
+	}
+}
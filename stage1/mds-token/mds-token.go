@@ -0,0 +1,155 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+
+	"github.com/coreos/rkt/common"
+	stage1lib "github.com/coreos/rkt/pkg/stage1"
+)
+
+// envDir is where stage1/init writes the environment files of the apps,
+// relative to the stage1 rootfs
+const envDir = "/rkt/env"
+
+const mdsURLEnv = "AC_METADATA_URL"
+
+var (
+	debug    bool
+	mdsToken string
+)
+
+func init() {
+	flag.BoolVar(&debug, "debug", false, "Run in debug mode")
+	flag.StringVar(&mdsToken, "mds-token", "", "New MDS auth token")
+}
+
+func main() {
+	flag.Parse()
+
+	if !debug {
+		log.SetOutput(ioutil.Discard)
+	}
+
+	podID, err := types.NewUUID(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "UUID is missing or malformed")
+		os.Exit(1)
+	}
+
+	if mdsToken == "" {
+		fmt.Fprintln(os.Stderr, "MDS token is missing")
+		os.Exit(1)
+	}
+
+	if err := reissueToken(podID, mdsToken); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// reissueToken replaces the token in the metadata service URL of the apps of
+// the pod rooted in the current directory. The apps get the new URL in
+// AC_METADATA_URL when they are (re)started.
+func reissueToken(podID *types.UUID, token string) error {
+	p, err := stage1lib.LoadPod(".", podID)
+	if err != nil {
+		return fmt.Errorf("failed to load pod: %v", err)
+	}
+
+	for _, ra := range p.Manifest.Apps {
+		path := filepath.Join(common.Stage1RootfsPath("."), envDir, ra.Name.String())
+		if err := rewriteEnvFile(path, token); err != nil {
+			return fmt.Errorf("failed to re-issue the token to app %q: %v", ra.Name, err)
+		}
+		log.Printf("re-issued the token to app %q", ra.Name)
+	}
+
+	return nil
+}
+
+// rewriteEnvFile atomically replaces the environment file at path with one
+// holding the new token, keeping its mode and owner.
+func rewriteEnvFile(path, token string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	env, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	env, err = replaceMDSToken(env, token)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, env, fi.Mode()); err != nil {
+		return err
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		if err := os.Chown(tmp, int(st.Uid), int(st.Gid)); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return nil
+}
+
+// replaceMDSToken replaces the token, the path of the metadata service URL,
+// in the NUL-separated environment env.
+func replaceMDSToken(env []byte, token string) ([]byte, error) {
+	prefix := []byte(mdsURLEnv + "=")
+	vars := bytes.Split(env, []byte{0})
+
+	found := false
+	for i, v := range vars {
+		if !bytes.HasPrefix(v, prefix) {
+			continue
+		}
+		u, err := url.Parse(string(v[len(prefix):]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", mdsURLEnv, err)
+		}
+		u.Path = "/" + token
+		vars[i] = []byte(mdsURLEnv + "=" + u.String())
+		found = true
+	}
+	if !found {
+		return nil, fmt.Errorf("%s not found, the pod does not use the metadata service", mdsURLEnv)
+	}
+
+	return bytes.Join(vars, []byte{0}), nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"testing"
+)
+
+func TestReplaceMDSToken(t *testing.T) {
+	tests := []struct {
+		env     string
+		token   string
+		want    string
+		wantErr bool
+	}{
+		{
+			"AC_APP_NAME=foo\000AC_METADATA_URL=http://172.16.28.1:2375/0123\000",
+			"abcd",
+			"AC_APP_NAME=foo\000AC_METADATA_URL=http://172.16.28.1:2375/abcd\000",
+			false,
+		},
+		{
+			"AC_METADATA_URL=http://127.0.0.1:2375/0123\000PATH=/bin\000",
+			"abcd",
+			"AC_METADATA_URL=http://127.0.0.1:2375/abcd\000PATH=/bin\000",
+			false,
+		},
+		{
+			"AC_APP_NAME=foo\000MY_AC_METADATA_URL=http://127.0.0.1:2375/0123\000",
+			"abcd",
+			"",
+			true,
+		},
+		{
+			"AC_METADATA_URL=%zz\000",
+			"abcd",
+			"",
+			true,
+		},
+	}
+
+	for i, tt := range tests {
+		got, err := replaceMDSToken([]byte(tt.env), tt.token)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("#%d: expected an error, got %q", i, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("#%d: got %q, want %q", i, got, tt.want)
+		}
+	}
+}
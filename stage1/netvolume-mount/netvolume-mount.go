@@ -0,0 +1,129 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// netvolume-mount mounts the file system of a nfs or cifs volume in stage1
+// with the mount system call, so stage1 needs no mount helper:
+//
+//	netvolume-mount [--read-only] [--credentials=FILE] TYPE SOURCE TARGET OPTIONS
+//	netvolume-mount --unmount TARGET
+//
+// OPTIONS are passed as is to the kernel, so they must contain the address
+// of the server, resolved by stage1 init. The credentials of a cifs volume
+// are read from a file in the format of mount.cifs and added to them.
+
+var (
+	readOnly    bool
+	credentials string
+	unmount     bool
+)
+
+func init() {
+	flag.BoolVar(&readOnly, "read-only", false, "Mount the file system read-only")
+	flag.StringVar(&credentials, "credentials", "", "File holding the credentials of a cifs file system")
+	flag.BoolVar(&unmount, "unmount", false, "Unmount the file system mounted on TARGET")
+}
+
+func main() {
+	flag.Parse()
+
+	var err error
+	switch {
+	case unmount && flag.NArg() == 1:
+		err = syscall.Unmount(flag.Arg(0), 0)
+	case !unmount && flag.NArg() == 4:
+		err = mountVolume(flag.Arg(0), flag.Arg(1), flag.Arg(2), flag.Arg(3))
+	default:
+		fmt.Fprintln(os.Stderr, "Usage: netvolume-mount [--read-only] [--credentials=FILE] TYPE SOURCE TARGET OPTIONS")
+		fmt.Fprintln(os.Stderr, "       netvolume-mount --unmount TARGET")
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "netvolume-mount: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// mountVolume mounts the file system on target, created if needed.
+func mountVolume(fstype, source, target, options string) error {
+	opts := []string{}
+	if options != "" {
+		opts = append(opts, options)
+	}
+	if credentials != "" {
+		b, err := ioutil.ReadFile(credentials)
+		if err != nil {
+			return fmt.Errorf("cannot read the credentials: %v", err)
+		}
+		creds, err := parseCredentials(string(b))
+		if err != nil {
+			return err
+		}
+		opts = append(opts, creds...)
+	}
+
+	var flags uintptr
+	if readOnly {
+		flags |= syscall.MS_RDONLY
+	}
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return err
+	}
+	if err := syscall.Mount(source, target, fstype, flags, strings.Join(opts, ",")); err != nil {
+		return fmt.Errorf("cannot mount %s on %s: %v", source, target, err)
+	}
+	return nil
+}
+
+// parseCredentials returns the mount options for the content of a
+// credentials file of mount.cifs: its username, password and domain lines.
+// The commas of the values are doubled, as the kernel expects.
+func parseCredentials(content string) ([]string, error) {
+	var opts []string
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(strings.TrimLeft(line, " \t"), "\r")
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid line in the credentials, must be KEY=VALUE")
+		}
+		var key string
+		switch kv[0] {
+		case "username", "user":
+			key = "username"
+		case "password", "pass":
+			key = "password"
+		case "domain", "dom", "workgroup":
+			key = "domain"
+		default:
+			return nil, fmt.Errorf("unknown key %q in the credentials", kv[0])
+		}
+		opts = append(opts, key+"="+strings.Replace(kv[1], ",", ",,", -1))
+	}
+	return opts, nil
+}
@@ -0,0 +1,48 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCredentials(t *testing.T) {
+	tests := []struct {
+		content string
+		opts    []string
+		err     bool
+	}{
+		{"", nil, false},
+		{"username=alice\npassword=s3cret\n", []string{"username=alice", "password=s3cret"}, false},
+		{"# share\r\n  user=alice\r\npass=a,b=c\r\ndomain=CORP\r\n", []string{"username=alice", "password=a,,b=c", "domain=CORP"}, false},
+		{"workgroup=CORP", []string{"domain=CORP"}, false},
+		{"username alice", nil, true},
+		{"uid=1000", nil, true},
+	}
+
+	for i, tt := range tests {
+		opts, err := parseCredentials(tt.content)
+		if (err != nil) != tt.err {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.err)
+			continue
+		}
+		if !reflect.DeepEqual(opts, tt.opts) {
+			t.Errorf("#%d: got options %v, want %v", i, opts, tt.opts)
+		}
+	}
+}
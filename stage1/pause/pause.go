@@ -0,0 +1,332 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+
+	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/common/cgroup"
+)
+
+const (
+	// freezeTimeout is how long to wait for the processes of the pod to
+	// be frozen
+	freezeTimeout = 10 * time.Second
+	// maxMoveAttempts is how many times the processes of the pod are moved
+	// to the freezer cgroup, to catch the processes forked in the meantime
+	maxMoveAttempts = 10
+)
+
+var (
+	debug  bool
+	resume bool
+)
+
+func init() {
+	flag.BoolVar(&debug, "debug", false, "Run in debug mode")
+	flag.BoolVar(&resume, "resume", false, "Resume the paused pod")
+}
+
+func main() {
+	flag.Parse()
+
+	if !debug {
+		log.SetOutput(ioutil.Discard)
+	}
+
+	podID, err := types.NewUUID(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "UUID is missing or malformed")
+		os.Exit(1)
+	}
+
+	if err := pause(podID); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// pause pauses or resumes the pod rooted in the current directory. The kvm
+// flavor stops the hypervisor, the other flavors freeze the processes of the
+// pod with the freezer cgroup.
+func pause(podID *types.UUID) error {
+	flavor, err := os.Readlink("flavor")
+	if err != nil {
+		return fmt.Errorf("failed to get stage1 flavor: %v", err)
+	}
+
+	// the ppid is the process executing the hypervisor or systemd-nspawn
+	ppidBytes, err := ioutil.ReadFile("ppid")
+	if err != nil {
+		return fmt.Errorf("failed to read ppid: %v", err)
+	}
+	ppid, err := strconv.Atoi(strings.TrimSpace(string(ppidBytes)))
+	if err != nil {
+		return fmt.Errorf("invalid ppid: %v", err)
+	}
+
+	if flavor == "kvm" {
+		sig := syscall.SIGSTOP
+		if resume {
+			sig = syscall.SIGCONT
+		}
+		log.Printf("sending %v to the hypervisor (pid %d)", sig, ppid)
+		return syscall.Kill(ppid, sig)
+	}
+
+	unified, err := cgroup.IsUnified()
+	if err != nil {
+		return err
+	}
+	if unified {
+		return freezeUnified(ppid, !resume)
+	}
+	return freezeLegacy(podID, ppid, !resume)
+}
+
+// freezeLegacy moves the processes of the pod to their own cgroup of the
+// legacy freezer hierarchy, as systemd does not manage that controller, and
+// freezes or thaws it.
+func freezeLegacy(podID *types.UUID, ppid int, freeze bool) error {
+	path := cgroup.PodFreezerCgroup(podID.String())
+
+	if !freeze {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return fmt.Errorf("pod %q is not paused", podID)
+		}
+		return ioutil.WriteFile(filepath.Join(path, "freezer.state"), []byte("THAWED"), 0644)
+	}
+
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return fmt.Errorf("error creating the freezer cgroup: %v", err)
+	}
+
+	for i := 0; i < maxMoveAttempts; i++ {
+		pids, err := getProcessTree(ppid)
+		if err != nil {
+			return err
+		}
+		frozen, err := readPids(filepath.Join(path, "cgroup.procs"))
+		if err != nil {
+			return err
+		}
+
+		moved := 0
+		for _, pid := range pids {
+			if frozen[pid] {
+				continue
+			}
+			if err := ioutil.WriteFile(filepath.Join(path, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644); err != nil {
+				if pe, ok := err.(*os.PathError); ok && pe.Err == syscall.ESRCH {
+					// the process exited
+					continue
+				}
+				return fmt.Errorf("error moving process %d to the freezer cgroup: %v", pid, err)
+			}
+			moved++
+		}
+		log.Printf("moved %d processes to %s", moved, path)
+		if moved == 0 {
+			break
+		}
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(path, "freezer.state"), []byte("FROZEN"), 0644); err != nil {
+		return fmt.Errorf("error freezing the pod: %v", err)
+	}
+	return waitForState(filepath.Join(path, "freezer.state"), "FROZEN")
+}
+
+// freezeUnified freezes or thaws the cgroup of the pod in the unified
+// hierarchy, recorded by stage1 in the pod directory. The cgroup must contain
+// only the processes of the pod, which is the case when the pod is registered
+// to machined or runs in its own unit.
+func freezeUnified(ppid int, freeze bool) error {
+	cg, err := readPodCgroup(".")
+	if err != nil {
+		return err
+	}
+	dir := cgroup.UnifiedCgroupDir(cg)
+
+	if freeze {
+		pids, err := getProcessTree(ppid)
+		if err != nil {
+			return err
+		}
+		inPod := make(map[int]bool)
+		for _, pid := range pids {
+			inPod[pid] = true
+		}
+		if err := checkCgroupProcesses(dir, inPod); err != nil {
+			return err
+		}
+	}
+
+	freezeFile := filepath.Join(dir, "cgroup.freeze")
+	if _, err := os.Stat(freezeFile); err != nil {
+		return fmt.Errorf("the kernel does not support freezing cgroups in the unified hierarchy: %v", err)
+	}
+
+	val, state := "0", "frozen 0"
+	if freeze {
+		val, state = "1", "frozen 1"
+	}
+	if err := ioutil.WriteFile(freezeFile, []byte(val), 0644); err != nil {
+		return fmt.Errorf("error writing %s: %v", freezeFile, err)
+	}
+	return waitForState(filepath.Join(dir, "cgroup.events"), state)
+}
+
+// readPodCgroup returns the cgroup of the pod rooted in podDir, from the root
+// of the hierarchy.
+func readPodCgroup(podDir string) (string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(podDir, common.PodCgroupsFilename))
+	if err != nil {
+		return "", fmt.Errorf("failed to read the pod cgroups: %v", err)
+	}
+	var pc common.PodCgroups
+	if err := json.Unmarshal(b, &pc); err != nil {
+		return "", fmt.Errorf("failed to parse the pod cgroups: %v", err)
+	}
+	if pc.Cgroup == "" || pc.Cgroup == "/" {
+		return "", fmt.Errorf("the pod has no cgroup of its own")
+	}
+	return pc.Cgroup, nil
+}
+
+// checkCgroupProcesses returns an error if a process of the cgroup in dir or
+// of its children is not in pids.
+func checkCgroupProcesses(dir string, pids map[int]bool) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		procs, err := readPids(filepath.Join(path, "cgroup.procs"))
+		if err != nil {
+			return err
+		}
+		for pid := range procs {
+			if !pids[pid] {
+				return fmt.Errorf("the cgroup %s contains processes outside of the pod, register the pod to machined or run it in a systemd unit to pause it", dir)
+			}
+		}
+		return nil
+	})
+}
+
+// waitForState waits until the file contains the line state
+func waitForState(file, state string) error {
+	deadline := time.Now().Add(freezeTimeout)
+	for {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		for _, line := range strings.Split(string(b), "\n") {
+			if strings.TrimSpace(line) == state {
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for %q in %s", state, file)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// readPids returns the set of pids in a cgroup.procs file
+func readPids(file string) (map[int]bool, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pids := make(map[int]bool)
+	for _, f := range strings.Fields(string(b)) {
+		pid, err := strconv.Atoi(f)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pid %q in %s", f, file)
+		}
+		pids[pid] = true
+	}
+	return pids, nil
+}
+
+// getProcessTree returns the pid of root and of all its descendants. The
+// orphaned processes of the pod are reparented to its PID 1, so they stay
+// in the tree.
+func getProcessTree(root int) ([]int, error) {
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+
+	children := make(map[int][]int)
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		stat, err := ioutil.ReadFile(filepath.Join("/proc", e.Name(), "stat"))
+		if err != nil {
+			// the process exited
+			continue
+		}
+		ppid, err := parseStatPPID(string(stat))
+		if err != nil {
+			return nil, err
+		}
+		children[ppid] = append(children[ppid], pid)
+	}
+
+	pids := []int{root}
+	for i := 0; i < len(pids); i++ {
+		pids = append(pids, children[pids[i]]...)
+	}
+	return pids, nil
+}
+
+// parseStatPPID returns the parent pid in the content of a /proc/PID/stat
+// file. The command name, in parentheses, can contain spaces and
+// parentheses, so the fields are counted from the last parenthesis.
+func parseStatPPID(stat string) (int, error) {
+	i := strings.LastIndex(stat, ")")
+	if i < 0 {
+		return 0, fmt.Errorf("invalid stat %q", stat)
+	}
+	// the fields after the command are the state and the ppid
+	fields := strings.Fields(stat[i+1:])
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("invalid stat %q", stat)
+	}
+	return strconv.Atoi(fields[1])
+}
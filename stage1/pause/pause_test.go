@@ -0,0 +1,110 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coreos/rkt/common"
+)
+
+func TestParseStatPPID(t *testing.T) {
+	tests := []struct {
+		stat string
+		ppid int
+		err  bool
+	}{
+		{"1234 (bash) S 1200 1234 1234 34817", 1200, false},
+		{"1234 (my (weird) app) R 42 1234 1234 0", 42, false},
+		{"1234 (bash)", 0, true},
+		{"garbage", 0, true},
+	}
+
+	for i, tt := range tests {
+		ppid, err := parseStatPPID(tt.stat)
+		if tt.err {
+			if err == nil {
+				t.Errorf("#%d: expected error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+			continue
+		}
+		if ppid != tt.ppid {
+			t.Errorf("#%d: got ppid %d, want %d", i, ppid, tt.ppid)
+		}
+	}
+}
+
+func TestGetProcessTree(t *testing.T) {
+	pids, err := getProcessTree(os.Getppid())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	found := false
+	for _, pid := range pids {
+		if pid == os.Getpid() {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("process %d not found in the tree of its parent: %v", os.Getpid(), pids)
+	}
+}
+
+func TestReadPodCgroup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rkt-pause-test-")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		content string
+		cgroup  string
+		err     bool
+	}{
+		{`{"cgroup":"/machine.slice/machine-rkt.scope","unit":"machine-rkt.scope","apps":[]}`, "/machine.slice/machine-rkt.scope", false},
+		{`{"cgroup":"/","apps":[]}`, "", true},
+		{`{"apps":[]}`, "", true},
+		{`garbage`, "", true},
+		{"", "", true},
+	}
+
+	for i, tt := range tests {
+		path := filepath.Join(dir, common.PodCgroupsFilename)
+		os.Remove(path)
+		if tt.content != "" {
+			if err := ioutil.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("error writing %s: %v", path, err)
+			}
+		}
+		cg, err := readPodCgroup(dir)
+		if (err != nil) != tt.err {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.err)
+			continue
+		}
+		if cg != tt.cgroup {
+			t.Errorf("#%d: got cgroup %q, want %q", i, cg, tt.cgroup)
+		}
+	}
+}
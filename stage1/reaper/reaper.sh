@@ -2,9 +2,24 @@
 shopt -s nullglob
 
 SYSCTL=/usr/bin/systemctl
+# the apps stopped by stop-sidecars.service once the one-shot apps of the
+# pod completed, recorded as exited successfully
+STOPPED_DIR=/rkt/stopped
+
+if [ "$1" = "--stopped" ]; then
+    shift
+    for app in "$@"; do
+        : > "${STOPPED_DIR}/$app"
+    done
+    exit 0
+fi
 
 if [ $# -eq 1 ]; then
     app=$1
+    if [ -e "${STOPPED_DIR}/$app" ]; then
+        echo 0 > "/rkt/status/$app"
+        exit 0
+    fi
     status=$(${SYSCTL} show --property ExecMainStatus "${app}.service")
     echo "${status#*=}" > "/rkt/status/$app"
     exit 0
@@ -8,7 +8,15 @@ _S1_SS_SUBDIRS_ := \
 	net \
 	init \
 	gc \
+	pause \
+	mds-token \
+	log-writer \
+	log-shim \
+	netvolume-mount \
+	vsock-proxy \
 	reaper \
+	healthcheck \
+	app-state \
 	units \
 	aci
 
@@ -53,8 +53,11 @@
 #
 # STAGE1_ENTER_CMD_$(flavor) - an enter command in stage1 to be used
 # for the "rkt enter" command.
-STAGE1_FLAVORS := $(call commas-to-spaces,$(RKT_STAGE1_ALL_FLAVORS))
-STAGE1_BUILT_FLAVORS := $(call commas-to-spaces,$(RKT_STAGE1_FLAVORS))
+#
+# The fly flavor is built by stage1_fly/stage1_fly.mk, it has nothing
+# in common with the other flavors.
+STAGE1_FLAVORS := $(filter-out fly,$(call commas-to-spaces,$(RKT_STAGE1_ALL_FLAVORS)))
+STAGE1_BUILT_FLAVORS := $(filter-out fly,$(call commas-to-spaces,$(RKT_STAGE1_FLAVORS)))
 $(foreach f,$(STAGE1_FLAVORS), \
 	$(eval STAGE1_COPY_SO_DEPS_$f :=) \
 	$(eval STAGE1_USR_STAMPS_$f :=) \
@@ -15,6 +15,16 @@ KERNEL_PATCHES := $(abspath $(KERNEL_PATCHESDIR)/*.patch)
 KERNEL_BUILD_CONFIG := $(KERNEL_BUILDDIR)/.config
 KERNEL_BZIMAGE := $(KERNEL_BUILDDIR)/arch/x86/boot/bzImage
 KERNEL_ACI_BZIMAGE := $(S1_RF_ACIROOTFSDIR)/bzImage
+# uncompressed kernel, booted by cloud-hypervisor
+KERNEL_VMLINUX := $(KERNEL_BUILDDIR)/vmlinux
+KERNEL_ACI_VMLINUX := $(S1_RF_ACIROOTFSDIR)/vmlinux
+# features of the guest kernel checked by stage1 init, see
+# stage1/init/kvm/features.go
+KERNEL_ACI_FEATURES := $(S1_RF_ACIROOTFSDIR)/guest-kernel-features
+KERNEL_FEATURES := \
+	$(if $(shell grep -x 'CONFIG_VIRTIO_FS=y' $(KERNEL_SRC_CONFIG)),virtiofs) \
+	$(if $(shell grep -x 'CONFIG_VIRTIO_VSOCKETS=y' $(KERNEL_SRC_CONFIG)),vsock)
+KERNEL_ACI_FILES := $(KERNEL_ACI_BZIMAGE) $(KERNEL_ACI_FEATURES)
 
 $(call setup-stamp-file,KERNEL_STAMP,/build_kernel)
 $(call setup-stamp-file,KERNEL_BZIMAGE_STAMP,/bzimage)
@@ -33,14 +43,32 @@ CREATE_DIRS += $(KERNEL_TMPDIR) $(KERNEL_BUILDDIR)
 CLEAN_DIRS += $(KERNEL_SRCDIR)
 INSTALL_FILES += $(KERNEL_SRC_CONFIG):$(KERNEL_BUILD_CONFIG):-
 S1_RF_INSTALL_FILES += $(KERNEL_BZIMAGE):$(KERNEL_ACI_BZIMAGE):-
+# cloud-hypervisor needs a guest kernel with virtio-fs, so vmlinux is
+# only shipped with such a kernel
+ifneq ($(filter virtiofs,$(KERNEL_FEATURES)),)
+S1_RF_INSTALL_FILES += $(KERNEL_VMLINUX):$(KERNEL_ACI_VMLINUX):-
+KERNEL_ACI_FILES += $(KERNEL_ACI_VMLINUX)
+endif
 S1_RF_SECONDARY_STAMPS += $(KERNEL_STAMP)
-CLEAN_FILES += $(KERNEL_TARGET_FILE)
+CLEAN_FILES += $(KERNEL_TARGET_FILE) $(KERNEL_ACI_FEATURES)
 
-$(call generate-stamp-rule,$(KERNEL_STAMP),$(KERNEL_ACI_BZIMAGE) $(KERNEL_DEPS_STAMP) $(KERNEL_BUILD_CLEAN_STAMP) $(KERNEL_SRC_CLEAN_STAMP))
+$(call generate-stamp-rule,$(KERNEL_STAMP),$(KERNEL_ACI_FILES) $(KERNEL_DEPS_STAMP) $(KERNEL_BUILD_CLEAN_STAMP) $(KERNEL_SRC_CLEAN_STAMP))
+
+# This generates the guest-kernel-features file in ACI rootfs, one
+# feature per line.
+$(call forward-vars,$(KERNEL_ACI_FEATURES), \
+	KERNEL_FEATURES)
+$(KERNEL_ACI_FEATURES): $(KERNEL_SRC_CONFIG) | $(S1_RF_ACIROOTFSDIR)
+	$(VQ) \
+	$(call vb,v2,GEN,$(call vsp,$@)) \
+	: >"$@"; \
+	for f in $(KERNEL_FEATURES); do echo "$${f}" >>"$@"; done
 
 # $(KERNEL_ACI_BZIMAGE) has a dependency on $(KERNEL_BZIMAGE), which
 # is actually provided by $(KERNEL_BZIMAGE_STAMP)
 $(KERNEL_BZIMAGE): $(KERNEL_BZIMAGE_STAMP)
+# vmlinux is built together with bzImage
+$(KERNEL_VMLINUX): $(KERNEL_BZIMAGE_STAMP)
 
 # This stamp is to make sure that building linux kernel has finished.
 $(call generate-stamp-rule,$(KERNEL_BZIMAGE_STAMP),$(KERNEL_BUILD_CONFIG) $(KERNEL_PATCH_STAMP),, \
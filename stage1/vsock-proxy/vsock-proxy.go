@@ -0,0 +1,170 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/coreos/rkt/pkg/vsock"
+)
+
+// vsock-proxy forwards the connections between the kvm pods and their host
+// over vsock, so entering the pod and reaching the metadata service do not
+// depend on the network of the pod:
+//
+//	vsock-proxy LISTEN TARGET
+//
+// LISTEN is vsock:PORT, listening on the vsock port, tcp:HOST:PORT, or -
+// for a single connection on the standard input and output. TARGET is
+// vsock:CID:PORT or tcp:HOST:PORT.
+
+func main() {
+	if len(os.Args) != 3 {
+		fmt.Fprintln(os.Stderr, "usage: vsock-proxy LISTEN TARGET")
+		os.Exit(1)
+	}
+
+	dial, err := parseTarget(os.Args[2])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if os.Args[1] == "-" {
+		if err := proxyStdio(dial); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	l, err := listen(os.Args[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to accept connection: %v\n", err)
+			os.Exit(1)
+		}
+		go func() {
+			if err := proxy(c, dial); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}()
+	}
+}
+
+// listen listens on the vsock:PORT or tcp:HOST:PORT endpoint.
+func listen(endpoint string) (net.Listener, error) {
+	switch {
+	case strings.HasPrefix(endpoint, "vsock:"):
+		port, err := strconv.ParseUint(strings.TrimPrefix(endpoint, "vsock:"), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid vsock port in %q", endpoint)
+		}
+		return vsock.Listen(uint32(port))
+	case strings.HasPrefix(endpoint, "tcp:"):
+		return net.Listen("tcp", strings.TrimPrefix(endpoint, "tcp:"))
+	default:
+		return nil, fmt.Errorf("invalid endpoint %q to listen on, must be vsock:PORT, tcp:HOST:PORT or -", endpoint)
+	}
+}
+
+// parseTarget returns the function connecting to the vsock:CID:PORT or
+// tcp:HOST:PORT endpoint.
+func parseTarget(endpoint string) (func() (net.Conn, error), error) {
+	switch {
+	case strings.HasPrefix(endpoint, "vsock:"):
+		addr, err := vsock.ParseAddr(strings.TrimPrefix(endpoint, "vsock:"))
+		if err != nil {
+			return nil, err
+		}
+		return func() (net.Conn, error) {
+			return vsock.Dial(addr)
+		}, nil
+	case strings.HasPrefix(endpoint, "tcp:"):
+		addr := strings.TrimPrefix(endpoint, "tcp:")
+		return func() (net.Conn, error) {
+			return net.Dial("tcp", addr)
+		}, nil
+	default:
+		return nil, fmt.Errorf("invalid target %q, must be vsock:CID:PORT or tcp:HOST:PORT", endpoint)
+	}
+}
+
+// closeWriter is implemented by the connections which can be half-closed.
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// proxy copies the data between c and a new connection to the target,
+// until both sides are done.
+func proxy(c net.Conn, dial func() (net.Conn, error)) error {
+	defer c.Close()
+
+	t, err := dial()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the target: %v", err)
+	}
+	defer t.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		copyAndCloseWrite(t, c)
+	}()
+	go func() {
+		defer wg.Done()
+		copyAndCloseWrite(c, t)
+	}()
+	wg.Wait()
+	return nil
+}
+
+// proxyStdio copies the data between the standard input and output and a
+// connection to the target, e.g. as the ProxyCommand of ssh.
+func proxyStdio(dial func() (net.Conn, error)) error {
+	t, err := dial()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the target: %v", err)
+	}
+	defer t.Close()
+
+	go func() {
+		copyAndCloseWrite(t, os.Stdin)
+	}()
+	// the session is over when the target closes the connection
+	_, err = io.Copy(os.Stdout, t)
+	return err
+}
+
+func copyAndCloseWrite(dst io.Writer, src io.Reader) {
+	io.Copy(dst, src)
+	if cw, ok := dst.(closeWriter); ok {
+		cw.CloseWrite()
+	}
+}
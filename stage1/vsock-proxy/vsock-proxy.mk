@@ -0,0 +1,11 @@
+VSP_FLAVORS := $(filter kvm,$(STAGE1_FLAVORS))
+
+ifneq ($(VSP_FLAVORS),)
+
+ASGB_FLAVORS := $(VSP_FLAVORS)
+
+include stage1/makelib/aci_simple_go_bin.mk
+
+endif
+
+$(undefine-namespaces,VSP)
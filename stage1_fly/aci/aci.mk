@@ -0,0 +1,25 @@
+# Generates the manifest of the fly stage1 ACI, with the version of
+# rkt.
+
+FLY_ACI_MANIFEST := $(FLY_ACIDIR)/manifest
+FLY_GEN_MANIFEST := $(BUILDDIR)/aci-manifest-fly
+FLY_SED_VERSION := $(call sed-replacement-escape,$(RKT_VERSION))
+
+$(call setup-stamp-file,FLY_MANIFEST_KV_DEPMK_STAMP,manifest-kv-dep)
+$(call setup-dep-file,FLY_MANIFEST_KV_DEPMK,manifest-kv-dep)
+
+$(call forward-vars,$(FLY_GEN_MANIFEST), \
+	FLY_SED_VERSION)
+$(FLY_GEN_MANIFEST): $(MK_SRCDIR)/aci-manifest.in | $(BUILDDIR)
+	$(VQ) \
+	set -e; \
+	$(call vb,vt,MANIFEST,fly) \
+	sed -e 's/@RKT_STAGE1_VERSION@/$(FLY_SED_VERSION)/g' "$<" >"$@.tmp"; \
+	$(call bash-cond-rename,$@.tmp,$@)
+
+# invalidate the generated manifest if the version changes
+$(call generate-kv-deps,$(FLY_MANIFEST_KV_DEPMK_STAMP),$(FLY_GEN_MANIFEST),$(FLY_MANIFEST_KV_DEPMK),FLY_SED_VERSION)
+
+INSTALL_FILES += $(FLY_GEN_MANIFEST):$(FLY_ACI_MANIFEST):0644
+FLY_ACI_FILES += $(FLY_ACI_MANIFEST) $(FLY_MANIFEST_KV_DEPMK_STAMP)
+CLEAN_FILES += $(FLY_GEN_MANIFEST)
@@ -0,0 +1,107 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+// Package common contains the parts of the app execution shared by the
+// entrypoints of the fly stage1, which runs the app of a pod directly on the
+// host, in a chroot, instead of in a container.
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"syscall"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	rktcommon "github.com/coreos/rkt/common"
+)
+
+// DefaultPath is the PATH of the apps which do not set one, as required by
+// the App Container Executor specification.
+const DefaultPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// AppEnv returns the environment of the given app, in the form NAME=VALUE.
+func AppEnv(ra *schema.RuntimeApp) []string {
+	env := append(types.Environment{}, ra.App.Environment...)
+	env.Set("AC_APP_NAME", ra.Name.String())
+	if _, ok := env.Get("PATH"); !ok {
+		env.Set("PATH", DefaultPath)
+	}
+
+	var kvs []string
+	for _, e := range env {
+		kvs = append(kvs, e.Name+"="+e.Value)
+	}
+	return kvs
+}
+
+// AppWorkDir returns the working directory of the given app.
+func AppWorkDir(app *types.App) string {
+	if app.WorkingDirectory != "" {
+		return app.WorkingDirectory
+	}
+	return "/"
+}
+
+// AppUserGroup returns the uid and gid the given app runs as. The fly-uid
+// and fly-gid pod annotations override the user and group of the app, so
+// the host tools can run as system users unknown to their image.
+// For now, only numeric ids (and the string "root") are supported.
+func AppUserGroup(app *types.App, annotations types.Annotations) (int, int, error) {
+	user, group := app.User, app.Group
+	if v, ok := annotations.Get(rktcommon.FlyUIDAnnotation); ok {
+		user = v
+	}
+	if v, ok := annotations.Get(rktcommon.FlyGIDAnnotation); ok {
+		group = v
+	}
+
+	uid, err := parseID(user)
+	if err != nil {
+		return -1, -1, fmt.Errorf("invalid user %q: %v", user, err)
+	}
+	gid, err := parseID(group)
+	if err != nil {
+		return -1, -1, fmt.Errorf("invalid group %q: %v", group, err)
+	}
+	return uid, gid, nil
+}
+
+func parseID(id string) (int, error) {
+	if id == "root" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(id)
+	if err != nil || n < 0 {
+		return -1, fmt.Errorf("non-numerical ids are not supported by the fly stage1")
+	}
+	return n, nil
+}
+
+// SetUser drops the supplementary groups of the process and switches its
+// real, effective and saved ids to the given uid and gid.
+func SetUser(uid, gid int) error {
+	if err := syscall.Setgroups(nil); err != nil {
+		return fmt.Errorf("cannot drop the supplementary groups: %v", err)
+	}
+	if err := syscall.Setresgid(gid, gid, gid); err != nil {
+		return fmt.Errorf("cannot set gid %d: %v", gid, err)
+	}
+	if err := syscall.Setresuid(uid, uid, uid); err != nil {
+		return fmt.Errorf("cannot set uid %d: %v", uid, err)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	rktcommon "github.com/coreos/rkt/common"
+)
+
+func TestAppEnv(t *testing.T) {
+	tests := []struct {
+		env  types.Environment
+		wenv []string
+	}{
+		{
+			nil,
+			[]string{"AC_APP_NAME=app", "PATH=" + DefaultPath},
+		},
+		{
+			types.Environment{{Name: "PATH", Value: "/bin"}, {Name: "FOO", Value: "bar"}},
+			[]string{"PATH=/bin", "FOO=bar", "AC_APP_NAME=app"},
+		},
+	}
+
+	for i, tt := range tests {
+		ra := &schema.RuntimeApp{
+			Name: "app",
+			App:  &types.App{Environment: tt.env},
+		}
+		if env := AppEnv(ra); !reflect.DeepEqual(env, tt.wenv) {
+			t.Errorf("#%d: expected environment %v, got %v", i, tt.wenv, env)
+		}
+	}
+}
+
+func TestAppUserGroup(t *testing.T) {
+	tests := []struct {
+		user  string
+		group string
+		fuid  string
+		fgid  string
+		uid   int
+		gid   int
+		werr  bool
+	}{
+		{"root", "root", "", "", 0, 0, false},
+		{"1000", "100", "", "", 1000, 100, false},
+		{"core", "0", "", "", -1, -1, true},
+		{"0", "-1", "", "", -1, -1, true},
+		{"core", "core", "500", "501", 500, 501, false},
+		{"1000", "100", "", "0", 1000, 0, false},
+		{"1000", "100", "etcd", "", -1, -1, true},
+	}
+
+	for i, tt := range tests {
+		var annotations types.Annotations
+		if tt.fuid != "" {
+			annotations.Set(rktcommon.FlyUIDAnnotation, tt.fuid)
+		}
+		if tt.fgid != "" {
+			annotations.Set(rktcommon.FlyGIDAnnotation, tt.fgid)
+		}
+		uid, gid, err := AppUserGroup(&types.App{User: tt.user, Group: tt.group}, annotations)
+		if gotErr := err != nil; gotErr != tt.werr {
+			t.Errorf("#%d: expected error %t, got %v", i, tt.werr, err)
+			continue
+		}
+		if uid != tt.uid || gid != tt.gid {
+			t.Errorf("#%d: expected %d:%d, got %d:%d", i, tt.uid, tt.gid, uid, gid)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	stage1lib "github.com/coreos/rkt/pkg/stage1"
+	flycommon "github.com/coreos/rkt/stage1_fly/common"
+)
+
+// envList implements the flag.Value interface to contain the environment
+// variables set with --env, in the form NAME=VALUE.
+type envList []string
+
+func (l *envList) String() string {
+	return strings.Join(*l, " ")
+}
+
+func (l *envList) Set(s string) error {
+	if !strings.Contains(s, "=") {
+		return fmt.Errorf("environment variable must be specified as name=value")
+	}
+	*l = append(*l, s)
+	return nil
+}
+
+var (
+	pid     int
+	appName string
+	env     envList
+	workDir string
+)
+
+func init() {
+	flag.IntVar(&pid, "pid", 0, "PID of the app process of the pod")
+	flag.StringVar(&appName, "appname", "", "Name of the app to enter")
+	flag.Var(&env, "env", "Environment variable of the command, in the form NAME=VALUE")
+	flag.StringVar(&workDir, "workdir", "/", "Working directory of the command")
+}
+
+func enter() int {
+	args := flag.Args()
+	if pid <= 0 || appName == "" || len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: enter --pid=PID --appname=NAME [--env=NAME=VALUE]... [--workdir=DIR] -- CMD [ARGS...]")
+		return 1
+	}
+
+	// we are in the directory of the pod, named after its UUID
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot get the pod directory: %v\n", err)
+		return 1
+	}
+	uuid, err := types.NewUUID(filepath.Base(cwd))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot get the pod UUID: %v\n", err)
+		return 1
+	}
+	p, err := stage1lib.LoadPod(".", uuid)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load pod: %v\n", err)
+		return 1
+	}
+	name, err := types.NewACName(appName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid app name %q: %v\n", appName, err)
+		return 1
+	}
+	ra := p.Manifest.Apps.Get(*name)
+	if ra == nil {
+		fmt.Fprintf(os.Stderr, "App %q not found in the pod\n", appName)
+		return 1
+	}
+
+	uid, gid, err := flycommon.AppUserGroup(ra.App, p.Manifest.Annotations)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "App %q: %v\n", ra.Name, err)
+		return 1
+	}
+
+	// the root of the app process is the rootfs of the app, with the
+	// volumes mounted in its mount namespace
+	root := fmt.Sprintf("/proc/%d/root", pid)
+	if err := syscall.Chroot(root); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to chroot to %q: %v\n", root, err)
+		return 1
+	}
+	if err := os.Chdir(workDir); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to change to the working directory: %v\n", err)
+		return 1
+	}
+	if err := flycommon.SetUser(uid, gid); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+
+	// the variables given with --env override the ones of the app
+	for _, e := range env {
+		kv := strings.SplitN(e, "=", 2)
+		ra.App.Environment.Set(kv[0], kv[1])
+	}
+	if err := syscall.Exec(args[0], args, flycommon.AppEnv(ra)); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to execute %q: %v\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+func main() {
+	flag.Parse()
+	os.Exit(enter())
+}
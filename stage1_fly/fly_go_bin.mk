@@ -0,0 +1,29 @@
+# Builds the go binary of an entrypoint of the fly stage1 and installs
+# it in the root of the ACI rootfs. This file should be included with
+# a standard include directive, the name of the binary is deduced from
+# the name of the including Makefile.
+
+_FGB_PATH_ := $(lastword $(MAKEFILE_LIST))
+_FGB_NAME_ := $(patsubst %.mk,%,$(MK_FILENAME))
+_FGB_BINARY_ := $(TOOLSDIR)/fly-$(_FGB_NAME_)
+_FGB_ACI_BINARY_ := $(FLY_ACIROOTFSDIR)/$(_FGB_NAME_)
+
+$(call setup-stamp-file,_FGB_BUILD_STAMP_,binary-build)
+$(call generate-stamp-rule,$(_FGB_BUILD_STAMP_))
+
+# variables for makelib/build_go_bin.mk
+BGB_STAMP := $(_FGB_BUILD_STAMP_)
+BGB_BINARY := $(_FGB_BINARY_)
+BGB_PKG_IN_REPO := $(call go-pkg-from-dir)
+
+include makelib/build_go_bin.mk
+
+CLEAN_FILES += $(_FGB_BINARY_)
+
+$(_FGB_BINARY_): $(_FGB_PATH_) $(MK_PATH) | $(TOOLSDIR)
+
+INSTALL_FILES += $(_FGB_BINARY_):$(_FGB_ACI_BINARY_):-
+$(call add-dependency,$(_FGB_ACI_BINARY_),$(_FGB_BUILD_STAMP_))
+FLY_ACI_FILES += $(_FGB_ACI_BINARY_)
+
+$(call undefine-namespaces,FGB _FGB)
@@ -0,0 +1,71 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	flycommon "github.com/coreos/rkt/stage1_fly/common"
+)
+
+var (
+	debug bool
+)
+
+func init() {
+	flag.BoolVar(&debug, "debug", false, "Run in debug mode")
+}
+
+// The fly stage1 allocates no resources outside of the pod directory: the
+// mounts of the app live in its mount namespace, which goes away with it,
+// and it uses the network of the host. The only exception is the subcgroup
+// of the legacy cpuset hierarchy the app may have been pinned with.
+func main() {
+	flag.Parse()
+
+	if _, err := types.NewUUID(flag.Arg(0)); err != nil {
+		fmt.Fprintln(os.Stderr, "UUID is missing or malformed")
+		os.Exit(1)
+	}
+
+	if err := removeCpusetCgroup(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to remove the cpuset subcgroup: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// removeCpusetCgroup removes the cpuset subcgroup recorded in the pod, whose
+// root is our working directory.
+func removeCpusetCgroup() error {
+	subcgroup, err := ioutil.ReadFile(flycommon.CpusetCgroupFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	err = os.Remove(filepath.Join("/sys/fs/cgroup/cpuset", string(subcgroup)))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common/cgroup"
+	"github.com/coreos/rkt/common/cpuset"
+	flycommon "github.com/coreos/rkt/stage1_fly/common"
+)
+
+// applyCpuset pins the app to the CPUs and the memory nodes of its cpuset
+// isolator. On the legacy hierarchy the app joins a subcgroup of our cpuset
+// cgroup, recorded in the pod so gc can remove it. On the unified hierarchy
+// the cpuset controller cannot be enabled below our cgroup, as it has
+// processes, so the CPU affinity and the memory policy are set instead.
+func applyCpuset(podRoot string, uuid *types.UUID, ra *schema.RuntimeApp) error {
+	var c *cpuset.Cpuset
+	for _, i := range ra.App.Isolators {
+		if v, ok := i.Value().(*cpuset.Cpuset); ok {
+			c = v
+		}
+	}
+	if c == nil {
+		return nil
+	}
+
+	unified, err := cgroup.IsUnified()
+	if err != nil {
+		return err
+	}
+	if unified || !cgroup.IsControllerMounted("cpuset") {
+		log.Printf("Setting the CPU affinity to %q and the memory nodes to %q", c.CPUs(), c.Mems())
+		if c.CPUs() != "" {
+			if err := cpuset.SetAffinity(c.CPUs()); err != nil {
+				return err
+			}
+		}
+		if c.Mems() != "" {
+			if err := cpuset.SetMemPolicy(c.Mems()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	ownCgroup, err := cgroup.GetOwnCgroupPath("cpuset")
+	if err != nil {
+		return fmt.Errorf("error getting our cpuset cgroup: %v", err)
+	}
+	subcgroup := filepath.Join(ownCgroup, "rkt-"+uuid.String())
+	if err := ioutil.WriteFile(filepath.Join(podRoot, flycommon.CpusetCgroupFile), []byte(subcgroup), 0644); err != nil {
+		return fmt.Errorf("error recording the cpuset subcgroup: %v", err)
+	}
+	log.Printf("Joining the cpuset subcgroup %q", subcgroup)
+	return cgroup.JoinCpusetSubcgroup(subcgroup, c.CPUs(), c.Mems())
+}
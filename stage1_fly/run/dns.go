@@ -0,0 +1,168 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+)
+
+const (
+	resolvConfPath = "/etc/resolv.conf"
+	hostsPath      = "/etc/hosts"
+)
+
+// noResolvConf is the resolv.conf file without name server
+var noResolvConf = []byte("# no name server, generated by rkt\n")
+
+// hostRoot is the root of the host the files are read from, changed by the
+// tests
+var hostRoot = "/"
+
+// dnsFiles returns the contents of the resolv.conf and hosts files of the
+// app for the DNS mode of the fly-dns annotation, nil for the files of the
+// host to be used. A missing file of the host is replaced by a generated
+// one, like the hosts file stage1 writes in the apps of the other flavors.
+func dnsFiles(annotations types.Annotations) ([]byte, []byte, error) {
+	mode := common.FlyDNSHost
+	var servers []string
+	if v, ok := annotations.Get(common.FlyDNSAnnotation); ok {
+		var err error
+		if mode, servers, err = common.ParseFlyDNS(v); err != nil {
+			return nil, nil, fmt.Errorf("invalid %s annotation: %v", common.FlyDNSAnnotation, err)
+		}
+	}
+
+	var resolvConf, hosts []byte
+	switch mode {
+	case common.FlyDNSNone:
+		resolvConf = noResolvConf
+	case common.FlyDNSServers:
+		var lines []string
+		for _, s := range servers {
+			lines = append(lines, "nameserver "+s)
+		}
+		resolvConf = []byte(strings.Join(lines, "\n") + "\n")
+	}
+
+	if resolvConf == nil && !exists(filepath.Join(hostRoot, resolvConfPath)) {
+		resolvConf = noResolvConf
+	}
+	// the app shares the network of the host, so it resolves the names of
+	// the host like the host does, unless it has no name server
+	if mode == common.FlyDNSNone || !exists(filepath.Join(hostRoot, hostsPath)) {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot get the hostname: %v", err)
+		}
+		hosts = []byte(fmt.Sprintf("127.0.0.1\t%s\tlocalhost\tlocalhost.localdomain\n", hostname))
+	}
+	return resolvConf, hosts, nil
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// dnsMounts returns the read-only mounts of the resolv.conf and hosts files
+// of the DNS mode of the pod over the ones of the image, so the app does
+// not use whatever its image contains. The generated files are written in
+// dir. A volume mounted on one of these files takes precedence over it.
+func dnsMounts(annotations types.Annotations, dir, rootfs string, volMounts []*flyMount) ([]*flyMount, error) {
+	resolvConf, hosts, err := dnsFiles(annotations)
+	if err != nil {
+		return nil, err
+	}
+
+	var mounts []*flyMount
+	for _, f := range []struct {
+		path    string
+		content []byte
+	}{
+		{resolvConfPath, resolvConf},
+		{hostsPath, hosts},
+	} {
+		if hasMountTarget(volMounts, f.path) {
+			continue
+		}
+		source := filepath.Join(hostRoot, f.path)
+		if f.content != nil {
+			source = filepath.Join(dir, filepath.Base(f.path))
+			if err := os.MkdirAll(dir, sharedVolPerm); err != nil {
+				return nil, fmt.Errorf("cannot create %q: %v", dir, err)
+			}
+			if err := ioutil.WriteFile(source, f.content, 0644); err != nil {
+				return nil, fmt.Errorf("cannot write %q: %v", source, err)
+			}
+		}
+		if err := removeTargetSymlink(rootfs, f.path); err != nil {
+			return nil, err
+		}
+		mounts = append(mounts, &flyMount{
+			volume:   "dns",
+			source:   source,
+			target:   f.path,
+			readOnly: true,
+		})
+	}
+	return mounts, nil
+}
+
+// removeTargetSymlink removes the file of the image at path if it is a
+// symlink, which would be followed out of the rootfs when mounting on it.
+// The directories of path are checked too: they cannot be removed without
+// breaking the image, so an error is returned if one of them is a symlink.
+func removeTargetSymlink(rootfs, path string) error {
+	target := rootfs
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i, part := range parts {
+		target = filepath.Join(target, part)
+		fi, err := os.Lstat(target)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("cannot stat %q: %v", target, err)
+		}
+		if fi.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		if i < len(parts)-1 {
+			return fmt.Errorf("cannot mount on %q: %q is a symlink", path, target)
+		}
+		if err := os.Remove(target); err != nil {
+			return fmt.Errorf("cannot remove the symlink %q: %v", target, err)
+		}
+	}
+	return nil
+}
+
+func hasMountTarget(mounts []*flyMount, target string) bool {
+	for _, m := range mounts {
+		if filepath.Clean("/"+m.target) == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+)
+
+func TestDNSMounts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fly-dns")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(root string) { hostRoot = root }(hostRoot)
+	hostRoot = filepath.Join(dir, "host")
+	hostResolvConf := filepath.Join(hostRoot, resolvConfPath)
+	if err := os.MkdirAll(filepath.Dir(hostResolvConf), 0755); err != nil {
+		t.Fatalf("error creating host etc: %v", err)
+	}
+	if err := ioutil.WriteFile(hostResolvConf, []byte("nameserver 10.0.0.53\n"), 0644); err != nil {
+		t.Fatalf("error writing host resolv.conf: %v", err)
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatalf("error getting hostname: %v", err)
+	}
+	generatedHosts := "127.0.0.1\t" + hostname + "\tlocalhost\tlocalhost.localdomain\n"
+
+	// the image's resolv.conf is a symlink out of its rootfs
+	rootfs := filepath.Join(dir, "rootfs")
+	if err := os.MkdirAll(filepath.Join(rootfs, "etc"), 0755); err != nil {
+		t.Fatalf("error creating rootfs etc: %v", err)
+	}
+	if err := os.Symlink("/run/resolv.conf", filepath.Join(rootfs, resolvConfPath)); err != nil {
+		t.Fatalf("error creating symlink: %v", err)
+	}
+
+	tests := []struct {
+		dns       string
+		volMounts []*flyMount
+		// the content of the mounted files, by target
+		files map[string]string
+		err   bool
+	}{
+		{
+			"",
+			nil,
+			map[string]string{
+				resolvConfPath: "nameserver 10.0.0.53\n",
+				hostsPath:      generatedHosts,
+			},
+			false,
+		},
+		{
+			"none",
+			nil,
+			map[string]string{
+				resolvConfPath: string(noResolvConf),
+				hostsPath:      generatedHosts,
+			},
+			false,
+		},
+		{
+			"10.1.1.1,10.1.1.2",
+			[]*flyMount{{volume: "hosts", source: dir, target: "/etc/hosts"}},
+			map[string]string{
+				resolvConfPath: "nameserver 10.1.1.1\nnameserver 10.1.1.2\n",
+			},
+			false,
+		},
+		{"dns.example.com", nil, nil, true},
+	}
+
+	for i, tt := range tests {
+		annotations := types.Annotations{}
+		if tt.dns != "" {
+			annotations.Set(common.FlyDNSAnnotation, tt.dns)
+		}
+		mounts, err := dnsMounts(annotations, filepath.Join(dir, "dns"), rootfs, tt.volMounts)
+		if gotErr := err != nil; gotErr != tt.err {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.err)
+			continue
+		}
+		if len(mounts) != len(tt.files) {
+			t.Errorf("#%d: got %d mounts, want %d", i, len(mounts), len(tt.files))
+			continue
+		}
+		for _, m := range mounts {
+			want, ok := tt.files[m.target]
+			if !ok {
+				t.Errorf("#%d: unexpected mount on %q", i, m.target)
+				continue
+			}
+			if !m.readOnly {
+				t.Errorf("#%d: mount on %q is not read-only", i, m.target)
+			}
+			b, err := ioutil.ReadFile(m.source)
+			if err != nil {
+				t.Errorf("#%d: error reading %q: %v", i, m.source, err)
+				continue
+			}
+			if string(b) != want {
+				t.Errorf("#%d: %q has %q, want %q", i, m.target, b, want)
+			}
+		}
+	}
+
+	if _, err := os.Lstat(filepath.Join(rootfs, resolvConfPath)); !os.IsNotExist(err) {
+		t.Errorf("the symlink of the image was not removed: %v", err)
+	}
+}
+
+func TestRemoveTargetSymlink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fly-dns")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the etc directory of the image is a symlink out of its rootfs
+	rootfs := filepath.Join(dir, "rootfs")
+	if err := os.MkdirAll(rootfs, 0755); err != nil {
+		t.Fatalf("error creating rootfs: %v", err)
+	}
+	if err := os.Symlink(dir, filepath.Join(rootfs, "etc")); err != nil {
+		t.Fatalf("error creating symlink: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "resolv.conf"), nil, 0644); err != nil {
+		t.Fatalf("error writing resolv.conf: %v", err)
+	}
+
+	tests := []struct {
+		path string
+		err  bool
+	}{
+		{resolvConfPath, true},
+		{"/usr/etc/resolv.conf", false},
+	}
+	for i, tt := range tests {
+		err := removeTargetSymlink(rootfs, tt.path)
+		if gotErr := err != nil; gotErr != tt.err {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "resolv.conf")); err != nil {
+		t.Errorf("the file out of the rootfs was touched: %v", err)
+	}
+}
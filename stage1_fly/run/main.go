@@ -0,0 +1,278 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/common/cpuset"
+	stage1lib "github.com/coreos/rkt/pkg/stage1"
+	initcommon "github.com/coreos/rkt/stage1/init/common"
+	flycommon "github.com/coreos/rkt/stage1_fly/common"
+)
+
+var (
+	debug        bool
+	netList      common.NetList
+	interactive  bool
+	privateUsers string
+	mdsToken     string
+	localConfig  string
+)
+
+func init() {
+	flag.BoolVar(&debug, "debug", false, "Run in debug mode")
+	flag.Var(&netList, "net", "Setup networking")
+	flag.BoolVar(&interactive, "interactive", false, "The pod is interactive")
+	flag.StringVar(&privateUsers, "private-users", "", "Run within user namespace. Can be set to [=UIDBASE[:NUIDS]]")
+	flag.StringVar(&mdsToken, "mds-token", "", "MDS auth token")
+	flag.StringVar(&localConfig, "local-config", common.DefaultLocalConfigDir, "Local config path")
+
+	// the mount namespace is unshared, and the AppArmor profile set, by
+	// the main thread, which then execs the app
+	runtime.LockOSThread()
+}
+
+// bindMount bind mounts source on target, creating target as a file or a
+// directory like source if it does not exist.
+func bindMount(source, target string, flags uintptr, readOnly bool) error {
+	fi, err := os.Stat(source)
+	if err != nil {
+		return fmt.Errorf("cannot stat %q: %v", source, err)
+	}
+	if fi.IsDir() {
+		err = os.MkdirAll(target, sharedVolPerm)
+	} else if err = os.MkdirAll(filepath.Dir(target), sharedVolPerm); err == nil {
+		var f *os.File
+		if f, err = os.OpenFile(target, os.O_CREATE, 0644); err == nil {
+			f.Close()
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("cannot create mount point %q: %v", target, err)
+	}
+
+	if err := syscall.Mount(source, target, "", syscall.MS_BIND|flags, ""); err != nil {
+		return fmt.Errorf("cannot bind mount %q on %q: %v", source, target, err)
+	}
+	if readOnly {
+		if err := syscall.Mount("", target, "", syscall.MS_REMOUNT|syscall.MS_BIND|syscall.MS_RDONLY, ""); err != nil {
+			return fmt.Errorf("cannot remount %q read-only: %v", target, err)
+		}
+	}
+	return nil
+}
+
+// setupRootfs mounts the API file systems of the host and the volumes of the
+// app in its rootfs, in a new mount namespace. If readOnly is true, the
+// rootfs itself is made read-only, the mounts in it are not.
+func setupRootfs(rootfs string, mounts []*flyMount, readOnly bool) error {
+	if err := syscall.Unshare(syscall.CLONE_NEWNS); err != nil {
+		return fmt.Errorf("error unsharing: %v", err)
+	}
+	// mount events from the host still propagate to the app, but not
+	// the other way around
+	if err := syscall.Mount("", "/", "none", syscall.MS_REC|syscall.MS_SLAVE, ""); err != nil {
+		return fmt.Errorf("error making / a slave mount: %v", err)
+	}
+
+	if readOnly {
+		// the rootfs is bind mounted on itself, so it can be remounted
+		// read-only once the other mounts are done in it
+		if err := syscall.Mount(rootfs, rootfs, "", syscall.MS_BIND, ""); err != nil {
+			return fmt.Errorf("cannot bind mount the rootfs: %v", err)
+		}
+	}
+
+	for _, dir := range []string{"/proc", "/dev", "/sys"} {
+		if err := bindMount(dir, filepath.Join(rootfs, dir), syscall.MS_REC, false); err != nil {
+			return err
+		}
+	}
+
+	// the mounts are ordered, so the nested mounts are not shadowed
+	for _, m := range mounts {
+		log.Printf("Mounting %q on %q (read-only: %t)", m.source, m.target, m.readOnly)
+		if err := bindMount(m.source, filepath.Join(rootfs, m.target), 0, m.readOnly); err != nil {
+			return err
+		}
+	}
+
+	if readOnly {
+		if err := syscall.Mount("", rootfs, "", syscall.MS_REMOUNT|syscall.MS_BIND|syscall.MS_RDONLY, ""); err != nil {
+			return fmt.Errorf("cannot remount the rootfs read-only: %v", err)
+		}
+	}
+	return nil
+}
+
+func stage1() int {
+	uuid, err := types.NewUUID(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "UUID is missing or malformed")
+		return 1
+	}
+
+	if netList.Contained() || netList.None() {
+		fmt.Fprintf(os.Stderr, "The fly stage1 only supports host networking (--net=host)\n")
+		return 1
+	}
+	if privateUsers != "" {
+		fmt.Fprintf(os.Stderr, "The fly stage1 does not support user namespaces\n")
+		return 1
+	}
+	if mdsToken != "" {
+		fmt.Fprintf(os.Stderr, "The fly stage1 does not support the metadata service\n")
+		return 1
+	}
+
+	root := "."
+	p, err := stage1lib.LoadPod(root, uuid)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load pod: %v\n", err)
+		return 1
+	}
+	if len(p.Manifest.Apps) != 1 {
+		fmt.Fprintf(os.Stderr, "The fly stage1 only supports pods with a single app, got %d\n", len(p.Manifest.Apps))
+		return 1
+	}
+	ra := &p.Manifest.Apps[0]
+	if ra.App == nil || len(ra.App.Exec) == 0 {
+		fmt.Fprintf(os.Stderr, "App %q has no exec command\n", ra.Name)
+		return 1
+	}
+
+	// there is no service manager to stop the app when the pod times out
+	if _, ok := p.Manifest.Annotations.Get(common.TimeoutAnnotation); ok {
+		fmt.Fprintf(os.Stderr, "The fly stage1 does not support the pod timeout\n")
+		return 1
+	}
+
+	if err := checkAnnotations(p, ra); err != nil {
+		fmt.Fprintf(os.Stderr, "App %q: %v\n", ra.Name, err)
+		return 1
+	}
+	readOnly, err := initcommon.IsReadOnlyRootFS(ra, p.Images[ra.Name.String()])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "App %q: %v\n", ra.Name, err)
+		return 1
+	}
+
+	uid, gid, err := flycommon.AppUserGroup(ra.App, p.Manifest.Annotations)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "App %q: %v\n", ra.Name, err)
+		return 1
+	}
+
+	mounts, err := evaluateMounts(p, ra)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to evaluate the mounts: %v\n", err)
+		return 1
+	}
+
+	rootfs, err := filepath.Abs(common.AppRootfsPath(p.Root, ra.Name))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot get the app rootfs absolute path: %v\n", err)
+		return 1
+	}
+	dnsDir, err := filepath.Abs(filepath.Join(p.Root, "dns"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot get the DNS files absolute path: %v\n", err)
+		return 1
+	}
+	dns, err := dnsMounts(p.Manifest.Annotations, dnsDir, rootfs, mounts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to set up the DNS files: %v\n", err)
+		return 1
+	}
+	// the DNS files may be nested in a volume
+	mounts = append(mounts, dns...)
+	if err := orderMounts(mounts); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to evaluate the mounts: %v\n", err)
+		return 1
+	}
+
+	if err := setupRootfs(rootfs, mounts, readOnly); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to set up the app rootfs: %v\n", err)
+		return 2
+	}
+
+	if err := applyCpuset(p.Root, uuid, ra); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to apply the %s isolator: %v\n", cpuset.IsolatorName, err)
+		return 2
+	}
+
+	// the app replaces this process, so it keeps our PID and the lock
+	// of the pod until it exits
+	if err := stage1lib.WritePid(p.Root, os.Getpid()); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 4
+	}
+
+	if err := applyRlimits(ra); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 2
+	}
+	if err := setAppArmorProfile(p, ra); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 2
+	}
+
+	if err := syscall.Chroot(rootfs); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to chroot to %q: %v\n", rootfs, err)
+		return 2
+	}
+	if err := os.Chdir(flycommon.AppWorkDir(ra.App)); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to change to the working directory: %v\n", err)
+		return 2
+	}
+	if err := flycommon.SetUser(uid, gid); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 2
+	}
+	if err := setNoNewPrivileges(p, ra); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 2
+	}
+
+	args := ra.App.Exec
+	if err := syscall.Exec(args[0], args, flycommon.AppEnv(ra)); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to execute %q: %v\n", args[0], err)
+		return 7
+	}
+	return 0
+}
+
+func main() {
+	flag.Parse()
+
+	if !debug {
+		log.SetOutput(ioutil.Discard)
+	}
+
+	// move code into stage1() helper so defered fns get run
+	os.Exit(stage1())
+}
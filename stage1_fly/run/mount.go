@@ -0,0 +1,176 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+	stage1lib "github.com/coreos/rkt/pkg/stage1"
+	initcommon "github.com/coreos/rkt/stage1/init/common"
+)
+
+const sharedVolPerm = os.FileMode(0755)
+
+// flyMount is a bind mount of a host path into the rootfs of the app.
+type flyMount struct {
+	volume   types.ACName
+	source   string
+	target   string // relative to the rootfs of the app
+	readOnly bool
+}
+
+// depth returns the number of components of the target path.
+func (m *flyMount) depth() int {
+	if m.target == "/" {
+		return 0
+	}
+	return strings.Count(m.target, "/")
+}
+
+// byTargetDepth orders the mounts so a mount comes after the mounts of the
+// parent directories of its target, the ones with the same depth being
+// ordered by target.
+type byTargetDepth []*flyMount
+
+func (ms byTargetDepth) Len() int      { return len(ms) }
+func (ms byTargetDepth) Swap(i, j int) { ms[i], ms[j] = ms[j], ms[i] }
+func (ms byTargetDepth) Less(i, j int) bool {
+	di, dj := ms[i].depth(), ms[j].depth()
+	if di != dj {
+		return di < dj
+	}
+	return ms[i].target < ms[j].target
+}
+
+// isParent returns whether the path parent is a parent directory of path.
+func isParent(parent, path string) bool {
+	return parent == "/" || strings.HasPrefix(path, parent+"/")
+}
+
+// orderMounts sorts the mounts by target depth, so the nested mounts are
+// done after the mounts they are nested in, instead of being shadowed by
+// them. It returns an error if two mounts have the same target, or if a
+// mount is nested in a mount of a file.
+func orderMounts(mounts []*flyMount) error {
+	for _, m := range mounts {
+		m.target = filepath.Clean("/" + m.target)
+	}
+	sort.Sort(byTargetDepth(mounts))
+
+	for i, m := range mounts {
+		for _, prev := range mounts[:i] {
+			if prev.target == m.target {
+				return fmt.Errorf("volumes %q and %q are both mounted on %q", prev.volume, m.volume, m.target)
+			}
+			if !isParent(prev.target, m.target) {
+				continue
+			}
+			if fi, err := os.Stat(prev.source); err == nil && !fi.IsDir() {
+				return fmt.Errorf("volume %q cannot be mounted on %q, in the file %q of volume %q", m.volume, m.target, prev.target, prev.volume)
+			}
+		}
+	}
+	return nil
+}
+
+// checkMountAllowed returns an error if the source of the host volume is not
+// in the host paths the pod is allowed to mount.
+func checkMountAllowed(vol types.Volume, allow []string) error {
+	ok, err := common.IsFlyMountAllowed(vol.Source, allow)
+	if err != nil {
+		return fmt.Errorf("cannot check the source of volume %q: %v", vol.Name, err)
+	}
+	if !ok {
+		return fmt.Errorf("volume %q cannot be mounted: its source %q is not in the allowed host paths %q", vol.Name, vol.Source, strings.Join(allow, ","))
+	}
+	return nil
+}
+
+// evaluateMounts returns the bind mounts of the volumes of the app, in the
+// order they must be done. If the pod has the fly-mounts-allow annotation,
+// the host volumes must be in the host paths it allows.
+func evaluateMounts(p *stage1lib.Pod, ra *schema.RuntimeApp) ([]*flyMount, error) {
+	vols := make(map[types.ACName]types.Volume)
+	for _, v := range p.Manifest.Volumes {
+		vols[v.Name] = v
+	}
+
+	absRoot, err := filepath.Abs(p.Root)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get pod's root absolute path: %v", err)
+	}
+
+	// fly has no mount namespace of its own to mount them in
+	if _, ok := p.Manifest.Annotations.Get(common.NetworkVolumesAnnotation); ok {
+		return nil, fmt.Errorf("nfs and cifs volumes are not supported by fly")
+	}
+	// nor to bind the timezone and locale files in
+	_, hasTimezone := p.Manifest.Annotations.Get(common.TimezoneAnnotation)
+	_, hasLocale := p.Manifest.Annotations.Get(common.LocaleAnnotation)
+	if hasTimezone || hasLocale {
+		return nil, fmt.Errorf("the timezone and locale options are not supported by fly")
+	}
+
+	var allow []string
+	if v, ok := p.Manifest.Annotations.Get(common.FlyMountsAllowAnnotation); ok {
+		if allow, err = common.ParseFlyMountsAllow(v); err != nil {
+			return nil, fmt.Errorf("invalid %s annotation: %v", common.FlyMountsAllowAnnotation, err)
+		}
+	}
+
+	var mounts []*flyMount
+	for _, m := range initcommon.GenerateMounts(ra, vols) {
+		vol := vols[m.Volume]
+
+		var source string
+		switch vol.Kind {
+		case "host":
+			source = vol.Source
+			if allow != nil {
+				if err := checkMountAllowed(vol, allow); err != nil {
+					return nil, err
+				}
+			}
+		case "empty":
+			source = filepath.Join(common.SharedVolumesPath(absRoot), vol.Name.String())
+			if err := os.MkdirAll(source, sharedVolPerm); err != nil {
+				return nil, fmt.Errorf("could not create shared volume %q: %v", vol.Name, err)
+			}
+		default:
+			return nil, fmt.Errorf(`invalid volume kind %q. Must be one of "host" or "empty".`, vol.Kind)
+		}
+
+		mounts = append(mounts, &flyMount{
+			volume:   vol.Name,
+			source:   source,
+			target:   m.Path,
+			readOnly: initcommon.IsMountReadOnly(vol, ra.App.MountPoints),
+		})
+	}
+
+	if err := orderMounts(mounts); err != nil {
+		return nil, err
+	}
+	return mounts, nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOrderMounts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fly-mounts")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(file, nil, 0644); err != nil {
+		t.Fatalf("error writing file: %v", err)
+	}
+
+	tests := []struct {
+		mounts  []*flyMount
+		targets []string
+		err     bool
+	}{
+		{
+			[]*flyMount{
+				{volume: "foo", source: dir, target: "/var/lib/foo"},
+				{volume: "var", source: dir, target: "/var"},
+				{volume: "etc", source: dir, target: "/etc"},
+			},
+			[]string{"/etc", "/var", "/var/lib/foo"},
+			false,
+		},
+		{
+			[]*flyMount{
+				{volume: "b", source: dir, target: "b/c/"},
+				{volume: "a", source: dir, target: "/a/./b"},
+				{volume: "root", source: dir, target: "/"},
+			},
+			[]string{"/", "/a/b", "/b/c"},
+			false,
+		},
+		// siblings sharing a prefix are not nested
+		{
+			[]*flyMount{
+				{volume: "varlib", source: dir, target: "/var/lib"},
+				{volume: "file", source: file, target: "/var/li"},
+			},
+			[]string{"/var/li", "/var/lib"},
+			false,
+		},
+		{
+			[]*flyMount{
+				{volume: "a", source: dir, target: "/var/"},
+				{volume: "b", source: dir, target: "/var"},
+			},
+			nil,
+			true,
+		},
+		{
+			[]*flyMount{
+				{volume: "conf", source: dir, target: "/etc/foo.conf/bar"},
+				{volume: "file", source: file, target: "/etc/foo.conf"},
+			},
+			nil,
+			true,
+		},
+	}
+
+	for i, tt := range tests {
+		err := orderMounts(tt.mounts)
+		if tt.err {
+			if err == nil {
+				t.Errorf("#%d: expected an error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+			continue
+		}
+		var targets []string
+		for _, m := range tt.mounts {
+			targets = append(targets, m.target)
+		}
+		if len(targets) != len(tt.targets) {
+			t.Errorf("#%d: expected targets %v, got %v", i, tt.targets, targets)
+			continue
+		}
+		for j := range targets {
+			if targets[j] != tt.targets[j] {
+				t.Errorf("#%d: expected targets %v, got %v", i, tt.targets, targets)
+				break
+			}
+		}
+	}
+}
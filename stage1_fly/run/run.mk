@@ -0,0 +1 @@
+include stage1_fly/fly_go_bin.mk
@@ -0,0 +1,110 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/common/rlimit"
+	stage1lib "github.com/coreos/rkt/pkg/stage1"
+	initcommon "github.com/coreos/rkt/stage1/init/common"
+)
+
+// prSetNoNewPrivs is PR_SET_NO_NEW_PRIVS, see prctl(2)
+const prSetNoNewPrivs = 38
+
+// unsupportedPodAnnotations are the pod annotations the fly stage1 cannot
+// honor: the devices of the host are all available in the app.
+var unsupportedPodAnnotations = []string{
+	common.DevicesAnnotation,
+}
+
+// unsupportedAppAnnotations are the app annotations the fly stage1 cannot
+// honor, as the app runs with the /proc and /sys of the host and without a
+// seccomp filter.
+var unsupportedAppAnnotations = []string{
+	common.SeccompProfileAnnotation,
+	common.MaskProcPathsAnnotation,
+	common.ReadOnlySysAnnotation,
+}
+
+// checkAnnotations fails if the pod or its app have annotations the fly
+// stage1 cannot honor, rather than running the app without them.
+func checkAnnotations(p *stage1lib.Pod, ra *schema.RuntimeApp) error {
+	for _, name := range unsupportedPodAnnotations {
+		if _, ok := p.Manifest.Annotations.Get(name); ok {
+			return fmt.Errorf("the fly stage1 does not support the %q annotation", name)
+		}
+	}
+	im := p.Images[ra.Name.String()]
+	for _, name := range unsupportedAppAnnotations {
+		if _, ok := initcommon.GetAppAnnotation(ra, im, name); ok {
+			return fmt.Errorf("the fly stage1 does not support the %q annotation", name)
+		}
+	}
+	return nil
+}
+
+// applyRlimits sets the resource limits of the rlimits isolator of the app
+// on this process, so the app inherits them. They must be set before
+// dropping the privileges, to raise the hard limits.
+func applyRlimits(ra *schema.RuntimeApp) error {
+	for _, i := range ra.App.Isolators {
+		if v, ok := i.Value().(*rlimit.Rlimits); ok {
+			if err := v.Limits().Apply(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// setNoNewPrivileges sets PR_SET_NO_NEW_PRIVS on this process, inherited by
+// the app, if the no-new-privileges annotation of the app is set.
+func setNoNewPrivileges(p *stage1lib.Pod, ra *schema.RuntimeApp) error {
+	noNewPrivs, err := initcommon.GetAppBoolAnnotation(ra, p.Images[ra.Name.String()], common.NoNewPrivilegesAnnotation)
+	if err != nil || !noNewPrivs {
+		return err
+	}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+		return fmt.Errorf("error setting PR_SET_NO_NEW_PRIVS: %v", errno)
+	}
+	return nil
+}
+
+// setAppArmorProfile makes the kernel confine the app with the AppArmor
+// profile of its annotation, if any, when this thread executes it, like
+// aa_change_onexec(3). The thread must stay locked until then.
+func setAppArmorProfile(p *stage1lib.Pod, ra *schema.RuntimeApp) error {
+	profile, ok := initcommon.GetAppAnnotation(ra, p.Images[ra.Name.String()], common.AppArmorProfileAnnotation)
+	if !ok {
+		return nil
+	}
+	f, err := os.OpenFile(fmt.Sprintf("/proc/self/task/%d/attr/exec", syscall.Gettid()), os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("cannot set the AppArmor profile %q: %v", profile, err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString("exec " + profile); err != nil {
+		return fmt.Errorf("cannot set the AppArmor profile %q: %v", profile, err)
+	}
+	return nil
+}
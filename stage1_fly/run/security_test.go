@@ -0,0 +1,67 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package main
+
+import (
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+	stage1lib "github.com/coreos/rkt/pkg/stage1"
+)
+
+func TestCheckAnnotations(t *testing.T) {
+	tests := []struct {
+		podAnnotation   string
+		appAnnotation   string
+		imageAnnotation string
+		err             bool
+	}{
+		{"", "", "", false},
+		{common.FlyUIDAnnotation, common.NoNewPrivilegesAnnotation, common.ReadOnlyRootFSAnnotation, false},
+		{common.DevicesAnnotation, "", "", true},
+		{"", common.SeccompProfileAnnotation, "", true},
+		{"", common.AppArmorProfileAnnotation, "", false},
+		{"", "", common.MaskProcPathsAnnotation, true},
+		{"", "", common.ReadOnlySysAnnotation, true},
+	}
+
+	for i, tt := range tests {
+		ra := schema.RuntimeApp{Name: "app"}
+		im := &schema.ImageManifest{}
+		pm := &schema.PodManifest{Apps: schema.AppList{ra}}
+		if tt.podAnnotation != "" {
+			pm.Annotations.Set(types.ACIdentifier(tt.podAnnotation), "1")
+		}
+		if tt.appAnnotation != "" {
+			ra.Annotations.Set(types.ACIdentifier(tt.appAnnotation), "true")
+		}
+		if tt.imageAnnotation != "" {
+			im.Annotations.Set(types.ACIdentifier(tt.imageAnnotation), "true")
+		}
+		p := &stage1lib.Pod{
+			Manifest: pm,
+			Images:   map[string]*schema.ImageManifest{"app": im},
+		}
+
+		err := checkAnnotations(p, &ra)
+		if gotErr := err != nil; gotErr != tt.err {
+			t.Errorf("#%d: err==%v, want errstate %t", i, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+# The fly stage1 runs the app of a pod directly on the host, in a
+# chroot. It needs none of the systemd-based machinery of the other
+# flavors (see stage1/stage1.mk), so its ACI is assembled here: its
+# rootfs only contains the entrypoints, built from the go packages in
+# the subdirectories.
+
+ifneq ($(filter fly,$(call commas-to-spaces,$(RKT_STAGE1_FLAVORS))),)
+
+FLY_ACIDIR := $(BUILDDIR)/aci-for-fly-flavor
+FLY_ACIROOTFSDIR := $(FLY_ACIDIR)/rootfs
+FLY_ACI_IMAGE := $(BINDIR)/stage1-fly.aci
+# files installed in the ACI directory, filled by the included
+# Makefiles
+FLY_ACI_FILES :=
+
+$(call setup-stamp-file,FLY_STAMP)
+
+INSTALL_DIRS += \
+	$(FLY_ACIDIR):- \
+	$(FLY_ACIROOTFSDIR):0755 \
+	$(addsuffix :0755,$(call dir-chain,$(FLY_ACIROOTFSDIR),opt/stage2))
+
+$(call inc-many,run/run.mk enter/enter.mk gc/gc.mk aci/aci.mk)
+
+$(call forward-vars,$(FLY_ACI_IMAGE), \
+	ACTOOL FLY_ACIDIR)
+$(FLY_ACI_IMAGE): $(FLY_ACI_FILES) $(ACTOOL_STAMP) | $(BINDIR)
+	$(VQ) \
+	$(call vb,vt,ACTOOL,$(call vsp,$@)) \
+	"$(ACTOOL)" build --overwrite --owner-root "$(FLY_ACIDIR)" "$@"
+
+$(call generate-stamp-rule,$(FLY_STAMP),$(FLY_ACI_IMAGE))
+
+# The fly stage1 image is appended to the rkt binary, followed by its
+# size as 20 decimal digits and a magic string, so rkt fly works
+# without a separate stage1 file. The magic must match flyEmbedMagic
+# in rkt/fly_embed.go.
+FLY_EMBED_MAGIC := rkt-stage1-fly01
+
+$(call forward-vars,$(RKT_BINARY), \
+	FLY_ACI_IMAGE FLY_EMBED_MAGIC RKT_BINARY_WITHOUT_FLY)
+$(RKT_BINARY): $(RKT_BINARY_WITHOUT_FLY) $(FLY_ACI_IMAGE) | $(BINDIR)
+	$(VQ) \
+	set -e; \
+	$(call vb,vt,EMBED,$(call vsp,$@)) \
+	cat "$(RKT_BINARY_WITHOUT_FLY)" "$(FLY_ACI_IMAGE)" >"$@.tmp"; \
+	printf '%020d%s' "$$(stat -c %s "$(FLY_ACI_IMAGE)")" "$(FLY_EMBED_MAGIC)" >>"$@.tmp"; \
+	chmod 0755 "$@.tmp"; \
+	mv "$@.tmp" "$@"
+
+$(RKT_STAMP): $(RKT_BINARY)
+
+TOPLEVEL_STAMPS += $(FLY_STAMP)
+CLEAN_FILES += $(FLY_ACI_IMAGE) $(RKT_BINARY)
+
+endif
+
+$(call undefine-namespaces,FLY)
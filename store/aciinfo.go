@@ -35,6 +35,10 @@ type ACIInfo struct {
 	// Latest defines if the ACI was imported using the latest pattern (no
 	// version label was provided on ACI discovery)
 	Latest bool
+	// Arch is the arch label of the variant chosen on ACI discovery when
+	// no image was found for the requested arch. It's empty when the
+	// image matches the requested arch or wasn't discovered.
+	Arch string
 }
 
 func NewACIInfo(blobKey string, latest bool, t time.Time) *ACIInfo {
@@ -48,7 +52,7 @@ func NewACIInfo(blobKey string, latest bool, t time.Time) *ACIInfo {
 
 func aciinfoRowScan(rows *sql.Rows, aciinfo *ACIInfo) error {
 	// This ordering MUST match that in schema.go
-	return rows.Scan(&aciinfo.BlobKey, &aciinfo.Name, &aciinfo.ImportTime, &aciinfo.LastUsedTime, &aciinfo.Latest)
+	return rows.Scan(&aciinfo.BlobKey, &aciinfo.Name, &aciinfo.ImportTime, &aciinfo.LastUsedTime, &aciinfo.Latest, &aciinfo.Arch)
 }
 
 // GetAciInfosWithKeyPrefix returns all the ACIInfos with a blobkey starting with the given prefix.
@@ -155,7 +159,7 @@ func WriteACIInfo(tx *sql.Tx, aciinfo *ACIInfo) error {
 	if err != nil {
 		return err
 	}
-	_, err = tx.Exec("INSERT into aciinfo (blobkey, name, importtime, lastusedtime, latest) VALUES ($1, $2, $3, $4, $5)", aciinfo.BlobKey, aciinfo.Name, aciinfo.ImportTime, aciinfo.LastUsedTime, aciinfo.Latest)
+	_, err = tx.Exec("INSERT into aciinfo (blobkey, name, importtime, lastusedtime, latest, arch) VALUES ($1, $2, $3, $4, $5, $6)", aciinfo.BlobKey, aciinfo.Name, aciinfo.ImportTime, aciinfo.LastUsedTime, aciinfo.Latest, aciinfo.Arch)
 	if err != nil {
 		return err
 	}
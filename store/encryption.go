@@ -0,0 +1,279 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/coreos/rkt/common"
+)
+
+// The encrypted blobs start with encryptedBlobMagic and a random nonce
+// prefix, followed by chunks of at most encryptedChunkSize bytes of the
+// blob, each sealed with AES-GCM:
+//
+//	flag (1 byte) | length of the sealed chunk (4 bytes) | sealed chunk
+//
+// The flag, 1 for the last chunk and 0 for the others, is authenticated
+// with the chunk so a truncated blob is detected. The nonce of a chunk is
+// the nonce prefix followed by the index of the chunk.
+const (
+	encryptedBlobMagic = "rktenc1\n"
+	encryptedChunkSize = 64 * 1024
+	noncePrefixSize    = 8
+	chunkHeaderSize    = 5
+
+	lastChunkFlag byte = 1
+
+	// the size of the authentication tag of a sealed chunk
+	gcmTagSize = 16
+)
+
+// ErrNoBlobKey is returned when reading an encrypted blob from a store
+// without encryption.
+var ErrNoBlobKey = errors.New("the image is encrypted but no store encryption key is configured")
+
+// EnableEncryption makes the store encrypt the blobs it writes with the
+// AES-256 key returned by getKey, and decrypt the encrypted blobs it reads.
+// getKey is called once, when the key is first needed. The blobs written
+// before are read as they are.
+func (s *Store) EnableEncryption(getKey func() ([]byte, error)) {
+	s.getBlobKey = getKey
+	s.blobAEAD = nil
+}
+
+// encryptsBlobs returns whether the store encrypts the blobs it writes.
+func (s *Store) encryptsBlobs() bool {
+	return s.getBlobKey != nil
+}
+
+// getBlobAEAD returns the cipher of the blobs, getting the key when first
+// called.
+func (s *Store) getBlobAEAD() (cipher.AEAD, error) {
+	if s.blobAEAD != nil {
+		return s.blobAEAD, nil
+	}
+	if s.getBlobKey == nil {
+		return nil, ErrNoBlobKey
+	}
+	key, err := s.getBlobKey()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get the store encryption key: %v", err)
+	}
+	aead, err := newBlobAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	s.blobAEAD = aead
+	return aead, nil
+}
+
+func newBlobAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != common.StoreKeySize {
+		return nil, fmt.Errorf("invalid store encryption key of %d bytes, must be %d bytes", len(key), common.StoreKeySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// newBlobReader returns a reader of the content of the blob read from r,
+// decrypting it if it is encrypted.
+func (s *Store) newBlobReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(encryptedBlobMagic))
+	if err != nil || string(magic) != encryptedBlobMagic {
+		// too short or not encrypted
+		return br, nil
+	}
+	aead, err := s.getBlobAEAD()
+	if err != nil {
+		return nil, err
+	}
+	return newDecryptingReader(br, aead)
+}
+
+// isEncryptedBlob returns whether the blob read from r is encrypted.
+func isEncryptedBlob(r io.Reader) (bool, error) {
+	magic := make([]byte, len(encryptedBlobMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// too short to be encrypted
+			return false, nil
+		}
+		return false, err
+	}
+	return string(magic) == encryptedBlobMagic, nil
+}
+
+// plainBlobSize returns the size of the content of an encrypted blob of the
+// given size. All the chunks but the last are full, so it is known without
+// decrypting the blob.
+func plainBlobSize(size int64) (int64, error) {
+	const sealedChunkSize = chunkHeaderSize + encryptedChunkSize + gcmTagSize
+	const chunkOverhead = chunkHeaderSize + gcmTagSize
+	chunks := size - int64(len(encryptedBlobMagic)+noncePrefixSize)
+	if chunks < chunkOverhead {
+		return 0, errors.New("truncated encrypted blob")
+	}
+	n := (chunks + sealedChunkSize - 1) / sealedChunkSize
+	if chunks-(n-1)*sealedChunkSize < chunkOverhead {
+		return 0, errors.New("corrupted encrypted blob")
+	}
+	return chunks - n*chunkOverhead, nil
+}
+
+// encryptingWriter encrypts what is written to it into an encrypted blob.
+// Close must be called to write the last chunk.
+type encryptingWriter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	prefix []byte
+	index  uint32
+	buf    []byte
+}
+
+func newEncryptingWriter(w io.Writer, aead cipher.AEAD) (*encryptingWriter, error) {
+	prefix := make([]byte, noncePrefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(w, encryptedBlobMagic); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(prefix); err != nil {
+		return nil, err
+	}
+	return &encryptingWriter{w: w, aead: aead, prefix: prefix}, nil
+}
+
+func (ew *encryptingWriter) Write(p []byte) (int, error) {
+	ew.buf = append(ew.buf, p...)
+	// a full chunk is only written once more data follows, so the last
+	// one is never empty unless the blob is
+	for len(ew.buf) > encryptedChunkSize {
+		if err := ew.writeChunk(ew.buf[:encryptedChunkSize], 0); err != nil {
+			return 0, err
+		}
+		ew.buf = ew.buf[encryptedChunkSize:]
+	}
+	return len(p), nil
+}
+
+// Close writes the last chunk. It does not close the underlying writer.
+func (ew *encryptingWriter) Close() error {
+	err := ew.writeChunk(ew.buf, lastChunkFlag)
+	ew.buf = nil
+	return err
+}
+
+func (ew *encryptingWriter) writeChunk(chunk []byte, flag byte) error {
+	sealed := ew.aead.Seal(nil, chunkNonce(ew.prefix, ew.index), chunk, []byte{flag})
+	ew.index++
+	if ew.index == 0 {
+		return errors.New("too many chunks in encrypted blob")
+	}
+	header := make([]byte, chunkHeaderSize)
+	header[0] = flag
+	binary.BigEndian.PutUint32(header[1:], uint32(len(sealed)))
+	if _, err := ew.w.Write(header); err != nil {
+		return err
+	}
+	_, err := ew.w.Write(sealed)
+	return err
+}
+
+// decryptingReader reads the content of an encrypted blob.
+type decryptingReader struct {
+	r      io.Reader
+	aead   cipher.AEAD
+	prefix []byte
+	index  uint32
+	buf    []byte
+	last   bool
+}
+
+// newDecryptingReader returns a reader of the content of the encrypted blob
+// read from r, which starts with encryptedBlobMagic.
+func newDecryptingReader(r io.Reader, aead cipher.AEAD) (*decryptingReader, error) {
+	header := make([]byte, len(encryptedBlobMagic)+noncePrefixSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("cannot read the header of the encrypted blob: %v", err)
+	}
+	if !bytes.HasPrefix(header, []byte(encryptedBlobMagic)) {
+		return nil, errors.New("not an encrypted blob")
+	}
+	return &decryptingReader{r: r, aead: aead, prefix: header[len(encryptedBlobMagic):]}, nil
+}
+
+func (dr *decryptingReader) Read(p []byte) (int, error) {
+	for len(dr.buf) == 0 {
+		if dr.last {
+			return 0, io.EOF
+		}
+		if err := dr.readChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, dr.buf)
+	dr.buf = dr.buf[n:]
+	return n, nil
+}
+
+func (dr *decryptingReader) readChunk() error {
+	header := make([]byte, chunkHeaderSize)
+	if _, err := io.ReadFull(dr.r, header); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return fmt.Errorf("truncated encrypted blob: %v", err)
+	}
+	flag := header[0]
+	size := binary.BigEndian.Uint32(header[1:])
+	if flag > lastChunkFlag || size > uint32(encryptedChunkSize+dr.aead.Overhead()) {
+		return errors.New("corrupted encrypted blob")
+	}
+	sealed := make([]byte, size)
+	if _, err := io.ReadFull(dr.r, sealed); err != nil {
+		return fmt.Errorf("truncated encrypted blob: %v", err)
+	}
+	chunk, err := dr.aead.Open(sealed[:0], chunkNonce(dr.prefix, dr.index), sealed, []byte{flag})
+	if err != nil {
+		return fmt.Errorf("cannot decrypt blob, wrong key or corrupted blob: %v", err)
+	}
+	dr.index++
+	dr.buf = chunk
+	dr.last = flag == lastChunkFlag
+	return nil
+}
+
+// chunkNonce returns the nonce of the chunk of an encrypted blob with the
+// given index.
+func chunkNonce(prefix []byte, index uint32) []byte {
+	nonce := make([]byte, noncePrefixSize+4)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], index)
+	return nonce
+}
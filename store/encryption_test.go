@@ -0,0 +1,239 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/pkg/aci"
+)
+
+func testBlobKey() []byte {
+	key := make([]byte, common.StoreKeySize)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	return key
+}
+
+func encryptBlob(t *testing.T, key, data []byte) []byte {
+	aead, err := newBlobAEAD(key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var buf bytes.Buffer
+	ew, err := newEncryptingWriter(&buf, aead)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := ew.Write(data); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := ew.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestBlobEncryption(t *testing.T) {
+	key := testBlobKey()
+	s := &Store{}
+	s.EnableEncryption(func() ([]byte, error) { return key, nil })
+
+	for i, size := range []int{0, 1, encryptedChunkSize, encryptedChunkSize + 1, 3*encryptedChunkSize + 42} {
+		data := make([]byte, size)
+		if _, err := rand.Read(data); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		blob := encryptBlob(t, key, data)
+		// a few random bytes may be found in the blob by chance
+		if size > 16 && bytes.Contains(blob, data) {
+			t.Errorf("#%d: the encrypted blob contains the data", i)
+		}
+		r, err := s.newBlobReader(bytes.NewReader(blob))
+		if err != nil {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+			continue
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+			continue
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("#%d: got %d bytes differing from the %d bytes encrypted", i, len(got), len(data))
+		}
+		plainSize, err := plainBlobSize(int64(len(blob)))
+		if err != nil {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+		} else if plainSize != int64(size) {
+			t.Errorf("#%d: got plain size %d, want %d", i, plainSize, size)
+		}
+	}
+}
+
+func TestBlobDecryptionErrors(t *testing.T) {
+	key := testBlobKey()
+	data := bytes.Repeat([]byte("rkt"), encryptedChunkSize)
+	blob := encryptBlob(t, key, data)
+
+	tampered := append([]byte(nil), blob...)
+	tampered[len(tampered)/2] ^= 1
+	wrongKey := append([]byte(nil), key...)
+	wrongKey[0] ^= 1
+	// drop the last chunk, the first one being complete
+	firstChunkEnd := len(encryptedBlobMagic) + noncePrefixSize + chunkHeaderSize + encryptedChunkSize + 16
+
+	tests := []struct {
+		blob []byte
+		key  []byte
+	}{
+		{tampered, key},
+		{blob, wrongKey},
+		{blob[:firstChunkEnd], key},
+		{blob[:len(blob)-1], key},
+		{blob[:len(encryptedBlobMagic)+1], key},
+	}
+	for i, tt := range tests {
+		s := &Store{}
+		key := tt.key
+		s.EnableEncryption(func() ([]byte, error) { return key, nil })
+		r, err := s.newBlobReader(bytes.NewReader(tt.blob))
+		if err == nil {
+			_, err = ioutil.ReadAll(r)
+		}
+		if err == nil {
+			t.Errorf("#%d: expected an error reading a bad blob", i)
+		}
+	}
+
+	// no key
+	s := &Store{}
+	if _, err := s.newBlobReader(bytes.NewReader(blob)); err != ErrNoBlobKey {
+		t.Errorf("expected %v, got %v", ErrNoBlobKey, err)
+	}
+	// bad key
+	s.EnableEncryption(func() ([]byte, error) { return key[:16], nil })
+	if _, err := s.newBlobReader(bytes.NewReader(blob)); err == nil {
+		t.Errorf("expected an error with a key of the wrong size")
+	}
+}
+
+func TestBlobPlaintext(t *testing.T) {
+	s := &Store{}
+	s.EnableEncryption(func() ([]byte, error) { return testBlobKey(), nil })
+	for i, data := range []string{"", "rkt", "not an encrypted blob"} {
+		r, err := s.newBlobReader(bytes.NewReader([]byte(data)))
+		if err != nil {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+			continue
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+			continue
+		}
+		if string(got) != data {
+			t.Errorf("#%d: got %q, want %q", i, got, data)
+		}
+	}
+}
+
+func TestEncryptedStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", tstprefix)
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := NewStore(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer s.Close()
+	s.EnableEncryption(func() ([]byte, error) { return testBlobKey(), nil })
+
+	imj := `{
+			"acKind": "ImageManifest",
+			"acVersion": "0.7.1",
+			"name": "example.com/encrypted-image-name"
+		}`
+
+	aciFile, err := aci.NewACI(dir, imj, nil)
+	if err != nil {
+		t.Fatalf("error creating test tar: %v", err)
+	}
+	if _, err := aciFile.Seek(0, 0); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	key, err := s.WriteACI(aciFile, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	im, err := s.GetImageManifest(key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if im.Name.String() != "example.com/encrypted-image-name" {
+		t.Errorf("unexpected image name: %s", im.Name)
+	}
+
+	// the size is the one of the image, not of the encrypted blob
+	fi, err := aciFile.Stat()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	size, err := s.GetACISize(key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if size != fi.Size() {
+		t.Errorf("got size %d, want %d", size, fi.Size())
+	}
+
+	// the blob on disk is encrypted
+	err = filepath.Walk(filepath.Join(dir, "cas", "blob"), func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if !bytes.HasPrefix(b, []byte(encryptedBlobMagic)) || bytes.Contains(b, []byte("encrypted-image-name")) {
+			t.Errorf("blob %s is not encrypted", path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// a store without the key cannot read it
+	s2, err := NewStore(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer s2.Close()
+	if _, err := s2.ReadStream(key); err != ErrNoBlobKey {
+		t.Errorf("expected %v, got %v", ErrNoBlobKey, err)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2014 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+)
+
+// mcsCategories is the number of SELinux MCS categories the levels of the
+// pods are made of. A level is a pair of distinct categories.
+const mcsCategories = 1024
+
+// GetMCSLevel returns the SELinux MCS level allocated to the pod with the
+// given UUID. found will be false if the pod has no level.
+func GetMCSLevel(tx *sql.Tx, podUUID string) (level string, found bool, err error) {
+	rows, err := tx.Query("SELECT level FROM mcs WHERE poduuid == $1", podUUID)
+	if err != nil {
+		return "", false, err
+	}
+	for rows.Next() {
+		found = true
+		if err := rows.Scan(&level); err != nil {
+			return "", false, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", false, err
+	}
+	return level, found, nil
+}
+
+// mcsLevelUsed returns whether the level is allocated to a pod.
+func mcsLevelUsed(tx *sql.Tx, level string) (bool, error) {
+	rows, err := tx.Query("SELECT poduuid FROM mcs WHERE level == $1", level)
+	if err != nil {
+		return false, err
+	}
+	used := false
+	for rows.Next() {
+		used = true
+	}
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+	return used, nil
+}
+
+// randomMCSLevel returns a random level of two distinct categories, the
+// lowest first.
+func randomMCSLevel() (string, error) {
+	var c [2]uint32
+	for c[0] == c[1] {
+		if err := binary.Read(rand.Reader, binary.LittleEndian, &c); err != nil {
+			return "", err
+		}
+		c[0] %= mcsCategories
+		c[1] %= mcsCategories
+	}
+	if c[0] > c[1] {
+		c[0], c[1] = c[1], c[0]
+	}
+	return fmt.Sprintf("s0:c%d,c%d", c[0], c[1]), nil
+}
+
+// AllocateMCSLevel allocates a level unused by the other pods to the pod
+// with the given UUID, or returns the level already allocated to it.
+func AllocateMCSLevel(tx *sql.Tx, podUUID string) (string, error) {
+	level, found, err := GetMCSLevel(tx, podUUID)
+	if err != nil || found {
+		return level, err
+	}
+
+	for {
+		level, err := randomMCSLevel()
+		if err != nil {
+			return "", err
+		}
+		used, err := mcsLevelUsed(tx, level)
+		if err != nil {
+			return "", err
+		}
+		if used {
+			continue
+		}
+		if _, err := tx.Exec("INSERT INTO mcs VALUES ($1, $2)", level, podUUID); err != nil {
+			return "", err
+		}
+		return level, nil
+	}
+}
+
+// ReleaseMCSLevel releases the level allocated to the pod with the given
+// UUID, so it can be allocated to new pods.
+func ReleaseMCSLevel(tx *sql.Tx, podUUID string) error {
+	_, err := tx.Exec("DELETE FROM mcs WHERE poduuid == $1", podUUID)
+	return err
+}
@@ -0,0 +1,70 @@
+// Copyright 2014 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"regexp"
+	"testing"
+)
+
+func TestMCSLevels(t *testing.T) {
+	dir, err := ioutil.TempDir("", tstprefix)
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := NewStore(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer s.Close()
+
+	levelRegexp := regexp.MustCompile(`^s0:c[0-9]+,c[0-9]+$`)
+	pods := []string{"pod0", "pod1", "pod2"}
+	levels := make(map[string]string)
+	for _, pod := range pods {
+		level, err := s.AllocateMCSLevel(pod)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !levelRegexp.MatchString(level) {
+			t.Errorf("invalid level %q", level)
+		}
+		if other, ok := levels[level]; ok {
+			t.Errorf("level %q allocated to %q and %q", level, other, pod)
+		}
+		levels[level] = pod
+
+		again, err := s.AllocateMCSLevel(pod)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if again != level {
+			t.Errorf("expected %q to keep level %q, got %q", pod, level, again)
+		}
+	}
+
+	if err := s.ReleaseMCSLevel("pod1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, found, err := s.GetMCSLevel("pod1"); err != nil || found {
+		t.Errorf("expected the level of pod1 to be released, got found %t, error %v", found, err)
+	}
+	if level, found, err := s.GetMCSLevel("pod0"); err != nil || !found || levels[level] != "pod0" {
+		t.Errorf("expected pod0 to keep its level, got %q, found %t, error %v", level, found, err)
+	}
+}
@@ -30,6 +30,9 @@ var (
 		2: migrateToV2,
 		3: migrateToV3,
 		4: migrateToV4,
+		5: migrateToV5,
+		6: migrateToV6,
+		7: migrateToV7,
 	}
 )
 
@@ -129,3 +132,44 @@ func migrateToV4(tx *sql.Tx) error {
 	}
 	return nil
 }
+
+func migrateToV5(tx *sql.Tx) error {
+	for _, t := range []string{
+		"CREATE TABLE mcs (level string, poduuid string);",
+		"CREATE UNIQUE INDEX IF NOT EXISTS mcslevelidx ON mcs (level)",
+		"CREATE UNIQUE INDEX IF NOT EXISTS mcspoduuididx ON mcs (poduuid)",
+	} {
+		_, err := tx.Exec(t)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func migrateToV6(tx *sql.Tx) error {
+	_, err := tx.Exec("ALTER TABLE aciinfo ADD arch string")
+	if err != nil {
+		return err
+	}
+	// Set the default value for the new column on the current rows
+	_, err = tx.Exec("UPDATE aciinfo arch = $1", "")
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func migrateToV7(tx *sql.Tx) error {
+	for _, t := range []string{
+		"CREATE TABLE podrefs (poduuid string, blobkey string, treestoreid string);",
+		"CREATE INDEX IF NOT EXISTS podrefspoduuididx ON podrefs (poduuid)",
+		"CREATE INDEX IF NOT EXISTS podrefsblobkeyidx ON podrefs (blobkey)",
+	} {
+		_, err := tx.Exec(t)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -660,6 +660,118 @@ func TestMigrate(t *testing.T) {
 	}
 }
 
+func populateDBV4(db *DB, aciInfos []*ACIInfoV3, remotes []*RemoteV2_3) error {
+	if err := populateDBV3(db, 4, nil, remotes); err != nil {
+		return err
+	}
+	fn := func(tx *sql.Tx) error {
+		for _, stmt := range []string{
+			"DROP TABLE aciinfo",
+			"CREATE TABLE aciinfo (blobkey string, name string, importtime time, lastusedtime time, latest bool);",
+			"CREATE UNIQUE INDEX IF NOT EXISTS blobkeyidx ON aciinfo (blobkey)",
+			"CREATE INDEX IF NOT EXISTS nameidx ON aciinfo (name)",
+		} {
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		for _, aciinfo := range aciInfos {
+			_, err := tx.Exec("INSERT into aciinfo values ($1, $2, $3, $4, $5)", aciinfo.BlobKey, aciinfo.Name, aciinfo.ImportTime, aciinfo.ImportTime, aciinfo.Latest)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return db.Do(fn)
+}
+
+func TestMigrateToV5(t *testing.T) {
+	dir, err := ioutil.TempDir("", tstprefix)
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := NewDB(filepath.Join(dir, "cas", "db"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	aciinfos := []*ACIInfoV3{
+		{"sha512-aaaaaaaa", "example.com/app01", time.Time{}.UTC(), false},
+		{"sha512-bbbbbbbb", "example.com/app02", time.Time{}.UTC(), true},
+	}
+	if err := populateDBV4(db, aciinfos, nil); err != nil {
+		t.Fatalf("error populating the db: %v", err)
+	}
+
+	if err := db.Do(func(tx *sql.Tx) error { return migrate(tx, 5) }); err != nil {
+		t.Fatalf("unexpected error migrating the db: %v", err)
+	}
+
+	var version int
+	var level string
+	var found bool
+	err = db.Do(func(tx *sql.Tx) error {
+		var err error
+		if version, err = getDBVersion(tx); err != nil {
+			return err
+		}
+		if level, err = AllocateMCSLevel(tx, "6733c3e1-5c8e-4e54-9e5e-c7a0f4a3a4de"); err != nil {
+			return err
+		}
+		_, found, err = GetMCSLevel(tx, "6733c3e1-5c8e-4e54-9e5e-c7a0f4a3a4de")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if version != 5 {
+		t.Errorf("wrong db version: got %d, want 5", version)
+	}
+	if !found {
+		t.Errorf("the MCS level allocated in the migrated db was not found")
+	}
+
+	// the levels and the pods are unique
+	for i, row := range [][]string{
+		{level, "1bfd6f6f-5ab0-4d42-8b7f-6b0b1e1c4a50"},
+		{"s0:c1,c2", "6733c3e1-5c8e-4e54-9e5e-c7a0f4a3a4de"},
+	} {
+		err := db.Do(func(tx *sql.Tx) error {
+			_, err := tx.Exec("INSERT into mcs values ($1, $2)", row[0], row[1])
+			return err
+		})
+		if err == nil {
+			t.Errorf("#%d: expected an error inserting a duplicate MCS row", i)
+		}
+	}
+
+	// the images are kept
+	var got []*ACIInfoV3
+	err = db.Do(func(tx *sql.Tx) error {
+		rows, err := tx.Query("SELECT blobkey, name, latest FROM aciinfo")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			aciinfo := &ACIInfoV3{ImportTime: time.Time{}.UTC()}
+			if err := rows.Scan(&aciinfo.BlobKey, &aciinfo.Name, &aciinfo.Latest); err != nil {
+				return err
+			}
+			got = append(got, aciinfo)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !compareSlicesNoOrder(got, aciinfos) {
+		t.Errorf("got images %v, want %v", got, aciinfos)
+	}
+}
+
 // compareSlices compare slices regardless of the slice elements order
 func compareSlicesNoOrder(i1 interface{}, i2 interface{}) bool {
 	s1 := interfaceToSlice(i1)
@@ -0,0 +1,108 @@
+// Copyright 2014 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"database/sql"
+	"sort"
+)
+
+// PodRef records that a pod uses an image, as an app image, the stage1
+// image or one of their dependencies.
+type PodRef struct {
+	// PodUUID is the UUID of the pod.
+	PodUUID string
+	// BlobKey is the key of the image in the blob store.
+	BlobKey string
+	// TreeStoreID is the ID of the rendered tree used by the pod, empty
+	// when the image was copied in the pod.
+	TreeStoreID string
+}
+
+func podrefRowScan(rows *sql.Rows, podref *PodRef) error {
+	// This ordering MUST match that in schema.go
+	return rows.Scan(&podref.PodUUID, &podref.BlobKey, &podref.TreeStoreID)
+}
+
+// AddPodRef records that the pod with the given UUID uses the image with the
+// given key, through the given treestore.
+func AddPodRef(tx *sql.Tx, podref *PodRef) error {
+	rows, err := tx.Query("SELECT * FROM podrefs WHERE poduuid == $1 && blobkey == $2 && treestoreid == $3", podref.PodUUID, podref.BlobKey, podref.TreeStoreID)
+	if err != nil {
+		return err
+	}
+	found := false
+	for rows.Next() {
+		found = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if found {
+		return nil
+	}
+	_, err = tx.Exec("INSERT INTO podrefs (poduuid, blobkey, treestoreid) VALUES ($1, $2, $3)", podref.PodUUID, podref.BlobKey, podref.TreeStoreID)
+	return err
+}
+
+// GetPodRefsWithBlobKey returns the references of the pods to the image with
+// the given key.
+func GetPodRefsWithBlobKey(tx *sql.Tx, blobKey string) ([]*PodRef, error) {
+	var podrefs []*PodRef
+	rows, err := tx.Query("SELECT * FROM podrefs WHERE blobkey == $1", blobKey)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		podref := &PodRef{}
+		if err := podrefRowScan(rows, podref); err != nil {
+			return nil, err
+		}
+		podrefs = append(podrefs, podref)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return podrefs, nil
+}
+
+// RemovePodRefs removes the references of the pod with the given UUID.
+func RemovePodRefs(tx *sql.Tx, podUUID string) error {
+	_, err := tx.Exec("DELETE FROM podrefs WHERE poduuid == $1", podUUID)
+	return err
+}
+
+// RemovePodRefsWithBlobKey removes the references of the pods to the image
+// with the given key.
+func RemovePodRefsWithBlobKey(tx *sql.Tx, blobKey string) error {
+	_, err := tx.Exec("DELETE FROM podrefs WHERE blobkey == $1", blobKey)
+	return err
+}
+
+// podUUIDs returns the sorted UUIDs of the pods of the references, without
+// duplicates.
+func podUUIDs(podrefs []*PodRef) []string {
+	seen := make(map[string]struct{})
+	var uuids []string
+	for _, r := range podrefs {
+		if _, ok := seen[r.PodUUID]; ok {
+			continue
+		}
+		seen[r.PodUUID] = struct{}{}
+		uuids = append(uuids, r.PodUUID)
+	}
+	sort.Strings(uuids)
+	return uuids
+}
@@ -0,0 +1,75 @@
+// Copyright 2014 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestPodRefs(t *testing.T) {
+	dir, err := ioutil.TempDir("", tstprefix)
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := NewStore(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer s.Close()
+
+	for _, r := range []PodRef{
+		{"pod1", "key0", "tree0"},
+		{"pod0", "key0", "tree0"},
+		{"pod0", "key0", "tree0"},
+		{"pod0", "key0", ""},
+		{"pod0", "key1", ""},
+	} {
+		if err := s.AddPodRef(r.PodUUID, r.BlobKey, r.TreeStoreID); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	tests := []struct {
+		key  string
+		pods []string
+	}{
+		{"key0", []string{"pod0", "pod1"}},
+		{"key1", []string{"pod0"}},
+		{"key2", nil},
+	}
+	for i, tt := range tests {
+		pods, err := s.GetImagePods(tt.key)
+		if err != nil {
+			t.Fatalf("#%d: unexpected error: %v", i, err)
+		}
+		if !reflect.DeepEqual(pods, tt.pods) {
+			t.Errorf("#%d: expected pods %v, got %v", i, tt.pods, pods)
+		}
+	}
+
+	if err := s.ReleasePodRefs("pod0"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pods, err := s.GetImagePods("key0"); err != nil || !reflect.DeepEqual(pods, []string{"pod1"}) {
+		t.Errorf("expected only pod1 to use key0, got %v, error %v", pods, err)
+	}
+	if pods, err := s.GetImagePods("key1"); err != nil || len(pods) != 0 {
+		t.Errorf("expected no pod to use key1, got %v, error %v", pods, err)
+	}
+}
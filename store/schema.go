@@ -21,7 +21,7 @@ import (
 
 const (
 	// Incremental db version at the current code revision.
-	dbVersion = 4
+	dbVersion = 7
 )
 
 // Statement to run when creating a db. These are the statements to create the
@@ -37,9 +37,19 @@ var dbCreateStmts = [...]string{
 	"CREATE UNIQUE INDEX IF NOT EXISTS aciurlidx ON remote (aciurl)",
 
 	// aciinfo table. The primary key is "blobkey" and it matches the key used to save that aci in the blob store
-	"CREATE TABLE IF NOT EXISTS aciinfo (blobkey string, name string, importtime time, lastusedtime time, latest bool);",
+	"CREATE TABLE IF NOT EXISTS aciinfo (blobkey string, name string, importtime time, lastusedtime time, latest bool, arch string);",
 	"CREATE UNIQUE INDEX IF NOT EXISTS blobkeyidx ON aciinfo (blobkey)",
 	"CREATE INDEX IF NOT EXISTS nameidx ON aciinfo (name)",
+
+	// mcs table, the SELinux MCS levels allocated to the pods. The primary key is "poduuid".
+	"CREATE TABLE IF NOT EXISTS mcs (level string, poduuid string);",
+	"CREATE UNIQUE INDEX IF NOT EXISTS mcslevelidx ON mcs (level)",
+	"CREATE UNIQUE INDEX IF NOT EXISTS mcspoduuididx ON mcs (poduuid)",
+
+	// podrefs table, the images and treestores used by the pods.
+	"CREATE TABLE IF NOT EXISTS podrefs (poduuid string, blobkey string, treestoreid string);",
+	"CREATE INDEX IF NOT EXISTS podrefspoduuididx ON podrefs (poduuid)",
+	"CREATE INDEX IF NOT EXISTS podrefsblobkeyidx ON podrefs (blobkey)",
 }
 
 // dbIsPopulated checks if the db is already populated (at any version) verifing if the "version" table exists
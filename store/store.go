@@ -15,6 +15,8 @@
 package store
 
 import (
+	"archive/tar"
+	"crypto/cipher"
 	"crypto/sha512"
 	"database/sql"
 	"encoding/json"
@@ -25,13 +27,14 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"syscall"
 	"time"
 
+	"github.com/coreos/rkt/pkg/aci"
 	"github.com/coreos/rkt/pkg/lock"
 
-	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/aci"
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/pkg/acirenderer"
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
@@ -110,6 +113,10 @@ type Store struct {
 	storeLock        *lock.FileLock
 	imageLockDir     string
 	treeStoreLockDir string
+	// getBlobKey returns the key encrypting the blobs, nil unless
+	// EnableEncryption was called
+	getBlobKey func() ([]byte, error)
+	blobAEAD   cipher.AEAD
 }
 
 func NewStore(baseDir string) (*Store, error) {
@@ -330,7 +337,19 @@ func (s *Store) ReadStream(key string) (io.ReadCloser, error) {
 		return nil, fmt.Errorf("cannot remove image with ID: %s from db: %v", key, err)
 	}
 
-	return s.stores[blobType].ReadStream(key, false)
+	rc, err := s.stores[blobType].ReadStream(key, false)
+	if err != nil {
+		return nil, err
+	}
+	r, err := s.newBlobReader(rc)
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, rc}, nil
 }
 
 // WriteACI takes an ACI encapsulated in an io.Reader, decompresses it if
@@ -358,10 +377,35 @@ func (s *Store) WriteACI(r io.ReadSeeker, latest bool) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("error creating image: %v", err)
 	}
-	if _, err := io.Copy(fh, tr); err != nil {
+	// an encrypted image is never written in clear on disk
+	var w io.Writer = fh
+	var ew *encryptingWriter
+	if s.encryptsBlobs() {
+		aead, err := s.getBlobAEAD()
+		if err != nil {
+			return "", fmt.Errorf("error encrypting image: %v", err)
+		}
+		if ew, err = newEncryptingWriter(fh, aead); err != nil {
+			return "", fmt.Errorf("error encrypting image: %v", err)
+		}
+		w = ew
+	}
+	if _, err := io.Copy(w, tr); err != nil {
 		return "", fmt.Errorf("error copying image: %v", err)
 	}
-	im, err := aci.ManifestFromImage(fh)
+	if ew != nil {
+		if err := ew.Close(); err != nil {
+			return "", fmt.Errorf("error encrypting image: %v", err)
+		}
+	}
+	if _, err := fh.Seek(0, 0); err != nil {
+		return "", fmt.Errorf("error reading image: %v", err)
+	}
+	br, err := s.newBlobReader(fh)
+	if err != nil {
+		return "", fmt.Errorf("error reading image: %v", err)
+	}
+	im, err := aci.ManifestFromTar(tar.NewReader(br))
 	if err != nil {
 		return "", fmt.Errorf("error extracting image manifest: %v", err)
 	}
@@ -455,6 +499,11 @@ func (s *Store) RemoveACI(key string) error {
 		if err := RemoveRemote(tx, key); err != nil {
 			return err
 		}
+		// the pods still using the image, if forced to remove it, are
+		// detached from it
+		if err := RemovePodRefsWithBlobKey(tx, key); err != nil {
+			return err
+		}
 		return nil
 	})
 	if err != nil {
@@ -479,6 +528,125 @@ func (s *Store) RemoveACI(key string) error {
 	return nil
 }
 
+// DanglingReport lists the entries removed by RemoveDangling.
+type DanglingReport struct {
+	// Keys are the keys of the blobs and image manifests removed
+	Keys []string
+	// Remotes are the ACI URLs of the remotes removed
+	Remotes []string
+	// Size is the disk space reclaimed, in bytes
+	Size int64
+}
+
+// RemoveDangling removes the blobs and image manifests, and the remotes,
+// of the ACIs which are not in the store anymore, left behind by an
+// interrupted or failed image removal or import. The entries locked by
+// another rkt process are skipped, as they may be being written.
+func (s *Store) RemoveDangling() (*DanglingReport, error) {
+	var keys []string
+	err := s.db.Do(func(tx *sql.Tx) error {
+		aciinfos, err := GetAllACIInfos(tx, nil, false)
+		if err != nil {
+			return err
+		}
+		for _, ai := range aciinfos {
+			keys = append(keys, ai.BlobKey)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting aciinfos: %v", err)
+	}
+	known := make(map[string]bool)
+	for _, key := range keys {
+		known[key] = true
+	}
+
+	report := &DanglingReport{}
+	dangling := make(map[string]bool)
+	for _, ds := range s.stores {
+		for key := range ds.Keys(nil) {
+			if !known[key] {
+				dangling[key] = true
+			}
+		}
+	}
+	for key := range dangling {
+		size, err := s.removeDanglingKey(key)
+		if err != nil {
+			return report, err
+		}
+		if size >= 0 {
+			report.Keys = append(report.Keys, key)
+			report.Size += size
+		}
+	}
+	sort.Strings(report.Keys)
+
+	err = s.db.Do(func(tx *sql.Tx) error {
+		remotes, err := GetAllRemotes(tx)
+		if err != nil {
+			return err
+		}
+		for _, r := range remotes {
+			if known[r.BlobKey] {
+				continue
+			}
+			if _, err := tx.Exec("DELETE FROM remote WHERE aciurl == $1", r.ACIURL); err != nil {
+				return err
+			}
+			report.Remotes = append(report.Remotes, r.ACIURL)
+		}
+		return nil
+	})
+	if err != nil {
+		return report, fmt.Errorf("error removing remotes: %v", err)
+	}
+	return report, nil
+}
+
+// removeDanglingKey removes the entries of the diskv stores with the given
+// key if it is still not in the store once locked, and returns their size.
+// It returns -1 if the key is locked by another process or was written in
+// the meantime.
+func (s *Store) removeDanglingKey(key string) (int64, error) {
+	keyLock, err := lock.TryExclusiveKeyLock(s.imageLockDir, key)
+	if err == lock.ErrLocked {
+		return -1, nil
+	}
+	if err != nil {
+		return -1, fmt.Errorf("error locking image: %v", err)
+	}
+	defer keyLock.Close()
+
+	var found bool
+	if err := s.db.Do(func(tx *sql.Tx) error {
+		_, found, err = GetACIInfoWithBlobKey(tx, key)
+		return err
+	}); err != nil {
+		return -1, fmt.Errorf("error getting aciinfo: %v", err)
+	}
+	if found {
+		return -1, nil
+	}
+
+	var size int64
+	for _, ds := range s.stores {
+		if !ds.Has(key) {
+			continue
+		}
+		// XXX: The construction of 'path' depends on the implementation of diskv.
+		path := filepath.Join(ds.BasePath, filepath.Join(ds.Transform(key)...), key)
+		if fi, err := os.Stat(path); err == nil {
+			size += fi.Size()
+		}
+		if err := ds.Erase(key); err != nil {
+			return -1, fmt.Errorf("error removing dangling entry %s: %v", key, err)
+		}
+	}
+	return size, nil
+}
+
 // GetTreeStoreID calculates the treestore ID for the given image key.
 // The treeStoreID is computed as an hash of the flattened dependency tree
 // image keys. In this way the ID may change for the same key if the image's
@@ -623,6 +791,70 @@ func (s *Store) WriteRemote(remote *Remote) error {
 	return err
 }
 
+// AllocateMCSLevel returns the SELinux MCS level of the pod with the given
+// UUID, allocating a level unused by the other pods if it has none.
+func (s *Store) AllocateMCSLevel(podUUID string) (string, error) {
+	var level string
+	err := s.db.Do(func(tx *sql.Tx) error {
+		var err error
+		level, err = AllocateMCSLevel(tx, podUUID)
+		return err
+	})
+	return level, err
+}
+
+// GetMCSLevel returns the SELinux MCS level of the pod with the given UUID.
+// found will be false if the pod has no level.
+func (s *Store) GetMCSLevel(podUUID string) (string, bool, error) {
+	var level string
+	found := false
+	err := s.db.Do(func(tx *sql.Tx) error {
+		var err error
+		level, found, err = GetMCSLevel(tx, podUUID)
+		return err
+	})
+	return level, found, err
+}
+
+// ReleaseMCSLevel releases the SELinux MCS level of the pod with the given
+// UUID.
+func (s *Store) ReleaseMCSLevel(podUUID string) error {
+	return s.db.Do(func(tx *sql.Tx) error {
+		return ReleaseMCSLevel(tx, podUUID)
+	})
+}
+
+// AddPodRef records that the pod with the given UUID uses the image with the
+// given key, through the treestore with the given ID if not empty.
+func (s *Store) AddPodRef(podUUID string, key string, treeStoreID string) error {
+	return s.db.Do(func(tx *sql.Tx) error {
+		return AddPodRef(tx, &PodRef{PodUUID: podUUID, BlobKey: key, TreeStoreID: treeStoreID})
+	})
+}
+
+// GetImagePods returns the UUIDs of the pods using the image with the given
+// key.
+func (s *Store) GetImagePods(key string) ([]string, error) {
+	var podrefs []*PodRef
+	err := s.db.Do(func(tx *sql.Tx) error {
+		var err error
+		podrefs, err = GetPodRefsWithBlobKey(tx, key)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return podUUIDs(podrefs), nil
+}
+
+// ReleasePodRefs removes the references of the pod with the given UUID to
+// the images, once it's removed.
+func (s *Store) ReleasePodRefs(podUUID string) error {
+	return s.db.Do(func(tx *sql.Tx) error {
+		return RemovePodRefs(tx, podUUID)
+	})
+}
+
 // GetImageManifestJSON gets the ImageManifest JSON bytes with the
 // specified key.
 func (s *Store) GetImageManifestJSON(key string) ([]byte, error) {
@@ -750,6 +982,50 @@ func (s *Store) GetACIInfoWithBlobKey(blobKey string) (*ACIInfo, error) {
 	return aciInfo, err
 }
 
+// GetACISize returns the size of the ACI file with the given key. The size
+// of an encrypted ACI is the size of its content, not of the file on disk.
+func (s *Store) GetACISize(key string) (int64, error) {
+	ds := s.stores[blobType]
+	// XXX: The construction of 'path' depends on the implementation of diskv.
+	path := filepath.Join(ds.BasePath, filepath.Join(ds.Transform(key)...), key)
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("cannot open the image file: %v", err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("cannot get the stat of the image file: %v", err)
+	}
+	encrypted, err := isEncryptedBlob(f)
+	if err != nil {
+		return 0, fmt.Errorf("cannot read the image file: %v", err)
+	}
+	if !encrypted {
+		return fi.Size(), nil
+	}
+	size, err := plainBlobSize(fi.Size())
+	if err != nil {
+		return 0, fmt.Errorf("cannot get the size of the encrypted image file: %v", err)
+	}
+	return size, nil
+}
+
+// SetACIInfoArch records the arch of the variant chosen on discovery for
+// the image with the given key.
+func (s *Store) SetACIInfoArch(key string, arch string) error {
+	return s.db.Do(func(tx *sql.Tx) error {
+		aciinfo, found, err := GetACIInfoWithBlobKey(tx, key)
+		if err != nil {
+			return fmt.Errorf("error getting aciinfo: %v", err)
+		} else if !found {
+			return fmt.Errorf("cannot find image with key: %s", key)
+		}
+		aciinfo.Arch = arch
+		return WriteACIInfo(tx, aciinfo)
+	})
+}
+
 func (s *Store) Dump(hex bool) {
 	for _, ds := range s.stores {
 		var keyCount int
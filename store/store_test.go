@@ -19,9 +19,12 @@ import (
 	"bytes"
 	"database/sql"
 	"encoding/hex"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"testing"
 	"time"
 
@@ -198,6 +201,58 @@ func TestGetImageManifest(t *testing.T) {
 	}
 }
 
+func TestSetACIInfoArch(t *testing.T) {
+	dir, err := ioutil.TempDir("", tstprefix)
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := NewStore(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer s.Close()
+
+	imj := `{
+			"acKind": "ImageManifest",
+			"acVersion": "0.7.1",
+			"name": "example.com/test01",
+			"labels": [{"name": "arch", "value": "armv7l"}]
+		}`
+
+	aci, err := aci.NewACI(dir, imj, nil)
+	if err != nil {
+		t.Fatalf("error creating test tar: %v", err)
+	}
+	// Rewind the ACI
+	if _, err := aci.Seek(0, 0); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	key, err := s.WriteACI(aci, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := s.SetACIInfoArch(key, "armv7l"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	aciinfo, err := s.GetACIInfoWithBlobKey(key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if aciinfo.Arch != "armv7l" {
+		t.Errorf("expected arch %q, got %q", "armv7l", aciinfo.Arch)
+	}
+	if !aciinfo.Latest {
+		t.Errorf("expected the image to be still marked as latest")
+	}
+
+	// test unexistent key
+	if err := s.SetACIInfoArch("sha512-aaaaaaaaaaaaaaaaa", "armv7l"); err == nil {
+		t.Fatalf("expected non-nil error!")
+	}
+}
+
 func TestGetAci(t *testing.T) {
 	type test struct {
 		name     types.ACIdentifier
@@ -569,3 +624,87 @@ func TestRemoveACI(t *testing.T) {
 	}
 
 }
+
+func TestRemoveDangling(t *testing.T) {
+	dir, err := ioutil.TempDir("", tstprefix)
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := NewStore(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer s.Close()
+
+	var keys []string
+	for _, name := range []string{"example.com/test01", "example.com/test02"} {
+		imj := fmt.Sprintf(`{"acKind": "ImageManifest", "acVersion": "0.7.1", "name": %q}`, name)
+		aciFile, err := aci.NewACI(dir, imj, nil)
+		if err != nil {
+			t.Fatalf("error creating test tar: %v", err)
+		}
+		if _, err := aciFile.Seek(0, 0); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		key, err := s.WriteACI(aciFile, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		na := NewRemote("http://"+name+".aci", "")
+		na.BlobKey = key
+		if err := s.WriteRemote(na); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		keys = append(keys, key)
+	}
+	na := NewRemote("http://example.com/missing.aci", "")
+	na.BlobKey = "sha512-aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	if err := s.WriteRemote(na); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// simulate an interrupted removal of the second image
+	if err := s.db.Do(func(tx *sql.Tx) error {
+		return RemoveACIInfo(tx, keys[1])
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	report, err := s.RemoveDangling()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(report.Keys, []string{keys[1]}) {
+		t.Errorf("expected dangling keys %v, got %v", keys[1:], report.Keys)
+	}
+	sort.Strings(report.Remotes)
+	wantRemotes := []string{"http://example.com/missing.aci", "http://example.com/test02.aci"}
+	if !reflect.DeepEqual(report.Remotes, wantRemotes) {
+		t.Errorf("expected dangling remotes %v, got %v", wantRemotes, report.Remotes)
+	}
+	if report.Size <= 0 {
+		t.Errorf("expected reclaimed space, got %d", report.Size)
+	}
+
+	for _, ds := range s.stores {
+		if !ds.Has(keys[0]) {
+			t.Errorf("expected %s to be kept", keys[0])
+		}
+		if ds.Has(keys[1]) {
+			t.Errorf("expected %s to be removed", keys[1])
+		}
+	}
+	if _, found, err := s.GetRemote("http://example.com/test01.aci"); err != nil || !found {
+		t.Errorf("expected the remote of %s to be kept: %v", keys[0], err)
+	}
+
+	// nothing is left to remove
+	report, err = s.RemoveDangling()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(report.Keys) != 0 || len(report.Remotes) != 0 {
+		t.Errorf("expected nothing to be removed, got %+v", report)
+	}
+}
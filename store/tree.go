@@ -30,8 +30,8 @@ import (
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/pkg/tarheader"
 	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
 	"github.com/coreos/rkt/pkg/aci"
+	"github.com/coreos/rkt/pkg/lock"
 	"github.com/coreos/rkt/pkg/sys"
-	"github.com/coreos/rkt/pkg/uid"
 )
 
 const (
@@ -62,7 +62,7 @@ func (ts *TreeStore) Write(id string, key string, s *Store) error {
 	if err := os.MkdirAll(treepath, 0755); err != nil {
 		return fmt.Errorf("treestore: cannot create treestore directory %s: %v", treepath, err)
 	}
-	err = aci.RenderACIWithImageID(*imageID, treepath, s, uid.NewBlankUidRange())
+	err = aci.RenderACITree(*imageID, treepath, s, &treeFinder{s: s})
 	if err != nil {
 		return fmt.Errorf("treestore: cannot render aci: %v", err)
 	}
@@ -96,6 +96,33 @@ func (ts *TreeStore) Write(id string, key string, s *Store) error {
 	return nil
 }
 
+// treeFinder finds the rendered tree stores of the dependencies of an image
+// being rendered, so their files are copied instead of extracted again.
+type treeFinder struct {
+	s *Store
+}
+
+// FindTree returns the tree store of the image with the given key if it's
+// fully rendered. It's shared locked until release is called so it cannot
+// be removed while copying its files. A tree store being rendered or
+// removed is skipped rather than waited for.
+func (f *treeFinder) FindTree(key string) (string, func(), bool) {
+	id, err := f.s.GetTreeStoreID(key)
+	if err != nil {
+		return "", nil, false
+	}
+	treeStoreKeyLock, err := lock.TrySharedKeyLock(f.s.treeStoreLockDir, id)
+	if err != nil {
+		return "", nil, false
+	}
+	rendered, err := f.s.treestore.IsRendered(id)
+	if err != nil || !rendered {
+		treeStoreKeyLock.Close()
+		return "", nil, false
+	}
+	return f.s.treestore.GetPath(id), treeStoreKeyLock.Close, true
+}
+
 // Remove cleans the directory for the provided id
 func (ts *TreeStore) Remove(id string) error {
 	treepath := ts.GetPath(id)
@@ -198,6 +225,15 @@ func (ts *TreeStore) Check(id string) error {
 	return nil
 }
 
+// CheckTree verifies, like CheckTreeStore, the rendered ACI with the given
+// id in the store in baseDir, without opening the store: nothing is created,
+// migrated or locked, so a rendered ACI being written or removed meanwhile
+// is reported as corrupted.
+func CheckTree(baseDir, id string) error {
+	ts := &TreeStore{path: filepath.Join(baseDir, "cas", "tree")}
+	return ts.Check(id)
+}
+
 type xattr struct {
 	Name  string
 	Value string
@@ -0,0 +1,88 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema"
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/appc/spec/schema/types"
+	"github.com/coreos/rkt/common"
+	"github.com/coreos/rkt/tests/testutils"
+)
+
+// TestDryRunManifest checks that the pod manifest printed by run --dry-run
+// is the one of the pod prepared with the same flags, but for the stage1
+// digest annotation.
+func TestDryRunManifest(t *testing.T) {
+	const podUUID = "6733c3a8-ebf4-4b2b-8e5f-ea0a4d8d5f6e"
+
+	image := patchTestACI("rkt-inspect-dry-run.aci", "--exec=/inspect --print-msg=HelloWorld")
+	defer os.Remove(image)
+	ctx := testutils.NewRktRunCtx()
+	defer ctx.Cleanup()
+
+	importImageAndFetchHash(t, ctx, image)
+
+	flags := fmt.Sprintf("--uuid=%s --set-env=MESSAGE=dry --volume=data,kind=empty,mode=0700 %s --mount=volume=data,target=/data", podUUID, image)
+	cmd := fmt.Sprintf("%s run --dry-run --insecure-skip-verify %s", ctx.Cmd(), flags)
+	output, err := exec.Command("/bin/bash", "-c", cmd).Output()
+	if err != nil {
+		t.Fatalf("Dry run failed: %v", err)
+	}
+	out := string(output)
+	start := strings.Index(out, "pod manifest:\n")
+	end := strings.Index(out, "\n\nmounts:")
+	if start < 0 || end < start {
+		t.Fatalf("No pod manifest in the dry run output: %s", out)
+	}
+	var planned schema.PodManifest
+	if err := json.Unmarshal([]byte(out[start+len("pod manifest:\n"):end]), &planned); err != nil {
+		t.Fatalf("Cannot unmarshal the planned pod manifest: %v", err)
+	}
+
+	cmd = fmt.Sprintf("%s prepare --insecure-skip-verify %s", ctx.Cmd(), flags)
+	if uuid := runRktAndGetUUID(t, cmd); uuid != podUUID {
+		t.Fatalf("Prepared pod %q, want %q", uuid, podUUID)
+	}
+	output, err = exec.Command("/bin/bash", "-c", fmt.Sprintf("%s cat-manifest %s", ctx.Cmd(), podUUID)).Output()
+	if err != nil {
+		t.Fatalf("Cannot get the manifest of the prepared pod: %v", err)
+	}
+	var prepared schema.PodManifest
+	if err := json.Unmarshal(output, &prepared); err != nil {
+		t.Fatalf("Cannot unmarshal the prepared pod manifest: %v", err)
+	}
+	if _, ok := prepared.Annotations.Get(common.Stage1DigestAnnotation); !ok {
+		t.Errorf("The prepared pod manifest has no stage1 digest annotation")
+	}
+	var annotations []types.Annotation
+	for _, a := range prepared.Annotations {
+		if a.Name.String() != common.Stage1DigestAnnotation {
+			annotations = append(annotations, a)
+		}
+	}
+	prepared.Annotations = annotations
+
+	if !reflect.DeepEqual(planned, prepared) {
+		t.Errorf("The planned pod manifest differs from the prepared one:\nplanned:  %+v\nprepared: %+v", planned, prepared)
+	}
+}
@@ -95,3 +95,29 @@ func TestExitCodeWithSeveralApps(t *testing.T) {
 	// https://github.com/coreos/rkt/issues/1461
 	checkAppStatus(t, ctx, true, "hello2", "status=0")
 }
+
+// TestExitCodeOneShot is testing a pod with a one-shot app and a sidecar,
+// stopped once the one-shot app exited, which is recorded as exited
+// successfully.
+func TestExitCodeOneShot(t *testing.T) {
+	jobFile := patchTestACI("rkt-inspect-exit-job.aci", "--name=job",
+		"--exec=/inspect --print-msg=HelloWorld --exit-code=0 --sleep=1")
+	defer os.Remove(jobFile)
+
+	sidecarFile := patchTestACI("rkt-inspect-exit-sidecar.aci", "--name=sidecar",
+		"--exec=/inspect --print-msg=HelloWorld --sleep=600")
+	defer os.Remove(sidecarFile)
+
+	ctx := testutils.NewRktRunCtx()
+	defer ctx.Cleanup()
+
+	cmd := fmt.Sprintf(`%s --debug --insecure-skip-verify run --mds-register=false %s --oneshot %s`,
+		ctx.Cmd(), jobFile, sidecarFile)
+	child := spawnOrFail(t, cmd)
+
+	t.Logf("Waiting pod termination\n")
+	waitOrFail(t, child, true)
+
+	checkAppStatus(t, ctx, true, "job", "status=0")
+	checkAppStatus(t, ctx, true, "sidecar", "status=0")
+}
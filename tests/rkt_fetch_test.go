@@ -43,14 +43,14 @@ func TestFetchFromFile(t *testing.T) {
 		image string
 	}{
 		{"--insecure-skip-verify fetch", imagePath},
-		{"--insecure-skip-verify fetch --store-only", imagePath},
-		{"--insecure-skip-verify fetch --no-store", imagePath},
+		{"--insecure-skip-verify fetch --pull-policy=never", imagePath},
+		{"--insecure-skip-verify fetch --pull-policy=update", imagePath},
 		{"--insecure-skip-verify run --mds-register=false", imagePath},
-		{"--insecure-skip-verify run --mds-register=false --store-only", imagePath},
-		{"--insecure-skip-verify run --mds-register=false --no-store", imagePath},
+		{"--insecure-skip-verify run --mds-register=false --pull-policy=never", imagePath},
+		{"--insecure-skip-verify run --mds-register=false --pull-policy=update", imagePath},
 		{"--insecure-skip-verify prepare", imagePath},
-		{"--insecure-skip-verify prepare --store-only", imagePath},
-		{"--insecure-skip-verify prepare --no-store", imagePath},
+		{"--insecure-skip-verify prepare --pull-policy=never", imagePath},
+		{"--insecure-skip-verify prepare --pull-policy=update", imagePath},
 	}
 
 	for _, tt := range tests {
@@ -79,7 +79,7 @@ func testFetchFromFile(t *testing.T, arg string, image string) {
 
 // TestFetch tests that 'rkt fetch/run/prepare' for any type (image name string
 // or URL) except file:// URL will work with the default, store only
-// (--store-only) and remote only (--no-store) behaviors.
+// (--pull-policy=never) and remote only (--pull-policy=update) behaviors.
 func TestFetch(t *testing.T) {
 	image := "rkt-inspect-implicit-fetch.aci"
 	imagePath := patchTestACI(image, "--exec=/inspect")
@@ -108,11 +108,23 @@ func TestFetch(t *testing.T) {
 
 	for _, tt := range tests {
 		testFetchDefault(t, tt.args, tt.image, tt.imageArgs, tt.finalURL)
-		testFetchStoreOnly(t, tt.args, tt.image, tt.imageArgs, tt.finalURL)
-		testFetchNoStore(t, tt.args, tt.image, tt.imageArgs, tt.finalURL)
+		testFetchStoreOnly(t, "--pull-policy=never", tt.args, tt.image, tt.imageArgs, tt.finalURL)
+		testFetchNoStore(t, "--pull-policy=update", tt.args, tt.image, tt.imageArgs, tt.finalURL)
 	}
 }
 
+// TestFetchDeprecatedFlags tests that the deprecated --store-only and
+// --no-store flags still behave like --pull-policy=never and
+// --pull-policy=update.
+func TestFetchDeprecatedFlags(t *testing.T) {
+	args := "--insecure-skip-verify fetch"
+	image := "coreos.com/etcd:v2.1.2"
+	finalURL := "https://github.com/coreos/etcd/releases/download/v2.1.2/etcd-v2.1.2-linux-amd64.aci"
+
+	testFetchStoreOnly(t, "--store-only", args, image, "", finalURL)
+	testFetchNoStore(t, "--no-store", args, image, "", finalURL)
+}
+
 func testFetchDefault(t *testing.T, arg string, image string, imageArgs string, finalURL string) {
 	remoteFetchMsgTpl := `remote fetching from url %s`
 	storeMsgTpl := `using image from local store for .* %s`
@@ -138,7 +150,7 @@ func testFetchDefault(t *testing.T, arg string, image string, imageArgs string,
 	runRktAndCheckRegexOutput(t, cmd, storeMsg)
 }
 
-func testFetchStoreOnly(t *testing.T, args string, image string, imageArgs string, finalURL string) {
+func testFetchStoreOnly(t *testing.T, policyFlag string, args string, image string, imageArgs string, finalURL string) {
 	cannotFetchMsgTpl := `unable to fetch image for .* %s`
 	storeMsgTpl := `using image from local store for .* %s`
 	cannotFetchMsg := fmt.Sprintf(cannotFetchMsgTpl, image)
@@ -147,7 +159,7 @@ func testFetchStoreOnly(t *testing.T, args string, image string, imageArgs strin
 	ctx := testutils.NewRktRunCtx()
 	defer ctx.Cleanup()
 
-	cmd := fmt.Sprintf("%s --store-only %s %s %s", ctx.Cmd(), args, image, imageArgs)
+	cmd := fmt.Sprintf("%s %s %s %s %s", ctx.Cmd(), policyFlag, args, image, imageArgs)
 
 	// 1. Run cmd with the image not available in the store should get $cannotFetchMsg.
 	runRktAndCheckRegexOutput(t, cmd, cannotFetchMsg)
@@ -158,7 +170,7 @@ func testFetchStoreOnly(t *testing.T, args string, image string, imageArgs strin
 	runRktAndCheckRegexOutput(t, cmd, storeMsg)
 }
 
-func testFetchNoStore(t *testing.T, args string, image string, imageArgs string, finalURL string) {
+func testFetchNoStore(t *testing.T, policyFlag string, args string, image string, imageArgs string, finalURL string) {
 	remoteFetchMsgTpl := `remote fetching from url %s`
 	remoteFetchMsg := fmt.Sprintf(remoteFetchMsgTpl, finalURL)
 
@@ -167,7 +179,7 @@ func testFetchNoStore(t *testing.T, args string, image string, imageArgs string,
 
 	importImageAndFetchHash(t, ctx, image)
 
-	cmd := fmt.Sprintf("%s --no-store %s %s %s", ctx.Cmd(), args, image, imageArgs)
+	cmd := fmt.Sprintf("%s %s %s %s %s", ctx.Cmd(), policyFlag, args, image, imageArgs)
 
 	// 1. Run cmd with the image available in the store, should get $remoteFetchMsg.
 	child := spawnOrFail(t, cmd)
@@ -215,7 +227,7 @@ func TestResumedFetch(t *testing.T) {
 	ctx := testutils.NewRktRunCtx()
 	defer ctx.Cleanup()
 
-	cmd := fmt.Sprintf("%s --no-store --insecure-skip-verify fetch %s", ctx.Cmd(), server.URL)
+	cmd := fmt.Sprintf("%s --pull-policy=update --insecure-skip-verify fetch %s", ctx.Cmd(), server.URL)
 	child := spawnOrFail(t, cmd)
 	<-kill
 	err := child.Close()
@@ -259,7 +271,7 @@ func TestResumedFetchInvalidCache(t *testing.T) {
 	// Fetch the first half of the image, and kill rkt once it reaches halfway.
 	server := httptest.NewServer(testServerHandler(t, shouldInterrupt, imagePath, kill, reportkill))
 	defer server.Close()
-	cmd := fmt.Sprintf("%s --no-store --insecure-skip-verify fetch %s", ctx.Cmd(), server.URL)
+	cmd := fmt.Sprintf("%s --pull-policy=update --insecure-skip-verify fetch %s", ctx.Cmd(), server.URL)
 	child := spawnOrFail(t, cmd)
 	<-kill
 	err := child.Close()
@@ -80,6 +80,48 @@ func TestImageGCTreeStore(t *testing.T) {
 	}
 }
 
+func TestGCWithImagesKeepsPreparedPods(t *testing.T) {
+	ctx := testutils.NewRktRunCtx()
+	defer ctx.Cleanup()
+
+	expectedTreeStores := 2
+	// If overlayfs is not supported only the stage1 image is rendered in the treeStore
+	if !common.SupportsOverlay() {
+		expectedTreeStores = 1
+	}
+
+	referencedACI := os.Getenv("RKT_INSPECT_IMAGE")
+	cmd := fmt.Sprintf("%s --insecure-skip-verify prepare %s", ctx.Cmd(), referencedACI)
+	uuid := runRktAndGetUUID(t, cmd)
+
+	cmd = fmt.Sprintf("%s gc --grace-period=0s --with-images --image-grace-period=0s", ctx.Cmd())
+	spawnAndWaitOrFail(t, cmd, true)
+
+	treeStoreIDs, err := getTreeStoreIDs(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The treestores of the prepared pod must not be removed
+	if len(treeStoreIDs) != expectedTreeStores {
+		t.Fatalf("expected %d entries in the treestore but found %d entries", expectedTreeStores, len(treeStoreIDs))
+	}
+
+	// The prepared pod must still be runnable
+	cmd = fmt.Sprintf("%s --insecure-skip-verify run-prepared --mds-register=false %s", ctx.Cmd(), uuid)
+	spawnAndWaitOrFail(t, cmd, true)
+
+	cmd = fmt.Sprintf("%s gc --grace-period=0s --with-images --image-grace-period=0s", ctx.Cmd())
+	spawnAndWaitOrFail(t, cmd, true)
+
+	treeStoreIDs, err = getTreeStoreIDs(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(treeStoreIDs) != 0 {
+		t.Fatalf("expected empty treestore but found %d entries", len(treeStoreIDs))
+	}
+}
+
 func getTreeStoreIDs(ctx *testutils.RktRunCtx) (map[string]struct{}, error) {
 	treeStoreIDs := map[string]struct{}{}
 	ls, err := ioutil.ReadDir(filepath.Join(ctx.DataDir(), "cas", "tree"))
@@ -17,6 +17,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"os/exec"
 	"strings"
 	"testing"
 
@@ -169,3 +170,41 @@ func TestShortHash(t *testing.T) {
 		runRktAndCheckOutput(t, runCmd, tt.expect, tt.shouldFail)
 	}
 }
+
+// TestImageListInUse tests that rkt image list tells the images used by a
+// pod from the unused ones.
+func TestImageListInUse(t *testing.T) {
+	ctx := testutils.NewRktRunCtx()
+	defer ctx.Cleanup()
+
+	usedACI := patchTestACI("rkt-inuse-used.aci", "--name=inuse-used")
+	defer os.Remove(usedACI)
+	usedHash := importImageAndFetchHash(t, ctx, usedACI)
+	unusedHash := patchImportAndFetchHash("rkt-inuse-unused.aci", []string{"--name=inuse-unused"}, t, ctx)
+
+	cmd := fmt.Sprintf("%s --insecure-skip-verify prepare %s", ctx.Cmd(), usedACI)
+	runRktAndGetUUID(t, cmd)
+
+	tests := []struct {
+		filter  string
+		listed  string
+		skipped string
+	}{
+		{"in-use", usedHash, unusedHash},
+		{"unused", unusedHash, usedHash},
+	}
+
+	for _, tt := range tests {
+		cmd := fmt.Sprintf("%s image list --fields=id,inuse --full --no-legend --filter=%s", ctx.Cmd(), tt.filter)
+		output, err := exec.Command("/bin/sh", "-c", cmd).CombinedOutput()
+		if err != nil {
+			t.Fatalf("%q failed: %v\nOutput: %s", cmd, err, output)
+		}
+		if !strings.Contains(string(output), tt.listed) {
+			t.Errorf("--filter=%s: image %s not listed\nOutput: %s", tt.filter, tt.listed, output)
+		}
+		if strings.Contains(string(output), tt.skipped) {
+			t.Errorf("--filter=%s: image %s listed\nOutput: %s", tt.filter, tt.skipped, output)
+		}
+	}
+}
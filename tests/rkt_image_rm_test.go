@@ -28,7 +28,7 @@ import (
 )
 
 const (
-	rmImageReferenced = `rkt: image ID %q is referenced by some containers, cannot remove.`
+	rmImageReferenced = `rkt: image ID %q is used by pod(s)`
 	rmImageOk         = "rkt: successfully removed aci for image ID:"
 
 	unreferencedACI = "rkt-unreferencedACI.aci"
@@ -72,18 +72,30 @@ func TestImageRunRm(t *testing.T) {
 		t.Fatalf("rkt didn't terminate correctly: %v", err)
 	}
 
-	t.Logf("Removing stage1 image (should work)")
-	if err := removeImageId(ctx, stage1ImageID, true); err != nil {
+	t.Logf("Removing stage1 image (should fail, used by the exited pod)")
+	if err := removeImageId(ctx, stage1ImageID, false, false); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	t.Logf("Removing image for app %s (should work)", referencedApp)
-	if err := removeImageId(ctx, referencedImageID, true); err != nil {
+	t.Logf("Removing image for app %s (should fail, used by the exited pod)", referencedApp)
+	if err := removeImageId(ctx, referencedImageID, false, false); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
 	t.Logf("Removing image for app %s (should work)", unreferencedApp)
-	if err := removeImageId(ctx, unreferencedImageID, true); err != nil {
+	if err := removeImageId(ctx, unreferencedImageID, false, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	runGC(t, ctx)
+
+	t.Logf("Removing stage1 image after gc (should work)")
+	if err := removeImageId(ctx, stage1ImageID, false, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	t.Logf("Removing image for app %s after gc (should work)", referencedApp)
+	if err := removeImageId(ctx, referencedImageID, false, true); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
@@ -132,18 +144,23 @@ func TestImagePrepareRmRun(t *testing.T) {
 		t.Fatalf("rkt didn't terminate correctly: %v", err)
 	}
 
-	t.Logf("Removing stage1 image (should work)")
-	if err := removeImageId(ctx, stage1ImageID, true); err != nil {
+	t.Logf("Removing stage1 image (should fail, used by the prepared pod)")
+	if err := removeImageId(ctx, stage1ImageID, false, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	t.Logf("Removing stage1 image with --force (should work)")
+	if err := removeImageId(ctx, stage1ImageID, true, true); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	t.Logf("Removing image for app %s (should work)", referencedApp)
-	if err := removeImageId(ctx, referencedImageID, true); err != nil {
+	t.Logf("Removing image for app %s with --force (should work)", referencedApp)
+	if err := removeImageId(ctx, referencedImageID, true, true); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
 	t.Logf("Removing image for app %s (should work)", unreferencedApp)
-	if err := removeImageId(ctx, unreferencedImageID, true); err != nil {
+	if err := removeImageId(ctx, unreferencedImageID, false, true); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
@@ -170,12 +187,12 @@ func getImageId(ctx *testutils.RktRunCtx, name string) (string, error) {
 	return imageID, nil
 }
 
-func removeImageId(ctx *testutils.RktRunCtx, imageID string, shouldWork bool) error {
+func removeImageId(ctx *testutils.RktRunCtx, imageID string, force, shouldWork bool) error {
 	expect := fmt.Sprintf(rmImageReferenced, imageID)
 	if shouldWork {
 		expect = rmImageOk
 	}
-	cmd := fmt.Sprintf("%s image rm %s", ctx.Cmd(), imageID)
+	cmd := fmt.Sprintf("%s image rm --force=%t %s", ctx.Cmd(), force, imageID)
 	child, err := gexpect.Spawn(cmd)
 	if err != nil {
 		return fmt.Errorf("Cannot exec: %v", err)
@@ -183,8 +200,12 @@ func removeImageId(ctx *testutils.RktRunCtx, imageID string, shouldWork bool) er
 	if err := expectWithOutput(child, expect); err != nil {
 		return fmt.Errorf("Expected %q but not found: %v", expect, err)
 	}
-	if err := child.Wait(); err != nil {
+	err = child.Wait()
+	if shouldWork && err != nil {
 		return fmt.Errorf("rkt didn't terminate correctly: %v", err)
 	}
+	if !shouldWork && err == nil {
+		return fmt.Errorf("rkt unexpectedly succeeded")
+	}
 	return nil
 }
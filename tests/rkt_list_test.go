@@ -68,9 +68,9 @@ func TestRktList(t *testing.T) {
 			true,
 			imageID,
 		},
-		// Remove the image
+		// Remove the image, still used by the exited pod
 		{
-			fmt.Sprintf("image rm %s", imageID),
+			fmt.Sprintf("image rm --force %s", imageID),
 			true,
 			"successfully removed",
 		},
@@ -0,0 +1,48 @@
+// Copyright 2015 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coreos/rkt/tests/testutils"
+)
+
+// TestSecretRunPrepared checks that a secret is still mounted in the app when
+// the pod runs after being prepared, its directory having been moved.
+func TestSecretRunPrepared(t *testing.T) {
+	readFileImage := patchTestACI("rkt-inspect-read-secret.aci", "--exec=/inspect --read-file")
+	defer os.Remove(readFileImage)
+	ctx := testutils.NewRktRunCtx()
+	defer ctx.Cleanup()
+
+	tmpdir := createTempDirOrPanic("rkt-tests.")
+	defer os.RemoveAll(tmpdir)
+
+	secretFile := filepath.Join(tmpdir, "secret")
+	if err := ioutil.WriteFile(secretFile, []byte("s3cr3t"), 0600); err != nil {
+		t.Fatalf("Cannot create secret file: %v", err)
+	}
+
+	rktCmd := fmt.Sprintf("%s prepare --insecure-skip-verify --secret=token,source=file:%s --set-env=FILE=/run/secrets/token %s", ctx.Cmd(), secretFile, readFileImage)
+	uuid := runRktAndGetUUID(t, rktCmd)
+
+	rktCmd = fmt.Sprintf("%s run-prepared --mds-register=false %s", ctx.Cmd(), uuid)
+	runRktAndCheckOutput(t, rktCmd, "<<<s3cr3t>>>", false)
+}